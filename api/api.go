@@ -33,25 +33,32 @@ import (
 	"net/http"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/bmt"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/contracts/ens"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/spancontext"
 	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/encryption"
 	"github.com/ethersphere/swarm/storage/feed"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
 	"github.com/opentracing/opentracing-go"
+	"golang.org/x/crypto/sha3"
 )
 
 var (
 	apiResolveCount        = metrics.NewRegisteredCounter("api/resolve/count", nil)
 	apiResolveFail         = metrics.NewRegisteredCounter("api/resolve/fail", nil)
+	apiResolveCacheHit     = metrics.NewRegisteredCounter("api/resolve/cache/hit", nil)
 	apiGetCount            = metrics.NewRegisteredCounter("api/get/count", nil)
 	apiGetNotFound         = metrics.NewRegisteredCounter("api/get/notfound", nil)
 	apiGetHTTP300          = metrics.NewRegisteredCounter("api/get/http/300", nil)
@@ -76,6 +83,15 @@ var (
 	apiGetInvalid          = metrics.NewRegisteredCounter("api/get/invalid", nil)
 )
 
+const (
+	bmtSegmentCount = chunk.DefaultSize / 32 // number of segments in the BMT of a chunk
+	bmtProofLength  = 7                      // number of sisters in the BMT inclusion proof of a segment
+)
+
+// TarWhiteoutPrefix is the name prefix of the tar entries marking the removal of a file
+// from the manifest, following the whiteout convention of container image layers
+const TarWhiteoutPrefix = ".wh."
+
 // ResolverFunc is function which takes a domain in the form of a string and resolves it to a content hash
 type ResolverFunc func(domain string) (common.Hash, error)
 
@@ -94,6 +110,12 @@ type ResolveValidator interface {
 	HeaderByNumber(context.Context, *big.Int) (*types.Header, error)
 }
 
+// ReverseResolver is implemented by the resolvers able to resolve an address
+// to a name, which resolves to the address
+type ReverseResolver interface {
+	ReverseResolve(common.Address) (string, error)
+}
+
 // NoResolverError is returned by MultiResolver.Resolve if no resolver
 // can be found for the address.
 type NoResolverError struct {
@@ -115,10 +137,13 @@ func (e *NoResolverError) Error() string {
 
 // MultiResolver is used to resolve URL addresses based on their TLDs.
 // Each TLD can have multiple resolvers, and the resolution from the
-// first one in the sequence will be returned.
+// first one in the sequence will be returned. Resolved names are cached
+// for the TTL configured for their TLD.
 type MultiResolver struct {
-	resolvers map[string][]ResolveValidator
+	resolvers map[string][]Resolver
 	nameHash  func(string) common.Hash
+	ttls      map[string]time.Duration
+	cache     *resolverCache
 }
 
 // MultiResolverOption sets options for MultiResolver and is used as
@@ -130,16 +155,35 @@ type MultiResolverOption func(*MultiResolver)
 // to the list of default resolver, the ones that will be used for resolution
 // of addresses which do not have their TLD resolver specified.
 func MultiResolverOptionWithResolver(r ResolveValidator, tld string) MultiResolverOption {
+	return MultiResolverOptionWithNameService(r, tld)
+}
+
+// MultiResolverOptionWithNameService adds a Resolver of a name service other
+// than ENS to a list of resolvers for a specific TLD, in the same way as
+// MultiResolverOptionWithResolver.
+func MultiResolverOptionWithNameService(r Resolver, tld string) MultiResolverOption {
 	return func(m *MultiResolver) {
 		m.resolvers[tld] = append(m.resolvers[tld], r)
 	}
 }
 
+// MultiResolverOptionWithCacheTTL sets the duration for which the names of a
+// specific TLD are cached once resolved. If TLD is an empty string, the duration
+// applies to the names of TLDs without their own. Names are not cached if the
+// duration is zero, which is the default.
+func MultiResolverOptionWithCacheTTL(ttl time.Duration, tld string) MultiResolverOption {
+	return func(m *MultiResolver) {
+		m.ttls[tld] = ttl
+	}
+}
+
 // NewMultiResolver creates a new instance of MultiResolver.
 func NewMultiResolver(opts ...MultiResolverOption) (m *MultiResolver) {
 	m = &MultiResolver{
-		resolvers: make(map[string][]ResolveValidator),
+		resolvers: make(map[string][]Resolver),
 		nameHash:  ens.EnsNode,
+		ttls:      make(map[string]time.Duration),
+		cache:     newResolverCache(),
 	}
 	for _, o := range opts {
 		o(m)
@@ -152,21 +196,51 @@ func NewMultiResolver(opts ...MultiResolverOption) (m *MultiResolver) {
 // the Hash from the first one which does not return error
 // will be returned.
 func (m *MultiResolver) Resolve(addr string) (h common.Hash, err error) {
-	rs, err := m.getResolveValidator(addr)
+	if h, ok := m.cache.get(addr); ok {
+		apiResolveCacheHit.Inc(1)
+		return h, nil
+	}
+	rs, err := m.getResolvers(addr)
 	if err != nil {
 		return h, err
 	}
 	for _, r := range rs {
 		h, err = r.Resolve(addr)
 		if err == nil {
+			m.cache.put(addr, h, m.cacheTTL(addr))
 			return
 		}
 	}
 	return
 }
 
-// getResolveValidator uses the hostname to retrieve the resolver associated with the top level domain
-func (m *MultiResolver) getResolveValidator(name string) ([]ResolveValidator, error) {
+// ReverseResolve returns the name of an address from the first resolver
+// supporting reverse resolution which has a record for it. The default
+// resolvers are asked first, then the ones of the TLDs in alphabetical order.
+func (m *MultiResolver) ReverseResolve(addr common.Address) (name string, err error) {
+	tlds := make([]string, 0, len(m.resolvers))
+	for tld := range m.resolvers {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+	err = errors.New("no reverse resolver")
+	for _, tld := range tlds {
+		for _, r := range m.resolvers[tld] {
+			rr, ok := r.(ReverseResolver)
+			if !ok {
+				continue
+			}
+			name, err = rr.ReverseResolve(addr)
+			if err == nil {
+				return name, nil
+			}
+		}
+	}
+	return "", err
+}
+
+// getResolvers uses the hostname to retrieve the resolvers associated with the top level domain
+func (m *MultiResolver) getResolvers(name string) ([]Resolver, error) {
 	rs := m.resolvers[""]
 	tld := path.Ext(name)
 	if tld != "" {
@@ -182,6 +256,14 @@ func (m *MultiResolver) getResolveValidator(name string) ([]ResolveValidator, er
 	return rs, nil
 }
 
+// cacheTTL returns the duration for which the name is cached once resolved
+func (m *MultiResolver) cacheTTL(name string) time.Duration {
+	if ttl, ok := m.ttls[tld(name)]; ok {
+		return ttl
+	}
+	return m.ttls[""]
+}
+
 /*
 API implements webserver/file system related content storage and retrieval
 on top of the FileStore
@@ -194,6 +276,15 @@ type API struct {
 	rns       Resolver //provides access to rns resolvers
 	Tags      *chunk.Tags
 	Decryptor func(context.Context, string) DecryptFunc
+
+	// Popularity counts the requests for served content, nil if tracking is disabled
+	Popularity *Popularity
+	// DNSLink resolves the domains of the requests to the linked content, nil if disabled
+	DNSLink *DNSLink
+	// FeedScheduler publishes feed updates signed for future epochs, nil if scheduling is disabled
+	FeedScheduler *feed.Scheduler
+	// Kademlia is the view of the overlay network served for visualization, nil if not available
+	Kademlia *network.Kademlia
 }
 
 // NewAPI the api constructor initialises a new API instance.
@@ -216,6 +307,12 @@ func (a *API) Retrieve(ctx context.Context, addr storage.Address) (reader storag
 	return a.fileStore.Retrieve(ctx, addr)
 }
 
+// RetrieveProgressive FileStore progressive reader API
+// the reader returns bytes as soon as the leading chunks arrive, it should be closed after use
+func (a *API) RetrieveProgressive(ctx context.Context, addr storage.Address, params *storage.ProgressiveReaderParams) *storage.ProgressiveReader {
+	return a.fileStore.RetrieveProgressive(ctx, addr, params)
+}
+
 func (a *API) RetrieveFeedUpdate(ctx context.Context, addr storage.Address) ([]byte, error) {
 	chunk, err := a.fileStore.ChunkStore.Get(ctx, chunk.ModeGetRequest, addr)
 	if err != nil {
@@ -224,12 +321,56 @@ func (a *API) RetrieveFeedUpdate(ctx context.Context, addr storage.Address) ([]b
 	return chunk.Data(), err
 }
 
-// Store wraps the Store API call of the embedded FileStore
+// ErrNotContentAddressed is returned if an inclusion proof is requested for a chunk
+// that is not content addressed, e.g. a feed update
+var ErrNotContentAddressed = errors.New("chunk is not content addressed")
+
+// BMTProof returns the BMT inclusion proof of the segment with index i of the
+// content addressed chunk with the given address
+func (a *API) BMTProof(ctx context.Context, addr storage.Address, i int) (*bmt.InclusionProof, error) {
+	ch, err := a.fileStore.ChunkStore.Get(ctx, chunk.ModeGetRequest, addr)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := bmt.NewInclusionProof(sha3.NewLegacyKeccak256, bmtSegmentCount, ch.Data(), i)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifyBMTProof(addr, proof) {
+		return nil, ErrNotContentAddressed
+	}
+	return proof, nil
+}
+
+// VerifyBMTProof reports whether the BMT inclusion proof is valid for the content
+// addressed chunk with the given address
+func VerifyBMTProof(addr storage.Address, proof *bmt.InclusionProof) bool {
+	return proof != nil && len(proof.Sisters) == bmtProofLength && bmt.VerifyInclusionProof(sha3.NewLegacyKeccak256, addr, proof)
+}
+
+// Store wraps the Store API call of the embedded FileStore. Encrypted data is
+// stored with the key derived for the empty path from the master key of the
+// context, if the context has neither a master key nor the key of a path set
+// with pathEncryptionContext, with random keys.
 func (a *API) Store(ctx context.Context, data io.Reader, size int64, toEncrypt bool) (addr storage.Address, wait func(ctx context.Context) error, err error) {
 	log.Debug("api.store", "size", size)
+	if sctx.GetEncryptionKey(ctx) == nil {
+		ctx = pathEncryptionContext(ctx, "")
+	}
 	return a.fileStore.Store(ctx, data, size, toEncrypt)
 }
 
+// pathEncryptionContext returns the context with the encryption key of the
+// content at the path derived from the master key of the context, so that
+// the same content at the same path is stored to the same reference
+func pathEncryptionContext(ctx context.Context, path string) context.Context {
+	master := sctx.GetMasterKey(ctx)
+	if master == nil {
+		return ctx
+	}
+	return sctx.SetEncryptionKey(ctx, encryption.DeriveKey(master, path))
+}
+
 // Resolve a name into a content-addressed hash
 // where address could be an ENS/RNS name, or a content addressed hash
 func (a *API) Resolve(ctx context.Context, address string) (storage.Address, error) {
@@ -337,8 +478,14 @@ func (a *API) ResolveURI(ctx context.Context, uri *URI, credentials string) (sto
 // to resolve basePath to content using FileStore retrieve
 // it returns a section reader, mimeType, status, the key of the actual content and an error
 func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string) (reader storage.LazySectionReader, mimeType string, status int, contentAddr storage.Address, err error) {
-	log.Debug("api.get", "key", manifestAddr, "path", path)
 	apiGetCount.Inc(1)
+	return a.get(ctx, decrypt, manifestAddr, path, make(symlinkHops))
+}
+
+// get resolves path in the manifest at manifestAddr, following symlink entries
+// not yet recorded in hops
+func (a *API) get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string, hops symlinkHops) (reader storage.LazySectionReader, mimeType string, status int, contentAddr storage.Address, err error) {
+	log.Debug("api.get", "key", manifestAddr, "path", path)
 	trie, err := loadManifest(ctx, a.fileStore, manifestAddr, nil, decrypt)
 	if err != nil {
 		apiGetNotFound.Inc(1)
@@ -347,7 +494,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 	}
 
 	log.Debug("trie getting entry", "key", manifestAddr, "path", path)
-	entry, _ := trie.getEntry(path)
+	entry, fullpath := trie.getEntry(path)
 
 	if entry != nil {
 		log.Debug("trie got entry", "key", manifestAddr, "path", path, "entry.Hash", entry.Hash)
@@ -358,7 +505,22 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 			if err != nil {
 				return nil, "", 0, nil, err
 			}
-			return a.Get(ctx, decrypt, adr, entry.Path)
+			return a.get(ctx, decrypt, adr, entry.Path, hops)
+		}
+
+		if entry.ContentType == SymlinkContentType {
+			target, err := a.resolveSymlink(ctx, &entry.ManifestEntry)
+			if err != nil {
+				apiGetNotFound.Inc(1)
+				return nil, "", http.StatusNotFound, nil, err
+			}
+			rest := RegularSlashes(path)[len(fullpath):]
+			if err := hops.follow(target, rest); err != nil {
+				apiGetInvalid.Inc(1)
+				return nil, "", http.StatusLoopDetected, nil, err
+			}
+			log.Debug("entry is symlink", "key", manifestAddr, "target", target, "path", rest)
+			return a.get(ctx, decrypt, target, rest, hops)
 		}
 
 		// we need to do some extra work if this is a Swarm feed manifest
@@ -366,13 +528,14 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 			if entry.Feed == nil {
 				return reader, mimeType, status, nil, fmt.Errorf("Cannot decode Feed in manifest")
 			}
-			_, err := a.feed.Lookup(ctx, feed.NewQueryLatest(entry.Feed, lookup.NoClue))
+			update, err := a.feed.Lookup(ctx, feed.NewQueryLatest(entry.Feed, lookup.NoClue))
 			if err != nil {
 				apiGetNotFound.Inc(1)
 				status = http.StatusNotFound
 				log.Debug(fmt.Sprintf("get feed update content error: %v", err))
 				return reader, mimeType, status, nil, err
 			}
+			recordResolvedFeed(ctx, entry.Feed, update.Epoch)
 			// get the data of the update
 			_, contentAddr, err := a.feed.GetContent(entry.Feed)
 			if err != nil {
@@ -697,6 +860,9 @@ func (a *API) AddFile(ctx context.Context, mhash, path, fname string, content []
 	return fkey, newMkey.String(), nil
 }
 
+// UploadTar adds the regular files of the tar stream to the manifest under the manifest path.
+// Whiteout entries, named with the TarWhiteoutPrefix, remove the file they name instead,
+// so that a tar of the changes to a directory patches a previous manifest of it.
 func (a *API) UploadTar(ctx context.Context, bodyReader io.ReadCloser, manifestPath, defaultPath string, mw *ManifestWriter) (storage.Address, error) {
 	apiUploadTarCount.Inc(1)
 	var contentKey storage.Address
@@ -717,6 +883,20 @@ func (a *API) UploadTar(ctx context.Context, bodyReader io.ReadCloser, manifestP
 			continue
 		}
 
+		// whiteout entries remove the file they name from the manifest
+		if dir, name := path.Split(hdr.Name); strings.HasPrefix(name, TarWhiteoutPrefix) {
+			name = strings.TrimPrefix(name, TarWhiteoutPrefix)
+			if name == "" {
+				apiUploadTarFail.Inc(1)
+				return nil, fmt.Errorf("invalid whiteout entry %q", hdr.Name)
+			}
+			if err := mw.RemoveEntry(path.Join(manifestPath, dir, name)); err != nil {
+				apiUploadTarFail.Inc(1)
+				return nil, fmt.Errorf("error removing manifest entry of whiteout %q: %s", hdr.Name, err)
+			}
+			continue
+		}
+
 		// add the entry under the path from the request
 		manifestPath := path.Join(manifestPath, hdr.Name)
 		contentType := hdr.Xattrs["user.swarm.content-type"]
@@ -930,16 +1110,42 @@ func (a *API) FeedsLookup(ctx context.Context, query *feed.Query) ([]byte, error
 	return data, nil
 }
 
+// FeedsHistory calls fn with the past updates of the feed with timestamps between from and to, latest first
+func (a *API) FeedsHistory(ctx context.Context, fd *feed.Feed, from, to uint64, limit int, fn func(*feed.HistoryEntry) error) error {
+	return a.feed.History(ctx, fd, from, to, limit, fn)
+}
+
 // FeedsNewRequest creates a Request object to update a specific feed
 func (a *API) FeedsNewRequest(ctx context.Context, feed *feed.Feed) (*feed.Request, error) {
 	return a.feed.NewRequest(ctx, feed)
 }
 
+// FeedsNewRequestAt creates a Request object to update a specific feed at the given time
+func (a *API) FeedsNewRequestAt(ctx context.Context, feed *feed.Feed, at uint64) (*feed.Request, error) {
+	return a.feed.NewRequestAt(ctx, feed, at)
+}
+
 // FeedsUpdate publishes a new update on the given feed
 func (a *API) FeedsUpdate(ctx context.Context, request *feed.Request) (storage.Address, error) {
 	return a.feed.Update(ctx, request)
 }
 
+// ErrFeedSchedulingDisabled is returned when scheduling a feed update without a scheduler
+var ErrFeedSchedulingDisabled = errors.New("feed update scheduling is disabled")
+
+// FeedsSchedule keeps a signed update until the time of its epoch, when it is published
+func (a *API) FeedsSchedule(ctx context.Context, request *feed.Request) (storage.Address, error) {
+	if a.FeedScheduler == nil {
+		return nil, ErrFeedSchedulingDisabled
+	}
+	return a.FeedScheduler.Schedule(request)
+}
+
+// FeedsUpdateBatch signs and publishes updates to several feeds, rolling back the published ones if any update fails
+func (a *API) FeedsUpdateBatch(ctx context.Context, signer feed.Signer, updates []*feed.BatchUpdate) ([]storage.Address, error) {
+	return a.feed.UpdateBatch(ctx, signer, updates)
+}
+
 // ErrCannotLoadFeedManifest is returned when looking up a feeds manifest fails
 var ErrCannotLoadFeedManifest = errors.New("Cannot load feed manifest")
 
@@ -645,3 +645,36 @@ func putString(ctx context.Context, a *API, content string, contentType string,
 		return waitManifest(ctx)
 	}, nil
 }
+
+// TestBMTProof tests that the BMT inclusion proofs of the chunks of stored
+// content are valid and that they are not valid for other chunks
+func TestBMTProof(t *testing.T) {
+	testAPI(t, func(api *API, _ *chunk.Tags, toEncrypt bool) {
+		if toEncrypt {
+			return
+		}
+		ctx := context.TODO()
+		addr, wait, err := putString(ctx, api, "bmt inclusion proof", "text/plain", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range []int{0, 1, 127} {
+			proof, err := api.BMTProof(ctx, addr, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyBMTProof(addr, proof) {
+				t.Fatalf("segment %d: expected valid proof", i)
+			}
+			if VerifyBMTProof(make(storage.Address, len(addr)), proof) {
+				t.Fatalf("segment %d: expected invalid proof for another address", i)
+			}
+		}
+		if _, err := api.BMTProof(ctx, addr, 128); err == nil {
+			t.Fatal("expected error for segment index out of range")
+		}
+	})
+}
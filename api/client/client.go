@@ -54,18 +54,46 @@ var (
 
 func NewClient(gateway string) *Client {
 	jar, _ := cookiejar.New(nil) // New always returns nil error
-	return &Client{
+	c := &Client{
 		Gateway: gateway,
-		httpClient: &http.Client{
-			Jar: jar,
-		},
+		Policy:  DefaultPolicy(),
+	}
+	c.httpClient = &http.Client{
+		Jar:       jar,
+		Transport: &tokenTransport{client: c, base: http.DefaultTransport},
 	}
+	return c
 }
 
 // Client wraps interaction with a swarm HTTP gateway.
 type Client struct {
-	Gateway    string
-	httpClient *http.Client
+	Gateway       string
+	Token         string // API token sent with the requests if the gateway requires authentication
+	Policy        Policy // retries and timeouts of the operations
+	Chunking      string // chunking scheme of the uploads, fixed if empty
+	Compression   string // compression of the data chunks of unencrypted uploads, none if empty
+	EncryptionKey string // hex encoded master key or mnemonic the keys of encrypted uploads are derived from, random keys if empty
+	httpClient    *http.Client
+}
+
+// do sends the request of the operation, retrying and timing it out according to the policy
+func (c *Client) do(op Operation, req *http.Request) (*http.Response, error) {
+	return c.Policy.do(c.httpClient, op, req)
+}
+
+// tokenTransport adds the API token of the client to the requests
+type tokenTransport struct {
+	client *Client
+	base   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.client.Token == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.client.Token)
+	return t.base.RoundTrip(req)
 }
 
 // UploadRaw uploads raw data to swarm and returns the resulting hash. If toEncrypt is true it
@@ -84,13 +112,22 @@ func (c *Client) UploadRaw(r io.Reader, size int64, toEncrypt, toPin, anonymous
 	}
 	req.ContentLength = size
 	req.Header.Set(swarmhttp.TagHeaderName, fmt.Sprintf("raw_upload_%d", time.Now().Unix()))
+	if c.Chunking != "" {
+		req.Header.Set(swarmhttp.ChunkingHeaderName, c.Chunking)
+	}
+	if c.Compression != "" {
+		req.Header.Set(swarmhttp.CompressionHeaderName, c.Compression)
+	}
+	if c.EncryptionKey != "" {
+		req.Header.Set(swarmhttp.EncryptionKeyHeaderName, c.EncryptionKey)
+	}
 
 	// Set the pinning header if the file needs to be pinned
 	if toPin {
 		req.Header.Set(swarmhttp.PinHeaderName, "true")
 	}
 
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpUpload, req)
 	if err != nil {
 		return "", err
 	}
@@ -108,8 +145,11 @@ func (c *Client) UploadRaw(r io.Reader, size int64, toEncrypt, toPin, anonymous
 // DownloadRaw downloads raw data from swarm and it returns a ReadCloser and a bool whether the
 // content was encrypted
 func (c *Client) DownloadRaw(hash string) (io.ReadCloser, bool, error) {
-	uri := c.Gateway + "/bzz-raw:/" + hash
-	res, err := c.httpClient.Get(uri)
+	req, err := http.NewRequest(http.MethodGet, c.Gateway+"/bzz-raw:/"+hash, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := c.do(OpDownload, req)
 	if err != nil {
 		return nil, false, err
 	}
@@ -173,8 +213,11 @@ func (c *Client) Upload(file *File, manifest string, toEncrypt, toPin, anonymous
 // Download downloads a file with the given path from the swarm manifest with
 // the given hash (i.e. it gets bzz:/<hash>/<path>)
 func (c *Client) Download(hash, path string) (*File, error) {
-	uri := c.Gateway + "/bzz:/" + hash + "/" + path
-	res, err := c.httpClient.Get(uri)
+	req, err := http.NewRequest(http.MethodGet, c.Gateway+"/bzz:/"+hash+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(OpDownload, req)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +277,7 @@ func (c *Client) DownloadDirectory(hash, path, destDir, credentials string) erro
 		req.SetBasicAuth("", credentials)
 	}
 	req.Header.Set("Accept", "application/x-tar")
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpDownload, req)
 	if err != nil {
 		return err
 	}
@@ -319,7 +362,7 @@ func (c *Client) DownloadFile(hash, path, dest, credentials string) error {
 	if credentials != "" {
 		req.SetBasicAuth("", credentials)
 	}
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpDownload, req)
 	if err != nil {
 		return err
 	}
@@ -418,7 +461,7 @@ func (c *Client) List(hash, prefix, credentials string) (*api.ManifestList, erro
 	if credentials != "" {
 		req.SetBasicAuth("", credentials)
 	}
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpList, req)
 	if err != nil {
 		return nil, err
 	}
@@ -536,7 +579,6 @@ func (c *Client) TarUpload(hash string, uploader Uploader, defaultPath string, t
 	trace := GetClientTrace("swarm api client - upload tar", "api.client.uploadtar", uuid.New()[:8], &tn)
 
 	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
-	transport := http.DefaultTransport
 
 	req.Header.Set("Content-Type", "application/x-tar")
 	if defaultPath != "" {
@@ -552,6 +594,15 @@ func (c *Client) TarUpload(hash string, uploader Uploader, defaultPath string, t
 	log.Trace("setting upload tag", "tag", tag)
 
 	req.Header.Set(swarmhttp.TagHeaderName, tag)
+	if c.Chunking != "" {
+		req.Header.Set(swarmhttp.ChunkingHeaderName, c.Chunking)
+	}
+	if c.Compression != "" {
+		req.Header.Set(swarmhttp.CompressionHeaderName, c.Compression)
+	}
+	if c.EncryptionKey != "" {
+		req.Header.Set(swarmhttp.EncryptionKeyHeaderName, c.EncryptionKey)
+	}
 
 	// Set the pinning header if the file is to be pinned
 	if toPin {
@@ -592,7 +643,7 @@ func (c *Client) TarUpload(hash string, uploader Uploader, defaultPath string, t
 		reqW.CloseWithError(err)
 	}()
 	tn = time.Now()
-	res, err := transport.RoundTrip(req)
+	res, err := c.do(OpUpload, req)
 	if err != nil {
 		return "", err
 	}
@@ -624,6 +675,15 @@ func (c *Client) MultipartUpload(hash string, uploader Uploader, toPin, anonymou
 	mw := multipart.NewWriter(reqW)
 	req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=%q", mw.Boundary()))
 	req.Header.Set(swarmhttp.TagHeaderName, fmt.Sprintf("multipart_upload_%d", time.Now().Unix()))
+	if c.Chunking != "" {
+		req.Header.Set(swarmhttp.ChunkingHeaderName, c.Chunking)
+	}
+	if c.Compression != "" {
+		req.Header.Set(swarmhttp.CompressionHeaderName, c.Compression)
+	}
+	if c.EncryptionKey != "" {
+		req.Header.Set(swarmhttp.EncryptionKeyHeaderName, c.EncryptionKey)
+	}
 	if toPin {
 		req.Header.Set(swarmhttp.PinHeaderName, "true")
 	}
@@ -652,7 +712,7 @@ func (c *Client) MultipartUpload(hash string, uploader Uploader, toPin, anonymou
 		reqW.CloseWithError(err)
 	}()
 
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpUpload, req)
 	if err != nil {
 		return "", err
 	}
@@ -675,7 +735,7 @@ func (c *Client) TagByHash(hash string) (*chunk.Tag, error) {
 		return nil, err
 	}
 
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpTag, req)
 	if err != nil {
 		return nil, err
 	}
@@ -702,7 +762,7 @@ var ErrNoFeedUpdatesFound = errors.New("No updates found for this feed")
 // Returns the resulting feed manifest address that you can use to include in an ENS Resolver (setContent)
 // or reference future updates (Client.UpdateFeed)
 func (c *Client) CreateFeedWithManifest(request *feed.Request) (string, error) {
-	responseStream, err := c.updateFeed(request, true)
+	responseStream, err := c.updateFeed(request, true, false)
 	if err != nil {
 		return "", err
 	}
@@ -722,11 +782,18 @@ func (c *Client) CreateFeedWithManifest(request *feed.Request) (string, error) {
 
 // UpdateFeed allows you to set a new version of your content
 func (c *Client) UpdateFeed(request *feed.Request) error {
-	_, err := c.updateFeed(request, false)
+	_, err := c.updateFeed(request, false, false)
+	return err
+}
+
+// ScheduleFeedUpdate sends a signed feed update for a future epoch to the node,
+// which publishes it at the time of the epoch
+func (c *Client) ScheduleFeedUpdate(request *feed.Request) error {
+	_, err := c.updateFeed(request, false, true)
 	return err
 }
 
-func (c *Client) updateFeed(request *feed.Request, createManifest bool) (io.ReadCloser, error) {
+func (c *Client) updateFeed(request *feed.Request, createManifest bool, schedule bool) (io.ReadCloser, error) {
 	URL, err := url.Parse(c.Gateway)
 	if err != nil {
 		return nil, err
@@ -737,6 +804,9 @@ func (c *Client) updateFeed(request *feed.Request, createManifest bool) (io.Read
 	if createManifest {
 		values.Set("manifest", "1")
 	}
+	if schedule {
+		values.Set("schedule", "1")
+	}
 	URL.RawQuery = values.Encode()
 
 	req, err := http.NewRequest("POST", URL.String(), bytes.NewBuffer(body))
@@ -744,7 +814,7 @@ func (c *Client) updateFeed(request *feed.Request, createManifest bool) (io.Read
 		return nil, err
 	}
 
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(OpFeedUpdate, req)
 	if err != nil {
 		return nil, err
 	}
@@ -777,7 +847,11 @@ func (c *Client) queryFeed(query *feed.Query, manifestAddressOrDomain string, me
 		values.Set("meta", "1")
 	}
 	URL.RawQuery = values.Encode()
-	res, err := http.Get(URL.String())
+	req, err := http.NewRequest(http.MethodGet, URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(OpFeedLookup, req)
 	if err != nil {
 		return nil, err
 	}
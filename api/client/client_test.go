@@ -18,11 +18,13 @@ package client
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -30,6 +32,7 @@ import (
 	"github.com/ethersphere/swarm/api"
 	swarmhttp "github.com/ethersphere/swarm/api/http"
 	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
@@ -54,6 +57,51 @@ func TestClientUploadDownloadRaw(t *testing.T) {
 	chunktesting.CheckTag(t, tag, 1, 1, 0, 0, 0, 1)
 }
 
+// TestClientToken tests that the client sends its API token to gateways requiring authentication
+func TestClientToken(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	auth, err := swarmhttp.NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := auth.Mint(swarmhttp.ScopeAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := swarmhttp.NewTestSwarmServer(t, func(api *api.API, pinAPI *pin.API) swarmhttp.TestServer {
+		server := swarmhttp.NewServer(api, pinAPI, "")
+		if err := server.SetAuth(auth, nil); err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}, nil, nil)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	data := []byte("foo123")
+	if _, err := client.UploadRaw(bytes.NewReader(data), int64(len(data)), false, false, true); err == nil {
+		t.Fatal("expected error uploading without token")
+	}
+	client.Token = token
+	hash, err := client.UploadRaw(bytes.NewReader(data), int64(len(data)), false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := client.DownloadRaw(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	got, err := ioutil.ReadAll(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("expected downloaded data to be %q, got %q", data, got)
+	}
+}
+
 func TestClientUploadDownloadRawEncrypted(t *testing.T) {
 
 	if testutil.RaceEnabled {
@@ -72,6 +120,77 @@ func TestClientUploadDownloadRawEncrypted(t *testing.T) {
 	chunktesting.CheckTag(t, tag, 1, 1, 0, 0, 0, 1)
 }
 
+// TestClientUploadContentDefined tests uploading with content-defined chunking
+func TestClientUploadContentDefined(t *testing.T) {
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	client.Chunking = storage.ChunkingContentDefined
+	data := testutil.RandomBytes(1, 20000)
+	hash, err := client.UploadRaw(bytes.NewReader(data), int64(len(data)), false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(hash, fmt.Sprintf("%02x", storage.ContentDefinedChunking)) {
+		t.Fatalf("expected content-defined root address, got %s", hash)
+	}
+	res, _, err := client.DownloadRaw(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	gotData, err := ioutil.ReadAll(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotData, data) {
+		t.Fatal("downloaded data differs from the uploaded data")
+	}
+}
+
+// TestClientUploadCompressed tests that uploads with compression are recorded
+// in their manifest entries and downloaded correctly
+func TestClientUploadCompressed(t *testing.T) {
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	client.Compression = storage.CompressionSnappy
+	data := bytes.Repeat([]byte("compressible "), 2000)
+	file := &File{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(data)),
+		ManifestEntry: api.ManifestEntry{
+			Path:        "file.txt",
+			ContentType: "text/plain",
+			Size:        int64(len(data)),
+		},
+	}
+	hash, err := client.Upload(file, "", false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, _, err := client.DownloadManifest(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Entries) != 1 || manifest.Entries[0].Compression != storage.CompressionSnappy {
+		t.Fatalf("expected an entry compressed with snappy, got %+v", manifest.Entries)
+	}
+	downloaded, err := client.Download(hash, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer downloaded.Close()
+	gotData, err := ioutil.ReadAll(downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotData, data) {
+		t.Fatal("downloaded data differs from the uploaded data")
+	}
+}
+
 func testClientUploadDownloadRaw(srv *swarmhttp.TestSwarmServer, toEncrypt bool, t *testing.T, data []byte, toPin bool) string {
 	client := NewClient(srv.URL)
 
@@ -140,8 +259,8 @@ func testClientUploadDownloadFiles(toEncrypt bool, t *testing.T) string {
 		if file.Size != int64(len(expected)) {
 			t.Fatalf("expected downloaded file to be %d bytes, got %d", len(expected), file.Size)
 		}
-		if file.ContentType != "text/plain" {
-			t.Fatalf("expected downloaded file to have type %q, got %q", "text/plain", file.ContentType)
+		if file.ContentType != "text/plain; charset=utf-8" {
+			t.Fatalf("expected downloaded file to have type %q, got %q", "text/plain; charset=utf-8", file.ContentType)
 		}
 		data, err := ioutil.ReadAll(file)
 		if err != nil {
@@ -272,6 +391,95 @@ func TestClientUploadDownloadDirectory(t *testing.T) {
 	}
 }
 
+// TestClientUploadDirectoryDiff tests uploading the changes of a directory
+// to the manifest of a previous upload of it
+func TestClientUploadDirectoryDiff(t *testing.T) {
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	dir := newTestDirectory(t)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(srv.URL)
+	defaultPath := testDirFiles[0]
+	base, err := client.UploadDirectory(dir, defaultPath, "", false, false, true)
+	if err != nil {
+		t.Fatalf("error uploading directory: %s", err)
+	}
+
+	// nothing changed but the default path
+	hash, err := client.UploadDirectoryDiff(dir, defaultPath, base, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != base {
+		t.Fatalf("expected unchanged manifest %s, got %s", base, hash)
+	}
+
+	// modify, add and remove files
+	if err := ioutil.WriteFile(filepath.Join(dir, "dir1/file3.txt"), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "dir2/dir4/file8.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := client.DiffDirectory(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"dir1/file3.txt", "new.txt"}) {
+		t.Fatalf("unexpected changed files %v", diff.Changed)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"dir2/dir4/file8.txt"}) {
+		t.Fatalf("unexpected removed files %v", diff.Removed)
+	}
+	if diff.Unchanged != 6 {
+		t.Fatalf("expected 6 unchanged files, got %d", diff.Unchanged)
+	}
+
+	hash, err = client.UploadDirectoryDiff(dir, defaultPath, base, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"":                    testDirFiles[0],
+		"file2.txt":           "file2.txt",
+		"dir1/file3.txt":      "modified",
+		"new.txt":             "new",
+		"dir2/dir4/file7.txt": "dir2/dir4/file7.txt",
+	} {
+		file, err := client.Download(hash, path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("%s: expected data to be %q, got %q", path, expected, data)
+		}
+	}
+	if _, err := client.Download(hash, "dir2/dir4/file8.txt"); err == nil {
+		t.Fatal("expected removed file not to be found")
+	}
+
+	// the patched manifest matches the upload of the whole directory
+	full, err := client.UploadDirectory(dir, defaultPath, "", false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != full {
+		t.Fatalf("expected manifest %s, got %s", full, hash)
+	}
+}
+
 // TestClientFileList tests listing files in a swarm manifest
 func TestClientFileList(t *testing.T) {
 	testClientFileList(false, t)
@@ -648,3 +856,61 @@ func TestClientCreateUpdateFeed(t *testing.T) {
 		t.Fatalf("Expected: %v, got %v", databytes, gotData)
 	}
 }
+
+// TestClientScheduleFeedUpdate tests that an update signed for a future time is
+// accepted by the node and kept until its time instead of being published
+func TestClientScheduleFeedUpdate(t *testing.T) {
+	signer, _ := newTestSigner()
+
+	var swarmAPI *api.API
+	srv := swarmhttp.NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) swarmhttp.TestServer {
+		swarmAPI = a
+		return swarmhttp.NewServer(a, pinAPI, "")
+	}, nil, nil)
+	client := NewClient(srv.URL)
+	defer srv.Close()
+
+	topic, _ := feed.NewTopic("embargo", nil)
+	createRequest := feed.NewFirstRequest(topic)
+	createRequest.SetData([]byte("coming soon"))
+	if err := createRequest.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	manifestAddr, err := client.CreateFeedWithManifest(createRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := srv.CurrentTime + 3600
+	updateRequest, err := client.GetFeedRequest(&feed.Query{TimeLimit: release}, manifestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updateRequest.Epoch.Time != release {
+		t.Fatalf("got update request for time %d, want %d", updateRequest.Epoch.Time, release)
+	}
+	updateRequest.SetData([]byte("released"))
+	if err := updateRequest.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ScheduleFeedUpdate(updateRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := swarmAPI.FeedScheduler.Scheduled()
+	if len(scheduled) != 1 || scheduled[0].Time != release || scheduled[0].Feed != updateRequest.Feed {
+		t.Fatalf("unexpected scheduled updates %v", scheduled)
+	}
+	reader, err := client.QueryFeed(nil, manifestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "coming soon" {
+		t.Fatalf("got feed content %q before release", data)
+	}
+}
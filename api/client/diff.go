@@ -0,0 +1,224 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// DirectoryDiff is the difference between a local directory and
+// a manifest of a previous upload of it
+type DirectoryDiff struct {
+	Changed   []string // paths of the new and modified files
+	Removed   []string // paths of the manifest entries missing from the directory
+	Unchanged int      // number of files of which the manifest entries are reused
+}
+
+// DiffDirectory compares the files in a local directory to the entries of the manifest
+// of a previous upload of it. A file is unchanged if its swarm hash computed locally and
+// its content type match the manifest entry, which is never the case for encrypted manifests.
+func (c *Client) DiffDirectory(dir, base string) (*DirectoryDiff, error) {
+	entries := make(map[string]*api.ManifestEntry)
+	if err := c.listAll(base, "", entries); err != nil {
+		return nil, err
+	}
+
+	diff := &DirectoryDiff{}
+	err := filepath.Walk(dir, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		entry, ok := entries[relPath]
+		delete(entries, relPath)
+		if ok {
+			unchanged, err := sameContent(p, entry)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				diff.Unchanged++
+				return nil
+			}
+		}
+		diff.Changed = append(diff.Changed, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for p := range entries {
+		diff.Removed = append(diff.Removed, p)
+	}
+	sort.Strings(diff.Removed)
+	return diff, nil
+}
+
+// UploadDirectoryDiff uploads the changes of a local directory to the manifest of a previous
+// upload of it, returning the resulting manifest hash. Only new and modified files and the
+// default path are uploaded, files removed from the directory are removed from the manifest,
+// and the manifest entries of the unchanged files are reused.
+func (c *Client) UploadDirectoryDiff(dir, defaultPath, base string, toPin, anonymous bool) (string, error) {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	} else if !stat.IsDir() {
+		return "", fmt.Errorf("not a directory: %s", dir)
+	}
+	diff, err := c.DiffDirectory(dir, base)
+	if err != nil {
+		return "", err
+	}
+	changed := diff.Changed
+	if defaultPath != "" {
+		if _, err := os.Stat(filepath.Join(dir, defaultPath)); err != nil {
+			return "", fmt.Errorf("default path: %v", err)
+		}
+		// the default entry is set from the file in the upload
+		changed = append(changed, filepath.ToSlash(defaultPath))
+	}
+	if len(changed) == 0 && len(diff.Removed) == 0 {
+		return base, nil
+	}
+
+	uploader := &diffUploader{dir: dir, changed: changed, removed: diff.Removed}
+	return c.TarUpload(base, uploader, defaultPath, false, toPin, anonymous)
+}
+
+// diffUploader implements Uploader
+var _ Uploader = &diffUploader{}
+
+// diffUploader uploads the changed files of a directory and
+// whiteout entries for the removed files
+type diffUploader struct {
+	dir     string
+	changed []string
+	removed []string
+}
+
+func (d *diffUploader) Tag() string {
+	return filepath.Base(d.dir)
+}
+
+// Upload performs the upload of the changed files and the whiteout entries
+func (d *diffUploader) Upload(upload UploadFn) error {
+	uploaded := make(map[string]bool)
+	for _, p := range d.changed {
+		if uploaded[p] {
+			continue
+		}
+		uploaded[p] = true
+		file, err := Open(filepath.Join(d.dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		file.Path = p
+		err = upload(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range d.removed {
+		dir, name := path.Split(p)
+		file := &File{
+			ReadCloser: ioutil.NopCloser(strings.NewReader("")),
+			ManifestEntry: api.ManifestEntry{
+				Path: dir + api.TarWhiteoutPrefix + name,
+				Mode: 0644,
+			},
+		}
+		if err := upload(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listAll collects the file entries of the manifest under the prefix by their path
+func (c *Client) listAll(hash, prefix string, entries map[string]*api.ManifestEntry) error {
+	list, err := c.List(hash, prefix, "")
+	if err != nil {
+		return err
+	}
+	for _, entry := range list.Entries {
+		// the default entry is not a file of the directory
+		if entry.Path == "/" {
+			continue
+		}
+		entries[entry.Path] = entry
+	}
+	seen := make(map[string]bool)
+	for _, p := range list.CommonPrefixes {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if err := c.listAll(hash, p, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameContent returns true if the swarm hash and the content type of the file
+// match the manifest entry
+func sameContent(p string, entry *api.ManifestEntry) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if stat.Size() != entry.Size {
+		return false, nil
+	}
+	contentType, err := api.DetectContentType(f.Name(), f)
+	if err != nil {
+		return false, err
+	}
+	if contentType != entry.ContentType {
+		return false, nil
+	}
+	fileStore := storage.NewFileStore(&storage.FakeChunkStore{}, &storage.FakeChunkStore{}, storage.NewFileStoreParams(), chunk.NewTags())
+	addr, _, err := fileStore.Store(context.TODO(), f, stat.Size(), false)
+	if err != nil {
+		return false, err
+	}
+	return addr.Hex() == entry.Hash, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Operation is a kind of client operation with its own timeout and idempotency in a Policy
+type Operation string
+
+const (
+	OpUpload     Operation = "upload"      // uploads of content, which are content addressed and safe to repeat
+	OpDownload   Operation = "download"    // downloads of content
+	OpList       Operation = "list"        // listings of manifests
+	OpTag        Operation = "tag"         // queries of the state of upload tags
+	OpFeedLookup Operation = "feed-lookup" // lookups of feed updates and update templates
+	OpFeedUpdate Operation = "feed-update" // publishing of feed updates, which fails if repeated
+	OpNodeQuery  Operation = "node-query"  // rpc queries of the state of the node
+)
+
+// Policy configures how the operations of a client are retried after failed attempts
+// and how long they may take. Transport errors, timeouts of an attempt and responses with
+// the statuses 429, 502, 503 and 504 are retried, with a delay doubling after every retry.
+type Policy struct {
+	Retries    int                         // retries after a failed attempt, 0 to make a single attempt
+	Backoff    time.Duration               // delay before the first retry
+	MaxBackoff time.Duration               // upper bound of the delay between retries, unbounded if 0
+	Timeout    time.Duration               // timeout of operations including their retries, none if 0
+	Timeouts   map[Operation]time.Duration // timeouts of operations overriding Timeout
+	// Idempotent tells if an operation can be repeated safely after a failed attempt,
+	// operations not in the map are retried only if the HTTP method is idempotent
+	Idempotent map[Operation]bool
+}
+
+// DefaultPolicy returns the policy of new clients, which retries idempotent operations
+// three times and bounds the time of the operations that do not transfer content
+func DefaultPolicy() Policy {
+	return Policy{
+		Retries:    3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		Timeouts: map[Operation]time.Duration{
+			OpList:       time.Minute,
+			OpTag:        30 * time.Second,
+			OpFeedLookup: time.Minute,
+			OpFeedUpdate: time.Minute,
+			OpNodeQuery:  30 * time.Second,
+		},
+		Idempotent: map[Operation]bool{
+			OpUpload:     true,
+			OpFeedUpdate: false,
+			OpNodeQuery:  true,
+		},
+	}
+}
+
+// timeout returns the timeout of the operation, 0 if it has none
+func (p *Policy) timeout(op Operation) time.Duration {
+	if t, ok := p.Timeouts[op]; ok {
+		return t
+	}
+	return p.Timeout
+}
+
+// idempotent tells if the operation using the HTTP method can be retried
+func (p *Policy) idempotent(op Operation, method string) bool {
+	if v, ok := p.Idempotent[op]; ok {
+		return v
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry, counting from one
+func (p *Policy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// context returns the context of the operation expiring after its timeout
+func (p *Policy) context(ctx context.Context, op Operation) (context.Context, context.CancelFunc) {
+	if t := p.timeout(op); t > 0 {
+		return context.WithTimeout(ctx, t)
+	}
+	return context.WithCancel(ctx)
+}
+
+// wait waits before the given retry, it returns false if the context is done first
+func (p *Policy) wait(ctx context.Context, retry int) bool {
+	timer := time.NewTimer(p.backoff(retry))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Do calls fn with a context expiring after the timeout of the operation, and calls
+// it again after it failed, as long as the operation is idempotent and retries are left
+func (p *Policy) Do(ctx context.Context, op Operation, fn func(ctx context.Context) error) error {
+	ctx, cancel := p.context(ctx, op)
+	defer cancel()
+	retries := 0
+	if p.idempotent(op, "") {
+		retries = p.Retries
+	}
+	for retry := 0; ; retry++ {
+		err := fn(ctx)
+		if err == nil || retry >= retries || ctx.Err() != nil {
+			return err
+		}
+		if !p.wait(ctx, retry+1) {
+			return err
+		}
+	}
+}
+
+// retryStatus tells if a response with the status is retried
+func retryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends the request of the operation with the http client, applying the policy.
+// Requests with bodies that cannot be replayed are sent once. The timeout of the
+// operation also covers reading the body of the response.
+func (p *Policy) do(client *http.Client, op Operation, req *http.Request) (*http.Response, error) {
+	ctx, cancel := p.context(req.Context(), op)
+	retries := 0
+	if p.idempotent(op, req.Method) && (req.Body == nil || req.GetBody != nil) {
+		retries = p.Retries
+	}
+	for retry := 0; ; retry++ {
+		attempt := req.WithContext(ctx)
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		res, err := client.Do(attempt)
+		last := retry >= retries || ctx.Err() != nil
+		if err == nil && (last || !retryStatus(res.StatusCode)) {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+		if err != nil && last {
+			cancel()
+			return nil, err
+		}
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if !p.wait(ctx, retry+1) {
+			cancel()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, err
+		}
+	}
+}
+
+// cancelBody releases the context of the operation when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
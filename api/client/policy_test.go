@@ -0,0 +1,187 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	p := Policy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := p.backoff(retry + 1); d != want {
+			t.Errorf("retry %d: got backoff %v, want %v", retry+1, d, want)
+		}
+	}
+}
+
+// TestPolicyRetry tests that failed attempts are retried only for idempotent
+// operations and with request bodies that can be replayed
+func TestPolicyRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		bodies   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		attempts++
+		n := attempts
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	p := DefaultPolicy()
+	p.Backoff = time.Millisecond
+	c := &http.Client{}
+	for _, tc := range []struct {
+		name     string
+		op       Operation
+		method   string
+		status   int
+		attempts int
+	}{
+		{
+			name:     "get",
+			op:       OpDownload,
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "replayable upload",
+			op:       OpUpload,
+			method:   http.MethodPost,
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "feed update",
+			op:       OpFeedUpdate,
+			method:   http.MethodPost,
+			status:   http.StatusServiceUnavailable,
+			attempts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts, bodies = 0, nil
+			req, err := http.NewRequest(tc.method, srv.URL, bytes.NewReader([]byte("data")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := p.do(c, tc.op, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tc.status {
+				t.Fatalf("got status %d, want %d", res.StatusCode, tc.status)
+			}
+			if attempts != tc.attempts {
+				t.Fatalf("got %d attempts, want %d", attempts, tc.attempts)
+			}
+			for _, body := range bodies {
+				if body != "data" {
+					t.Fatalf("got request body %q, want %q", body, "data")
+				}
+			}
+		})
+	}
+
+	// a streamed body cannot be replayed
+	attempts = 0
+	req, err := http.NewRequest(http.MethodPost, srv.URL, ioutil.NopCloser(bytes.NewReader([]byte("data"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.do(c, OpUpload, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if attempts != 1 {
+		t.Fatalf("got %d attempts of a streamed upload, want 1", attempts)
+	}
+}
+
+func TestPolicyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	p := DefaultPolicy()
+	p.Retries = 0
+	p.Timeouts[OpTag] = 50 * time.Millisecond
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := p.do(&http.Client{}, OpTag, req); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("operation took %v", d)
+	}
+
+	var calls int
+	errFailed := errors.New("failed")
+	err = p.Do(context.Background(), OpTag, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return errFailed
+	})
+	if err != errFailed || calls != 1 {
+		t.Fatalf("got error %v after %d calls", err, calls)
+	}
+
+	// rpc node queries are retried until they succeed
+	p.Retries = 3
+	p.Backoff = time.Millisecond
+	calls = 0
+	err = p.Do(context.Background(), OpNodeQuery, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("got error %v after %d calls", err, calls)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -28,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethersphere/swarm/contracts/ens"
+	"github.com/ethersphere/swarm/metrics/history"
 	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/pss"
 	"github.com/ethersphere/swarm/storage"
@@ -37,6 +39,8 @@ import (
 const (
 	DefaultHTTPListenAddr = "127.0.0.1"
 	DefaultHTTPPort       = "8500"
+	// DefaultNetworkKeyGrace is the time the previous network key of a private swarm is accepted for
+	DefaultNetworkKeyGrace = 24 * time.Hour
 )
 
 // separate bzz directories
@@ -46,42 +50,144 @@ type Config struct {
 	*storage.FileStoreParams
 
 	// LocalStore
-	ChunkDbPath   string
-	DbCapacity    uint64
-	CacheCapacity uint
-	BaseKey       []byte
+	ChunkDbPath     string
+	DbCapacity      uint64
+	CacheCapacity   uint
+	BaseKey         []byte
+	MigrateLegacyDB bool // whether a chunk database of a legacy release is migrated on start
+	// ChunkStoreBackend is the backend storing the data of chunks, localstore.BackendLevelDB if empty
+	ChunkStoreBackend string
+	// S3 compatible cold tier storing the least recently accessed chunks, disabled if the endpoint is empty
+	DbHotCapacity      uint64 // number of chunks kept locally with the cold tier, half of DbCapacity if zero
+	ColdStoreEndpoint  string
+	ColdStoreBucket    string
+	ColdStoreRegion    string
+	ColdStoreAccessKey string
+	ColdStoreSecretKey string
 
 	// Swap configs
-	SwapBackendURL          string         // Ethereum API endpoint
-	SwapEnabled             bool           // whether SWAP incentives are enabled
-	SwapPaymentThreshold    uint64         // honey amount at which a payment is triggered
-	SwapDisconnectThreshold uint64         // honey amount at which a peer disconnects
-	SwapSkipDeposit         bool           // do not ask the user to deposit during boot sequence
-	SwapDepositAmount       uint64         // deposit amount to the chequebook
-	SwapLogPath             string         // dir to swap related audit logs
-	SwapLogLevel            int            // log level of swap related audit logs
-	Contract                common.Address // address of the chequebook contract
-	SwapChequebookFactory   common.Address // address of the chequebook factory contract
+	SwapBackendURL          string                 // Ethereum API endpoint
+	SwapEnabled             bool                   // whether SWAP incentives are enabled
+	SwapPaymentThreshold    uint64                 // honey amount at which a payment is triggered
+	SwapDisconnectThreshold uint64                 // honey amount at which a peer disconnects
+	SwapSkipDeposit         bool                   // do not ask the user to deposit during boot sequence
+	SwapDepositAmount       uint64                 // deposit amount to the chequebook
+	SwapLogPath             string                 // dir to swap related audit logs
+	SwapLogLevel            int                    // log level of swap related audit logs
+	Contract                common.Address         // address of the chequebook contract
+	SwapChequebookFactory   common.Address         // address of the chequebook factory contract
+	SwapTokens              []swap.TokenParams     // chequebooks of tokens accepted besides the default one, in order of preference
+	SwapPriceOracle         swap.PriceOracleParams // oracle of the prices of the messages the node is paid for
 	// end of Swap configs
 
+	// Metering configs, used only when Swap is disabled
+	MeteringEnabled     bool  // whether the traffic with peers is metered without settlement
+	MeteringSoftLimit   int64 // balance a peer can owe before its messages are delayed
+	MeteringRefreshRate int64 // units of the balances settled every second for free
+
+	// Bandwidth limits in bytes per second of the stream, retrieval and pss protocols, 0 for no limit
+	BandwidthUpload       int64 // rate of the messages sent to all peers
+	BandwidthDownload     int64 // rate of the messages received from all peers
+	BandwidthPeerUpload   int64 // rate of the messages sent to every peer
+	BandwidthPeerDownload int64 // rate of the messages received from every peer
+
+	// Postage configs
+	PostageEnabled  bool             // whether uploads are stamped and postage stamps of synced chunks are validated
+	PostageRequired bool             // whether chunks without postage stamps are rejected
+	PostageIssuers  []common.Address // owners of batches whose stamps are trusted, as batches are issued locally
+
+	// Identity configs of private swarms, peers are verified if authorities are set
+	IdentityCredential     string           // hex encoded credential of the node issued by an authority
+	IdentityAuthorities    []common.Address // authorities whose credentials are trusted
+	IdentityRevocationList string           // path to the file with the overlay addresses of revoked nodes
+
+	// Network access key of private swarms, peers are rejected without a MAC made with it if set
+	NetworkKey         string        // hex encoded pre-shared secret of the private swarm
+	NetworkKeyPrevious string        // hex encoded key being rotated out, presented and accepted during the grace period
+	NetworkKeyGrace    time.Duration // time after the start the previous key is presented and accepted for
+
+	// Failover configs of gateways paired as warm standby, enabled if a partner is set
+	FailoverListenAddr string // listen address of the virtual endpoint
+	FailoverPartner    string // URL of the virtual endpoint of the partner node
+	FailoverPrimary    bool   // whether the node serves the requests of the pair while it is healthy
+
+	// Pin check configs, the pins are checked for orphaned chunks and broken pins if an interval is set
+	PinCheckInterval time.Duration // interval of the checks
+	PinCheckFix      bool          // whether orphaned chunks are unpinned and broken pins fetched
+
+	// Pin repair configs, samples of the chunks of the pins are checked for retrievability
+	// from the network and the missing chunks re-uploaded if an interval is set
+	PinRepairInterval time.Duration // interval of the repair rounds
+	PinRepairSamples  int           // chunks of each pinned file checked per round, the default if 0
+
+	// Zone configs of clustered deployments, the zone is announced to peers if set
+	Zone          string // deployment zone of the node, e.g. a datacenter
+	ZonePreferred bool   // whether retrieval prefers peers of the same zone among equally close peers
+
+	// DNSLink configs of public gateways, domains pointed at the gateway are served if enabled
+	DNSLinkEnabled bool // whether domains are resolved to content with their swarmlink TXT records
+
+	// Gateway configs of public gateways, the gateway policy is enforced on HTTP clients if enabled
+	GatewayEnabled            bool     // whether the gateway policy is enforced
+	GatewayRequestsPerMinute  int      // requests a client IP can make in a minute, 0 is unlimited
+	GatewayMaxUploadSize      int64    // size in bytes of the largest accepted upload, 0 is unlimited
+	GatewayBandwidthQuota     int64    // bytes a client IP can transfer in an hour, 0 is unlimited
+	GatewayBlockedTopics      []string // pss topics rpc clients can not use
+	GatewayNoAnonymousUploads bool     // whether uploads require one of the upload tokens
+	GatewayUploadTokens       []string // tokens authorizing uploads
+
+	// ContentType configs of the HTTP API, how the content types of served files are determined
+	ContentTypePipeline  []string // sources of the types tried in order, of manifest, extension and content
+	ContentTypeOverrides []string // types replacing the detected ones, as type=replacement or .ext=type
+
+	// Auth configs, the HTTP API requires scoped API tokens minted with the auth admin RPC if enabled
+	AuthEnabled bool // whether API tokens are required
+
+	// Quota configs, the uploads of the accounts of the API tokens are held to their quota if enabled with Auth
+	QuotaEnabled     bool  // whether the usage of the accounts is tracked
+	QuotaUploadBytes int64 // bytes an account can upload by default, 0 is unlimited
+	QuotaPinnedBytes int64 // bytes of uploads an account can keep pinned by default, 0 is unlimited
+
+	// Popularity configs, the requests for served content are counted by root address unless disabled
+	PopularityDisabled  bool          // whether the counting is opted out of
+	PopularityWindow    time.Duration // period over which the requests are aggregated
+	PopularityThreshold uint64        // number of requests in a window below which content is not reported
+
+	// MetricsHistory configs, the metrics are sampled into an in-memory history queried over RPC if enabled
+	MetricsHistoryEnabled   bool          // whether the history is kept
+	MetricsHistoryInterval  time.Duration // period between two samples of a series
+	MetricsHistoryRetention time.Duration // period over which the samples are kept
+
 	*network.HiveParams
 	Pss                *pss.Params
 	EnsRoot            common.Address
 	EnsAPIs            []string
+	EnsCacheTTLs       []string // durations resolved names are cached for, format [tld:]duration
 	RnsAPI             string
 	Path               string
 	ListenAddr         string
 	Port               string
 	PublicKey          string
 	BzzKey             string
-	Enode              *enode.Node `toml:"-"`
+	Enode              *enode.Node   `toml:"-"`
+	Bootnodes          []*enode.Node `toml:"-"`
 	NetworkID          uint64
 	SyncEnabled        bool
+	SyncMinPO          int      // lowest proximity order bin to pull sync
+	SyncMaxPO          int      // highest proximity order bin to pull sync, 0 for no limit
+	SyncTags           []uint32 // if set, only chunks uploaded with these tags are offered to peers
 	PushSyncEnabled    bool
 	LightNodeEnabled   bool
+	PssRelayDisabled   bool     // advertise to peers that pss messages addressed to others are not forwarded
+	NatRelay           bool     // advertise to peers that the connections of nodes behind NATs are relayed
+	AltUnderlays       []string // additional host:port addresses advertised to peers, e.g. over IPv6
+	QuicListenAddr     string   // UDP address connections of peers over QUIC are accepted on, empty to disable
+	Bridge             bool     // serve browsers joining as light peers over websocket on the HTTP proxy
+	BootnodeTrees      []string // enrtree:// URLs of DNS trees listing bootnodes, see EIP-1459
 	BootnodeMode       bool
 	DisableAutoConnect bool
 	EnablePinning      bool
+	PinningProvider    bool // pin content on behalf of peers, requires EnablePinning
 	Cors               string
 	BzzAccount         string
 	GlobalStoreAPI     string
@@ -112,6 +218,11 @@ func NewConfig() *Config {
 		SyncEnabled:             true,
 		PushSyncEnabled:         true,
 		EnablePinning:           false,
+		PopularityWindow:        DefaultPopularityWindow,
+		PopularityThreshold:     DefaultPopularityThreshold,
+		MetricsHistoryInterval:  history.DefaultInterval,
+		MetricsHistoryRetention: history.DefaultRetention,
+		NetworkKeyGrace:         DefaultNetworkKeyGrace,
 	}
 }
 
@@ -0,0 +1,111 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DNSLinkPrefix is the prefix of the TXT records linking a domain to the content under a swarm address
+	DNSLinkPrefix = "swarmlink=/bzz:/"
+	// DefaultDNSLinkTTL is the duration for which the links of domains are cached
+	DefaultDNSLinkTTL = time.Minute
+	// maxDNSLinkEntries bounds the number of cached domains, as any domain can be requested
+	maxDNSLinkEntries = 1000
+)
+
+// dnsLinkEntry is a cached link of a domain, addr is empty if the domain has no link
+type dnsLinkEntry struct {
+	addr    string
+	expires time.Time
+}
+
+// DNSLink resolves regular domain names to swarm addresses using the
+// swarmlink=/bzz:/<address> TXT records of the domains, so that a domain
+// pointed at a gateway serves the linked content under its root.
+type DNSLink struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*dnsLinkEntry
+}
+
+// NewDNSLink creates a DNSLink caching the links of the domains for the ttl.
+// TXT records are looked up with lookupTXT, or with the default DNS resolver if it is nil.
+func NewDNSLink(ttl time.Duration, lookupTXT func(ctx context.Context, name string) ([]string, error)) *DNSLink {
+	if lookupTXT == nil {
+		lookupTXT = net.DefaultResolver.LookupTXT
+	}
+	return &DNSLink{
+		lookupTXT: lookupTXT,
+		ttl:       ttl,
+		now:       time.Now,
+		cache:     make(map[string]*dnsLinkEntry),
+	}
+}
+
+// Lookup returns the swarm address, a content hash or an ENS name optionally followed
+// by a path, the domain is linked to, or an empty string if the domain has no link.
+func (d *DNSLink) Lookup(ctx context.Context, domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	d.mu.Lock()
+	e, ok := d.cache[domain]
+	d.mu.Unlock()
+	if ok && d.now().Before(e.expires) {
+		return e.addr, nil
+	}
+
+	records, err := d.lookupTXT(ctx, domain)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			return "", err
+		}
+	}
+	var addr string
+	for _, record := range records {
+		if strings.HasPrefix(record, DNSLinkPrefix) {
+			addr = strings.Trim(strings.TrimPrefix(record, DNSLinkPrefix), "/")
+			break
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if len(d.cache) >= maxDNSLinkEntries {
+		for name, e := range d.cache {
+			if !now.Before(e.expires) {
+				delete(d.cache, name)
+			}
+		}
+	}
+	if len(d.cache) < maxDNSLinkEntries {
+		d.cache[domain] = &dnsLinkEntry{
+			addr:    addr,
+			expires: now.Add(d.ttl),
+		}
+	}
+	return addr, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestDNSLink tests that domains are resolved to the addresses in their
+// swarmlink TXT records and that the links are cached for the ttl
+func TestDNSLink(t *testing.T) {
+	hash := "2222222222222222222222222222222222222222222222222222222222222222"
+	records := map[string][]string{
+		"example.com":   {"v=spf1 -all", DNSLinkPrefix + hash},
+		"swarm.example": {DNSLinkPrefix + "swarm.eth/docs/"},
+		"other.example": {"v=spf1 -all"},
+	}
+	lookups := 0
+	lookupTXT := func(ctx context.Context, name string) ([]string, error) {
+		lookups++
+		if name == "broken.example" {
+			return nil, errors.New("server failure")
+		}
+		r, ok := records[name]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return r, nil
+	}
+	d := NewDNSLink(time.Minute, lookupTXT)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	for _, x := range []struct {
+		domain string
+		addr   string
+	}{
+		{"example.com", hash},
+		{"Example.com.", hash},
+		{"swarm.example", "swarm.eth/docs"},
+		{"other.example", ""},
+		{"missing.example", ""},
+	} {
+		addr, err := d.Lookup(context.Background(), x.domain)
+		if err != nil {
+			t.Fatalf("%s: %v", x.domain, err)
+		}
+		if addr != x.addr {
+			t.Fatalf("%s: expected %q, got %q", x.domain, x.addr, addr)
+		}
+	}
+	if lookups != 4 {
+		t.Fatalf("expected 4 lookups, got %d", lookups)
+	}
+
+	if _, err := d.Lookup(context.Background(), "broken.example"); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	// the links are looked up again once expired
+	now = now.Add(time.Minute)
+	if _, err := d.Lookup(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 6 {
+		t.Fatalf("expected 6 lookups, got %d", lookups)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network/retrieval"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// RetrievalEstimate is the estimated number of chunks and accounting cost of retrieving
+// content, computed from its manifests and the intermediate chunks of its files
+type RetrievalEstimate struct {
+	Files              int    `json:"files"`              // number of files, 1 if the content is not a manifest
+	Size               int64  `json:"size"`               // size of the files in bytes
+	Chunks             int64  `json:"chunks"`             // number of distinct chunks of the content
+	IntermediateChunks int64  `json:"intermediateChunks"` // number of chunks retrieved for the estimate, the manifests and the trees of the files
+	Bytes              int64  `json:"bytes"`              // number of bytes of the chunks
+	LocalChunks        int64  `json:"localChunks"`        // number of chunks stored locally, retrieved without cost
+	Cost               uint64 `json:"cost"`               // estimated accounting cost of the chunks not stored locally, in honey
+}
+
+// chunkCost returns the accounting cost of retrieving a chunk of the length from
+// a peer with the current prices, the request and the delivery of the data
+func chunkCost(length int64) uint64 {
+	request := (&retrieval.RetrieveRequest{}).Price()
+	delivery := (&retrieval.ChunkDelivery{}).Price()
+	cost := request.Value
+	if delivery.PerByte {
+		cost += delivery.Value * uint64(length)
+	} else {
+		cost += delivery.Value
+	}
+	return cost
+}
+
+// fetchRecorder is a chunk store recording the lengths of the retrieved chunks
+// and whether they were stored locally before
+type fetchRecorder struct {
+	storage.ChunkStore
+	mu      sync.Mutex
+	fetched map[string]fetchedChunk
+}
+
+type fetchedChunk struct {
+	length int64
+	local  bool
+}
+
+func (r *fetchRecorder) Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (chunk.Chunk, error) {
+	local, err := r.ChunkStore.Has(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := r.ChunkStore.Get(ctx, mode, addr)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.fetched[string(addr)] = fetchedChunk{length: int64(len(ch.Data())), local: local}
+	r.mu.Unlock()
+	return ch, nil
+}
+
+// EstimateRetrieval estimates the number of chunks and the accounting cost of retrieving
+// the content with the address. Only the manifests and the intermediate chunks of the files
+// are retrieved, the lengths of the data chunks are computed from the sizes of the files,
+// for compressed files they are upper bounds.
+func (a *API) EstimateRetrieval(ctx context.Context, addr storage.Address) (*RetrievalEstimate, error) {
+	recorder := &fetchRecorder{
+		ChunkStore: a.fileStore.ChunkStore,
+		fetched:    make(map[string]fetchedChunk),
+	}
+	fileStore := storage.NewFileStore(recorder, recorder, storage.NewFileStoreParams(), chunk.NewTags())
+	hashSize := fileStore.HashSize()
+
+	e := new(RetrievalEstimate)
+	seen := make(map[string]bool)
+	count := func(length int64, local bool) {
+		e.Chunks++
+		e.Bytes += length
+		if local {
+			e.LocalChunks++
+			return
+		}
+		e.Cost += chunkCost(length)
+	}
+	// walk counts the chunks of the document with the address, file is false for manifests
+	walk := func(addr storage.Address, file bool) error {
+		reader, isEncrypted := a.fileStore.Retrieve(ctx, addr)
+		size, err := reader.Size(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if file {
+			e.Files++
+			e.Size += size
+		}
+		var refs []storage.Reference
+		if err := fileStore.Walk(ctx, addr, func(ref storage.Reference) error {
+			refs = append(refs, ref)
+			return nil
+		}); err != nil {
+			return err
+		}
+		var data []chunk.Address
+		for _, ref := range refs {
+			addr := chunk.Address(ref[:hashSize])
+			if seen[string(addr)] {
+				continue
+			}
+			seen[string(addr)] = true
+			if c, ok := recorder.fetched[string(addr)]; ok {
+				e.IntermediateChunks++
+				count(c.length, c.local)
+				continue
+			}
+			data = append(data, addr)
+		}
+		// data chunks are full but the last one, encrypted chunks are padded
+		for i, addr := range data {
+			length := int64(chunk.DefaultSize)
+			if !isEncrypted && i == len(data)-1 {
+				if rest := size % chunk.DefaultSize; rest > 0 {
+					length = rest
+				}
+			}
+			local, err := a.fileStore.ChunkStore.Has(ctx, addr)
+			if err != nil {
+				return err
+			}
+			count(8+length, local)
+		}
+		return nil
+	}
+
+	walker, err := a.NewManifestWalker(ctx, addr, NOOPDecrypt, nil)
+	if err != nil {
+		// not a manifest, the content is a single file
+		if err := walk(addr, true); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if err := walk(addr, false); err != nil {
+		return nil, err
+	}
+	err = walker.Walk(func(entry *ManifestEntry) error {
+		ref, err := hex.DecodeString(entry.Hash)
+		if err != nil {
+			return err
+		}
+		return walk(ref, entry.ContentType != ManifestType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestEstimateRetrieval tests that the estimate counts the chunks of stored content
+// and that the locally stored chunks have no cost.
+func TestEstimateRetrieval(t *testing.T) {
+	const size = 130*chunk.DefaultSize + 100
+	testAPI(t, func(api *API, _ *chunk.Tags, toEncrypt bool) {
+		ctx := context.TODO()
+		addr, wait, err := api.Store(ctx, bytes.NewReader(testutil.RandomBytes(1, size)), size, toEncrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		e, err := api.EstimateRetrieval(ctx, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Files != 1 {
+			t.Errorf("got %d files, want 1", e.Files)
+		}
+		if e.Size != size {
+			t.Errorf("got size %d, want %d", e.Size, size)
+		}
+		if got := e.Chunks - e.IntermediateChunks; got != 131 {
+			t.Errorf("got %d data chunks, want 131", got)
+		}
+		// 2 chunks of references and the root, 3 and the root for encrypted references
+		wantIntermediate := int64(3)
+		if toEncrypt {
+			wantIntermediate = 4
+		}
+		if e.IntermediateChunks != wantIntermediate {
+			t.Errorf("got %d intermediate chunks, want %d", e.IntermediateChunks, wantIntermediate)
+		}
+		if e.Bytes < size {
+			t.Errorf("got %d bytes, want at least %d", e.Bytes, size)
+		}
+		if e.LocalChunks != e.Chunks {
+			t.Errorf("got %d local chunks, want %d", e.LocalChunks, e.Chunks)
+		}
+		if e.Cost != 0 {
+			t.Errorf("got cost %d, want 0", e.Cost)
+		}
+	})
+}
+
+// TestEstimateRetrievalManifest tests that the estimate counts the files and the
+// manifest chunks of a collection.
+func TestEstimateRetrievalManifest(t *testing.T) {
+	testAPI(t, func(api *API, _ *chunk.Tags, toEncrypt bool) {
+		ctx := context.TODO()
+		addr, wait, err := putString(ctx, api, "retrieval estimate", "text/plain", toEncrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		e, err := api.EstimateRetrieval(ctx, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Files != 1 {
+			t.Errorf("got %d files, want 1", e.Files)
+		}
+		if e.Size != int64(len("retrieval estimate")) {
+			t.Errorf("got size %d, want %d", e.Size, len("retrieval estimate"))
+		}
+		// the manifest and the file
+		if e.Chunks != 2 {
+			t.Errorf("got %d chunks, want 2", e.Chunks)
+		}
+	})
+}
+
+// TestChunkCost tests that the cost of a chunk grows with its length.
+func TestChunkCost(t *testing.T) {
+	if chunkCost(8) == 0 {
+		t.Fatal("expected cost of a request")
+	}
+	if chunkCost(8+chunk.DefaultSize) <= chunkCost(8) {
+		t.Fatal("expected cost to grow with the length of the chunk")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// HashAPIVersion is the version of the hash RPC API
+const HashAPIVersion = "1.0"
+
+// HashOptions select the chunking and the compression the hash is computed with,
+// they must match the ones of the upload for the hash to match its reference
+type HashOptions struct {
+	Chunking    string `json:"chunking"`    // fixed (default) or content-defined
+	Compression string `json:"compression"` // none (default) or snappy
+}
+
+// HashAPI computes the swarm hashes of data over RPC without uploading it,
+// to verify published references or to check for duplicates before uploading
+type HashAPI struct{}
+
+// NewHashAPI creates a HashAPI
+func NewHashAPI() *HashAPI {
+	return &HashAPI{}
+}
+
+// Hash returns the swarm hash of the data, the reference of its unencrypted raw upload
+func (a *HashAPI) Hash(ctx context.Context, data hexutil.Bytes, opts *HashOptions) (storage.Address, error) {
+	ctx, err := opts.context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Hash(ctx, bytes.NewReader(data))
+}
+
+// HashFile returns the swarm hash of the file at the path on the filesystem of the node,
+// the reference of its unencrypted raw upload
+func (a *HashAPI) HashFile(ctx context.Context, path string, opts *HashOptions) (storage.Address, error) {
+	ctx, err := opts.context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return storage.Hash(ctx, f)
+}
+
+// context returns the context with the chunking and the compression of the options
+func (o *HashOptions) context(ctx context.Context) (context.Context, error) {
+	if o == nil {
+		return ctx, nil
+	}
+	switch o.Chunking {
+	case "", storage.ChunkingFixed:
+	case storage.ChunkingContentDefined:
+		ctx = sctx.SetContentDefinedChunking(ctx)
+	default:
+		return nil, fmt.Errorf("invalid chunking %q", o.Chunking)
+	}
+	switch o.Compression {
+	case "", storage.CompressionNone:
+	case storage.CompressionSnappy:
+		ctx = sctx.SetCompression(ctx, storage.CompressionSnappy)
+	default:
+		return nil, fmt.Errorf("invalid compression %q", o.Compression)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestHashAPI validates that the hashes of the data and of the file
+// with the data match and depend on the options.
+func TestHashAPI(t *testing.T) {
+	a := NewHashAPI()
+	data := testutil.RandomBytes(1, 100000)
+
+	want, err := storage.Hash(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.Hash(context.Background(), data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got hash %s, want %s", got, want)
+	}
+
+	f, err := ioutil.TempFile("", "swarm-hash-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	got, err = a.HashFile(context.Background(), f.Name(), &HashOptions{Chunking: storage.ChunkingFixed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got file hash %s, want %s", got, want)
+	}
+
+	// random data is stored uncompressed
+	compressible := bytes.Repeat([]byte("swarm"), 20000)
+	uncompressed, err := a.Hash(context.Background(), compressible, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = a.Hash(context.Background(), compressible, &HashOptions{Compression: storage.CompressionSnappy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, uncompressed) {
+		t.Error("got the same hash with compression")
+	}
+
+	if _, err := a.Hash(context.Background(), data, &HashOptions{Chunking: "unknown"}); err == nil {
+		t.Error("got no error for invalid chunking")
+	}
+}
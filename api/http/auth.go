@@ -0,0 +1,384 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/state"
+)
+
+// AuthAPIVersion is the version of the token admin RPC API
+const AuthAPIVersion = "1.0"
+
+// authTokenPrefix is the state store key prefix of the API tokens
+const authTokenPrefix = "auth_token_"
+
+// RPCPath is the path of the RPC endpoint served to clients with pss or admin tokens
+const RPCPath = "/rpc"
+
+// TokenScope is the part of the API an API token grants access to
+type TokenScope string
+
+const (
+	ScopeRead   TokenScope = "read"   // downloads
+	ScopeUpload TokenScope = "upload" // uploads and feed updates
+	ScopePss    TokenScope = "pss"    // the pss RPC API and the bridge of browser clients
+	ScopeAdmin  TokenScope = "admin"  // everything, including pinning and the admin RPC APIs
+)
+
+var (
+	ErrMissingToken = errors.New("missing API token")
+	ErrInvalidToken = errors.New("invalid API token")
+	ErrExpiredToken = errors.New("expired API token")
+	ErrTokenScope   = errors.New("API token scope does not allow the request")
+)
+
+// validScope reports whether s is one of the token scopes
+func validScope(s TokenScope) bool {
+	switch s {
+	case ScopeRead, ScopeUpload, ScopePss, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// APIToken describes an API token without its secret
+type APIToken struct {
+	ID      string     `json:"id"`
+	Scope   TokenScope `json:"scope"`
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires,omitempty"` // zero if the token does not expire
+	Account string     `json:"account,omitempty"` // account the usage is accounted to, the id if empty
+}
+
+// AccountName returns the account the usage of the token is accounted to
+func (t *APIToken) AccountName() string {
+	if t.Account != "" {
+		return t.Account
+	}
+	return t.ID
+}
+
+// storedToken is an API token as persisted, only the hash of the secret is kept
+type storedToken struct {
+	APIToken
+	SecretHash string `json:"secretHash"`
+}
+
+// Auth mints, revokes and verifies the API tokens of the HTTP API.
+// Tokens have the form <id>.<secret> and are persisted in the state store.
+type Auth struct {
+	store state.Store
+	now   func() time.Time
+
+	mu     sync.RWMutex
+	tokens map[string]*storedToken
+}
+
+// NewAuth creates an Auth with the tokens persisted in the store
+func NewAuth(store state.Store) (*Auth, error) {
+	a := &Auth{
+		store:  store,
+		now:    time.Now,
+		tokens: make(map[string]*storedToken),
+	}
+	err := store.Iterate(authTokenPrefix, func(key, value []byte) (bool, error) {
+		t := new(storedToken)
+		if err := json.Unmarshal(value, t); err != nil {
+			return true, fmt.Errorf("decode API token %s: %v", key, err)
+		}
+		a.tokens[t.ID] = t
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Mint creates a token with the given scope that expires after ttl, or never if ttl is zero.
+// The returned token string is the only copy of the secret.
+func (a *Auth) Mint(scope TokenScope, ttl time.Duration) (string, *APIToken, error) {
+	return a.MintAccount(scope, ttl, "")
+}
+
+// MintAccount creates a token like Mint, with its usage accounted to the account,
+// so that the tokens of a tenant share its quota
+func (a *Auth) MintAccount(scope TokenScope, ttl time.Duration, account string) (string, *APIToken, error) {
+	if !validScope(scope) {
+		return "", nil, fmt.Errorf("invalid token scope %q", scope)
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("invalid token ttl %v", ttl)
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	now := a.now()
+	t := &storedToken{
+		APIToken: APIToken{
+			ID:      id,
+			Scope:   scope,
+			Created: now,
+			Account: account,
+		},
+		SecretHash: hashSecret(secret),
+	}
+	if ttl > 0 {
+		t.Expires = now.Add(ttl)
+	}
+	if err := a.store.Put(authTokenPrefix+id, t); err != nil {
+		return "", nil, err
+	}
+	a.mu.Lock()
+	a.tokens[id] = t
+	a.mu.Unlock()
+	info := t.APIToken
+	return id + "." + secret, &info, nil
+}
+
+// Revoke deletes the token with the given id
+func (a *Auth) Revoke(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.tokens[id]; !ok {
+		return fmt.Errorf("API token %s not found", id)
+	}
+	if err := a.store.Delete(authTokenPrefix + id); err != nil {
+		return err
+	}
+	delete(a.tokens, id)
+	return nil
+}
+
+// Tokens returns the tokens, sorted by creation time
+func (a *Auth) Tokens() []*APIToken {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	tokens := make([]*APIToken, 0, len(a.tokens))
+	for _, t := range a.tokens {
+		info := t.APIToken
+		tokens = append(tokens, &info)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+	return tokens
+}
+
+// Verify returns the token with the given token string if it is valid and not expired
+func (a *Auth) Verify(token string) (*APIToken, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	a.mu.RLock()
+	t, ok := a.tokens[parts[0]]
+	a.mu.RUnlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(t.SecretHash), []byte(hashSecret(parts[1]))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if !t.Expires.IsZero() && !a.now().Before(t.Expires) {
+		return nil, ErrExpiredToken
+	}
+	info := t.APIToken
+	return &info, nil
+}
+
+// Allows reports whether a token with the scope can be used for requests needing the required scope
+func (s TokenScope) Allows(required TokenScope) bool {
+	return s == ScopeAdmin || s == required
+}
+
+// requiredScope returns the token scope needed for the request,
+// empty if a token of any scope can be used
+func requiredScope(r *http.Request) TokenScope {
+	switch {
+	case r.URL.Path == QuotaPath:
+		return ""
+	case strings.HasPrefix(r.URL.Path, RPCPath), r.URL.Path == BridgePath:
+		return ScopePss
+	case strings.HasPrefix(r.URL.Path, "/bzz-pin:"), r.URL.Path == TopologyPath:
+		return ScopeAdmin
+	case isWriteRequest(r):
+		return ScopeUpload
+	}
+	return ScopeRead
+}
+
+// requestToken returns the API token of the request, given either as a bearer token
+// in the Authorization header or with the access_token query parameter
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// Authenticate is a middleware that refuses the requests without a valid API token
+// with a scope allowing the request
+func Authenticate(h http.Handler, a *Auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+		t, err := a.Verify(requestToken(r))
+		if err != nil {
+			metrics.GetOrRegisterCounter("http/auth/unauthorized", nil).Inc(1)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="swarm"`)
+			respondError(w, r, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if required := requiredScope(r); required != "" && !t.Scope.Allows(required) {
+			metrics.GetOrRegisterCounter("http/auth/forbidden", nil).Inc(1)
+			respondError(w, r, ErrTokenScope.Error(), http.StatusForbidden)
+			return
+		}
+		ctx := SetAccount(SetTokenScope(r.Context(), t.Scope), t.AccountName())
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// rpcHandler serves the RPC APIs allowed by the token scope of the requests,
+// the pss APIs to pss tokens and all APIs to admin tokens
+type rpcHandler struct {
+	pss   http.Handler
+	admin http.Handler
+}
+
+// newRPCHandler registers the apis with the RPC servers of the token scopes
+func newRPCHandler(apis []rpc.API) (*rpcHandler, error) {
+	pss, admin := rpc.NewServer(), rpc.NewServer()
+	for _, api := range apis {
+		if api.Namespace == "pss" {
+			if err := pss.RegisterName(api.Namespace, api.Service); err != nil {
+				return nil, err
+			}
+		}
+		if err := admin.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, err
+		}
+	}
+	return &rpcHandler{
+		pss:   rpcEndpoint(pss),
+		admin: rpcEndpoint(admin),
+	}, nil
+}
+
+// rpcEndpoint serves the RPC server over HTTP and websockets on the same path,
+// origins are not checked as the requests are authenticated with API tokens
+func rpcEndpoint(server *rpc.Server) http.Handler {
+	ws := server.WebsocketHandler([]string{"*"})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		server.ServeHTTP(w, r)
+	})
+}
+
+func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if GetTokenScope(r.Context()) == ScopeAdmin {
+		h.admin.ServeHTTP(w, r)
+		return
+	}
+	h.pss.ServeHTTP(w, r)
+}
+
+// AuthAPI is the admin RPC API managing the API tokens
+type AuthAPI struct {
+	auth *Auth
+}
+
+// NewAuthAPI creates an AuthAPI for the given Auth
+func NewAuthAPI(a *Auth) *AuthAPI {
+	return &AuthAPI{auth: a}
+}
+
+// MintedToken is a newly minted API token with its secret
+type MintedToken struct {
+	*APIToken
+	Token string `json:"token"`
+}
+
+// Mint creates a token with the scope read, upload, pss or admin
+// that expires after ttl seconds, or never if ttl is zero,
+// with its usage accounted to the account if one is given
+func (api *AuthAPI) Mint(scope TokenScope, ttl uint64, account *string) (*MintedToken, error) {
+	var accountName string
+	if account != nil {
+		accountName = *account
+	}
+	token, info, err := api.auth.MintAccount(scope, time.Duration(ttl)*time.Second, accountName)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("API token minted", "id", info.ID, "scope", info.Scope, "expires", info.Expires, "account", info.AccountName())
+	return &MintedToken{APIToken: info, Token: token}, nil
+}
+
+// Revoke revokes the token with the given id
+func (api *AuthAPI) Revoke(id string) error {
+	if err := api.auth.Revoke(id); err != nil {
+		return err
+	}
+	log.Info("API token revoked", "id", id)
+	return nil
+}
+
+// Tokens returns the tokens without their secrets
+func (api *AuthAPI) Tokens() []*APIToken {
+	return api.auth.Tokens()
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// TestAuth tests minting, verifying, expiring and revoking API tokens
+// and that the tokens are persisted in the state store
+func TestAuth(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+
+	a, err := NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	a.now = func() time.Time { return now }
+
+	if _, _, err := a.Mint("root", 0); err == nil {
+		t.Fatal("expected error for invalid scope")
+	}
+	readToken, read, err := a.Mint(ScopeRead, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadToken, upload, err := a.Mint(ScopeUpload, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Verify(""); err != ErrMissingToken {
+		t.Fatalf("got error %v, want %v", err, ErrMissingToken)
+	}
+	if _, err := a.Verify(read.ID + ".wrong"); err != ErrInvalidToken {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidToken)
+	}
+	got, err := a.Verify(readToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != read.ID || got.Scope != ScopeRead {
+		t.Fatalf("got token %+v, want %+v", got, read)
+	}
+
+	// tokens are loaded from the state store
+	b, err := NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.now = a.now
+	if tokens := b.Tokens(); len(tokens) != 2 {
+		t.Fatalf("got %d tokens, want 2", len(tokens))
+	}
+	if _, err := b.Verify(uploadToken); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := b.Verify(uploadToken); err != ErrExpiredToken {
+		t.Fatalf("got error %v, want %v", err, ErrExpiredToken)
+	}
+
+	if err := b.Revoke(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Revoke(upload.ID); err == nil {
+		t.Fatal("expected error revoking a revoked token")
+	}
+	c, err := NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens := c.Tokens(); len(tokens) != 1 || tokens[0].ID != read.ID {
+		t.Fatalf("got tokens %v, want only %s", tokens, read.ID)
+	}
+}
+
+// testRPCService is served on the RPC endpoint under the pss and test namespaces
+type testRPCService struct{}
+
+func (testRPCService) Echo(s string) string {
+	return s
+}
+
+// TestAuthenticate tests that requests need tokens with a scope allowing them
+func TestAuthenticate(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	a, err := NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := make(map[TokenScope]string)
+	for _, scope := range []TokenScope{ScopeRead, ScopeUpload, ScopePss, ScopeAdmin} {
+		token, _, err := a.Mint(scope, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[scope] = token
+	}
+
+	srv := NewTestSwarmServer(t, func(swarmAPI *api.API, pinAPI *pin.API) TestServer {
+		server := NewServer(swarmAPI, pinAPI, "")
+		err := server.SetAuth(a, []rpc.API{
+			{Namespace: "pss", Service: testRPCService{}},
+			{Namespace: "test", Service: testRPCService{}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}, nil, nil)
+	defer srv.Close()
+
+	do := func(method, path, token string, body []byte) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if path == RPCPath {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, data
+	}
+
+	data := []byte("data")
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", "", data); code != http.StatusUnauthorized {
+		t.Fatalf("no token: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", tokens[ScopeRead], data); code != http.StatusForbidden {
+		t.Fatalf("read token upload: got status %d, want %d", code, http.StatusForbidden)
+	}
+	code, hash := do(http.MethodPost, "/bzz-raw:/", tokens[ScopeUpload], data)
+	if code != http.StatusOK {
+		t.Fatalf("upload token upload: got status %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := do(http.MethodGet, "/bzz-raw:/"+string(hash), tokens[ScopeUpload], nil); code != http.StatusForbidden {
+		t.Fatalf("upload token download: got status %d, want %d", code, http.StatusForbidden)
+	}
+	code, body := do(http.MethodGet, "/bzz-raw:/"+string(hash)+"?access_token="+tokens[ScopeRead], "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("read token download: got status %d, want %d", code, http.StatusOK)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatalf("got %q, want %q", body, data)
+	}
+	if code, _ := do(http.MethodGet, "/bzz-pin:/", tokens[ScopeRead], nil); code != http.StatusForbidden {
+		t.Fatalf("read token pins: got status %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := do(http.MethodGet, BridgePath, tokens[ScopeRead], nil); code != http.StatusForbidden {
+		t.Fatalf("read token bridge: got status %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := do(http.MethodGet, BridgePath, tokens[ScopePss], nil); code != http.StatusNotFound {
+		t.Fatalf("pss token bridge not enabled: got status %d, want %d", code, http.StatusNotFound)
+	}
+
+	call := func(token, method string) (int, string) {
+		t.Helper()
+		code, body := do(http.MethodPost, RPCPath, token, []byte(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":["hello"]}`))
+		if code != http.StatusOK {
+			return code, ""
+		}
+		var res struct {
+			Result string
+			Error  *struct{ Message string }
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Error != nil {
+			return code, "error: " + res.Error.Message
+		}
+		return code, res.Result
+	}
+	if code, _ := call(tokens[ScopeRead], "pss_echo"); code != http.StatusForbidden {
+		t.Fatalf("read token rpc: got status %d, want %d", code, http.StatusForbidden)
+	}
+	if _, result := call(tokens[ScopePss], "pss_echo"); result != "hello" {
+		t.Fatalf("pss token pss rpc: got %q, want %q", result, "hello")
+	}
+	if _, result := call(tokens[ScopePss], "test_echo"); result == "hello" {
+		t.Fatal("pss token can call other rpc namespaces")
+	}
+	if _, result := call(tokens[ScopeAdmin], "test_echo"); result != "hello" {
+		t.Fatalf("admin token rpc: got %q, want %q", result, "hello")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/storage"
+)
+
+const (
+	// immutableCacheControl is the Cache-Control header of content requested by its
+	// hash, which never changes
+	immutableCacheControl = "max-age=2147483648, immutable"
+	// revalidateCacheControl is the Cache-Control header of content resolved through a
+	// name or feed updates, which caches revalidate with its ETag or Last-Modified header
+	revalidateCacheControl = "no-cache"
+)
+
+// setCacheHeaders sets the strong ETag of the content with the given address and
+// the headers telling caches whether it is immutable or needs revalidation. Content
+// resolved through feed updates was last modified at the latest update, which is
+// returned to serve the content with, the zero time otherwise
+func setCacheHeaders(w http.ResponseWriter, addr storage.Address, immutable bool, feeds *api.ResolvedFeeds) time.Time {
+	if addr != nil {
+		w.Header().Set("ETag", etag(addr))
+	}
+	modtime := feeds.LastModified()
+	if immutable && len(feeds.Updates()) == 0 {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+		return time.Time{}
+	}
+	w.Header().Set("Cache-Control", revalidateCacheControl)
+	if !modtime.IsZero() {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	return modtime
+}
+
+// etag returns the entity tag of the content with the given address
+func etag(addr storage.Address) string {
+	return `"` + addr.Hex() + `"`
+}
+
+// notModified reports whether the request has an If-None-Match header matching the
+// content with the given address. As required for If-None-Match, weak and strong
+// entity tags match alike, and tags without quotes are accepted as well
+func notModified(r *http.Request, addr storage.Address) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || addr == nil {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.Trim(strings.TrimPrefix(tag, "W/"), `"`) == addr.Hex() {
+			return true
+		}
+	}
+	return false
+}
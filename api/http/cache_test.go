@@ -0,0 +1,146 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// TestBzzCacheHeaders validates the headers caching proxies rely on: content requested
+// by its hash is immutable with its hash as strong ETag, content resolved through feed
+// updates is revalidated with its ETag or the time of the update, and conditional
+// requests of unchanged content are answered with 304 Not Modified
+func TestBzzCacheHeaders(t *testing.T) {
+	var swarmAPI *api.API
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		swarmAPI = a
+		return NewServer(a, pinAPI, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	ctx := context.Background()
+	var contentAddr storage.Address
+	upload := func(content string) storage.Address {
+		addr, err := swarmAPI.NewManifest(ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err = swarmAPI.UpdateManifest(ctx, addr, func(mw *api.ManifestWriter) error {
+			contentAddr, err = mw.AddEntry(ctx, strings.NewReader(content), &api.ManifestEntry{
+				Path:        "file.txt",
+				ContentType: "text/plain",
+				Size:        int64(len(content)),
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	get := func(url string, header http.Header) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	check := func(res *http.Response, code int, etag, cacheControl string) {
+		t.Helper()
+		if res.StatusCode != code {
+			t.Fatalf("got status %d, want %d", res.StatusCode, code)
+		}
+		if got := res.Header.Get("ETag"); got != etag {
+			t.Fatalf("got ETag %q, want %q", got, etag)
+		}
+		if got := res.Header.Get("Cache-Control"); got != cacheControl {
+			t.Fatalf("got Cache-Control %q, want %q", got, cacheControl)
+		}
+	}
+
+	manifest := upload("first")
+	first := `"` + contentAddr.Hex() + `"`
+	check(get("/bzz:/"+manifest.Hex()+"/file.txt", nil), http.StatusOK, first, immutableCacheControl)
+	check(get("/bzz:/"+manifest.Hex()+"/file.txt", http.Header{"If-None-Match": {`"other", W/` + first}}), http.StatusNotModified, first, immutableCacheControl)
+	check(get("/bzz:/"+manifest.Hex()+"/file.txt", http.Header{"If-None-Match": {"*"}}), http.StatusNotModified, first, immutableCacheControl)
+	check(get("/bzz:/"+manifest.Hex()+"/file.txt", http.Header{"If-None-Match": {`"other"`}}), http.StatusOK, first, immutableCacheControl)
+	check(get("/bzz-raw:/"+contentAddr.Hex(), nil), http.StatusOK, first, immutableCacheControl)
+	check(get("/bzz-raw:/"+contentAddr.Hex(), http.Header{"If-None-Match": {first}}), http.StatusNotModified, first, immutableCacheControl)
+	// errors are not cached
+	check(get("/bzz:/"+manifest.Hex()+"/missing.txt", nil), http.StatusNotFound, "", "")
+
+	signer, _, err := newTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, _ := feed.NewTopic("cache", nil)
+	request := feed.NewFirstRequest(topic)
+	request.Feed.User = signer.Address()
+	request.SetData(manifest)
+	if err := request.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := swarmAPI.FeedsUpdate(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	feedManifest, err := swarmAPI.NewFeedManifest(ctx, &request.Feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "/bzz:/" + feedManifest.Hex() + "/file.txt"
+	res := get(url, nil)
+	check(res, http.StatusOK, first, revalidateCacheControl)
+	lastModified := time.Unix(int64(request.Epoch.Time), 0).UTC().Format(http.TimeFormat)
+	if got := res.Header.Get("Last-Modified"); got != lastModified {
+		t.Fatalf("got Last-Modified %q, want %q", got, lastModified)
+	}
+	check(get(url, http.Header{"If-None-Match": {first}}), http.StatusNotModified, first, revalidateCacheControl)
+	check(get(url, http.Header{"If-Modified-Since": {lastModified}}), http.StatusNotModified, first, revalidateCacheControl)
+
+	// once the feed is updated, the cached content is stale
+	manifest = upload("second")
+	second := `"` + contentAddr.Hex() + `"`
+	request, err = swarmAPI.FeedsNewRequest(ctx, &request.Feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetData(manifest)
+	if err := request.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := swarmAPI.FeedsUpdate(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	check(get(url, http.Header{"If-None-Match": {first}}), http.StatusOK, second, revalidateCacheControl)
+}
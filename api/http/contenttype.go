@@ -0,0 +1,194 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ethersphere/swarm/api"
+)
+
+// Sources of the content type of served files, tried in the order of the pipeline
+// of ContentTypes until one of them determines the type
+const (
+	ContentTypeFromManifest  = "manifest"  // type of the manifest entry or the content_type query parameter
+	ContentTypeFromExtension = "extension" // type registered for the extension of the file name
+	ContentTypeFromContent   = "content"   // type detected from the magic bytes of the content
+)
+
+// DefaultContentTypePipeline is the order in which the sources of the content type of
+// served files are tried by default
+var DefaultContentTypePipeline = []string{ContentTypeFromManifest, ContentTypeFromExtension, ContentTypeFromContent}
+
+// sniffLen is the number of leading bytes of the content used to detect its type and
+// charset, the same as considered by http.DetectContentType
+const sniffLen = 512
+
+// ContentTypes determines the Content-Type header of the files served by the server.
+// The generic application/octet-stream type does not determine the type of a file, so
+// the next source of the pipeline is tried. Text types without a charset are served
+// with the utf-8 charset if the leading bytes of the content are valid UTF-8.
+type ContentTypes struct {
+	pipeline   []string
+	extensions map[string]string // overrides of the types of files with an extension
+	types      map[string]string // overrides of media types
+}
+
+// NewContentTypes returns ContentTypes trying the sources of the pipeline in order,
+// the default pipeline if empty. The overrides replace the detected types, either of
+// a media type given as "type=replacement" or of the files with an extension given
+// as ".ext=type"
+func NewContentTypes(pipeline []string, overrides []string) (*ContentTypes, error) {
+	if len(pipeline) == 0 {
+		pipeline = DefaultContentTypePipeline
+	}
+	c := &ContentTypes{
+		extensions: make(map[string]string),
+		types:      make(map[string]string),
+	}
+	for _, source := range pipeline {
+		switch source = strings.TrimSpace(source); source {
+		case ContentTypeFromManifest, ContentTypeFromExtension, ContentTypeFromContent:
+			c.pipeline = append(c.pipeline, source)
+		default:
+			return nil, fmt.Errorf("invalid content type source %q", source)
+		}
+	}
+	for _, override := range overrides {
+		i := strings.Index(override, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid content type override %q", override)
+		}
+		from, to := strings.ToLower(strings.TrimSpace(override[:i])), strings.TrimSpace(override[i+1:])
+		if _, _, err := mime.ParseMediaType(to); err != nil {
+			return nil, fmt.Errorf("invalid content type override %q: %v", override, err)
+		}
+		if strings.HasPrefix(from, ".") {
+			c.extensions[from] = to
+			continue
+		}
+		if mediaType, _, err := mime.ParseMediaType(from); err != nil || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("invalid content type override %q: invalid media type %q", override, from)
+		}
+		c.types[from] = to
+	}
+	return c, nil
+}
+
+// Detect returns the content type of the file with the given name and manifest
+// content type, application/octet-stream if no source determines it. The leading bytes of the content are read if
+// needed, and the content is rewound to its current position afterwards
+func (c *ContentTypes) Detect(name, manifestType string, content io.ReadSeeker) (string, error) {
+	ext := strings.ToLower(path.Ext(name))
+	if override, ok := c.extensions[ext]; ok {
+		return override, nil
+	}
+
+	var head []byte
+	sniff := func() ([]byte, error) {
+		if head != nil {
+			return head, nil
+		}
+		pos, err := content.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("seeker can't seek, %s", err)
+		}
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(content, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		if _, err := content.Seek(pos, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seeker can't seek, %s", err)
+		}
+		head = buf[:n]
+		return head, nil
+	}
+
+	ctype := api.MimeOctetStream
+pipeline:
+	for _, source := range c.pipeline {
+		var typ string
+		switch source {
+		case ContentTypeFromManifest:
+			typ = manifestType
+		case ContentTypeFromExtension:
+			typ = mime.TypeByExtension(ext)
+		case ContentTypeFromContent:
+			b, err := sniff()
+			if err != nil {
+				return "", err
+			}
+			typ = http.DetectContentType(b)
+		}
+		if typ == "" {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(typ)
+		if err != nil || mediaType == api.MimeOctetStream {
+			continue
+		}
+		ctype = typ
+		break pipeline
+	}
+
+	mediaType, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		// invalid types from the manifest are skipped, so this is not expected
+		return ctype, nil
+	}
+	if override, ok := c.types[mediaType]; ok {
+		return override, nil
+	}
+	if _, ok := params["charset"]; ok || !isTextType(mediaType) {
+		return mime.FormatMediaType(mediaType, params), nil
+	}
+	b, err := sniff()
+	if err != nil {
+		return "", err
+	}
+	if validUTF8Prefix(b, len(b) == sniffLen) {
+		params["charset"] = "utf-8"
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
+
+// isTextType reports whether the media type is text that can have a charset
+func isTextType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, allowing an incomplete rune at
+// the end of b if it is truncated
+func validUTF8Prefix(b []byte, truncated bool) bool {
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && len(b) > 0 && !utf8.Valid(b); i++ {
+			b = b[:len(b)-1]
+		}
+	}
+	return utf8.Valid(b)
+}
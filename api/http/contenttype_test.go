@@ -0,0 +1,148 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestContentTypes validates that the content type of a file is determined by the
+// first source of the pipeline which knows it, with the charset and overrides applied
+func TestContentTypes(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	latin1 := []byte("caf\xe9")
+
+	for _, tc := range []struct {
+		name         string
+		pipeline     []string
+		overrides    []string
+		file         string
+		manifestType string
+		content      []byte
+		want         string
+	}{
+		{
+			name:         "manifest type",
+			file:         "index.html",
+			manifestType: "text/plain",
+			content:      []byte("<html></html>"),
+			want:         "text/plain; charset=utf-8",
+		},
+		{
+			name:         "manifest charset",
+			file:         "index.html",
+			manifestType: "text/html; charset=ISO-8859-1",
+			content:      latin1,
+			want:         "text/html; charset=ISO-8859-1",
+		},
+		{
+			name:    "extension",
+			file:    "style.css",
+			content: []byte("body {}"),
+			want:    "text/css; charset=utf-8",
+		},
+		{
+			name:         "octet stream",
+			file:         "image.png",
+			manifestType: "application/octet-stream",
+			content:      png,
+			want:         "image/png",
+		},
+		{
+			name:    "extensionless",
+			file:    "logo",
+			content: png,
+			want:    "image/png",
+		},
+		{
+			name:    "extensionless text",
+			file:    "LICENSE",
+			content: []byte("Copyright"),
+			want:    "text/plain; charset=utf-8",
+		},
+		{
+			name:         "no utf-8 charset",
+			file:         "notes",
+			manifestType: "text/plain",
+			content:      latin1,
+			want:         "text/plain",
+		},
+		{
+			name:         "pipeline without manifest",
+			pipeline:     []string{ContentTypeFromContent},
+			file:         "logo.txt",
+			manifestType: "text/plain",
+			content:      png,
+			want:         "image/png",
+		},
+		{
+			name:    "unknown",
+			file:    "data",
+			content: []byte{0, 1, 2, 3},
+			want:    "application/octet-stream",
+		},
+		{
+			name:      "type override",
+			overrides: []string{"text/html=text/plain"},
+			file:      "index.html",
+			content:   []byte("<html></html>"),
+			want:      "text/plain",
+		},
+		{
+			name:         "extension override",
+			overrides:    []string{".WASM=application/wasm"},
+			file:         "app.wasm",
+			manifestType: "application/octet-stream",
+			content:      []byte{0, 1, 2, 3},
+			want:         "application/wasm",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewContentTypes(tc.pipeline, tc.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(tc.content)
+			got, err := c.Detect(tc.file, tc.manifestType, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got content type %q, want %q", got, tc.want)
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Fatalf("content not rewound, at position %d", pos)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		pipeline  []string
+		overrides []string
+	}{
+		{pipeline: []string{"magic"}},
+		{overrides: []string{"text/html"}},
+		{overrides: []string{"text/html=;"}},
+		{overrides: []string{"html=text/plain"}},
+	} {
+		if _, err := NewContentTypes(tc.pipeline, tc.overrides); err == nil {
+			t.Fatalf("expected error for pipeline %v and overrides %v", tc.pipeline, tc.overrides)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// GatewayAPIVersion is the version of the gateway admin RPC API
+const GatewayAPIVersion = "1.0"
+
+const (
+	gatewayRateWindow  = time.Minute // window in which the requests of a client are limited
+	gatewayQuotaPeriod = time.Hour   // period of the bandwidth quota of a client
+	maxGatewayClients  = 100000      // clients whose usage is tracked before expired entries are removed
+)
+
+// UploadTokenHeaderName is the header carrying the token that authorizes an upload
+// through a gateway that does not accept anonymous uploads
+const UploadTokenHeaderName = "x-swarm-upload-token"
+
+// GatewayPolicy holds the limits a public gateway enforces on its clients.
+// Clients are identified by their IP address, zero values mean no limit.
+type GatewayPolicy struct {
+	RequestsPerMinute int      `json:"requestsPerMinute"` // requests a client can make in a minute
+	MaxUploadSize     int64    `json:"maxUploadSize"`     // size in bytes of the largest accepted request body
+	BandwidthQuota    int64    `json:"bandwidthQuota"`    // bytes a client can upload and download in an hour
+	BlockedTopics     []string `json:"blockedTopics"`     // pss topics rpc clients can not use, hex encoded or topic strings
+	AnonymousUploads  bool     `json:"anonymousUploads"`  // whether uploads without a valid upload token are accepted
+	UploadTokens      []string `json:"uploadTokens"`      // tokens authorizing uploads when anonymous uploads are off
+}
+
+// GatewayUsage is the current usage of the gateway by a client
+type GatewayUsage struct {
+	Client   string `json:"client"`
+	Requests int    `json:"requests"` // requests in the current minute
+	Bytes    int64  `json:"bytes"`    // bytes transferred in the current hour
+}
+
+// gatewayClient tracks the usage of a single client
+type gatewayClient struct {
+	rateStart  time.Time
+	requests   int
+	quotaStart time.Time
+	bytes      int64
+}
+
+// Gateway enforces a GatewayPolicy on the requests to the HTTP server.
+// The policy can be replaced at any time with SetPolicy.
+type Gateway struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	policy  GatewayPolicy
+	topics  map[message.Topic]bool
+	clients map[string]*gatewayClient
+}
+
+// NewGateway creates a Gateway enforcing the given policy
+func NewGateway(policy GatewayPolicy) (*Gateway, error) {
+	g := &Gateway{
+		now:     time.Now,
+		clients: make(map[string]*gatewayClient),
+	}
+	if err := g.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Policy returns the policy currently enforced
+func (g *Gateway) Policy() GatewayPolicy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.policy
+}
+
+// SetPolicy replaces the enforced policy, usage counted so far is kept
+func (g *Gateway) SetPolicy(policy GatewayPolicy) error {
+	if policy.RequestsPerMinute < 0 || policy.MaxUploadSize < 0 || policy.BandwidthQuota < 0 {
+		return fmt.Errorf("gateway limits can not be negative")
+	}
+	topics := make(map[message.Topic]bool)
+	for _, t := range policy.BlockedTopics {
+		topic, err := ParseTopic(t)
+		if err != nil {
+			return err
+		}
+		topics[topic] = true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+	g.topics = topics
+	return nil
+}
+
+// TopicBlocked reports whether pss rpc clients are not allowed to use the topic
+func (g *Gateway) TopicBlocked(topic message.Topic) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.topics[topic]
+}
+
+// Usage returns the usage of the clients seen in the current periods, sorted by client
+func (g *Gateway) Usage() []GatewayUsage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	var usage []GatewayUsage
+	for client, c := range g.clients {
+		c.expire(now)
+		if c.requests == 0 && c.bytes == 0 {
+			continue
+		}
+		usage = append(usage, GatewayUsage{
+			Client:   client,
+			Requests: c.requests,
+			Bytes:    c.bytes,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Client < usage[j].Client
+	})
+	return usage
+}
+
+// ParseTopic parses a pss topic given either as 0x prefixed hex or as a string hashed with message.NewTopic
+func ParseTopic(s string) (topic message.Topic, err error) {
+	if strings.HasPrefix(s, "0x") {
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return topic, fmt.Errorf("invalid topic %q: %v", s, err)
+		}
+		if len(b) != message.TopicLength {
+			return topic, fmt.Errorf("invalid topic %q: length is not %d bytes", s, message.TopicLength)
+		}
+		copy(topic[:], b)
+		return topic, nil
+	}
+	return message.NewTopic([]byte(s)), nil
+}
+
+// expire resets the counters whose period has passed
+func (c *gatewayClient) expire(now time.Time) {
+	if now.Sub(c.rateStart) >= gatewayRateWindow {
+		c.rateStart = now
+		c.requests = 0
+	}
+	if now.Sub(c.quotaStart) >= gatewayQuotaPeriod {
+		c.quotaStart = now
+		c.bytes = 0
+	}
+}
+
+// admit counts a request of the client and returns the status code
+// and message of the response if the request is refused
+func (g *Gateway) admit(client string, r *http.Request) (int, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if isWriteRequest(r) {
+		if !g.policy.AnonymousUploads && !g.validUploadToken(r.Header.Get(UploadTokenHeaderName)) {
+			return http.StatusForbidden, "anonymous uploads are not accepted by this gateway"
+		}
+		if g.policy.MaxUploadSize > 0 && r.ContentLength > g.policy.MaxUploadSize {
+			return http.StatusRequestEntityTooLarge, fmt.Sprintf("upload is larger than %d bytes", g.policy.MaxUploadSize)
+		}
+	}
+
+	now := g.now()
+	c, ok := g.clients[client]
+	if !ok {
+		if len(g.clients) >= maxGatewayClients {
+			g.removeExpired(now)
+		}
+		c = &gatewayClient{rateStart: now, quotaStart: now}
+		g.clients[client] = c
+	}
+	c.expire(now)
+
+	if g.policy.RequestsPerMinute > 0 && c.requests >= g.policy.RequestsPerMinute {
+		return http.StatusTooManyRequests, "request rate limit exceeded"
+	}
+	if g.policy.BandwidthQuota > 0 && c.bytes >= g.policy.BandwidthQuota {
+		return http.StatusTooManyRequests, "bandwidth quota exceeded"
+	}
+	c.requests++
+	return 0, ""
+}
+
+// account adds the bytes transferred for a request of the client to its usage
+func (g *Gateway) account(client string, n int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.clients[client]; ok {
+		c.bytes += n
+	}
+}
+
+// validUploadToken reports whether the token is one of the policy upload tokens
+func (g *Gateway) validUploadToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range g.policy.UploadTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExpired removes the clients without usage in the current periods
+func (g *Gateway) removeExpired(now time.Time) {
+	for client, c := range g.clients {
+		if now.Sub(c.rateStart) >= gatewayRateWindow && now.Sub(c.quotaStart) >= gatewayQuotaPeriod {
+			delete(g.clients, client)
+		}
+	}
+}
+
+// isWriteRequest reports whether the request stores or changes content
+func isWriteRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// EnforceGateway is a middleware that refuses the requests exceeding the limits of the gateway policy
+// and counts the bytes uploaded and downloaded by each client against its bandwidth quota
+func EnforceGateway(h http.Handler, g *Gateway) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if code, msg := g.admit(client, r); code != 0 {
+			metrics.GetOrRegisterCounter(fmt.Sprintf("http/gateway/refused/%d", code), nil).Inc(1)
+			log.Debug("gateway refused request", "client", client, "code", code, "reason", msg)
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", strconv.Itoa(int(gatewayRateWindow.Seconds())))
+			}
+			respondError(w, r, msg, code)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if max := g.Policy().MaxUploadSize; max > 0 && isWriteRequest(r) {
+			body.ReadCloser = http.MaxBytesReader(w, r.Body, max)
+		}
+		r.Body = body
+		cw := &countingResponseWriter{ResponseWriter: w}
+
+		h.ServeHTTP(cw, r)
+
+		g.account(client, body.n+cw.n)
+	})
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingResponseWriter counts the bytes written to a response
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped response writer does
+func (c *countingResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the wrapped response writer does,
+// the traffic of hijacked connections is not accounted
+func (c *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// GatewayAPI is the admin RPC API adjusting the gateway policy of a running node
+type GatewayAPI struct {
+	gateway *Gateway
+}
+
+// NewGatewayAPI creates a GatewayAPI for the given gateway
+func NewGatewayAPI(g *Gateway) *GatewayAPI {
+	return &GatewayAPI{gateway: g}
+}
+
+// Policy returns the gateway policy currently enforced
+func (a *GatewayAPI) Policy() GatewayPolicy {
+	return a.gateway.Policy()
+}
+
+// SetPolicy replaces the gateway policy without restarting the node
+func (a *GatewayAPI) SetPolicy(policy GatewayPolicy) error {
+	if err := a.gateway.SetPolicy(policy); err != nil {
+		return err
+	}
+	log.Info("gateway policy updated", "requestsPerMinute", policy.RequestsPerMinute, "maxUploadSize", policy.MaxUploadSize, "bandwidthQuota", policy.BandwidthQuota, "blockedTopics", len(policy.BlockedTopics), "anonymousUploads", policy.AnonymousUploads)
+	return nil
+}
+
+// Usage returns the usage of the gateway by its clients in the current periods
+func (a *GatewayAPI) Usage() []GatewayUsage {
+	return a.gateway.Usage()
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// TestGateway tests that the gateway middleware enforces the limits of the policy
+// and that the policy can be changed while serving
+func TestGateway(t *testing.T) {
+	g, err := NewGateway(GatewayPolicy{
+		RequestsPerMinute: 3,
+		MaxUploadSize:     10,
+		AnonymousUploads:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+
+	handler := EnforceGateway(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(append([]byte("ok"), body...))
+	}), g)
+
+	do := func(method, client string, body []byte, header http.Header) int {
+		t.Helper()
+		req := httptest.NewRequest(method, "/bzz-raw:/", bytes.NewReader(body))
+		req.RemoteAddr = client + ":1234"
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// rate limit per client
+	for i := 0; i < 3; i++ {
+		if code := do(http.MethodGet, "10.0.0.1", nil, nil); code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if code := do(http.MethodGet, "10.0.0.1", nil, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := do(http.MethodGet, "10.0.0.2", nil, nil); code != http.StatusOK {
+		t.Fatalf("other client: got status %d, want %d", code, http.StatusOK)
+	}
+	now = now.Add(gatewayRateWindow)
+	if code := do(http.MethodGet, "10.0.0.1", nil, nil); code != http.StatusOK {
+		t.Fatalf("next window: got status %d, want %d", code, http.StatusOK)
+	}
+
+	// max upload size
+	if code := do(http.MethodPost, "10.0.0.3", make([]byte, 11), nil); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large upload: got status %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+	if code := do(http.MethodPost, "10.0.0.3", make([]byte, 10), nil); code != http.StatusOK {
+		t.Fatalf("small upload: got status %d, want %d", code, http.StatusOK)
+	}
+
+	// anonymous uploads turned off at runtime
+	if err := g.SetPolicy(GatewayPolicy{UploadTokens: []string{"secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(http.MethodPost, "10.0.0.4", []byte("data"), nil); code != http.StatusForbidden {
+		t.Fatalf("anonymous upload: got status %d, want %d", code, http.StatusForbidden)
+	}
+	header := http.Header{}
+	header.Set(UploadTokenHeaderName, "wrong")
+	if code := do(http.MethodPost, "10.0.0.4", []byte("data"), header); code != http.StatusForbidden {
+		t.Fatalf("wrong token: got status %d, want %d", code, http.StatusForbidden)
+	}
+	header.Set(UploadTokenHeaderName, "secret")
+	if code := do(http.MethodPost, "10.0.0.4", []byte("data"), header); code != http.StatusOK {
+		t.Fatalf("authorized upload: got status %d, want %d", code, http.StatusOK)
+	}
+	if code := do(http.MethodGet, "10.0.0.4", nil, nil); code != http.StatusOK {
+		t.Fatalf("download: got status %d, want %d", code, http.StatusOK)
+	}
+
+	// bandwidth quota counts uploaded and downloaded bytes
+	if err := g.SetPolicy(GatewayPolicy{BandwidthQuota: 10, AnonymousUploads: true}); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(http.MethodPost, "10.0.0.5", []byte("12345"), nil); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if code := do(http.MethodGet, "10.0.0.5", nil, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("quota exceeded: got status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	var found bool
+	for _, u := range g.Usage() {
+		if u.Client == "10.0.0.5" {
+			found = true
+			if u.Bytes != 12 {
+				t.Fatalf("got %d bytes used, want 12", u.Bytes)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("client usage not reported")
+	}
+	now = now.Add(gatewayQuotaPeriod)
+	if code := do(http.MethodGet, "10.0.0.5", nil, nil); code != http.StatusOK {
+		t.Fatalf("next period: got status %d, want %d", code, http.StatusOK)
+	}
+
+	if err := g.SetPolicy(GatewayPolicy{RequestsPerMinute: -1}); err == nil {
+		t.Fatal("expected error for negative limit")
+	}
+}
+
+// TestGatewayBlockedTopics tests that blocked pss topics are parsed from hex and topic strings
+func TestGatewayBlockedTopics(t *testing.T) {
+	topic := message.NewTopic([]byte("chat"))
+	g, err := NewGateway(GatewayPolicy{BlockedTopics: []string{"spam", topic.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.TopicBlocked(topic) {
+		t.Fatal("hex topic not blocked")
+	}
+	if !g.TopicBlocked(message.NewTopic([]byte("spam"))) {
+		t.Fatal("string topic not blocked")
+	}
+	if g.TopicBlocked(message.NewTopic([]byte("news"))) {
+		t.Fatal("unexpected blocked topic")
+	}
+	if _, err := NewGateway(GatewayPolicy{BlockedTopics: []string{"0x1234"}}); err == nil {
+		t.Fatal("expected error for short hex topic")
+	}
+}
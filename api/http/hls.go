@@ -0,0 +1,333 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// HLS streaming of MPEG transport streams stored in swarm.
+//
+// bzz-hls:/<addr>/index.m3u8 responds with an HLS media playlist of the transport stream
+// with the root address, split into segments of about hlsSegmentDuration on packet
+// boundaries. The segments, bzz-hls:/<addr>/<start>-<end>.ts, are served with range
+// reads of the byte range of the stream, so only the chunks of the played segments are
+// retrieved and the stream is not transcoded. The duration of the segments is estimated
+// from the timestamps at the start and the end of the stream, assuming a constant bitrate.
+
+var (
+	getHLSCount = metrics.NewRegisteredCounter("api/http/get/hls/count", nil)
+	getHLSFail  = metrics.NewRegisteredCounter("api/http/get/hls/fail", nil)
+)
+
+const (
+	hlsPlaylistName    = "index.m3u8"
+	hlsSegmentDuration = 6 * time.Second // target duration of the segments
+
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsProbeSize  = 1024 * tsPacketSize // bytes read at the start and the end of a stream to find its timestamps
+	ptsFrequency = 90000               // ticks per second of the presentation timestamps
+	ptsWrap      = 1 << 33             // presentation timestamps are 33 bits
+)
+
+var errNotTransportStream = errors.New("not an MPEG transport stream")
+
+// HandleGetHLS handles a GET request to bzz-hls:/<addr>/<path> and responds with the
+// HLS playlist or a segment of the MPEG transport stream with the root address
+func (s *Server) HandleGetHLS(w http.ResponseWriter, r *http.Request) {
+	ruid := GetRUID(r.Context())
+	uri := GetURI(r.Context())
+	log.Debug("handle.get.hls", "ruid", ruid, "uri", uri)
+	getHLSCount.Inc(1)
+
+	addr := uri.Address()
+	if addr == nil {
+		var err error
+		addr, err = s.api.Resolve(r.Context(), uri.Addr)
+		if err != nil {
+			getHLSFail.Inc(1)
+			respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
+			return
+		}
+	} else {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	}
+
+	reader, _ := s.api.Retrieve(r.Context(), addr)
+	size, err := reader.Size(r.Context(), nil)
+	if err != nil {
+		getHLSFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("root chunk not found %s: %s", addr, err), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case uri.Path == hlsPlaylistName:
+		s.serveHLSPlaylist(w, r, reader, size)
+	case strings.HasSuffix(uri.Path, ".ts"):
+		s.serveHLSSegment(w, r, reader, size, strings.TrimSuffix(uri.Path, ".ts"))
+	default:
+		respondError(w, r, fmt.Sprintf("invalid hls path %q", uri.Path), http.StatusNotFound)
+	}
+}
+
+// serveHLSPlaylist responds with the media playlist of the stream
+func (s *Server) serveHLSPlaylist(w http.ResponseWriter, r *http.Request, reader storage.LazySectionReader, size int64) {
+	duration, err := tsDuration(reader, size)
+	if err != nil {
+		getHLSFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write(hlsPlaylist(size, duration))
+}
+
+// serveHLSSegment responds with the segment of the stream in the byte range,
+// preceded by the program tables of the stream so that it can be decoded on its own
+func (s *Server) serveHLSSegment(w http.ResponseWriter, r *http.Request, reader storage.LazySectionReader, size int64, byteRange string) {
+	var start, end int64
+	if _, err := fmt.Sscanf(byteRange, "%d-%d", &start, &end); err != nil || start < 0 || start%tsPacketSize != 0 || end <= start || end > size {
+		respondError(w, r, fmt.Sprintf("invalid hls segment %q", byteRange), http.StatusNotFound)
+		return
+	}
+	var tables []byte
+	if start > 0 {
+		var err error
+		tables, err = tsProgramTables(reader, size)
+		if err != nil {
+			getHLSFail.Inc(1)
+			respondError(w, r, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	if _, err := reader.Seek(start, io.SeekStart); err != nil {
+		getHLSFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(tables))+end-start, 10))
+	if _, err := w.Write(tables); err != nil {
+		return
+	}
+	if _, err := io.CopyN(w, reader, end-start); err != nil {
+		// the status is already sent, the client detects the truncated content by the content length
+		getHLSFail.Inc(1)
+		log.Debug("handle.get.hls: read failed", "ruid", GetRUID(r.Context()), "err", err)
+	}
+}
+
+// hlsPlaylist returns the media playlist of a stream of the size and duration,
+// split into segments of whole packets of about hlsSegmentDuration
+func hlsPlaylist(size int64, duration time.Duration) []byte {
+	packets := size / tsPacketSize
+	segmentPackets := int64(float64(packets) * hlsSegmentDuration.Seconds() / duration.Seconds())
+	if segmentPackets < 1 {
+		segmentPackets = 1
+	}
+	segmentSize := segmentPackets * tsPacketSize
+
+	var segments bytes.Buffer
+	var targetDuration float64
+	for start := int64(0); start < size; start += segmentSize {
+		end := start + segmentSize
+		// trailing bytes of the stream are added to the last segment
+		if end > size-tsPacketSize {
+			end = size
+		}
+		d := duration.Seconds() * float64(end-start) / float64(size)
+		targetDuration = math.Max(targetDuration, d)
+		fmt.Fprintf(&segments, "#EXTINF:%.3f,\n%d-%d.ts\n", d, start, end)
+		if end == size {
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&buf, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration)))
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	buf.Write(segments.Bytes())
+	buf.WriteString("#EXT-X-ENDLIST\n")
+	return buf.Bytes()
+}
+
+// tsDuration returns the duration of the transport stream from the difference of the
+// first presentation timestamp at its start and the last one at its end
+func tsDuration(reader io.ReaderAt, size int64) (time.Duration, error) {
+	head, err := readTSPackets(reader, 0, size)
+	if err != nil {
+		return 0, err
+	}
+	first, ok := int64(-1), false
+	for i := 0; i+tsPacketSize <= len(head) && !ok; i += tsPacketSize {
+		first, ok = tsPTS(head[i : i+tsPacketSize])
+	}
+	if !ok {
+		return 0, errors.New("no timestamps at the start of the stream")
+	}
+
+	offset := size - tsProbeSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail, err := readTSPackets(reader, offset-offset%tsPacketSize, size)
+	if err != nil {
+		return 0, err
+	}
+	last, ok := int64(-1), false
+	for i := 0; i+tsPacketSize <= len(tail); i += tsPacketSize {
+		if pts, found := tsPTS(tail[i : i+tsPacketSize]); found {
+			last, ok = pts, true
+		}
+	}
+	if !ok {
+		return 0, errors.New("no timestamps at the end of the stream")
+	}
+	ticks := (last - first + ptsWrap) % ptsWrap
+	if ticks == 0 {
+		return 0, errors.New("stream of zero duration")
+	}
+	return time.Duration(ticks) * time.Second / ptsFrequency, nil
+}
+
+// tsProgramTables returns the packets of the program association table and the
+// program map table of the first program at the start of the transport stream
+func tsProgramTables(reader io.ReaderAt, size int64) ([]byte, error) {
+	head, err := readTSPackets(reader, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	var pat []byte
+	pmtPID := -1
+	for i := 0; i+tsPacketSize <= len(head); i += tsPacketSize {
+		pkt := head[i : i+tsPacketSize]
+		pid := tsPID(pkt)
+		if !tsUnitStart(pkt) {
+			continue
+		}
+		if pid == 0 && pat == nil {
+			if pmtPID = tsPMTPID(pkt); pmtPID >= 0 {
+				pat = pkt
+			}
+			continue
+		}
+		if pat != nil && pid == pmtPID {
+			return append(append([]byte{}, pat...), pkt...), nil
+		}
+	}
+	return nil, errors.New("no program tables at the start of the stream")
+}
+
+// readTSPackets reads the packets at the offset of the transport stream, up to tsProbeSize bytes
+func readTSPackets(reader io.ReaderAt, offset, size int64) ([]byte, error) {
+	n := size - offset
+	if n > tsProbeSize {
+		n = tsProbeSize
+	}
+	buf := make([]byte, n-n%tsPacketSize)
+	if _, err := reader.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(buf) == 0 || buf[0] != tsSyncByte {
+		return nil, errNotTransportStream
+	}
+	return buf, nil
+}
+
+// tsPID returns the packet identifier of the packet
+func tsPID(pkt []byte) int {
+	return int(pkt[1]&0x1f)<<8 | int(pkt[2])
+}
+
+// tsUnitStart returns true if a section or a PES packet starts in the payload of the packet
+func tsUnitStart(pkt []byte) bool {
+	return pkt[1]&0x40 != 0
+}
+
+// tsPayload returns the payload of the packet after its adaptation field
+func tsPayload(pkt []byte) []byte {
+	if pkt[0] != tsSyncByte {
+		return nil
+	}
+	control := pkt[3] >> 4 & 0x3
+	offset := 4
+	if control&0x2 != 0 {
+		offset += 1 + int(pkt[4])
+	}
+	if control&0x1 == 0 || offset >= len(pkt) {
+		return nil
+	}
+	return pkt[offset:]
+}
+
+// tsPTS returns the presentation timestamp of the PES packet starting in the packet
+func tsPTS(pkt []byte) (int64, bool) {
+	payload := tsPayload(pkt)
+	if !tsUnitStart(pkt) || len(payload) < 14 || !bytes.Equal(payload[:3], []byte{0, 0, 1}) {
+		return 0, false
+	}
+	if payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+	return pts, true
+}
+
+// tsPMTPID returns the packet identifier of the program map table of the first program
+// in the program association table in the packet, or -1
+func tsPMTPID(pkt []byte) int {
+	payload := tsPayload(pkt)
+	if len(payload) < 1 || 1+int(payload[0]) > len(payload) {
+		return -1
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 8 {
+		return -1
+	}
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	// the programs follow the 8 byte header and precede the 4 byte checksum
+	end := 3 + length - 4
+	if end > len(section) {
+		return -1
+	}
+	for i := 8; i+4 <= end; i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program != 0 {
+			return int(section[i+2]&0x1f)<<8 | int(section[i+3])
+		}
+	}
+	return -1
+}
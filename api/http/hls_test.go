@@ -0,0 +1,185 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTransportStream returns a transport stream of the number of packets with the program
+// tables in its first two packets, and a PES packet every 30 packets with a timestamp
+// advancing by the step
+func testTransportStream(packets int, step int64) []byte {
+	data := make([]byte, packets*tsPacketSize)
+	for i := 0; i < packets; i++ {
+		pkt := data[i*tsPacketSize : (i+1)*tsPacketSize]
+		pkt[0] = tsSyncByte
+		pkt[3] = 0x10 // payload only
+		switch {
+		case i == 0:
+			// program association table mapping program 1 to pid 0x100
+			pkt[1] = 0x40
+			copy(pkt[4:], []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 0x01, 0xe1, 0x00, 0, 0, 0, 0})
+		case i == 1:
+			pkt[1], pkt[2] = 0x41, 0x00
+			pkt[4] = 0xff
+		case i%30 == 2:
+			pkt[1], pkt[2] = 0x41, 0x01
+			pts := int64(i/30) * step
+			copy(pkt[4:], []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+				byte(0x21 | (pts>>29)&0x0e), byte(pts >> 22), byte(0x01 | (pts>>14)&0xfe), byte(pts >> 7), byte(0x01 | (pts<<1)&0xfe)})
+		default:
+			pkt[1], pkt[2] = 0x01, 0x01
+		}
+	}
+	return data
+}
+
+// TestBzzHLS validates that the playlist of a transport stream covers the stream
+// with segments of the estimated duration, and that the segments are served
+// with the program tables of the stream
+func TestBzzHLS(t *testing.T) {
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	// 100 PES packets, 0.2 seconds apart
+	data := testTransportStream(3000, ptsFrequency/5)
+	resp, err := http.Post(fmt.Sprintf("%s/bzz-raw:/", srv.URL), "video/mp2t", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("err %s", resp.Status)
+	}
+	rootHash, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/bzz-hls:/%s/%s", srv.URL, rootHash, hlsPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("err %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Fatalf("got content type %q", ct)
+	}
+	var total float64
+	var segments []string
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+		if strings.HasPrefix(line, "#EXTINF:") {
+			d, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ","), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += d
+		} else if !strings.HasPrefix(line, "#") {
+			segments = append(segments, line)
+		}
+	}
+	if lines[0] != "#EXTM3U" || lines[len(lines)-1] != "#EXT-X-ENDLIST" {
+		t.Fatalf("invalid playlist %v", lines)
+	}
+	if want := (99 * 200 * time.Millisecond).Seconds(); total < want-0.01 || total > want+0.01 {
+		t.Fatalf("got duration %v, want %v", total, want)
+	}
+	if len(segments) != 4 {
+		t.Fatalf("got %d segments, want 4", len(segments))
+	}
+
+	// the segments are contiguous and cover the stream
+	var offset int64
+	for _, segment := range segments {
+		var start, end int64
+		if _, err := fmt.Sscanf(segment, "%d-%d.ts", &start, &end); err != nil {
+			t.Fatal(err)
+		}
+		if start != offset {
+			t.Fatalf("segment %s starts at %d, want %d", segment, start, offset)
+		}
+		offset = end
+
+		resp, err := http.Get(fmt.Sprintf("%s/bzz-hls:/%s/%s", srv.URL, rootHash, segment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("segment %s: err %s", segment, resp.Status)
+		}
+		want := data[start:end]
+		if start > 0 {
+			want = append(append([]byte{}, data[:2*tsPacketSize]...), want...)
+		}
+		if !bytes.Equal(body, want) {
+			t.Fatalf("segment %s: content mismatch", segment)
+		}
+	}
+	if offset != int64(len(data)) {
+		t.Fatalf("segments end at %d, want %d", offset, len(data))
+	}
+
+	for _, segment := range []string{"1-189.ts", "0-999999999.ts", "x.ts", "other"} {
+		resp, err := http.Get(fmt.Sprintf("%s/bzz-hls:/%s/%s", srv.URL, rootHash, segment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("segment %s: got status %s, want %d", segment, resp.Status, http.StatusNotFound)
+		}
+	}
+
+	// other content is not streamed
+	resp, err = http.Post(fmt.Sprintf("%s/bzz-raw:/", srv.URL), "text/plain", strings.NewReader("not a video"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	rootHash, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(fmt.Sprintf("%s/bzz-hls:/%s/%s", srv.URL, rootHash, hlsPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("got status %s, want %d", resp.Status, http.StatusUnsupportedMediaType)
+	}
+}
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strconv"
@@ -12,8 +14,11 @@ import (
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/trojan"
 	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/spancontext"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/encryption"
 	"github.com/ethersphere/swarm/storage/pin"
 	"github.com/pborman/uuid"
 )
@@ -53,6 +58,34 @@ func SetRequestHost(h http.Handler) http.Handler {
 	})
 }
 
+// SetRetrievalClient is a middleware that injects the remote host of the request
+// into the request context, so that chunk retrievals are scheduled fairly among clients.
+// Requests with the BackgroundHeaderName header set are retrieved with background priority.
+// Chunks that can not be retrieved are requested to be recovered from the neighbourhoods
+// given with the RecoveryHeaderName header.
+func SetRetrievalClient(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		ctx := sctx.SetClient(r.Context(), client)
+		if background, _ := strconv.ParseBool(r.Header.Get(BackgroundHeaderName)); background {
+			ctx = sctx.SetBackground(ctx)
+		}
+		if recoveryTargets := r.Header.Get(RecoveryHeaderName); recoveryTargets != "" {
+			targets, err := parseRecoveryTargets(recoveryTargets)
+			if err != nil {
+				respondError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ctx = sctx.SetRecoveryTargets(ctx, targets)
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // ParseURI is a middleware that parses the request URI
 // to a Swarm URI object that dissects the content presented after the HTTP URI's first slash
 func ParseURI(h http.Handler) http.Handler {
@@ -111,6 +144,13 @@ func InitUploadTag(h http.Handler, tags *chunk.Tags) http.Handler {
 			contentType          = r.Header.Get("Content-Type")
 			headerTag            = r.Header.Get(TagHeaderName)
 			anonTag              = r.Header.Get(AnonymousHeaderName)
+			priorityTag          = r.Header.Get(PriorityHeaderName)
+			rateLimitTag         = r.Header.Get(RateLimitHeaderName)
+			postageBatch         = r.Header.Get(PostageHeaderName)
+			chunking             = r.Header.Get(ChunkingHeaderName)
+			dedupTag             = r.Header.Get(DedupHeaderName)
+			compression          = r.Header.Get(CompressionHeaderName)
+			encryptionKey        = r.Header.Get(EncryptionKeyHeaderName)
 		)
 		if headerTag != "" {
 			tagName = headerTag
@@ -139,13 +179,105 @@ func InitUploadTag(h http.Handler, tags *chunk.Tags) http.Handler {
 			log.Error("error creating tag", "err", err, "tagName", tagName)
 		}
 
+		if priorityTag != "" {
+			priority, err := parsePriority(priorityTag)
+			if err != nil {
+				respondError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			t.SetPriority(priority)
+		}
+		if rateLimitTag != "" {
+			rateLimit, err := strconv.ParseInt(rateLimitTag, 10, 64)
+			if err != nil || rateLimit < 0 {
+				respondError(w, r, fmt.Sprintf("invalid rate limit %q", rateLimitTag), http.StatusBadRequest)
+				return
+			}
+			t.SetRateLimit(rateLimit)
+		}
+		if dedupTag != "" {
+			dedup, err := strconv.ParseBool(dedupTag)
+			if err != nil {
+				respondError(w, r, fmt.Sprintf("invalid dedup %q", dedupTag), http.StatusBadRequest)
+				return
+			}
+			t.SetDedup(dedup)
+		}
+
 		log.Trace("setting tag id to context", "uid", t.Uid)
 		ctx := sctx.SetTag(r.Context(), t.Uid)
 
+		if postageBatch != "" {
+			batchID, err := hex.DecodeString(strings.TrimPrefix(postageBatch, "0x"))
+			if err != nil || len(batchID) != 32 {
+				respondError(w, r, fmt.Sprintf("invalid postage batch %q", postageBatch), http.StatusBadRequest)
+				return
+			}
+			ctx = sctx.SetPostageBatch(ctx, batchID)
+		}
+
+		switch strings.ToLower(chunking) {
+		case "", storage.ChunkingFixed:
+		case storage.ChunkingContentDefined:
+			ctx = sctx.SetContentDefinedChunking(ctx)
+		default:
+			respondError(w, r, fmt.Sprintf("invalid chunking mode %q", chunking), http.StatusBadRequest)
+			return
+		}
+
+		switch strings.ToLower(compression) {
+		case "", storage.CompressionNone:
+		case storage.CompressionSnappy:
+			ctx = sctx.SetCompression(ctx, storage.CompressionSnappy)
+		default:
+			respondError(w, r, fmt.Sprintf("invalid compression %q", compression), http.StatusBadRequest)
+			return
+		}
+
+		if encryptionKey != "" {
+			key, err := encryption.ParseMasterKey(encryptionKey)
+			if err != nil {
+				respondError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ctx = sctx.SetMasterKey(ctx, key)
+		}
+
 		h.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// parsePriority parses the value of the priority header into a tag priority
+func parsePriority(s string) (chunk.Priority, error) {
+	switch strings.ToLower(s) {
+	case "background", "low":
+		return chunk.PriorityBackground, nil
+	case "normal":
+		return chunk.PriorityNormal, nil
+	case "high":
+		return chunk.PriorityHigh, nil
+	}
+	return 0, fmt.Errorf("invalid priority %q", s)
+}
+
+// parseRecoveryTargets parses the value of the recovery header into address prefixes
+// of equal length, at most trojan.MaxTargets of at most trojan.MaxTargetSize bytes
+func parseRecoveryTargets(s string) ([][]byte, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > trojan.MaxTargets {
+		return nil, fmt.Errorf("invalid recovery targets %q: more than %d targets", s, trojan.MaxTargets)
+	}
+	var targets [][]byte
+	for _, t := range parts {
+		target, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(t), "0x"))
+		if err != nil || len(target) == 0 || len(target) > trojan.MaxTargetSize || len(targets) > 0 && len(target) != len(targets[0]) {
+			return nil, fmt.Errorf("invalid recovery targets %q", s)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
 // InstrumentOpenTracing instruments an HTTP request with an OpenTracing span
 func InstrumentOpenTracing(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -185,6 +317,42 @@ func PinningEnabledPassthrough(h http.Handler, api *pin.API, checkHeader bool) h
 	})
 }
 
+// RouteDNSLink is a middleware that serves the content linked to the domain of the request
+// with a swarmlink=/bzz:/<address> TXT record under the root of the domain, by rewriting
+// the request path to the bzz:/<address>/<path> form. Requests with a bzz scheme path,
+// to IP addresses or to domains without a link are passed through unchanged.
+func RouteDNSLink(h http.Handler, a *api.API) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.DNSLink == nil || r.Method != http.MethodGet && r.Method != http.MethodHead || strings.HasPrefix(r.URL.Path, "/bzz") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		addr, err := a.DNSLink.Lookup(r.Context(), host)
+		if err != nil {
+			log.Debug("dnslink lookup failed", "host", host, "err", err)
+			respondError(w, r, fmt.Sprintf("cannot resolve %s: %v", host, err), http.StatusBadGateway)
+			return
+		}
+		if addr == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		log.Debug("routing request with dnslink", "host", host, "addr", addr, "path", r.URL.Path)
+		r.URL.Path = "/bzz:/" + addr + r.URL.Path
+		r.URL.RawPath = ""
+		r.RequestURI = r.URL.RequestURI()
+		h.ServeHTTP(w, r)
+	})
+}
+
 // RecoverPanic is a middleware intended to catch possible panic in the call stack
 // and log them when they occur, failing gracefully to the client
 func RecoverPanic(h http.Handler) http.Handler {
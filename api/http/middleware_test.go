@@ -0,0 +1,44 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/swarm/pss/trojan"
+)
+
+// TestParseRecoveryTargets tests that the recovery header is parsed into at most
+// trojan.MaxTargets targets of equal length up to trojan.MaxTargetSize
+func TestParseRecoveryTargets(t *testing.T) {
+	targets, err := parseRecoveryTargets("0x0102, 0304")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || !bytes.Equal(targets[0], []byte{1, 2}) || !bytes.Equal(targets[1], []byte{3, 4}) {
+		t.Fatalf("got targets %x", targets)
+	}
+
+	tooMany := strings.Repeat("01,", trojan.MaxTargets) + "01"
+	for _, s := range []string{"", "zz", "01,0203", "010203", tooMany} {
+		if _, err := parseRecoveryTargets(s); err == nil {
+			t.Fatalf("expected targets %q to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// QuotaAPIVersion is the version of the quota admin RPC API
+const QuotaAPIVersion = "1.0"
+
+// QuotaPath is the path of the endpoint serving the usage of the account of the request
+const QuotaPath = "/quota"
+
+const (
+	quotaAccountPrefix = "quota_account_" // state store key prefix of the usage of the accounts
+	quotaPinPrefix     = "quota_pin_"     // state store key prefix of the pins accounted to the accounts
+)
+
+// ErrQuotaExceeded is returned when an account exhausted its quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimits are the limits of the usage of an account, zero values mean no limit
+type QuotaLimits struct {
+	UploadBytes int64 `json:"uploadBytes"` // bytes the account can upload in total
+	PinnedBytes int64 `json:"pinnedBytes"` // bytes of uploads the account can keep pinned
+}
+
+// AccountUsage is the usage of an account and the limits it is held to
+type AccountUsage struct {
+	Account  string      `json:"account"`
+	Uploaded int64       `json:"uploaded"` // bytes uploaded since the usage was last reset
+	Pinned   int64       `json:"pinned"`   // bytes of the uploads pinned and not yet unpinned
+	Limits   QuotaLimits `json:"limits"`
+	Custom   bool        `json:"custom"` // whether the limits were set for the account instead of the defaults
+}
+
+// quotaAccount is the usage of an account as persisted
+type quotaAccount struct {
+	Uploaded int64        `json:"uploaded"`
+	Pinned   int64        `json:"pinned"`
+	Limits   *QuotaLimits `json:"limits,omitempty"` // nil if the default limits apply
+}
+
+// quotaPin is a pin accounted to an account as persisted
+type quotaPin struct {
+	Account string `json:"account"`
+	Size    int64  `json:"size"`
+}
+
+// Quota tracks the bytes uploaded and pinned by the accounts of the API tokens
+// and holds them to their limits. The usage is persisted in the state store.
+// Requests made with admin tokens are not accounted.
+type Quota struct {
+	store state.Store
+
+	mu       sync.Mutex
+	defaults QuotaLimits
+	accounts map[string]*quotaAccount
+	pins     map[string]*quotaPin // keyed by the hex of the pinned address
+}
+
+// NewQuota creates a Quota with the usage persisted in the store, holding the
+// accounts without limits of their own to the default limits
+func NewQuota(store state.Store, defaults QuotaLimits) (*Quota, error) {
+	if err := validLimits(defaults); err != nil {
+		return nil, err
+	}
+	q := &Quota{
+		store:    store,
+		defaults: defaults,
+		accounts: make(map[string]*quotaAccount),
+		pins:     make(map[string]*quotaPin),
+	}
+	err := store.Iterate(quotaAccountPrefix, func(key, value []byte) (bool, error) {
+		a := new(quotaAccount)
+		if err := json.Unmarshal(value, a); err != nil {
+			return true, fmt.Errorf("decode quota account %s: %v", key, err)
+		}
+		q.accounts[strings.TrimPrefix(string(key), quotaAccountPrefix)] = a
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.Iterate(quotaPinPrefix, func(key, value []byte) (bool, error) {
+		p := new(quotaPin)
+		if err := json.Unmarshal(value, p); err != nil {
+			return true, fmt.Errorf("decode quota pin %s: %v", key, err)
+		}
+		q.pins[strings.TrimPrefix(string(key), quotaPinPrefix)] = p
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func validLimits(l QuotaLimits) error {
+	if l.UploadBytes < 0 || l.PinnedBytes < 0 {
+		return fmt.Errorf("invalid quota limits %+v", l)
+	}
+	return nil
+}
+
+// Usage returns the usage of the account
+func (q *Quota) Usage(account string) AccountUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage(account, q.accounts[account])
+}
+
+// Accounts returns the usage of all accounts that uploaded or have limits of their own,
+// sorted by account
+func (q *Quota) Accounts() []AccountUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := make([]AccountUsage, 0, len(q.accounts))
+	for account, a := range q.accounts {
+		usage = append(usage, q.usage(account, a))
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Account < usage[j].Account
+	})
+	return usage
+}
+
+// Defaults returns the limits of the accounts without limits of their own
+func (q *Quota) Defaults() QuotaLimits {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.defaults
+}
+
+// SetLimits sets the limits of the account, nil makes the default limits apply to it
+func (q *Quota) SetLimits(account string, limits *QuotaLimits) error {
+	if limits != nil {
+		if err := validLimits(*limits); err != nil {
+			return err
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a := q.account(account)
+	a.Limits = limits
+	return q.save(account, a)
+}
+
+// Reset sets the bytes uploaded by the account to zero, the pinned bytes are kept
+// as they are only released when the content is unpinned
+func (q *Quota) Reset(account string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a, ok := q.accounts[account]
+	if !ok {
+		return nil
+	}
+	a.Uploaded = 0
+	return q.save(account, a)
+}
+
+// remaining returns the number of bytes the account can still upload, pinned if pin is true,
+// or -1 if it is not limited
+func (q *Quota) remaining(account string, pin bool) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a := q.accounts[account]
+	u := q.usage(account, a)
+	remaining := int64(-1)
+	if u.Limits.UploadBytes > 0 {
+		remaining = max64(u.Limits.UploadBytes-u.Uploaded, 0)
+	}
+	if pin && u.Limits.PinnedBytes > 0 {
+		left := max64(u.Limits.PinnedBytes-u.Pinned, 0)
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining
+}
+
+// AddUploaded accounts n uploaded bytes to the account
+func (q *Quota) AddUploaded(account string, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a := q.account(account)
+	a.Uploaded += n
+	return q.save(account, a)
+}
+
+// AddPin accounts the pinned content at the address of size bytes to the account
+func (q *Quota) AddPin(account string, addr storage.Address, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := addr.Hex()
+	if _, ok := q.pins[key]; ok {
+		// the content is already accounted to the account that pinned it first
+		return nil
+	}
+	p := &quotaPin{Account: account, Size: size}
+	if err := q.store.Put(quotaPinPrefix+key, p); err != nil {
+		return err
+	}
+	q.pins[key] = p
+	a := q.account(account)
+	a.Pinned += size
+	return q.save(account, a)
+}
+
+// RemovePin releases the pinned bytes of the content at the address from the account
+// it is accounted to
+func (q *Quota) RemovePin(addr storage.Address) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := addr.Hex()
+	p, ok := q.pins[key]
+	if !ok {
+		return nil
+	}
+	if err := q.store.Delete(quotaPinPrefix + key); err != nil {
+		return err
+	}
+	delete(q.pins, key)
+	a := q.account(p.Account)
+	a.Pinned = max64(a.Pinned-p.Size, 0)
+	return q.save(p.Account, a)
+}
+
+// account returns the usage of the account, creating it if it does not exist
+func (q *Quota) account(account string) *quotaAccount {
+	a, ok := q.accounts[account]
+	if !ok {
+		a = new(quotaAccount)
+		q.accounts[account] = a
+	}
+	return a
+}
+
+func (q *Quota) save(account string, a *quotaAccount) error {
+	return q.store.Put(quotaAccountPrefix+account, a)
+}
+
+func (q *Quota) usage(account string, a *quotaAccount) AccountUsage {
+	u := AccountUsage{
+		Account: account,
+		Limits:  q.defaults,
+	}
+	if a == nil {
+		return u
+	}
+	u.Uploaded = a.Uploaded
+	u.Pinned = a.Pinned
+	if a.Limits != nil {
+		u.Limits = *a.Limits
+		u.Custom = true
+	}
+	return u
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type quotaUploadKey struct{}
+
+// quotaUpload is an upload accounted to an account
+type quotaUpload struct {
+	account string
+	body    *countingReader
+}
+
+// EnforceQuota is a middleware that refuses the uploads of accounts which exhausted their
+// quota, cuts uploads off at the remaining quota and accounts the uploaded bytes
+func EnforceQuota(h http.Handler, q *Quota) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		account := GetAccount(r.Context())
+		if account == "" || GetTokenScope(r.Context()) == ScopeAdmin || !isWriteRequest(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		pin := strings.ToLower(r.Header.Get(PinHeaderName)) == "true"
+		remaining := q.remaining(account, pin)
+		if remaining == 0 {
+			metrics.GetOrRegisterCounter("http/quota/refused", nil).Inc(1)
+			log.Debug("quota refused upload", "account", account, "pin", pin)
+			respondError(w, r, ErrQuotaExceeded.Error(), http.StatusForbidden)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if remaining > 0 {
+			body.ReadCloser = http.MaxBytesReader(w, r.Body, remaining)
+		}
+		r.Body = body
+		ctx := context.WithValue(r.Context(), quotaUploadKey{}, &quotaUpload{account: account, body: body})
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+
+		if err := q.AddUploaded(account, body.n); err != nil {
+			log.Error("quota account upload", "account", account, "err", err)
+		}
+	})
+}
+
+// accountPin accounts the content pinned by an upload to the account of the request
+func (s *Server) accountPin(r *http.Request, addr storage.Address) {
+	if s.quota == nil {
+		return
+	}
+	u, ok := r.Context().Value(quotaUploadKey{}).(*quotaUpload)
+	if !ok {
+		return
+	}
+	if err := s.quota.AddPin(u.account, addr, u.body.n); err != nil {
+		log.Error("quota account pin", "account", u.account, "addr", addr, "err", err)
+	}
+}
+
+// HandleGetQuota responds with the usage of the account of the API token of the request
+func (s *Server) HandleGetQuota(w http.ResponseWriter, r *http.Request) {
+	account := GetAccount(r.Context())
+	if s.quota == nil || account == "" {
+		respondError(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.quota.Usage(account))
+}
+
+// QuotaAPI is the admin RPC API querying the usage of the accounts and adjusting their limits
+type QuotaAPI struct {
+	quota *Quota
+}
+
+// NewQuotaAPI creates a QuotaAPI for the given Quota
+func NewQuotaAPI(q *Quota) *QuotaAPI {
+	return &QuotaAPI{quota: q}
+}
+
+// Usage returns the usage of the account
+func (api *QuotaAPI) Usage(account string) AccountUsage {
+	return api.quota.Usage(account)
+}
+
+// Accounts returns the usage of all accounts
+func (api *QuotaAPI) Accounts() []AccountUsage {
+	return api.quota.Accounts()
+}
+
+// Defaults returns the limits of the accounts without limits of their own
+func (api *QuotaAPI) Defaults() QuotaLimits {
+	return api.quota.Defaults()
+}
+
+// SetLimits sets the limits of the account, null makes the default limits apply to it
+func (api *QuotaAPI) SetLimits(account string, limits *QuotaLimits) error {
+	if err := api.quota.SetLimits(account, limits); err != nil {
+		return err
+	}
+	log.Info("quota limits set", "account", account, "limits", limits)
+	return nil
+}
+
+// Reset sets the bytes uploaded by the account to zero
+func (api *QuotaAPI) Reset(account string) error {
+	if err := api.quota.Reset(account); err != nil {
+		return err
+	}
+	log.Info("quota usage reset", "account", account)
+	return nil
+}
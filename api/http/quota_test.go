@@ -0,0 +1,155 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// TestQuota tests that the uploads and pins of the tokens of an account are accounted
+// to it, held to its limits and that the usage is persisted in the state store
+func TestQuota(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	a, err := NewAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQuota(store, QuotaLimits{UploadBytes: 10, PinnedBytes: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant1, _, err := a.MintAccount(ScopeUpload, 0, "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant2, _, err := a.MintAccount(ScopeUpload, 0, "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, _, err := a.Mint(ScopeAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewTestSwarmServer(t, func(swarmAPI *api.API, pinAPI *pin.API) TestServer {
+		server := NewServer(swarmAPI, pinAPI, "")
+		if err := server.SetAuth(a, []rpc.API{}); err != nil {
+			t.Fatal(err)
+		}
+		server.SetQuota(q)
+		return server
+	}, nil, nil)
+	defer srv.Close()
+
+	do := func(method, path, token string, body []byte, pin bool) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if pin {
+			req.Header.Set(PinHeaderName, "true")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, data
+	}
+	checkUsage := func(uploaded, pinned int64) {
+		t.Helper()
+		code, body := do(http.MethodGet, QuotaPath, tenant2, nil, false)
+		if code != http.StatusOK {
+			t.Fatalf("quota: got status %d, want %d", code, http.StatusOK)
+		}
+		var u AccountUsage
+		if err := json.Unmarshal(body, &u); err != nil {
+			t.Fatal(err)
+		}
+		if u.Account != "tenant" || u.Uploaded != uploaded || u.Pinned != pinned {
+			t.Fatalf("got usage %+v, want %d uploaded and %d pinned bytes of tenant", u, uploaded, pinned)
+		}
+	}
+
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", tenant1, []byte("1234"), false); code != http.StatusOK {
+		t.Fatalf("upload: got status %d, want %d", code, http.StatusOK)
+	}
+	checkUsage(4, 0)
+	code, hash := do(http.MethodPost, "/bzz-raw:/", tenant2, []byte("5678"), true)
+	if code != http.StatusOK {
+		t.Fatalf("pinned upload: got status %d, want %d", code, http.StatusOK)
+	}
+	checkUsage(8, 4)
+
+	// uploads of admin tokens are not accounted
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", admin, []byte("admin data"), false); code != http.StatusOK {
+		t.Fatalf("admin upload: got status %d, want %d", code, http.StatusOK)
+	}
+	checkUsage(8, 4)
+
+	// the upload is cut off at the remaining quota
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", tenant1, []byte("9abc"), true); code == http.StatusOK {
+		t.Fatal("upload exceeding the quota succeeded")
+	}
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", tenant1, []byte("d"), false); code != http.StatusForbidden {
+		t.Fatalf("upload of exhausted quota: got status %d, want %d", code, http.StatusForbidden)
+	}
+
+	// unpinning releases the pinned bytes
+	if code, _ := do(http.MethodDelete, "/bzz-pin:/"+string(hash), admin, nil, false); code != http.StatusOK {
+		t.Fatalf("unpin: got status %d, want %d", code, http.StatusOK)
+	}
+	if u := q.Usage("tenant"); u.Pinned != 0 {
+		t.Fatalf("got %d pinned bytes after unpin, want 0", u.Pinned)
+	}
+
+	if err := q.SetLimits("tenant", &QuotaLimits{UploadBytes: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(http.MethodPost, "/bzz-raw:/", tenant1, []byte("d"), false); code != http.StatusOK {
+		t.Fatalf("upload after raising the limit: got status %d, want %d", code, http.StatusOK)
+	}
+
+	q2, err := NewQuota(store, QuotaLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := q2.Usage("tenant")
+	if !u.Custom || u.Limits.UploadBytes != 100 || u.Uploaded != q.Usage("tenant").Uploaded {
+		t.Fatalf("got persisted usage %+v, want %+v", u, q.Usage("tenant"))
+	}
+	if err := q2.RemovePin(storage.Address(make([]byte, 32))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -84,13 +84,14 @@ func respondError(w http.ResponseWriter, r *http.Request, msg string, code int)
 }
 
 func respond(w http.ResponseWriter, r *http.Request, params *ResponseParams) {
-	w.WriteHeader(params.Code)
-
 	if params.Code >= 400 {
 		w.Header().Del("Cache-Control")
 		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
 	}
 
+	w.WriteHeader(params.Code)
+
 	acceptHeader := r.Header.Get("Accept")
 	// this cannot be in a switch since an Accept header can have multiple values: "Accept: */*, text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8"
 	if strings.Contains(acceptHeader, "application/json") {
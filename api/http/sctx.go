@@ -9,6 +9,10 @@ import (
 
 type uriKey struct{}
 
+type tokenScopeKey struct{}
+
+type accountKey struct{}
+
 func GetRUID(ctx context.Context) string {
 	v, ok := ctx.Value(sctx.HTTPRequestIDKey{}).(string)
 	if ok {
@@ -32,3 +36,23 @@ func GetURI(ctx context.Context) *api.URI {
 func SetURI(ctx context.Context, uri *api.URI) context.Context {
 	return context.WithValue(ctx, uriKey{}, uri)
 }
+
+// GetTokenScope returns the scope of the API token the request was authenticated with
+func GetTokenScope(ctx context.Context) TokenScope {
+	v, _ := ctx.Value(tokenScopeKey{}).(TokenScope)
+	return v
+}
+
+func SetTokenScope(ctx context.Context, scope TokenScope) context.Context {
+	return context.WithValue(ctx, tokenScopeKey{}, scope)
+}
+
+// GetAccount returns the account of the API token the request was authenticated with
+func GetAccount(ctx context.Context) string {
+	v, _ := ctx.Value(accountKey{}).(string)
+	return v
+}
+
+func SetAccount(ctx context.Context, account string) context.Context {
+	return context.WithValue(ctx, accountKey{}, account)
+}
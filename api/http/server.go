@@ -21,6 +21,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -35,9 +36,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/api/http/langos"
 	"github.com/ethersphere/swarm/chunk"
@@ -62,8 +63,11 @@ var (
 	getFileCount    = metrics.NewRegisteredCounter("api/http/get/file/count", nil)
 	getFileNotFound = metrics.NewRegisteredCounter("api/http/get/file/notfound", nil)
 	getFileFail     = metrics.NewRegisteredCounter("api/http/get/file/fail", nil)
+	getFileRedirect = metrics.NewRegisteredCounter("api/http/get/file/redirect", nil)
 	getListCount    = metrics.NewRegisteredCounter("api/http/get/list/count", nil)
 	getListFail     = metrics.NewRegisteredCounter("api/http/get/list/fail", nil)
+	getInfoCount    = metrics.NewRegisteredCounter("api/http/get/info/count", nil)
+	getInfoFail     = metrics.NewRegisteredCounter("api/http/get/info/fail", nil)
 	getTagCount     = metrics.NewRegisteredCounter("api/http/get/tag/count", nil)
 	getTagNotFound  = metrics.NewRegisteredCounter("api/http/get/tag/notfound", nil)
 	getTagFail      = metrics.NewRegisteredCounter("api/http/get/tag/fail", nil)
@@ -76,14 +80,29 @@ var (
 )
 
 const (
-	TagHeaderName       = "x-swarm-tag"       // Presence of this in header indicates the tag
-	AnonymousHeaderName = "x-swarm-anonymous" // Presence of this in header indicates only pull sync should be used for upload
-	PinHeaderName       = "x-swarm-pin"       // Presence of this in header indicates pinning required
+	TagHeaderName           = "x-swarm-tag"              // Presence of this in header indicates the tag
+	AnonymousHeaderName     = "x-swarm-anonymous"        // Presence of this in header indicates only pull sync should be used for upload
+	PinHeaderName           = "x-swarm-pin"              // Presence of this in header indicates pinning required
+	PriorityHeaderName      = "x-swarm-priority"         // Push sync priority of the upload: background, normal or high
+	RateLimitHeaderName     = "x-swarm-rate-limit"       // Max number of bytes per second push synced for the upload
+	BackgroundHeaderName    = "x-swarm-background"       // Presence of this in header indicates a download with background priority
+	PostageHeaderName       = "x-swarm-postage"          // Id of the postage batch the uploaded chunks are stamped with
+	RecoveryHeaderName      = "x-swarm-recovery-targets" // Comma separated hex prefixes of the neighbourhoods asked to re-upload missing chunks
+	ChunkingHeaderName      = "x-swarm-chunking"         // Chunking mode of the upload: fixed (default) or content-defined
+	DedupHeaderName         = "x-swarm-dedup"            // Presence of this in header indicates chunks already stored in their neighbourhood are not sent
+	CompressionHeaderName   = "x-swarm-compression"      // Compression of the data chunks of unencrypted uploads: none (default) or snappy
+	EncryptionKeyHeaderName = "x-swarm-encryption-key"   // Hex encoded master key or mnemonic the keys of encrypted uploads are derived from per path
 
 	encryptAddr    = "encrypt"
 	tarContentType = "application/x-tar"
+
+	maxTagWait          = time.Minute            // max time a tag request waits for push sync progress
+	tagWaitPollInterval = 100 * time.Millisecond // interval at which the synced count of a waited tag is checked
 )
 
+// feedWatchInterval is the interval at which a feed watched by a request is looked up for new updates
+var feedWatchInterval = api.DefaultWatchInterval
+
 type methodHandler map[string]http.Handler
 
 func (m methodHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -107,12 +126,14 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 		AllowedHeaders: []string{"*"},
 	})
 
-	server := &Server{api: api, pinAPI: pinAPI}
+	contentTypes, _ := NewContentTypes(nil, nil)
+	server := &Server{api: api, pinAPI: pinAPI, contentTypes: contentTypes}
 
 	defaultMiddlewares := []Adapter{
 		RecoverPanic,
 		SetRequestID,
 		SetRequestHost,
+		SetRetrievalClient,
 		InitLoggingResponseWriter,
 		ParseURI,
 		InstrumentOpenTracing,
@@ -173,6 +194,18 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 			defaultMiddlewares...,
 		),
 	})
+	mux.Handle("/bzz-info:/", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetInfo),
+			defaultMiddlewares...,
+		),
+	})
+	mux.Handle("/bzz-hls:/", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetHLS),
+			defaultMiddlewares...,
+		),
+	})
 	mux.Handle("/bzz-feed:/", methodHandler{
 		"GET": Adapt(
 			http.HandlerFunc(server.HandleGetFeed),
@@ -216,11 +249,121 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 			InitLoggingResponseWriter,
 		),
 	})
-	server.Handler = c.Handler(mux)
+	mux.Handle(TopologyPath, methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetTopology),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle(QuotaPath, methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetQuota),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle(RPCPath, http.HandlerFunc(server.HandleRPC))
+	mux.Handle(BridgePath, http.HandlerFunc(server.HandleBridge))
+	server.Handler = c.Handler(server.authenticate(server.enforceGateway(server.enforceQuota(RouteDNSLink(mux, api)))))
 
 	return server
 }
 
+// SetGateway makes the server enforce the policy of the gateway on all requests
+// must be called before the server starts serving
+func (s *Server) SetGateway(g *Gateway) {
+	s.gateway = g
+}
+
+// SetContentTypes sets how the content types of served files are determined
+// must be called before the server starts serving
+func (s *Server) SetContentTypes(c *ContentTypes) {
+	s.contentTypes = c
+}
+
+// SetAuth makes the server require API tokens on all requests and serve
+// the apis on the RPC endpoint to the clients with pss or admin tokens
+// must be called before the server starts serving
+func (s *Server) SetAuth(a *Auth, apis []rpc.API) error {
+	handler, err := newRPCHandler(apis)
+	if err != nil {
+		return err
+	}
+	s.auth = a
+	s.rpc = handler
+	return nil
+}
+
+// authenticate checks the API tokens of the requests if authentication is enabled
+func (s *Server) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		Authenticate(h, s.auth).ServeHTTP(w, r)
+	})
+}
+
+// SetQuota makes the server account the uploads of the accounts of the API tokens
+// and hold them to their quota, authentication must be enabled with SetAuth
+// must be called before the server starts serving
+func (s *Server) SetQuota(q *Quota) {
+	s.quota = q
+}
+
+// enforceQuota passes the requests through the quota if one is set
+func (s *Server) enforceQuota(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.quota == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		EnforceQuota(h, s.quota).ServeHTTP(w, r)
+	})
+}
+
+// BridgePath is the path of the websocket endpoint browsers join as light peers on
+const BridgePath = "/bridge"
+
+// SetBridge makes the server serve the bridge of browser clients on BridgePath
+// must be called before the server starts serving
+func (s *Server) SetBridge(h http.Handler) {
+	s.bridge = h
+}
+
+// HandleBridge passes the request to the bridge,
+// the endpoint only exists if the bridge is enabled
+func (s *Server) HandleBridge(w http.ResponseWriter, r *http.Request) {
+	if s.bridge == nil {
+		respondError(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+	s.bridge.ServeHTTP(w, r)
+}
+
+// HandleRPC serves the RPC APIs allowed by the API token of the request,
+// the endpoint only exists if authentication is enabled
+func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
+	if s.rpc == nil {
+		respondError(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+	s.rpc.ServeHTTP(w, r)
+}
+
+// enforceGateway passes the requests through the gateway if one is set
+func (s *Server) enforceGateway(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.gateway == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		EnforceGateway(h, s.gateway).ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) ListenAndServe(addr string) error {
 	s.listenAddr = addr
 	return http.ListenAndServe(addr, s)
@@ -232,9 +375,15 @@ func (s *Server) ListenAndServe(addr string) error {
 // https://github.com/atom/electron/blob/master/docs/api/protocol.md
 type Server struct {
 	http.Handler
-	api        *api.API
-	pinAPI     *pin.API
-	listenAddr string
+	api          *api.API
+	pinAPI       *pin.API
+	gateway      *Gateway
+	contentTypes *ContentTypes
+	auth         *Auth
+	quota        *Quota
+	rpc          *rpcHandler
+	bridge       http.Handler
+	listenAddr   string
 }
 
 func (s *Server) HandleBzzGet(w http.ResponseWriter, r *http.Request) {
@@ -347,6 +496,7 @@ func (s *Server) HandlePostRaw(w http.ResponseWriter, r *http.Request) {
 			respondError(w, r, fmt.Sprintf("Error pinning file : %s", addr.Hex()), http.StatusInternalServerError)
 			return
 		}
+		s.accountPin(r, addr)
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
@@ -452,6 +602,7 @@ func (s *Server) HandlePostFiles(w http.ResponseWriter, r *http.Request) {
 			respondError(w, r, fmt.Sprintf("Error pinning file : %s", newAddr.Hex()), http.StatusInternalServerError)
 			return
 		}
+		s.accountPin(r, newAddr)
 	}
 
 	log.Debug("stored content", "ruid", ruid, "key", newAddr)
@@ -617,7 +768,12 @@ func (s *Server) HandlePostFeed(w http.ResponseWriter, r *http.Request) {
 			respondError(w, r, err.Error(), http.StatusForbidden)
 			return
 		}
-		_, err = s.api.FeedsUpdate(r.Context(), &updateRequest)
+		if query.Get("schedule") == "1" {
+			// the update is kept by the node and published at the time of its epoch
+			_, err = s.api.FeedsSchedule(r.Context(), &updateRequest)
+		} else {
+			_, err = s.api.FeedsUpdate(r.Context(), &updateRequest)
+		}
 		if err != nil {
 			respondError(w, r, err.Error(), http.StatusInternalServerError)
 			return
@@ -663,6 +819,11 @@ func (s *Server) HandlePostFeed(w http.ResponseWriter, r *http.Request) {
 // hint.level=xx - hint the lookup algorithm looking for updates at around this frequency level
 // meta=1 - get feed metadata and status information instead of performing a feed query
 // NOTE: meta=1 will be deprecated in the near future
+// watch=<path> - wait until a feed update changes the entry at the path of the manifest the feed
+// references and respond with its content. The request is answered immediately with the current
+// content if the entry exists and differs from the content hash sent in the If-None-Match header.
+// history=1 - stream the past updates of the feed as newline delimited JSON, latest first,
+// limited by the optional from=xx, to=xx (in epoch seconds) and limit=xx parameters
 func (s *Server) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
 	ruid := GetRUID(r.Context())
 	uri := GetURI(r.Context())
@@ -682,7 +843,13 @@ func (s *Server) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
 
 	// determine if the query specifies period and version or it is a metadata query
 	if r.URL.Query().Get("meta") == "1" {
-		unsignedUpdateRequest, err := s.api.FeedsNewRequest(r.Context(), fd)
+		var unsignedUpdateRequest *feed.Request
+		// a time in the query prepares an update for that time, which can be scheduled
+		if at, _ := strconv.ParseUint(r.URL.Query().Get("time"), 10, 64); at > 0 {
+			unsignedUpdateRequest, err = s.api.FeedsNewRequestAt(r.Context(), fd, at)
+		} else {
+			unsignedUpdateRequest, err = s.api.FeedsNewRequest(r.Context(), fd)
+		}
 		if err != nil {
 			getFail.Inc(1)
 			respondError(w, r, fmt.Sprintf("cannot retrieve feed metadata for feed=%s: %s", fd.Hex(), err), http.StatusNotFound)
@@ -699,6 +866,16 @@ func (s *Server) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if watchPath := r.URL.Query().Get("watch"); watchPath != "" {
+		s.handleWatchFeedPath(w, r, fd, watchPath)
+		return
+	}
+
+	if r.URL.Query().Get("history") == "1" {
+		s.handleGetFeedHistory(w, r, fd)
+		return
+	}
+
 	lookupParams := &feed.Query{Feed: *fd}
 	if err = lookupParams.FromValues(r.URL.Query()); err != nil { // parse period, version
 		respondError(w, r, fmt.Sprintf("invalid feed update request:%s", err), http.StatusBadRequest)
@@ -720,6 +897,88 @@ func (s *Server) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, "", time.Now(), bytes.NewReader(data))
 }
 
+// handleWatchFeedPath waits for a change of the entry at the path of the manifests referenced by the feed
+// and serves its content, setting the ETag header to the content hash
+func (s *Server) handleWatchFeedPath(w http.ResponseWriter, r *http.Request, fd *feed.Feed, path string) {
+	since := strings.Trim(r.Header.Get("If-None-Match"), `"`)
+	for update := range s.api.WatchPath(r.Context(), fd, path, feedWatchInterval) {
+		if update.ContentAddr.Hex() == since {
+			continue
+		}
+		if update.ContentAddr == nil {
+			respondError(w, r, fmt.Sprintf("entry %q removed from manifest %s", path, update.Manifest), http.StatusNotFound)
+			return
+		}
+		log.Debug("handle.get.feed: watched path changed", "ruid", GetRUID(r.Context()), "feed", fd.Hex(), "path", path, "manifest", update.Manifest)
+		w.Header().Set("Content-Type", update.ContentType)
+		w.Header().Set("ETag", fmt.Sprintf("%q", update.ContentAddr.Hex()))
+		w.WriteHeader(http.StatusOK)
+		w.Write(update.Content)
+		return
+	}
+}
+
+// handleGetFeedHistory streams the past updates of the feed as newline delimited JSON
+func (s *Server) handleGetFeedHistory(w http.ResponseWriter, r *http.Request, fd *feed.Feed) {
+	query := r.URL.Query()
+	var (
+		from, to uint64
+		limit    int
+		err      error
+	)
+	if v := query.Get("from"); v != "" {
+		if from, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, r, fmt.Sprintf("invalid from time: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, r, fmt.Sprintf("invalid to time: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			respondError(w, r, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	var written bool
+	err = s.api.FeedsHistory(r.Context(), fd, from, to, limit, func(entry *feed.HistoryEntry) error {
+		if !written {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			written = true
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written {
+			// the status is already sent, the client detects the error by the truncated stream
+			getFail.Inc(1)
+			log.Debug("handle.get.feed: history failed", "ruid", GetRUID(r.Context()), "feed", fd.Hex(), "err", err)
+			return
+		}
+		code, err2 := s.translateFeedError(w, r, "feed history fail", err)
+		respondError(w, r, err2.Error(), code)
+		return
+	}
+	if !written {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func (s *Server) HandleGetFeedRaw(w http.ResponseWriter, r *http.Request) {
 	ruid := GetRUID(r.Context())
 	uri := GetURI(r.Context())
@@ -767,6 +1026,8 @@ func (s *Server) translateFeedError(w http.ResponseWriter, r *http.Request, supE
 // HandleGet handles a GET request to
 // - bzz-raw://<key> and responds with the raw content stored at the
 //   given storage key
+// - bzz-raw://<key>?progressive=1 and streams the raw content as soon as
+//   its leading chunks arrive
 // - bzz-hash://<key> and responds with the hash of the content stored
 //   at the given storage key as a text/plain response
 func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
@@ -782,23 +1043,26 @@ func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
 		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
 		return
 	}
-	w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path, so we are sure it is immutable.
 
 	log.Debug("handle.get: resolved", "ruid", ruid, "key", addr)
 
 	// if path is set, interpret <key> as a manifest and return the
-	// raw entry at the given path
-	etag := common.Bytes2Hex(addr)
-	noneMatchEtag := r.Header.Get("If-None-Match")
-	w.Header().Set("ETag", fmt.Sprintf("%q", etag)) // set etag to manifest key or raw entry key.
-	if noneMatchEtag != "" {
-		if bytes.Equal(storage.Address(common.Hex2Bytes(noneMatchEtag)), addr) {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	// raw entry at the given path, the etag is the manifest key or raw entry key.
+	// the content is immutable if the url was of type bzz-raw://<hex key>/path
+	setCacheHeaders(w, addr, uri.Address() != nil, nil)
+	if notModified(r, addr) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if uri.Raw() {
+		s.recordPopularity(r, addr)
 	}
 
 	switch {
+	case uri.Raw() && r.URL.Query().Get("progressive") != "":
+		s.serveProgressive(w, r, addr)
+
 	case uri.Raw():
 		// check the root chunk exists by retrieving the file's size
 		reader, isEncrypted := s.api.Retrieve(r.Context(), addr)
@@ -810,18 +1074,13 @@ func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("X-Decrypted", fmt.Sprintf("%v", isEncrypted))
 
-		// allow the request to overwrite the content type using a query
-		// parameter
-		if typ := r.URL.Query().Get("content_type"); typ != "" {
-			w.Header().Set("Content-Type", typ)
-		}
-
 		fileName := uri.Addr
 		if found := path.Base(uri.Path); found != "" && found != "." && found != "/" {
 			fileName = found
 		}
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
-		http.ServeContent(w, r, fileName, time.Now(), langos.NewBufferedReadSeeker(reader, getFileBufferSize))
+		// allow the request to overwrite the content type using a query
+		// parameter, which takes the place of the type of a manifest entry
+		s.serveContent(w, r, fileName, r.URL.Query().Get("content_type"), time.Time{}, reader)
 
 	case uri.Hash():
 		w.Header().Set("Content-Type", "text/plain")
@@ -831,6 +1090,64 @@ func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// serveProgressive streams the content at the address, writing bytes as soon as the
+// leading chunks arrive. The optional read_timeout query parameter bounds the time
+// waited for the data at every position; the response is truncated if it is exceeded.
+func (s *Server) serveProgressive(w http.ResponseWriter, r *http.Request, addr storage.Address) {
+	params := &storage.ProgressiveReaderParams{}
+	if readTimeout := r.URL.Query().Get("read_timeout"); readTimeout != "" {
+		timeout, err := time.ParseDuration(readTimeout)
+		if err != nil || timeout < 0 {
+			respondError(w, r, fmt.Sprintf("invalid read timeout %q", readTimeout), http.StatusBadRequest)
+			return
+		}
+		params.ReadTimeout = timeout
+	}
+	reader := s.api.RetrieveProgressive(r.Context(), addr, params)
+	defer reader.Close()
+
+	size, err := reader.Size()
+	if err != nil {
+		getFail.Inc(1)
+		status := http.StatusNotFound
+		if err == storage.ErrReadTimeout {
+			status = http.StatusGatewayTimeout
+		}
+		respondError(w, r, fmt.Sprintf("root chunk not found %s: %s", addr, err), status)
+		return
+	}
+	contentType := r.URL.Query().Get("content_type")
+	if contentType == "" {
+		contentType = api.MimeOctetStream
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, chunk.DefaultSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// the status is already sent, the client detects the truncated content by the content length
+			getFail.Inc(1)
+			log.Debug("handle.get.progressive: read failed", "ruid", GetRUID(r.Context()), "addr", addr, "err", err)
+			return
+		}
+	}
+}
+
 // HandleGetList handles a GET request to bzz-list:/<manifest>/<path> and returns
 // a list of all files contained in <manifest> under <path> grouped into
 // common prefixes using "/" as a delimiter
@@ -890,6 +1207,48 @@ func (s *Server) HandleGetList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&list)
 }
 
+// HandleGetInfo handles a GET request to bzz-info:/<manifest>/<path> and responds
+// with the JSON metadata of the file at <path> without retrieving its content
+func (s *Server) HandleGetInfo(w http.ResponseWriter, r *http.Request) {
+	ruid := GetRUID(r.Context())
+	uri := GetURI(r.Context())
+	_, credentials, _ := r.BasicAuth()
+	log.Debug("handle.get.info", "ruid", ruid, "uri", uri)
+	getInfoCount.Inc(1)
+
+	manifestAddr := uri.Address()
+	if manifestAddr == nil {
+		var err error
+		manifestAddr, err = s.api.Resolve(r.Context(), uri.Addr)
+		if err != nil {
+			getInfoFail.Inc(1)
+			respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
+			return
+		}
+	}
+	log.Debug("handle.get.info: resolved", "ruid", ruid, "key", manifestAddr)
+
+	info, status, err := s.api.GetFileInfo(r.Context(), s.api.Decryptor(r.Context(), credentials), manifestAddr, uri.Path)
+	if err != nil {
+		getInfoFail.Inc(1)
+		if isDecryptError(err) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", manifestAddr))
+			respondError(w, r, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		switch status {
+		case http.StatusNotFound, http.StatusMultipleChoices:
+			respondError(w, r, err.Error(), status)
+		default:
+			respondError(w, r, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
 // HandleGetFile handles a GET request to bzz://<manifest>/<path> and responds
 // with the content of the file at <path> from the given <manifest>
 func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
@@ -906,6 +1265,9 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 	}
 	var err error
 	manifestAddr := uri.Address()
+	// the content is immutable if the url was of type bzz://<hex key>/path
+	// and it is not resolved through feed updates
+	immutable := manifestAddr != nil
 
 	if manifestAddr == nil {
 		manifestAddr, err = s.api.Resolve(r.Context(), uri.Addr)
@@ -914,22 +1276,18 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 			respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
 			return
 		}
-	} else {
-		w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path, so we are sure it is immutable.
 	}
 
 	log.Debug("handle.get.file: resolved", "ruid", ruid, "key", manifestAddr)
 
-	reader, contentType, status, contentKey, err := s.api.Get(r.Context(), s.api.Decryptor(r.Context(), credentials), manifestAddr, uri.Path)
+	ctx, feeds := api.WithResolvedFeeds(r.Context())
+	reader, contentType, status, contentKey, err := s.api.Get(ctx, s.api.Decryptor(r.Context(), credentials), manifestAddr, uri.Path)
 
-	etag := common.Bytes2Hex(contentKey)
-	noneMatchEtag := r.Header.Get("If-None-Match")
-	w.Header().Set("ETag", fmt.Sprintf("%q", etag)) // set etag to actual content key.
-	if noneMatchEtag != "" {
-		if bytes.Equal(storage.Address(common.Hex2Bytes(noneMatchEtag)), contentKey) {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	// set etag to actual content key.
+	modtime := setCacheHeaders(w, contentKey, immutable, feeds)
+	if err == nil && notModified(r, contentKey) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
 	if err != nil {
@@ -943,6 +1301,9 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 		case http.StatusNotFound:
 			getFileNotFound.Inc(1)
 			respondError(w, r, err.Error(), http.StatusNotFound)
+		case http.StatusLoopDetected:
+			getFileFail.Inc(1)
+			respondError(w, r, err.Error(), http.StatusLoopDetected)
 		default:
 			getFileFail.Inc(1)
 			respondError(w, r, err.Error(), http.StatusInternalServerError)
@@ -971,6 +1332,11 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if contentType == api.RedirectContentType {
+		s.redirect(w, r, uri, reader, status)
+		return
+	}
+
 	// check the root chunk exists by retrieving the file's size
 	if _, err := reader.Size(r.Context(), nil); err != nil {
 		getFileNotFound.Inc(1)
@@ -978,23 +1344,71 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if contentType != "" {
-		w.Header().Set("Content-Type", contentType)
-	}
-
 	fileName := uri.Addr
 	if found := path.Base(uri.Path); found != "" && found != "." && found != "/" {
 		fileName = found
 	}
+	s.recordPopularity(r, manifestAddr)
+	s.serveContent(w, r, fileName, contentType, modtime, reader)
+}
+
+// serveContent serves the file with the content type determined by the content type
+// pipeline of the server from its name, manifest content type and content. The file
+// is served as last modified at modtime unless it is zero
+func (s *Server) serveContent(w http.ResponseWriter, r *http.Request, fileName, contentType string, modtime time.Time, reader storage.LazySectionReader) {
+	rs := langos.NewBufferedReadSeeker(reader, getFileBufferSize)
+	ctype, err := s.contentTypes.Detect(fileName, contentType, rs)
+	if err != nil {
+		getFileFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("content type detection failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	http.ServeContent(w, r, fileName, modtime, rs)
+}
 
-	http.ServeContent(w, r, fileName, time.Now(), langos.NewBufferedReadSeeker(reader, getFileBufferSize))
+// redirect responds to a request for a redirect entry of a manifest
+// with the location of the target read from the entry content
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, uri *api.URI, reader storage.LazySectionReader, status int) {
+	target, err := ioutil.ReadAll(io.LimitReader(reader, api.MaxRedirectSize+1))
+	if err != nil {
+		getFileNotFound.Inc(1)
+		respondError(w, r, fmt.Sprintf("redirect target not found %s: %s", uri, err), http.StatusNotFound)
+		return
+	}
+	location, err := api.RedirectLocation(strings.TrimSpace(string(target)), uri)
+	if err != nil {
+		getFileFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code, err := api.RedirectStatus(status)
+	if err != nil {
+		getFileFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	getFileRedirect.Inc(1)
+	http.Redirect(w, r, location, code)
+}
+
+// recordPopularity counts a request for the content under the root address,
+// unless tracking is disabled or the client opted out with the DNT header
+func (s *Server) recordPopularity(r *http.Request, addr storage.Address) {
+	if s.api.Popularity == nil || r.Header.Get("DNT") == "1" {
+		return
+	}
+	s.api.Popularity.Record(addr)
 }
 
 // HandleGetTag responds to the following request
 //    - bzz-tag:/<manifest>  and
 //    - bzz-tag:/?tagId=<tagId>
 // Clients should use root hash or the tagID to get the tag counters
+// Setting the wait query parameter (e.g. wait=30s) turns the request into a long-poll for push sync
+// progress: the response is sent once the synced count differs from the synced query parameter
+// (or from the count when the request arrived), once all chunks are synced, or once the wait elapses
 func (s *Server) HandleGetTag(w http.ResponseWriter, r *http.Request) {
 	getTagCount.Inc(1)
 	uri := GetURI(r.Context())
@@ -1039,11 +1453,33 @@ func (s *Server) HandleGetTag(w http.ResponseWriter, r *http.Request) {
 		tag = tagByFile
 	}
 
+	if waitString := r.URL.Query().Get("wait"); waitString != "" {
+		wait, err := time.ParseDuration(waitString)
+		if err != nil || wait < 0 {
+			getTagFail.Inc(1)
+			respondError(w, r, "Invalid wait argument", http.StatusBadRequest)
+			return
+		}
+		if wait > maxTagWait {
+			wait = maxTagWait
+		}
+		synced := tag.Get(chunk.StateSynced)
+		if syncedString := r.URL.Query().Get("synced"); syncedString != "" {
+			synced, err = strconv.ParseInt(syncedString, 10, 64)
+			if err != nil {
+				getTagFail.Inc(1)
+				respondError(w, r, "Invalid synced argument", http.StatusBadRequest)
+				return
+			}
+		}
+		waitSyncProgress(r.Context(), tag, synced, wait)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
 	r.Header.Del("ETag")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(&tag)
+	err := json.NewEncoder(w).Encode(tag.Progress())
 	if err != nil {
 		getTagFail.Inc(1)
 		respondError(w, r, "marshalling error", http.StatusInternalServerError)
@@ -1051,6 +1487,24 @@ func (s *Server) HandleGetTag(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// waitSyncProgress blocks until the synced count of the tag differs from synced,
+// the tag is done syncing, the wait elapses or the context is done
+func waitSyncProgress(ctx context.Context, tag *chunk.Tag, synced int64, wait time.Duration) {
+	ticker := time.NewTicker(tagWaitPollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for tag.Get(chunk.StateSynced) == synced && !tag.Done(chunk.StateSynced) {
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // HandlePin takes a root hash as argument and pins a given file or collection in the local Swarm DB
 func (s *Server) HandlePin(w http.ResponseWriter, r *http.Request) {
 	postPinCount.Inc(1)
@@ -1103,6 +1557,11 @@ func (s *Server) HandleUnpin(w http.ResponseWriter, r *http.Request) {
 		respondError(w, r, fmt.Sprintf("error pinning file %s: %s", fileAddr.Hex(), err), http.StatusInternalServerError)
 		return
 	}
+	if s.quota != nil {
+		if err := s.quota.RemovePin(fileAddr); err != nil {
+			log.Error("quota release pin", "ruid", ruid, "addr", fileAddr, "err", err)
+		}
+	}
 
 	log.Debug("unpinned content", "ruid", ruid, "key", fileAddr.Hex())
 	w.Header().Set("Content-Type", "text/plain")
@@ -1169,6 +1628,13 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush implements http.Flusher if the wrapped response writer does
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func isDecryptError(err error) bool {
 	return strings.Contains(err.Error(), api.ErrDecrypt.Error())
 }
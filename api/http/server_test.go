@@ -29,6 +29,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -45,6 +46,7 @@ import (
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/chunk"
 	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
@@ -139,6 +141,126 @@ func TestGetTagUsingHash(t *testing.T) {
 
 }
 
+// TestGetTagWait tests that a tag request with the wait parameter returns
+// once the synced count of the tag changes, or once the wait elapses
+func TestGetTagWait(t *testing.T) {
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	data := testutil.RandomBytes(1, 10000)
+	resp, err := http.Post(fmt.Sprintf("%s/bzz-raw:/", srv.URL), "text/plain", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("err %s", resp.Status)
+	}
+	tidString := resp.Header.Get(TagHeaderName)
+	tid, err := strconv.ParseUint(tidString, 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := srv.Tags.Get(uint32(tid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getTag := func(query string) (*chunk.Tag, time.Duration) {
+		t.Helper()
+		start := time.Now()
+		getResp, err := http.Get(fmt.Sprintf("%s/bzz-tag:/?Id=%s&%s", srv.URL, tidString, query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer getResp.Body.Close()
+		if getResp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", getResp.Status)
+		}
+		tag := &chunk.Tag{}
+		if err := json.NewDecoder(getResp.Body).Decode(tag); err != nil {
+			t.Fatal(err)
+		}
+		return tag, time.Since(start)
+	}
+
+	// no progress, the request returns after the wait
+	_, elapsed := getTag("wait=300ms")
+	if elapsed < 300*time.Millisecond {
+		t.Fatalf("expected request to wait at least %v, returned after %v", 300*time.Millisecond, elapsed)
+	}
+
+	// progress while waiting, the request returns early with the new count
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tag.Inc(chunk.StateSynced)
+	}()
+	rcvdTag, elapsed := getTag("wait=10s&synced=0")
+	if elapsed > 5*time.Second {
+		t.Fatalf("expected request to return on progress, returned after %v", elapsed)
+	}
+	if synced := rcvdTag.Get(chunk.StateSynced); synced != 1 {
+		t.Fatalf("expected synced count %d, got %d", 1, synced)
+	}
+
+	getResp, err := http.Get(fmt.Sprintf("%s/bzz-tag:/?Id=%s&wait=never", srv.URL, tidString))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getResp.Body.Close()
+	if getResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %s", http.StatusBadRequest, getResp.Status)
+	}
+}
+
+// TestBzzRawProgressive uploads a file and retrieves it with a progressive download
+func TestBzzRawProgressive(t *testing.T) {
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	data := testutil.RandomBytes(1, 100000)
+	resp, err := http.Post(fmt.Sprintf("%s/bzz-raw:/", srv.URL), "text/plain", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("err %s", resp.Status)
+	}
+	rootHash, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getResp, err := http.Get(fmt.Sprintf("%s/bzz-raw:/%s?progressive=1&read_timeout=5s", srv.URL, rootHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode != http.StatusOK {
+		t.Fatalf("err %s", getResp.Status)
+	}
+	if getResp.ContentLength != int64(len(data)) {
+		t.Fatalf("expected content length %d, got %d", len(data), getResp.ContentLength)
+	}
+	retrievedData, err := ioutil.ReadAll(getResp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(retrievedData, data) {
+		t.Fatal("retrieved data mismatch")
+	}
+
+	getResp, err = http.Get(fmt.Sprintf("%s/bzz-raw:/%s?progressive=1&read_timeout=soon", srv.URL, rootHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %s", http.StatusBadRequest, getResp.Status)
+	}
+}
+
 // TestGetTag uploads a file, retrieves the tag using http GET and check if it matches
 func TestGetTagUsingTagId(t *testing.T) {
 	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
@@ -474,6 +596,273 @@ func TestBzzWithFeed(t *testing.T) {
 	}
 }
 
+// TestBzzFeedWatch tests waiting for changes of a path of the manifest referenced by a feed
+func TestBzzFeedWatch(t *testing.T) {
+	defer func(interval time.Duration) { feedWatchInterval = interval }(feedWatchInterval)
+	feedWatchInterval = 10 * time.Millisecond
+
+	signer, _, _ := newTestSigner()
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	// uploadConfig adds the config to the manifest, or to a new manifest if it is empty
+	uploadConfig := func(manifest string, config []byte) storage.Address {
+		t.Helper()
+		if manifest == "" {
+			resp, err := http.Post(fmt.Sprintf("%s/bzz:/", srv.URL), "text/plain", bytes.NewReader([]byte("index")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest = string(b)
+		}
+		resp, err := http.Post(fmt.Sprintf("%s/bzz:/%s/config.json", srv.URL, manifest), "application/json", bytes.NewReader(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", resp.Status)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return storage.Address(common.FromHex(string(b)))
+	}
+	// updateFeed publishes the update request with the manifest as data and returns the response body
+	updateFeed := func(updateRequest *feed.Request, manifest storage.Address) []byte {
+		t.Helper()
+		updateRequest.SetData(manifest)
+		if err := updateRequest.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		feedUpdateURL, err := url.Parse(fmt.Sprintf("%s/bzz-feed:/", srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := feedUpdateURL.Query()
+		body := updateRequest.AppendValues(query)
+		query.Set("manifest", "1")
+		feedUpdateURL.RawQuery = query.Encode()
+		resp, err := http.Post(feedUpdateURL.String(), "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", resp.Status)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	// watch waits for the config to differ from the one with the etag
+	watch := func(feedManifest *storage.Address, etag string) (config []byte, newEtag string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/bzz-feed:/%s?watch=/config.json", srv.URL, feedManifest), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", resp.Status)
+		}
+		config, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config, resp.Header.Get("ETag")
+	}
+
+	config1 := []byte(`{"version":1}`)
+	manifest1 := uploadConfig("", config1)
+
+	topic, _ := feed.NewTopic("watched config", nil)
+	b := updateFeed(feed.NewFirstRequest(topic), manifest1)
+	feedManifest := &storage.Address{}
+	if err := json.Unmarshal(b, feedManifest); err != nil {
+		t.Fatalf("data %s could not be unmarshaled: %v", b, err)
+	}
+
+	// the current config is served immediately
+	config, etag := watch(feedManifest, "")
+	if !bytes.Equal(config, config1) {
+		t.Fatalf("expected config %s, got %s", config1, config)
+	}
+
+	// a watch with the current etag waits for the next change
+	type result struct {
+		config []byte
+		etag   string
+	}
+	results := make(chan result, 1)
+	go func() {
+		config, etag := watch(feedManifest, etag)
+		results <- result{config, etag}
+	}()
+
+	// update the feed with a manifest having the same config, which does not complete the watch
+	srv.CurrentTime++
+	resp, err := http.Get(fmt.Sprintf("%s/bzz-feed:/%s/?meta=1", srv.URL, feedManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	updateRequest := &feed.Request{}
+	if err = updateRequest.UnmarshalJSON(b); err != nil {
+		t.Fatalf("Error decoding feed metadata: %s", err)
+	}
+	manifest2 := uploadConfig(manifest1.Hex(), config1)
+	updateFeed(updateRequest, manifest2)
+
+	select {
+	case r := <-results:
+		t.Fatalf("unexpected watch result %s for an unchanged config", r.config)
+	case <-time.After(20 * feedWatchInterval):
+	}
+
+	// update the feed with a manifest having a new config
+	srv.CurrentTime++
+	resp, err = http.Get(fmt.Sprintf("%s/bzz-feed:/%s/?meta=1", srv.URL, feedManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	updateRequest = &feed.Request{}
+	if err = updateRequest.UnmarshalJSON(b); err != nil {
+		t.Fatalf("Error decoding feed metadata: %s", err)
+	}
+	config2 := []byte(`{"version":2}`)
+	updateFeed(updateRequest, uploadConfig(manifest2.Hex(), config2))
+
+	select {
+	case r := <-results:
+		if !bytes.Equal(r.config, config2) {
+			t.Fatalf("expected config %s, got %s", config2, r.config)
+		}
+		if r.etag == etag {
+			t.Fatalf("expected etag to change from %s", etag)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the config change")
+	}
+}
+
+// TestBzzFeedHistory tests that the past updates of a feed are streamed as newline delimited JSON
+func TestBzzFeedHistory(t *testing.T) {
+	signer, _, _ := newTestSigner()
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	topic, _ := feed.NewTopic("history", nil)
+	fd := feed.Feed{
+		Topic: topic,
+		User:  signer.Address(),
+	}
+
+	// publish three updates a second apart
+	var data [][]byte
+	var epoch lookup.Epoch
+	for i := 0; i < 3; i++ {
+		updateRequest := feed.NewFirstRequest(topic)
+		updateRequest.Epoch = lookup.GetNextEpoch(epoch, srv.CurrentTime)
+		updateRequest.SetData([]byte(fmt.Sprintf("update %d", i)))
+		if err := updateRequest.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		feedUpdateURL, err := url.Parse(fmt.Sprintf("%s/bzz-feed:/", srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := feedUpdateURL.Query()
+		body := updateRequest.AppendValues(query)
+		feedUpdateURL.RawQuery = query.Encode()
+		resp, err := http.Post(feedUpdateURL.String(), "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", resp.Status)
+		}
+		data = append(data, []byte(fmt.Sprintf("update %d", i)))
+		epoch = updateRequest.Epoch
+		srv.CurrentTime++
+	}
+
+	history := func(params string) []feed.HistoryEntry {
+		t.Helper()
+		values := url.Values{}
+		fd.AppendValues(values)
+		resp, err := http.Get(fmt.Sprintf("%s/bzz-feed:/?%s&history=1%s", srv.URL, values.Encode(), params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("err %s", resp.Status)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Fatalf("expected content type application/x-ndjson, got %s", ct)
+		}
+		var entries []feed.HistoryEntry
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			var entry feed.HistoryEntry
+			if err := dec.Decode(&entry); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	entries := history("")
+	if len(entries) != len(data) {
+		t.Fatalf("expected %d updates, got %d", len(data), len(entries))
+	}
+	for i, entry := range entries {
+		want := data[len(data)-1-i]
+		if entry.PayloadHash != crypto.Keccak256Hash(want) {
+			t.Fatalf("update %d: expected payload hash of %q", i, want)
+		}
+	}
+
+	entries = history(fmt.Sprintf("&to=%d&limit=1", entries[1].Time))
+	if len(entries) != 1 || entries[0].PayloadHash != crypto.Keccak256Hash(data[1]) {
+		t.Fatalf("expected the second update only, got %d updates", len(entries))
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/bzz-feed:/?topic=%s&user=%s&history=1&limit=x", srv.URL, topic.Hex(), fd.User.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an invalid limit, got %s", http.StatusBadRequest, resp.Status)
+	}
+}
+
 // Test Swarm feeds using the raw update methods
 func TestBzzFeed(t *testing.T) {
 	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
@@ -1247,6 +1636,360 @@ func testBzzRootRedirect(toEncrypt bool, t *testing.T) {
 	}
 }
 
+// TestBzzDNSLink tests that the content linked to a domain with a swarmlink TXT
+// record is served under the root of the domain
+func TestBzzDNSLink(t *testing.T) {
+	var hash string
+	lookupTXT := func(ctx context.Context, name string) ([]string, error) {
+		if name != "example.com" {
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return []string{api.DNSLinkPrefix + hash}, nil
+	}
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		a.DNSLink = api.NewDNSLink(time.Minute, lookupTXT)
+		return NewServer(a, pinAPI, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	data := []byte("data")
+	headers := map[string]string{"Content-Type": "text/plain"}
+	res, hash := httpDo("POST", srv.URL+"/bzz:/", bytes.NewReader(data), headers, false, t)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code from server %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	get := func(host string) (int, []byte) {
+		req, err := http.NewRequest("GET", srv.URL+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, body
+	}
+
+	code, body := get("example.com")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code from server %d want %d", code, http.StatusOK)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatalf("expected response to equal %q, got %q", data, body)
+	}
+
+	// domains without a link are served the landing page
+	code, body = get("other.example.com")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code from server %d want %d", code, http.StatusOK)
+	}
+	if bytes.Equal(body, data) {
+		t.Fatal("expected landing page for domain without link")
+	}
+}
+
+// TestBzzRedirect tests that redirect entries of manifests are served as HTTP redirects
+func TestBzzRedirect(t *testing.T) {
+	var swarmAPI *api.API
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		swarmAPI = a
+		return NewServer(a, pinAPI, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	ctx := context.Background()
+	addr, err := swarmAPI.NewManifest(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("<h1>new</h1>")
+	addr, err = swarmAPI.UpdateManifest(ctx, addr, func(mw *api.ManifestWriter) error {
+		_, err := mw.AddEntry(ctx, bytes.NewReader(data), &api.ManifestEntry{
+			Path:        "new.html",
+			ContentType: "text/html",
+			Size:        int64(len(data)),
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := strings.Repeat("ab", 32)
+	addr, err = swarmAPI.AddRedirect(ctx, addr, "old.html", "/new.html", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err = swarmAPI.AddRedirect(ctx, addr, "/moved", "bzz:/"+other+"/index.html", http.StatusTemporaryRedirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := swarmAPI.AddRedirect(ctx, addr, "bad", "/new.html", http.StatusOK); err == nil {
+		t.Fatal("expected error for invalid redirect status")
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, tc := range []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{
+			path:     "old.html",
+			code:     http.StatusMovedPermanently,
+			location: "/bzz:/" + addr.Hex() + "/new.html",
+		},
+		{
+			path:     "moved",
+			code:     http.StatusTemporaryRedirect,
+			location: "/bzz:/" + other + "/index.html",
+		},
+		{
+			path: "new.html",
+			code: http.StatusOK,
+		},
+	} {
+		res, err := client.Get(srv.URL + "/bzz:/" + addr.Hex() + "/" + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.code {
+			t.Fatalf("%s: got status %d, want %d", tc.path, res.StatusCode, tc.code)
+		}
+		if location := res.Header.Get("Location"); location != tc.location {
+			t.Fatalf("%s: got location %q, want %q", tc.path, location, tc.location)
+		}
+	}
+}
+
+// TestBzzSymlink tests that requests under symlink entries of manifests are served
+// from the referenced manifests, and that symlink loops are detected
+func TestBzzSymlink(t *testing.T) {
+	var swarmAPI *api.API
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		swarmAPI = a
+		return NewServer(a, pinAPI, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	ctx := context.Background()
+	upload := func(files map[string]string) storage.Address {
+		addr, err := swarmAPI.NewManifest(ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err = swarmAPI.UpdateManifest(ctx, addr, func(mw *api.ManifestWriter) error {
+			for path, content := range files {
+				_, err := mw.AddEntry(ctx, strings.NewReader(content), &api.ManifestEntry{
+					Path:        path,
+					ContentType: "text/plain",
+					Size:        int64(len(content)),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	signer, _, err := newTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := func(name string, addr storage.Address) *feed.Feed {
+		topic, _ := feed.NewTopic(name, nil)
+		request := feed.NewFirstRequest(topic)
+		request.Feed.User = signer.Address()
+		request.SetData(addr)
+		if err := request.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := swarmAPI.FeedsUpdate(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+		return &request.Feed
+	}
+
+	shared := upload(map[string]string{
+		"":          "shared index",
+		"style.css": "shared style",
+	})
+	site := upload(map[string]string{
+		"index.html": "site index",
+	})
+	site, err = swarmAPI.AddSymlink(ctx, site, "/shared/", shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, err = swarmAPI.AddFeedSymlink(ctx, site, "latest/", update("latest", shared))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the default entry of the manifest is a symlink to the manifest itself
+	loop := upload(map[string]string{
+		"index.html": "loop index",
+	})
+	topic, _ := feed.NewTopic("loop", nil)
+	loop, err = swarmAPI.AddFeedSymlink(ctx, loop, "", &feed.Feed{Topic: topic, User: signer.Address()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update("loop", loop)
+
+	for _, tc := range []struct {
+		addr storage.Address
+		path string
+		code int
+		body string
+	}{
+		{addr: site, path: "index.html", code: http.StatusOK, body: "site index"},
+		{addr: site, path: "shared/style.css", code: http.StatusOK, body: "shared style"},
+		{addr: site, path: "shared/", code: http.StatusOK, body: "shared index"},
+		{addr: site, path: "latest/style.css", code: http.StatusOK, body: "shared style"},
+		{addr: site, path: "missing.html", code: http.StatusNotFound},
+		{addr: loop, path: "index.html", code: http.StatusOK, body: "loop index"},
+		{addr: loop, path: "missing.html", code: http.StatusLoopDetected},
+	} {
+		res, err := http.Get(srv.URL + "/bzz:/" + tc.addr.Hex() + "/" + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tc.code {
+			t.Fatalf("%s: got status %d, want %d", tc.path, res.StatusCode, tc.code)
+		}
+		if tc.code == http.StatusOK && string(body) != tc.body {
+			t.Fatalf("%s: got body %q, want %q", tc.path, body, tc.body)
+		}
+	}
+}
+
+func TestBzzInfo(t *testing.T) {
+	var swarmAPI *api.API
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		swarmAPI = a
+		return NewServer(a, pinAPI, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	ctx := context.Background()
+	addr, err := swarmAPI.NewManifest(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("a"), 10000)
+	addr, err = swarmAPI.UpdateManifest(ctx, addr, func(mw *api.ManifestWriter) error {
+		_, err := mw.AddEntry(ctx, bytes.NewReader(data), &api.ManifestEntry{
+			Path:        "data.bin",
+			ContentType: "application/octet-stream",
+			Mode:        0644,
+			Size:        int64(len(data)),
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(srv.URL + "/bzz-info:/" + addr.Hex() + "/data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	var info api.FileInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("got size %d, want %d", info.Size, len(data))
+	}
+	if info.ContentType != "application/octet-stream" {
+		t.Fatalf("got content type %q", info.ContentType)
+	}
+	if info.Encrypted {
+		t.Fatal("expected content not to be encrypted")
+	}
+	// three data chunks and the root chunk
+	if info.Chunks != 4 {
+		t.Fatalf("got %d chunks, want 4", info.Chunks)
+	}
+	if info.RetrievalCost != api.RetrievalCost(info.Size, info.Chunks, storage.AddressLength) {
+		t.Fatalf("got retrieval cost %d", info.RetrievalCost)
+	}
+	if info.Entry == nil || info.Entry.Path != "data.bin" || info.Entry.Mode != 0644 || info.Entry.Hash != info.Hash {
+		t.Fatalf("unexpected manifest entry %+v", info.Entry)
+	}
+	if info.Chunking != storage.ChunkingFixed || info.Entry.Chunking != "" {
+		t.Fatalf("expected fixed chunking, got %q and entry %q", info.Chunking, info.Entry.Chunking)
+	}
+
+	// content-defined chunked content is counted by its intermediate chunks
+	cdcData := testutil.RandomBytes(1, 100000)
+	addr, err = swarmAPI.UpdateManifest(ctx, addr, func(mw *api.ManifestWriter) error {
+		_, err := mw.AddEntry(sctx.SetContentDefinedChunking(ctx), bytes.NewReader(cdcData), &api.ManifestEntry{
+			Path:        "cdc.bin",
+			ContentType: "application/octet-stream",
+			Size:        int64(len(cdcData)),
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get(srv.URL + "/bzz-info:/" + addr.Hex() + "/cdc.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = api.FileInfo{}
+	err = json.NewDecoder(res.Body).Decode(&info)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Chunking != storage.ChunkingContentDefined || info.Entry == nil || info.Entry.Chunking != storage.ChunkingContentDefined {
+		t.Fatalf("expected content-defined chunking, got %q and entry %+v", info.Chunking, info.Entry)
+	}
+	if info.Encrypted {
+		t.Fatal("expected content not to be encrypted")
+	}
+	// at least the data chunks of maximum size and the root chunk
+	if min := int64(len(cdcData))/chunk.DefaultSize + 2; info.Chunks < min {
+		t.Fatalf("got %d chunks, want at least %d", info.Chunks, min)
+	}
+
+	res, err = http.Get(srv.URL + "/bzz-info:/" + addr.Hex() + "/missing.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %d for missing file, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
+
 func TestMethodsNotAllowed(t *testing.T) {
 	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
 	defer srv.Close()
@@ -1508,6 +2251,57 @@ func TestMultiPartUpload(t *testing.T) {
 	}
 }
 
+// TestBzzEncryptionKey tests that encrypted uploads with the same master key
+// store the same content to the same reference and that it is retrievable
+func TestBzzEncryptionKey(t *testing.T) {
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	upload := func(key string) (*http.Response, string) {
+		buf := new(bytes.Buffer)
+		form := multipart.NewWriter(buf)
+		file, _ := form.CreateFormFile("cv", "cv.txt")
+		file.Write([]byte("John Doe's Credentials"))
+		form.Close()
+
+		headers := map[string]string{
+			"Content-Type":   form.FormDataContentType(),
+			"Content-Length": strconv.Itoa(buf.Len()),
+		}
+		if key != "" {
+			headers[EncryptionKeyHeaderName] = key
+		}
+		return httpDo("POST", srv.URL+"/bzz:/encrypt", buf, headers, false, t)
+	}
+
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	res, ref := upload(mnemonic)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if len(ref) != 128 {
+		t.Fatalf("got reference %q, want an encrypted reference", ref)
+	}
+	if _, again := upload(mnemonic); again != ref {
+		t.Errorf("got reference %s on second upload, want %s", again, ref)
+	}
+	if _, random := upload(""); random == ref {
+		t.Error("got the same reference with random keys")
+	}
+
+	res, body := httpDo("GET", srv.URL+"/bzz:/"+ref+"/cv.txt", nil, nil, false, t)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if body != "John Doe's Credentials" {
+		t.Errorf("got body %q", body)
+	}
+
+	if res, _ := upload("0x1234"); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for invalid key, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
 // TestBzzGetFileWithResolver tests fetching a file using a mocked ENS resolver
 func TestBzzGetFileWithResolver(t *testing.T) {
 	resolver := newTestResolveValidator("")
@@ -1581,14 +2375,14 @@ func TestBzzGetFileWithResolver(t *testing.T) {
 			addr:                string(swarmHash),
 			path:                fileNames[0],
 			expectedStatusCode:  http.StatusOK,
-			expectedContentType: "text/plain",
+			expectedContentType: "text/plain; charset=utf-8",
 			expectedFileName:    path.Base(fileNames[0]),
 		},
 		{
 			addr:                "somebogusensname",
 			path:                fileNames[0],
 			expectedStatusCode:  http.StatusOK,
-			expectedContentType: "text/plain",
+			expectedContentType: "text/plain; charset=utf-8",
 			expectedFileName:    path.Base(fileNames[0]),
 		},
 	} {
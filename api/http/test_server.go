@@ -26,6 +26,7 @@ import (
 
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed"
@@ -71,6 +72,11 @@ func NewTestSwarmServer(t *testing.T, serverFunc func(*api.API, *pin.API) TestSe
 	}
 
 	swarmApi := api.NewAPI(fileStore, resolver, nil, feeds.Handler, nil, tags)
+	swarmApi.FeedScheduler, err = feed.NewScheduler(feeds.Handler, stateStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swarmApi.Kademlia = network.NewKademlia(make([]byte, 32), network.NewKadParams())
 	pinAPI := pin.NewAPI(localStore, stateStore, nil, tags, swarmApi)
 	apiServer := httptest.NewServer(serverFunc(swarmApi, pinAPI))
 
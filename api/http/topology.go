@@ -0,0 +1,96 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+)
+
+// TopologyPath is the path of the endpoint serving the graph description
+// of the view of the overlay network of the node
+const TopologyPath = "/topology"
+
+// HandleGetTopology responds with the graph description of the overlay network
+// as JSON, or in the DOT language if the format query parameter is dot.
+// If the refresh query parameter is given, the response is a stream of the graph
+// descriptions sent whenever the topology changes, checked every refresh seconds.
+func (s *Server) HandleGetTopology(w http.ResponseWriter, r *http.Request) {
+	kad := s.api.Kademlia
+	if kad == nil {
+		respondError(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var contentType string
+	var write func(*network.Topology) error
+	switch format := query.Get("format"); format {
+	case "", "json":
+		contentType = "application/json"
+		enc := json.NewEncoder(w)
+		write = func(t *network.Topology) error {
+			return enc.Encode(t)
+		}
+	case "dot":
+		contentType = "text/vnd.graphviz"
+		write = func(t *network.Topology) error {
+			_, err := w.Write([]byte(t.DOT()))
+			return err
+		}
+	default:
+		respondError(w, r, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	refresh := query.Get("refresh")
+	if refresh == "" {
+		w.Header().Set("Content-Type", contentType)
+		if err := write(kad.Topology()); err != nil {
+			log.Debug("handle.get.topology: write failed", "ruid", GetRUID(r.Context()), "err", err)
+		}
+		return
+	}
+	seconds, err := strconv.ParseUint(refresh, 10, 64)
+	if err != nil || seconds == 0 {
+		respondError(w, r, fmt.Sprintf("invalid refresh %q", refresh), http.StatusBadRequest)
+		return
+	}
+
+	if contentType == "application/json" {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	err = kad.WatchTopology(r.Context(), time.Duration(seconds)*time.Second, func(t *network.Topology) error {
+		if err := write(t); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	log.Debug("handle.get.topology: stream ended", "ruid", GetRUID(r.Context()), "err", err)
+}
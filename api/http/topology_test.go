@@ -0,0 +1,105 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/swarm/network"
+)
+
+// TestTopology tests the graph description of the overlay network in the formats
+// served by the topology endpoint
+func TestTopology(t *testing.T) {
+	srv := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srv.Close()
+
+	get := func(query string) (*http.Response, string) {
+		t.Helper()
+		res, err := http.Get(srv.URL + TopologyPath + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(body)
+	}
+
+	res, body := get("")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	var topology network.Topology
+	if err := json.Unmarshal([]byte(body), &topology); err != nil {
+		t.Fatal(err)
+	}
+	if topology.Self != strings.Repeat("00", 32) {
+		t.Fatalf("unexpected self %s", topology.Self)
+	}
+	if len(topology.Nodes) != 1 || !topology.Nodes[0].Self {
+		t.Fatalf("expected only the local node, got %+v", topology.Nodes)
+	}
+
+	res, body = get("?format=dot")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/vnd.graphviz" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	if !strings.HasPrefix(body, "graph kademlia {") {
+		t.Fatalf("expected graph, got %s", body)
+	}
+
+	for _, query := range []string{"?format=svg", "?refresh=0", "?refresh=x"} {
+		if res, _ := get(query); res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", query, http.StatusBadRequest, res.StatusCode)
+		}
+	}
+
+	// the refreshed topology is streamed until the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+TopologyPath+"?refresh=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	line, err := bufio.NewReader(res.Body).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(line, &topology); err != nil {
+		t.Fatal(err)
+	}
+}
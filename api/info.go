@@ -0,0 +1,142 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/swap"
+)
+
+// chunkSpanSize is the length of the span prefixed to the data of every chunk
+const chunkSpanSize = 8
+
+// FileInfo is the metadata of a file in a manifest, which is resolved without retrieving
+// more than the root chunk of the content, or only its intermediate chunks if it was split
+// with content-defined chunking
+type FileInfo struct {
+	Path          string         `json:"path"`
+	Hash          string         `json:"hash"`
+	ContentType   string         `json:"contentType,omitempty"`
+	Size          int64          `json:"size"`
+	Encrypted     bool           `json:"encrypted"`
+	Chunking      string         `json:"chunking"`
+	Chunks        int64          `json:"chunks"`
+	RetrievalCost uint64         `json:"retrievalCost"`
+	Entry         *ManifestEntry `json:"entry,omitempty"`
+}
+
+// GetFileInfo returns the metadata of the file at path in the manifest at manifestAddr
+// it returns the info, the status of the manifest entry and an error
+func (a *API) GetFileInfo(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string) (*FileInfo, int, error) {
+	log.Debug("api.get.info", "key", manifestAddr, "path", path)
+	reader, contentType, status, contentAddr, err := a.Get(ctx, decrypt, manifestAddr, path)
+	if err != nil {
+		return nil, status, err
+	}
+	if status == http.StatusMultipleChoices {
+		return nil, status, fmt.Errorf("ambiguous path %q", path)
+	}
+	size, err := reader.Size(ctx, nil)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("file not found %s: %s", contentAddr, err)
+	}
+
+	info := &FileInfo{
+		Path:        path,
+		Hash:        contentAddr.Hex(),
+		ContentType: contentType,
+		Size:        size,
+		Chunking:    storage.Chunking(storage.Reference(contentAddr)),
+	}
+	if info.Chunking == storage.ChunkingContentDefined {
+		// the chunk boundaries depend on the content, so the chunks are counted
+		// by walking the intermediate chunks listing the references and sizes
+		err := a.fileStore.Walk(ctx, contentAddr, func(storage.Reference) error {
+			info.Chunks++
+			return nil
+		})
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("file not found %s: %s", contentAddr, err)
+		}
+		// intermediate chunks list the subtree size after each reference
+		info.RetrievalCost = RetrievalCost(size, info.Chunks, storage.AddressLength+8)
+	} else {
+		refSize := storage.AddressLength
+		if len(contentAddr) > storage.AddressLength {
+			refSize = len(contentAddr)
+			info.Encrypted = true
+		}
+		info.Chunks = ChunkCount(size, refSize)
+		info.RetrievalCost = RetrievalCost(size, info.Chunks, refSize)
+	}
+	// the entry attributes are informational, the content is already resolved
+	entry, err := a.getManifestEntry(ctx, decrypt, manifestAddr, path)
+	if err != nil {
+		log.Debug("api.get.info: no manifest entry", "key", manifestAddr, "path", path, "err", err)
+	}
+	info.Entry = entry
+	return info, status, nil
+}
+
+// getManifestEntry returns a copy of the manifest entry matching path,
+// following nested manifests the same way as Get
+func (a *API) getManifestEntry(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string) (*ManifestEntry, error) {
+	trie, err := loadManifest(ctx, a.fileStore, manifestAddr, nil, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := trie.getEntry(path)
+	if entry == nil {
+		return nil, fmt.Errorf("manifest entry for '%s' not found", path)
+	}
+	if entry.ContentType == ManifestType {
+		return a.getManifestEntry(ctx, decrypt, common.Hex2Bytes(entry.Hash), entry.Path)
+	}
+	e := entry.ManifestEntry
+	return &e, nil
+}
+
+// ChunkCount returns the number of chunks in the swarm hash tree of content of the
+// given size, where the intermediate chunks hold references of refSize bytes
+func ChunkCount(size int64, refSize int) int64 {
+	branches := int64(chunk.DefaultSize / refSize)
+	n := (size + chunk.DefaultSize - 1) / chunk.DefaultSize
+	if n == 0 {
+		n = 1
+	}
+	count := n
+	for n > 1 {
+		n = (n + branches - 1) / branches
+		count += n
+	}
+	return count
+}
+
+// RetrievalCost estimates the swap cost of retrieving all chunks of content of the
+// given size, one retrieve request and one chunk delivery charged per byte for every chunk
+func RetrievalCost(size int64, chunks int64, refSize int) uint64 {
+	// every chunk but the root is referenced once from an intermediate chunk
+	delivered := uint64(size) + uint64(chunks-1)*uint64(refSize) + uint64(chunks)*chunkSpanSize
+	return uint64(chunks)*swap.RetrieveRequestPrice + delivered*swap.ChunkDeliveryPrice
+}
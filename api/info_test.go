@@ -0,0 +1,58 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/swap"
+)
+
+func TestChunkCount(t *testing.T) {
+	for _, tc := range []struct {
+		size    int64
+		refSize int
+		chunks  int64
+	}{
+		{size: 0, refSize: storage.AddressLength, chunks: 1},
+		{size: 1, refSize: storage.AddressLength, chunks: 1},
+		{size: chunk.DefaultSize, refSize: storage.AddressLength, chunks: 1},
+		{size: chunk.DefaultSize + 1, refSize: storage.AddressLength, chunks: 3},
+		{size: 128 * chunk.DefaultSize, refSize: storage.AddressLength, chunks: 129},
+		{size: 128*chunk.DefaultSize + 1, refSize: storage.AddressLength, chunks: 129 + 1 + 1 + 1},
+		{size: 64 * chunk.DefaultSize, refSize: 2 * storage.AddressLength, chunks: 65},
+		{size: 64*chunk.DefaultSize + 1, refSize: 2 * storage.AddressLength, chunks: 65 + 1 + 1 + 1},
+	} {
+		if chunks := ChunkCount(tc.size, tc.refSize); chunks != tc.chunks {
+			t.Errorf("size %d ref size %d: got %d chunks, want %d", tc.size, tc.refSize, chunks, tc.chunks)
+		}
+	}
+}
+
+func TestRetrievalCost(t *testing.T) {
+	single := swap.RetrieveRequestPrice + (100+chunkSpanSize)*swap.ChunkDeliveryPrice
+	if cost := RetrievalCost(100, 1, storage.AddressLength); cost != single {
+		t.Fatalf("got cost %d, want %d", cost, single)
+	}
+	// two data chunks and the root chunk referencing them
+	tree := 3*swap.RetrieveRequestPrice + (chunk.DefaultSize+1+2*storage.AddressLength+3*chunkSpanSize)*swap.ChunkDeliveryPrice
+	if cost := RetrievalCost(chunk.DefaultSize+1, 3, storage.AddressLength); cost != tree {
+		t.Fatalf("got cost %d, want %d", cost, tree)
+	}
+}
@@ -18,22 +18,39 @@ package api
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/bmt"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/network/stream"
+	"github.com/ethersphere/swarm/network/timeouts"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/ethersphere/swarm/subscription"
 )
 
 const InspectorIsPullSyncingTolerance = 15 * time.Second
 
+// probeWorkers is the number of chunks probed concurrently by Inspector.Probe
+const probeWorkers = 8
+
+var errPeerLabelsDisabled = errors.New("peer labels are disabled")
+
+var errPeerScoresDisabled = errors.New("peer scores are disabled")
+
 type Inspector struct {
 	api      *API
 	hive     *network.Hive
@@ -56,6 +73,48 @@ func (i *Inspector) KademliaInfo() network.KademliaInfo {
 	return i.hive.KademliaInfo()
 }
 
+// Topology returns the graph description of the view of the overlay network of the node
+func (i *Inspector) Topology() *network.Topology {
+	return i.hive.Topology()
+}
+
+// TopologyDOT returns the graph description of the overlay network in the DOT language
+func (i *Inspector) TopologyDOT() string {
+	return i.hive.Topology().DOT()
+}
+
+// TopologyUpdates is an RPC subscription sending the graph description of the overlay
+// network when it changes, checked every interval given in seconds. The optional opts
+// select the buffering of the notifications for slow clients.
+func (i *Inspector) TopologyUpdates(ctx context.Context, interval uint64, opts *subscription.Options) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	if interval == 0 {
+		interval = 1
+	}
+	sub := notifier.CreateSubscription()
+	n, err := subscription.New(notifier, sub, opts, subscription.DropOldest)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-n.Closed()
+		cancel()
+	}()
+	go func() {
+		err := i.hive.WatchTopology(ctx, time.Duration(interval)*time.Second, func(t *network.Topology) error {
+			return n.Notify(t)
+		})
+		if err != nil && err != context.Canceled {
+			log.Debug("topology subscription failed", "err", err)
+		}
+	}()
+	return sub, nil
+}
+
 func (i *Inspector) IsPushSynced(tagname string) bool {
 	tags := i.api.Tags.All()
 
@@ -86,9 +145,10 @@ func (i *Inspector) DeliveriesPerPeer() map[string]int64 {
 	// iterate connection in kademlia
 	i.hive.Kademlia.EachConn(nil, 255, func(p *network.Peer, po int) bool {
 		// get how many chunks we receive for retrieve requests per peer
-		peermetric := fmt.Sprintf("network.retrieve.chunk.delivery.%x", p.Over()[:16])
+		name := i.hive.PeerMetricName(p.BzzAddr)
+		peermetric := fmt.Sprintf("network/retrieve/chunk/delivery/%s", name)
 
-		res[fmt.Sprintf("%x", p.Over()[:16])] = metrics.GetOrRegisterCounter(peermetric, nil).Count()
+		res[name] = metrics.GetOrRegisterCounter(peermetric, nil).Count()
 
 		return true
 	})
@@ -96,6 +156,45 @@ func (i *Inspector) DeliveriesPerPeer() map[string]int64 {
 	return res
 }
 
+// SetPeerLabel labels the overlay address or enode ID of a node,
+// an empty label removes the label
+func (i *Inspector) SetPeerLabel(addr hexutil.Bytes, label string) error {
+	labels := i.hive.PeerLabels()
+	if labels == nil {
+		return errPeerLabelsDisabled
+	}
+	return labels.Set(addr, label)
+}
+
+// PeerLabels returns the labels of the nodes by hex address
+func (i *Inspector) PeerLabels() (map[string]string, error) {
+	labels := i.hive.PeerLabels()
+	if labels == nil {
+		return nil, errPeerLabelsDisabled
+	}
+	return labels.All(), nil
+}
+
+// PeerScores returns the reputation of the peers by hex overlay address
+func (i *Inspector) PeerScores() (map[string]network.PeerScore, error) {
+	scores := i.hive.PeerScores()
+	if scores == nil {
+		return nil, errPeerScoresDisabled
+	}
+	return scores.All(), nil
+}
+
+// UnderlayStats returns the outcomes of the dials of the underlay addresses of peers,
+// the hive dials the peers advertising several addresses on the ones reached
+func (i *Inspector) UnderlayStats() map[string]network.UnderlayStats {
+	return i.hive.UnderlayStats()
+}
+
+// Bootnodes returns the health of the bootnodes the hive dials while the node has few peers
+func (i *Inspector) Bootnodes() []network.BootnodeStats {
+	return i.hive.BootnodeStats()
+}
+
 // Has checks whether each chunk address is present in the underlying datastore,
 // the bool in the returned structs indicates if the underlying datastore has
 // the chunk stored with the given address (true), or not (false)
@@ -131,3 +230,205 @@ func (i *Inspector) PeerStreams() (string, error) {
 func (i *Inspector) StorageIndices() (map[string]int, error) {
 	return i.ls.DebugIndices()
 }
+
+// CacheStats returns the statistics of the in-memory chunk cache of the local store
+func (i *Inspector) CacheStats() localstore.CacheStats {
+	return i.ls.CacheStats()
+}
+
+// ResizeCache changes the number of chunks kept in the in-memory chunk cache, 0 disables it
+func (i *Inspector) ResizeCache(capacity int) error {
+	return i.ls.ResizeCache(capacity)
+}
+
+// FlushCache evicts all chunks from the in-memory chunk cache
+func (i *Inspector) FlushCache() {
+	i.ls.FlushCache()
+}
+
+// StorageTiers returns the statistics of the hot and cold tiers of the local store
+func (i *Inspector) StorageTiers() (localstore.TierStats, error) {
+	return i.ls.TierStats()
+}
+
+// VerifyStorage checks the integrity of the local store at the rate of chunks per second,
+// 0 for unlimited, and with repair fixes the issues found and quarantines corrupted chunks
+func (i *Inspector) VerifyStorage(ctx context.Context, repair bool, rate int) (*localstore.VerifyReport, error) {
+	o := &localstore.VerifyOptions{
+		Repair: repair,
+		Rate:   rate,
+	}
+	if vs, ok := i.netStore.Store.(*chunk.ValidatorStore); ok {
+		o.Validators = vs.Validators()
+	}
+	return i.ls.Verify(ctx, o)
+}
+
+// ProbeResult is the outcome of probing the availability of the chunks of a reference
+type ProbeResult struct {
+	Total        int      `json:"total"`        // number of chunks the reference consists of
+	Sampled      int      `json:"sampled"`      // number of chunks probed
+	Retrieved    int      `json:"retrieved"`    // number of probed chunks retrieved from the network
+	Routes       int      `json:"routes"`       // number of distinct peers the probed chunks were retrieved through
+	Failed       []string `json:"failed"`       // addresses of the probed chunks that could not be retrieved
+	Availability float64  `json:"availability"` // ratio of retrieved to probed chunks
+}
+
+// Probe estimates the availability of the content with the given reference in the network.
+// It collects the addresses of all the chunks of the reference, manifests included, and
+// retrieves a random sample of them from the network, bypassing the local store. Every chunk
+// is requested through a different first hop peer as long as there are peers left, so that
+// the estimate is not biased by the routes of a single peer.
+func (i *Inspector) Probe(ctx context.Context, addr storage.Address, samples int) (*ProbeResult, error) {
+	if samples <= 0 {
+		return nil, fmt.Errorf("invalid number of samples %d", samples)
+	}
+	addrs, err := i.references(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if samples > len(addrs) {
+		samples = len(addrs)
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	sample := addrs[:samples]
+
+	var (
+		mu     sync.Mutex
+		routes = make(map[enode.ID]struct{})
+		failed []string
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, probeWorkers)
+	)
+	for _, a := range sample {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a storage.Address) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			peer, err := i.probe(ctx, a, &mu, routes)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Debug("probe chunk failed", "ref", a, "err", err)
+				failed = append(failed, a.Hex())
+				return
+			}
+			routes[*peer] = struct{}{}
+		}(a)
+	}
+	wg.Wait()
+
+	res := &ProbeResult{
+		Total:     len(addrs),
+		Sampled:   len(sample),
+		Retrieved: len(sample) - len(failed),
+		Routes:    len(routes),
+		Failed:    failed,
+	}
+	if res.Sampled > 0 {
+		res.Availability = float64(res.Retrieved) / float64(res.Sampled)
+	}
+	return res, nil
+}
+
+// BMTProof returns the BMT inclusion proof of the segment with the given index
+// of the content addressed chunk with the given address
+func (i *Inspector) BMTProof(ctx context.Context, addr storage.Address, index int) (*bmt.InclusionProof, error) {
+	return i.api.BMTProof(ctx, addr, index)
+}
+
+// VerifyBMTProof reports whether the BMT inclusion proof is valid for the content
+// addressed chunk with the given address
+func (i *Inspector) VerifyBMTProof(addr storage.Address, proof *bmt.InclusionProof) bool {
+	return VerifyBMTProof(addr, proof)
+}
+
+// EstimateRetrieval returns the estimated number of chunks and accounting cost of
+// retrieving the content with the given address, see API.EstimateRetrieval
+func (i *Inspector) EstimateRetrieval(ctx context.Context, addr storage.Address) (*RetrievalEstimate, error) {
+	return i.api.EstimateRetrieval(ctx, addr)
+}
+
+// TopContent returns at most n of the most requested content served by the node
+// over the last complete window, all reported content if n is 0
+func (i *Inspector) TopContent(n int) ([]*ContentPopularity, error) {
+	if i.api.Popularity == nil {
+		return nil, errors.New("content popularity tracking is disabled")
+	}
+	return i.api.Popularity.Top(n), nil
+}
+
+// DiffManifests returns the paths which were added, removed or changed in the
+// manifest at to with respect to the manifest at from
+func (i *Inspector) DiffManifests(ctx context.Context, from, to storage.Address) (*ManifestDiff, error) {
+	return i.api.DiffManifests(ctx, from, to)
+}
+
+// MergeManifests merges the changes made in the manifest at theirs into the manifest
+// at ours since their common base, see API.MergeManifests
+func (i *Inspector) MergeManifests(ctx context.Context, base, ours, theirs storage.Address) (*ManifestMerge, error) {
+	return i.api.MergeManifests(ctx, base, ours, theirs)
+}
+
+// probe retrieves a single chunk from the network through a peer that has not been
+// used as a route by the other chunks of the probe, falling back to any peer once
+// all of them have been used
+func (i *Inspector) probe(ctx context.Context, addr storage.Address, mu *sync.Mutex, routes map[enode.ID]struct{}) (*enode.ID, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.FetcherGlobalTimeout)
+	defer cancel()
+
+	req := storage.NewRequestWithContext(ctx, addr)
+	mu.Lock()
+	used := len(routes)
+	for id := range routes {
+		req.PeersToSkip.Store(id.String(), time.Now())
+	}
+	mu.Unlock()
+
+	peer, err := i.netStore.Probe(ctx, req)
+	if err == storage.ErrNoSuitablePeer && used > 0 {
+		peer, err = i.netStore.Probe(ctx, storage.NewRequestWithContext(ctx, addr))
+	}
+	return peer, err
+}
+
+// references returns the addresses of all the chunks of the content with the given
+// reference. If the reference is a manifest, the chunks of the manifests and of all
+// the entries are included.
+func (i *Inspector) references(ctx context.Context, addr storage.Address) ([]storage.Address, error) {
+	var addrs []storage.Address
+	seen := make(map[string]bool)
+	collect := func(ref storage.Reference) error {
+		if !seen[string(ref)] {
+			seen[string(ref)] = true
+			addrs = append(addrs, storage.Address(ref))
+		}
+		return nil
+	}
+
+	if err := i.api.fileStore.Walk(ctx, addr, collect); err != nil {
+		return nil, err
+	}
+	walker, err := i.api.NewManifestWalker(ctx, addr, NOOPDecrypt, nil)
+	if err != nil {
+		// not a manifest, the content is a single file
+		return addrs, nil
+	}
+	err = walker.Walk(func(entry *ManifestEntry) error {
+		ref, err := hex.DecodeString(entry.Hash)
+		if err != nil {
+			return err
+		}
+		return i.api.fileStore.Walk(ctx, ref, collect)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
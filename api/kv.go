@@ -0,0 +1,322 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// KVContentType is the content type of the entries holding the values of a KVStore
+const KVContentType = "application/octet-stream"
+
+// ErrKeyNotFound is returned when the key is not in the KVStore
+var ErrKeyNotFound = errors.New("key not found")
+
+// KVStore is a mutable key-value store over a manifest. Every key is the path of
+// an entry of the manifest, which content is the value of the key, so the store can
+// also be browsed with the bzz scheme.
+//
+// Updates are written in batches, every batch producing a new root manifest at once.
+// If a feed is set with SetFeed, the root of every batch is published to it, and
+// the store can be opened from the feed with OpenKVStore.
+type KVStore struct {
+	api *API
+
+	mu     sync.Mutex // serializes batches and protects the root
+	root   storage.Address
+	feed   *feed.Feed
+	signer feed.Signer
+}
+
+// KVBatch is a set of updates written to a KVStore at once
+type KVBatch struct {
+	ops []kvOp
+}
+
+type kvOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// Put sets the value of the key in the batch
+func (b *KVBatch) Put(key string, value []byte) {
+	b.ops = append(b.ops, kvOp{key: key, value: value})
+}
+
+// Delete removes the key in the batch
+func (b *KVBatch) Delete(key string) {
+	b.ops = append(b.ops, kvOp{key: key, delete: true})
+}
+
+// Len returns the number of updates in the batch
+func (b *KVBatch) Len() int {
+	return len(b.ops)
+}
+
+// NewKVStore creates a key-value store over the manifest with the root address,
+// or over a new empty manifest if root is nil
+func (a *API) NewKVStore(ctx context.Context, root storage.Address) (*KVStore, error) {
+	if root == nil {
+		var err error
+		if root, err = a.NewManifest(ctx, false); err != nil {
+			return nil, err
+		}
+	}
+	return &KVStore{
+		api:  a,
+		root: root,
+	}, nil
+}
+
+// OpenKVStore opens the key-value store with the root published to the feed, and keeps
+// publishing the roots of the batches written to it if signer is not nil.
+// The store is empty if nothing is published to the feed yet.
+func (a *API) OpenKVStore(ctx context.Context, fd *feed.Feed, signer feed.Signer) (*KVStore, error) {
+	var root storage.Address
+	if _, err := a.feed.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		if ferr, ok := err.(*feed.Error); !ok || ferr.Code() != feed.ErrNotFound {
+			return nil, err
+		}
+	} else {
+		_, data, err := a.feed.GetContent(fd)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != storage.AddressLength {
+			return nil, fmt.Errorf("invalid swarm hash in feed update. Expected %d bytes. Got %d", storage.AddressLength, len(data))
+		}
+		root = storage.Address(data)
+	}
+	s, err := a.NewKVStore(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		s.SetFeed(fd, signer)
+	}
+	return s, nil
+}
+
+// SetFeed sets the feed the roots of the batches are published to with the signer
+func (s *KVStore) SetFeed(fd *feed.Feed, signer feed.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feed = fd
+	s.signer = signer
+}
+
+// Root returns the address of the manifest of the store
+func (s *KVStore) Root() storage.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.root
+}
+
+// Get returns the value of the key, or ErrKeyNotFound
+func (s *KVStore) Get(ctx context.Context, key string) ([]byte, error) {
+	trie, err := loadManifest(ctx, s.api.fileStore, s.Root(), nil, NOOPDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := trie.lookupEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, ErrKeyNotFound
+	}
+	return s.value(ctx, entry)
+}
+
+// Put sets the value of the key
+func (s *KVStore) Put(ctx context.Context, key string, value []byte) error {
+	b := &KVBatch{}
+	b.Put(key, value)
+	_, err := s.Write(ctx, b)
+	return err
+}
+
+// Delete removes the key
+func (s *KVStore) Delete(ctx context.Context, key string) error {
+	b := &KVBatch{}
+	b.Delete(key)
+	_, err := s.Write(ctx, b)
+	return err
+}
+
+// Write applies the updates of the batch in order and returns the new root of the
+// store. Either all the updates are written or, on error, none of them.
+func (s *KVStore) Write(ctx context.Context, b *KVBatch) (storage.Address, error) {
+	for _, op := range b.ops {
+		if err := validateKVKey(op.key); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mw, err := s.api.NewManifestWriter(ctx, s.root, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range b.ops {
+		if op.delete {
+			if err := mw.RemoveEntry(op.key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry := &ManifestEntry{
+			Path:        op.key,
+			ContentType: KVContentType,
+			Size:        int64(len(op.value)),
+		}
+		if _, err := mw.AddEntry(ctx, bytes.NewReader(op.value), entry); err != nil {
+			return nil, fmt.Errorf("put key %q: %w", op.key, err)
+		}
+	}
+	root, err := mw.Store()
+	if err != nil {
+		return nil, err
+	}
+	if s.feed != nil {
+		if err := s.publish(ctx, root); err != nil {
+			return nil, fmt.Errorf("publish root: %w", err)
+		}
+	}
+	s.root = root
+	return root, nil
+}
+
+// Iterate calls fn for every key with the prefix and its value, in the order of keys.
+// Iteration stops when fn returns true or an error.
+func (s *KVStore) Iterate(ctx context.Context, prefix string, fn func(key string, value []byte) (stop bool, err error)) error {
+	trie, err := loadManifest(ctx, s.api.fileStore, s.Root(), nil, NOOPDecrypt)
+	if err != nil {
+		return err
+	}
+	_, err = trie.walkPrefix("", prefix, func(path string, entry *manifestTrieEntry) (bool, error) {
+		value, err := s.value(ctx, entry)
+		if err != nil {
+			return false, fmt.Errorf("get key %q: %w", path, err)
+		}
+		return fn(path, value)
+	})
+	return err
+}
+
+// value returns the content of the entry
+func (s *KVStore) value(ctx context.Context, entry *manifestTrieEntry) ([]byte, error) {
+	reader, _ := s.api.Retrieve(ctx, common.Hex2Bytes(entry.Hash))
+	return ioutil.ReadAll(reader)
+}
+
+// publish updates the feed with the root
+// it must be called with the mutex held
+func (s *KVStore) publish(ctx context.Context, root storage.Address) error {
+	request, err := s.api.feed.NewRequest(ctx, s.feed)
+	if err != nil {
+		return err
+	}
+	request.SetData(root)
+	if err := request.Sign(s.signer); err != nil {
+		return err
+	}
+	_, err = s.api.feed.Update(ctx, request)
+	return err
+}
+
+// validateKVKey checks that the key is a regular manifest path
+func validateKVKey(key string) error {
+	if key == "" || !utf8.ValidString(key) || RegularSlashes(key) != key {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	return nil
+}
+
+// lookupEntry returns the entry with exactly the path, or nil
+func (mt *manifestTrie) lookupEntry(path string) (*manifestTrieEntry, error) {
+	i := 256
+	if path != "" {
+		i = int(path[0])
+	}
+	entry := mt.entries[i]
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.ContentType != ManifestType {
+		if entry.Path != path {
+			return nil, nil
+		}
+		return entry, nil
+	}
+	if !strings.HasPrefix(path, entry.Path) {
+		return nil, nil
+	}
+	if err := mt.loadSubTrie(entry, nil); err != nil {
+		return nil, err
+	}
+	return entry.subtrie.lookupEntry(path[len(entry.Path):])
+}
+
+// walkPrefix calls fn for the full path of every entry with the prefix below the base path,
+// in the order of paths, and returns true if fn stopped the walk
+func (mt *manifestTrie) walkPrefix(base, prefix string, fn func(path string, entry *manifestTrieEntry) (bool, error)) (bool, error) {
+	// the entry of the empty path precedes all the others
+	entries := append([]*manifestTrieEntry{mt.entries[256]}, mt.entries[:256]...)
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		path := base + entry.Path
+		if entry.ContentType == ManifestType {
+			if !strings.HasPrefix(path, prefix) && !strings.HasPrefix(prefix, path) {
+				continue
+			}
+			if err := mt.loadSubTrie(entry, nil); err != nil {
+				return false, err
+			}
+			stop, err := entry.subtrie.walkPrefix(path, prefix, fn)
+			if stop || err != nil {
+				return stop, err
+			}
+			continue
+		}
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		stop, err := fn(path, entry)
+		if stop || err != nil {
+			return stop, err
+		}
+	}
+	return false, nil
+}
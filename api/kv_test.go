@@ -0,0 +1,148 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+)
+
+// collectKV returns the keys and values of the store with the prefix
+func collectKV(t *testing.T, s *KVStore, prefix string) string {
+	t.Helper()
+
+	var kvs []string
+	err := s.Iterate(context.Background(), prefix, func(key string, value []byte) (bool, error) {
+		kvs = append(kvs, key+"="+string(value))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(kvs)
+}
+
+// TestKVStore validates that batches of updates of a key-value store produce new roots,
+// and that keys can be retrieved and iterated over by prefix
+func TestKVStore(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "kv-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+	fileStore, cleanup, err := storage.NewLocalFileStore(datadir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	handler, err := feed.NewTestHandler(datadir, &feed.HandlerParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	a := NewAPI(fileStore, nil, nil, handler.Handler, nil, chunk.NewTags())
+	ctx := context.Background()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := feed.NewGenericSigner(key)
+	topic, err := feed.NewTopic("kv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &feed.Feed{Topic: topic, User: signer.Address()}
+
+	s, err := a.OpenKVStore(ctx, fd, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := s.Root()
+	if _, err := s.Get(ctx, "a"); err != ErrKeyNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrKeyNotFound)
+	}
+
+	b := &KVBatch{}
+	for _, k := range []string{"user/1", "user/10", "user/2", "user", "group/1"} {
+		b.Put(k, []byte("v"+k))
+	}
+	root, err := s.Write(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Hex() == empty.Hex() || s.Root().Hex() != root.Hex() {
+		t.Fatalf("got root %s after batch, from %s", root, empty)
+	}
+
+	if got := collectKV(t, s, ""); got != "[group/1=vgroup/1 user=vuser user/1=vuser/1 user/10=vuser/10 user/2=vuser/2]" {
+		t.Fatalf("got %s", got)
+	}
+	if got := collectKV(t, s, "user/1"); got != "[user/1=vuser/1 user/10=vuser/10]" {
+		t.Fatalf("got %s", got)
+	}
+	if got := collectKV(t, s, "x"); got != "[]" {
+		t.Fatalf("got %s", got)
+	}
+	for _, k := range []string{"use", "user/", "user/3", "group"} {
+		if _, err := s.Get(ctx, k); err != ErrKeyNotFound {
+			t.Fatalf("key %q: got error %v, want %v", k, err, ErrKeyNotFound)
+		}
+	}
+
+	if err := s.Put(ctx, "user/1", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(ctx, "user/1"); err != nil || string(v) != "updated" {
+		t.Fatalf("got value %q and error %v", v, err)
+	}
+
+	// a batch with an invalid key is not written
+	b = &KVBatch{}
+	b.Delete("user/2")
+	b.Put("/invalid", nil)
+	before := s.Root()
+	if _, err := s.Write(ctx, b); err == nil {
+		t.Fatal("expected error writing invalid key")
+	}
+	if s.Root().Hex() != before.Hex() {
+		t.Fatal("root changed by a failed batch")
+	}
+
+	// the store opened from the feed has the latest root
+	r, err := a.OpenKVStore(ctx, fd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Root().Hex() != s.Root().Hex() {
+		t.Fatalf("got root %s from feed, want %s", r.Root(), s.Root())
+	}
+	if got := collectKV(t, r, ""); got != "[group/1=vgroup/1 user/1=updated user/10=vuser/10 user/2=vuser/2]" {
+		t.Fatalf("got %s", got)
+	}
+}
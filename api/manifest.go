@@ -30,13 +30,16 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed"
 )
 
 const (
-	ManifestType    = "application/bzz-manifest+json"
-	FeedContentType = "application/bzz-feed"
+	ManifestType        = "application/bzz-manifest+json"
+	FeedContentType     = "application/bzz-feed"
+	RedirectContentType = "application/bzz-redirect" // content of the entry is the redirect target, see redirect.go
+	SymlinkContentType  = "application/bzz-symlink"  // entry references another manifest, see symlink.go
 
 	manifestSizeLimit = 5 * 1024 * 1024
 )
@@ -57,6 +60,8 @@ type ManifestEntry struct {
 	Status      int          `json:"status,omitempty"`
 	Access      *AccessEntry `json:"access,omitempty"`
 	Feed        *feed.Feed   `json:"feed,omitempty"`
+	Chunking    string       `json:"chunking,omitempty"`    // chunking scheme of the content, omitted if fixed
+	Compression string       `json:"compression,omitempty"` // compression of the data chunks of the content, omitted if none
 }
 
 // ManifestList represents the result of listing files in a manifest
@@ -115,6 +120,7 @@ func (a *API) NewManifestWriter(ctx context.Context, addr storage.Address, quitC
 	if err != nil {
 		return nil, fmt.Errorf("error loading manifest %s: %s", addr, err)
 	}
+	trie.encryptionKey = sctx.GetEncryptionKey(pathEncryptionContext(ctx, ""))
 	return &ManifestWriter{a, trie, quitC}, nil
 }
 
@@ -123,7 +129,7 @@ func (m *ManifestWriter) AddEntry(ctx context.Context, data io.Reader, e *Manife
 	entry := newManifestTrieEntry(e, nil)
 	if data != nil {
 		var wait func(context.Context) error
-		addr, wait, err = m.api.Store(ctx, data, e.Size, m.trie.encrypted)
+		addr, wait, err = m.api.Store(pathEncryptionContext(ctx, e.Path), data, e.Size, m.trie.encrypted)
 		if err != nil {
 			return nil, err
 		}
@@ -132,10 +138,16 @@ func (m *ManifestWriter) AddEntry(ctx context.Context, data io.Reader, e *Manife
 			return nil, err
 		}
 		entry.Hash = addr.Hex()
+		if compression := sctx.GetCompression(ctx); compression == storage.CompressionSnappy && !m.trie.encrypted {
+			entry.Compression = compression
+		}
 	}
 	if entry.Hash == "" {
 		return addr, errors.New("missing entry hash")
 	}
+	if storage.IsContentDefined(common.Hex2Bytes(entry.Hash)) {
+		entry.Chunking = storage.ChunkingContentDefined
+	}
 	m.trie.addEntry(entry, m.quitC)
 	return addr, nil
 }
@@ -213,6 +225,8 @@ type manifestTrie struct {
 	ref       storage.Address         // if ref != nil, it is stored
 	encrypted bool
 	decrypt   DecryptFunc
+	// the keys of the encrypted manifest chunks are derived from it if set, otherwise random
+	encryptionKey []byte
 }
 
 func newManifestTrieEntry(entry *ManifestEntry, subtrie *manifestTrie) *manifestTrieEntry {
@@ -231,7 +245,8 @@ type manifestTrieEntry struct {
 func loadManifest(ctx context.Context, fileStore *storage.FileStore, addr storage.Address, quitC chan bool, decrypt DecryptFunc) (trie *manifestTrie, err error) { // non-recursive, subtrees are downloaded on-demand
 	log.Trace("manifest lookup", "addr", addr)
 	// retrieve manifest via FileStore
-	manifestReader, isEncrypted := fileStore.Retrieve(ctx, addr)
+	// manifests are needed to resolve any path, so they are retrieved with metadata priority
+	manifestReader, isEncrypted := fileStore.Retrieve(sctx.SetMetadata(ctx, true), addr)
 	log.Trace("reader retrieved", "addr", addr)
 	return readManifest(manifestReader, addr, fileStore, isEncrypted, quitC, decrypt)
 }
@@ -369,7 +384,8 @@ func (mt *manifestTrie) deleteEntry(path string, quitC chan bool) {
 	if entry == nil {
 		return
 	}
-	if entry.Path == path {
+	// a manifest entry with the path holds the entry of the path and the longer ones
+	if entry.Path == path && entry.ContentType != ManifestType {
 		mt.entries[b] = nil
 		return
 	}
@@ -403,7 +419,8 @@ func (mt *manifestTrie) recalcAndStore() error {
 	list := &Manifest{}
 	for _, entry := range &mt.entries {
 		if entry != nil {
-			if entry.Hash == "" { // TODO: paralellize
+			if entry.Hash == "" && entry.ContentType == ManifestType { // TODO: paralellize
+				entry.subtrie.encryptionKey = mt.encryptionKey
 				err := entry.subtrie.recalcAndStore()
 				if err != nil {
 					return err
@@ -422,6 +439,9 @@ func (mt *manifestTrie) recalcAndStore() error {
 
 	sr := bytes.NewReader(manifest)
 	ctx := context.TODO()
+	if mt.encryptionKey != nil {
+		ctx = sctx.SetEncryptionKey(ctx, mt.encryptionKey)
+	}
 	addr, wait, err2 := mt.fileStore.Store(ctx, sr, int64(len(manifest)), mt.encrypted)
 	if err2 != nil {
 		return err2
@@ -553,6 +573,9 @@ func (mt *manifestTrie) findPrefixOf(path string, quitC chan bool) (entry *manif
 				entry.Status = http.StatusMultipleChoices
 			}
 
+		} else if entry.ContentType == SymlinkContentType {
+			//the paths under a symlink are resolved in the manifest it references
+			return entry, epl
 		} else {
 			//entry is not a manifest, return it
 			if path != entry.Path {
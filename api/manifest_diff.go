@@ -0,0 +1,199 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ethersphere/swarm/storage"
+)
+
+// ManifestDiff lists the paths of a manifest which differ from another manifest
+type ManifestDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// ManifestConflict is a path changed differently by both descendants of a common
+// base manifest, the entries are nil where the path is absent
+type ManifestConflict struct {
+	Path   string         `json:"path"`
+	Base   *ManifestEntry `json:"base,omitempty"`
+	Ours   *ManifestEntry `json:"ours,omitempty"`
+	Theirs *ManifestEntry `json:"theirs,omitempty"`
+}
+
+// ManifestMerge is the result of a three-way merge of manifests, the root is only
+// set if the merge has no conflicts
+type ManifestMerge struct {
+	Root      storage.Address     `json:"root,omitempty"`
+	Conflicts []*ManifestConflict `json:"conflicts,omitempty"`
+}
+
+// DiffManifests returns the paths which were added, removed or changed in the
+// manifest at to with respect to the manifest at from
+func (a *API) DiffManifests(ctx context.Context, from, to storage.Address) (*ManifestDiff, error) {
+	fromEntries, err := a.manifestEntries(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toEntries, err := a.manifestEntries(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ManifestDiff{}
+	for path, entry := range toEntries {
+		prev, ok := fromEntries[path]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, path)
+		case !sameManifestEntry(prev, entry):
+			diff.Changed = append(diff.Changed, path)
+		}
+	}
+	for path := range fromEntries {
+		if _, ok := toEntries[path]; !ok {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff, nil
+}
+
+// MergeManifests applies the changes made in the manifest at theirs to the manifest
+// at ours, both being descendants of the manifest at base. A path changed in only
+// one of them takes that change, a path changed in both to different entries is a
+// conflict. The merged manifest is only stored if there are no conflicts
+func (a *API) MergeManifests(ctx context.Context, base, ours, theirs storage.Address) (*ManifestMerge, error) {
+	baseEntries, err := a.manifestEntries(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	ourEntries, err := a.manifestEntries(ctx, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirEntries, err := a.manifestEntries(ctx, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]struct{})
+	for _, entries := range []map[string]*ManifestEntry{baseEntries, ourEntries, theirEntries} {
+		for path := range entries {
+			paths[path] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	merge := &ManifestMerge{}
+	// the entries of theirs to be applied to ours, nil for removals
+	changes := make(map[string]*ManifestEntry)
+	for _, path := range sorted {
+		b, o, t := baseEntries[path], ourEntries[path], theirEntries[path]
+		switch {
+		case sameManifestEntry(o, t), sameManifestEntry(b, t):
+		case sameManifestEntry(b, o):
+			changes[path] = t
+		default:
+			merge.Conflicts = append(merge.Conflicts, &ManifestConflict{
+				Path:   path,
+				Base:   b,
+				Ours:   o,
+				Theirs: t,
+			})
+		}
+	}
+	if len(merge.Conflicts) > 0 {
+		return merge, nil
+	}
+	if len(changes) == 0 {
+		merge.Root = ours
+		return merge, nil
+	}
+
+	mw, err := a.NewManifestWriter(ctx, ours, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range sorted {
+		entry, ok := changes[path]
+		if !ok {
+			continue
+		}
+		if entry == nil {
+			if err := mw.RemoveEntry(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the entry refers to existing content, so it is added as is
+		if err := mw.trie.addEntry(newManifestTrieEntry(entry, nil), nil); err != nil {
+			return nil, err
+		}
+	}
+	merge.Root, err = mw.Store()
+	if err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// manifestEntries returns the entries of the manifest at addr by their full paths
+func (a *API) manifestEntries(ctx context.Context, addr storage.Address) (map[string]*ManifestEntry, error) {
+	trie, err := loadManifest(ctx, a.fileStore, addr, nil, NOOPDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*ManifestEntry)
+	_, err = trie.walkPrefix("", "", func(path string, entry *manifestTrieEntry) (bool, error) {
+		e := entry.ManifestEntry
+		e.Path = path
+		entries[path] = &e
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// sameManifestEntry reports whether two entries, either of which may be nil, refer
+// to the same content served the same way
+func sameManifestEntry(a, b *ManifestEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if (a.Feed == nil) != (b.Feed == nil) || a.Feed != nil && *a.Feed != *b.Feed {
+		return false
+	}
+	return a.Hash == b.Hash &&
+		a.ContentType == b.ContentType &&
+		a.Mode == b.Mode &&
+		a.Status == b.Status &&
+		a.Chunking == b.Chunking &&
+		a.Compression == b.Compression
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// updateManifest adds the files to and removes the paths from the manifest at addr
+func updateManifest(t *testing.T, a *API, addr storage.Address, files map[string]string, remove ...string) storage.Address {
+	t.Helper()
+
+	ctx := context.Background()
+	mw, err := a.NewManifestWriter(ctx, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		if _, err := mw.AddEntry(ctx, strings.NewReader(content), &ManifestEntry{Path: path, ContentType: "text/plain", Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range remove {
+		if err := mw.RemoveEntry(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := mw.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// TestManifestDiffMerge validates the diff of manifests and their three-way merge,
+// with and without conflicting changes
+func TestManifestDiffMerge(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "manifest-diff-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+	fileStore, cleanup, err := storage.NewLocalFileStore(datadir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	a := NewAPI(fileStore, nil, nil, nil, nil, chunk.NewTags())
+	ctx := context.Background()
+
+	empty, err := a.NewManifest(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := updateManifest(t, a, empty, map[string]string{
+		"index.html":     "index",
+		"about.html":     "about",
+		"img/logo.png":   "logo",
+		"img/banner.png": "banner",
+	})
+	ours := updateManifest(t, a, base, map[string]string{
+		"index.html":   "new index",
+		"contact.html": "contact",
+	}, "img/banner.png")
+	theirs := updateManifest(t, a, base, map[string]string{
+		"img/logo.png": "new logo",
+		"blog/1.html":  "post",
+	}, "about.html")
+
+	diff, err := a.DiffManifests(ctx, base, ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(diff.Added, diff.Removed, diff.Changed)
+	if want := "[contact.html] [img/banner.png] [index.html]"; got != want {
+		t.Fatalf("got diff %s, want %s", got, want)
+	}
+	diff, err = a.DiffManifests(ctx, ours, ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Fatalf("got diff %v of identical manifests", diff)
+	}
+
+	merge, err := a.MergeManifests(ctx, base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merge.Conflicts) != 0 {
+		t.Fatalf("got %d conflicts, want none", len(merge.Conflicts))
+	}
+	entries, err := a.manifestEntries(ctx, merge.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for path, entry := range entries {
+		r, _ := a.Retrieve(ctx, storage.Address(common.Hex2Bytes(entry.Hash)))
+		size, err := r.Size(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := make([]byte, size)
+		if _, err := r.ReadAt(content, 0); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		files = append(files, path+"="+string(content))
+	}
+	sort.Strings(files)
+	got = fmt.Sprint(files)
+	if want := "[blog/1.html=post contact.html=contact img/logo.png=new logo index.html=new index]"; got != want {
+		t.Fatalf("got merged files %s, want %s", got, want)
+	}
+
+	// merging the same changes is not a conflict
+	merge, err = a.MergeManifests(ctx, base, ours, ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merge.Conflicts) != 0 || !bytes.Equal(merge.Root, ours) {
+		t.Fatalf("got merge %v of identical manifests, want root %v", merge, ours)
+	}
+
+	conflicting := updateManifest(t, a, base, map[string]string{
+		"index.html": "their index",
+		"about.html": "new about",
+	}, "img/banner.png")
+	merge, err = a.MergeManifests(ctx, base, ours, conflicting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merge.Root != nil {
+		t.Fatalf("got merged root %v despite conflicts", merge.Root)
+	}
+	if len(merge.Conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(merge.Conflicts))
+	}
+	c := merge.Conflicts[0]
+	if c.Path != "index.html" || c.Base == nil || c.Ours == nil || c.Theirs == nil || c.Ours.Hash == c.Theirs.Hash {
+		t.Fatalf("got conflict %+v", c)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/storage"
+)
+
+const (
+	// DefaultPopularityWindow is the period over which the requests are aggregated
+	DefaultPopularityWindow = time.Hour
+	// DefaultPopularityThreshold is the number of requests in a window below which
+	// the content is not reported
+	DefaultPopularityThreshold = 10
+	// maxPopularityEntries bounds the number of addresses counted in a window
+	maxPopularityEntries = 10000
+)
+
+// ContentPopularity is the number of requests for the content under a root address
+type ContentPopularity struct {
+	Address  storage.Address `json:"address"`
+	Requests uint64          `json:"requests"`
+}
+
+// Popularity counts the requests for served content by root address.
+// To preserve the privacy of the requesters no information about the clients is kept,
+// the counts are only reported for the last complete window, so single requests can
+// not be told apart by timing, and content requested fewer times than the threshold
+// in a window is left out.
+type Popularity struct {
+	window    time.Duration
+	threshold uint64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	start   time.Time            // start of the current window
+	current map[string]uint64    // counts of the current window
+	last    []*ContentPopularity // reported counts of the last window, most requested first
+}
+
+// NewPopularity creates a popularity counter aggregating the requests over windows
+// of the given duration and reporting content requested at least threshold times
+func NewPopularity(window time.Duration, threshold uint64) *Popularity {
+	return &Popularity{
+		window:    window,
+		threshold: threshold,
+		now:       time.Now,
+		start:     time.Now(),
+		current:   make(map[string]uint64),
+	}
+}
+
+// Record counts a request for the content under the root address
+func (p *Popularity) Record(addr storage.Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rotate()
+	key := string(addr)
+	if _, ok := p.current[key]; !ok && len(p.current) >= maxPopularityEntries {
+		metrics.GetOrRegisterCounter("api/popularity/dropped", nil).Inc(1)
+		return
+	}
+	p.current[key]++
+}
+
+// Top returns at most n of the most requested content in the last complete window.
+// All reported content is returned if n is not positive.
+func (p *Popularity) Top(n int) []*ContentPopularity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rotate()
+	if n <= 0 || n > len(p.last) {
+		n = len(p.last)
+	}
+	top := make([]*ContentPopularity, n)
+	for i := range top {
+		c := *p.last[i]
+		top[i] = &c
+	}
+	return top
+}
+
+// rotate closes the current window if it elapsed, the counts of a window are
+// reported only if no windows passed without requests since
+func (p *Popularity) rotate() {
+	elapsed := p.now().Sub(p.start)
+	if elapsed < p.window {
+		return
+	}
+	p.last = nil
+	if elapsed < 2*p.window {
+		for key, count := range p.current {
+			if count < p.threshold {
+				continue
+			}
+			p.last = append(p.last, &ContentPopularity{
+				Address:  storage.Address(key),
+				Requests: count,
+			})
+		}
+		sort.Slice(p.last, func(i, j int) bool {
+			if p.last[i].Requests != p.last[j].Requests {
+				return p.last[i].Requests > p.last[j].Requests
+			}
+			return bytes.Compare(p.last[i].Address, p.last[j].Address) < 0
+		})
+	}
+	p.start = p.start.Add(elapsed / p.window * p.window)
+	p.current = make(map[string]uint64)
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/storage"
+)
+
+// TestPopularity tests that the requests are reported for the last complete
+// window only and that content requested fewer times than the threshold is left out
+func TestPopularity(t *testing.T) {
+	now := time.Now()
+	p := NewPopularity(time.Hour, 2)
+	p.now = func() time.Time { return now }
+	p.start = now
+
+	a := storage.Address(bytes.Repeat([]byte{1}, 32))
+	b := storage.Address(bytes.Repeat([]byte{2}, 32))
+	c := storage.Address(bytes.Repeat([]byte{3}, 32))
+	for i := 0; i < 2; i++ {
+		p.Record(a)
+	}
+	for i := 0; i < 3; i++ {
+		p.Record(b)
+	}
+	p.Record(c)
+
+	// the counts of the current window are not reported
+	if top := p.Top(0); len(top) != 0 {
+		t.Fatalf("expected no content reported, got %d", len(top))
+	}
+
+	now = now.Add(time.Hour)
+	p.Record(c)
+
+	top := p.Top(0)
+	if len(top) != 2 {
+		t.Fatalf("expected 2 content reported, got %d", len(top))
+	}
+	for i, want := range []*ContentPopularity{{b, 3}, {a, 2}} {
+		if !bytes.Equal(top[i].Address, want.Address) || top[i].Requests != want.Requests {
+			t.Fatalf("content %d: expected %x requested %d times, got %x requested %d times", i, want.Address, want.Requests, top[i].Address, top[i].Requests)
+		}
+	}
+	if top := p.Top(1); len(top) != 1 || !bytes.Equal(top[0].Address, b) {
+		t.Fatalf("expected the most requested content only, got %v", top)
+	}
+
+	// the last window is not reported once a window without requests passed
+	now = now.Add(2 * time.Hour)
+	if top := p.Top(0); len(top) != 0 {
+		t.Fatalf("expected no content reported, got %d", len(top))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethersphere/swarm/storage"
+)
+
+// MaxRedirectSize is the maximum length of the target of a redirect entry
+const MaxRedirectSize = 4096
+
+// Redirect entries are manifest entries with the RedirectContentType whose content is
+// the target of the redirect, either a path in the same manifest starting with a slash
+// or a bzz URI of other content. The status of the entry is the HTTP status code of
+// the redirect, entries without a status redirect permanently.
+
+// RedirectStatus returns the HTTP status code of a redirect entry with the given status
+func RedirectStatus(status int) (int, error) {
+	switch status {
+	case 0:
+		return http.StatusMovedPermanently, nil
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return status, nil
+	}
+	return 0, fmt.Errorf("invalid redirect status %d", status)
+}
+
+// RedirectLocation returns the location the target of a redirect entry points to
+// when requested with the given uri, relative to the root of the HTTP server
+func RedirectLocation(target string, uri *URI) (string, error) {
+	if len(target) > MaxRedirectSize {
+		return "", fmt.Errorf("redirect target longer than %d bytes", MaxRedirectSize)
+	}
+	if strings.HasPrefix(target, "/") {
+		return "/" + uri.Scheme + ":/" + uri.Addr + target, nil
+	}
+	to, err := Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect target %q: %v", target, err)
+	}
+	switch to.Scheme {
+	case "bzz", "bzz-immutable":
+	default:
+		return "", fmt.Errorf("invalid redirect target %q: unsupported scheme %q", target, to.Scheme)
+	}
+	if to.Addr == "" {
+		return "", fmt.Errorf("invalid redirect target %q: missing address", target)
+	}
+	return "/" + to.String(), nil
+}
+
+// AddRedirect adds an entry to the manifest redirecting requests for path to target
+// with the given HTTP status code and returns the address of the updated manifest
+func (a *API) AddRedirect(ctx context.Context, addr storage.Address, path, target string, status int) (storage.Address, error) {
+	status, err := RedirectStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := RedirectLocation(target, &URI{Scheme: "bzz", Addr: addr.Hex()}); err != nil {
+		return nil, err
+	}
+	return a.UpdateManifest(ctx, addr, func(mw *ManifestWriter) error {
+		_, err := mw.AddEntry(ctx, strings.NewReader(target), &ManifestEntry{
+			Path:        strings.TrimPrefix(path, "/"),
+			ContentType: RedirectContentType,
+			Size:        int64(len(target)),
+			Status:      status,
+		})
+		return err
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirectLocation(t *testing.T) {
+	uri := &URI{Scheme: "bzz", Addr: "site.eth"}
+	for _, tc := range []struct {
+		target   string
+		location string
+		err      bool
+	}{
+		{target: "/docs/new.html", location: "/bzz:/site.eth/docs/new.html"},
+		{target: "bzz:/other.eth/page", location: "/bzz:/other.eth/page"},
+		{target: "bzz-immutable://abcd/", location: "/bzz-immutable:/abcd/"},
+		{target: "bzz-raw:/abcd", err: true},
+		{target: "https://example.com", err: true},
+		{target: "relative/path", err: true},
+		{target: "bzz:/", err: true},
+	} {
+		location, err := RedirectLocation(tc.target, uri)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%q: expected error", tc.target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tc.target, err)
+		}
+		if location != tc.location {
+			t.Fatalf("%q: got location %q, want %q", tc.target, location, tc.location)
+		}
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	if status, err := RedirectStatus(0); err != nil || status != http.StatusMovedPermanently {
+		t.Fatalf("got status %d error %v, want %d", status, err, http.StatusMovedPermanently)
+	}
+	if status, err := RedirectStatus(http.StatusSeeOther); err != nil || status != http.StatusSeeOther {
+		t.Fatalf("got status %d error %v, want %d", status, err, http.StatusSeeOther)
+	}
+	if _, err := RedirectStatus(http.StatusNotFound); err == nil {
+		t.Fatal("expected error for non redirect status")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+type resolvedFeedsKey struct{}
+
+// ResolvedFeed is a feed update content was resolved through
+type ResolvedFeed struct {
+	Feed  feed.Feed
+	Epoch lookup.Epoch
+}
+
+// ResolvedFeeds records the feed updates content is resolved through with a context,
+// so that callers can tell whether the content can change and when it last did
+type ResolvedFeeds struct {
+	mu      sync.Mutex
+	updates []ResolvedFeed
+}
+
+// WithResolvedFeeds returns a context recording the feed updates that content
+// resolved with it is resolved through
+func WithResolvedFeeds(ctx context.Context) (context.Context, *ResolvedFeeds) {
+	r := &ResolvedFeeds{}
+	return context.WithValue(ctx, resolvedFeedsKey{}, r), r
+}
+
+// Updates returns the recorded feed updates, nil if there are none
+func (r *ResolvedFeeds) Updates() []ResolvedFeed {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ResolvedFeed(nil), r.updates...)
+}
+
+// LastModified returns the time of the latest recorded feed update, the zero time
+// if there are none
+func (r *ResolvedFeeds) LastModified() time.Time {
+	var last time.Time
+	for _, u := range r.Updates() {
+		if t := time.Unix(int64(u.Epoch.Time), 0); t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// recordResolvedFeed records the feed update content is resolved through if the
+// context was returned by WithResolvedFeeds
+func recordResolvedFeed(ctx context.Context, fd *feed.Feed, epoch lookup.Epoch) {
+	r, ok := ctx.Value(resolvedFeedsKey{}).(*ResolvedFeeds)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, ResolvedFeed{Feed: *fd, Epoch: epoch})
+}
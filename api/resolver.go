@@ -0,0 +1,157 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// ResolverAPIVersion is the version of the resolver RPC API
+	ResolverAPIVersion = "1.0"
+	// DefaultResolverCacheTTL is the duration for which resolved names are cached by default
+	DefaultResolverCacheTTL = 5 * time.Minute
+)
+
+// ResolverCacheEntry is a resolved name in the cache of a MultiResolver
+type ResolverCacheEntry struct {
+	Name    string      `json:"name"`
+	Hash    common.Hash `json:"hash"`
+	Expires time.Time   `json:"expires"`
+}
+
+// resolverCache holds the resolved names until they expire
+type resolverCache struct {
+	mu      sync.Mutex
+	entries map[string]*ResolverCacheEntry
+	now     func() time.Time
+}
+
+func newResolverCache() *resolverCache {
+	return &resolverCache{
+		entries: make(map[string]*ResolverCacheEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns the hash of the name if it is cached and not expired
+func (c *resolverCache) get(name string) (common.Hash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[name]
+	if !ok {
+		return common.Hash{}, false
+	}
+	if !c.now().Before(e.Expires) {
+		delete(c.entries, name)
+		return common.Hash{}, false
+	}
+	return e.Hash, true
+}
+
+// put caches the hash of the name for the duration of the ttl
+func (c *resolverCache) put(name string, hash common.Hash, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[name] = &ResolverCacheEntry{
+		Name:    name,
+		Hash:    hash,
+		Expires: c.now().Add(ttl),
+	}
+}
+
+// CacheEntries returns the names in the resolution cache which are not expired,
+// in alphabetical order
+func (m *MultiResolver) CacheEntries() []*ResolverCacheEntry {
+	c := m.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make([]*ResolverCacheEntry, 0, len(c.entries))
+	for name, e := range c.entries {
+		if !now.Before(e.Expires) {
+			delete(c.entries, name)
+			continue
+		}
+		entry := *e
+		entries = append(entries, &entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// FlushCache removes the name from the resolution cache, or all names if it is
+// an empty string, and returns the number of names removed
+func (m *MultiResolver) FlushCache(name string) int {
+	c := m.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name == "" {
+		n := len(c.entries)
+		c.entries = make(map[string]*ResolverCacheEntry)
+		return n
+	}
+	if _, ok := c.entries[name]; !ok {
+		return 0
+	}
+	delete(c.entries, name)
+	return 1
+}
+
+// ResolverAPI is the RPC API to resolve names and inspect the resolution cache
+type ResolverAPI struct {
+	resolver *MultiResolver
+}
+
+// NewResolverAPI creates a new ResolverAPI for the resolver
+func NewResolverAPI(resolver *MultiResolver) *ResolverAPI {
+	return &ResolverAPI{resolver: resolver}
+}
+
+// Resolve resolves the name to a content hash
+func (a *ResolverAPI) Resolve(name string) (common.Hash, error) {
+	return a.resolver.Resolve(name)
+}
+
+// LookupAddress resolves the address to the name in its reverse record
+func (a *ResolverAPI) LookupAddress(addr common.Address) (string, error) {
+	return a.resolver.ReverseResolve(addr)
+}
+
+// Cache returns the names in the resolution cache
+func (a *ResolverAPI) Cache() []*ResolverCacheEntry {
+	return a.resolver.CacheEntries()
+}
+
+// Flush removes the name from the resolution cache, or all names if it is empty,
+// and returns the number of names removed
+func (a *ResolverAPI) Flush(name string) int {
+	return a.resolver.FlushCache(name)
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// countingResolver resolves every name to the same hash and counts the resolutions
+type countingResolver struct {
+	hash  common.Hash
+	count int
+}
+
+func (r *countingResolver) Resolve(string) (common.Hash, error) {
+	r.count++
+	return r.hash, nil
+}
+
+// testReverseResolver resolves the addresses in its records to names
+type testReverseResolver struct {
+	names map[common.Address]string
+}
+
+func (r *testReverseResolver) Resolve(string) (common.Hash, error) {
+	return common.Hash{}, errors.New("not found")
+}
+
+func (r *testReverseResolver) ReverseResolve(addr common.Address) (string, error) {
+	name, ok := r.names[addr]
+	if !ok {
+		return "", errors.New("no reverse record")
+	}
+	return name, nil
+}
+
+// TestMultiResolverCache tests that resolved names are cached for the TTL of
+// their TLD and that the cache can be flushed
+func TestMultiResolverCache(t *testing.T) {
+	ethResolve := &countingResolver{hash: common.HexToHash("0x2222")}
+	testResolve := &countingResolver{hash: common.HexToHash("0x1111")}
+	r := NewMultiResolver(
+		MultiResolverOptionWithNameService(ethResolve, "eth"),
+		MultiResolverOptionWithNameService(testResolve, "test"),
+		MultiResolverOptionWithCacheTTL(time.Minute, ""),
+		MultiResolverOptionWithCacheTTL(0, "test"),
+	)
+	now := time.Now()
+	r.cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Resolve("swarm.eth"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Resolve("swarm.test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ethResolve.count != 1 {
+		t.Fatalf("expected 1 resolution of the cached name, got %d", ethResolve.count)
+	}
+	if testResolve.count != 3 {
+		t.Fatalf("expected 3 resolutions of the name not cached, got %d", testResolve.count)
+	}
+
+	entries := r.CacheEntries()
+	if len(entries) != 1 || entries[0].Name != "swarm.eth" || entries[0].Hash != ethResolve.hash {
+		t.Fatalf("expected swarm.eth cached, got %v", entries)
+	}
+
+	// the name is resolved again once expired
+	now = now.Add(time.Minute)
+	if len(r.CacheEntries()) != 0 {
+		t.Fatal("expected expired name removed from the cache")
+	}
+	if _, err := r.Resolve("swarm.eth"); err != nil {
+		t.Fatal(err)
+	}
+	if ethResolve.count != 2 {
+		t.Fatalf("expected 2 resolutions of the expired name, got %d", ethResolve.count)
+	}
+
+	if n := r.FlushCache("other.eth"); n != 0 {
+		t.Fatalf("expected no names flushed, got %d", n)
+	}
+	if n := r.FlushCache(""); n != 1 {
+		t.Fatalf("expected 1 name flushed, got %d", n)
+	}
+	if _, err := r.Resolve("swarm.eth"); err != nil {
+		t.Fatal(err)
+	}
+	if ethResolve.count != 3 {
+		t.Fatalf("expected 3 resolutions of the flushed name, got %d", ethResolve.count)
+	}
+}
+
+// TestMultiResolverReverseResolve tests that addresses are resolved to names by
+// the first resolver with a reverse record for them
+func TestMultiResolverReverseResolve(t *testing.T) {
+	addr := common.HexToAddress("0x1234123412341234123412341234123412341234")
+	otherAddr := common.HexToAddress("0x5678567856785678567856785678567856785678")
+
+	if _, err := NewMultiResolver(MultiResolverOptionWithResolver(newTestResolveValidator(""), "")).ReverseResolve(addr); err == nil {
+		t.Fatal("expected error without reverse resolvers, got none")
+	}
+
+	r := NewMultiResolver(
+		MultiResolverOptionWithResolver(newTestResolveValidator(""), ""),
+		MultiResolverOptionWithNameService(&testReverseResolver{names: map[common.Address]string{otherAddr: "other.test"}}, "test"),
+		MultiResolverOptionWithNameService(&testReverseResolver{names: map[common.Address]string{addr: "swarm.eth"}}, "eth"),
+	)
+	for a, want := range map[common.Address]string{addr: "swarm.eth", otherAddr: "other.test"} {
+		name, err := r.ReverseResolve(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != want {
+			t.Fatalf("expected %q, got %q", want, name)
+		}
+	}
+	if _, err := r.ReverseResolve(common.Address{}); err == nil {
+		t.Fatal("expected error for address without reverse record, got none")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// MaxSymlinkHops is the maximum number of symlink entries followed to resolve a path
+const MaxSymlinkHops = 8
+
+// Symlink entries are manifest entries with the SymlinkContentType referencing another
+// manifest, either by its hash or by a feed whose latest update is the hash of a
+// manifest. Requests for the path of the entry and the paths under it are served from
+// the referenced manifest with the rest of the path, so that manifests can share
+// common subtrees by reference instead of copying them.
+
+var (
+	// ErrSymlinkLoop is returned when resolving a path leads back to a symlink
+	// already followed for the same path
+	ErrSymlinkLoop = errors.New("symlink loop detected")
+	// ErrSymlinkHops is returned when resolving a path follows more than
+	// MaxSymlinkHops symlinks
+	ErrSymlinkHops = fmt.Errorf("more than %d symlinks followed", MaxSymlinkHops)
+)
+
+// AddSymlink adds an entry to the manifest at addr referencing the manifest at target
+// under path and returns the address of the updated manifest
+func (a *API) AddSymlink(ctx context.Context, addr storage.Address, path string, target storage.Address) (storage.Address, error) {
+	if len(target) != storage.AddressLength {
+		return nil, fmt.Errorf("invalid symlink target %x", target)
+	}
+	return a.addSymlink(ctx, addr, &ManifestEntry{
+		Path:        strings.TrimPrefix(path, "/"),
+		Hash:        target.Hex(),
+		ContentType: SymlinkContentType,
+	})
+}
+
+// AddFeedSymlink adds an entry to the manifest at addr referencing the manifest in the
+// latest update of the feed under path and returns the address of the updated manifest
+func (a *API) AddFeedSymlink(ctx context.Context, addr storage.Address, path string, fd *feed.Feed) (storage.Address, error) {
+	return a.addSymlink(ctx, addr, &ManifestEntry{
+		Path:        strings.TrimPrefix(path, "/"),
+		Feed:        fd,
+		ContentType: SymlinkContentType,
+	})
+}
+
+func (a *API) addSymlink(ctx context.Context, addr storage.Address, entry *ManifestEntry) (storage.Address, error) {
+	return a.UpdateManifest(ctx, addr, func(mw *ManifestWriter) error {
+		// the entry has no content of its own, so it is added to the trie as is
+		return mw.trie.addEntry(newManifestTrieEntry(entry, nil), mw.quitC)
+	})
+}
+
+// resolveSymlink returns the address of the manifest the symlink entry references
+func (a *API) resolveSymlink(ctx context.Context, entry *ManifestEntry) (storage.Address, error) {
+	if entry.Feed == nil {
+		addr := storage.Address(common.Hex2Bytes(entry.Hash))
+		if len(addr) != storage.AddressLength {
+			return nil, fmt.Errorf("invalid symlink target %q", entry.Hash)
+		}
+		return addr, nil
+	}
+	update, err := a.feed.Lookup(ctx, feed.NewQueryLatest(entry.Feed, lookup.NoClue))
+	if err != nil {
+		return nil, err
+	}
+	recordResolvedFeed(ctx, entry.Feed, update.Epoch)
+	_, content, err := a.feed.GetContent(entry.Feed)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) != storage.AddressLength {
+		return nil, fmt.Errorf("invalid swarm hash in feed update. Expected %d bytes. Got %d", storage.AddressLength, len(content))
+	}
+	return storage.Address(content), nil
+}
+
+// symlinkHops records the symlinks followed to resolve a path by the address of the
+// referenced manifest and the path resolved in it
+type symlinkHops map[string]struct{}
+
+// follow records following a symlink to the path in the manifest at addr, returning
+// an error if it was already followed or there are too many symlinks
+func (h symlinkHops) follow(addr storage.Address, path string) error {
+	key := addr.Hex() + "/" + path
+	if _, ok := h[key]; ok {
+		return ErrSymlinkLoop
+	}
+	if len(h) >= MaxSymlinkHops {
+		return ErrSymlinkHops
+	}
+	h[key] = struct{}{}
+	return nil
+}
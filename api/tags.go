@@ -0,0 +1,99 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/subscription"
+)
+
+// TagsAPIVersion is the version of the tags RPC API
+const TagsAPIVersion = "1.0"
+
+// tagProgressInterval is the interval at which the counters of a subscribed tag are checked
+var tagProgressInterval = time.Second
+
+// TagsAPI exposes the progress of the upload tags over RPC
+type TagsAPI struct {
+	tags *chunk.Tags
+}
+
+// NewTagsAPI creates a TagsAPI for the tags
+func NewTagsAPI(tags *chunk.Tags) *TagsAPI {
+	return &TagsAPI{tags: tags}
+}
+
+// List returns the progress of all tags, the most recently started first
+func (a *TagsAPI) List() []*chunk.Progress {
+	tags := a.tags.All()
+	progress := make([]*chunk.Progress, 0, len(tags))
+	for _, t := range tags {
+		progress = append(progress, t.Progress())
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].StartedAt.After(progress[j].StartedAt)
+	})
+	return progress
+}
+
+// Get returns the progress of the tag with the uid
+func (a *TagsAPI) Get(uid uint32) (*chunk.Progress, error) {
+	t, err := a.tags.Get(uid)
+	if err != nil {
+		return nil, err
+	}
+	return t.Progress(), nil
+}
+
+// Progress is an RPC subscription sending the progress of the tag with the uid
+// when its counters change, the last notification is sent once all chunks are synced.
+// The optional opts select the buffering of the notifications for slow clients.
+func (a *TagsAPI) Progress(ctx context.Context, uid uint32, opts *subscription.Options) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	t, err := a.tags.Get(uid)
+	if err != nil {
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+	n, err := subscription.New(notifier, sub, opts, subscription.DropOldest)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-n.Closed()
+		cancel()
+	}()
+	go func() {
+		err := t.WatchProgress(ctx, tagProgressInterval, func(p *chunk.Progress) error {
+			return n.Notify(p)
+		})
+		if err != nil && err != context.Canceled {
+			log.Debug("tag progress subscription failed", "uid", uid, "err", err)
+		}
+	}()
+	return sub, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/subscription"
+)
+
+// TestTagsAPI tests listing the progress of the tags and subscribing to the progress of a tag
+func TestTagsAPI(t *testing.T) {
+	defer func(interval time.Duration) { tagProgressInterval = interval }(tagProgressInterval)
+	tagProgressInterval = 10 * time.Millisecond
+
+	tags := chunk.NewTags()
+	tag, err := tags.Create("upload", 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []chunk.State{chunk.StateSplit, chunk.StateStored} {
+		tag.IncN(state, 4)
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("tags", NewTagsAPI(tags)); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var list []*chunk.Progress
+	if err := client.Call(&list, "tags_list"); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Uid != tag.Uid || list[0].Split != 4 || list[0].Done {
+		t.Fatalf("got tags %+v", list)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	progressC := make(chan *chunk.Progress)
+	sub, err := client.Subscribe(ctx, "tags", progressC, "progress", tag.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	p := <-progressC
+	if p.Synced != 0 || p.ETA != nil {
+		t.Fatalf("got initial progress %+v", p)
+	}
+	for i := 1; i <= 4; i++ {
+		tag.Inc(chunk.StateSent)
+		tag.Inc(chunk.StateSynced)
+		select {
+		case p = <-progressC:
+		case err := <-sub.Err():
+			t.Fatal(err)
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+		for p.Synced < int64(i) {
+			p = <-progressC
+		}
+		if p.ETA == nil || p.SyncedRate <= 0 {
+			t.Fatalf("expected an ETA and a synced rate, got %+v", p)
+		}
+	}
+	if !p.Done {
+		t.Fatalf("expected the tag to be done, got %+v", p)
+	}
+
+	var got *chunk.Progress
+	if err := client.Call(&got, "tags_get", tag.Uid); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Done || got.Synced != 4 {
+		t.Fatalf("got progress %+v", got)
+	}
+
+	opts := &subscription.Options{Buffer: 1, Policy: "block"}
+	if _, err := client.Subscribe(ctx, "tags", make(chan *chunk.Progress), "progress", tag.Uid, opts); err == nil {
+		t.Fatal("expected error subscribing with an invalid policy")
+	}
+	opts.Policy = subscription.DropOldest
+	progressC = make(chan *chunk.Progress)
+	sub, err = client.Subscribe(ctx, "tags", progressC, "progress", tag.Uid, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	if p := <-progressC; !p.Done {
+		t.Fatalf("expected the progress of the done tag, got %+v", p)
+	}
+}
@@ -28,7 +28,8 @@ import (
 
 //matches hex swarm hashes
 // TODO: this is bad, it should not be hardcoded how long is a hash
-var hashMatcher = regexp.MustCompile("^([0-9A-Fa-f]{64})([0-9A-Fa-f]{64})?$")
+// the root addresses of content split with content-defined chunking have a suffix byte
+var hashMatcher = regexp.MustCompile("^([0-9A-Fa-f]{64})([0-9A-Fa-f]{64}|[0-9A-Fa-f]{2})?$")
 
 // URI is a reference to content stored in swarm.
 type URI struct {
@@ -39,6 +40,8 @@ type URI struct {
 	// * bzz-immutable - immutable URI of an entry in a swarm manifest
 	//                   (address is not resolved)
 	// * bzz-list      -  list of all files contained in a swarm manifest
+	// * bzz-info      - metadata of an entry in a swarm manifest
+	// * bzz-hls       - HLS playlist and segments of an MPEG transport stream
 	//
 	Scheme string
 
@@ -86,7 +89,7 @@ func Parse(rawuri string) (*URI, error) {
 
 	// check the scheme is valid
 	switch uri.Scheme {
-	case "bzz", "bzz-raw", "bzz-immutable", "bzz-list", "bzz-hash", "bzz-feed", "bzz-feed-raw", "bzz-tag", "bzz-pin":
+	case "bzz", "bzz-raw", "bzz-immutable", "bzz-list", "bzz-hash", "bzz-feed", "bzz-feed-raw", "bzz-tag", "bzz-pin", "bzz-info", "bzz-hls":
 	default:
 		return nil, fmt.Errorf("unknown scheme %q", u.Scheme)
 	}
@@ -134,6 +137,16 @@ func (u *URI) Hash() bool {
 	return u.Scheme == "bzz-hash"
 }
 
+// Info returns true if the uri refers to the metadata of a manifest entry
+func (u *URI) Info() bool {
+	return u.Scheme == "bzz-info"
+}
+
+// HLS returns true if the uri refers to the HLS stream of a transport stream
+func (u *URI) HLS() bool {
+	return u.Scheme == "bzz-hls"
+}
+
 // Pin returns the string representation of the pin uri scheme
 func (u *URI) Pin() bool {
 	return u.Scheme == "bzz-pin"
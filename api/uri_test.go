@@ -33,6 +33,8 @@ func TestParseURI(t *testing.T) {
 		expectImmutable bool
 		expectList      bool
 		expectHash      bool
+		expectInfo      bool
+		expectHLS       bool
 		expectValidKey  bool
 		expectAddr      storage.Address
 	}
@@ -122,6 +124,16 @@ func TestParseURI(t *testing.T) {
 			expectURI:  &URI{Scheme: "bzz-list"},
 			expectList: true,
 		},
+		{
+			uri:        "bzz-info:/abc/file.txt",
+			expectURI:  &URI{Scheme: "bzz-info", Addr: "abc", Path: "file.txt"},
+			expectInfo: true,
+		},
+		{
+			uri:       "bzz-hls:/abc/index.m3u8",
+			expectURI: &URI{Scheme: "bzz-hls", Addr: "abc", Path: "index.m3u8"},
+			expectHLS: true,
+		},
 		{
 			uri: "bzz-raw://4378d19c26590f1a818ed7d6a62c3809e149b0999cab5ce5f26233b3b423bf8c",
 			expectURI: &URI{Scheme: "bzz-raw",
@@ -162,6 +174,12 @@ func TestParseURI(t *testing.T) {
 		if actual.Hash() != x.expectHash {
 			t.Fatalf("expected %s hash to be %t, got %t", x.uri, x.expectHash, actual.Hash())
 		}
+		if actual.Info() != x.expectInfo {
+			t.Fatalf("expected %s info to be %t, got %t", x.uri, x.expectInfo, actual.Info())
+		}
+		if actual.HLS() != x.expectHLS {
+			t.Fatalf("expected %s hls to be %t, got %t", x.uri, x.expectHLS, actual.HLS())
+		}
 		if x.expectValidKey {
 			if actual.Address() == nil {
 				t.Fatalf("expected %s to return a valid key, got nil", x.uri)
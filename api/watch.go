@@ -0,0 +1,149 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// DefaultWatchInterval is the interval at which a watched feed is looked up for new updates
+const DefaultWatchInterval = 5 * time.Second
+
+// PathUpdate notifies about a change of the entry at a path of the manifest
+// referenced by the latest update of a feed
+type PathUpdate struct {
+	Manifest    storage.Address // manifest referenced by the feed update
+	Path        string          // watched path
+	ContentAddr storage.Address // address of the entry content, nil if the entry was removed
+	ContentType string          // content type of the entry
+	Content     []byte          // content of the entry
+}
+
+// WatchPath watches the entry at the path of the manifests referenced by the updates of the feed.
+// The feed is looked up at the given interval and an update is sent on the returned channel
+// every time a new feed update changes the entry, starting with the entry of the latest update
+// if it exists. The channel is closed when the context is done.
+func (a *API) WatchPath(ctx context.Context, fd *feed.Feed, path string, interval time.Duration) <-chan *PathUpdate {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	path = strings.TrimPrefix(path, "/")
+	updates := make(chan *PathUpdate)
+	go func() {
+		defer close(updates)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var (
+			lastManifest storage.Address
+			lastHash     string
+		)
+		for {
+			manifest, err := a.feedManifest(ctx, fd)
+			if err != nil {
+				log.Debug("watch path: feed lookup failed", "feed", fd.Hex(), "err", err)
+			} else if !bytes.Equal(manifest, lastManifest) {
+				lastManifest = manifest
+				update, hash, err := a.pathUpdate(ctx, manifest, path)
+				if err != nil {
+					log.Debug("watch path: manifest entry lookup failed", "manifest", manifest, "path", path, "err", err)
+				} else if hash != lastHash {
+					lastHash = hash
+					select {
+					case updates <- update:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+// feedManifest returns the address of the manifest referenced by the latest update of the feed
+func (a *API) feedManifest(ctx context.Context, fd *feed.Feed) (storage.Address, error) {
+	if _, err := a.feed.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		return nil, err
+	}
+	_, data, err := a.feed.GetContent(fd)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != storage.AddressLength {
+		return nil, fmt.Errorf("invalid swarm hash in feed update. Expected %d bytes. Got %d", storage.AddressLength, len(data))
+	}
+	return storage.Address(data), nil
+}
+
+// pathUpdate returns the entry at the path of the manifest together with its hash,
+// which is empty if the manifest has no entry at the path
+func (a *API) pathUpdate(ctx context.Context, manifest storage.Address, path string) (update *PathUpdate, hash string, err error) {
+	update = &PathUpdate{
+		Manifest: manifest,
+		Path:     path,
+	}
+	entry, err := a.manifestEntry(ctx, manifest, path)
+	if err != nil {
+		return nil, "", err
+	}
+	if entry == nil {
+		return update, "", nil
+	}
+	update.ContentAddr, err = hex.DecodeString(entry.Hash)
+	if err != nil {
+		return nil, "", err
+	}
+	update.ContentType = entry.ContentType
+	reader, _ := a.fileStore.Retrieve(ctx, update.ContentAddr)
+	update.Content, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return update, entry.Hash, nil
+}
+
+// manifestEntry returns the entry at exactly the path of the manifest
+// it returns nil if the manifest has no such entry
+func (a *API) manifestEntry(ctx context.Context, manifest storage.Address, path string) (*manifestTrieEntry, error) {
+	trie, err := loadManifest(ctx, a.fileStore, manifest, nil, NOOPDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	entry, fullpath := trie.getEntry(path)
+	if entry == nil || fullpath != RegularSlashes(path) || entry.ContentType == ManifestType {
+		return nil, nil
+	}
+	return entry, nil
+}
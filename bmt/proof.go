@@ -0,0 +1,142 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package bmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// InclusionProof proves that a segment is included in the chunk with a given content
+// address, which is the hash of the span and the BMT root of the chunk data. It can
+// be verified without the rest of the chunk data, e.g. by a smart contract.
+type InclusionProof struct {
+	Span    hexutil.Bytes   `json:"span"`    // span of the chunk
+	Index   int             `json:"index"`   // index of the segment in the chunk data
+	Segment hexutil.Bytes   `json:"segment"` // the segment, zero padded if it is beyond the chunk data
+	Sisters []hexutil.Bytes `json:"sisters"` // the inclusion proof of the segment, bottom up
+}
+
+// ErrInvalidChunkData is returned if the chunk data is too short to contain the span
+var ErrInvalidChunkData = errors.New("invalid chunk data")
+
+// NewInclusionProof returns the inclusion proof of the segment with index i of
+// the chunk data, which consists of the 8 byte span followed by the payload.
+func NewInclusionProof(hasher BaseHasherFunc, segmentCount int, data []byte, i int) (*InclusionProof, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidChunkData
+	}
+	if i < 0 || i >= segmentCount {
+		return nil, fmt.Errorf("segment index %d out of range [0, %d)", i, segmentCount)
+	}
+	rh := NewRefHasher(hasher, segmentCount)
+	segmentSize := rh.sectionLength / 2
+	segment := make([]byte, segmentSize)
+	if start := 8 + i*segmentSize; start < len(data) {
+		copy(segment, data[start:])
+	}
+	p := &InclusionProof{
+		Span:    append([]byte{}, data[:8]...),
+		Index:   i,
+		Segment: segment,
+	}
+	for _, sister := range rh.Proof(data[8:], i) {
+		p.Sisters = append(p.Sisters, sister)
+	}
+	return p, nil
+}
+
+// VerifyInclusionProof reports whether the inclusion proof is valid for the chunk
+// with the given content address. It is a pure function of its arguments.
+func VerifyInclusionProof(hasher BaseHasherFunc, addr []byte, p *InclusionProof) bool {
+	segmentSize := hasher().Size()
+	if p == nil || len(p.Span) != 8 || len(p.Segment) != segmentSize || len(p.Sisters) == 0 || len(p.Sisters) >= 32 {
+		return false
+	}
+	if p.Index < 0 || p.Index >= 1<<uint(len(p.Sisters)) {
+		return false
+	}
+	proof := make([][]byte, len(p.Sisters))
+	for i, sister := range p.Sisters {
+		if len(sister) != segmentSize {
+			return false
+		}
+		proof[i] = sister
+	}
+	h := hasher()
+	h.Write(p.Span)
+	h.Write(ProofRoot(hasher, p.Segment, p.Index, proof))
+	return bytes.Equal(h.Sum(nil), addr)
+}
+
+// Proof returns the inclusion proof of the segment with index i of the data:
+// the sister segment followed by the hashes of the sister subtrees up to the root
+// of the BMT. Together with the segment it is sufficient to compute the BMT root
+// with ProofRoot.
+func (rh *RefHasher) Proof(data []byte, i int) [][]byte {
+	d := make([]byte, rh.maxDataLength)
+	copy(d, data)
+	segmentSize := rh.sectionLength / 2
+
+	var sisters [][]byte
+	offset, length := 0, rh.maxDataLength
+	// descend to the section of the segment collecting the hashes of the sister subtrees
+	for length > rh.sectionLength {
+		half := length / 2
+		if i*segmentSize < offset+half {
+			sisters = append(sisters, rh.hash(d[offset+half:offset+length], half))
+		} else {
+			sisters = append(sisters, rh.hash(d[offset:offset+half], half))
+			offset += half
+		}
+		length = half
+	}
+	if i%2 == 0 {
+		sisters = append(sisters, d[offset+segmentSize:offset+rh.sectionLength])
+	} else {
+		sisters = append(sisters, d[offset:offset+segmentSize])
+	}
+
+	// the proof is ordered bottom up
+	for l, r := 0, len(sisters)-1; l < r; l, r = l+1, r-1 {
+		sisters[l], sisters[r] = sisters[r], sisters[l]
+	}
+	return sisters
+}
+
+// ProofRoot returns the BMT root computed from the segment with index i and
+// its inclusion proof. The proof is valid if the result equals the BMT root of the data.
+func ProofRoot(hasher BaseHasherFunc, segment []byte, i int, proof [][]byte) []byte {
+	h := hasher()
+	node := segment
+	for _, sister := range proof {
+		h.Reset()
+		if i%2 == 0 {
+			h.Write(node)
+			h.Write(sister)
+		} else {
+			h.Write(sister)
+			h.Write(node)
+		}
+		node = h.Sum(nil)
+		i /= 2
+	}
+	return node
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package bmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// TestProof tests that the BMT root computed from the inclusion proofs of all
+// segments equals the root of the reference hasher
+func TestProof(t *testing.T) {
+	segmentCount := 128
+	for _, length := range []int{0, 1, 31, 32, 33, 100, 2048, 4095, 4096} {
+		data := make([]byte, length)
+		rand.Read(data)
+		rh := NewRefHasher(sha3.NewLegacyKeccak256, segmentCount)
+		root := rh.Hash(data)
+
+		padded := make([]byte, segmentCount*32)
+		copy(padded, data)
+		for i := 0; i < segmentCount; i++ {
+			segment := padded[i*32 : (i+1)*32]
+			proof := rh.Proof(data, i)
+			if len(proof) != 7 {
+				t.Fatalf("length %d, segment %d: expected proof of 7 sisters, got %d", length, i, len(proof))
+			}
+			if got := ProofRoot(sha3.NewLegacyKeccak256, segment, i, proof); !bytes.Equal(got, root) {
+				t.Fatalf("length %d, segment %d: expected root %x, got %x", length, i, root, got)
+			}
+			// the proof is not valid for another segment
+			if got := ProofRoot(sha3.NewLegacyKeccak256, segment, i^1, proof); bytes.Equal(got, root) && !bytes.Equal(segment, proof[0]) {
+				t.Fatalf("length %d, segment %d: proof valid for segment %d", length, i, i^1)
+			}
+		}
+	}
+}
+
+// TestInclusionProof tests that the inclusion proofs of all segments of a chunk
+// are valid for its content address and invalid if they are tampered with
+func TestInclusionProof(t *testing.T) {
+	segmentCount := 128
+	for _, length := range []int{1, 32, 100, 4096} {
+		data := make([]byte, 8+length)
+		binary.LittleEndian.PutUint64(data, uint64(length))
+		rand.Read(data[8:])
+		rh := NewRefHasher(sha3.NewLegacyKeccak256, segmentCount)
+		h := sha3.NewLegacyKeccak256()
+		h.Write(data[:8])
+		h.Write(rh.Hash(data[8:]))
+		addr := h.Sum(nil)
+
+		for i := 0; i < segmentCount; i++ {
+			p, err := NewInclusionProof(sha3.NewLegacyKeccak256, segmentCount, data, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyInclusionProof(sha3.NewLegacyKeccak256, addr, p) {
+				t.Fatalf("length %d, segment %d: expected valid proof", length, i)
+			}
+			p.Segment[0]++
+			if VerifyInclusionProof(sha3.NewLegacyKeccak256, addr, p) {
+				t.Fatalf("length %d, segment %d: expected invalid proof for tampered segment", length, i)
+			}
+		}
+	}
+
+	if _, err := NewInclusionProof(sha3.NewLegacyKeccak256, segmentCount, make([]byte, 4), 0); err != ErrInvalidChunkData {
+		t.Fatalf("expected error %v, got %v", ErrInvalidChunkData, err)
+	}
+	if _, err := NewInclusionProof(sha3.NewLegacyKeccak256, segmentCount, make([]byte, 8), segmentCount); err == nil {
+		t.Fatal("expected error for segment index out of range")
+	}
+}
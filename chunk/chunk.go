@@ -42,6 +42,8 @@ type Chunk interface {
 	WithPinCounter(p uint64) Chunk
 	TagID() uint32
 	WithTagID(t uint32) Chunk
+	Stamp() []byte
+	WithStamp(s []byte) Chunk
 }
 
 type chunk struct {
@@ -49,6 +51,7 @@ type chunk struct {
 	sdata      []byte
 	pinCounter uint64
 	tagID      uint32
+	stamp      []byte // encoded postage stamp
 }
 
 func NewChunk(addr Address, data []byte) Chunk {
@@ -68,6 +71,11 @@ func (c *chunk) WithTagID(t uint32) Chunk {
 	return c
 }
 
+func (c *chunk) WithStamp(s []byte) Chunk {
+	c.stamp = s
+	return c
+}
+
 func (c *chunk) Address() Address {
 	return c.addr
 }
@@ -84,6 +92,10 @@ func (c *chunk) TagID() uint32 {
 	return c.tagID
 }
 
+func (c *chunk) Stamp() []byte {
+	return c.stamp
+}
+
 func (self *chunk) String() string {
 	return fmt.Sprintf("Address: %v Chunksize: %v", self.addr.Log(), len(self.sdata))
 }
@@ -222,6 +234,8 @@ func (m ModeSet) String() string {
 		return "ModeSetPin"
 	case ModeSetUnpin:
 		return "ModeSetUnpin"
+	case ModeSetReUpload:
+		return "ReUpload"
 	default:
 		return "Unknown"
 	}
@@ -241,6 +255,8 @@ const (
 	ModeSetPin
 	// ModeSetUnpin: when a chunk is unpinned using a command locally
 	ModeSetUnpin
+	// ModeSetReUpload: when a stored chunk needs to be push synced again, e.g. to repair missing content
+	ModeSetReUpload
 )
 
 // Descriptor holds information required for Pull syncing. This struct
@@ -248,6 +264,7 @@ const (
 type Descriptor struct {
 	Address Address
 	BinID   uint64
+	Tag     uint32 // uid of the tag the chunk was uploaded with, 0 for synced chunks
 }
 
 func (d *Descriptor) String() string {
@@ -269,11 +286,54 @@ type Store interface {
 	Close() (err error)
 }
 
+// BatchStore is implemented by stores that write and read many chunks
+// at once, amortizing the index updates over the chunks.
+type BatchStore interface {
+	// PutBatch stores the chunks as Store.Put does.
+	PutBatch(ctx context.Context, mode ModePut, chs []Chunk) (exist []bool, err error)
+	// GetBatch returns the chunks with the addresses, nil for the ones not found.
+	GetBatch(ctx context.Context, mode ModeGet, addrs []Address) (chs []Chunk, err error)
+}
+
+// PutBatch stores the chunks with the PutBatch method of the store
+// if it is a BatchStore, otherwise with a single Put call.
+func PutBatch(ctx context.Context, store Store, mode ModePut, chs []Chunk) (exist []bool, err error) {
+	if s, ok := store.(BatchStore); ok {
+		return s.PutBatch(ctx, mode, chs)
+	}
+	return store.Put(ctx, mode, chs...)
+}
+
+// GetBatch returns the chunks with the addresses, nil for the ones not found, with
+// the GetBatch method of the store if it is a BatchStore, otherwise one by one.
+func GetBatch(ctx context.Context, store Store, mode ModeGet, addrs []Address) (chs []Chunk, err error) {
+	if s, ok := store.(BatchStore); ok {
+		return s.GetBatch(ctx, mode, addrs)
+	}
+	chs = make([]Chunk, len(addrs))
+	for i, addr := range addrs {
+		chs[i], err = store.Get(ctx, mode, addr)
+		if err == ErrChunkNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chs, nil
+}
+
 // Validator validates a chunk.
 type Validator interface {
 	Validate(ch Chunk) bool
 }
 
+// StampValidator validates the postage stamp of a chunk
+// before it is accepted from the network.
+type StampValidator interface {
+	ValidateStamp(ch Chunk) error
+}
+
 // ValidatorStore encapsulates Store by decorating the Put method
 // with validators check.
 type ValidatorStore struct {
@@ -301,6 +361,26 @@ func (s *ValidatorStore) Put(ctx context.Context, mode ModePut, chs ...Chunk) (e
 	return s.Store.Put(ctx, mode, chs...)
 }
 
+// PutBatch overrides BatchStore PutBatch method with validators check as Put.
+func (s *ValidatorStore) PutBatch(ctx context.Context, mode ModePut, chs []Chunk) (exist []bool, err error) {
+	for _, ch := range chs {
+		if !s.validate(ch) {
+			return nil, ErrChunkInvalid
+		}
+	}
+	return PutBatch(ctx, s.Store, mode, chs)
+}
+
+// GetBatch implements BatchStore with the encapsulated Store.
+func (s *ValidatorStore) GetBatch(ctx context.Context, mode ModeGet, addrs []Address) (chs []Chunk, err error) {
+	return GetBatch(ctx, s.Store, mode, addrs)
+}
+
+// Validators returns the validators used to validate chunks on Put.
+func (s *ValidatorStore) Validators() []Validator {
+	return s.validators
+}
+
 // validate returns true if one of the validators
 // return true. If all validators return false,
 // the chunk is considered invalid.
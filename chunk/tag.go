@@ -39,11 +39,21 @@ var (
 type State = uint32
 
 const (
-	StateSplit  State = iota // chunk has been processed by filehasher/swarm safe call
-	StateStored              // chunk stored locally
-	StateSeen                // chunk previously seen
-	StateSent                // chunk sent to neighbourhood
-	StateSynced              // proof is received; chunk removed from sync db; chunk is available everywhere
+	StateSplit        State = iota // chunk has been processed by filehasher/swarm safe call
+	StateStored                    // chunk stored locally
+	StateSeen                      // chunk previously seen
+	StateSent                      // chunk sent to neighbourhood
+	StateSynced                    // proof is received; chunk removed from sync db; chunk is available everywhere
+	StateDeduplicated              // chunk found stored in its neighbourhood; not sent
+)
+
+// Priority is the enum type for push sync priorities of tags
+type Priority = uint32
+
+const (
+	PriorityBackground Priority = iota // bulk uploads which must not starve other uploads
+	PriorityNormal                     // default priority of new tags
+	PriorityHigh                       // urgent uploads pushed ahead of all others
 )
 
 // Tag represents info on the status of new chunks
@@ -55,12 +65,21 @@ type Tag struct {
 	Sent   int64 // number of chunks sent for push syncing
 	Synced int64 // number of chunks synced with proof
 
+	Deduplicated int64 // number of chunks found stored in their neighbourhood and not sent
+
+	RawBytes        int64 // length of the payloads of the data chunks offered for compression
+	CompressedBytes int64 // length of those payloads as stored, after compression
+
 	Uid       uint32    // a unique identifier for this tag
 	Anonymous bool      // indicates if the tag is anonymous (i.e. if only pull sync should be used)
 	Name      string    // a name tag for this tag
 	Address   Address   // the associated swarm hash for this tag
 	StartedAt time.Time // tag started to calculate ETA
 
+	Priority  Priority // push sync priority of the chunks belonging to the tag
+	RateLimit int64    // max number of bytes per second push synced for the tag, 0 if unlimited
+	dedup     uint32   // 1 if chunks are probed in their neighbourhood before they are sent
+
 	// end-to-end tag tracing
 	ctx      context.Context  // tracing context
 	span     opentracing.Span // tracing root span
@@ -75,6 +94,7 @@ func NewTag(uid uint32, s string, total int64, anon bool) *Tag {
 		Name:      s,
 		StartedAt: time.Now(),
 		Total:     total,
+		Priority:  PriorityNormal,
 	}
 
 	// context here is used only to store the root span `new.upload.tag` within Tag,
@@ -109,6 +129,8 @@ func (t *Tag) IncN(state State, n int) {
 		v = &t.Sent
 	case StateSynced:
 		v = &t.Synced
+	case StateDeduplicated:
+		v = &t.Deduplicated
 	}
 	atomic.AddInt64(v, int64(n))
 }
@@ -132,10 +154,64 @@ func (t *Tag) Get(state State) int64 {
 		v = &t.Sent
 	case StateSynced:
 		v = &t.Synced
+	case StateDeduplicated:
+		v = &t.Deduplicated
 	}
 	return atomic.LoadInt64(v)
 }
 
+// SetPriority sets the push sync priority of the tag
+func (t *Tag) SetPriority(p Priority) {
+	atomic.StoreUint32(&t.Priority, p)
+}
+
+// GetPriority returns the push sync priority of the tag
+func (t *Tag) GetPriority() Priority {
+	return atomic.LoadUint32(&t.Priority)
+}
+
+// SetRateLimit sets the max number of bytes per second push synced for the tag
+// a limit of 0 means unlimited
+func (t *Tag) SetRateLimit(bytesPerSecond int64) {
+	atomic.StoreInt64(&t.RateLimit, bytesPerSecond)
+}
+
+// GetRateLimit returns the max number of bytes per second push synced for the tag
+func (t *Tag) GetRateLimit() int64 {
+	return atomic.LoadInt64(&t.RateLimit)
+}
+
+// SetDedup sets whether chunks of the tag are probed in their neighbourhood
+// and only sent if they are not already stored there
+func (t *Tag) SetDedup(dedup bool) {
+	var v uint32
+	if dedup {
+		v = 1
+	}
+	atomic.StoreUint32(&t.dedup, v)
+}
+
+// Dedup returns true if chunks of the tag are deduplicated before they are sent
+func (t *Tag) Dedup() bool {
+	return atomic.LoadUint32(&t.dedup) == 1
+}
+
+// AddCompressed accounts a data chunk payload of raw bytes stored as compressed bytes
+func (t *Tag) AddCompressed(raw, compressed int64) {
+	atomic.AddInt64(&t.RawBytes, raw)
+	atomic.AddInt64(&t.CompressedBytes, compressed)
+}
+
+// CompressionRatio returns the ratio of the raw length of the compressed data chunk
+// payloads to their stored length, 0 if no data chunk was compressed
+func (t *Tag) CompressionRatio() float64 {
+	compressed := atomic.LoadInt64(&t.CompressedBytes)
+	if compressed == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&t.RawBytes)) / float64(compressed)
+}
+
 // GetTotal returns the total count
 func (t *Tag) TotalCounter() int64 {
 	return atomic.LoadInt64(&t.Total)
@@ -185,7 +261,7 @@ func (t *Tag) Status(state State) (int64, int64, error) {
 	switch state {
 	case StateSplit, StateStored, StateSeen:
 		return count, total, nil
-	case StateSent, StateSynced:
+	case StateSent, StateSynced, StateDeduplicated:
 		stored := atomic.LoadInt64(&t.Stored)
 		if stored < total {
 			return count, total - seen, errNA
@@ -209,6 +285,92 @@ func (t *Tag) ETA(state State) (time.Time, error) {
 	return t.StartedAt.Add(dur), nil
 }
 
+// Progress is a snapshot of the counters of a tag with the rates and the ETA of
+// syncing derived from them, its fields are named as those of the tag
+type Progress struct {
+	Uid       uint32
+	Name      string
+	Address   Address
+	Anonymous bool
+	StartedAt time.Time
+
+	Total        int64
+	Split        int64
+	Seen         int64
+	Stored       int64
+	Sent         int64
+	Synced       int64
+	Deduplicated int64
+
+	RawBytes        int64
+	CompressedBytes int64
+
+	SplitRate  float64    // chunks split per second since the tag started
+	SyncedRate float64    // chunks synced per second since the tag started
+	ETA        *time.Time `json:",omitempty"` // estimated time syncing completes, nil if it can not be estimated yet
+	Done       bool       // whether all chunks of the tag are synced
+}
+
+// Progress returns a snapshot of the counters of the tag
+func (t *Tag) Progress() *Progress {
+	p := &Progress{
+		Uid:             t.Uid,
+		Name:            t.Name,
+		Address:         t.Address,
+		Anonymous:       t.Anonymous,
+		StartedAt:       t.StartedAt,
+		Total:           atomic.LoadInt64(&t.Total),
+		Split:           t.Get(StateSplit),
+		Seen:            t.Get(StateSeen),
+		Stored:          t.Get(StateStored),
+		Sent:            t.Get(StateSent),
+		Synced:          t.Get(StateSynced),
+		Deduplicated:    t.Get(StateDeduplicated),
+		RawBytes:        atomic.LoadInt64(&t.RawBytes),
+		CompressedBytes: atomic.LoadInt64(&t.CompressedBytes),
+		Done:            t.Done(StateSynced),
+	}
+	if elapsed := time.Since(t.StartedAt).Seconds(); elapsed > 0 {
+		p.SplitRate = float64(p.Split) / elapsed
+		p.SyncedRate = float64(p.Synced) / elapsed
+	}
+	if eta, err := t.ETA(StateSynced); err == nil {
+		p.ETA = &eta
+	}
+	return p
+}
+
+// counters returns whether the counters of the progress equal those of the other
+func (p *Progress) counters(o *Progress) bool {
+	return p.Total == o.Total && p.Split == o.Split && p.Seen == o.Seen && p.Stored == o.Stored &&
+		p.Sent == o.Sent && p.Synced == o.Synced && p.Deduplicated == o.Deduplicated
+}
+
+// WatchProgress calls f with the progress of the tag when its counters change, checked
+// every interval, until the tag is synced, f returns an error or the context is done
+func (t *Tag) WatchProgress(ctx context.Context, interval time.Duration, f func(*Progress) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *Progress
+	for {
+		p := t.Progress()
+		if last == nil || !p.counters(last) {
+			if err := f(p); err != nil {
+				return err
+			}
+			last = p
+		}
+		if p.Done {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // MarshalBinary marshals the tag into a byte slice
 func (tag *Tag) MarshalBinary() (data []byte, err error) {
 	buffer := make([]byte, 4)
@@ -219,6 +381,9 @@ func (tag *Tag) MarshalBinary() (data []byte, err error) {
 	encodeInt64Append(&buffer, tag.Stored)
 	encodeInt64Append(&buffer, tag.Sent)
 	encodeInt64Append(&buffer, tag.Synced)
+	encodeInt64Append(&buffer, tag.Deduplicated)
+	encodeInt64Append(&buffer, tag.RawBytes)
+	encodeInt64Append(&buffer, tag.CompressedBytes)
 
 	intBuffer := make([]byte, 8)
 
@@ -247,6 +412,9 @@ func (tag *Tag) UnmarshalBinary(buffer []byte) error {
 	tag.Stored = decodeInt64Splice(&buffer)
 	tag.Sent = decodeInt64Splice(&buffer)
 	tag.Synced = decodeInt64Splice(&buffer)
+	tag.Deduplicated = decodeInt64Splice(&buffer)
+	tag.RawBytes = decodeInt64Splice(&buffer)
+	tag.CompressedBytes = decodeInt64Splice(&buffer)
 
 	t, n := binary.Varint(buffer)
 	tag.StartedAt = time.Unix(t, 0)
@@ -258,6 +426,9 @@ func (tag *Tag) UnmarshalBinary(buffer []byte) error {
 		tag.Address = buffer[:t]
 	}
 	tag.Name = string(buffer[t:])
+	// priority, rate limit and deduplication are runtime settings which are not persisted
+	tag.Priority = PriorityNormal
+	tag.dedup = 0
 
 	return nil
 }
@@ -24,7 +24,7 @@ import (
 )
 
 var (
-	allStates = []State{StateSplit, StateStored, StateSeen, StateSent, StateSynced}
+	allStates = []State{StateSplit, StateStored, StateSeen, StateSent, StateSynced, StateDeduplicated}
 )
 
 // TestTagSingleIncrements tests if Inc increments the tag state value
@@ -42,6 +42,7 @@ func TestTagSingleIncrements(t *testing.T) {
 		{state: StateSeen, inc: 1, expcount: 1, exptotal: 10},
 		{state: StateSent, inc: 9, expcount: 9, exptotal: 9},
 		{state: StateSynced, inc: 9, expcount: 9, exptotal: 9},
+		{state: StateDeduplicated, inc: 4, expcount: 4, exptotal: 9},
 	}
 
 	for _, tc := range tc {
@@ -63,6 +64,7 @@ func TestTagStatus(t *testing.T) {
 	tg.Inc(StateSeen)
 	tg.Inc(StateSent)
 	tg.Inc(StateSynced)
+	tg.Inc(StateDeduplicated)
 
 	for i := 0; i < 10; i++ {
 		tg.Inc(StateSplit)
@@ -78,6 +80,7 @@ func TestTagStatus(t *testing.T) {
 		{state: StateSeen, expVal: 1, expTotal: 10},
 		{state: StateSent, expVal: 1, expTotal: 9},
 		{state: StateSynced, expVal: 1, expTotal: 9},
+		{state: StateDeduplicated, expVal: 1, expTotal: 9},
 	} {
 		val, total, err := tg.Status(v.state)
 		if err != nil {
@@ -114,7 +117,7 @@ func TestTagConcurrentIncrements(t *testing.T) {
 	tg := &Tag{}
 	n := 1000
 	wg := sync.WaitGroup{}
-	wg.Add(5 * n)
+	wg.Add(len(allStates) * n)
 	for _, f := range allStates {
 		go func(f State) {
 			for j := 0; j < n; j++ {
@@ -139,7 +142,7 @@ func TestTagsMultipleConcurrentIncrementsSyncMap(t *testing.T) {
 	ts := NewTags()
 	n := 100
 	wg := sync.WaitGroup{}
-	wg.Add(10 * 5 * n)
+	wg.Add(10 * len(allStates) * n)
 	for i := 0; i < 10; i++ {
 		s := string([]byte{uint8(i)})
 		tag, err := ts.Create(s, int64(n), false)
@@ -189,6 +192,7 @@ func TestMarshallingWithAddr(t *testing.T) {
 	for _, f := range allStates {
 		tg.Inc(f)
 	}
+	tg.AddCompressed(4096, 1024)
 
 	b, err := tg.MarshalBinary()
 	if err != nil {
@@ -223,6 +227,10 @@ func TestMarshallingWithAddr(t *testing.T) {
 		t.Fatalf("tag names not equal. want %d got %d", tg.TotalCounter(), unmarshalledTag.TotalCounter())
 	}
 
+	if r := unmarshalledTag.CompressionRatio(); r != 4 {
+		t.Fatalf("expected compression ratio 4, got %v", r)
+	}
+
 	if len(unmarshalledTag.Address) != len(tg.Address) {
 		t.Fatalf("tag addresses length mismatch, want %d, got %d", len(tg.Address), len(unmarshalledTag.Address))
 	}
@@ -1,23 +1,36 @@
 package client
 
 import (
+	"context"
+
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm"
+	apiclient "github.com/ethersphere/swarm/api/client"
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/storage"
 )
 
 type Bzz struct {
 	client *rpc.Client
+
+	Policy apiclient.Policy // retries and timeouts of the calls
 }
 
 // NewBzz is a constructor for a Bzz API
 func NewBzz(client *rpc.Client) *Bzz {
 	return &Bzz{
 		client: client,
+		Policy: apiclient.DefaultPolicy(),
 	}
 }
 
+// call calls the rpc method, retrying and timing it out according to the policy
+func (b *Bzz) call(result interface{}, method string, args ...interface{}) error {
+	return b.Policy.Do(context.Background(), apiclient.OpNodeQuery, func(ctx context.Context) error {
+		return b.client.CallContext(ctx, result, method, args...)
+	})
+}
+
 // GetChunksBitVector returns a bit vector of presence for a given slice of chunks
 func (b *Bzz) GetChunksBitVector(addrs []storage.Address) (string, error) {
 	var hostChunks string
@@ -31,7 +44,7 @@ func (b *Bzz) GetChunksBitVector(addrs []storage.Address) (string, error) {
 			pagesize = len(addrs)
 		}
 
-		err := b.client.Call(&pageChunks, "bzz_has", addrs[:pagesize])
+		err := b.call(&pageChunks, "bzz_has", addrs[:pagesize])
 		if err != nil {
 			return "", err
 		}
@@ -46,7 +59,7 @@ func (b *Bzz) GetChunksBitVector(addrs []storage.Address) (string, error) {
 func (b *Bzz) GetBzzAddr() (string, error) {
 	var info swarm.Info
 
-	err := b.client.Call(&info, "bzz_info")
+	err := b.call(&info, "bzz_info")
 	if err != nil {
 		return "", err
 	}
@@ -58,7 +71,7 @@ func (b *Bzz) GetBzzAddr() (string, error) {
 func (b *Bzz) IsPullSyncing() (bool, error) {
 	var isSyncing bool
 
-	err := b.client.Call(&isSyncing, "bzz_isPullSyncing")
+	err := b.call(&isSyncing, "bzz_isPullSyncing")
 	if err != nil {
 		log.Error("error calling host for isPullSyncing", "err", err)
 		return false, err
@@ -71,7 +84,7 @@ func (b *Bzz) IsPullSyncing() (bool, error) {
 func (b *Bzz) IsPushSynced(tagname string) (bool, error) {
 	var isSynced bool
 
-	err := b.client.Call(&isSynced, "bzz_isPushSynced", tagname)
+	err := b.call(&isSynced, "bzz_isPushSynced", tagname)
 	if err != nil {
 		log.Error("error calling host for isPushSynced", "err", err)
 		return false, err
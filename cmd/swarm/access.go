@@ -25,7 +25,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethersphere/swarm/api"
-	"github.com/ethersphere/swarm/api/client"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -255,7 +254,7 @@ func printManifests(rootAccessManifest, actManifest *api.Manifest) error {
 
 func uploadManifests(ctx *cli.Context, rootAccessManifest, actManifest *api.Manifest, toPin bool) error {
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-	client := client.NewClient(bzzapi)
+	client := newClient(ctx, bzzapi)
 
 	var (
 		key string
@@ -22,3 +22,7 @@ var SwarmBootnodes = []string{
 
 	"enode://1e03eed11736a0b03d9bed9ddb2b753179ad078c93fe3de759ccfa43340aab1c14c96959bed0ccf71216f811aa8ed1c760662ffa0f54ed75f4296fe5292d392f@44.232.104.7:30301",
 }
+
+// SwarmBootnodeTrees are the enrtree:// URLs of the DNS trees listing bootnodes, by network id,
+// used unless set with --bootnodes-dns
+var SwarmBootnodeTrees = map[uint64][]string{}
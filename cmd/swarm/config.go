@@ -18,12 +18,15 @@ package main
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -36,6 +39,9 @@ import (
 
 	bzzapi "github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/dnsdisc"
+	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/ethersphere/swarm/swap"
 )
 
 var (
@@ -72,11 +78,83 @@ const (
 	SwarmEnvSwapBackendURL          = "SWARM_SWAP_BACKEND_URL"
 	SwarmEnvSwapPaymentThreshold    = "SWARM_SWAP_PAYMENT_THRESHOLD"
 	SwarmEnvSwapDisconnectThreshold = "SWARM_SWAP_DISCONNECT_THRESHOLD"
+	SwarmEnvSwapTokens              = "SWARM_SWAP_TOKENS"
+	SwarmEnvSwapPriceOracle         = "SWARM_SWAP_PRICE_ORACLE"
+	SwarmEnvSwapPrices              = "SWARM_SWAP_PRICES"
+	SwarmEnvSwapPriceContract       = "SWARM_SWAP_PRICE_CONTRACT"
+	SwarmEnvSwapReferenceGasPrice   = "SWARM_SWAP_REFERENCE_GAS_PRICE"
+	SwarmEnvSwapPriceUpdateInterval = "SWARM_SWAP_PRICE_UPDATE_INTERVAL"
+	SwarmEnvSwapMaxPriceRatio       = "SWARM_SWAP_MAX_PRICE_RATIO"
+	SwarmEnvMeteringEnable          = "SWARM_METERING_ENABLE"
+	SwarmEnvMeteringSoftLimit       = "SWARM_METERING_SOFT_LIMIT"
+	SwarmEnvMeteringRefreshRate     = "SWARM_METERING_REFRESH_RATE"
+	SwarmEnvBandwidthUpload         = "SWARM_BANDWIDTH_UPLOAD"
+	SwarmEnvBandwidthDownload       = "SWARM_BANDWIDTH_DOWNLOAD"
+	SwarmEnvBandwidthPeerUpload     = "SWARM_BANDWIDTH_PEER_UPLOAD"
+	SwarmEnvBandwidthPeerDownload   = "SWARM_BANDWIDTH_PEER_DOWNLOAD"
+	SwarmEnvPostageEnable           = "SWARM_POSTAGE_ENABLE"
+	SwarmEnvPostageRequired         = "SWARM_POSTAGE_REQUIRED"
+	SwarmEnvPostageIssuers          = "SWARM_POSTAGE_ISSUERS"
+	SwarmEnvIdentityCredential      = "SWARM_IDENTITY_CREDENTIAL"
+	SwarmEnvIdentityAuthorities     = "SWARM_IDENTITY_AUTHORITIES"
+	SwarmEnvIdentityRevocationList  = "SWARM_IDENTITY_REVOCATION_LIST"
+	SwarmEnvNetworkKey              = "SWARM_NETWORK_KEY"
+	SwarmEnvNetworkKeyPrevious      = "SWARM_NETWORK_KEY_PREVIOUS"
+	SwarmEnvNetworkKeyGrace         = "SWARM_NETWORK_KEY_GRACE"
+	SwarmEnvFailoverAddr            = "SWARM_FAILOVER_ADDR"
+	SwarmEnvFailoverPartner         = "SWARM_FAILOVER_PARTNER"
+	SwarmEnvFailoverPrimary         = "SWARM_FAILOVER_PRIMARY"
+	SwarmEnvHandoverTimeout         = "SWARM_HANDOVER_TIMEOUT"
+	SwarmEnvPinCheckInterval        = "SWARM_PIN_CHECK_INTERVAL"
+	SwarmEnvPinCheckFix             = "SWARM_PIN_CHECK_FIX"
+	SwarmEnvPinRepairInterval       = "SWARM_PIN_REPAIR_INTERVAL"
+	SwarmEnvPinRepairSamples        = "SWARM_PIN_REPAIR_SAMPLES"
+	SwarmEnvDNSLink                 = "SWARM_DNSLINK"
+	SwarmEnvZone                    = "SWARM_ZONE"
+	SwarmEnvPreferZone              = "SWARM_PREFER_ZONE"
+	SwarmEnvGateway                 = "SWARM_GATEWAY"
+	SwarmEnvGatewayRateLimit        = "SWARM_GATEWAY_RATE_LIMIT"
+	SwarmEnvGatewayMaxUploadSize    = "SWARM_GATEWAY_MAX_UPLOAD_SIZE"
+	SwarmEnvGatewayBandwidthQuota   = "SWARM_GATEWAY_BANDWIDTH_QUOTA"
+	SwarmEnvGatewayBlockedTopics    = "SWARM_GATEWAY_BLOCKED_TOPICS"
+	SwarmEnvGatewayNoAnonymous      = "SWARM_GATEWAY_NO_ANONYMOUS_UPLOAD"
+	SwarmEnvGatewayUploadTokens     = "SWARM_GATEWAY_UPLOAD_TOKENS"
+	SwarmEnvContentTypePipeline     = "SWARM_CONTENT_TYPE_PIPELINE"
+	SwarmEnvContentTypeOverrides    = "SWARM_CONTENT_TYPE_OVERRIDES"
+	SwarmEnvHTTPAuth                = "SWARM_HTTP_AUTH"
+	SwarmEnvQuota                   = "SWARM_QUOTA"
+	SwarmEnvQuotaUpload             = "SWARM_QUOTA_UPLOAD"
+	SwarmEnvQuotaPinned             = "SWARM_QUOTA_PINNED"
+	SwarmEnvAPIToken                = "SWARM_API_TOKEN"
+	SwarmEnvNoPopularity            = "SWARM_NO_POPULARITY"
+	SwarmEnvPopularityWindow        = "SWARM_POPULARITY_WINDOW"
+	SwarmEnvPopularityThreshold     = "SWARM_POPULARITY_THRESHOLD"
+	SwarmEnvMetricsHistory          = "SWARM_METRICS_HISTORY"
+	SwarmEnvMetricsHistoryInterval  = "SWARM_METRICS_HISTORY_INTERVAL"
+	SwarmEnvMetricsHistoryRetention = "SWARM_METRICS_HISTORY_RETENTION"
 	SwarmNoSync                     = "SWARM_NO_SYNC"
+	SwarmEnvSyncMinPO               = "SWARM_SYNC_MIN_PO"
+	SwarmEnvSyncMaxPO               = "SWARM_SYNC_MAX_PO"
+	SwarmEnvSyncTags                = "SWARM_SYNC_TAGS"
 	SwarmEnvSwapLogPath             = "SWARM_SWAP_LOG_PATH"
 	SwarmEnvSwapLogLevel            = "SWARM_SWAP_LOG_LEVEL"
 	SwarmEnvLightNodeEnable         = "SWARM_LIGHT_NODE_ENABLE"
+	SwarmEnvNoPssRelay              = "SWARM_NO_PSS_RELAY"
+	SwarmEnvNatRelay                = "SWARM_NAT_RELAY"
+	SwarmEnvUnderlays               = "SWARM_UNDERLAYS"
+	SwarmEnvQuicAddr                = "SWARM_QUIC_ADDR"
+	SwarmEnvBridge                  = "SWARM_BRIDGE"
+	SwarmEnvBootnodesDNS            = "SWARM_BOOTNODES_DNS"
+	SwarmEnvMigrateLegacyDB         = "SWARM_MIGRATE_LEGACY_DB"
+	SwarmEnvStoreBackend            = "SWARM_STORE_BACKEND"
+	SwarmEnvStoreHotCapacity        = "SWARM_STORE_HOT_CAPACITY"
+	SwarmEnvColdStoreEndpoint       = "SWARM_STORE_COLD_ENDPOINT"
+	SwarmEnvColdStoreBucket         = "SWARM_STORE_COLD_BUCKET"
+	SwarmEnvColdStoreRegion         = "SWARM_STORE_COLD_REGION"
+	SwarmEnvColdStoreAccessKey      = "SWARM_STORE_COLD_ACCESS_KEY"
+	SwarmEnvColdStoreSecretKey      = "SWARM_STORE_COLD_SECRET_KEY"
 	SwarmEnvENSAPI                  = "SWARM_ENS_API"
+	SwarmEnvENSCacheTTL             = "SWARM_ENS_CACHE_TTL"
 	SwarmEnvRNSAPI                  = "SWARM_RNS_API"
 	SwarmEnvENSAddr                 = "SWARM_ENS_ADDR"
 	SwarmEnvCORS                    = "SWARM_CORS"
@@ -89,6 +167,7 @@ const (
 	SwarmEnvNATInterface            = "SWARM_NAT_INTERFACE"
 	SwarmAccessPassword             = "SWARM_ACCESS_PASSWORD"
 	SwarmAutoDefaultPath            = "SWARM_AUTO_DEFAULTPATH"
+	SwarmEnvEncryptionKey           = "SWARM_ENCRYPTION_KEY"
 	SwarmGlobalstoreAPI             = "SWARM_GLOBALSTORE_API"
 	GethEnvDataDir                  = "GETH_DATADIR"
 )
@@ -228,13 +307,168 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if disconnectThreshold := ctx.GlobalUint64(SwarmSwapDisconnectThresholdFlag.Name); disconnectThreshold != 0 {
 		currentConfig.SwapDisconnectThreshold = disconnectThreshold
 	}
+	if swapTokens := ctx.GlobalString(SwarmSwapTokensFlag.Name); swapTokens != "" {
+		currentConfig.SwapTokens = nil
+		for _, t := range strings.Split(swapTokens, ",") {
+			parts := strings.SplitN(strings.TrimSpace(t), ":", 2)
+			if !common.IsHexAddress(parts[0]) {
+				utils.Fatalf("invalid swap token chequebook address %q", parts[0])
+			}
+			token := swap.TokenParams{Chequebook: common.HexToAddress(parts[0])}
+			if len(parts) == 2 {
+				rate, err := strconv.ParseUint(parts[1], 10, 64)
+				if err != nil {
+					utils.Fatalf("invalid swap token rate %q: %v", parts[1], err)
+				}
+				token.Rate = rate
+			}
+			currentConfig.SwapTokens = append(currentConfig.SwapTokens, token)
+		}
+	}
+	if priceOracle := ctx.GlobalString(SwarmSwapPriceOracleFlag.Name); priceOracle != "" {
+		currentConfig.SwapPriceOracle.Kind = priceOracle
+	}
+	if prices := ctx.GlobalString(SwarmSwapPricesFlag.Name); prices != "" {
+		currentConfig.SwapPriceOracle.Prices = nil
+		for _, p := range strings.Split(prices, ",") {
+			parts := strings.SplitN(strings.TrimSpace(p), ":", 2)
+			if len(parts) != 2 {
+				utils.Fatalf("invalid swap price %q, expected message:price", p)
+			}
+			value, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				utils.Fatalf("invalid swap price %q: %v", parts[1], err)
+			}
+			currentConfig.SwapPriceOracle.Prices = append(currentConfig.SwapPriceOracle.Prices, swap.MessagePrice{Message: parts[0], Value: value})
+		}
+	}
+	if priceContract := ctx.GlobalString(SwarmSwapPriceContractFlag.Name); priceContract != "" {
+		if !common.IsHexAddress(priceContract) {
+			utils.Fatalf("invalid swap price contract address %q", priceContract)
+		}
+		currentConfig.SwapPriceOracle.Contract = common.HexToAddress(priceContract)
+	}
+	if referenceGasPrice := ctx.GlobalUint64(SwarmSwapReferenceGasPriceFlag.Name); referenceGasPrice != 0 {
+		currentConfig.SwapPriceOracle.ReferenceGasPrice = referenceGasPrice
+	}
+	if interval := ctx.GlobalDuration(SwarmSwapPriceUpdateIntervalFlag.Name); interval != 0 {
+		currentConfig.SwapPriceOracle.UpdateInterval = interval
+	}
+	if ratio := ctx.GlobalUint64(SwarmSwapMaxPriceRatioFlag.Name); ratio != 0 {
+		currentConfig.SwapPriceOracle.MaxPriceRatio = ratio
+	}
+	if ctx.GlobalBool(SwarmMeteringEnabledFlag.Name) {
+		currentConfig.MeteringEnabled = true
+	}
+	if softLimit := ctx.GlobalInt64(SwarmMeteringSoftLimitFlag.Name); softLimit != 0 {
+		currentConfig.MeteringSoftLimit = softLimit
+	}
+	if refreshRate := ctx.GlobalInt64(SwarmMeteringRefreshRateFlag.Name); refreshRate != 0 {
+		currentConfig.MeteringRefreshRate = refreshRate
+	}
+	if upload := ctx.GlobalInt64(SwarmBandwidthUploadFlag.Name); upload != 0 {
+		currentConfig.BandwidthUpload = upload
+	}
+	if download := ctx.GlobalInt64(SwarmBandwidthDownloadFlag.Name); download != 0 {
+		currentConfig.BandwidthDownload = download
+	}
+	if peerUpload := ctx.GlobalInt64(SwarmBandwidthPeerUploadFlag.Name); peerUpload != 0 {
+		currentConfig.BandwidthPeerUpload = peerUpload
+	}
+	if peerDownload := ctx.GlobalInt64(SwarmBandwidthPeerDownloadFlag.Name); peerDownload != 0 {
+		currentConfig.BandwidthPeerDownload = peerDownload
+	}
+	if ctx.GlobalBool(SwarmPostageEnabledFlag.Name) {
+		currentConfig.PostageEnabled = true
+	}
+	if ctx.GlobalBool(SwarmPostageRequiredFlag.Name) {
+		currentConfig.PostageRequired = true
+	}
+	if issuers := ctx.GlobalString(SwarmPostageIssuersFlag.Name); issuers != "" {
+		currentConfig.PostageIssuers = nil
+		for _, issuer := range strings.Split(issuers, ",") {
+			issuer = strings.TrimSpace(issuer)
+			if !common.IsHexAddress(issuer) {
+				utils.Fatalf("invalid postage issuer address %q", issuer)
+			}
+			currentConfig.PostageIssuers = append(currentConfig.PostageIssuers, common.HexToAddress(issuer))
+		}
+	}
+	if credential := ctx.GlobalString(SwarmIdentityCredentialFlag.Name); credential != "" {
+		currentConfig.IdentityCredential = credential
+	}
+	if authorities := ctx.GlobalString(SwarmIdentityAuthoritiesFlag.Name); authorities != "" {
+		currentConfig.IdentityAuthorities = nil
+		for _, authority := range strings.Split(authorities, ",") {
+			authority = strings.TrimSpace(authority)
+			if !common.IsHexAddress(authority) {
+				utils.Fatalf("invalid identity authority address %q", authority)
+			}
+			currentConfig.IdentityAuthorities = append(currentConfig.IdentityAuthorities, common.HexToAddress(authority))
+		}
+	}
+	if revocationList := ctx.GlobalString(SwarmIdentityRevocationListFlag.Name); revocationList != "" {
+		currentConfig.IdentityRevocationList = revocationList
+	}
+	if key := ctx.GlobalString(SwarmNetworkKeyFlag.Name); key != "" {
+		currentConfig.NetworkKey = key
+	}
+	if previous := ctx.GlobalString(SwarmNetworkKeyPreviousFlag.Name); previous != "" {
+		currentConfig.NetworkKeyPrevious = previous
+	}
+	if ctx.GlobalIsSet(SwarmNetworkKeyGraceFlag.Name) {
+		currentConfig.NetworkKeyGrace = ctx.GlobalDuration(SwarmNetworkKeyGraceFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmFailoverAddrFlag.Name) {
+		currentConfig.FailoverListenAddr = ctx.GlobalString(SwarmFailoverAddrFlag.Name)
+	}
+	if partner := ctx.GlobalString(SwarmFailoverPartnerFlag.Name); partner != "" {
+		currentConfig.FailoverPartner = partner
+	}
+	if ctx.GlobalIsSet(SwarmFailoverPrimaryFlag.Name) {
+		currentConfig.FailoverPrimary = ctx.GlobalBool(SwarmFailoverPrimaryFlag.Name)
+	}
 	if ctx.GlobalIsSet(SwarmNoSyncFlag.Name) {
 		val := !ctx.GlobalBool(SwarmNoSyncFlag.Name)
 		currentConfig.SyncEnabled, currentConfig.PushSyncEnabled = val, val // if the flag is set (true) - push and pull sync should be disabled
 	}
+	if ctx.GlobalIsSet(SwarmSyncMinPOFlag.Name) {
+		currentConfig.SyncMinPO = ctx.GlobalInt(SwarmSyncMinPOFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmSyncMaxPOFlag.Name) {
+		currentConfig.SyncMaxPO = ctx.GlobalInt(SwarmSyncMaxPOFlag.Name)
+	}
+	if syncTags := ctx.GlobalString(SwarmSyncTagsFlag.Name); syncTags != "" {
+		currentConfig.SyncTags = nil
+		for _, t := range strings.Split(syncTags, ",") {
+			uid, err := strconv.ParseUint(strings.TrimSpace(t), 10, 32)
+			if err != nil {
+				utils.Fatalf("invalid sync tag %q: %v", t, err)
+			}
+			currentConfig.SyncTags = append(currentConfig.SyncTags, uint32(uid))
+		}
+	}
 	if ctx.GlobalIsSet(SwarmLightNodeEnabled.Name) {
 		currentConfig.LightNodeEnabled = true
 	}
+	if ctx.GlobalIsSet(SwarmNoPssRelayFlag.Name) {
+		currentConfig.PssRelayDisabled = ctx.GlobalBool(SwarmNoPssRelayFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmNatRelayFlag.Name) {
+		currentConfig.NatRelay = ctx.GlobalBool(SwarmNatRelayFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmUnderlaysFlag.Name) {
+		currentConfig.AltUnderlays = ctx.GlobalStringSlice(SwarmUnderlaysFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmQuicAddrFlag.Name) {
+		currentConfig.QuicListenAddr = ctx.GlobalString(SwarmQuicAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmBridgeFlag.Name) {
+		currentConfig.Bridge = ctx.GlobalBool(SwarmBridgeFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmBootnodesDNSFlag.Name) {
+		currentConfig.BootnodeTrees = ctx.GlobalStringSlice(SwarmBootnodesDNSFlag.Name)
+	}
 	if ctx.GlobalIsSet(EnsAPIFlag.Name) {
 		ensAPIs := ctx.GlobalStringSlice(EnsAPIFlag.Name)
 		// preserve backward compatibility to disable ENS with --ens-api=""
@@ -246,6 +480,9 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 		}
 		currentConfig.EnsAPIs = ensAPIs
 	}
+	if ctx.GlobalIsSet(EnsCacheTTLFlag.Name) {
+		currentConfig.EnsCacheTTLs = ctx.GlobalStringSlice(EnsCacheTTLFlag.Name)
+	}
 	if rns := ctx.GlobalString(RnsAPIFlag.Name); rns != "" {
 		currentConfig.RnsAPI = rns
 	}
@@ -261,6 +498,30 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if ctx.GlobalIsSet(SwarmStoreCacheCapacity.Name) {
 		currentConfig.CacheCapacity = ctx.GlobalUint(SwarmStoreCacheCapacity.Name)
 	}
+	if ctx.GlobalIsSet(SwarmMigrateLegacyDBFlag.Name) {
+		currentConfig.MigrateLegacyDB = ctx.GlobalBool(SwarmMigrateLegacyDBFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmStoreBackendFlag.Name) {
+		currentConfig.ChunkStoreBackend = ctx.GlobalString(SwarmStoreBackendFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmStoreHotCapacityFlag.Name) {
+		currentConfig.DbHotCapacity = ctx.GlobalUint64(SwarmStoreHotCapacityFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmColdStoreEndpointFlag.Name) {
+		currentConfig.ColdStoreEndpoint = ctx.GlobalString(SwarmColdStoreEndpointFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmColdStoreBucketFlag.Name) {
+		currentConfig.ColdStoreBucket = ctx.GlobalString(SwarmColdStoreBucketFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmColdStoreRegionFlag.Name) {
+		currentConfig.ColdStoreRegion = ctx.GlobalString(SwarmColdStoreRegionFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmColdStoreAccessKeyFlag.Name) {
+		currentConfig.ColdStoreAccessKey = ctx.GlobalString(SwarmColdStoreAccessKeyFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmColdStoreSecretKeyFlag.Name) {
+		currentConfig.ColdStoreSecretKey = ctx.GlobalString(SwarmColdStoreSecretKeyFlag.Name)
+	}
 	if ctx.GlobalIsSet(SwarmBootnodeModeFlag.Name) {
 		currentConfig.BootnodeMode = ctx.GlobalBool(SwarmBootnodeModeFlag.Name)
 	}
@@ -273,6 +534,87 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if ctx.GlobalBool(SwarmEnablePinningFlag.Name) {
 		currentConfig.EnablePinning = true
 	}
+	if ctx.GlobalBool(SwarmPinningProviderFlag.Name) {
+		currentConfig.PinningProvider = true
+	}
+	if ctx.GlobalIsSet(SwarmPinCheckIntervalFlag.Name) {
+		currentConfig.PinCheckInterval = ctx.GlobalDuration(SwarmPinCheckIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPinCheckFixFlag.Name) {
+		currentConfig.PinCheckFix = ctx.GlobalBool(SwarmPinCheckFixFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPinRepairIntervalFlag.Name) {
+		currentConfig.PinRepairInterval = ctx.GlobalDuration(SwarmPinRepairIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPinRepairSamplesFlag.Name) {
+		currentConfig.PinRepairSamples = ctx.GlobalInt(SwarmPinRepairSamplesFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmDNSLinkFlag.Name) {
+		currentConfig.DNSLinkEnabled = ctx.GlobalBool(SwarmDNSLinkFlag.Name)
+	}
+	if zone := ctx.GlobalString(SwarmZoneFlag.Name); zone != "" {
+		currentConfig.Zone = zone
+	}
+	if ctx.GlobalIsSet(SwarmPreferZoneFlag.Name) {
+		currentConfig.ZonePreferred = ctx.GlobalBool(SwarmPreferZoneFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayFlag.Name) {
+		currentConfig.GatewayEnabled = ctx.GlobalBool(SwarmGatewayFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayRateLimitFlag.Name) {
+		currentConfig.GatewayRequestsPerMinute = ctx.GlobalInt(SwarmGatewayRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayMaxUploadSizeFlag.Name) {
+		currentConfig.GatewayMaxUploadSize = ctx.GlobalInt64(SwarmGatewayMaxUploadSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayBandwidthQuotaFlag.Name) {
+		currentConfig.GatewayBandwidthQuota = ctx.GlobalInt64(SwarmGatewayBandwidthQuotaFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayBlockedTopicsFlag.Name) {
+		currentConfig.GatewayBlockedTopics = ctx.GlobalStringSlice(SwarmGatewayBlockedTopicsFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayNoAnonymousUploadFlag.Name) {
+		currentConfig.GatewayNoAnonymousUploads = ctx.GlobalBool(SwarmGatewayNoAnonymousUploadFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmGatewayUploadTokensFlag.Name) {
+		currentConfig.GatewayUploadTokens = ctx.GlobalStringSlice(SwarmGatewayUploadTokensFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmContentTypePipelineFlag.Name) {
+		currentConfig.ContentTypePipeline = ctx.GlobalStringSlice(SwarmContentTypePipelineFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmContentTypeOverridesFlag.Name) {
+		currentConfig.ContentTypeOverrides = ctx.GlobalStringSlice(SwarmContentTypeOverridesFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmHTTPAuthFlag.Name) {
+		currentConfig.AuthEnabled = ctx.GlobalBool(SwarmHTTPAuthFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmQuotaFlag.Name) {
+		currentConfig.QuotaEnabled = ctx.GlobalBool(SwarmQuotaFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmQuotaUploadFlag.Name) {
+		currentConfig.QuotaUploadBytes = ctx.GlobalInt64(SwarmQuotaUploadFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmQuotaPinnedFlag.Name) {
+		currentConfig.QuotaPinnedBytes = ctx.GlobalInt64(SwarmQuotaPinnedFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmNoPopularityFlag.Name) {
+		currentConfig.PopularityDisabled = ctx.GlobalBool(SwarmNoPopularityFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPopularityWindowFlag.Name) {
+		currentConfig.PopularityWindow = ctx.GlobalDuration(SwarmPopularityWindowFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPopularityThresholdFlag.Name) {
+		currentConfig.PopularityThreshold = ctx.GlobalUint64(SwarmPopularityThresholdFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmMetricsHistoryFlag.Name) {
+		currentConfig.MetricsHistoryEnabled = ctx.GlobalBool(SwarmMetricsHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmMetricsHistoryIntervalFlag.Name) {
+		currentConfig.MetricsHistoryInterval = ctx.GlobalDuration(SwarmMetricsHistoryIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmMetricsHistoryRetentionFlag.Name) {
+		currentConfig.MetricsHistoryRetention = ctx.GlobalDuration(SwarmMetricsHistoryRetentionFlag.Name)
+	}
 	return currentConfig
 }
 
@@ -293,7 +635,10 @@ func dumpConfig(ctx *cli.Context) error {
 	return nil
 }
 
-//validate configuration parameters
+// minimum length in bytes of the network key of private swarms
+const minNetworkKeyLength = 16
+
+// validate configuration parameters
 func validateConfig(cfg *bzzapi.Config) (err error) {
 	for _, ensAPI := range cfg.EnsAPIs {
 		if ensAPI != "" {
@@ -302,6 +647,49 @@ func validateConfig(cfg *bzzapi.Config) (err error) {
 			}
 		}
 	}
+	for _, ensCacheTTL := range cfg.EnsCacheTTLs {
+		ttl := ensCacheTTL
+		if i := strings.Index(ttl, ":"); i >= 0 {
+			ttl = ttl[i+1:]
+		}
+		if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+			return fmt.Errorf("invalid format [tld:]duration for ENS cache TTL configuration %q", ensCacheTTL)
+		}
+	}
+	for _, underlay := range cfg.AltUnderlays {
+		if _, err := network.ParseUnderlay(underlay); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{cfg.NetworkKey, cfg.NetworkKeyPrevious} {
+		if key == "" {
+			continue
+		}
+		if b, err := hex.DecodeString(strings.TrimPrefix(key, "0x")); err != nil || len(b) < minNetworkKeyLength {
+			return fmt.Errorf("invalid network key, must be at least %d hex encoded bytes", minNetworkKeyLength)
+		}
+	}
+	if cfg.NetworkKeyPrevious != "" && cfg.NetworkKey == "" {
+		return errors.New("previous network key set without a network key")
+	}
+	switch cfg.ChunkStoreBackend {
+	case "", localstore.BackendLevelDB, localstore.BackendFiles:
+	default:
+		return fmt.Errorf("invalid chunk store backend %q, must be %s or %s", cfg.ChunkStoreBackend, localstore.BackendLevelDB, localstore.BackendFiles)
+	}
+	if cfg.ColdStoreEndpoint != "" {
+		if cfg.ColdStoreBucket == "" {
+			return errors.New("cold store endpoint set without a bucket")
+		}
+		if cfg.DbHotCapacity >= cfg.DbCapacity {
+			return fmt.Errorf("hot store size %d must be smaller than the store size %d", cfg.DbHotCapacity, cfg.DbCapacity)
+		}
+	}
+	for _, tree := range cfg.BootnodeTrees {
+		if _, _, err := dnsdisc.ParseURL(tree); err != nil {
+			return fmt.Errorf("invalid bootnode tree %q: %v", tree, err)
+		}
+	}
 	return nil
 }
 
@@ -18,19 +18,25 @@ package main
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
 	"github.com/ethersphere/swarm/storage/localstore"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
@@ -67,7 +73,22 @@ The export may be quite large, consider piping the output through the Unix
 pv(1) tool to get a progress bar:
 
     swarm db export ~/.ethereum/swarm/bzz-KEY/chunks - | pv > chunks.tar
+
+With --stream the chunks are exported in a length prefixed stream format
+that keeps the pin counters of the chunks, optionally compressed with --gzip,
+and can be limited to pinned chunks, a proximity order range to the base key
+or chunks stored since a time, to seed new nodes or back up gateways:
+
+    swarm db export --stream --gzip --pinned ~/.ethereum/swarm/bzz-KEY/chunks pinned.swarm KEY
 `,
+			Flags: []cli.Flag{
+				SwarmExportStreamFlag,
+				SwarmExportGzipFlag,
+				SwarmExportPinnedFlag,
+				SwarmExportMinPOFlag,
+				SwarmExportMaxPOFlag,
+				SwarmExportSinceFlag,
+			},
 		},
 		{
 			Action:             dbImport,
@@ -82,11 +103,63 @@ pv(1) tool to get a progress bar:
 The import may be quite large, consider piping the input through the Unix
 pv(1) tool to get a progress bar:
 
-    pv chunks.tar | swarm db import ~/.ethereum/swarm/bzz-KEY/chunks -`,
+    pv chunks.tar | swarm db import ~/.ethereum/swarm/bzz-KEY/chunks -
+
+Exports in the stream format of swarm db export --stream are detected and
+imported with the pin counters of the chunks.`,
 			Flags: []cli.Flag{
 				SwarmLegacyFlag,
 			},
 		},
+		{
+			Action:             dbImportLegacy,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "import-legacy",
+			Usage:              "import chunks from a legacy chunk database into a local chunk database",
+			ArgsUsage:          "<legacy chunkdb> <chunkdb> <basekey>",
+			Description: `Import chunks from the chunk database of a legacy swarm release into a local chunk database.
+
+    swarm db import-legacy ~/.ethereum/swarm/bzz-KEY/chunks.legacy ~/.ethereum/swarm/bzz-KEY/chunks KEY
+
+The chunks are imported in the order they were last accessed, so that the
+garbage collection of the local chunk database removes the same chunks first.
+The local chunk database is created if it does not exist.`,
+		},
+		{
+			Action:             dbMigrateBackend,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "migrate-backend",
+			Usage:              "move the data of chunks of a local chunk database to a backend",
+			ArgsUsage:          "<chunkdb> <backend> <basekey>",
+			Description: `Move the data of chunks of a local chunk database to the backend, leveldb or files.
+
+    swarm db migrate-backend ~/.ethereum/swarm/bzz-KEY/chunks files KEY
+
+A node started with the --store.backend flag stores new chunks in the backend
+and reads the chunks from the backend they were stored in, the migration
+moves the chunks stored before to the backend.`,
+		},
+		{
+			Action:             dbVerify,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "verify",
+			Usage:              "check the integrity of a local chunk database",
+			ArgsUsage:          "<chunkdb> <basekey>",
+			Description: `Check the indexes and the data of the chunks of a local chunk database and print a JSON report of the issues found.
+
+    swarm db verify --repair --rate 10000 ~/.ethereum/swarm/bzz-KEY/chunks KEY
+
+With --repair the inconsistent index entries are fixed or removed and the
+corrupted chunks are moved to the quarantine index. The --store.backend flag
+must match the one of the node, chunks with the data in a backend that is not
+configured are reported as unchecked. A running node is checked with the
+bzz_verifyStorage RPC method instead.`,
+			Flags: []cli.Flag{
+				SwarmVerifyRepairFlag,
+				SwarmVerifyRateFlag,
+				SwarmStoreBackendFlag,
+			},
+		},
 	},
 }
 
@@ -125,7 +198,31 @@ func dbExport(ctx *cli.Context) {
 	}
 	defer store.Close()
 
-	count, err := store.Export(out)
+	var count int64
+	if ctx.Bool(SwarmExportStreamFlag.Name) {
+		maxPO := ctx.Uint(SwarmExportMaxPOFlag.Name)
+		if maxPO > chunk.MaxPO {
+			utils.Fatalf("invalid --%s %v, must be at most %v", SwarmExportMaxPOFlag.Name, maxPO, chunk.MaxPO)
+		}
+		var since int64
+		if ctx.IsSet(SwarmExportSinceFlag.Name) {
+			since = time.Unix(ctx.Int64(SwarmExportSinceFlag.Name), 0).UnixNano()
+		}
+		count, err = store.ExportStream(out, &localstore.ExportOptions{
+			Pinned: ctx.Bool(SwarmExportPinnedFlag.Name),
+			MinPO:  uint8(ctx.Uint(SwarmExportMinPOFlag.Name)),
+			MaxPO:  uint8(maxPO),
+			Since:  since,
+			Gzip:   ctx.Bool(SwarmExportGzipFlag.Name),
+		})
+	} else {
+		for _, f := range []string{SwarmExportGzipFlag.Name, SwarmExportPinnedFlag.Name, SwarmExportMinPOFlag.Name, SwarmExportMaxPOFlag.Name, SwarmExportSinceFlag.Name} {
+			if ctx.IsSet(f) {
+				utils.Fatalf("--%s requires --%s", f, SwarmExportStreamFlag.Name)
+			}
+		}
+		count, err = store.Export(out)
+	}
 	if err != nil {
 		utils.Fatalf("error exporting local chunk database: %s", err)
 	}
@@ -159,7 +256,13 @@ func dbImport(ctx *cli.Context) {
 		in = f
 	}
 
-	count, err := store.Import(in, legacy)
+	var count int64
+	br := bufio.NewReader(in)
+	if localstore.IsStreamExport(br) {
+		count, err = store.ImportStream(br)
+	} else {
+		count, err = store.Import(br, legacy)
+	}
 	if err != nil {
 		utils.Fatalf("error importing local chunk database: %s", err)
 	}
@@ -167,6 +270,94 @@ func dbImport(ctx *cli.Context) {
 	log.Info(fmt.Sprintf("successfully imported %d chunks", count))
 }
 
+func dbImportLegacy(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 3 {
+		utils.Fatalf("invalid arguments, please specify <legacy chunkdb> (path to a legacy chunk database), <chunkdb> (path to a local chunk database) and the base key")
+	}
+	if !localstore.IsLegacyDatabase(args[0]) {
+		utils.Fatalf("%s is not a legacy chunk database", args[0])
+	}
+	if localstore.IsLegacyDatabase(args[1]) {
+		utils.Fatalf("%s is a legacy chunk database", args[1])
+	}
+	basekey := common.Hex2Bytes(args[2])
+
+	store, err := localstore.New(args[1], basekey, nil)
+	if err != nil {
+		utils.Fatalf("error opening local chunk database: %s", err)
+	}
+	defer store.Close()
+
+	count, err := store.ImportLegacy(args[0], basekey)
+	if err != nil {
+		utils.Fatalf("error importing legacy chunk database: %s", err)
+	}
+
+	log.Info(fmt.Sprintf("successfully imported %d chunks from legacy db", count))
+}
+
+func dbVerify(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		utils.Fatalf("invalid arguments, please specify both <chunkdb> (path to a local chunk database) and the base key")
+	}
+	if _, err := os.Stat(filepath.Join(args[0], "CURRENT")); err != nil {
+		utils.Fatalf("invalid chunkdb path: %s", err)
+	}
+
+	store, err := localstore.New(args[0], common.Hex2Bytes(args[1]), &localstore.Options{
+		Backend: ctx.String(SwarmStoreBackendFlag.Name),
+	})
+	if err != nil {
+		utils.Fatalf("error opening local chunk database: %s", err)
+	}
+	defer store.Close()
+
+	report, err := store.Verify(context.Background(), &localstore.VerifyOptions{
+		Validators: []chunk.Validator{
+			storage.NewContentAddressValidator(storage.MakeHashFunc(storage.DefaultHash)),
+			feed.NewHandler(&feed.HandlerParams{}),
+		},
+		Repair: ctx.Bool(SwarmVerifyRepairFlag.Name),
+		Rate:   ctx.Int(SwarmVerifyRateFlag.Name),
+	})
+	if err != nil {
+		utils.Fatalf("error verifying local chunk database: %s", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		utils.Fatalf("error writing report: %s", err)
+	}
+}
+
+func dbMigrateBackend(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 3 {
+		utils.Fatalf("invalid arguments, please specify <chunkdb> (path to a local chunk database), <backend> (leveldb or files) and the base key")
+	}
+	if _, err := os.Stat(filepath.Join(args[0], "CURRENT")); err != nil {
+		utils.Fatalf("invalid chunkdb path: %s", err)
+	}
+
+	store, err := localstore.New(args[0], common.Hex2Bytes(args[2]), &localstore.Options{
+		Backend: args[1],
+	})
+	if err != nil {
+		utils.Fatalf("error opening local chunk database: %s", err)
+	}
+	defer store.Close()
+
+	count, err := store.MigrateBackend()
+	if err != nil {
+		utils.Fatalf("error migrating local chunk database to backend %s: %s", args[1], err)
+	}
+
+	log.Info(fmt.Sprintf("successfully moved %d chunks to backend %s", count, args[1]))
+}
+
 func openLDBStore(path string, basekey []byte) (*localstore.DB, error) {
 	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
 		return nil, fmt.Errorf("invalid chunkdb path: %s", err)
@@ -0,0 +1,68 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethersphere/swarm/events"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var eventsCommand = cli.Command{
+	Action:             printEvents,
+	CustomHelpTemplate: helpTemplate,
+	Name:               "events",
+	Usage:              "print the events of a running node",
+	ArgsUsage:          "[type...]",
+	Description:        "Prints the events of the types, all if none given, of the Swarm node running locally as JSON lines until interrupted. The types are peer-added, peer-dropped, depth-changed, gc-run, cheque-bounced and sync-stalled. You must reference the correct path to your bzzd.ipc file",
+}
+
+func printEvents(ctx *cli.Context) {
+	types := make([]events.Type, 0, len(ctx.Args()))
+	for _, t := range ctx.Args() {
+		types = append(types, events.Type(t))
+	}
+
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	c := make(chan json.RawMessage)
+	sub, err := client.Subscribe(context.Background(), "admin", c, "events", types, nil)
+	if err != nil {
+		utils.Fatalf("subscribing to events: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case e := <-c:
+			os.Stdout.Write(append(e, '\n'))
+		case err := <-sub.Err():
+			if err != nil {
+				utils.Fatalf("events subscription: %v", err)
+			}
+			return
+		}
+	}
+}
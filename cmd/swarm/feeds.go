@@ -26,7 +26,6 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
-	swarm "github.com/ethersphere/swarm/api/client"
 	"github.com/ethersphere/swarm/storage/feed"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -72,8 +71,11 @@ var feedCommand = cli.Command{
 					
 					If you have a manifest, you can specify it with --manifest to refer to the feed,
 					instead of using --topic / --name
+
+					Use --at to sign the update for a future time and have the node publish it then,
+					the signing key does not need to be available at that time
 					`,
-			Flags: []cli.Flag{SwarmFeedManifestFlag, SwarmFeedNameFlag, SwarmFeedTopicFlag},
+			Flags: []cli.Flag{SwarmFeedManifestFlag, SwarmFeedNameFlag, SwarmFeedTopicFlag, SwarmFeedAtFlag},
 		},
 		{
 			Action:             feedInfo,
@@ -124,7 +126,7 @@ func getTopic(ctx *cli.Context) (topic feed.Topic) {
 func feedCreateManifest(ctx *cli.Context) {
 	var (
 		bzzapi = strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-		client = swarm.NewClient(bzzapi)
+		client = newClient(ctx, bzzapi)
 	)
 
 	newFeedUpdateRequest := feed.NewFirstRequest(getTopic(ctx))
@@ -144,8 +146,9 @@ func feedUpdate(ctx *cli.Context) {
 
 	var (
 		bzzapi                  = strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-		client                  = swarm.NewClient(bzzapi)
+		client                  = newClient(ctx, bzzapi)
 		manifestAddressOrDomain = ctx.String(SwarmFeedManifestFlag.Name)
+		at                      = ctx.Uint64(SwarmFeedAtFlag.Name)
 	)
 
 	if len(args) < 1 {
@@ -170,6 +173,13 @@ func feedUpdate(ctx *cli.Context) {
 		query.User = signer.Address()
 		query.Topic = getTopic(ctx)
 	}
+	if at > 0 {
+		// request an update for the epoch of the publishing time
+		if query == nil {
+			query = new(feed.Query)
+		}
+		query.TimeLimit = at
+	}
 
 	// Retrieve a feed update request
 	updateRequest, err = client.GetFeedRequest(query, manifestAddressOrDomain)
@@ -191,7 +201,11 @@ func feedUpdate(ctx *cli.Context) {
 	}
 
 	// post update
-	err = client.UpdateFeed(updateRequest)
+	if at > 0 {
+		err = client.ScheduleFeedUpdate(updateRequest)
+	} else {
+		err = client.UpdateFeed(updateRequest)
+	}
 	if err != nil {
 		utils.Fatalf("Error updating feed: %s", err.Error())
 		return
@@ -201,7 +215,7 @@ func feedUpdate(ctx *cli.Context) {
 func feedInfo(ctx *cli.Context) {
 	var (
 		bzzapi                  = strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-		client                  = swarm.NewClient(bzzapi)
+		client                  = newClient(ctx, bzzapi)
 		manifestAddressOrDomain = ctx.String(SwarmFeedManifestFlag.Name)
 	)
 
@@ -18,7 +18,13 @@
 package main
 
 import (
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/handover"
+	"github.com/ethersphere/swarm/metrics/history"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/pin"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
@@ -94,11 +100,163 @@ var (
 		Usage:  "honey amount at which a peer disconnects",
 		EnvVar: SwarmEnvSwapDisconnectThreshold,
 	}
+	SwarmSwapTokensFlag = cli.StringFlag{
+		Name:   "swap-tokens",
+		Usage:  "comma separated chequebooks of additional payment tokens with optional rates (chequebook[:rate]), in order of preference",
+		EnvVar: SwarmEnvSwapTokens,
+	}
+	SwarmSwapPriceOracleFlag = cli.StringFlag{
+		Name:   "swap-price-oracle",
+		Usage:  "oracle of the prices of the messages the node is paid for: static, gas (prices scaled by the gas price) or contract",
+		EnvVar: SwarmEnvSwapPriceOracle,
+	}
+	SwarmSwapPricesFlag = cli.StringFlag{
+		Name:   "swap-prices",
+		Usage:  "comma separated prices in honey of message types (message:price), base prices of the gas price oracle",
+		EnvVar: SwarmEnvSwapPrices,
+	}
+	SwarmSwapPriceContractFlag = cli.StringFlag{
+		Name:   "swap-price-contract",
+		Usage:  "address of the contract providing the prices of the contract price oracle",
+		EnvVar: SwarmEnvSwapPriceContract,
+	}
+	SwarmSwapReferenceGasPriceFlag = cli.Uint64Flag{
+		Name:   "swap-reference-gas-price",
+		Usage:  "gas price in wei at which the gas price oracle returns the configured prices",
+		EnvVar: SwarmEnvSwapReferenceGasPrice,
+	}
+	SwarmSwapPriceUpdateIntervalFlag = cli.DurationFlag{
+		Name:   "swap-price-update-interval",
+		Usage:  "interval at which prices are updated from the oracle and advertised to peers",
+		EnvVar: SwarmEnvSwapPriceUpdateInterval,
+	}
+	SwarmSwapMaxPriceRatioFlag = cli.Uint64Flag{
+		Name:   "swap-max-price-ratio",
+		Usage:  "multiple of the local prices above which peers advertising higher prices are dropped",
+		EnvVar: SwarmEnvSwapMaxPriceRatio,
+	}
+	SwarmMeteringEnabledFlag = cli.BoolFlag{
+		Name:   "metering",
+		Usage:  "meter the traffic with peers without settlement, when SWAP is disabled",
+		EnvVar: SwarmEnvMeteringEnable,
+	}
+	SwarmMeteringSoftLimitFlag = cli.Int64Flag{
+		Name:   "metering-soft-limit",
+		Usage:  "balance a peer can owe before its messages are delayed, 0 for no limit",
+		EnvVar: SwarmEnvMeteringSoftLimit,
+	}
+	SwarmMeteringRefreshRateFlag = cli.Int64Flag{
+		Name:   "metering-refresh-rate",
+		Usage:  "units of the peer balances settled every second for free",
+		EnvVar: SwarmEnvMeteringRefreshRate,
+	}
+	SwarmBandwidthUploadFlag = cli.Int64Flag{
+		Name:   "bandwidth-upload",
+		Usage:  "bytes per second sent to all peers by the chunk transferring protocols, 0 for no limit",
+		EnvVar: SwarmEnvBandwidthUpload,
+	}
+	SwarmBandwidthDownloadFlag = cli.Int64Flag{
+		Name:   "bandwidth-download",
+		Usage:  "bytes per second received from all peers by the chunk transferring protocols, 0 for no limit",
+		EnvVar: SwarmEnvBandwidthDownload,
+	}
+	SwarmBandwidthPeerUploadFlag = cli.Int64Flag{
+		Name:   "bandwidth-peer-upload",
+		Usage:  "bytes per second sent to every peer by the chunk transferring protocols, 0 for no limit",
+		EnvVar: SwarmEnvBandwidthPeerUpload,
+	}
+	SwarmBandwidthPeerDownloadFlag = cli.Int64Flag{
+		Name:   "bandwidth-peer-download",
+		Usage:  "bytes per second received from every peer by the chunk transferring protocols, 0 for no limit",
+		EnvVar: SwarmEnvBandwidthPeerDownload,
+	}
+	SwarmPostageEnabledFlag = cli.BoolFlag{
+		Name:   "postage",
+		Usage:  "stamp uploads with postage batches and validate the postage stamps of synced chunks",
+		EnvVar: SwarmEnvPostageEnable,
+	}
+	SwarmPostageRequiredFlag = cli.BoolFlag{
+		Name:   "postage-required",
+		Usage:  "reject synced chunks without postage stamps",
+		EnvVar: SwarmEnvPostageRequired,
+	}
+	SwarmPostageIssuersFlag = cli.StringFlag{
+		Name:   "postage-issuers",
+		Usage:  "comma separated addresses of the owners of postage batches whose stamps are trusted",
+		EnvVar: SwarmEnvPostageIssuers,
+	}
+	SwarmIdentityCredentialFlag = cli.StringFlag{
+		Name:   "identity-credential",
+		Usage:  "hex encoded identity credential of the node issued by an authority of the private swarm",
+		EnvVar: SwarmEnvIdentityCredential,
+	}
+	SwarmIdentityAuthoritiesFlag = cli.StringFlag{
+		Name:   "identity-authorities",
+		Usage:  "comma separated addresses of the authorities whose identity credentials are trusted, only peers with trusted credentials are accepted if set",
+		EnvVar: SwarmEnvIdentityAuthorities,
+	}
+	SwarmIdentityRevocationListFlag = cli.StringFlag{
+		Name:   "identity-revocation-list",
+		Usage:  "path to the file with the hex encoded overlay addresses of revoked nodes, one per line, reloaded periodically",
+		EnvVar: SwarmEnvIdentityRevocationList,
+	}
+	SwarmNetworkKeyFlag = cli.StringFlag{
+		Name:   "network-key",
+		Usage:  "hex encoded pre-shared secret of a private swarm, peers without a MAC made with it are rejected",
+		EnvVar: SwarmEnvNetworkKey,
+	}
+	SwarmNetworkKeyPreviousFlag = cli.StringFlag{
+		Name:   "network-key-previous",
+		Usage:  "hex encoded network key being rotated out, presented and accepted during the grace period",
+		EnvVar: SwarmEnvNetworkKeyPrevious,
+	}
+	SwarmNetworkKeyGraceFlag = cli.DurationFlag{
+		Name:   "network-key-grace",
+		Usage:  "time after the start the previous network key is presented and accepted for",
+		Value:  api.DefaultNetworkKeyGrace,
+		EnvVar: SwarmEnvNetworkKeyGrace,
+	}
+	SwarmFailoverAddrFlag = cli.StringFlag{
+		Name:   "failover-addr",
+		Usage:  "listen address of the virtual endpoint of a failover pair (default :8600)",
+		EnvVar: SwarmEnvFailoverAddr,
+	}
+	SwarmFailoverPartnerFlag = cli.StringFlag{
+		Name:   "failover-partner",
+		Usage:  "URL of the virtual endpoint of the partner node, pairs the node as a warm standby failover pair",
+		EnvVar: SwarmEnvFailoverPartner,
+	}
+	SwarmFailoverPrimaryFlag = cli.BoolFlag{
+		Name:   "failover-primary",
+		Usage:  "serve the requests of the failover pair while the node is healthy",
+		EnvVar: SwarmEnvFailoverPrimary,
+	}
+	SwarmHandoverTimeoutFlag = cli.DurationFlag{
+		Name:   "handover-timeout",
+		Usage:  "time to wait for the new process to start and to be ready when the listening sockets are handed over to it on SIGUSR2",
+		Value:  handover.DefaultTimeout,
+		EnvVar: SwarmEnvHandoverTimeout,
+	}
 	SwarmNoSyncFlag = cli.BoolFlag{
 		Name:   "no-sync",
 		Usage:  "disable syncing",
 		EnvVar: SwarmNoSync,
 	}
+	SwarmSyncMinPOFlag = cli.IntFlag{
+		Name:   "sync-min-po",
+		Usage:  "lowest proximity order bin to pull sync",
+		EnvVar: SwarmEnvSyncMinPO,
+	}
+	SwarmSyncMaxPOFlag = cli.IntFlag{
+		Name:   "sync-max-po",
+		Usage:  "highest proximity order bin to pull sync (default no limit)",
+		EnvVar: SwarmEnvSyncMaxPO,
+	}
+	SwarmSyncTagsFlag = cli.StringFlag{
+		Name:   "sync-tags",
+		Usage:  "comma separated list of upload tag uids, only chunks uploaded with these tags are offered to peers",
+		EnvVar: SwarmEnvSyncTags,
+	}
 	SwarmSwapLogPathFlag = cli.StringFlag{
 		Name:   "swap-audit-logpath",
 		Usage:  "Write execution logs of swap audit to the given directory",
@@ -111,14 +269,49 @@ var (
 	}
 	SwarmLightNodeEnabled = cli.BoolFlag{
 		Name:   "lightnode",
-		Usage:  "Enable Swarm LightNode (default false)",
+		Usage:  "Enable Swarm LightNode, not storing chunks of the neighbourhood, switchable at runtime with bzz_setLightNode (default false)",
 		EnvVar: SwarmEnvLightNodeEnable,
 	}
+	SwarmNoPssRelayFlag = cli.BoolFlag{
+		Name:   "no-pss-relay",
+		Usage:  "Advertise to peers that pss messages addressed to other nodes are not forwarded",
+		EnvVar: SwarmEnvNoPssRelay,
+	}
+	SwarmNatRelayFlag = cli.BoolFlag{
+		Name:   "nat-relay",
+		Usage:  "Advertise to peers that the connections of nodes behind NATs are relayed, for publicly reachable nodes",
+		EnvVar: SwarmEnvNatRelay,
+	}
+	SwarmUnderlaysFlag = cli.StringSliceFlag{
+		Name:   "underlay",
+		Usage:  "Additional address the node is reachable on advertised to peers, e.g. over IPv6, can be repeated, format ip:port",
+		EnvVar: SwarmEnvUnderlays,
+	}
+	SwarmQuicAddrFlag = cli.StringFlag{
+		Name:   "quic-addr",
+		Usage:  "UDP address connections of peers over QUIC are accepted on, advertised to peers, format [ip]:port, requires a build with the quic tag",
+		EnvVar: SwarmEnvQuicAddr,
+	}
+	SwarmBridgeFlag = cli.BoolFlag{
+		Name:   "bridge",
+		Usage:  "Serve browsers joining as light peers over websocket on the /bridge path of the HTTP proxy",
+		EnvVar: SwarmEnvBridge,
+	}
+	SwarmBootnodesDNSFlag = cli.StringSliceFlag{
+		Name:   "bootnodes-dns",
+		Usage:  "DNS tree listing bootnodes dialed while the node has few peers, can be repeated, format enrtree://<key>@<domain>",
+		EnvVar: SwarmEnvBootnodesDNS,
+	}
 	EnsAPIFlag = cli.StringSliceFlag{
 		Name:   "ens-api",
 		Usage:  "ENS API endpoint for a TLD and with contract address, can be repeated, format [tld:][contract-addr@]url",
 		EnvVar: SwarmEnvENSAPI,
 	}
+	EnsCacheTTLFlag = cli.StringSliceFlag{
+		Name:   "ens-cache-ttl",
+		Usage:  "Duration names resolved with ENS are cached for, for a TLD or all TLDs without their own, can be repeated, format [tld:]duration",
+		EnvVar: SwarmEnvENSCacheTTL,
+	}
 	RnsAPIFlag = cli.StringFlag{
 		Name:   "rns-api",
 		Usage:  "RNS API endpoint for RKS domains contract address, format [contract-addr@]url",
@@ -129,6 +322,19 @@ var (
 		Usage: "Specifies the Swarm HTTP endpoint to connect to",
 		Value: "http://127.0.0.1:8500",
 	}
+	SwarmApiTokenFlag = cli.StringFlag{
+		Name:   "bzzapi-token",
+		Usage:  "API token sent to the Swarm HTTP endpoint if it requires authentication",
+		EnvVar: SwarmEnvAPIToken,
+	}
+	SwarmApiRetriesFlag = cli.IntFlag{
+		Name:  "bzzapi-retries",
+		Usage: "Number of retries of failed requests to the Swarm HTTP endpoint (default 3)",
+	}
+	SwarmApiTimeoutFlag = cli.DurationFlag{
+		Name:  "bzzapi-timeout",
+		Usage: "Timeout of every operation on the Swarm HTTP endpoint, replacing the default timeouts of the operations",
+	}
 	SwarmRecursiveFlag = cli.BoolFlag{
 		Name:  "recursive",
 		Usage: "Upload directories recursively",
@@ -141,6 +347,20 @@ var (
 		Name:  "defaultpath",
 		Usage: "path to file served for empty url path (none)",
 	}
+	SwarmUploadChunkingFlag = cli.StringFlag{
+		Name:  "chunking",
+		Usage: "chunking scheme of the upload: fixed or content-defined, which deduplicates shifted data",
+		Value: storage.ChunkingFixed,
+	}
+	SwarmUploadCompressionFlag = cli.StringFlag{
+		Name:  "compression",
+		Usage: "compression of the data chunks of the upload: none or snappy",
+		Value: storage.CompressionNone,
+	}
+	SwarmUploadBaseFlag = cli.StringFlag{
+		Name:  "base",
+		Usage: "manifest hash of a previous upload of the directory, only its changes are uploaded",
+	}
 	SwarmAccessGrantKeyFlag = cli.StringFlag{
 		Name:  "grant-key",
 		Usage: "grants a given public key access to an ACT",
@@ -161,6 +381,11 @@ var (
 		Name:  "encrypt",
 		Usage: "use encrypted upload",
 	}
+	SwarmEncryptionKeyFlag = cli.StringFlag{
+		Name:   "encryption-key",
+		Usage:  "Hex encoded master key or BIP-39 mnemonic the keys of the encrypted upload are derived from, so that the same content at the same path uploads to the same reference",
+		EnvVar: SwarmEnvEncryptionKey,
+	}
 	SwarmAccessPasswordFlag = cli.StringFlag{
 		Name:   "password",
 		Usage:  "Password",
@@ -191,6 +416,46 @@ var (
 		EnvVar: SwarmEnvStoreCacheCapacity,
 		Value:  10000,
 	}
+	SwarmMigrateLegacyDBFlag = cli.BoolFlag{
+		Name:   "migrate-legacy-db",
+		Usage:  "Migrate the chunk DB of a legacy release on start, keeping it as a backup in <store.path>.legacy",
+		EnvVar: SwarmEnvMigrateLegacyDB,
+	}
+	SwarmStoreBackendFlag = cli.StringFlag{
+		Name:   "store.backend",
+		Usage:  "Backend storing the data of chunks, leveldb or files (migrate with swarm db migrate-backend)",
+		EnvVar: SwarmEnvStoreBackend,
+	}
+	SwarmStoreHotCapacityFlag = cli.Uint64Flag{
+		Name:   "store.hot.size",
+		Usage:  "Number of chunks of store.size kept locally with a cold store (default half of store.size)",
+		EnvVar: SwarmEnvStoreHotCapacity,
+	}
+	SwarmColdStoreEndpointFlag = cli.StringFlag{
+		Name:   "store.cold.endpoint",
+		Usage:  "URL of the S3 compatible object storage the least recently accessed chunks are moved to",
+		EnvVar: SwarmEnvColdStoreEndpoint,
+	}
+	SwarmColdStoreBucketFlag = cli.StringFlag{
+		Name:   "store.cold.bucket",
+		Usage:  "Bucket of the cold store",
+		EnvVar: SwarmEnvColdStoreBucket,
+	}
+	SwarmColdStoreRegionFlag = cli.StringFlag{
+		Name:   "store.cold.region",
+		Usage:  "Region of the bucket of the cold store (default us-east-1)",
+		EnvVar: SwarmEnvColdStoreRegion,
+	}
+	SwarmColdStoreAccessKeyFlag = cli.StringFlag{
+		Name:   "store.cold.access-key",
+		Usage:  "Access key of the cold store",
+		EnvVar: SwarmEnvColdStoreAccessKey,
+	}
+	SwarmColdStoreSecretKeyFlag = cli.StringFlag{
+		Name:   "store.cold.secret-key",
+		Usage:  "Secret key of the cold store",
+		EnvVar: SwarmEnvColdStoreSecretKey,
+	}
 	SwarmCompressedFlag = cli.BoolFlag{
 		Name:  "compressed",
 		Usage: "Prints encryption keys in compressed form",
@@ -219,6 +484,10 @@ var (
 		Name:  "user",
 		Usage: "Indicates the user who updates the feed",
 	}
+	SwarmFeedAtFlag = cli.Uint64Flag{
+		Name:  "at",
+		Usage: "Unix time at which the node publishes the update, which is signed and scheduled in advance",
+	}
 	SwarmGlobalStoreAPIFlag = cli.StringFlag{
 		Name:   "globalstore-api",
 		Usage:  "URL of the Global Store API provider (only for testing)",
@@ -228,6 +497,39 @@ var (
 		Name:  "legacy",
 		Usage: "Use this flag when importing a db export from a legacy local store database dump (for schemas older than 'sanctuary')",
 	}
+	SwarmExportStreamFlag = cli.BoolFlag{
+		Name:  "stream",
+		Usage: "Export chunks in the length prefixed stream format, which keeps the pin counters and supports the export filters",
+	}
+	SwarmExportGzipFlag = cli.BoolFlag{
+		Name:  "gzip",
+		Usage: "Compress the stream export with gzip",
+	}
+	SwarmExportPinnedFlag = cli.BoolFlag{
+		Name:  "pinned",
+		Usage: "Export only pinned chunks",
+	}
+	SwarmExportMinPOFlag = cli.UintFlag{
+		Name:  "po.min",
+		Usage: "Export only chunks with at least this proximity order to the base key",
+	}
+	SwarmExportMaxPOFlag = cli.UintFlag{
+		Name:  "po.max",
+		Usage: "Export only chunks with at most this proximity order to the base key",
+		Value: chunk.MaxPO,
+	}
+	SwarmExportSinceFlag = cli.Int64Flag{
+		Name:  "since",
+		Usage: "Export only chunks stored at or after this Unix time in seconds",
+	}
+	SwarmVerifyRepairFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Fix the issues found by swarm db verify and move corrupted chunks to the quarantine index",
+	}
+	SwarmVerifyRateFlag = cli.IntFlag{
+		Name:  "rate",
+		Usage: "Number of chunks and index entries checked by swarm db verify per second (0 for unlimited)",
+	}
 	SwarmPinFlag = cli.BoolFlag{
 		Name:  "pin",
 		Usage: "Use this flag to pin the file after upload is complete. This flag is used when uploading a file.",
@@ -236,6 +538,145 @@ var (
 		Name:  "enable-pinning",
 		Usage: "Use this flag to enable the pinning feature",
 	}
+	SwarmPinningProviderFlag = cli.BoolFlag{
+		Name:  "pinning-provider",
+		Usage: "Use this flag to pin content on behalf of peers, requires --enable-pinning",
+	}
+	SwarmPinCheckIntervalFlag = cli.DurationFlag{
+		Name:   "pin-check-interval",
+		Usage:  "interval of the checks of the pins for orphaned chunks and broken pins, requires --enable-pinning (default: disabled)",
+		EnvVar: SwarmEnvPinCheckInterval,
+	}
+	SwarmPinCheckFixFlag = cli.BoolFlag{
+		Name:   "pin-check-fix",
+		Usage:  "unpin the orphaned chunks and fetch the broken pins found by the pin checks",
+		EnvVar: SwarmEnvPinCheckFix,
+	}
+	SwarmPinRepairIntervalFlag = cli.DurationFlag{
+		Name:   "pin-repair-interval",
+		Usage:  "interval of the rounds checking samples of the chunks of the pins for retrievability from the network and re-uploading the missing ones, requires --enable-pinning (default: disabled)",
+		EnvVar: SwarmEnvPinRepairInterval,
+	}
+	SwarmPinRepairSamplesFlag = cli.IntFlag{
+		Name:   "pin-repair-samples",
+		Usage:  "number of chunks of each pinned file checked per pin repair round",
+		Value:  pin.DefaultRepairSamples,
+		EnvVar: SwarmEnvPinRepairSamples,
+	}
+	SwarmDNSLinkFlag = cli.BoolFlag{
+		Name:   "dnslink",
+		Usage:  "Serve the content linked to the domains of the requests with swarmlink=/bzz:/<hash> TXT records",
+		EnvVar: SwarmEnvDNSLink,
+	}
+	SwarmZoneFlag = cli.StringFlag{
+		Name:   "zone",
+		Usage:  "Deployment zone of the node announced to peers, e.g. a datacenter",
+		EnvVar: SwarmEnvZone,
+	}
+	SwarmPreferZoneFlag = cli.BoolFlag{
+		Name:   "prefer-zone",
+		Usage:  "Retrieve chunks from peers in the same zone when peers are equally close to the chunk, requires --zone",
+		EnvVar: SwarmEnvPreferZone,
+	}
+	SwarmGatewayFlag = cli.BoolFlag{
+		Name:   "gateway",
+		Usage:  "Enforce the gateway policy on the clients of the HTTP API, the policy can be changed at runtime with the gateway admin RPC",
+		EnvVar: SwarmEnvGateway,
+	}
+	SwarmGatewayRateLimitFlag = cli.IntFlag{
+		Name:   "gateway-rate-limit",
+		Usage:  "requests a client IP can make to the gateway in a minute, requires --gateway (default: unlimited)",
+		EnvVar: SwarmEnvGatewayRateLimit,
+	}
+	SwarmGatewayMaxUploadSizeFlag = cli.Int64Flag{
+		Name:   "gateway-max-upload-size",
+		Usage:  "size in bytes of the largest upload accepted by the gateway, requires --gateway (default: unlimited)",
+		EnvVar: SwarmEnvGatewayMaxUploadSize,
+	}
+	SwarmGatewayBandwidthQuotaFlag = cli.Int64Flag{
+		Name:   "gateway-bandwidth-quota",
+		Usage:  "bytes a client IP can upload and download through the gateway in an hour, requires --gateway (default: unlimited)",
+		EnvVar: SwarmEnvGatewayBandwidthQuota,
+	}
+	SwarmGatewayBlockedTopicsFlag = cli.StringSliceFlag{
+		Name:   "gateway-blocked-topics",
+		Usage:  "pss topics rpc clients can not send or receive messages on, 0x prefixed hex or topic strings, requires --gateway",
+		EnvVar: SwarmEnvGatewayBlockedTopics,
+	}
+	SwarmGatewayNoAnonymousUploadFlag = cli.BoolFlag{
+		Name:   "gateway-no-anonymous-upload",
+		Usage:  "Accept only the uploads with one of the tokens given with --gateway-upload-tokens in the x-swarm-upload-token header, requires --gateway",
+		EnvVar: SwarmEnvGatewayNoAnonymous,
+	}
+	SwarmGatewayUploadTokensFlag = cli.StringSliceFlag{
+		Name:   "gateway-upload-tokens",
+		Usage:  "tokens authorizing uploads when anonymous uploads are not accepted",
+		EnvVar: SwarmEnvGatewayUploadTokens,
+	}
+	SwarmContentTypePipelineFlag = cli.StringSliceFlag{
+		Name:   "content-type-pipeline",
+		Usage:  "sources of the content types of files served over HTTP tried in order, of manifest, extension and content (default: manifest,extension,content)",
+		EnvVar: SwarmEnvContentTypePipeline,
+	}
+	SwarmContentTypeOverridesFlag = cli.StringSliceFlag{
+		Name:   "content-type-overrides",
+		Usage:  "content types replacing the detected ones of files served over HTTP, as type=replacement or .ext=type",
+		EnvVar: SwarmEnvContentTypeOverrides,
+	}
+	SwarmHTTPAuthFlag = cli.BoolFlag{
+		Name:   "http-auth",
+		Usage:  "Require API tokens minted with the auth admin RPC on the HTTP API, pss and admin tokens can use the RPC APIs on its /rpc endpoint",
+		EnvVar: SwarmEnvHTTPAuth,
+	}
+	SwarmQuotaFlag = cli.BoolFlag{
+		Name:   "quota",
+		Usage:  "Account the uploads of the API tokens to their accounts and hold them to their quota, requires --http-auth",
+		EnvVar: SwarmEnvQuota,
+	}
+	SwarmQuotaUploadFlag = cli.Int64Flag{
+		Name:   "quota-upload",
+		Usage:  "bytes an account can upload unless the quota admin RPC sets its own limits, requires --quota (default: unlimited)",
+		EnvVar: SwarmEnvQuotaUpload,
+	}
+	SwarmQuotaPinnedFlag = cli.Int64Flag{
+		Name:   "quota-pinned",
+		Usage:  "bytes of uploads an account can keep pinned unless the quota admin RPC sets its own limits, requires --quota (default: unlimited)",
+		EnvVar: SwarmEnvQuotaPinned,
+	}
+	SwarmNoPopularityFlag = cli.BoolFlag{
+		Name:   "no-popularity",
+		Usage:  "Disable counting the requests for served content",
+		EnvVar: SwarmEnvNoPopularity,
+	}
+	SwarmPopularityWindowFlag = cli.DurationFlag{
+		Name:   "popularity-window",
+		Usage:  "period over which the requests for served content are aggregated",
+		EnvVar: SwarmEnvPopularityWindow,
+		Value:  api.DefaultPopularityWindow,
+	}
+	SwarmPopularityThresholdFlag = cli.Uint64Flag{
+		Name:   "popularity-threshold",
+		Usage:  "number of requests in a window below which content is not reported",
+		EnvVar: SwarmEnvPopularityThreshold,
+		Value:  api.DefaultPopularityThreshold,
+	}
+	SwarmMetricsHistoryFlag = cli.BoolFlag{
+		Name:   "metrics-history",
+		Usage:  "Keep an in-memory history of the metrics queried with the metrics RPC, requires --metrics",
+		EnvVar: SwarmEnvMetricsHistory,
+	}
+	SwarmMetricsHistoryIntervalFlag = cli.DurationFlag{
+		Name:   "metrics-history-interval",
+		Usage:  "period between two samples of the metrics in the history",
+		EnvVar: SwarmEnvMetricsHistoryInterval,
+		Value:  history.DefaultInterval,
+	}
+	SwarmMetricsHistoryRetentionFlag = cli.DurationFlag{
+		Name:   "metrics-history-retention",
+		Usage:  "period over which the samples of the metrics are kept in the history",
+		EnvVar: SwarmEnvMetricsHistoryRetention,
+		Value:  history.DefaultRetention,
+	}
 	SwarmProgressFlag = cli.BoolFlag{
 		Name:  "progress",
 		Usage: "Use this flag to enable tracking of the upload progress through the CLI",
@@ -0,0 +1,112 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethersphere/swarm/handover"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// nodeHandover tracks the handover of the listening sockets to a new process
+type nodeHandover struct {
+	mtx     sync.Mutex
+	doneC   chan struct{} // closed when a handover the node was stopped for is done, nil if it was not stopped for one
+	resumed bool          // whether the node was restarted as the new process failed
+	err     error
+}
+
+// watchHandover hands the listening sockets over to a new process of the binary
+// on the handover signal: the sockets are duplicated and the binary is started
+// again with the same arguments, once it has started the node is stopped to flush
+// its state and release the data directory to the new process; the node keeps
+// serving if the new process fails to start and is restarted if it fails to get
+// ready. The listener of the devp2p server is not handed over
+func watchHandover(ctx *cli.Context, stack *node.Node) *nodeHandover {
+	h := &nodeHandover{}
+	if handoverSignal == nil {
+		return h
+	}
+	timeout := ctx.GlobalDuration(SwarmHandoverTimeoutFlag.Name)
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, handoverSignal)
+		defer signal.Stop(sigc)
+		for range sigc {
+			path, err := os.Executable()
+			if err != nil {
+				log.Error("could not find the binary to hand over to", "err", err)
+				continue
+			}
+			files, err := handover.Files()
+			if err != nil {
+				log.Error("could not duplicate the listening sockets", "err", err)
+				continue
+			}
+			log.Info("Handing the listening sockets over...", "binary", path, "listeners", len(files))
+			proc, err := handover.Start(path, os.Args[1:], files, timeout)
+			if err != nil {
+				log.Error("handover failed, still serving", "err", err)
+				continue
+			}
+			log.Info("Started the new process, shutting swarm down...", "pid", proc.Pid)
+			doneC := make(chan struct{})
+			h.mtx.Lock()
+			h.doneC = doneC
+			h.mtx.Unlock()
+			stack.Stop()
+			if err := proc.Release(timeout); err == nil {
+				log.Info("Handed the listening sockets over", "pid", proc.Pid)
+				close(doneC)
+				return
+			}
+			log.Error("handover failed, restarting swarm", "pid", proc.Pid, "err", err)
+			err = stack.Start()
+			h.mtx.Lock()
+			h.resumed, h.err = err == nil, err
+			h.mtx.Unlock()
+			close(doneC)
+			if err != nil {
+				log.Error("could not restart swarm", "err", err)
+				return
+			}
+		}
+	}()
+	return h
+}
+
+// wait waits for the handover to complete if the node was stopped for it, it
+// returns whether the node was restarted as the new process failed
+func (h *nodeHandover) wait() (resumed bool, err error) {
+	h.mtx.Lock()
+	doneC := h.doneC
+	h.mtx.Unlock()
+	if doneC == nil {
+		return false, nil
+	}
+	<-doneC
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	resumed, err = h.resumed, h.err
+	h.doneC, h.resumed, h.err = nil, false, nil
+	return resumed, err
+}
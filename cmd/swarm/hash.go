@@ -25,8 +25,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/contracts/ens"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/storage"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -37,7 +37,8 @@ var hashCommand = cli.Command{
 	Name:               "hash",
 	Usage:              "print the swarm hash of a file or directory",
 	ArgsUsage:          "<file>",
-	Description:        "Prints the swarm hash of file or directory",
+	Description:        "Prints the swarm hash of file or directory, the reference of its unencrypted raw upload with the same chunking and compression, without uploading it",
+	Flags:              []cli.Flag{SwarmUploadChunkingFlag, SwarmUploadCompressionFlag},
 	Subcommands: []cli.Command{
 		{
 			CustomHelpTemplate: helpTemplate,
@@ -77,10 +78,23 @@ func hash(ctx *cli.Context) {
 	}
 	defer f.Close()
 
-	stat, _ := f.Stat()
-	fileStore := storage.NewFileStore(&storage.FakeChunkStore{}, &storage.FakeChunkStore{}, storage.NewFileStoreParams(), chunk.NewTags())
+	hashCtx := context.TODO()
+	switch chunking := ctx.String(SwarmUploadChunkingFlag.Name); chunking {
+	case storage.ChunkingFixed:
+	case storage.ChunkingContentDefined:
+		hashCtx = sctx.SetContentDefinedChunking(hashCtx)
+	default:
+		utils.Fatalf("Invalid chunking scheme %q", chunking)
+	}
+	switch compression := ctx.String(SwarmUploadCompressionFlag.Name); compression {
+	case storage.CompressionNone:
+	case storage.CompressionSnappy:
+		hashCtx = sctx.SetCompression(hashCtx, compression)
+	default:
+		utils.Fatalf("Invalid compression %q", compression)
+	}
 
-	addr, _, err := fileStore.Store(context.TODO(), f, stat.Size(), false)
+	addr, err := storage.Hash(hashCtx, f)
 	if err != nil {
 		utils.Fatalf("%v\n", err)
 	} else {
@@ -0,0 +1,72 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Command identity issues identity credentials for nodes of private swarms.
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/network"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var identityCommand = cli.Command{
+	CustomHelpTemplate: helpTemplate,
+	Name:               "identity",
+	Usage:              "manage the identities of nodes of private swarms",
+	ArgsUsage:          "<sub command>",
+	Description:        "Manage the identity credentials verified in the handshake of private swarms",
+	Subcommands: []cli.Command{
+		{
+			Action:             issueCredential,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "issue",
+			Usage:              "issue the identity credential of a node",
+			ArgsUsage:          "<authority key file> <node id> <bzz key>",
+			Description:        "Prints the hex encoded identity credential of the node with the enode id and bzz key signed with the private key of the authority, to be set with --identity-credential on the node",
+		},
+	},
+}
+
+func issueCredential(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 3 {
+		utils.Fatalf("Usage: swarm identity issue <authority key file> <node id> <bzz key>")
+	}
+	key, err := crypto.LoadECDSA(args[0])
+	if err != nil {
+		utils.Fatalf("Error loading authority key: %v", err)
+	}
+	var id enode.ID
+	if err := id.UnmarshalText([]byte(args[1])); err != nil {
+		utils.Fatalf("Error parsing node id: %v", err)
+	}
+	overlay, err := hex.DecodeString(strings.TrimPrefix(args[2], "0x"))
+	if err != nil {
+		utils.Fatalf("Error parsing bzz key: %v", err)
+	}
+	credential, err := network.IssueCredential(key, id, overlay)
+	if err != nil {
+		utils.Fatalf("Error issuing credential: %v", err)
+	}
+	fmt.Println(hex.EncodeToString(credential))
+}
@@ -43,10 +43,12 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm"
 	bzzapi "github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/handover"
 	"github.com/ethersphere/swarm/internal/debug"
 	"github.com/ethersphere/swarm/internal/flags"
 	swarmmetrics "github.com/ethersphere/swarm/metrics"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/quic"
 	"github.com/ethersphere/swarm/storage/mock"
 	mockrpc "github.com/ethersphere/swarm/storage/mock/rpc"
 	"github.com/ethersphere/swarm/tracing"
@@ -144,8 +146,12 @@ func init() {
 		manifestCommand,
 		// See fs.go
 		fsCommand,
+		// See events.go
+		eventsCommand,
 		// See db.go
 		dbCommand,
+		// See identity.go
+		identityCommand,
 		// See config.go
 		DumpConfigCommand,
 		// hashesCommand
@@ -177,6 +183,7 @@ func init() {
 		// bzzd-specific flags
 		CorsStringFlag,
 		EnsAPIFlag,
+		EnsCacheTTLFlag,
 		RnsAPIFlag,
 		SwarmTomlConfigPathFlag,
 		//swap flags
@@ -184,6 +191,13 @@ func init() {
 		SwarmSwapBackendURLFlag,
 		SwarmSwapDisconnectThresholdFlag,
 		SwarmSwapPaymentThresholdFlag,
+		SwarmSwapTokensFlag,
+		SwarmSwapPriceOracleFlag,
+		SwarmSwapPricesFlag,
+		SwarmSwapPriceContractFlag,
+		SwarmSwapReferenceGasPriceFlag,
+		SwarmSwapPriceUpdateIntervalFlag,
+		SwarmSwapMaxPriceRatioFlag,
 		SwarmSwapLogPathFlag,
 		SwarmSwapLogLevelFlag,
 		SwarmSwapChequebookAddrFlag,
@@ -191,16 +205,77 @@ func init() {
 		SwarmSwapSkipDepositFlag,
 		SwarmSwapDepositAmountFlag,
 		// end of swap flags
+		//metering flags
+		SwarmMeteringEnabledFlag,
+		SwarmMeteringSoftLimitFlag,
+		SwarmMeteringRefreshRateFlag,
+		SwarmBandwidthUploadFlag,
+		SwarmBandwidthDownloadFlag,
+		SwarmBandwidthPeerUploadFlag,
+		SwarmBandwidthPeerDownloadFlag,
+		//postage flags
+		SwarmPostageEnabledFlag,
+		SwarmPostageRequiredFlag,
+		SwarmPostageIssuersFlag,
+		SwarmIdentityCredentialFlag,
+		SwarmIdentityAuthoritiesFlag,
+		SwarmIdentityRevocationListFlag,
+		SwarmNetworkKeyFlag,
+		SwarmNetworkKeyPreviousFlag,
+		SwarmNetworkKeyGraceFlag,
+		SwarmFailoverAddrFlag,
+		SwarmFailoverPartnerFlag,
+		SwarmFailoverPrimaryFlag,
+		SwarmHandoverTimeoutFlag,
 		SwarmNoSyncFlag,
+		SwarmSyncMinPOFlag,
+		SwarmSyncMaxPOFlag,
+		SwarmSyncTagsFlag,
 		SwarmLightNodeEnabled,
+		SwarmNoPssRelayFlag,
+		SwarmNatRelayFlag,
+		SwarmUnderlaysFlag,
+		SwarmQuicAddrFlag,
+		SwarmBridgeFlag,
+		SwarmBootnodesDNSFlag,
 		SwarmListenAddrFlag,
 		SwarmPortFlag,
 		SwarmAccountFlag,
 		SwarmBzzKeyHexFlag,
 		SwarmNetworkIdFlag,
 		SwarmEnablePinningFlag,
+		SwarmPinningProviderFlag,
+		SwarmPinCheckIntervalFlag,
+		SwarmPinCheckFixFlag,
+		SwarmPinRepairIntervalFlag,
+		SwarmPinRepairSamplesFlag,
+		SwarmDNSLinkFlag,
+		SwarmZoneFlag,
+		SwarmPreferZoneFlag,
+		SwarmGatewayFlag,
+		SwarmGatewayRateLimitFlag,
+		SwarmGatewayMaxUploadSizeFlag,
+		SwarmGatewayBandwidthQuotaFlag,
+		SwarmGatewayBlockedTopicsFlag,
+		SwarmGatewayNoAnonymousUploadFlag,
+		SwarmGatewayUploadTokensFlag,
+		SwarmContentTypePipelineFlag,
+		SwarmContentTypeOverridesFlag,
+		SwarmHTTPAuthFlag,
+		SwarmQuotaFlag,
+		SwarmQuotaUploadFlag,
+		SwarmQuotaPinnedFlag,
+		SwarmNoPopularityFlag,
+		SwarmPopularityWindowFlag,
+		SwarmPopularityThresholdFlag,
+		SwarmMetricsHistoryFlag,
+		SwarmMetricsHistoryIntervalFlag,
+		SwarmMetricsHistoryRetentionFlag,
 		// upload flags
 		SwarmApiFlag,
+		SwarmApiTokenFlag,
+		SwarmApiRetriesFlag,
+		SwarmApiTimeoutFlag,
 		SwarmRecursiveFlag,
 		SwarmWantManifestFlag,
 		SwarmUploadDefaultPath,
@@ -213,6 +288,14 @@ func init() {
 		SwarmStorePath,
 		SwarmStoreCapacity,
 		SwarmStoreCacheCapacity,
+		SwarmMigrateLegacyDBFlag,
+		SwarmStoreBackendFlag,
+		SwarmStoreHotCapacityFlag,
+		SwarmColdStoreEndpointFlag,
+		SwarmColdStoreBucketFlag,
+		SwarmColdStoreRegionFlag,
+		SwarmColdStoreAccessKeyFlag,
+		SwarmColdStoreSecretKeyFlag,
 		SwarmGlobalStoreAPIFlag,
 		// debugging
 		SwarmMutexProfileFlag,
@@ -333,6 +416,9 @@ func bzzd(ctx *cli.Context) error {
 	setSwarmBootstrapNodes(ctx, &cfg)
 	//setup the ethereum node
 	utils.SetNodeConfig(ctx, &cfg)
+	//the hive dials the bootnodes, rotating through them while the node has few peers
+	setSwarmBootnodeTrees(ctx, bzzconfig)
+	bzzconfig.Bootnodes = cfg.P2P.BootstrapNodes
 
 	//disable dynamic dialing from p2p/discovery
 	cfg.P2P.NoDial = true
@@ -340,6 +426,16 @@ func bzzd(ctx *cli.Context) error {
 	//optionally set the NAT IP from a network interface
 	setSwarmNATFromInterface(ctx, &cfg)
 
+	//optionally dial peers over QUIC, the server copies the dialer when the node is created
+	var transport *quic.Transport
+	if bzzconfig.QuicListenAddr != "" {
+		transport, err = quic.New(bzzconfig.QuicListenAddr)
+		if err != nil {
+			utils.Fatalf("can't create QUIC transport: %v", err)
+		}
+		cfg.P2P.Dialer = transport
+	}
+
 	stack, err := node.New(&cfg)
 	if err != nil {
 		utils.Fatalf("can't create node: %v", err)
@@ -353,9 +449,18 @@ func bzzd(ctx *cli.Context) error {
 		return err
 	}
 	//register BZZ as node.Service in the ethereum node
-	registerBzzService(bzzconfig, stack)
+	registerBzzService(bzzconfig, stack, transport)
+	//wait for the process the listening sockets were handed over from to release the data directory
+	if err := handover.Acquire(); err != nil {
+		utils.Fatalf("could not take the node over: %v", err)
+	}
 	//start the node
 	utils.StartNode(stack)
+	//signal the process the listening sockets were handed over from
+	if err := handover.Ready(); err != nil {
+		log.Error("could not complete the handover", "err", err)
+	}
+	h := watchHandover(ctx, stack)
 
 	go func() {
 		sigc := make(chan os.Signal, 1)
@@ -366,20 +471,16 @@ func bzzd(ctx *cli.Context) error {
 		stack.Stop()
 	}()
 
-	// add swarm bootnodes, because swarm doesn't use p2p package's discovery discv5
-	go func() {
-		s := stack.Server()
-
-		for _, n := range cfg.P2P.BootstrapNodes {
-			s.AddPeer(n)
+	for {
+		stack.Wait()
+		//the node is restarted if the process the sockets were handed over to failed
+		if resumed, err := h.wait(); !resumed {
+			return err
 		}
-	}()
-
-	stack.Wait()
-	return nil
+	}
 }
 
-func registerBzzService(bzzconfig *bzzapi.Config, stack *node.Node) {
+func registerBzzService(bzzconfig *bzzapi.Config, stack *node.Node, transport *quic.Transport) {
 	//define the swarm service boot function
 	boot := func(_ *node.ServiceContext) (node.Service, error) {
 		var nodeStore *mock.NodeStore
@@ -393,7 +494,14 @@ func registerBzzService(bzzconfig *bzzapi.Config, stack *node.Node) {
 			// create a node store for this swarm key on global store
 			nodeStore = globalStore.NewNodeStore(common.HexToAddress(bzzconfig.BzzKey))
 		}
-		return swarm.NewSwarm(bzzconfig, nodeStore)
+		s, err := swarm.NewSwarm(bzzconfig, nodeStore)
+		if err != nil {
+			return nil, err
+		}
+		if transport != nil {
+			s.SetQuic(transport)
+		}
+		return s, nil
 	}
 	//register within the ethereum node
 	if err := stack.Register(boot); err != nil {
@@ -583,6 +691,13 @@ func setSwarmBootstrapNodes(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+func setSwarmBootnodeTrees(ctx *cli.Context, config *bzzapi.Config) {
+	if ctx.GlobalIsSet(SwarmBootnodesDNSFlag.Name) || len(config.BootnodeTrees) > 0 {
+		return
+	}
+	config.BootnodeTrees = SwarmBootnodeTrees[config.NetworkID]
+}
+
 func setSwarmNATFromInterface(ctx *cli.Context, cfg *node.Config) {
 	ifacename := ctx.GlobalString(SwarmNATInterfaceFlag.Name)
 
@@ -90,7 +90,7 @@ func manifestAdd(ctx *cli.Context) {
 	)
 
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-	client := swarm.NewClient(bzzapi)
+	client := newClient(ctx, bzzapi)
 
 	m, _, err := client.DownloadManifest(hash)
 	if err != nil {
@@ -126,7 +126,7 @@ func manifestUpdate(ctx *cli.Context) {
 	)
 
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-	client := swarm.NewClient(bzzapi)
+	client := newClient(ctx, bzzapi)
 
 	m, _, err := client.DownloadManifest(hash)
 	if err != nil {
@@ -166,7 +166,7 @@ func manifestRemove(ctx *cli.Context) {
 	)
 
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
-	client := swarm.NewClient(bzzapi)
+	client := newClient(ctx, bzzapi)
 
 	newManifest := removeEntryFromManifest(client, mhash, path, toPin)
 	fmt.Println(newManifest)
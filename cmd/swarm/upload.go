@@ -34,6 +34,8 @@ import (
 	"github.com/ethersphere/swarm/api/client"
 	swarm "github.com/ethersphere/swarm/api/client"
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/encryption"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
 
@@ -48,7 +50,7 @@ var (
 		Name:               "up",
 		Usage:              "uploads a file or directory to swarm using the HTTP API",
 		ArgsUsage:          "<file>",
-		Flags:              []cli.Flag{SwarmEncryptedFlag, SwarmPinFlag, SwarmProgressFlag, SwarmVerboseFlag},
+		Flags:              []cli.Flag{SwarmEncryptedFlag, SwarmEncryptionKeyFlag, SwarmPinFlag, SwarmProgressFlag, SwarmVerboseFlag, SwarmUploadBaseFlag, SwarmUploadChunkingFlag, SwarmUploadCompressionFlag},
 		Description:        "uploads a file or directory to swarm using the HTTP API and prints the root hash",
 	}
 
@@ -74,14 +76,47 @@ func upload(ctx *cli.Context) {
 		fromStdin       = ctx.GlobalBool(SwarmUpFromStdinFlag.Name)
 		mimeType        = ctx.GlobalString(SwarmUploadMimeType.Name)
 		verbose         = ctx.Bool(SwarmVerboseFlag.Name)
-		client          = swarm.NewClient(bzzapi)
+		client          = newClient(ctx, bzzapi)
 		toEncrypt       = ctx.Bool(SwarmEncryptedFlag.Name)
 		toPin           = ctx.Bool(SwarmPinFlag.Name)
 		progress        = ctx.Bool(SwarmProgressFlag.Name)
 		anon            = ctx.Bool(SwarmAnonymousUploadFlag.Name)
+		base            = ctx.String(SwarmUploadBaseFlag.Name)
+		chunking        = ctx.String(SwarmUploadChunkingFlag.Name)
+		compression     = ctx.String(SwarmUploadCompressionFlag.Name)
+		encryptionKey   = ctx.String(SwarmEncryptionKeyFlag.Name)
 		autoDefaultPath = false
 		file            string
 	)
+	switch chunking {
+	case storage.ChunkingFixed:
+	case storage.ChunkingContentDefined:
+		if toEncrypt {
+			utils.Fatalf("Content-defined chunking can not be used with encryption")
+		}
+		client.Chunking = chunking
+	default:
+		utils.Fatalf("Invalid chunking scheme %q", chunking)
+	}
+	switch compression {
+	case storage.CompressionNone:
+	case storage.CompressionSnappy:
+		if toEncrypt {
+			utils.Fatalf("Compression can not be used with encryption")
+		}
+		client.Compression = compression
+	default:
+		utils.Fatalf("Invalid compression %q", compression)
+	}
+	if encryptionKey != "" {
+		if !toEncrypt {
+			utils.Fatalf("--%s requires --%s", SwarmEncryptionKeyFlag.Name, SwarmEncryptedFlag.Name)
+		}
+		if _, err := encryption.ParseMasterKey(encryptionKey); err != nil {
+			utils.Fatalf("Invalid encryption key: %v", err)
+		}
+		client.EncryptionKey = encryptionKey
+	}
 	if !verbose {
 		chunkStates = chunkStates[3:] // just poll Synced state
 	}
@@ -160,6 +195,13 @@ func upload(ctx *cli.Context) {
 					defaultPath = strings.TrimPrefix(absDefaultPath, absFile)
 				}
 			}
+			if base != "" {
+				// the base manifest determines whether the upload is encrypted
+				if toEncrypt {
+					return "", errors.New("--base can not be used with --encrypt")
+				}
+				return client.UploadDirectoryDiff(file, defaultPath, base, toPin, anon)
+			}
 			return client.UploadDirectory(file, defaultPath, "", toEncrypt, toPin, anon)
 		}
 	} else {
@@ -183,7 +225,8 @@ func upload(ctx *cli.Context) {
 	}
 
 	// dont show the progress bar if `progress` flag is not set
-	if !progress {
+	// or if there were no changes to upload to the base manifest
+	if !progress || hash == base {
 		fmt.Println(hash)
 		return
 	}
@@ -326,3 +369,17 @@ func homeDir() string {
 	}
 	return ""
 }
+
+// newClient creates a client of the Swarm HTTP endpoint sending the API token given with --bzzapi-token
+func newClient(ctx *cli.Context, bzzapi string) *swarm.Client {
+	c := swarm.NewClient(bzzapi)
+	c.Token = ctx.GlobalString(SwarmApiTokenFlag.Name)
+	if ctx.GlobalIsSet(SwarmApiRetriesFlag.Name) {
+		c.Policy.Retries = ctx.GlobalInt(SwarmApiRetriesFlag.Name)
+	}
+	if timeout := ctx.GlobalDuration(SwarmApiTimeoutFlag.Name); timeout > 0 {
+		c.Policy.Timeout = timeout
+		c.Policy.Timeouts = nil
+	}
+	return c
+}
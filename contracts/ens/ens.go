@@ -23,6 +23,7 @@ package ens
 
 import (
 	"encoding/binary"
+	"fmt"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -104,6 +105,11 @@ func EnsNode(name string) common.Hash {
 	return crypto.Keccak256Hash(parentNode[:], parentLabel[:])
 }
 
+// ReverseNode returns the node of the reverse record of an address.
+func ReverseNode(addr common.Address) common.Hash {
+	return EnsNode(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+}
+
 func (ens *ENS) getResolver(node [32]byte) (*contract.PublicResolverSession, error) {
 	resolverAddr, err := ens.Resolver(node)
 	if err != nil {
@@ -201,6 +207,33 @@ func (ens *ENS) Addr(name string) (common.Address, error) {
 	return common.BytesToAddress(ret[:]), nil
 }
 
+// ReverseResolve is a non-transactional call that returns the name in the reverse record of an address.
+// As anyone can claim any name in the reverse record of their address, the name is only returned
+// if it resolves to the address.
+func (ens *ENS) ReverseResolve(addr common.Address) (string, error) {
+	node := ReverseNode(addr)
+
+	resolver, err := ens.getResolver(node)
+	if err != nil {
+		return "", err
+	}
+	name, err := resolver.Name(node)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("no reverse record for %s", addr.Hex())
+	}
+	resolved, err := ens.Addr(name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != addr {
+		return "", fmt.Errorf("name %q of the reverse record of %s resolves to %s", name, addr.Hex(), resolved.Hex())
+	}
+	return name, nil
+}
+
 // SetAddress sets the address associated with a name. Only works if the caller
 // owns the name, and the associated resolver implements a `setAddress` function.
 func (ens *ENS) SetAddr(name string, addr common.Address) (*types.Transaction, error) {
@@ -18,6 +18,7 @@ package ens
 
 import (
 	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -124,3 +125,76 @@ func TestENS(t *testing.T) {
 		t.Fatalf("resolve error, expected %v, got %v", hash.Hex(), resolvedHash.Hex())
 	}
 }
+
+func TestReverseResolve(t *testing.T) {
+	contractBackend := backends.NewSimulatedBackend(core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}}, 10000000)
+	transactOpts := bind.NewKeyedTransactor(key)
+
+	ensAddr, ens, err := DeployENS(transactOpts, contractBackend)
+	if err != nil {
+		t.Fatalf("can't deploy root registry: %v", err)
+	}
+	contractBackend.Commit()
+
+	// Own the name and the reverse node of our address.
+	if _, err := ens.Register(name); err != nil {
+		t.Fatalf("can't register: %v", err)
+	}
+	if _, err := ens.Register("reverse"); err != nil {
+		t.Fatalf("can't register: %v", err)
+	}
+	contractBackend.Commit()
+	if _, err := ens.SetSubnodeOwner(EnsNode("reverse"), crypto.Keccak256Hash([]byte("addr")), addr); err != nil {
+		t.Fatalf("can't set subnode owner: %v", err)
+	}
+	contractBackend.Commit()
+	if _, err := ens.SetSubnodeOwner(EnsNode("addr.reverse"), crypto.Keccak256Hash([]byte(strings.ToLower(addr.Hex()[2:]))), addr); err != nil {
+		t.Fatalf("can't set subnode owner: %v", err)
+	}
+	contractBackend.Commit()
+
+	// Deploy a resolver and make it responsible for both nodes.
+	resolverAddr, _, _, err := contract.DeployPublicResolver(transactOpts, contractBackend, ensAddr)
+	if err != nil {
+		t.Fatalf("can't deploy resolver: %v", err)
+	}
+	if _, err := ens.SetResolver(EnsNode(name), resolverAddr); err != nil {
+		t.Fatalf("can't set resolver: %v", err)
+	}
+	if _, err := ens.SetResolver(ReverseNode(addr), resolverAddr); err != nil {
+		t.Fatalf("can't set resolver: %v", err)
+	}
+	contractBackend.Commit()
+
+	resolver, err := contract.NewPublicResolver(resolverAddr, contractBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.SetName(transactOpts, ReverseNode(addr), name); err != nil {
+		t.Fatalf("can't set name: %v", err)
+	}
+	contractBackend.Commit()
+
+	// The name does not resolve to the address yet.
+	if _, err := ens.ReverseResolve(addr); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	if _, err = ens.SetAddr(name, addr); err != nil {
+		t.Fatalf("can't set address: %v", err)
+	}
+	contractBackend.Commit()
+
+	reverseName, err := ens.ReverseResolve(addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reverseName != name {
+		t.Fatalf("reverse resolve error, expected %q, got %q", name, reverseName)
+	}
+
+	// An address without a reverse record does not resolve.
+	if _, err := ens.ReverseResolve(testAddr); err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
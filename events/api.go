@@ -0,0 +1,68 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/subscription"
+)
+
+// APIVersion is the textual version number of the events API
+const APIVersion = "1.0"
+
+// API exposes the events of the bus as RPC subscriptions
+type API struct {
+	bus *Bus
+}
+
+// NewAPI creates the events API of the bus
+func NewAPI(bus *Bus) *API {
+	return &API{
+		bus: bus,
+	}
+}
+
+// Events is an RPC subscription sending the events of the types, all types if none given.
+// The optional opts select the buffering of the notifications for slow clients.
+func (a *API) Events(ctx context.Context, types []Type, opts *subscription.Options) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	n, err := subscription.New(notifier, sub, opts, subscription.DropNewest)
+	if err != nil {
+		return nil, err
+	}
+	s := a.bus.Subscribe(types...)
+	go func() {
+		defer s.Unsubscribe()
+		for {
+			select {
+			case e := <-s.Events():
+				if err := n.Notify(e); err != nil {
+					return
+				}
+			case <-n.Closed():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package events is the bus the typed events of the node lifecycle and of the
+// protocols are published on, so that monitoring and the CLI can follow them
+// instead of scraping logs. Producers publish events without waiting for the
+// subscribers, events are dropped for subscribers not keeping up.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Type is the type of an event, selecting the type of its data
+type Type string
+
+// event types
+const (
+	PeerAdded     Type = "peer-added"     // a peer connected, PeerData
+	PeerDropped   Type = "peer-dropped"   // a peer disconnected, PeerData
+	DepthChanged  Type = "depth-changed"  // the neighbourhood depth changed, DepthData
+	GCRun         Type = "gc-run"         // a garbage collection run completed, GCData
+	ChequeBounced Type = "cheque-bounced" // a cashed cheque bounced, ChequeData
+	SyncStalled   Type = "sync-stalled"   // a sync batch timed out, SyncData
+)
+
+// DefaultBufferSize is the number of events buffered for a subscriber
+const DefaultBufferSize = 64
+
+var droppedCount = metrics.NewRegisteredCounter("events/dropped", nil)
+
+// Event is an event of the node
+type Event struct {
+	Type Type        `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// PeerData is the data of the PeerAdded and PeerDropped events
+type PeerData struct {
+	Peer   string `json:"peer"`             // enode id of the peer
+	Reason string `json:"reason,omitempty"` // why the peer was dropped
+}
+
+// DepthData is the data of the DepthChanged event
+type DepthData struct {
+	Depth    int `json:"depth"`
+	Previous int `json:"previous"`
+}
+
+// GCData is the data of the GCRun event
+type GCData struct {
+	Collected uint64        `json:"collected"` // number of chunks removed
+	Size      uint64        `json:"size"`      // number of garbage collectable chunks left
+	Duration  time.Duration `json:"duration"`
+}
+
+// ChequeData is the data of the ChequeBounced event
+type ChequeData struct {
+	Chequebook  string `json:"chequebook"`  // address of the chequebook which issued the cheque
+	Beneficiary string `json:"beneficiary"` // address the cheque was paid to
+	Transaction string `json:"transaction"` // hash of the cashing transaction
+}
+
+// SyncData is the data of the SyncStalled event
+type SyncData struct {
+	Peer   string `json:"peer"`   // enode id of the peer
+	Stream string `json:"stream"` // stream of the batch
+}
+
+// Bus delivers the published events to the subscribers
+// A nil Bus drops the events, so producers do not need to check whether one is set.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events of the types it is subscribed to
+type Subscription struct {
+	bus   *Bus
+	types map[Type]bool // all types if empty
+	c     chan Event
+	once  sync.Once
+}
+
+// Subscribe returns a subscription to the events of the types, all types if none given
+func (b *Bus) Subscribe(types ...Type) *Subscription {
+	s := &Subscription{
+		bus:   b,
+		types: make(map[Type]bool, len(types)),
+		c:     make(chan Event, DefaultBufferSize),
+	}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Events returns the channel the events are received on, closed on Unsubscribe
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Unsubscribe stops the delivery of the events and closes the events channel
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// Publish delivers an event of the type with the data to the subscribers of the type
+func (b *Bus) Publish(t Type, data interface{}) {
+	if b == nil {
+		return
+	}
+	e := Event{
+		Type: t,
+		Time: time.Now(),
+		Data: data,
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if len(s.types) > 0 && !s.types[t] {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			droppedCount.Inc(1)
+		}
+	}
+}
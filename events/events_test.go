@@ -0,0 +1,134 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TestBus tests that the events are delivered to the subscribers of their types
+// and that a nil bus drops them
+func TestBus(t *testing.T) {
+	var nilBus *Bus
+	nilBus.Publish(GCRun, nil)
+
+	b := NewBus()
+	all := b.Subscribe()
+	defer all.Unsubscribe()
+	peers := b.Subscribe(PeerAdded, PeerDropped)
+	defer peers.Unsubscribe()
+
+	b.Publish(GCRun, &GCData{Collected: 1})
+	b.Publish(PeerDropped, &PeerData{Peer: "peer", Reason: "reason"})
+
+	for _, want := range []Type{GCRun, PeerDropped} {
+		if e := <-all.Events(); e.Type != want {
+			t.Fatalf("got event %s, want %s", e.Type, want)
+		}
+	}
+	e := <-peers.Events()
+	if e.Type != PeerDropped {
+		t.Fatalf("got event %s, want %s", e.Type, PeerDropped)
+	}
+	if d, ok := e.Data.(*PeerData); !ok || d.Reason != "reason" {
+		t.Fatalf("got data %#v, want peer data with the reason", e.Data)
+	}
+	select {
+	case e := <-peers.Events():
+		t.Fatalf("got unexpected event %s", e.Type)
+	default:
+	}
+
+	// events are dropped for subscribers not keeping up
+	for i := 0; i < DefaultBufferSize+1; i++ {
+		b.Publish(GCRun, nil)
+	}
+	if n := len(all.Events()); n != DefaultBufferSize {
+		t.Fatalf("got %d buffered events, want %d", n, DefaultBufferSize)
+	}
+
+	// the events channel is closed on unsubscribe after the buffered events
+	all.Unsubscribe()
+	b.Publish(GCRun, nil)
+	n := 0
+	for range all.Events() {
+		n++
+	}
+	if n != DefaultBufferSize {
+		t.Fatalf("got %d events after unsubscribe, want %d", n, DefaultBufferSize)
+	}
+}
+
+// TestAPIEvents tests the RPC subscription to the events
+func TestAPIEvents(t *testing.T) {
+	b := NewBus()
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("admin", NewAPI(b)); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	c := make(chan json.RawMessage)
+	sub, err := client.Subscribe(context.Background(), "admin", c, "events", []Type{DepthChanged}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// wait for the subscription of the bus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.RLock()
+		n := len(b.subs)
+		b.mu.RUnlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the subscription")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Publish(GCRun, &GCData{})
+	b.Publish(DepthChanged, &DepthData{Depth: 3, Previous: 2})
+
+	select {
+	case msg := <-c:
+		var e struct {
+			Type Type
+			Data DepthData
+		}
+		if err := json.Unmarshal(msg, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != DepthChanged || e.Data.Depth != 3 || e.Data.Previous != 2 {
+			t.Fatalf("got event %s", msg)
+		}
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the event")
+	}
+}
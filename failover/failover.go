@@ -0,0 +1,279 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package failover pairs two gateway nodes as a warm standby failover pair.
+//
+// Each node of the pair serves a virtual endpoint that proxies gateway requests to
+// the primary node while it is healthy and to the standby node otherwise, so clients
+// can use the endpoint of either node. The nodes check the health of each other and
+// replicate the state needed to serve the same content: pins, the address book and
+// the latest known feed updates.
+package failover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/handover"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pinservice"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// ForwardedHeaderName is set on requests forwarded to the partner node,
+// which serves them with its local gateway
+const ForwardedHeaderName = "x-swarm-failover-forwarded"
+
+// default listen address, intervals and thresholds
+const (
+	DefaultListenAddr          = ":8600"
+	DefaultHealthInterval      = 5 * time.Second
+	DefaultReplicationInterval = time.Minute
+	DefaultFailureThreshold    = 3
+)
+
+var (
+	servedLocal   = metrics.NewRegisteredCounter("failover/served/local", nil)
+	servedPartner = metrics.NewRegisteredCounter("failover/served/partner", nil)
+	failovers     = metrics.NewRegisteredCounter("failover/failovers", nil)
+)
+
+// Params configures a node of a failover pair
+type Params struct {
+	ListenAddr          string        // listen address of the virtual endpoint
+	Gateway             string        // URL of the HTTP gateway of the node
+	Partner             string        // URL of the virtual endpoint of the partner node
+	Primary             bool          // whether requests are served by this node while it is healthy
+	HealthInterval      time.Duration // interval of the health checks of the partner
+	ReplicationInterval time.Duration // interval of the state replication from the partner
+	FailureThreshold    int           // failed health checks before the partner is considered down
+}
+
+// NewParams returns the default parameters
+func NewParams() *Params {
+	return &Params{
+		ListenAddr:          DefaultListenAddr,
+		HealthInterval:      DefaultHealthInterval,
+		ReplicationInterval: DefaultReplicationInterval,
+		FailureThreshold:    DefaultFailureThreshold,
+	}
+}
+
+// Node is a node of a failover pair
+type Node struct {
+	params   *Params
+	gateway  *url.URL
+	partner  *url.URL
+	kad      *network.Kademlia
+	pinAPI   *pin.API             // nil if pinning is disabled
+	pinner   *pinservice.Provider // fetches and pins the pins of the partner, nil if pinning is disabled
+	feeds    *feed.Handler
+	client   *http.Client
+	local    *httputil.ReverseProxy
+	remote   *httputil.ReverseProxy
+	mtx      sync.RWMutex
+	failures int  // consecutive failed health checks of the partner
+	healthy  bool // whether the gateway of the node passed the last health check
+	server   *http.Server
+	quit     chan struct{}
+}
+
+// New creates a node of a failover pair replicating the address book of the kademlia,
+// the pins of the pin API and the feed updates of the feed handler
+func New(params *Params, kad *network.Kademlia, pinAPI *pin.API, pinner *pinservice.Provider, feeds *feed.Handler) (*Node, error) {
+	gateway, err := url.Parse(params.Gateway)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gateway url: %v", err)
+	}
+	partner, err := url.Parse(params.Partner)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partner url: %v", err)
+	}
+	n := &Node{
+		params:  params,
+		gateway: gateway,
+		partner: partner,
+		kad:     kad,
+		pinAPI:  pinAPI,
+		pinner:  pinner,
+		feeds:   feeds,
+		client:  &http.Client{Timeout: params.HealthInterval},
+		local:   httputil.NewSingleHostReverseProxy(gateway),
+		remote:  httputil.NewSingleHostReverseProxy(partner),
+		healthy: true,
+		quit:    make(chan struct{}),
+	}
+	director := n.remote.Director
+	n.remote.Director = func(r *http.Request) {
+		director(r)
+		r.Header.Set(ForwardedHeaderName, "true")
+	}
+	return n, nil
+}
+
+// Start starts serving the virtual endpoint and checking the partner
+func (n *Node) Start() error {
+	listener, err := handover.Listen("tcp", n.params.ListenAddr, "failover")
+	if err != nil {
+		return err
+	}
+	n.server = &http.Server{Handler: n}
+	go func() {
+		if err := n.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("failover endpoint failed", "err", err)
+		}
+	}()
+	go n.loop()
+	log.Info("failover endpoint started", "addr", listener.Addr(), "partner", n.partner, "primary", n.params.Primary)
+	return nil
+}
+
+// Stop stops the virtual endpoint
+func (n *Node) Stop() error {
+	close(n.quit)
+	if n.server == nil {
+		return nil
+	}
+	return n.server.Close()
+}
+
+// loop checks the health of the partner and replicates its state
+func (n *Node) loop() {
+	health := time.NewTicker(n.params.HealthInterval)
+	defer health.Stop()
+	replication := time.NewTicker(n.params.ReplicationInterval)
+	defer replication.Stop()
+	for {
+		select {
+		case <-health.C:
+			n.checkGateway()
+			n.checkPartner()
+		case <-replication.C:
+			if !n.PartnerHealthy() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), n.params.ReplicationInterval)
+			if err := n.replicate(ctx); err != nil {
+				log.Warn("failover state replication failed", "partner", n.partner, "err", err)
+			}
+			cancel()
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+// checkPartner checks the health of the partner and counts the consecutive failures
+func (n *Node) checkPartner() {
+	err := n.check(n.partner, "/failover/health")
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if err == nil {
+		if n.failures >= n.params.FailureThreshold {
+			log.Info("failover partner recovered", "partner", n.partner)
+		}
+		n.failures = 0
+		return
+	}
+	n.failures++
+	if n.failures == n.params.FailureThreshold {
+		log.Warn("failover partner down", "partner", n.partner, "err", err)
+		failovers.Inc(1)
+	}
+}
+
+// checkGateway checks the health of the gateway of the node
+func (n *Node) checkGateway() {
+	err := n.check(n.gateway, "/robots.txt")
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if err != nil && n.healthy {
+		log.Warn("failover gateway down", "gateway", n.gateway, "err", err)
+	}
+	n.healthy = err == nil
+}
+
+// PartnerHealthy returns whether the partner passed any of its recent health checks
+func (n *Node) PartnerHealthy() bool {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	return n.failures < n.params.FailureThreshold
+}
+
+// Healthy returns whether the gateway of the node passed its last health check
+func (n *Node) Healthy() bool {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	return n.healthy
+}
+
+// check requests the path on the base url and expects a successful response
+func (n *Node) check(base *url.URL, path string) error {
+	res, err := n.client.Get(strings.TrimSuffix(base.String(), "/") + path)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// ServeHTTP serves the failover endpoints and proxies all other requests
+// to the gateway of the active node
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/failover/health":
+		if !n.Healthy() {
+			http.Error(w, "gateway unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	case "/failover/state":
+		n.serveState(w, r)
+		return
+	}
+	if r.Header.Get(ForwardedHeaderName) == "" && n.forward() {
+		servedPartner.Inc(1)
+		n.remote.ServeHTTP(w, r)
+		return
+	}
+	servedLocal.Inc(1)
+	n.local.ServeHTTP(w, r)
+}
+
+// forward returns whether requests are forwarded to the partner: the standby forwards
+// to the primary while it is healthy, the primary forwards only if it is unhealthy itself
+func (n *Node) forward() bool {
+	if !n.PartnerHealthy() {
+		return false
+	}
+	if n.params.Primary {
+		return !n.Healthy()
+	}
+	return true
+}
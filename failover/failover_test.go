@@ -0,0 +1,166 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package failover
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethersphere/swarm/network"
+)
+
+// testGateway is a gateway responding with its name that can be taken down
+type testGateway struct {
+	name string
+	down int32
+}
+
+func (g *testGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&g.down) == 1 {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte(g.name))
+}
+
+// TestFailover tests that requests to both virtual endpoints are served by the
+// primary while it is healthy and by the standby otherwise
+func TestFailover(t *testing.T) {
+	primaryGateway := &testGateway{name: "primary"}
+	standbyGateway := &testGateway{name: "standby"}
+	primaryGatewayServer := httptest.NewServer(primaryGateway)
+	defer primaryGatewayServer.Close()
+	standbyGatewayServer := httptest.NewServer(standbyGateway)
+	defer standbyGatewayServer.Close()
+
+	var primary, standby *Node
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary.ServeHTTP(w, r)
+	}))
+	defer primaryServer.Close()
+	standbyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		standby.ServeHTTP(w, r)
+	}))
+	defer standbyServer.Close()
+
+	primary = newTestNode(t, primaryGatewayServer.URL, standbyServer.URL, true)
+	standby = newTestNode(t, standbyGatewayServer.URL, primaryServer.URL, false)
+	check := func() {
+		primary.checkGateway()
+		standby.checkGateway()
+		primary.checkPartner()
+		standby.checkPartner()
+	}
+
+	check()
+	expectServedBy(t, primaryServer.URL, "primary")
+	expectServedBy(t, standbyServer.URL, "primary")
+
+	// the primary gateway goes down
+	atomic.StoreInt32(&primaryGateway.down, 1)
+	check()
+	if primary.Healthy() || !standby.Healthy() {
+		t.Fatal("expected the primary to be unhealthy and the standby healthy")
+	}
+	expectServedBy(t, primaryServer.URL, "standby")
+	expectServedBy(t, standbyServer.URL, "standby")
+
+	// the primary gateway recovers
+	atomic.StoreInt32(&primaryGateway.down, 0)
+	check()
+	expectServedBy(t, primaryServer.URL, "primary")
+	expectServedBy(t, standbyServer.URL, "primary")
+}
+
+// TestReplicate tests that the address book of the partner is replicated
+func TestReplicate(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	partnerAddr := network.RandomBzzAddr()
+	partnerKad := network.NewKademlia(partnerAddr.Over(), network.NewKadParams())
+	peers := []*network.BzzAddr{network.RandomBzzAddr(), network.RandomBzzAddr()}
+	// the address book of the partner includes the node itself
+	if err := partnerKad.Register(append(peers, addr)...); err != nil {
+		t.Fatal(err)
+	}
+
+	partner, err := New(&Params{Gateway: "http://localhost", Partner: "http://localhost"}, partnerKad, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partnerServer := httptest.NewServer(partner)
+	defer partnerServer.Close()
+
+	n, err := New(&Params{Gateway: "http://localhost", Partner: partnerServer.URL}, kad, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.replicate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	known := make(map[string]bool)
+	kad.EachAddr(nil, 256, func(a *network.BzzAddr, _ int) bool {
+		known[string(a.Over())] = true
+		return true
+	})
+	if len(known) != len(peers) {
+		t.Fatalf("expected %d peers, got %d", len(peers), len(known))
+	}
+	for _, p := range peers {
+		if !known[string(p.Over())] {
+			t.Fatalf("expected peer %s to be replicated", p)
+		}
+	}
+}
+
+func newTestNode(t *testing.T, gateway, partner string, primary bool) *Node {
+	t.Helper()
+
+	params := NewParams()
+	params.Gateway = gateway
+	params.Partner = partner
+	params.Primary = primary
+	params.FailureThreshold = 1
+	addr := network.RandomBzzAddr()
+	n, err := New(params, network.NewKademlia(addr.Over(), network.NewKadParams()), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func expectServedBy(t *testing.T, endpoint, name string) {
+	t.Helper()
+
+	res, err := http.Get(endpoint + "/bzz:/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != name {
+		t.Fatalf("expected request to %s to be served by the %s, got %q", endpoint, name, body)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package failover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pinservice"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// State is the state replicated between the nodes of a failover pair
+type State struct {
+	Pins  []pin.PinInfo      `json:"pins,omitempty"`
+	Peers []*network.BzzAddr `json:"peers,omitempty"`
+	Feeds []feed.ID          `json:"feeds,omitempty"`
+}
+
+// State returns the replicated state of the node
+func (n *Node) State() (*State, error) {
+	s := &State{}
+	if n.pinAPI != nil {
+		pins, err := n.pinAPI.ListPins()
+		if err != nil {
+			return nil, err
+		}
+		s.Pins = pins
+	}
+	n.kad.EachAddr(nil, 256, func(addr *network.BzzAddr, _ int) bool {
+		s.Peers = append(s.Peers, addr)
+		return true
+	})
+	if n.feeds != nil {
+		s.Feeds = n.feeds.Latest()
+	}
+	return s, nil
+}
+
+// serveState serves the replicated state to the partner
+func (n *Node) serveState(w http.ResponseWriter, r *http.Request) {
+	s, err := n.State()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// replicate retrieves the state of the partner and applies it
+func (n *Node) replicate(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(n.partner.String(), "/")+"/failover/state", nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	var s State
+	if err := json.NewDecoder(res.Body).Decode(&s); err != nil {
+		return err
+	}
+	return n.apply(ctx, &s)
+}
+
+// apply merges the state of the partner into the state of the node. Peers are added
+// to the address book, missing pins are fetched and pinned in the background and
+// the cached feed updates are brought up to date. Nothing is removed.
+func (n *Node) apply(ctx context.Context, s *State) error {
+	var peers []*network.BzzAddr
+	for _, addr := range s.Peers {
+		if !bytes.Equal(addr.Over(), n.kad.BaseAddr()) {
+			peers = append(peers, addr)
+		}
+	}
+	if len(peers) > 0 {
+		if err := n.kad.Register(peers...); err != nil {
+			return err
+		}
+	}
+
+	if n.pinner != nil {
+		for _, p := range s.Pins {
+			status, _ := n.pinner.Status(p.Address)
+			if status == pinservice.StatusUnknown || status == pinservice.StatusFailed {
+				log.Debug("failover: pinning partner pin", "root", p.Address)
+				n.pinner.Pin(p.Address, p.IsRaw)
+			}
+		}
+	}
+
+	if n.feeds != nil {
+		latest := make(map[feed.Feed]uint64)
+		for _, id := range n.feeds.Latest() {
+			latest[id.Feed] = id.Epoch.Time
+		}
+		for _, id := range s.Feeds {
+			if t, ok := latest[id.Feed]; ok && t >= id.Epoch.Time {
+				continue
+			}
+			if _, err := n.feeds.Lookup(ctx, feed.NewQueryLatest(&id.Feed, id.Epoch)); err != nil {
+				log.Debug("failover: feed lookup failed", "feed", id.Feed.Hex(), "err", err)
+			}
+		}
+	}
+	return nil
+}
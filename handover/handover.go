@@ -0,0 +1,359 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package handover hands the listening sockets of a node over to a new process
+// of the node, so that the binary can be upgraded without refusing connections.
+//
+// The old process duplicates the sockets of its listeners and starts the new process,
+// which inherits the sockets as file descriptors named in the environment. Once the
+// new process signals it has started, the old one stops to flush its state and release
+// the data directory, which the new process waits for. Connections arriving in the
+// meantime wait in the backlog of the sockets until the new process has reloaded the
+// state and accepts them. If the new process fails to start, the old one keeps serving.
+//
+// Only the listeners opened with Listen are handed over. The listener of the devp2p
+// server is not, so that peers dialing the node while it restarts are refused, and
+// the sessions of the server are closed, the new process reconnects to the peers
+// persisted in the address book.
+package handover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+)
+
+// environment variables of the new process naming the inherited file descriptors
+const (
+	EnvListeners = "SWARM_HANDOVER_LISTENERS" // comma separated name=fd pairs of the listeners
+	EnvReady     = "SWARM_HANDOVER_READY"     // fd of the pipe the new process signals its start and readiness on
+	EnvRelease   = "SWARM_HANDOVER_RELEASE"   // fd of the pipe closed by the old process once it stopped
+)
+
+// DefaultTimeout is the default time the old process waits for the new one to start and to be ready
+const DefaultTimeout = time.Minute
+
+// ErrNotReady is returned if the new process exits or times out before it is started or ready
+var ErrNotReady = errors.New("new process is not ready")
+
+var (
+	mu        sync.Mutex
+	listeners = make(map[string]*listener) // open listeners by name
+
+	inheritOnce sync.Once
+	inherited   map[string]net.Listener // listeners inherited from the old process by name
+	inheritErr  error
+
+	readyOnce sync.Once
+	readyPipe *os.File // pipe the start and readiness are signalled on, nil if not handed over
+	readyErr  error
+)
+
+// listener unregisters itself when closed
+type listener struct {
+	net.Listener
+	name string
+}
+
+// Close closes the listener and stops handing it over
+func (l *listener) Close() error {
+	mu.Lock()
+	if listeners[l.name] == l {
+		delete(listeners, l.name)
+	}
+	mu.Unlock()
+	return l.Listener.Close()
+}
+
+// Listen returns the listener with the name inherited from the old process if
+// there is one, otherwise it announces on the local network address;
+// the listener is handed over to the next process until it is closed
+func Listen(network, addr, name string) (net.Listener, error) {
+	inheritOnce.Do(inherit)
+	if inheritErr != nil {
+		return nil, inheritErr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := inherited[name]
+	if ok {
+		delete(inherited, name)
+		log.Info("inherited listener", "name", name, "addr", l.Addr())
+	} else {
+		var err error
+		l, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hl := &listener{Listener: l, name: name}
+	listeners[name] = hl
+	return hl, nil
+}
+
+// inherit parses the listeners handed over by the old process
+func inherit() {
+	inherited = make(map[string]net.Listener)
+	env := os.Getenv(EnvListeners)
+	if env == "" {
+		return
+	}
+	for _, pair := range strings.Split(env, ",") {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			inheritErr = fmt.Errorf("handover: invalid listener %q", pair)
+			return
+		}
+		name := pair[:i]
+		fd, err := strconv.Atoi(pair[i+1:])
+		if err != nil {
+			inheritErr = fmt.Errorf("handover: invalid descriptor of listener %s: %v", name, err)
+			return
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			inheritErr = fmt.Errorf("handover: listener %s: %v", name, err)
+			return
+		}
+		inherited[name] = l
+	}
+}
+
+// Files returns duplicates of the sockets of the open listeners by name,
+// which stay open when the listeners are closed
+func Files() (map[string]*os.File, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	files := make(map[string]*os.File, len(listeners))
+	for name, l := range listeners {
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, fmt.Errorf("handover: listener %s has no file descriptor", name)
+		}
+		f, err := filer.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("handover: listener %s: %v", name, err)
+		}
+		files[name] = f
+	}
+	return files, nil
+}
+
+// Process is the new process the listening sockets are handed over to
+type Process struct {
+	*os.Process
+	release  *os.File   // closed once the old process stopped
+	signalC  chan error // signals of the new process, an error once the pipe is closed
+	signalsR *os.File
+}
+
+// Start starts the new process with the arguments, handing it the sockets, and waits
+// until it has started, the process is killed if it does not start within the timeout;
+// the files are closed in the old process
+func Start(path string, args []string, files map[string]*os.File, timeout time.Duration) (*Process, error) {
+	defer closeFiles(files)
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	releaseR, releaseW, err := os.Pipe()
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// inherited descriptors are numbered from 3, after stdin, stdout and stderr
+	var extra []*os.File
+	var pairs []string
+	for i, name := range names {
+		extra = append(extra, files[name])
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, 3+i))
+	}
+	extra = append(extra, w, releaseR)
+
+	var env []string
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, EnvListeners+"=") && !strings.HasPrefix(v, EnvReady+"=") && !strings.HasPrefix(v, EnvRelease+"=") {
+			env = append(env, v)
+		}
+	}
+	env = append(env,
+		EnvListeners+"="+strings.Join(pairs, ","),
+		fmt.Sprintf("%s=%d", EnvReady, 3+len(names)),
+		fmt.Sprintf("%s=%d", EnvRelease, 4+len(names)),
+	)
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extra
+	err = cmd.Start()
+	w.Close()
+	releaseR.Close()
+	if err != nil {
+		r.Close()
+		releaseW.Close()
+		return nil, err
+	}
+
+	p := &Process{
+		Process:  cmd.Process,
+		release:  releaseW,
+		signalC:  make(chan error, 2),
+		signalsR: r,
+	}
+	go func() {
+		// the pipe is closed without a byte if the new process exits before signalling
+		buf := make([]byte, 1)
+		for i := 0; i < 2; i++ {
+			if _, err := r.Read(buf); err != nil {
+				p.signalC <- err
+				return
+			}
+			p.signalC <- nil
+		}
+	}()
+	if err := p.wait(timeout); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Release signals the new process that the old one stopped and released the node,
+// and waits until the new process is ready, it is killed if it is not ready within the timeout
+func (p *Process) Release(timeout time.Duration) error {
+	p.release.Close()
+	err := p.wait(timeout)
+	if err == nil {
+		p.signalsR.Close()
+	}
+	return err
+}
+
+// wait waits for the next signal of the new process, killing it if it does not signal in time
+func (p *Process) wait(timeout time.Duration) error {
+	select {
+	case err := <-p.signalC:
+		if err == nil {
+			return nil
+		}
+	case <-time.After(timeout):
+	}
+	p.Kill()
+	p.release.Close()
+	p.signalsR.Close()
+	// reap the process so that it does not linger as a zombie
+	go p.Process.Wait()
+	return ErrNotReady
+}
+
+// Acquire signals the old process that the new one has started and waits until the old
+// process has stopped, releasing the data directory of the node; it is a noop if the
+// process was not handed over
+func Acquire() error {
+	pipe, err := signalPipe()
+	if pipe == nil || err != nil {
+		return err
+	}
+	if _, err := pipe.Write([]byte{1}); err != nil {
+		return err
+	}
+	env := os.Getenv(EnvRelease)
+	os.Unsetenv(EnvRelease)
+	fd, err := strconv.Atoi(env)
+	if err != nil {
+		return fmt.Errorf("handover: invalid descriptor of release pipe: %v", err)
+	}
+	f := os.NewFile(uintptr(fd), "release")
+	defer f.Close()
+	// the old process closes the pipe once it has stopped, or when it exits
+	_, err = f.Read(make([]byte, 1))
+	if err != io.EOF {
+		return fmt.Errorf("handover: waiting for the release: %v", err)
+	}
+	return nil
+}
+
+// Ready signals the old process that the new one is ready and closes the inherited
+// listeners that were not claimed, it is a noop if the process was not handed over
+func Ready() error {
+	inheritOnce.Do(inherit)
+	mu.Lock()
+	for name, l := range inherited {
+		log.Warn("closing unused inherited listener", "name", name, "addr", l.Addr())
+		l.Close()
+		delete(inherited, name)
+	}
+	mu.Unlock()
+
+	pipe, err := signalPipe()
+	if pipe == nil || err != nil {
+		return err
+	}
+	defer pipe.Close()
+	_, err = pipe.Write([]byte{1})
+	return err
+}
+
+// signalPipe returns the pipe the new process signals the old one on, nil if the process
+// was not handed over
+func signalPipe() (*os.File, error) {
+	readyOnce.Do(func() {
+		env := os.Getenv(EnvReady)
+		if env == "" {
+			return
+		}
+		os.Unsetenv(EnvReady)
+		fd, err := strconv.Atoi(env)
+		if err != nil {
+			readyErr = fmt.Errorf("handover: invalid descriptor of ready pipe: %v", err)
+			return
+		}
+		readyPipe = os.NewFile(uintptr(fd), "ready")
+	})
+	return readyPipe, readyErr
+}
+
+// closeFiles closes the duplicated sockets, restoring the non-blocking mode of the
+// sockets shared with the listeners, which is cleared when they are passed to a process
+func closeFiles(files map[string]*os.File) {
+	for _, f := range files {
+		setNonblock(f)
+		f.Close()
+	}
+}
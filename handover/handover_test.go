@@ -0,0 +1,175 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package handover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const helperEnv = "SWARM_HANDOVER_TEST_HELPER"
+
+// TestHandover tests that a request made while no process accepts connections
+// is served by the new process the listener is handed over to, which starts
+// serving only once the old process released it
+func TestHandover(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("http://%s/", l.Addr())
+	files, err := Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files["http"] == nil {
+		t.Fatalf("expected the http listener, got %v", files)
+	}
+
+	os.Setenv(helperEnv, "serve")
+	defer os.Unsetenv(helperEnv)
+	proc, err := Start(os.Args[0], []string{"-test.run=TestHandoverHelper"}, files, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Wait()
+
+	// the old process stops accepting, the socket stays open through the duplicate
+	l.Close()
+	if files, err := Files(); err != nil || len(files) != 0 {
+		t.Fatalf("expected no listeners after close, got %v %v", files, err)
+	}
+
+	type response struct {
+		body string
+		err  error
+	}
+	respC := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			respC <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		respC <- response{string(body), err}
+	}()
+
+	if err := proc.Release(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case resp := <-respC:
+		if resp.err != nil {
+			t.Fatal(resp.err)
+		}
+		if resp.body != "new" {
+			t.Fatalf("expected the new process to respond, got %q", resp.body)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the response")
+	}
+}
+
+// TestHandoverFailed tests that the old process keeps its listener if the new
+// process exits before it started
+func TestHandoverFailed(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	files, err := Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(helperEnv, "fail")
+	defer os.Unsetenv(helperEnv)
+	if _, err := Start(os.Args[0], []string{"-test.run=TestHandoverHelper"}, files, 10*time.Second); err != ErrNotReady {
+		t.Fatalf("expected %v, got %v", ErrNotReady, err)
+	}
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("old"))
+	}))
+	resp, err := http.Get(fmt.Sprintf("http://%s/", l.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "old" {
+		t.Fatalf("expected the old process to respond, got %q", body)
+	}
+}
+
+// TestHandoverHelper is the new process of TestHandover and TestHandoverFailed, it
+// either exits before it started or serves a single request once it is released
+func TestHandoverHelper(t *testing.T) {
+	switch os.Getenv(helperEnv) {
+	case "":
+		t.Skip("run by TestHandover")
+	case "fail":
+		os.Exit(1)
+	}
+	if err := Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen("tcp", "127.0.0.1:0", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	servedC := make(chan struct{})
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+		close(servedC)
+	}))
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-servedC:
+		// let the response be written before the process exits
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the request")
+	}
+}
+
+// TestReadyWithoutHandover tests that Acquire and Ready are noops in a process that
+// was not handed over
+func TestReadyWithoutHandover(t *testing.T) {
+	if os.Getenv(helperEnv) != "" {
+		t.Skip("run by TestHandover")
+	}
+	if err := Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
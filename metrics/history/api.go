@@ -0,0 +1,59 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"time"
+)
+
+// Textual version number of the metrics history API
+const APIVersion = "1.0"
+
+// API provides the recorded history of the metrics over RPC
+type API struct {
+	recorder *Recorder
+}
+
+// NewAPI creates a new API
+func NewAPI(recorder *Recorder) *API {
+	return &API{
+		recorder: recorder,
+	}
+}
+
+// Series returns the names of the recorded series
+func (a *API) Series() []string {
+	return a.recorder.Names()
+}
+
+// Query returns the samples of the series taken between the from and to unix
+// timestamps in seconds, 0 leaves the range open on that side
+func (a *API) Query(name string, from, to int64) ([]Sample, error) {
+	var fromTime, toTime time.Time
+	if from > 0 {
+		fromTime = time.Unix(from, 0)
+	}
+	if to > 0 {
+		toTime = time.Unix(to, 0)
+	}
+	return a.recorder.Query(name, fromTime, toTime)
+}
+
+// Since returns the samples of the series taken in the last ago seconds
+func (a *API) Since(name string, ago uint64) ([]Sample, error) {
+	return a.recorder.Query(name, a.recorder.now().Add(-time.Duration(ago)*time.Second), time.Time{})
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package history keeps a short in-memory history of metrics series
+// of the node, so what happened in the recent past can be looked up
+// over RPC without an external metrics stack.
+package history
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// DefaultInterval is the period between two samples of a series
+	DefaultInterval = time.Minute
+	// DefaultRetention is the period over which the samples of a series are kept
+	DefaultRetention = 24 * time.Hour
+	// maxSeries bounds the number of series recorded
+	maxSeries = 1000
+)
+
+// DefaultSeries are the name prefixes of the series recorded by default
+var DefaultSeries = []string{
+	"stack/",
+	"system/",
+	"datadir/",
+	"api/http/",
+	"http/",
+	"network/stream/",
+	"network/retrieve/",
+	"network/custody/",
+	"pusher/",
+	"netstore/",
+	"pss/",
+	"postage/",
+	"swap/",
+}
+
+// ErrUnknownSeries is returned when a queried series is not recorded
+var ErrUnknownSeries = errors.New("unknown series")
+
+// Sample is the value of a series at a time
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Recorder samples the metrics of a registry periodically into fixed size
+// ring buffers, one for each series with a name matching one of the prefixes.
+// Counters and gauges are recorded with their values, meters with their one
+// minute rates and timers and histograms with their means. Resetting timers
+// are left out as taking their snapshots would reset them for the reporters.
+type Recorder struct {
+	registry metrics.Registry
+	interval time.Duration
+	size     int
+	prefixes []string
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	series map[string]*ring
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRecorder creates a Recorder keeping the samples of the series of the registry
+// with names matching the prefixes taken every interval for the retention period.
+func NewRecorder(registry metrics.Registry, interval, retention time.Duration, prefixes []string) *Recorder {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	size := int(retention / interval)
+	if size < 1 {
+		size = 1
+	}
+	return &Recorder{
+		registry: registry,
+		interval: interval,
+		size:     size,
+		prefixes: prefixes,
+		now:      time.Now,
+		series:   make(map[string]*ring),
+	}
+}
+
+// Start starts sampling the series every interval
+func (r *Recorder) Start() {
+	r.quit = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Record()
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sampling the series
+func (r *Recorder) Stop() {
+	if r.quit == nil {
+		return
+	}
+	close(r.quit)
+	r.wg.Wait()
+	r.quit = nil
+}
+
+// Record takes a sample of every recorded series
+func (r *Recorder) Record() {
+	t := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registry.Each(func(name string, m interface{}) {
+		if !r.matches(name) {
+			return
+		}
+		v, ok := value(m)
+		if !ok {
+			return
+		}
+		s, ok := r.series[name]
+		if !ok {
+			if len(r.series) >= maxSeries {
+				return
+			}
+			s = newRing(r.size)
+			r.series[name] = s
+		}
+		s.add(Sample{Time: t, Value: v})
+	})
+}
+
+// Names returns the sorted names of the recorded series
+func (r *Recorder) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.series))
+	for name := range r.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query returns the samples of the series taken between from and to inclusive,
+// oldest first, a zero from or to leaves the range open on that side
+func (r *Recorder) Query(name string, from, to time.Time) ([]Sample, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.series[name]
+	if !ok {
+		return nil, ErrUnknownSeries
+	}
+	samples := []Sample{}
+	s.each(func(sample Sample) {
+		if !from.IsZero() && sample.Time.Before(from) {
+			return
+		}
+		if !to.IsZero() && sample.Time.After(to) {
+			return
+		}
+		samples = append(samples, sample)
+	})
+	return samples, nil
+}
+
+func (r *Recorder) matches(name string) bool {
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value sampled of a metric
+func value(m interface{}) (float64, bool) {
+	switch m := m.(type) {
+	case metrics.Counter:
+		return float64(m.Count()), true
+	case metrics.Gauge:
+		return float64(m.Value()), true
+	case metrics.GaugeFloat64:
+		return m.Value(), true
+	case metrics.Meter:
+		return m.Snapshot().Rate1(), true
+	case metrics.Timer:
+		return m.Snapshot().Mean(), true
+	case metrics.Histogram:
+		return m.Snapshot().Mean(), true
+	}
+	return 0, false
+}
+
+// ring is a fixed size buffer of samples overwriting the oldest when full
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func newRing(size int) *ring {
+	return &ring{
+		samples: make([]Sample, size),
+	}
+}
+
+func (r *ring) add(s Sample) {
+	r.samples[r.next] = s
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// each calls f with the samples oldest first
+func (r *ring) each(f func(Sample)) {
+	if r.full {
+		for _, s := range r.samples[r.next:] {
+			f(s)
+		}
+	}
+	for _, s := range r.samples[:r.next] {
+		f(s)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// TestRecorder checks that the matching series are sampled and that only
+// the samples of the retention period are kept
+func TestRecorder(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := metrics.NewCounterForced()
+	registry.Register("pusher/sent", counter)
+	gauge := &metrics.StandardGauge{}
+	registry.Register("stack/uptime", gauge)
+	registry.Register("eth/ignored", metrics.NewCounterForced())
+
+	r := NewRecorder(registry, time.Minute, 3*time.Minute, []string{"pusher/", "stack/"})
+	now := time.Unix(1000000, 0)
+	r.now = func() time.Time { return now }
+
+	for i := 1; i <= 5; i++ {
+		counter.Inc(1)
+		gauge.Update(int64(10 * i))
+		r.Record()
+		now = now.Add(time.Minute)
+	}
+
+	names := r.Names()
+	if len(names) != 2 || names[0] != "pusher/sent" || names[1] != "stack/uptime" {
+		t.Fatalf("got series %v", names)
+	}
+
+	samples, err := r.Query("pusher/sent", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(samples))
+	}
+	for i, s := range samples {
+		if s.Value != float64(i+3) {
+			t.Fatalf("sample %d: got value %v, want %v", i, s.Value, i+3)
+		}
+		if want := time.Unix(1000000, 0).Add(time.Duration(i+2) * time.Minute); !s.Time.Equal(want) {
+			t.Fatalf("sample %d: got time %v, want %v", i, s.Time, want)
+		}
+	}
+
+	from := time.Unix(1000000, 0).Add(3 * time.Minute)
+	samples, err = r.Query("stack/uptime", from, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Value != 40 {
+		t.Fatalf("got samples %v", samples)
+	}
+
+	if _, err := r.Query("eth/ignored", time.Time{}, time.Time{}); err != ErrUnknownSeries {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownSeries)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network/dnsdisc"
+)
+
+var (
+	// BootnodeInterval is the time between the rounds of dials of bootnodes
+	BootnodeInterval = 30 * time.Second
+	// BootnodesPerRound is the number of bootnodes dialed in a round
+	BootnodesPerRound = 2
+	// BootnodeMinPeers is the number of connected peers below which bootnodes are dialed
+	BootnodeMinPeers = 4
+	// BootnodeMaxFailures is the number of failed dials in a row after which a bootnode is set aside
+	BootnodeMaxFailures = 3
+	// BootnodeRetryDelay is the time a bootnode set aside is not dialed for
+	BootnodeRetryDelay = 10 * time.Minute
+	// BootnodeRefresh is the time between the resolutions of the DNS trees of bootnodes
+	BootnodeRefresh = 30 * time.Minute
+	// BootnodeResolveTimeout is the time a DNS tree of bootnodes must be resolved in
+	BootnodeResolveTimeout = 30 * time.Second
+)
+
+// BootnodeStats is the health of a bootnode
+type BootnodeStats struct {
+	Enode       string    `json:"enode"`
+	Source      string    `json:"source"`   // "static" or the URL of the DNS tree the node is listed in
+	Dials       int       `json:"dials"`    // number of dials of the node
+	Failures    int       `json:"failures"` // number of failed dials in a row
+	LastDial    time.Time `json:"lastDial"`
+	LastSuccess time.Time `json:"lastSuccess"`
+}
+
+type bootnode struct {
+	node *enode.Node
+	BootnodeStats
+	checked bool // whether the outcome of the last dial is accounted
+}
+
+// Bootnodes dials bootnodes while the node has few peers, rotating through the static
+// bootnodes and those listed in DNS trees (see the dnsdisc package), and setting aside
+// for a while the ones failing the dials
+type Bootnodes struct {
+	static  []*enode.Node
+	trees   []string
+	resolve func(ctx context.Context, url string) ([]*enode.Node, error)
+
+	// set on start by the hive
+	dial      func(*enode.Node)
+	peers     func() int
+	connected func(enode.ID) bool
+
+	mu       sync.Mutex
+	nodes    []*bootnode // in the order dialed
+	next     int         // index of the node dialed next
+	resolved time.Time   // when the trees were last resolved
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBootnodes creates Bootnodes of the static nodes and the nodes listed in the DNS trees
+// with the enrtree:// URLs
+func NewBootnodes(static []*enode.Node, trees []string) *Bootnodes {
+	b := &Bootnodes{
+		static:  static,
+		trees:   trees,
+		resolve: dnsdisc.NewClient(nil).SyncTree,
+	}
+	b.update(nil)
+	return b
+}
+
+// start dials the bootnodes in rounds until stopped
+func (b *Bootnodes) start(dial func(*enode.Node), peers func() int, connected func(enode.ID) bool) {
+	b.dial, b.peers, b.connected = dial, peers, connected
+	b.quit = make(chan struct{})
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(BootnodeInterval)
+		defer ticker.Stop()
+		for {
+			b.round()
+			select {
+			case <-ticker.C:
+			case <-b.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (b *Bootnodes) stop() {
+	close(b.quit)
+	b.wg.Wait()
+}
+
+// round resolves the trees if they are due, accounts the outcome of the dials of the
+// last round and dials the next bootnodes if the node has too few peers
+func (b *Bootnodes) round() {
+	if len(b.trees) > 0 && time.Since(b.resolved) > BootnodeRefresh {
+		b.resolveTrees()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, n := range b.nodes {
+		if b.connected(n.node.ID()) {
+			n.Failures = 0
+			n.LastSuccess = time.Now()
+			n.checked = true
+			continue
+		}
+		if !n.checked {
+			n.Failures++
+			n.checked = true
+			if n.Failures == BootnodeMaxFailures {
+				metrics.GetOrRegisterCounter("network/bootnodes/setaside", nil).Inc(1)
+				log.Warn("bootnode set aside after failed dials", "enode", n.Enode, "source", n.Source, "failures", n.Failures)
+			}
+		}
+	}
+
+	if b.peers() >= BootnodeMinPeers {
+		return
+	}
+	dialed := 0
+	for i := 0; i < len(b.nodes) && dialed < BootnodesPerRound; i++ {
+		n := b.nodes[b.next]
+		b.next = (b.next + 1) % len(b.nodes)
+		if b.connected(n.node.ID()) {
+			continue
+		}
+		if n.Failures >= BootnodeMaxFailures && time.Since(n.LastDial) < BootnodeRetryDelay {
+			continue
+		}
+		log.Debug("dialing bootnode", "enode", n.Enode, "source", n.Source)
+		metrics.GetOrRegisterCounter("network/bootnodes/dial", nil).Inc(1)
+		n.Dials++
+		n.LastDial = time.Now()
+		n.checked = false
+		b.dial(n.node)
+		dialed++
+	}
+}
+
+// resolveTrees resolves the nodes of the DNS trees, keeping the nodes of the trees failing to resolve
+func (b *Bootnodes) resolveTrees() {
+	resolved := make(map[string][]*enode.Node)
+	for _, url := range b.trees {
+		ctx, cancel := context.WithTimeout(context.Background(), BootnodeResolveTimeout)
+		nodes, err := b.resolve(ctx, url)
+		cancel()
+		if err != nil {
+			metrics.GetOrRegisterCounter("network/bootnodes/resolve/fail", nil).Inc(1)
+			log.Warn("could not resolve bootnode tree", "url", url, "err", err)
+			continue
+		}
+		log.Debug("resolved bootnode tree", "url", url, "nodes", len(nodes))
+		resolved[url] = nodes
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resolved = time.Now()
+	b.update(resolved)
+}
+
+// update sets the nodes to the static ones and the ones of the trees, keeping their stats,
+// the nodes of trees missing from resolved are kept; nodes not reachable over TCP are skipped
+// caller must hold the lock
+func (b *Bootnodes) update(resolved map[string][]*enode.Node) {
+	old := make(map[enode.ID]*bootnode)
+	for _, n := range b.nodes {
+		old[n.node.ID()] = n
+	}
+	var nodes []*bootnode
+	seen := make(map[enode.ID]bool)
+	add := func(n *enode.Node, source string) {
+		if n == nil || seen[n.ID()] || n.IP() == nil || n.TCP() == 0 {
+			return
+		}
+		seen[n.ID()] = true
+		if bn, ok := old[n.ID()]; ok {
+			bn.node, bn.Enode = n, n.URLv4()
+			nodes = append(nodes, bn)
+			return
+		}
+		nodes = append(nodes, &bootnode{
+			node:          n,
+			BootnodeStats: BootnodeStats{Enode: n.URLv4(), Source: source},
+			checked:       true,
+		})
+	}
+	for _, n := range b.static {
+		add(n, "static")
+	}
+	for _, url := range b.trees {
+		if ns, ok := resolved[url]; ok {
+			for _, n := range ns {
+				add(n, url)
+			}
+			continue
+		}
+		for _, bn := range b.nodes {
+			if bn.Source == url {
+				add(bn.node, url)
+			}
+		}
+	}
+	b.nodes = nodes
+	if b.next >= len(nodes) {
+		b.next = 0
+	}
+}
+
+// Stats returns the health of the bootnodes in the order they are dialed
+func (b *Bootnodes) Stats() []BootnodeStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make([]BootnodeStats, len(b.nodes))
+	for i, n := range b.nodes {
+		stats[i] = n.BootnodeStats
+	}
+	return stats
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// testBootnodes wires bootnodes to a fake server connecting the nodes in up when dialed
+type testBootnodes struct {
+	*Bootnodes
+	up        map[enode.ID]bool // nodes accepting dials
+	connected map[enode.ID]bool
+	peers     int
+	dialed    []*enode.Node
+}
+
+func newTestBootnodes(static []*enode.Node, trees []string, resolve func(context.Context, string) ([]*enode.Node, error)) *testBootnodes {
+	b := NewBootnodes(nil, trees)
+	b.static = static
+	b.resolve = resolve
+	b.update(nil)
+	tb := &testBootnodes{
+		Bootnodes: b,
+		up:        make(map[enode.ID]bool),
+		connected: make(map[enode.ID]bool),
+	}
+	b.dial = func(n *enode.Node) {
+		tb.dialed = append(tb.dialed, n)
+		if tb.up[n.ID()] {
+			tb.connected[n.ID()] = true
+		}
+	}
+	b.peers = func() int { return tb.peers + len(tb.connected) }
+	b.connected = func(id enode.ID) bool { return tb.connected[id] }
+	return tb
+}
+
+// round runs a round of dials and returns the nodes dialed
+func (tb *testBootnodes) round() []*enode.Node {
+	tb.dialed = nil
+	tb.Bootnodes.round()
+	return tb.dialed
+}
+
+func newTestNodes(t *testing.T, n int) []*enode.Node {
+	nodes := make([]*enode.Node, n)
+	for i := range nodes {
+		nodes[i] = enode.NewV4(&newTestKey(t).PublicKey, net.IP{10, 0, 0, byte(i + 1)}, 30399, 30399)
+	}
+	return nodes
+}
+
+func checkDialed(t *testing.T, dialed []*enode.Node, want ...*enode.Node) {
+	t.Helper()
+	if len(dialed) != len(want) {
+		t.Fatalf("expected %d nodes dialed, got %d", len(want), len(dialed))
+	}
+	for i := range want {
+		if dialed[i].ID() != want[i].ID() {
+			t.Fatalf("expected node %d dialed to be %s, got %s", i, want[i].URLv4(), dialed[i].URLv4())
+		}
+	}
+}
+
+// TestBootnodesRotation checks that bootnodes are dialed in rotation while the node has few peers
+// and are set aside after failing dials
+func TestBootnodesRotation(t *testing.T) {
+	defer func(n, f int) { BootnodesPerRound, BootnodeMaxFailures = n, f }(BootnodesPerRound, BootnodeMaxFailures)
+	BootnodesPerRound = 2
+	BootnodeMaxFailures = 2
+
+	nodes := newTestNodes(t, 3)
+	tb := newTestBootnodes(nodes, nil, nil)
+
+	checkDialed(t, tb.round(), nodes[0], nodes[1])
+	checkDialed(t, tb.round(), nodes[2], nodes[0])
+	// nodes[0] fails its second dial and is set aside, nodes[1] connects
+	tb.up[nodes[1].ID()] = true
+	checkDialed(t, tb.round(), nodes[1], nodes[2])
+	stats := tb.Stats()
+	if stats[0].Failures != 2 || stats[0].Dials != 2 {
+		t.Fatalf("expected 2 dials and 2 failures of the first node, got %+v", stats[0])
+	}
+
+	// nodes[2] is set aside too and connected nodes are not dialed
+	checkDialed(t, tb.round())
+	stats = tb.Stats()
+	if stats[1].Failures != 0 || stats[1].LastSuccess.IsZero() {
+		t.Fatalf("expected the second node to be healthy, got %+v", stats[1])
+	}
+
+	// nodes set aside are dialed again after the retry delay
+	defer func(d time.Duration) { BootnodeRetryDelay = d }(BootnodeRetryDelay)
+	BootnodeRetryDelay = 0
+	checkDialed(t, tb.round(), nodes[0], nodes[2])
+
+	// no dials with enough peers
+	tb.peers = BootnodeMinPeers
+	checkDialed(t, tb.round())
+}
+
+// TestBootnodesTrees checks that the nodes of DNS trees are dialed after the static ones,
+// and kept when the trees fail to resolve
+func TestBootnodesTrees(t *testing.T) {
+	defer func(n int) { BootnodesPerRound = n }(BootnodesPerRound)
+	BootnodesPerRound = 4
+
+	nodes := newTestNodes(t, 3)
+	fail := false
+	resolve := func(_ context.Context, url string) ([]*enode.Node, error) {
+		if fail {
+			return nil, errors.New("no such host")
+		}
+		// nodes[0] is listed both statically and in the tree
+		return nodes, nil
+	}
+	tb := newTestBootnodes(nodes[:1], []string{"enrtree://tree"}, resolve)
+
+	checkDialed(t, tb.round(), nodes...)
+	stats := tb.Stats()
+	if stats[0].Source != "static" || stats[1].Source != "enrtree://tree" {
+		t.Fatalf("unexpected sources of bootnodes: %+v", stats)
+	}
+
+	fail = true
+	tb.resolved = tb.resolved.Add(-2 * BootnodeRefresh)
+	checkDialed(t, tb.round(), nodes...)
+	if stats = tb.Stats(); stats[2].Dials != 2 {
+		t.Fatalf("expected tree node stats kept, got %+v", stats[2])
+	}
+}
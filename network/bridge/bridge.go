@@ -0,0 +1,377 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bridge lets browsers join swarm as light peers. Browser clients connect to
+// a node over websocket and retrieve chunks and send and receive raw pss messages
+// through it, speaking the wire format defined in this package. Clients are counted
+// in the kademlia of the node as leaf peers, which neither store chunks nor route.
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// MaxSessions is the number of clients served at the same time
+	MaxSessions = 100
+	// MaxRequests is the number of retrievals a client can have in flight
+	MaxRequests = 32
+	// MaxTopics is the number of pss topics a client can subscribe to
+	MaxTopics = 16
+	// MaxMessageSize is the size limit of the messages of the clients
+	MaxMessageSize int64 = 64 * 1024
+	// MessageTTL is the expiry of the pss messages sent by the clients
+	MessageTTL = 30 * time.Second
+	// HandshakeTimeout is the time a client has to open its session in after connecting
+	HandshakeTimeout = 10 * time.Second
+	// WriteTimeout is the time a message to a client must be written in
+	WriteTimeout = 10 * time.Second
+
+	sessionsGauge   = metrics.NewRegisteredGauge("network/bridge/sessions", nil)
+	retrieveCounter = metrics.NewRegisteredCounter("network/bridge/retrieve", nil)
+	sendCounter     = metrics.NewRegisteredCounter("network/bridge/send", nil)
+	droppedCounter  = metrics.NewRegisteredCounter("network/bridge/pss/dropped", nil)
+
+	errPssDisabled     = errors.New("pss is not enabled on the node")
+	errTooManyRequests = errors.New("too many requests in flight")
+	errTooManyTopics   = errors.New("too many topics subscribed")
+	errInvalidTopic    = errors.New("invalid topic")
+	errInvalidAddress  = errors.New("invalid address")
+)
+
+// PubSub is the pss interface the messages of the clients are sent and received with,
+// implemented by pss.PubSub
+type PubSub interface {
+	Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func()
+	Send(to []byte, topic string, msg []byte) error
+}
+
+// Bridge serves browser clients connecting over websocket, it implements http.Handler
+type Bridge struct {
+	kad      *network.Kademlia
+	netStore *storage.NetStore
+	pubSub   PubSub // nil if pss is not enabled
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// New creates a Bridge retrieving chunks for its clients from the netstore and
+// counting them as leaf peers in the kademlia, pubSub may be nil if pss is not enabled
+func New(kad *network.Kademlia, netStore *storage.NetStore, pubSub PubSub) *Bridge {
+	return &Bridge{
+		kad:      kad,
+		netStore: netStore,
+		pubSub:   pubSub,
+		upgrader: websocket.Upgrader{
+			// clients are pages served from any origin, access is controlled
+			// with the API tokens and the gateway policy of the HTTP server
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		sessions: make(map[*session]struct{}),
+	}
+}
+
+// ServeHTTP upgrades the request to a websocket connection and serves the client on it
+// until it disconnects or the bridge is stopped
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	if b.closed || len(b.sessions) >= MaxSessions {
+		b.mu.Unlock()
+		http.Error(w, "bridge is not accepting clients", http.StatusServiceUnavailable)
+		return
+	}
+	s := newSession(b)
+	b.sessions[s] = struct{}{}
+	sessionsGauge.Update(int64(len(b.sessions)))
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		sessionsGauge.Update(int64(len(b.sessions)))
+		b.mu.Unlock()
+		b.wg.Done()
+	}()
+
+	conn, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("bridge upgrade failed", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	s.run(conn)
+}
+
+// Sessions returns the number of clients connected
+func (b *Bridge) Sessions() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.sessions)
+}
+
+// Stop disconnects the clients and waits for their sessions to end
+func (b *Bridge) Stop() {
+	b.mu.Lock()
+	b.closed = true
+	for s := range b.sessions {
+		s.cancel()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+// session serves a client connected to the bridge
+type session struct {
+	b        *Bridge
+	addr     *network.BzzAddr  // overlay address of the client, set by the handshake
+	client   string            // identifier of the client the retrievals are done for
+	ctx      context.Context   // done when the session ends
+	cancel   func()            // ends the session
+	out      chan *Message     // messages to write to the client
+	requests chan struct{}     // slots of the retrievals in flight
+	topics   map[string]func() // deregister functions of the topics subscribed
+	wg       sync.WaitGroup    // retrievals in flight
+}
+
+func newSession(b *Bridge) *session {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &session{
+		b:        b,
+		ctx:      ctx,
+		cancel:   cancel,
+		out:      make(chan *Message, 64),
+		requests: make(chan struct{}, MaxRequests),
+		topics:   make(map[string]func()),
+	}
+}
+
+// run handles the messages of the client until the connection fails or the session is ended
+func (s *session) run(conn *websocket.Conn) {
+	defer s.cancel()
+	go func() {
+		<-s.ctx.Done()
+		conn.Close()
+	}()
+	conn.SetReadLimit(MaxMessageSize)
+
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	var hello Message
+	if err := conn.ReadJSON(&hello); err != nil {
+		log.Debug("bridge handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	welcome, err := s.handshake(&hello)
+	if err != nil {
+		log.Debug("bridge handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+		conn.WriteJSON(&Message{Type: TypeError, Error: err.Error()})
+		return
+	}
+	defer s.b.kad.OffLeaf(s.addr)
+	conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	if err := conn.WriteJSON(welcome); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	log.Debug("bridge client connected", "remote", conn.RemoteAddr(), "overlay", s.addr.ShortString())
+
+	go s.write(conn)
+	defer func() {
+		s.cancel()
+		s.wg.Wait()
+		for _, deregister := range s.topics {
+			deregister()
+		}
+	}()
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			log.Debug("bridge client disconnected", "remote", conn.RemoteAddr(), "err", err)
+			return
+		}
+		s.handle(&msg)
+	}
+}
+
+// handshake checks the hello message of the client and counts it as a leaf peer
+func (s *session) handshake(hello *Message) (*Message, error) {
+	if hello.Type != TypeHello {
+		return nil, fmt.Errorf("expected %s message, got %q", TypeHello, hello.Type)
+	}
+	if hello.Version != Version {
+		return nil, fmt.Errorf("version mismatch %d (!= %d)", hello.Version, Version)
+	}
+	if len(hello.Overlay) != chunk.AddressLength {
+		return nil, errInvalidAddress
+	}
+	addr := network.NewBzzAddr(hello.Overlay, nil)
+	if !s.b.kad.OnLeaf(addr) {
+		return nil, errors.New("overlay address already connected")
+	}
+	s.addr = addr
+	s.client = "bridge:" + hex.EncodeToString(addr.Address())
+	return &Message{
+		Type:    TypeWelcome,
+		Version: Version,
+		Overlay: s.b.kad.BaseAddr(),
+		Depth:   s.b.kad.NeighbourhoodDepth(),
+	}, nil
+}
+
+// write writes the messages to the client until the session ends
+func (s *session) write(conn *websocket.Conn) {
+	for {
+		select {
+		case msg := <-s.out:
+			conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				s.cancel()
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// reply queues the message to be written to the client
+func (s *session) reply(msg *Message) {
+	select {
+	case s.out <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// replyErr answers the request with the ID with the error, or with ok if it is nil
+func (s *session) replyErr(id uint64, err error) {
+	if err != nil {
+		s.reply(&Message{Type: TypeError, ID: id, Error: err.Error()})
+		return
+	}
+	s.reply(&Message{Type: TypeOK, ID: id})
+}
+
+func (s *session) handle(msg *Message) {
+	switch msg.Type {
+	case TypeRetrieve:
+		s.retrieve(msg)
+	case TypeSend:
+		s.replyErr(msg.ID, s.send(msg))
+	case TypeSubscribe:
+		s.replyErr(msg.ID, s.subscribe(msg.Topic))
+	case TypeUnsubscribe:
+		s.replyErr(msg.ID, s.unsubscribe(msg.Topic))
+	default:
+		s.replyErr(msg.ID, fmt.Errorf("unknown message type %q", msg.Type))
+	}
+}
+
+// retrieve gets the chunk from the netstore, the answer is sent once it is retrieved
+func (s *session) retrieve(msg *Message) {
+	if len(msg.Addr) != chunk.AddressLength {
+		s.replyErr(msg.ID, errInvalidAddress)
+		return
+	}
+	select {
+	case s.requests <- struct{}{}:
+	default:
+		s.replyErr(msg.ID, errTooManyRequests)
+		return
+	}
+	retrieveCounter.Inc(1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.requests }()
+		ctx, cancel := context.WithTimeout(sctx.SetClient(s.ctx, s.client), timeouts.FetcherGlobalTimeout)
+		defer cancel()
+		ch, err := s.b.netStore.Get(ctx, chunk.ModeGetRequest, storage.NewRequestWithContext(ctx, storage.Address(msg.Addr)))
+		if err != nil {
+			s.replyErr(msg.ID, err)
+			return
+		}
+		s.reply(&Message{Type: TypeChunk, ID: msg.ID, Addr: msg.Addr, Data: ch.Data()})
+	}()
+}
+
+// send sends the payload to the address as a raw pss message on the topic
+func (s *session) send(msg *Message) error {
+	if s.b.pubSub == nil {
+		return errPssDisabled
+	}
+	if msg.Topic == "" {
+		return errInvalidTopic
+	}
+	sendCounter.Inc(1)
+	return s.b.pubSub.Send(msg.Addr, msg.Topic, msg.Data)
+}
+
+// subscribe makes the raw pss messages on the topic addressed to the node delivered to the client.
+// Messages are dropped if the client does not keep up with reading them.
+func (s *session) subscribe(topic string) error {
+	if s.b.pubSub == nil {
+		return errPssDisabled
+	}
+	if topic == "" {
+		return errInvalidTopic
+	}
+	if _, ok := s.topics[topic]; ok {
+		return nil
+	}
+	if len(s.topics) >= MaxTopics {
+		return errTooManyTopics
+	}
+	s.topics[topic] = s.b.pubSub.Register(topic, false, func(data []byte, _ *p2p.Peer) error {
+		select {
+		case s.out <- &Message{Type: TypePss, Topic: topic, Data: data}:
+		default:
+			droppedCounter.Inc(1)
+		}
+		return nil
+	})
+	return nil
+}
+
+// unsubscribe stops the delivery of the messages on the topic
+func (s *session) unsubscribe(topic string) error {
+	deregister, ok := s.topics[topic]
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %q", topic)
+	}
+	deregister()
+	delete(s.topics, topic)
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/swarmtest"
+	"github.com/gorilla/websocket"
+)
+
+type testBridge struct {
+	*Bridge
+	store   *swarmtest.ChunkStore
+	fetcher *swarmtest.Fetcher
+	pubSub  *swarmtest.PubSub
+	url     string
+	close   func()
+}
+
+func newTestBridge(t *testing.T) *testBridge {
+	t.Helper()
+	base := network.RandomBzzAddr()
+	store := swarmtest.NewChunkStore(base.Address())
+	netStore := storage.NewNetStore(store, base)
+	pubSub := swarmtest.NewPubSub(base.Address())
+	b := New(network.NewKademlia(base.Address(), nil), netStore, pubSub)
+	srv := httptest.NewServer(b)
+	return &testBridge{
+		Bridge:  b,
+		store:   store,
+		fetcher: swarmtest.NewFetcher(netStore),
+		pubSub:  pubSub,
+		url:     "ws" + strings.TrimPrefix(srv.URL, "http"),
+		close: func() {
+			b.Stop()
+			srv.Close()
+		},
+	}
+}
+
+// connect opens a session with the overlay address and returns the welcome or error message
+func (tb *testBridge) connect(t *testing.T, overlay []byte, version uint) (*websocket.Conn, *Message) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(tb.url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(&Message{Type: TypeHello, Version: version, Overlay: overlay}); err != nil {
+		t.Fatal(err)
+	}
+	return conn, read(t, conn)
+}
+
+func request(t *testing.T, conn *websocket.Conn, msg *Message) *Message {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+	return read(t, conn)
+}
+
+func read(t *testing.T, conn *websocket.Conn) *Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return &msg
+}
+
+// waitLeaves waits until the number of leaf peers counted in the kademlia is n
+func (tb *testBridge) waitLeaves(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; tb.kad.Leaves() != n; i++ {
+		if i == 100 {
+			t.Fatalf("expected %d leaf peers, got %d", n, tb.kad.Leaves())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHandshake checks that clients are counted as leaf peers while connected,
+// and refused with mismatching versions or overlay addresses already connected
+func TestHandshake(t *testing.T) {
+	tb := newTestBridge(t)
+	defer tb.close()
+	overlay := network.RandomBzzAddr().Address()
+
+	conn, welcome := tb.connect(t, overlay, Version)
+	if welcome.Type != TypeWelcome || !bytes.Equal(welcome.Overlay, tb.kad.BaseAddr()) || welcome.Version != Version {
+		t.Fatalf("unexpected welcome message %+v", welcome)
+	}
+	tb.waitLeaves(t, 1)
+	if n := tb.kad.KademliaInfo().TotalConnections; n != 0 {
+		t.Fatalf("expected leaf peers not in the table, got %d connections", n)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		overlay []byte
+		version uint
+		err     string
+	}{
+		{"version", network.RandomBzzAddr().Address(), Version + 1, "version mismatch"},
+		{"overlay", overlay, Version, "already connected"},
+		{"address", []byte{1}, Version, errInvalidAddress.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, msg := tb.connect(t, tc.overlay, tc.version)
+			defer conn.Close()
+			if msg.Type != TypeError || !strings.Contains(msg.Error, tc.err) {
+				t.Fatalf("expected error %q, got %+v", tc.err, msg)
+			}
+		})
+	}
+	tb.waitLeaves(t, 1)
+
+	conn.Close()
+	tb.waitLeaves(t, 0)
+	if n := tb.Sessions(); n != 0 {
+		t.Fatalf("expected no sessions, got %d", n)
+	}
+}
+
+// TestRetrieve checks that clients get the chunks stored locally and those retrieved from peers
+func TestRetrieve(t *testing.T) {
+	tb := newTestBridge(t)
+	defer tb.close()
+	conn, _ := tb.connect(t, network.RandomBzzAddr().Address(), Version)
+	defer conn.Close()
+
+	local := chunktesting.GenerateTestRandomChunk()
+	if _, err := tb.store.Put(context.Background(), chunk.ModePutUpload, local); err != nil {
+		t.Fatal(err)
+	}
+	remote := chunktesting.GenerateTestRandomChunk()
+	tb.fetcher.AddPeer(enode.ID{1}, remote)
+
+	for i, ch := range []chunk.Chunk{local, remote} {
+		msg := request(t, conn, &Message{Type: TypeRetrieve, ID: uint64(i + 1), Addr: hexutil.Bytes(ch.Address())})
+		if msg.Type != TypeChunk || msg.ID != uint64(i+1) || !bytes.Equal(msg.Data, ch.Data()) {
+			t.Fatalf("chunk %d: unexpected message %+v", i, msg)
+		}
+	}
+	msg := request(t, conn, &Message{Type: TypeRetrieve, ID: 3, Addr: []byte{1}})
+	if msg.Type != TypeError || msg.ID != 3 || msg.Error != errInvalidAddress.Error() {
+		t.Fatalf("expected invalid address error, got %+v", msg)
+	}
+}
+
+// TestPss checks that clients send pss messages and receive those on the topics subscribed
+func TestPss(t *testing.T) {
+	tb := newTestBridge(t)
+	defer tb.close()
+	conn, _ := tb.connect(t, network.RandomBzzAddr().Address(), Version)
+	defer conn.Close()
+
+	if msg := request(t, conn, &Message{Type: TypeSubscribe, ID: 1, Topic: "chat"}); msg.Type != TypeOK || msg.ID != 1 {
+		t.Fatalf("expected subscription, got %+v", msg)
+	}
+	if err := tb.pubSub.Send(tb.kad.BaseAddr(), "chat", []byte("hello browser")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := read(t, conn); msg.Type != TypePss || msg.Topic != "chat" || string(msg.Data) != "hello browser" {
+		t.Fatalf("expected pss message, got %+v", msg)
+	}
+
+	// sent on another topic, as the messages are looped back to the subscriptions
+	to := network.RandomBzzAddr().Address()
+	if msg := request(t, conn, &Message{Type: TypeSend, ID: 2, Addr: to, Topic: "mail", Data: []byte("hello node")}); msg.Type != TypeOK {
+		t.Fatalf("expected message sent, got %+v", msg)
+	}
+	if sent := tb.pubSub.Sent(to); len(sent) != 1 || string(sent[0].Msg) != "hello node" {
+		t.Fatalf("expected message sent to %x, got %v", to, sent)
+	}
+
+	if msg := request(t, conn, &Message{Type: TypeUnsubscribe, ID: 3, Topic: "chat"}); msg.Type != TypeOK {
+		t.Fatalf("expected unsubscription, got %+v", msg)
+	}
+	if msg := request(t, conn, &Message{Type: TypeUnsubscribe, ID: 4, Topic: "chat"}); msg.Type != TypeError {
+		t.Fatalf("expected error unsubscribing twice, got %+v", msg)
+	}
+}
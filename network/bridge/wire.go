@@ -0,0 +1,63 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Version is the version of the wire format of the bridge
+const Version = 1
+
+// Types of the messages. The client opens a session with hello, answered by welcome,
+// after which it can send requests carrying an ID the answers of the node refer to:
+//
+//	hello {version, overlay}             -> welcome {version, overlay, depth} or error
+//	retrieve {id, addr}                  -> chunk {id, addr, data} or error {id, error}
+//	send {id, addr, topic, data}         -> ok {id} or error {id, error}
+//	subscribe {id, topic}                -> ok {id} or error {id, error}
+//	unsubscribe {id, topic}              -> ok {id} or error {id, error}
+//
+// While subscribed to a topic, the client receives pss {topic, data} messages with
+// the payloads of the raw pss messages on the topic addressed to the node.
+const (
+	TypeHello       = "hello"
+	TypeWelcome     = "welcome"
+	TypeRetrieve    = "retrieve"
+	TypeChunk       = "chunk"
+	TypeSend        = "send"
+	TypeSubscribe   = "subscribe"
+	TypeUnsubscribe = "unsubscribe"
+	TypePss         = "pss"
+	TypeOK          = "ok"
+	TypeError       = "error"
+)
+
+// Message is the envelope of all messages of the bridge. Messages are sent as
+// websocket text messages in JSON, with binary fields in 0x prefixed hex, so
+// that browsers need no other encoding than the one they have built in.
+type Message struct {
+	Type    string        `json:"type"`
+	ID      uint64        `json:"id,omitempty"`      // request ID, set by the client
+	Version uint          `json:"version,omitempty"` // wire format version, in hello and welcome
+	Overlay hexutil.Bytes `json:"overlay,omitempty"` // overlay address of the client or the node
+	Depth   int           `json:"depth,omitempty"`   // neighbourhood depth of the node, in welcome
+	Addr    hexutil.Bytes `json:"addr,omitempty"`    // chunk address or pss recipient address
+	Topic   string        `json:"topic,omitempty"`   // pss topic
+	Data    hexutil.Bytes `json:"data,omitempty"`    // chunk data or pss payload
+	Error   string        `json:"error,omitempty"`
+}
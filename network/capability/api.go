@@ -23,7 +23,7 @@ import (
 )
 
 // API abstracts RPC API access to capabilities controls
-// will in the future provide notifications of capability changes
+// changes made through the API are announced to connected peers
 type API struct {
 	*Capabilities
 }
@@ -42,6 +42,13 @@ func (a *API) RegisterCapability(cp *Capability) error {
 	return a.Add(cp)
 }
 
+// UpdateCapability replaces the registered Capability with the same id as the given capability object
+// If the Capability is not registered an error will be returned
+func (a *API) UpdateCapability(cp *Capability) error {
+	log.Debug("Updating capability", "cp", cp)
+	return a.Update(cp)
+}
+
 // IsRegisteredCapability returns true if a Capability with the given id is registered
 func (a *API) IsRegisteredCapability(id CapabilityID) (bool, error) {
 	return a.Get(id) != nil, nil
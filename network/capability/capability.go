@@ -101,6 +101,7 @@ type Capabilities struct {
 	idx  map[CapabilityID]int // maps the CapabilityIDs to their position in the Caps vector
 	Caps []*Capability
 	mu   sync.Mutex
+	subs []chan struct{} // signals when the capabilities are changed
 }
 
 // NewCapabilities initializes a new Capabilities object
@@ -119,9 +120,59 @@ func (c *Capabilities) Add(cp *Capability) error {
 	defer c.mu.Unlock()
 	c.Caps = append(c.Caps, cp)
 	c.idx[cp.Id] = len(c.Caps) - 1
+	c.notify()
 	return nil
 }
 
+// Update replaces the registered capability with the same module id as the argument
+// Fails with error if no capability with the id is registered
+func (c *Capabilities) Update(cp *Capability) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx, ok := c.idx[cp.Id]
+	if !ok {
+		return fmt.Errorf("Capability id %d not registered", cp.Id)
+	}
+	c.Caps[idx] = cp
+	c.notify()
+	return nil
+}
+
+// Subscribe returns a channel that signals when a capability is added or updated
+// Returned function unsubscribes the channel and is safe to be called multiple times
+func (c *Capabilities) Subscribe() (<-chan struct{}, func()) {
+	channel := make(chan struct{}, 1)
+	var closeOnce sync.Once
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs = append(c.subs, channel)
+
+	unsubscribe := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, sub := range c.subs {
+			if sub == channel {
+				c.subs = append(c.subs[:i], c.subs[i+1:]...)
+				break
+			}
+		}
+		closeOnce.Do(func() { close(channel) })
+	}
+	return channel, unsubscribe
+}
+
+// notify signals all subscribers without blocking
+// must be called with the lock held
+func (c *Capabilities) notify() {
+	for _, sub := range c.subs {
+		select {
+		case sub <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // gets the capability with the specified module id
 // returns nil if the id doesn't exist
 func (c *Capabilities) Get(id CapabilityID) *Capability {
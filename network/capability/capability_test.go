@@ -19,6 +19,7 @@ package capability
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -99,6 +100,55 @@ func TestCapabilitiesControl(t *testing.T) {
 	}
 }
 
+// TestCapabilitiesUpdate tests that capabilities can be replaced
+// and that subscribers are notified of changes
+func TestCapabilitiesUpdate(t *testing.T) {
+	caps := NewCapabilities()
+	c, unsubscribe := caps.Subscribe()
+	defer unsubscribe()
+
+	// Fail if capability id is not registered
+	err := caps.Update(NewCapability(1, 16))
+	if err == nil {
+		t.Fatalf("Expected Update call with unregistered id to fail")
+	}
+
+	err = caps.Add(NewCapability(1, 16))
+	if err != nil {
+		t.Fatalf("RegisterCapabilityModule fail: %v", err)
+	}
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected notification of added capability")
+	}
+
+	c1 := NewCapability(1, 16)
+	c1.Set(3)
+	err = caps.Update(c1)
+	if err != nil {
+		t.Fatalf("Update fail: %v", err)
+	}
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected notification of updated capability")
+	}
+	if !caps.Get(1).IsSameAs(c1) {
+		t.Fatalf("Expected capability %v, got %v", c1, caps.Get(1))
+	}
+
+	// no notifications after unsubscribing
+	unsubscribe()
+	if _, ok := <-c; ok {
+		t.Fatalf("Expected subscription channel to be closed")
+	}
+	err = caps.Update(NewCapability(1, 16))
+	if err != nil {
+		t.Fatalf("Update fail: %v", err)
+	}
+}
+
 // TestCapabilitiesString checks that the string representation of the capabilities is correct
 func TestCapabilitiesString(t *testing.T) {
 	sets1 := []bool{
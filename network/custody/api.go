@@ -0,0 +1,44 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package custody
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// API is the RPC API of the proof of custody protocol
+type API struct {
+	c *Custody
+}
+
+// NewAPI creates the RPC API of the proof of custody protocol
+func NewAPI(c *Custody) *API {
+	return &API{c: c}
+}
+
+// ChallengePeer challenges the peer to prove custody of a random chunk of the
+// neighbourhood and returns whether the peer passed the challenge
+func (a *API) ChallengePeer(ctx context.Context, peer enode.ID) (bool, error) {
+	return a.c.Challenge(ctx, peer)
+}
+
+// AuditScores returns the audit scores of the challenged peers
+func (a *API) AuditScores() map[enode.ID]AuditScore {
+	return a.c.Scores()
+}
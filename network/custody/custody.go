@@ -0,0 +1,386 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package custody implements proof of custody challenges, by which a node audits
+// that its neighbourhood peers store the chunks they are responsible for.
+// The challenger sends the address of a random chunk of the neighbourhood and a nonce,
+// the storer responds with the BMT inclusion proof of the segment of the chunk data
+// selected by the nonce. The proof is verified against the chunk address, so the
+// response can not be given without the chunk data.
+package custody
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/bmt"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pot"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	// ChallengeTimeout is the time a peer has to respond to a challenge
+	ChallengeTimeout = 10 * time.Second
+
+	// ErrPeerNotFound is returned when challenging a peer that is not connected
+	ErrPeerNotFound = errors.New("peer not found")
+	// ErrNoChunk is returned if there is no chunk in the neighbourhood to challenge with
+	ErrNoChunk = errors.New("no chunk to challenge with")
+
+	challengesPassed = metrics.NewRegisteredCounter("network/custody/passed", nil)
+	challengesFailed = metrics.NewRegisteredCounter("network/custody/failed", nil)
+)
+
+const (
+	segmentCount = chunk.DefaultSize / 32 // number of segments in the BMT of a chunk
+	proofLength  = 7                      // number of sisters in the BMT inclusion proof of a segment
+	// attempts to find a content addressed chunk to challenge with
+	pickAttempts = 8
+)
+
+// AuditScore is the result of the challenges of a peer
+type AuditScore struct {
+	Passed    uint64    `json:"passed"`
+	Failed    uint64    `json:"failed"`
+	LastAudit time.Time `json:"lastAudit"`
+}
+
+// Score returns the ratio of passed challenges, 1 if the peer was not audited
+func (s AuditScore) Score() float64 {
+	if s.Passed+s.Failed == 0 {
+		return 1
+	}
+	return float64(s.Passed) / float64(s.Passed+s.Failed)
+}
+
+// Custody handles the proof of custody protocol
+type Custody struct {
+	bzz         *network.Bzz
+	store       chunk.Store
+	mtx         sync.RWMutex                  // protects peers and scores
+	peers       map[enode.ID]*network.BzzPeer // connected peers
+	scores      map[enode.ID]*AuditScore      // audit scores of the challenged peers
+	requestsMtx sync.Mutex                    // protects requests
+	requests    map[uint64]chan *ProofMsg     // open challenges by id
+	logger      log.Logger
+}
+
+// New creates the proof of custody protocol handler proving custody of the chunks in the store
+func New(bzz *network.Bzz, store chunk.Store) *Custody {
+	return &Custody{
+		bzz:      bzz,
+		store:    store,
+		peers:    make(map[enode.ID]*network.BzzPeer),
+		scores:   make(map[enode.ID]*AuditScore),
+		requests: make(map[uint64]chan *ProofMsg),
+		logger:   log.NewBaseAddressLogger(fmt.Sprintf("%x", bzz.BaseAddr()[:4])),
+	}
+}
+
+// Run is the protocol run function
+func (c *Custody) Run(bp *network.BzzPeer) error {
+	c.mtx.Lock()
+	c.peers[bp.ID()] = bp
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		delete(c.peers, bp.ID())
+		c.mtx.Unlock()
+	}()
+
+	return bp.Run(func(ctx context.Context, msg interface{}) error {
+		switch msg := msg.(type) {
+		case *ChallengeMsg:
+			return c.handleChallengeMsg(ctx, bp, msg)
+		case *ProofMsg:
+			c.requestsMtx.Lock()
+			ch, ok := c.requests[msg.ID]
+			c.requestsMtx.Unlock()
+			if !ok {
+				c.logger.Debug("custody: proof of unknown challenge", "peer", bp.ID(), "id", msg.ID)
+				return nil
+			}
+			select {
+			case ch <- msg:
+			default:
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown message type: %T", msg)
+	})
+}
+
+// handleChallengeMsg responds with the inclusion proof of the segment selected by the nonce
+func (c *Custody) handleChallengeMsg(ctx context.Context, bp *network.BzzPeer, msg *ChallengeMsg) error {
+	res := &ProofMsg{ID: msg.ID}
+	ch, err := c.store.Get(ctx, chunk.ModeGetLookup, msg.Addr)
+	if err != nil {
+		res.Err = err.Error()
+	} else {
+		res.Span, res.Segment, res.Proof = prove(ch.Data(), segmentIndex(msg.Addr, msg.Nonce))
+	}
+	return bp.Send(ctx, res)
+}
+
+// Challenge challenges the peer with a random chunk of the neighbourhood and updates
+// the audit score of the peer. It returns false if the peer fails the challenge.
+func (c *Custody) Challenge(ctx context.Context, id enode.ID) (bool, error) {
+	c.mtx.RLock()
+	bp, ok := c.peers[id]
+	c.mtx.RUnlock()
+	if !ok {
+		return false, ErrPeerNotFound
+	}
+	addr, err := c.pick(ctx)
+	if err != nil {
+		return false, err
+	}
+	passed, err := c.challenge(ctx, bp, addr)
+	if err != nil {
+		return false, err
+	}
+	c.updateScore(id, passed)
+	return passed, nil
+}
+
+// Stored probes the connected peer closest to the address for custody of the content
+// addressed chunk. It returns the overlay address of the peer if it proves custody.
+// Unlike Challenge, the probe does not update the audit score of the peer.
+func (c *Custody) Stored(ctx context.Context, addr chunk.Address) ([]byte, bool) {
+	var closest *network.BzzPeer
+	c.mtx.RLock()
+	for _, bp := range c.peers {
+		if closest == nil || pot.ProxCmp(addr, bp.Over(), closest.Over()) < 0 {
+			closest = bp
+		}
+	}
+	c.mtx.RUnlock()
+	if closest == nil {
+		return nil, false
+	}
+	passed, err := c.challenge(ctx, closest, addr)
+	if err != nil {
+		c.logger.Debug("custody: probe failed", "peer", closest.ID(), "chunk", addr, "err", err)
+		return nil, false
+	}
+	if !passed {
+		return nil, false
+	}
+	return closest.Over(), true
+}
+
+// challenge sends a challenge for the chunk with a random nonce and waits for the proof.
+// It returns false if the proof is invalid or the peer does not respond in time.
+func (c *Custody) challenge(ctx context.Context, bp *network.BzzPeer, addr chunk.Address) (bool, error) {
+	nonce := make([]byte, 32)
+	if _, err := crand.Read(nonce); err != nil {
+		return false, err
+	}
+
+	rid := rand.Uint64()
+	proofC := make(chan *ProofMsg, 1)
+	c.requestsMtx.Lock()
+	c.requests[rid] = proofC
+	c.requestsMtx.Unlock()
+	defer func() {
+		c.requestsMtx.Lock()
+		delete(c.requests, rid)
+		c.requestsMtx.Unlock()
+	}()
+
+	if err := bp.Send(ctx, &ChallengeMsg{ID: rid, Addr: addr, Nonce: nonce}); err != nil {
+		return false, err
+	}
+	select {
+	case proof := <-proofC:
+		passed := proof.Err == "" && verify(addr, segmentIndex(addr, nonce), proof)
+		if !passed {
+			c.logger.Debug("custody: challenge failed", "peer", bp.ID(), "chunk", addr, "err", proof.Err)
+		}
+		return passed, nil
+	case <-time.After(ChallengeTimeout):
+		c.logger.Debug("custody: challenge timed out", "peer", bp.ID(), "chunk", addr)
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// updateScore records the result of a challenge
+func (c *Custody) updateScore(id enode.ID, passed bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	s, ok := c.scores[id]
+	if !ok {
+		s = &AuditScore{}
+		c.scores[id] = s
+	}
+	if passed {
+		s.Passed++
+		challengesPassed.Inc(1)
+	} else {
+		s.Failed++
+		challengesFailed.Inc(1)
+	}
+	s.LastAudit = time.Now()
+}
+
+// Scores returns the audit scores of the challenged peers
+func (c *Custody) Scores() map[enode.ID]AuditScore {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	scores := make(map[enode.ID]AuditScore, len(c.scores))
+	for id, s := range c.scores {
+		scores[id] = *s
+	}
+	return scores
+}
+
+// pick returns the address of a random content addressed chunk of the neighbourhood,
+// which all neighbourhood peers are expected to store
+func (c *Custody) pick(ctx context.Context) (chunk.Address, error) {
+	var bins []uint8
+	var lasts []uint64
+	for bin := c.bzz.NeighbourhoodDepth(); bin <= chunk.MaxPO; bin++ {
+		last, err := c.store.LastPullSubscriptionBinID(uint8(bin))
+		if err != nil {
+			return nil, err
+		}
+		if last > 0 {
+			bins = append(bins, uint8(bin))
+			lasts = append(lasts, last)
+		}
+	}
+	if len(bins) == 0 {
+		return nil, ErrNoChunk
+	}
+	for i := 0; i < pickAttempts; i++ {
+		b := rand.Intn(len(bins))
+		since := uint64(rand.Int63n(int64(lasts[b]))) + 1
+		addr, err := c.first(ctx, bins[b], since, lasts[b])
+		if err != nil {
+			return nil, err
+		}
+		if addr == nil {
+			continue
+		}
+		// only content addressed chunks can be proven with the BMT
+		ch, err := c.store.Get(ctx, chunk.ModeGetLookup, addr)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(address(ch.Data()), addr) {
+			return addr, nil
+		}
+	}
+	return nil, ErrNoChunk
+}
+
+// first returns the address of the first chunk in the pull index of the bin
+// within the range, nil if there is none
+func (c *Custody) first(ctx context.Context, bin uint8, since, until uint64) (chunk.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	descriptors, stop := c.store.SubscribePull(ctx, bin, since, until)
+	defer stop()
+	select {
+	case d, ok := <-descriptors:
+		if !ok {
+			return nil, nil
+		}
+		return d.Address, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// segmentIndex returns the index of the segment selected by the nonce
+func segmentIndex(addr chunk.Address, nonce []byte) int {
+	return int(crypto.Keccak256(addr, nonce)[0]) % segmentCount
+}
+
+// prove returns the span, the segment with index i and its inclusion proof
+// in the BMT of the chunk data
+func prove(data []byte, i int) (span, segment []byte, proof [][]byte) {
+	if len(data) < 8 {
+		return nil, nil, nil
+	}
+	payload := make([]byte, chunk.DefaultSize)
+	copy(payload, data[8:])
+	rh := bmt.NewRefHasher(sha3.NewLegacyKeccak256, segmentCount)
+	return data[:8], payload[i*32 : (i+1)*32], rh.Proof(data[8:], i)
+}
+
+// verify checks the inclusion proof of the segment with index i against the chunk address
+func verify(addr chunk.Address, i int, msg *ProofMsg) bool {
+	if len(msg.Span) != 8 || len(msg.Segment) != 32 || len(msg.Proof) != proofLength {
+		return false
+	}
+	for _, sister := range msg.Proof {
+		if len(sister) != 32 {
+			return false
+		}
+	}
+	root := bmt.ProofRoot(sha3.NewLegacyKeccak256, msg.Segment, i, msg.Proof)
+	return bytes.Equal(crypto.Keccak256(msg.Span, root), addr)
+}
+
+// address returns the content address of the chunk data
+func address(data []byte) []byte {
+	if len(data) < 8 {
+		return nil
+	}
+	rh := bmt.NewRefHasher(sha3.NewLegacyKeccak256, segmentCount)
+	return crypto.Keccak256(data[:8], rh.Hash(data[8:]))
+}
+
+// Protocols returns the p2p protocol run over bzz peers
+func (c *Custody) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{
+			Name:    Spec.Name,
+			Version: Spec.Version,
+			Length:  Spec.Length(),
+			Run:     c.bzz.RunProtocol(Spec, c.Run),
+		},
+	}
+}
+
+// APIs returns the RPC API of the protocol
+func (c *Custody) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "swarm",
+			Version:   "1.0",
+			Service:   NewAPI(c),
+			Public:    false,
+		},
+	}
+}
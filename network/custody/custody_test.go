@@ -0,0 +1,203 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package custody
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/localstore"
+)
+
+// TestChallenge tests that a peer storing the chunks of the neighbourhood passes
+// the challenges and a peer missing them fails, and that the scores are updated
+func TestChallenge(t *testing.T) {
+	challenger, challengerStore, cleanup := newTestCustody(t)
+	defer cleanup()
+	storer, storerStore, cleanup := newTestCustody(t)
+	defer cleanup()
+
+	var chunks []chunk.Chunk
+	for _, size := range []int64{1, 100, 4095, chunk.DefaultSize} {
+		chunks = append(chunks, storage.GenerateRandomChunk(size))
+	}
+	ctx := context.Background()
+	for _, s := range []chunk.Store{challengerStore, storerStore} {
+		if _, err := s.Put(ctx, chunk.ModePutSync, chunks...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id := enode.ID{1}
+	disconnect := connect(challenger, storer, id)
+	defer disconnect()
+
+	for i := 0; i < 10; i++ {
+		passed, err := challenger.Challenge(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !passed {
+			t.Fatal("expected challenge to pass")
+		}
+	}
+
+	// the storer loses the chunks
+	for _, ch := range chunks {
+		if err := storerStore.Set(ctx, chunk.ModeSetRemove, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	passed, err := challenger.Challenge(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passed {
+		t.Fatal("expected challenge to fail")
+	}
+
+	score, ok := challenger.Scores()[id]
+	if !ok {
+		t.Fatal("expected audit score of the peer")
+	}
+	if score.Passed != 10 || score.Failed != 1 {
+		t.Fatalf("expected 10 passed and 1 failed challenges, got %d passed and %d failed", score.Passed, score.Failed)
+	}
+	if _, err := challenger.Challenge(ctx, enode.ID{2}); err != ErrPeerNotFound {
+		t.Fatalf("expected error %v, got %v", ErrPeerNotFound, err)
+	}
+}
+
+// TestStored tests that the probe succeeds for a chunk stored by the closest peer
+// and fails for a missing chunk, without updating the audit scores
+func TestStored(t *testing.T) {
+	challenger, _, cleanup := newTestCustody(t)
+	defer cleanup()
+	storer, storerStore, cleanup := newTestCustody(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+	if _, ok := challenger.Stored(ctx, ch.Address()); ok {
+		t.Fatal("expected probe without peers to fail")
+	}
+
+	id := enode.ID{1}
+	disconnect := connect(challenger, storer, id)
+	defer disconnect()
+
+	if _, err := storerStore.Put(ctx, chunk.ModePutSync, ch); err != nil {
+		t.Fatal(err)
+	}
+	storerAddr, ok := challenger.Stored(ctx, ch.Address())
+	if !ok {
+		t.Fatal("expected stored chunk to be found")
+	}
+	challenger.mtx.RLock()
+	over := challenger.peers[id].Over()
+	challenger.mtx.RUnlock()
+	if !bytes.Equal(storerAddr, over) {
+		t.Fatalf("expected storer %x, got %x", over, storerAddr)
+	}
+
+	missing := storage.GenerateRandomChunk(chunk.DefaultSize)
+	if _, ok := challenger.Stored(ctx, missing.Address()); ok {
+		t.Fatal("expected missing chunk not to be found")
+	}
+	if len(challenger.Scores()) != 0 {
+		t.Fatal("expected probes not to update audit scores")
+	}
+}
+
+// TestVerify tests that proofs of other segments or chunks are rejected
+func TestVerify(t *testing.T) {
+	ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+	other := storage.GenerateRandomChunk(chunk.DefaultSize)
+	for i := 0; i < segmentCount; i++ {
+		span, segment, proof := prove(ch.Data(), i)
+		msg := &ProofMsg{Span: span, Segment: segment, Proof: proof}
+		if !verify(ch.Address(), i, msg) {
+			t.Fatalf("segment %d: expected valid proof", i)
+		}
+		if verify(ch.Address(), (i+1)%segmentCount, msg) {
+			t.Fatalf("segment %d: expected proof of another segment to be invalid", i)
+		}
+		if verify(other.Address(), i, msg) {
+			t.Fatalf("segment %d: expected proof of another chunk to be invalid", i)
+		}
+	}
+}
+
+// connect runs the protocol of the custody handlers over a message pipe,
+// the storer is a peer of the challenger with the id
+func connect(challenger, storer *Custody, id enode.ID) func() {
+	challengerRW, storerRW := p2p.MsgPipe()
+	go challenger.Run(&network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(id, "storer", nil), challengerRW, Spec),
+		BzzAddr: network.RandomBzzAddr(),
+	})
+	go storer.Run(&network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(enode.ID{}, "challenger", nil), storerRW, Spec),
+		BzzAddr: network.RandomBzzAddr(),
+	})
+	// wait for the peer to be registered
+	for i := 0; i < 100; i++ {
+		challenger.mtx.RLock()
+		_, ok := challenger.peers[id]
+		challenger.mtx.RUnlock()
+		if ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() {
+		challengerRW.Close()
+	}
+}
+
+func newTestCustody(t *testing.T) (*Custody, *localstore.DB, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "swarm-custody-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := network.RandomBzzAddr()
+	store, err := localstore.New(dir, addr.Over(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	bzz := network.NewBzz(&network.BzzConfig{
+		Address:    addr,
+		HiveParams: network.NewHiveParams(),
+	}, kad, nil, nil, nil, nil, nil)
+	return New(bzz, store), store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package custody
+
+import (
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// Spec is the spec of the proof of custody protocol
+var Spec = &protocols.Spec{
+	Name:       "bzz-custody",
+	Version:    1,
+	MaxMsgSize: 10 * 1024,
+	Messages: []interface{}{
+		ChallengeMsg{},
+		ProofMsg{},
+	},
+}
+
+// ChallengeMsg challenges a peer to prove that it stores the chunk with the address.
+// The nonce selects the segment of the chunk data that has to be proven.
+type ChallengeMsg struct {
+	ID    uint64
+	Addr  chunk.Address
+	Nonce []byte
+}
+
+// ProofMsg is the response to a ChallengeMsg with the BMT inclusion proof of the
+// segment selected by the nonce, Err is set if the peer can not give a proof
+type ProofMsg struct {
+	ID      uint64
+	Span    []byte   // span of the chunk
+	Segment []byte   // the selected segment of the chunk data
+	Proof   [][]byte // sister segment and sister subtree hashes up to the BMT root
+	Err     string
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc resolves the node lists published in DNS as merkle trees of TXT
+// records, as specified in EIP-1459, and builds such trees for publishers.
+//
+// A tree is referred to with an enrtree://<key>@<domain> URL, where key is the base32
+// encoded compressed public key signing the root record found at the domain:
+//
+//	enrtree-root:v1 e=<enr-root> l=<link-root> seq=<sequence-number> sig=<signature>
+//
+// The other records are found at the subdomains named after the hash of their content:
+// branches listing the hashes of their children (enrtree-branch:<h1>,<h2>,...), node
+// records (enr:<node-record>) and links to other trees (enrtree://<key>@<domain>).
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	rootPrefix   = "enrtree-root:v1"
+	branchPrefix = "enrtree-branch:"
+	linkPrefix   = "enrtree://"
+	enrPrefix    = "enr:"
+
+	sigLength = 65 // length of the [R || S || V] root signature
+)
+
+var (
+	b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+	b64 = base64.RawURLEncoding
+
+	// MaxLinkDepth is the number of links followed from the tree resolved
+	MaxLinkDepth = 4
+	// MaxEntries is the number of records resolved in a tree, including those of its links
+	MaxEntries = 10000
+
+	errUnknownEntry = errors.New("unknown entry type")
+	errInvalidSig   = errors.New("invalid root signature")
+	errTooManyLinks = errors.New("too many links followed")
+	errTooLarge     = errors.New("tree has too many entries")
+)
+
+// Resolver looks up the TXT records of a domain, implemented by net.Resolver
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// Client resolves trees of node records
+type Client struct {
+	resolver Resolver
+}
+
+// NewClient creates a Client looking up records with the resolver, net.DefaultResolver if nil
+func NewClient(resolver Resolver) *Client {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &Client{resolver: resolver}
+}
+
+// ParseURL parses an enrtree://<key>@<domain> URL into the public key signing the tree and its domain
+func ParseURL(url string) (*ecdsa.PublicKey, string, error) {
+	if !strings.HasPrefix(url, linkPrefix) {
+		return nil, "", fmt.Errorf("invalid tree url %q: missing %s prefix", url, linkPrefix)
+	}
+	at := strings.IndexByte(url, '@')
+	if at < 0 {
+		return nil, "", fmt.Errorf("invalid tree url %q: missing domain", url)
+	}
+	key, domain := url[len(linkPrefix):at], url[at+1:]
+	if domain == "" {
+		return nil, "", fmt.Errorf("invalid tree url %q: missing domain", url)
+	}
+	keyBytes, err := b32.DecodeString(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid tree url %q: invalid public key: %v", url, err)
+	}
+	pubkey, err := crypto.DecompressPubkey(keyBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid tree url %q: invalid public key: %v", url, err)
+	}
+	return pubkey, domain, nil
+}
+
+// URL returns the enrtree:// URL of the tree at the domain signed with the key
+func URL(pubkey *ecdsa.PublicKey, domain string) string {
+	return linkPrefix + b32.EncodeToString(crypto.CompressPubkey(pubkey)) + "@" + domain
+}
+
+// SyncTree resolves all the node records of the tree with the URL and the trees it links to
+func (c *Client) SyncTree(ctx context.Context, url string) ([]*enode.Node, error) {
+	s := &resolution{
+		client:  c,
+		visited: make(map[string]bool),
+	}
+	if err := s.tree(ctx, url, 0); err != nil {
+		return nil, err
+	}
+	return s.nodes, nil
+}
+
+// resolution is the state of the resolution of a tree
+type resolution struct {
+	client  *Client
+	visited map[string]bool // trees resolved, by url
+	entries int
+	nodes   []*enode.Node
+}
+
+// tree resolves the root of the tree and its node and link subtrees
+func (s *resolution) tree(ctx context.Context, url string, depth int) error {
+	if s.visited[url] {
+		return nil
+	}
+	if depth > MaxLinkDepth {
+		return errTooManyLinks
+	}
+	s.visited[url] = true
+	pubkey, domain, err := ParseURL(url)
+	if err != nil {
+		return err
+	}
+	txt, err := s.lookup(ctx, domain, rootPrefix)
+	if err != nil {
+		return err
+	}
+	r, err := parseRoot(txt)
+	if err != nil {
+		return err
+	}
+	if !r.verify(pubkey) {
+		return errInvalidSig
+	}
+	if err := s.subtree(ctx, domain, r.eroot, depth); err != nil {
+		return err
+	}
+	return s.subtree(ctx, domain, r.lroot, depth)
+}
+
+// subtree resolves the entry with the hash and its children
+func (s *resolution) subtree(ctx context.Context, domain, hash string, depth int) error {
+	s.entries++
+	if s.entries > MaxEntries {
+		return errTooLarge
+	}
+	txt, err := s.lookup(ctx, hash+"."+domain, "")
+	if err != nil {
+		return err
+	}
+	if h := subdomain(txt); h != hash {
+		return fmt.Errorf("entry %s.%s has hash %s", hash, domain, h)
+	}
+	switch {
+	case strings.HasPrefix(txt, branchPrefix):
+		for _, child := range parseBranch(txt) {
+			if err := s.subtree(ctx, domain, child, depth); err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(txt, enrPrefix):
+		n, err := enode.Parse(enode.ValidSchemes, txt)
+		if err != nil {
+			return fmt.Errorf("entry %s.%s: %v", hash, domain, err)
+		}
+		s.nodes = append(s.nodes, n)
+	case strings.HasPrefix(txt, linkPrefix):
+		return s.tree(ctx, txt, depth+1)
+	default:
+		return fmt.Errorf("entry %s.%s: %v", hash, domain, errUnknownEntry)
+	}
+	return nil
+}
+
+// lookup returns the first TXT record of the name with the prefix, records
+// at subdomains are recognised by their prefix when it is empty
+func (s *resolution) lookup(ctx context.Context, name, prefix string) (string, error) {
+	txts, err := s.client.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	for _, txt := range txts {
+		if prefix != "" && strings.HasPrefix(txt, prefix) {
+			return txt, nil
+		}
+		if prefix == "" && (strings.HasPrefix(txt, branchPrefix) || strings.HasPrefix(txt, enrPrefix) || strings.HasPrefix(txt, linkPrefix)) {
+			return txt, nil
+		}
+	}
+	return "", fmt.Errorf("no tree entry found at %s", name)
+}
+
+// root is the signed root record of a tree
+type root struct {
+	eroot string // hash of the root of the node records subtree
+	lroot string // hash of the root of the links subtree
+	seq   uint
+	sig   []byte
+}
+
+func parseRoot(txt string) (*root, error) {
+	var r root
+	var sig string
+	if _, err := fmt.Sscanf(txt, rootPrefix+" e=%s l=%s seq=%d sig=%s", &r.eroot, &r.lroot, &r.seq, &sig); err != nil {
+		return nil, fmt.Errorf("invalid root entry %q: %v", txt, err)
+	}
+	var err error
+	if r.sig, err = b64.DecodeString(sig); err != nil || len(r.sig) != sigLength {
+		return nil, fmt.Errorf("invalid root entry %q: invalid signature", txt)
+	}
+	return &r, nil
+}
+
+// signedText is the part of the root record covered by the signature
+func (r *root) signedText() string {
+	return fmt.Sprintf(rootPrefix+" e=%s l=%s seq=%d", r.eroot, r.lroot, r.seq)
+}
+
+func (r *root) String() string {
+	return r.signedText() + " sig=" + b64.EncodeToString(r.sig)
+}
+
+func (r *root) verify(pubkey *ecdsa.PublicKey) bool {
+	hash := crypto.Keccak256([]byte(r.signedText()))
+	return crypto.VerifySignature(crypto.CompressPubkey(pubkey), hash, r.sig[:sigLength-1])
+}
+
+func parseBranch(txt string) []string {
+	hashes := strings.Split(strings.TrimPrefix(txt, branchPrefix), ",")
+	if len(hashes) == 1 && hashes[0] == "" {
+		return nil
+	}
+	return hashes
+}
+
+// subdomain returns the name of the subdomain of the entry, the hash of its content
+func subdomain(txt string) string {
+	return b32.EncodeToString(crypto.Keccak256([]byte(txt))[:16])
+}
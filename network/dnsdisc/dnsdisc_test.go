@@ -0,0 +1,207 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// mapResolver serves the TXT records published in a map
+type mapResolver map[string]string
+
+func (m mapResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if txt, ok := m[name]; ok {
+		return []string{txt}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// publish signs the tree and adds its records to the resolver
+func (m mapResolver) publish(t *testing.T, tree *Tree, key *ecdsa.PrivateKey, domain string) string {
+	t.Helper()
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := tree.ToTXT(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, txt := range records {
+		m[name] = txt
+	}
+	return url
+}
+
+func newTestNodes(t *testing.T, n int) []*enode.Node {
+	t.Helper()
+	nodes := make([]*enode.Node, n)
+	for i := range nodes {
+		key := newTestKey(t)
+		var r enr.Record
+		r.Set(enr.IP(net.IP{10, 0, 0, byte(i)}))
+		r.Set(enr.TCP(30399))
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+		node, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = node
+	}
+	return nodes
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestSyncTree checks that the node records of a tree and of the trees it links to are resolved
+func TestSyncTree(t *testing.T) {
+	r := make(mapResolver)
+
+	linked := newTestNodes(t, 2)
+	linkedTree, err := MakeTree(1, linked, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := r.publish(t, linkedTree, newTestKey(t), "linked.swarm.test")
+
+	// more nodes than fit in a branch
+	nodes := newTestNodes(t, 3*maxChildren)
+	tree, err := MakeTree(1, nodes, []string{link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := r.publish(t, tree, newTestKey(t), "nodes.swarm.test")
+
+	got, err := NewClient(r).SyncTree(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[enode.ID]bool)
+	for _, n := range append(nodes, linked...) {
+		want[n.ID()] = true
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d nodes, got %d", len(want), len(got))
+	}
+	for _, n := range got {
+		if !want[n.ID()] {
+			t.Fatalf("unexpected node %v", n.ID())
+		}
+		if n.TCP() != 30399 {
+			t.Fatalf("expected tcp port 30399, got %d", n.TCP())
+		}
+	}
+}
+
+// TestSyncTreeLinkCycle checks that trees linking to each other are resolved once
+func TestSyncTreeLinkCycle(t *testing.T) {
+	r := make(mapResolver)
+	keyA, keyB := newTestKey(t), newTestKey(t)
+	urlA, urlB := URL(&keyA.PublicKey, "a.swarm.test"), URL(&keyB.PublicKey, "b.swarm.test")
+
+	treeA, err := MakeTree(1, newTestNodes(t, 1), []string{urlB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.publish(t, treeA, keyA, "a.swarm.test")
+	treeB, err := MakeTree(1, newTestNodes(t, 1), []string{urlA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.publish(t, treeB, keyB, "b.swarm.test")
+
+	got, err := NewClient(r).SyncTree(context.Background(), urlA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(got))
+	}
+}
+
+// TestSyncTreeInvalid checks that trees not signed with the key of the URL
+// or with records not matching their hashes are refused
+func TestSyncTreeInvalid(t *testing.T) {
+	r := make(mapResolver)
+	nodes := newTestNodes(t, 2)
+	tree, err := MakeTree(1, nodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.publish(t, tree, newTestKey(t), "nodes.swarm.test")
+
+	other := newTestKey(t)
+	if _, err := NewClient(r).SyncTree(context.Background(), URL(&other.PublicKey, "nodes.swarm.test")); err != errInvalidSig {
+		t.Fatalf("expected error %v, got %v", errInvalidSig, err)
+	}
+
+	key := newTestKey(t)
+	url := r.publish(t, tree, key, "nodes.swarm.test")
+	for name, txt := range r {
+		if strings.HasPrefix(txt, enrPrefix) {
+			r[name] = nodes[0].String()
+			if r[name] == txt {
+				r[name] = nodes[1].String()
+			}
+			break
+		}
+	}
+	if _, err := NewClient(r).SyncTree(context.Background(), url); err == nil || !strings.Contains(err.Error(), "has hash") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+}
+
+// TestParseURL checks that tree URLs round trip and malformed ones are refused
+func TestParseURL(t *testing.T) {
+	key := newTestKey(t)
+	url := URL(&key.PublicKey, "nodes.swarm.test")
+	pubkey, domain, err := ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != "nodes.swarm.test" || crypto.PubkeyToAddress(*pubkey) != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("unexpected key or domain %q of url %s", domain, url)
+	}
+	for _, invalid := range []string{
+		"nodes.swarm.test",
+		"enrtree://nodes.swarm.test",
+		"enrtree://AAAA@nodes.swarm.test",
+		fmt.Sprintf("enrtree://%s@", strings.TrimPrefix(strings.Split(url, "@")[0], linkPrefix)),
+	} {
+		if _, _, err := ParseURL(invalid); err == nil {
+			t.Fatalf("expected url %q to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// maxChildren is the number of hashes in a branch record, keeping it within the size of a TXT record
+const maxChildren = 13
+
+// Tree is a tree of node records and links to other trees to publish in DNS
+type Tree struct {
+	root    *root
+	entries map[string]string // records by subdomain
+}
+
+// MakeTree builds a tree of the node records and the links with the sequence number,
+// which must be increased with every update of the tree. Nodes must have signed
+// records, nodes created from enode URLs can not be published.
+func MakeTree(seq uint, nodes []*enode.Node, links []string) (*Tree, error) {
+	t := &Tree{
+		root:    &root{seq: seq},
+		entries: make(map[string]string),
+	}
+	records := make([]string, len(nodes))
+	for i, n := range nodes {
+		records[i] = n.String()
+		if !strings.HasPrefix(records[i], enrPrefix) {
+			return nil, fmt.Errorf("node %v has no signed record", n.ID())
+		}
+	}
+	for _, link := range links {
+		if _, _, err := ParseURL(link); err != nil {
+			return nil, err
+		}
+	}
+	t.root.eroot = t.build(records)
+	t.root.lroot = t.build(links)
+	return t, nil
+}
+
+// build adds the records and the branches above them to the tree, returning the hash of the topmost branch
+func (t *Tree) build(records []string) string {
+	hashes := make([]string, len(records))
+	for i, r := range records {
+		hashes[i] = t.add(r)
+	}
+	sort.Strings(hashes)
+	for len(hashes) > maxChildren {
+		var parents []string
+		for i := 0; i < len(hashes); i += maxChildren {
+			end := i + maxChildren
+			if end > len(hashes) {
+				end = len(hashes)
+			}
+			parents = append(parents, t.add(branchPrefix+strings.Join(hashes[i:end], ",")))
+		}
+		hashes = parents
+	}
+	return t.add(branchPrefix + strings.Join(hashes, ","))
+}
+
+func (t *Tree) add(record string) string {
+	h := subdomain(record)
+	t.entries[h] = record
+	return h
+}
+
+// Sign signs the root of the tree with the key and returns the URL of the tree at the domain
+func (t *Tree) Sign(key *ecdsa.PrivateKey, domain string) (string, error) {
+	sig, err := crypto.Sign(crypto.Keccak256([]byte(t.root.signedText())), key)
+	if err != nil {
+		return "", err
+	}
+	t.root.sig = sig
+	return URL(&key.PublicKey, domain), nil
+}
+
+// ToTXT returns the TXT records of the signed tree to publish by their fully qualified names in the domain
+func (t *Tree) ToTXT(domain string) (map[string]string, error) {
+	if t.root.sig == nil {
+		return nil, errors.New("tree is not signed")
+	}
+	records := map[string]string{domain: t.root.String()}
+	for h, r := range t.entries {
+		records[h+"."+domain] = r
+	}
+	return records, nil
+}
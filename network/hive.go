@@ -66,6 +66,9 @@ type Hive struct {
 	*Kademlia                     // the overlay connectiviy driver
 	Store       state.Store       // storage interface to save peers across sessions
 	addPeer     func(*enode.Node) // server callback to connect to a peer
+	punch       func(*BzzAddr)    // callback with the peers dialed, to punch holes in the NATs of unreachable ones
+	reach       *reachability     // outcomes of the dials of the underlay addresses of peers
+	bootnodes   *Bootnodes        // bootnodes dialed while the node has few peers
 	// bookkeeping
 	lock    sync.Mutex
 	peers   map[enode.ID]*BzzPeer
@@ -84,6 +87,7 @@ func NewHive(params *HiveParams, kad *Kademlia, store state.Store) *Hive {
 		Kademlia:   kad,
 		Store:      store,
 		peers:      make(map[enode.ID]*BzzPeer),
+		reach:      newReachability(),
 	}
 }
 
@@ -117,10 +121,41 @@ func (h *Hive) start(server *p2p.Server, addPeerFunc func(*enode.Node)) error {
 	if !h.DisableAutoConnect {
 		go h.connect()
 	}
+	if h.bootnodes != nil {
+		h.bootnodes.start(addPeerFunc, h.peerCount, func(id enode.ID) bool {
+			return h.Peer(id) != nil
+		})
+	}
 	h.started = true
 	return nil
 }
 
+// SetPuncher sets the function called with each peer the hive dials, it is expected
+// to coordinate a hole punch with the peers it sees repeatedly dialed in vain
+// it must be called before the hive is started
+func (h *Hive) SetPuncher(punch func(*BzzAddr)) {
+	h.punch = punch
+}
+
+// SetBootnodes sets the bootnodes the hive dials while the node has few peers
+// it must be called before the hive is started
+func (h *Hive) SetBootnodes(b *Bootnodes) {
+	h.bootnodes = b
+}
+
+// BootnodeStats returns the health of the bootnodes, nil if none are set
+func (h *Hive) BootnodeStats() []BootnodeStats {
+	if h.bootnodes == nil {
+		return nil
+	}
+	return h.bootnodes.Stats()
+}
+
+// UnderlayStats returns the outcomes of the dials of the underlay addresses of peers
+func (h *Hive) UnderlayStats() map[string]UnderlayStats {
+	return h.reach.all()
+}
+
 // Stop terminates the updateloop and saves the peers
 func (h *Hive) Stop() error {
 	log.Info(fmt.Sprintf("%08x hive stopping, saving peers", h.BaseAddr()[:4]))
@@ -131,6 +166,9 @@ func (h *Hive) Stop() error {
 		h.ticker.Stop()
 	}
 	close(h.done)
+	if h.bootnodes != nil {
+		h.bootnodes.stop()
+	}
 	if h.Store != nil {
 		if err := h.savePeers(); err != nil {
 			return fmt.Errorf("could not save peers to persistence store: %v", err)
@@ -172,15 +210,16 @@ func (h *Hive) tickHive() {
 	}
 	if addr != nil {
 		log.Trace(fmt.Sprintf("%08x hive connect() suggested %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		underA := addr.Under()
-		s := string(underA)
-		under, err := enode.ParseV4(s)
+		under, err := h.reach.dial(addr)
 		if err != nil {
 			log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
 			return
 		}
 		log.Trace(fmt.Sprintf("%08x attempt to connect to bee %08x", h.BaseAddr()[:4], addr.Address()[:4]))
 		h.addPeer(under)
+		if h.punch != nil {
+			h.punch(addr)
+		}
 	}
 }
 
@@ -189,8 +228,10 @@ func (h *Hive) Run(p *BzzPeer) error {
 	h.trackPeer(p)
 	defer h.untrackPeer(p)
 
+	h.reach.connected(p.BzzAddr, p.RemoteAddr(), p.Inbound())
 	dp := NewPeer(p, h.Kademlia)
 	depth, changed := h.On(dp)
+	log.Debug("hive peer on", "peer", dp.Label(), "addr", p.ShortOver())
 	// if we want discovery, advertise change of depth
 	if h.Discovery {
 		if changed {
@@ -202,7 +243,10 @@ func (h *Hive) Run(p *BzzPeer) error {
 		}
 		h.NotifyPeer(p.BzzAddr)
 	}
-	defer h.Off(dp)
+	defer func() {
+		h.Off(dp)
+		log.Debug("hive peer off", "peer", dp.Label(), "addr", p.ShortOver())
+	}()
 	return dp.Run(h.handleMsg(dp))
 }
 
@@ -243,6 +287,14 @@ func (h *Hive) PeerInfo(id enode.ID) interface{} {
 	}
 }
 
+// peerCount returns the number of bzz peers connected
+func (h *Hive) peerCount() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return len(h.peers)
+}
+
 // Peer returns a bzz peer from the Hive. If there is no peer
 // with the provided enode id, a nil value is returned.
 func (h *Hive) Peer(id enode.ID) *BzzPeer {
@@ -292,7 +344,7 @@ func (h *Hive) connectInitialPeers(conns []*BzzAddr) {
 	log.Info(fmt.Sprintf("%08x hive connectInitialPeers() With %v saved connections", h.BaseAddr()[:4], len(conns)))
 	for _, addr := range conns {
 		log.Trace(fmt.Sprintf("%08x hive connect() suggested initial %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		under, err := enode.ParseV4(string(addr.Under()))
+		under, err := h.reach.dial(addr)
 		if err != nil {
 			log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
 			continue
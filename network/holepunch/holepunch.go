@@ -0,0 +1,287 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package holepunch connects nodes behind NATs. A node that repeatedly fails to dial
+// a peer signals it over pss to dial each other at the same time, which opens the
+// NATs of both nodes to the connection. If the dials fail, the nodes run the bzz
+// protocols over a connection relayed by a publicly reachable peer advertising the
+// relay capability, which forwards the messages of the protocols in frames.
+package holepunch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pot"
+)
+
+var (
+	// PunchAttempts is the number of dials of a peer after which a hole punch is coordinated
+	PunchAttempts = 3
+	// PunchDelay is the time between signaling a peer and the simultaneous dials
+	PunchDelay = 2 * time.Second
+	// PunchTimeout is the time the connection is expected to be established in after the dials
+	PunchTimeout = 5 * time.Second
+	// SignalTTL is the expiry of the signaling pss messages
+	SignalTTL = 10 * time.Second
+
+	punchCounter   = metrics.NewRegisteredCounter("network/holepunch/punch", nil)
+	directCounter  = metrics.NewRegisteredCounter("network/holepunch/direct", nil)
+	relayedCounter = metrics.NewRegisteredCounter("network/holepunch/relayed", nil)
+	forwardCounter = metrics.NewRegisteredCounter("network/holepunch/forward", nil)
+
+	errSessionClosed = errors.New("relayed connection closed")
+)
+
+// topic is the pss topic of the signaling messages
+const topic = "HOLEPUNCH"
+
+// PubSub is the pss interface the peers are signaled with, implemented by pss.PubSub
+type PubSub interface {
+	Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func()
+	Send(to []byte, topic string, msg []byte) error
+}
+
+// Puncher coordinates hole punches with unreachable peers and runs the connection relay protocol
+type Puncher struct {
+	bzz       *network.Bzz
+	pubSub    PubSub
+	protocols []p2p.Protocol // protocols run over relayed connections
+	relay     bool           // whether the frames of other nodes are forwarded
+
+	self       func() *enode.Node            // local node, set on start
+	addPeer    func(*enode.Node)             // server callback to connect to a peer, set on start
+	connected  func(enode.ID) bool           // whether the node is connected directly, set on start
+	mtx        sync.Mutex                    // protects attempts, pending, peers and sessions
+	attempts   map[string]int                // dials of unreachable peers by overlay address
+	pending    map[enode.ID]time.Time        // nodes coordinating a hole punch until the time
+	peers      map[enode.ID]*network.BzzPeer // peers running the relay protocol
+	sessions   map[enode.ID]*session         // relayed connections by remote node
+	unregister func()
+	quit       chan struct{}
+	logger     log.Logger
+}
+
+// New creates a puncher signaling peers with pss and relaying the bzz protocols,
+// if relay is set the frames of other nodes are forwarded
+func New(bzz *network.Bzz, pubSub PubSub, relay bool) *Puncher {
+	return &Puncher{
+		bzz:       bzz,
+		pubSub:    pubSub,
+		protocols: bzz.Protocols(),
+		relay:     relay,
+		attempts:  make(map[string]int),
+		pending:   make(map[enode.ID]time.Time),
+		peers:     make(map[enode.ID]*network.BzzPeer),
+		sessions:  make(map[enode.ID]*session),
+		quit:      make(chan struct{}),
+		logger:    log.NewBaseAddressLogger(fmt.Sprintf("%x", bzz.BaseAddr()[:4])),
+	}
+}
+
+// Start registers the signaling handler, it receives the p2p.Server to dial peers with
+func (p *Puncher) Start(srv *p2p.Server) error {
+	return p.start(srv.Self, srv.AddPeer, func(id enode.ID) bool {
+		for _, peer := range srv.Peers() {
+			if peer.ID() == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (p *Puncher) start(self func() *enode.Node, addPeer func(*enode.Node), connected func(enode.ID) bool) error {
+	p.self = self
+	p.addPeer = addPeer
+	p.connected = connected
+	p.unregister = p.pubSub.Register(topic, false, p.handleSignal)
+	return nil
+}
+
+// Stop unregisters the signaling handler and closes the relayed connections
+func (p *Puncher) Stop() error {
+	close(p.quit)
+	if p.unregister != nil {
+		p.unregister()
+	}
+	p.mtx.Lock()
+	sessions := make([]*session, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mtx.Unlock()
+	for _, s := range sessions {
+		p.closeSession(s, true)
+	}
+	return nil
+}
+
+// Punch is called with the peers the hive dials, a peer dialed PunchAttempts times
+// is not reachable and is signaled to dial at the same time, passing the relay
+// used if the dials fail. Relays are publicly reachable and are not punched.
+func (p *Puncher) Punch(addr *network.BzzAddr) {
+	if network.IsNatRelay(addr) {
+		return
+	}
+	node, err := enode.ParseV4(string(addr.Under()))
+	if err != nil {
+		return
+	}
+	key := string(addr.Over())
+	p.mtx.Lock()
+	p.attempts[key]++
+	if p.attempts[key] < PunchAttempts {
+		p.mtx.Unlock()
+		return
+	}
+	delete(p.attempts, key)
+	if until, ok := p.pending[node.ID()]; ok && time.Now().Before(until) {
+		p.mtx.Unlock()
+		return
+	}
+	at := time.Now().Add(PunchDelay)
+	p.setPending(node.ID(), at.Add(PunchTimeout))
+	relay := p.closestRelay(addr.Over())
+	p.mtx.Unlock()
+
+	msg := &signalMsg{
+		Enode: p.self().URLv4(),
+		At:    uint64(at.UnixNano()),
+	}
+	if relay != nil {
+		msg.Relay = string(relay.Under())
+	}
+	data, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		p.logger.Error("holepunch: encode signal", "err", err)
+		return
+	}
+	if err := p.pubSub.Send(addr.Over(), topic, data); err != nil {
+		p.logger.Debug("holepunch: signal failed", "peer", addr, "err", err)
+		return
+	}
+	go p.punch(node, relay, at)
+}
+
+// handleSignal dials the signaling node at the time given, connecting to the relay
+// in advance so that the relayed connection can be accepted if the dials fail
+func (p *Puncher) handleSignal(data []byte, _ *p2p.Peer) error {
+	var msg signalMsg
+	if err := rlp.DecodeBytes(data, &msg); err != nil {
+		return err
+	}
+	node, err := enode.ParseV4(msg.Enode)
+	if err != nil {
+		return err
+	}
+	if node.ID() == p.self().ID() {
+		return nil
+	}
+	at := time.Unix(0, int64(msg.At))
+	if wait := time.Until(at); wait > SignalTTL || wait < -PunchTimeout {
+		p.logger.Debug("holepunch: stale signal", "node", node.ID(), "at", at)
+		return nil
+	}
+	p.mtx.Lock()
+	// the relayed connection is opened by the signaling node after the timeout
+	p.setPending(node.ID(), at.Add(2*PunchTimeout))
+	p.mtx.Unlock()
+	if msg.Relay != "" {
+		relay, err := enode.ParseV4(msg.Relay)
+		if err != nil {
+			return err
+		}
+		if !p.connected(relay.ID()) {
+			p.addPeer(relay)
+		}
+	}
+	go p.punch(node, nil, at)
+	return nil
+}
+
+// punch dials the node at the time and opens a relayed connection through the relay,
+// if given, unless the node is connected in time
+func (p *Puncher) punch(node *enode.Node, relay *network.BzzPeer, at time.Time) {
+	select {
+	case <-time.After(time.Until(at)):
+	case <-p.quit:
+		return
+	}
+	punchCounter.Inc(1)
+	p.addPeer(node)
+	select {
+	case <-time.After(PunchTimeout):
+	case <-p.quit:
+		return
+	}
+	if p.connected(node.ID()) {
+		directCounter.Inc(1)
+		p.mtx.Lock()
+		delete(p.pending, node.ID())
+		p.mtx.Unlock()
+		return
+	}
+	if relay == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.pending, node.ID())
+	if _, ok := p.sessions[node.ID()]; ok {
+		return
+	}
+	if _, ok := p.peers[relay.ID()]; !ok {
+		p.logger.Debug("holepunch: relay disconnected", "node", node.ID(), "relay", relay.ID())
+		return
+	}
+	p.logger.Debug("holepunch: dials failed, relaying connection", "node", node.ID(), "relay", relay.ID())
+	p.startSession(node.ID(), relay)
+}
+
+// setPending records that the node coordinates a hole punch until the time and
+// removes the expired records, it must be called with the lock held
+func (p *Puncher) setPending(id enode.ID, until time.Time) {
+	now := time.Now()
+	for pid, t := range p.pending {
+		if now.After(t) {
+			delete(p.pending, pid)
+		}
+	}
+	p.pending[id] = until
+}
+
+// closestRelay returns the peer closest to the address among those relaying
+// connections, it must be called with the lock held
+func (p *Puncher) closestRelay(addr []byte) (relay *network.BzzPeer) {
+	for _, bp := range p.peers {
+		if !network.IsNatRelay(bp.BzzAddr) {
+			continue
+		}
+		if relay == nil || pot.ProxCmp(addr, bp.Over(), relay.Over()) < 0 {
+			relay = bp
+		}
+	}
+	return relay
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package holepunch
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+func init() {
+	PunchDelay = 10 * time.Millisecond
+	PunchTimeout = 100 * time.Millisecond
+}
+
+// TestRelayedConnection tests that two nodes which can not dial each other
+// run their protocols over a connection relayed by a common peer, and that
+// the connection is closed on both ends when one of them stops
+func TestRelayedConnection(t *testing.T) {
+	pubSub := newTestPubSub()
+	a := newTestNode(t, pubSub, false)
+	r := newTestNode(t, pubSub, true)
+	b := newTestNode(t, pubSub, false)
+	defer r.Stop()
+	defer b.Stop()
+	connect(a, r)
+	connect(b, r)
+
+	for i := 0; i < PunchAttempts; i++ {
+		a.Punch(b.addr)
+	}
+
+	a.peer, b.peer = b.node, a.node
+	for _, n := range []*testNode{a, b} {
+		select {
+		case got := <-n.received:
+			if got != n.peer.ID().String() {
+				t.Fatalf("expected message of %v, got %s", n.peer.ID(), got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for relayed message")
+		}
+	}
+
+	a.Stop()
+	waitSessions(t, b.Puncher, 0)
+}
+
+// TestRelayRefused tests that a peer not relaying connections closes
+// the relayed connections opened through it
+func TestRelayRefused(t *testing.T) {
+	pubSub := newTestPubSub()
+	a := newTestNode(t, pubSub, false)
+	r := newTestNode(t, pubSub, false)
+	b := newTestNode(t, pubSub, false)
+	defer a.Stop()
+	defer r.Stop()
+	defer b.Stop()
+	// the peer advertises the capability, but does not relay
+	r.addr = network.NewBzzAddrFromEnode(r.node).WithCapabilities(newTestNode(t, pubSub, true).addr.Capabilities)
+	connect(a, r)
+	connect(b, r)
+
+	for i := 0; i < PunchAttempts; i++ {
+		a.Punch(b.addr)
+	}
+	select {
+	case err := <-a.done:
+		if err != errSessionClosed {
+			t.Fatalf("expected error %v, got %v", errSessionClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for relayed connection to close")
+	}
+	waitSessions(t, a.Puncher, 0)
+	waitSessions(t, b.Puncher, 0)
+}
+
+type testNode struct {
+	*Puncher
+	node     *enode.Node
+	addr     *network.BzzAddr
+	peer     *enode.Node // remote node of the relayed connection
+	received chan string
+	done     chan error // error of the test protocol
+}
+
+// newTestNode creates a puncher of a node which dials fail, the test protocol
+// sends the node ID and reports the message received over relayed connections
+func newTestNode(t *testing.T, pubSub *testPubSub, relay bool) *testNode {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303)
+	addr := network.NewBzzAddrFromEnode(node)
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	bzz := network.NewBzz(&network.BzzConfig{
+		Address:    addr,
+		HiveParams: network.NewHiveParams(),
+		NatRelay:   relay,
+	}, kad, nil, nil, nil, nil, nil)
+	addr.Capabilities = kad.Capabilities
+
+	n := &testNode{
+		Puncher:  New(bzz, pubSub.node(addr.Over()), relay),
+		node:     node,
+		addr:     addr,
+		received: make(chan string, 1),
+		done:     make(chan error, 1),
+	}
+	n.protocols = []p2p.Protocol{
+		{
+			Name:    "test",
+			Version: 1,
+			Length:  1,
+			Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) (err error) {
+				defer func() {
+					n.done <- err
+				}()
+				if err := p2p.Send(rw, 0, node.ID().String()); err != nil {
+					return err
+				}
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				var id string
+				if err := msg.Decode(&id); err != nil {
+					return err
+				}
+				n.received <- id
+				_, err = rw.ReadMsg()
+				return err
+			},
+		},
+	}
+	n.start(func() *enode.Node { return node }, func(*enode.Node) {}, func(enode.ID) bool { return false })
+	return n
+}
+
+// connect runs the connection relay protocol between the nodes over a message pipe
+func connect(x, y *testNode) {
+	xrw, yrw := p2p.MsgPipe()
+	go x.Run(&network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(y.node.ID(), "y", nil), xrw, Spec),
+		BzzAddr: y.addr,
+	})
+	go y.Run(&network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(x.node.ID(), "x", nil), yrw, Spec),
+		BzzAddr: x.addr,
+	})
+	for _, n := range []*testNode{x, y} {
+		for i := 0; i < 100; i++ {
+			n.mtx.Lock()
+			c := len(n.peers)
+			n.mtx.Unlock()
+			if c > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// waitSessions waits for the puncher to have the number of relayed connections
+func waitSessions(t *testing.T, p *Puncher, want int) {
+	t.Helper()
+	var got int
+	for i := 0; i < 500; i++ {
+		p.mtx.Lock()
+		got = len(p.sessions)
+		p.mtx.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d relayed connections, got %d", want, got)
+}
+
+// testPubSub delivers the messages sent to the overlay address of a node to its handlers
+type testPubSub struct {
+	mtx      sync.Mutex
+	handlers map[string]func(msg []byte, p *p2p.Peer) error
+}
+
+func newTestPubSub() *testPubSub {
+	return &testPubSub{handlers: make(map[string]func(msg []byte, p *p2p.Peer) error)}
+}
+
+// node returns the PubSub of the node with the overlay address
+func (ps *testPubSub) node(addr []byte) PubSub {
+	return &testNodePubSub{ps: ps, addr: addr}
+}
+
+type testNodePubSub struct {
+	ps   *testPubSub
+	addr []byte
+}
+
+func (n *testNodePubSub) Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func() {
+	n.ps.mtx.Lock()
+	defer n.ps.mtx.Unlock()
+	n.ps.handlers[topic+string(n.addr)] = handler
+	return func() {
+		n.ps.mtx.Lock()
+		defer n.ps.mtx.Unlock()
+		delete(n.ps.handlers, topic+string(n.addr))
+	}
+}
+
+func (n *testNodePubSub) Send(to []byte, topic string, msg []byte) error {
+	n.ps.mtx.Lock()
+	handler, ok := n.ps.handlers[topic+string(to)]
+	n.ps.mtx.Unlock()
+	if !ok {
+		return fmt.Errorf("no handler of %x", to)
+	}
+	return handler(msg, nil)
+}
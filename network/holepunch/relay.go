@@ -0,0 +1,249 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package holepunch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/network"
+)
+
+// session is a connection with a remote node relayed by a peer, over which the protocols run
+type session struct {
+	local  enode.ID
+	remote enode.ID
+	relay  *network.BzzPeer
+	rws    map[string]*relayRW // message readwriters by protocol name
+	quit   chan struct{}
+	once   sync.Once
+}
+
+// relayRW is the p2p.MsgReadWriter of a protocol running over a relayed connection
+type relayRW struct {
+	s        *session
+	protocol string
+	in       chan p2p.Msg
+}
+
+// ReadMsg returns the next message of the protocol forwarded by the relay
+func (rw *relayRW) ReadMsg() (p2p.Msg, error) {
+	select {
+	case msg := <-rw.in:
+		return msg, nil
+	case <-rw.s.quit:
+		return p2p.Msg{}, errSessionClosed
+	}
+}
+
+// WriteMsg sends the message to the relay in a frame
+func (rw *relayRW) WriteMsg(msg p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-rw.s.quit:
+		return errSessionClosed
+	default:
+	}
+	return rw.s.relay.Send(context.TODO(), &FrameMsg{
+		From:     rw.s.local,
+		To:       rw.s.remote,
+		Protocol: rw.protocol,
+		Code:     msg.Code,
+		Payload:  payload,
+	})
+}
+
+// deliver passes the message of the frame to the protocol it belongs to
+func (s *session) deliver(msg *FrameMsg) {
+	rw, ok := s.rws[msg.Protocol]
+	if !ok {
+		return
+	}
+	select {
+	case rw.in <- p2p.Msg{
+		Code:       msg.Code,
+		Size:       uint32(len(msg.Payload)),
+		Payload:    bytes.NewReader(msg.Payload),
+		ReceivedAt: time.Now(),
+	}:
+	case <-s.quit:
+	}
+}
+
+// Run is the protocol run function of the connection relay protocol
+func (p *Puncher) Run(bp *network.BzzPeer) error {
+	p.mtx.Lock()
+	p.peers[bp.ID()] = bp
+	p.mtx.Unlock()
+	defer func() {
+		p.mtx.Lock()
+		delete(p.peers, bp.ID())
+		var closed []*session
+		for _, s := range p.sessions {
+			if s.relay == bp {
+				closed = append(closed, s)
+			}
+		}
+		p.mtx.Unlock()
+		for _, s := range closed {
+			p.closeSession(s, false)
+		}
+	}()
+
+	return bp.Run(func(ctx context.Context, msg interface{}) error {
+		switch msg := msg.(type) {
+		case *FrameMsg:
+			return p.handleFrameMsg(ctx, bp, msg)
+		case *CloseMsg:
+			return p.handleCloseMsg(ctx, bp, msg)
+		}
+		return fmt.Errorf("unknown message type: %T", msg)
+	})
+}
+
+// handleFrameMsg forwards the frame if it is addressed to another node, otherwise
+// it delivers the frame to the relayed connection with the sender. A relayed connection
+// is accepted from nodes coordinating a hole punch.
+func (p *Puncher) handleFrameMsg(ctx context.Context, bp *network.BzzPeer, msg *FrameMsg) error {
+	if msg.To != p.self().ID() {
+		return p.forward(ctx, bp, msg.From, msg.To, msg)
+	}
+	p.mtx.Lock()
+	s, ok := p.sessions[msg.From]
+	if !ok {
+		until, pending := p.pending[msg.From]
+		if !pending || time.Now().After(until) {
+			p.mtx.Unlock()
+			p.logger.Debug("holepunch: frame of unknown connection", "node", msg.From, "relay", bp.ID())
+			return bp.Send(ctx, &CloseMsg{From: msg.To, To: msg.From})
+		}
+		delete(p.pending, msg.From)
+		s = p.startSession(msg.From, bp)
+	}
+	p.mtx.Unlock()
+	if s.relay != bp {
+		return nil
+	}
+	s.deliver(msg)
+	return nil
+}
+
+// handleCloseMsg forwards the message if it is addressed to another node,
+// otherwise it closes the relayed connection with the sender
+func (p *Puncher) handleCloseMsg(ctx context.Context, bp *network.BzzPeer, msg *CloseMsg) error {
+	if msg.To != p.self().ID() {
+		return p.forward(ctx, bp, msg.From, msg.To, msg)
+	}
+	p.mtx.Lock()
+	s, ok := p.sessions[msg.From]
+	p.mtx.Unlock()
+	if ok && s.relay == bp {
+		p.closeSession(s, false)
+	}
+	return nil
+}
+
+// forward sends the message of the peer to the node it is addressed to if relaying
+// is enabled and the node is a peer, otherwise the connection is closed with the sender
+func (p *Puncher) forward(ctx context.Context, bp *network.BzzPeer, from, to enode.ID, msg interface{}) error {
+	if from != bp.ID() {
+		return fmt.Errorf("relayed message of %v sent by %v", from, bp.ID())
+	}
+	p.mtx.Lock()
+	peer, ok := p.peers[to]
+	p.mtx.Unlock()
+	if !p.relay || !ok {
+		if _, isClose := msg.(*CloseMsg); isClose {
+			return nil
+		}
+		p.logger.Debug("holepunch: can not relay", "from", from, "to", to, "relay", p.relay)
+		return bp.Send(ctx, &CloseMsg{From: to, To: from})
+	}
+	forwardCounter.Inc(1)
+	if err := peer.Send(ctx, msg); err != nil {
+		p.logger.Debug("holepunch: forward failed", "from", from, "to", to, "err", err)
+	}
+	return nil
+}
+
+// startSession runs the protocols over a connection with the remote node relayed
+// by the peer, it must be called with the lock held
+func (p *Puncher) startSession(remote enode.ID, relay *network.BzzPeer) *session {
+	s := &session{
+		local:  p.self().ID(),
+		remote: remote,
+		relay:  relay,
+		rws:    make(map[string]*relayRW),
+		quit:   make(chan struct{}),
+	}
+	var caps []p2p.Cap
+	for _, proto := range p.protocols {
+		s.rws[proto.Name] = &relayRW{s: s, protocol: proto.Name, in: make(chan p2p.Msg, 64)}
+		caps = append(caps, p2p.Cap{Name: proto.Name, Version: proto.Version})
+	}
+	p.sessions[remote] = s
+	relayedCounter.Inc(1)
+
+	peer := p2p.NewPeer(remote, "relayed", caps)
+	for _, proto := range p.protocols {
+		proto := proto
+		go func() {
+			err := proto.Run(peer, s.rws[proto.Name])
+			p.logger.Debug("holepunch: relayed protocol ended", "node", remote, "protocol", proto.Name, "err", err)
+			p.closeSession(s, true)
+		}()
+	}
+	return s
+}
+
+// closeSession ends the protocols of the relayed connection, notifying the remote node if notify is set
+func (p *Puncher) closeSession(s *session, notify bool) {
+	s.once.Do(func() {
+		close(s.quit)
+		p.mtx.Lock()
+		if p.sessions[s.remote] == s {
+			delete(p.sessions, s.remote)
+		}
+		p.mtx.Unlock()
+		if notify {
+			if err := s.relay.Send(context.TODO(), &CloseMsg{From: s.local, To: s.remote}); err != nil {
+				p.logger.Debug("holepunch: close failed", "node", s.remote, "err", err)
+			}
+		}
+	})
+}
+
+// Protocols returns the connection relay protocol
+func (p *Puncher) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{
+			Name:    Spec.Name,
+			Version: Spec.Version,
+			Length:  Spec.Length(),
+			Run:     p.bzz.RunProtocol(Spec, p.Run),
+		},
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package holepunch
+
+import (
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// Spec is the spec of the connection relay protocol
+var Spec = &protocols.Spec{
+	Name:       "bzz-relay",
+	Version:    1,
+	MaxMsgSize: 11 * 1024 * 1024, // the messages of the relayed protocols are up to 10MB
+	Messages: []interface{}{
+		FrameMsg{},
+		CloseMsg{},
+	},
+}
+
+// FrameMsg carries a message of a protocol between the two ends of a relayed connection,
+// the relay forwards it to its peer with the To node ID
+type FrameMsg struct {
+	From     enode.ID
+	To       enode.ID
+	Protocol string // name of the protocol of the message
+	Code     uint64
+	Payload  []byte
+}
+
+// CloseMsg ends the relayed connection between From and To
+type CloseMsg struct {
+	From enode.ID
+	To   enode.ID
+}
+
+// signalMsg is sent over pss to coordinate the simultaneous dials of a hole punch
+type signalMsg struct {
+	Enode string // enode URL of the sender
+	Relay string // enode URL of the relay used if the dials fail, empty if there is none
+	At    uint64 // unix time in nanoseconds at which both nodes dial
+}
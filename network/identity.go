@@ -0,0 +1,153 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var (
+	// ErrNoCredential is returned if a peer of a private swarm presents no credential
+	ErrNoCredential = errors.New("no identity credential")
+	// ErrUntrustedCredential is returned if the credential is not issued by a trusted authority
+	ErrUntrustedCredential = errors.New("identity credential not issued by a trusted authority")
+	// ErrRevokedCredential is returned if the identity of the peer is revoked
+	ErrRevokedCredential = errors.New("identity revoked")
+)
+
+// IdentityProvider vouches for the identity of the node in the bzz handshake and
+// verifies the identities of its peers, so that only vetted nodes join a private swarm
+type IdentityProvider interface {
+	// Credential returns the credential that the node presents to its peers
+	Credential() []byte
+	// Verify returns an error if the credential does not vouch for the peer
+	// with the underlay id and overlay address
+	Verify(id enode.ID, addr *BzzAddr, credential []byte) error
+}
+
+// SignatureIdentity is an IdentityProvider for credentials signed by trusted
+// authorities, typically the keys of the organisation running the swarm.
+// A credential is the signature of the underlay id and the overlay address of a node.
+type SignatureIdentity struct {
+	credential  []byte
+	authorities map[common.Address]bool
+	mtx         sync.RWMutex
+	revoked     map[string]bool // revoked overlay addresses
+}
+
+// NewSignatureIdentity creates a SignatureIdentity presenting the credential of the node
+// and accepting the credentials issued by the authorities
+func NewSignatureIdentity(credential []byte, authorities []common.Address) *SignatureIdentity {
+	s := &SignatureIdentity{
+		credential:  credential,
+		authorities: make(map[common.Address]bool),
+		revoked:     make(map[string]bool),
+	}
+	for _, a := range authorities {
+		s.authorities[a] = true
+	}
+	return s
+}
+
+// IssueCredential signs the credential of the node with the underlay id and
+// overlay address with the key of the authority
+func IssueCredential(key *ecdsa.PrivateKey, id enode.ID, overlay []byte) ([]byte, error) {
+	return crypto.Sign(credentialHash(id, overlay), key)
+}
+
+// credentialHash is the hash signed by the authority
+func credentialHash(id enode.ID, overlay []byte) []byte {
+	return crypto.Keccak256([]byte("swarm-identity"), id[:], overlay)
+}
+
+// Credential implements IdentityProvider
+func (s *SignatureIdentity) Credential() []byte {
+	return s.credential
+}
+
+// Verify implements IdentityProvider
+func (s *SignatureIdentity) Verify(id enode.ID, addr *BzzAddr, credential []byte) error {
+	if len(credential) == 0 {
+		return ErrNoCredential
+	}
+	pubkey, err := crypto.SigToPub(credentialHash(id, addr.Over()), credential)
+	if err != nil {
+		return fmt.Errorf("invalid identity credential: %v", err)
+	}
+	if !s.authorities[crypto.PubkeyToAddress(*pubkey)] {
+		return ErrUntrustedCredential
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.revoked[string(addr.Over())] {
+		return ErrRevokedCredential
+	}
+	return nil
+}
+
+// Revoke adds the overlay addresses to the revocation list
+func (s *SignatureIdentity) Revoke(overlays ...[]byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, o := range overlays {
+		s.revoked[string(o)] = true
+	}
+}
+
+// LoadRevocationList replaces the revocation list with the overlay addresses read
+// from the file, one hex encoded address per line. Empty lines and lines starting
+// with # are ignored.
+func (s *SignatureIdentity) LoadRevocationList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	revoked := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		overlay, err := hex.DecodeString(strings.TrimPrefix(line, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid revoked address %q: %v", line, err)
+		}
+		revoked[string(overlay)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	s.revoked = revoked
+	s.mtx.Unlock()
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	p2ptest "github.com/ethersphere/swarm/p2p/testing"
+)
+
+// TestSignatureIdentity tests the verification of credentials issued by authorities
+func TestSignatureIdentity(t *testing.T) {
+	authority, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := NewSignatureIdentity(nil, []common.Address{crypto.PubkeyToAddress(authority.PublicKey)})
+
+	addr := RandomBzzAddr()
+	id := enode.ID{1}
+	credential, err := IssueCredential(authority, id, addr.Over())
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, err := IssueCredential(other, id, addr.Over())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := identity.Verify(id, addr, credential); err != nil {
+		t.Fatal(err)
+	}
+	if err := identity.Verify(id, addr, nil); err != ErrNoCredential {
+		t.Fatalf("expected error %v, got %v", ErrNoCredential, err)
+	}
+	if err := identity.Verify(id, addr, untrusted); err != ErrUntrustedCredential {
+		t.Fatalf("expected error %v, got %v", ErrUntrustedCredential, err)
+	}
+	// the credential is bound to the underlay id and the overlay address
+	if err := identity.Verify(enode.ID{2}, addr, credential); err != ErrUntrustedCredential {
+		t.Fatalf("expected error %v, got %v", ErrUntrustedCredential, err)
+	}
+	if err := identity.Verify(id, RandomBzzAddr(), credential); err != ErrUntrustedCredential {
+		t.Fatalf("expected error %v, got %v", ErrUntrustedCredential, err)
+	}
+
+	identity.Revoke(addr.Over())
+	if err := identity.Verify(id, addr, credential); err != ErrRevokedCredential {
+		t.Fatalf("expected error %v, got %v", ErrRevokedCredential, err)
+	}
+
+	// loading a revocation list replaces the revoked addresses
+	f, err := ioutil.TempFile("", "swarm-revocation-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	revoked := RandomBzzAddr()
+	fmt.Fprintf(f, "# revoked nodes\n\n0x%x\n", revoked.Over())
+	f.Close()
+	if err := identity.LoadRevocationList(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := identity.Verify(id, addr, credential); err != nil {
+		t.Fatal(err)
+	}
+	revokedCredential, err := IssueCredential(authority, id, revoked.Over())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := identity.Verify(id, revoked, revokedCredential); !errors.Is(err, ErrRevokedCredential) {
+		t.Fatalf("expected error %v, got %v", ErrRevokedCredential, err)
+	}
+}
+
+// TestBzzHandshakeIdentity tests that only peers with valid credentials
+// complete the bzz handshake and that revoked peers are dropped
+func TestBzzHandshakeIdentity(t *testing.T) {
+	authority, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorities := []common.Address{crypto.PubkeyToAddress(authority.PublicKey)}
+
+	t.Run("valid", func(t *testing.T) {
+		s, identity := newBzzIdentityTester(t, authority, authorities)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+		rhs.Credential, err = IssueCredential(authority, node.ID(), rhs.Addr.Over())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.Credential = identity.Credential()
+		if err := s.testHandshake(lhs, rhs); err != nil {
+			t.Fatal(err)
+		}
+
+		// revoking the peer drops it
+		identity.Revoke(rhs.Addr.Over())
+		s.bzz.RevalidatePeers()
+		err = s.TestDisconnected(&p2ptest.Disconnect{Peer: node.ID(), Error: errors.New("subprotocol error")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("no credential", func(t *testing.T) {
+		s, identity := newBzzIdentityTester(t, authority, authorities)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.Credential = identity.Credential()
+		err := s.testHandshake(
+			lhs,
+			newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false),
+			&p2ptest.Disconnect{Peer: node.ID(), Error: fmt.Errorf("message handler: (msg code 0): identity verification failed: %v", ErrNoCredential)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// newBzzIdentityTester creates a bzz handshake tester for a node with a credential issued by the authority
+func newBzzIdentityTester(t *testing.T, authority *ecdsa.PrivateKey, authorities []common.Address) (*bzzTester, *SignatureIdentity) {
+	t.Helper()
+
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record enr.Record
+	record.Set(NewENRAddrEntry(PrivateKeyToBzzKey(prvkey)))
+	if err := enode.SignV4(&record, prvkey); err != nil {
+		t.Fatal(err)
+	}
+	nod, err := enode.New(enode.V4ID{}, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := getENRBzzAddr(nod)
+	credential, err := IssueCredential(authority, nod.ID(), addr.Over())
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := NewSignatureIdentity(credential, authorities)
+
+	config := &BzzConfig{
+		Address:    addr,
+		HiveParams: NewHiveParams(),
+		NetworkID:  DefaultTestNetworkID,
+		Identity:   identity,
+	}
+	bzz := NewBzz(config, NewKademlia(addr.OAddr, NewKadParams()), nil, nil, nil, nil, nil)
+	return &bzzTester{
+		addr:           addr,
+		ProtocolTester: p2ptest.NewProtocolTester(prvkey, 1, bzz.runBzz),
+		bzz:            bzz,
+	}, identity
+}
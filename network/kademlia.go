@@ -101,6 +101,12 @@ type Kademlia struct {
 	nDepthSig       []chan struct{}             // signals when neighbourhood depth nDepth is changed
 
 	onOffPeerPubSub *pubsubchannel.PubSubChannel // signals on and off peers in the table
+	capsPubSub      *pubsubchannel.PubSubChannel // signals capability changes of peers in the table
+
+	labels *PeerLabels // labels operators assign to peers, nil if not set
+	scores *PeerScores // reputation of peers evicting the lowest scored from overfull bins, nil if not set
+
+	leaves map[string]*BzzAddr // leaf peers by overlay address, not part of the table
 }
 
 type KademliaInfo struct {
@@ -110,6 +116,7 @@ type KademliaInfo struct {
 	TotalKnown       int        `json:"total_known"`
 	Connections      [][]string `json:"connections"`
 	Known            [][]string `json:"known"`
+	Leaves           int        `json:"leaves"`
 }
 
 // NewKademlia creates a Kademlia table for base address addr
@@ -128,6 +135,8 @@ func NewKademlia(addr []byte, params *KadParams) *Kademlia {
 		capabilityIndex: make(map[string]*capabilityIndex),
 		defaultIndex:    NewDefaultIndex(),
 		onOffPeerPubSub: pubsubchannel.New(100),
+		capsPubSub:      pubsubchannel.New(100),
+		leaves:          make(map[string]*BzzAddr),
 	}
 	k.RegisterCapabilityIndex("full", *fullCapability)
 	k.RegisterCapabilityIndex("light", *lightCapability)
@@ -499,7 +508,17 @@ func (k *Kademlia) suggestPeerInBinByGap(bin *pot.Bin) *BzzAddr {
 }
 
 // On inserts the peer as a kademlia peer into the live peers
+// if peer scores are set and the bin of the peer outside the neighbourhood holds more than
+// MaxBinSize peers, the lowest scored peer of the bin is dropped, possibly the inserted one
 func (k *Kademlia) On(p *Peer) (uint8, bool) {
+	var evicted *Peer
+	defer func() {
+		// drop after releasing the lock as disconnecting calls back into the kademlia
+		if evicted != nil {
+			metrics.GetOrRegisterCounter("kad/evict", nil).Inc(1)
+			evicted.Drop("evicted from overfull kademlia bin")
+		}
+	}()
 	k.lock.Lock()
 	defer k.lock.Unlock()
 	metrics.GetOrRegisterCounter("kad/on", nil).Inc(1)
@@ -529,6 +548,7 @@ func (k *Kademlia) On(p *Peer) (uint8, bool) {
 		index.addrs, _, _, _ = pot.Swap(index.addrs, a, Pof, func(v pot.Val) pot.Val {
 			return a
 		})
+		evicted = k.evictionCandidate(po)
 	}
 	// calculate if depth of saturation changed
 	depth := uint8(k.saturation())
@@ -632,6 +652,84 @@ func (k *Kademlia) SubscribeToPeerChanges() *pubsubchannel.Subscription {
 	return k.onOffPeerPubSub.Subscribe()
 }
 
+// OnLeaf counts a leaf peer, a client connected to the node that neither stores chunks
+// nor routes messages, such as a browser connected through a bridge. Leaf peers are
+// not in the table: they are never iterated, advertised nor accounted for the depth.
+// It returns false if a leaf peer with the same overlay address is already counted.
+func (k *Kademlia) OnLeaf(addr *BzzAddr) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key := string(addr.Address())
+	if _, ok := k.leaves[key]; ok {
+		return false
+	}
+	k.leaves[key] = addr
+	metrics.GetOrRegisterGauge("kad/leaves", nil).Update(int64(len(k.leaves)))
+	return true
+}
+
+// OffLeaf stops counting the leaf peer
+func (k *Kademlia) OffLeaf(addr *BzzAddr) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	delete(k.leaves, string(addr.Address()))
+	metrics.GetOrRegisterGauge("kad/leaves", nil).Update(int64(len(k.leaves)))
+}
+
+// Leaves returns the number of leaf peers counted
+func (k *Kademlia) Leaves() int {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return len(k.leaves)
+}
+
+// CapabilityChange is the signal published when a connected peer announces new capabilities
+type CapabilityChange struct {
+	Peer *Peer
+}
+
+// SubscribeToCapabilityChanges returns a subscription that receives a CapabilityChange
+// message whenever a connected peer changes its capabilities.
+func (k *Kademlia) SubscribeToCapabilityChanges() *pubsubchannel.Subscription {
+	return k.capsPubSub.Subscribe()
+}
+
+// IsStorer returns whether the local node stores the chunks of its neighbourhood
+// according to its own advertised capabilities
+func (k *Kademlia) IsStorer() bool {
+	return isStorer(k.Capabilities)
+}
+
+// UpdateCapabilities sets the capabilities of the peer with the given address and, if
+// the peer is connected, reindexes it in the capability indices.
+// The capabilities are set under the kademlia lock so that a peer being added
+// concurrently is indexed with either the old or the new capabilities.
+func (k *Kademlia) UpdateCapabilities(addr *BzzAddr, caps *capability.Capabilities) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	var p *Peer
+	// the closest connected peer is the peer itself if connected
+	k.defaultIndex.conns.EachNeighbour(addr.Over(), Pof, func(val pot.Val, _ int) bool {
+		if e := val.(*entry); bytes.Equal(e.Address(), addr.Over()) {
+			p = e.conn
+		}
+		return false
+	})
+	if p == nil {
+		// the peer is not yet in the kademlia table
+		addr.Capabilities = caps
+		return
+	}
+
+	k.removeFromCapabilityIndex(p, false)
+	p.BzzAddr.Capabilities = caps
+	k.addToCapabilityIndex(p)
+	k.addToCapabilityIndex(newEntryFromBzzAddress(p.BzzAddr))
+	k.setNeighbourhoodDepth()
+	k.capsPubSub.Publish(CapabilityChange{Peer: p})
+}
+
 // Off removes a peer from among live peers
 func (k *Kademlia) Off(p *Peer) {
 	k.lock.Lock()
@@ -936,6 +1034,7 @@ func (k *Kademlia) kademliaInfo() (ki KademliaInfo) {
 	ki.Depth = depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
 	ki.TotalConnections = k.defaultIndex.conns.Size()
 	ki.TotalKnown = k.defaultIndex.addrs.Size()
+	ki.Leaves = len(k.leaves)
 	ki.Connections = make([][]string, k.MaxProxDisplay)
 	ki.Known = make([][]string, k.MaxProxDisplay)
 
@@ -997,6 +1096,9 @@ func (k *Kademlia) string() string {
 	}
 	rows = append(rows, fmt.Sprintf("%v KΛÐΞMLIΛ hive: queen's address: %x", time.Now().UTC().Format(time.UnixDate), k.BaseAddr()))
 	rows = append(rows, fmt.Sprintf("population: %d (%d), NeighbourhoodSize: %d, MinBinSize: %d, MaxBinSize: %d", k.defaultIndex.conns.Size(), k.defaultIndex.addrs.Size(), k.NeighbourhoodSize, k.MinBinSize, k.MaxBinSize))
+	if len(k.leaves) > 0 {
+		rows = append(rows, fmt.Sprintf("leaves: %d", len(k.leaves)))
+	}
 
 	liverows := make([]string, k.MaxProxDisplay)
 	peersrows := make([]string, k.MaxProxDisplay)
@@ -17,6 +17,7 @@
 package network
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"testing"
@@ -1159,3 +1160,33 @@ func (tk *testKademlia) getAddressBin(po int) *pot.Bin {
 func bzzAddrToBinary(bzzAddress *BzzAddr) string {
 	return byteToBitString(bzzAddress.OAddr[0])
 }
+
+// TestLeaves checks that leaf peers are counted but not part of the table
+func TestLeaves(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.On("10000000")
+	leaf := testKadPeerAddr("01000000")
+	if !tk.OnLeaf(leaf) {
+		t.Fatal("expected leaf peer counted")
+	}
+	if tk.OnLeaf(leaf) {
+		t.Fatal("expected leaf peer with the same address refused")
+	}
+	if n := tk.Leaves(); n != 1 {
+		t.Fatalf("expected 1 leaf peer, got %d", n)
+	}
+	info := tk.KademliaInfo()
+	if info.Leaves != 1 || info.TotalConnections != 1 {
+		t.Fatalf("expected 1 leaf peer and 1 connection, got %d and %d", info.Leaves, info.TotalConnections)
+	}
+	tk.EachConn(nil, 255, func(p *Peer, _ int) bool {
+		if bytes.Equal(p.Address(), leaf.Address()) {
+			t.Fatal("expected leaf peer not iterated")
+		}
+		return true
+	})
+	tk.OffLeaf(leaf)
+	if n := tk.Leaves(); n != 0 {
+		t.Fatalf("expected no leaf peers, got %d", n)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ethersphere/swarm/state"
+)
+
+// the state store key prefix of the peer labels
+const peerLabelPrefix = "peer_label_"
+
+// maximum length of a peer label
+const maxPeerLabelLength = 64
+
+// ErrInvalidPeerLabel is returned when a label is too long or contains control characters
+var ErrInvalidPeerLabel = errors.New("invalid peer label")
+
+// PeerLabels holds the human readable labels operators assign to the overlay addresses
+// or enode IDs of known nodes, persisted in the state store; logs, metrics and RPC
+// outputs show the label of a peer if it has one
+type PeerLabels struct {
+	mu     sync.RWMutex
+	store  state.Store
+	labels map[string]string // labels by hex address
+}
+
+// NewPeerLabels creates PeerLabels with the labels persisted in the store
+func NewPeerLabels(store state.Store) (*PeerLabels, error) {
+	l := &PeerLabels{
+		store:  store,
+		labels: make(map[string]string),
+	}
+	err := store.Iterate(peerLabelPrefix, func(key, value []byte) (bool, error) {
+		var label string
+		if err := json.Unmarshal(value, &label); err != nil {
+			return true, fmt.Errorf("decode peer label %s: %v", key, err)
+		}
+		l.labels[strings.TrimPrefix(string(key), peerLabelPrefix)] = label
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Set labels the overlay address or enode ID, an empty label removes the label
+func (l *PeerLabels) Set(addr []byte, label string) error {
+	label = strings.TrimSpace(label)
+	if len(label) > maxPeerLabelLength || strings.IndexFunc(label, unicode.IsControl) >= 0 {
+		return ErrInvalidPeerLabel
+	}
+	key := hex.EncodeToString(addr)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if label == "" {
+		if err := l.store.Delete(peerLabelPrefix + key); err != nil {
+			return err
+		}
+		delete(l.labels, key)
+		return nil
+	}
+	if err := l.store.Put(peerLabelPrefix+key, label); err != nil {
+		return err
+	}
+	l.labels[key] = label
+	return nil
+}
+
+// Get returns the label of the overlay address or enode ID,
+// empty if it has none or the labels are nil
+func (l *PeerLabels) Get(addr []byte) string {
+	if l == nil {
+		return ""
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.labels[hex.EncodeToString(addr)]
+}
+
+// Lookup returns the label of the peer by its overlay address or else its enode ID
+func (l *PeerLabels) Lookup(a *BzzAddr) string {
+	if l == nil {
+		return ""
+	}
+	if label := l.Get(a.Over()); label != "" {
+		return label
+	}
+	if len(a.UAddr) == 0 {
+		return ""
+	}
+	id := a.ID()
+	return l.Get(id[:])
+}
+
+// All returns the labels by hex address
+func (l *PeerLabels) All() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	labels := make(map[string]string, len(l.labels))
+	for k, v := range l.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// SetPeerLabels sets the labels shown for the peers, it must be called before
+// the kademlia is used
+func (k *Kademlia) SetPeerLabels(l *PeerLabels) {
+	k.labels = l
+}
+
+// PeerLabels returns the labels of the peers, nil if not set
+func (k *Kademlia) PeerLabels() *PeerLabels {
+	return k.labels
+}
+
+// PeerMetricName returns the label of the peer as used in the names of the per peer
+// metrics, with the characters other than letters and digits replaced by underscores,
+// or the hex of the first half of the overlay address if the peer has no label
+func (k *Kademlia) PeerMetricName(a *BzzAddr) string {
+	label := k.labels.Lookup(a)
+	if label == "" {
+		return fmt.Sprintf("%x", a.Over()[:16])
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, label)
+}
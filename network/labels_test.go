@@ -0,0 +1,141 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/swarm/pot"
+	"github.com/ethersphere/swarm/state"
+)
+
+// TestPeerLabels tests labelling peers by overlay address and enode ID and
+// that the labels persist in the state store
+func TestPeerLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer-labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := state.NewDBStore(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	labels, err := NewPeerLabels(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byOverlay := RandomBzzAddr()
+	if err := labels.Set(byOverlay.Over(), " gateway-1 "); err != nil {
+		t.Fatal(err)
+	}
+	byEnode := NewBzzAddr(RandomBzzAddr().Over(), RandomBzzAddr().UAddr)
+	id := byEnode.ID()
+	if err := labels.Set(id[:], "bootnode"); err != nil {
+		t.Fatal(err)
+	}
+	if err := labels.Set(byOverlay.Over(), "bad\nlabel"); err != ErrInvalidPeerLabel {
+		t.Fatalf("expected %v, got %v", ErrInvalidPeerLabel, err)
+	}
+	if err := labels.Set(byOverlay.Over(), strings.Repeat("a", maxPeerLabelLength+1)); err != ErrInvalidPeerLabel {
+		t.Fatalf("expected %v, got %v", ErrInvalidPeerLabel, err)
+	}
+
+	// reload the labels from the store
+	labels, err = NewPeerLabels(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := labels.Lookup(byOverlay); label != "gateway-1" {
+		t.Fatalf("expected label gateway-1 by overlay, got %q", label)
+	}
+	if label := labels.Lookup(byEnode); label != "bootnode" {
+		t.Fatalf("expected label bootnode by enode ID, got %q", label)
+	}
+	if label := labels.Lookup(RandomBzzAddr()); label != "" {
+		t.Fatalf("expected no label, got %q", label)
+	}
+	if all := labels.All(); len(all) != 2 || all[hex.EncodeToString(byOverlay.Over())] != "gateway-1" {
+		t.Fatalf("got labels %v", all)
+	}
+
+	// an empty label removes the label
+	if err := labels.Set(id[:], ""); err != nil {
+		t.Fatal(err)
+	}
+	labels, err = NewPeerLabels(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := labels.Lookup(byEnode); label != "" {
+		t.Fatalf("expected the label to be removed, got %q", label)
+	}
+
+	var nilLabels *PeerLabels
+	if label := nilLabels.Lookup(byOverlay); label != "" {
+		t.Fatalf("expected no label from nil labels, got %q", label)
+	}
+}
+
+// TestPeerLabelsKademlia tests that the labels show in the peer labels,
+// the metric names and the topology
+func TestPeerLabelsKademlia(t *testing.T) {
+	labels, err := NewPeerLabels(state.NewInmemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := newTestKademlia(t, "00000000")
+	tk.SetPeerLabels(labels)
+	tk.On("10000000", "01000000")
+
+	labelled := pot.NewAddressFromString("10000000")
+	if err := labels.Set(labelled, "eu west/1"); err != nil {
+		t.Fatal(err)
+	}
+	p := tk.newTestKadPeer("10000000")
+	if label := p.Label(); label != "eu west/1" {
+		t.Fatalf("expected peer label, got %q", label)
+	}
+	if name := tk.PeerMetricName(p.BzzAddr); name != "eu_west_1" {
+		t.Fatalf("expected metric name eu_west_1, got %q", name)
+	}
+	unlabelled := tk.newTestKadPeer("01000000")
+	if name := tk.PeerMetricName(unlabelled.BzzAddr); name != hex.EncodeToString(unlabelled.Over()[:16]) {
+		t.Fatalf("expected hex metric name, got %q", name)
+	}
+
+	topology := tk.Topology()
+	for _, n := range topology.Nodes {
+		exp := ""
+		if n.ID == hex.EncodeToString(labelled) {
+			exp = "eu west/1"
+		}
+		if n.Label != exp {
+			t.Fatalf("node %s: expected label %q, got %q", n.ID, exp, n.Label)
+		}
+	}
+	if !strings.Contains(topology.DOT(), "eu west/1") {
+		t.Fatal("expected the label in the DOT graph")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -19,6 +20,8 @@ type BzzAddr struct {
 	OAddr        []byte
 	UAddr        []byte
 	Capabilities *capability.Capabilities
+	AltUAddrs    [][]byte // additional underlay addresses of the node, e.g. over IPv6
+	QuicPort     uint16   // UDP port the node accepts connections over QUIC on, 0 if none
 }
 
 // EncodeRLP implements rlp.Encoder
@@ -39,7 +42,15 @@ func (b *BzzAddr) EncodeRLP(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	alts := b.AltUAddrs
+	if alts == nil {
+		alts = [][]byte{}
+	}
+	err = rlp.Encode(w, alts)
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, b.QuicPort)
 }
 
 // DecodeRLP implements rlp.Decoder
@@ -63,6 +74,16 @@ func (b *BzzAddr) DecodeRLP(s *rlp.Stream) error {
 	if err != nil {
 		return fmt.Errorf("caps --- %v", err)
 	}
+	var alts [][]byte
+	if err := s.Decode(&alts); err != nil {
+		return fmt.Errorf("altuaddrs --- %v", err)
+	}
+	if len(alts) > 0 {
+		b.AltUAddrs = alts
+	}
+	if err := s.Decode(&b.QuicPort); err != nil {
+		return fmt.Errorf("quicport --- %v", err)
+	}
 	return nil
 }
 
@@ -91,6 +112,11 @@ func (a *BzzAddr) Under() []byte {
 	return a.UAddr
 }
 
+// Unders returns the underlay addresses, the preferred one first
+func (a *BzzAddr) Unders() [][]byte {
+	return append([][]byte{a.UAddr}, a.AltUAddrs...)
+}
+
 // ShortString returns shortened versions of overlay and underlay address in a format: shortOver:shortUnder
 // It can be used for logging
 func (a *BzzAddr) ShortString() string {
@@ -126,14 +152,17 @@ func (a *BzzAddr) ID() enode.ID {
 	return n.ID()
 }
 
-// Update updates the underlay address of a peer record
+// Update updates the underlay addresses of a peer record
 func (a *BzzAddr) Update(na *BzzAddr) *BzzAddr {
-	return &BzzAddr{a.OAddr, na.UAddr, a.Capabilities}
+	return &BzzAddr{a.OAddr, na.UAddr, a.Capabilities, na.AltUAddrs, na.QuicPort}
 }
 
 // String pretty prints the address
 func (a *BzzAddr) String() string {
-	return fmt.Sprintf("%x <%s> cap:%s", a.OAddr, a.UAddr, a.Capabilities)
+	if len(a.AltUAddrs) == 0 {
+		return fmt.Sprintf("%x <%s> cap:%s", a.OAddr, a.UAddr, a.Capabilities)
+	}
+	return fmt.Sprintf("%x <%s> %s cap:%s", a.OAddr, a.UAddr, a.AltUAddrs, a.Capabilities)
 }
 
 // RandomBzzAddr is a utility method generating a private key and corresponding enode id
@@ -160,6 +189,38 @@ func (b *BzzAddr) WithCapabilities(c *capability.Capabilities) *BzzAddr {
 	return b
 }
 
+// AltUnderlays returns the enode URLs of the node at the alternative underlay addresses,
+// given in host:port format with the host an IPv4 or IPv6 address
+func AltUnderlays(node *enode.Node, addrs []string) ([][]byte, error) {
+	var alts [][]byte
+	for _, addr := range addrs {
+		tcp, err := ParseUnderlay(addr)
+		if err != nil {
+			return nil, err
+		}
+		alt := enode.NewV4(node.Pubkey(), tcp.IP, tcp.Port, tcp.Port)
+		alts = append(alts, []byte(alt.URLv4()))
+	}
+	return alts, nil
+}
+
+// ParseUnderlay parses an underlay address in host:port format with the host an IPv4 or IPv6 address
+func ParseUnderlay(addr string) (*net.TCPAddr, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid underlay address %q: %v", addr, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid underlay address %q: host is not an IP address", addr)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return nil, fmt.Errorf("invalid underlay address %q: invalid port", addr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
 // PrivateKeyToBzzKey create a swarm overlay address from the given private key
 func PrivateKeyToBzzKey(prvKey *ecdsa.PrivateKey) []byte {
 	pubkeyBytes := crypto.FromECDSAPub(&prvKey.PublicKey)
@@ -13,6 +13,8 @@ func TestBzzAddrRLPSerialization(t *testing.T) {
 	caps := capability.NewCapabilities()
 	caps.Add(lightCapability)
 	addr := RandomBzzAddr().WithCapabilities(caps)
+	addr.AltUAddrs = [][]byte{RandomBzzAddr().UAddr}
+	addr.QuicPort = 30399
 	b, err := rlp.EncodeToBytes(addr)
 	if err != nil {
 		t.Fatal(err)
@@ -38,5 +40,13 @@ func (b *BzzAddr) Match(bcmp *BzzAddr) bool {
 	if !b.Capabilities.Match(bcmp.Capabilities) {
 		return false
 	}
-	return true
+	if len(b.AltUAddrs) != len(bcmp.AltUAddrs) {
+		return false
+	}
+	for i := range b.AltUAddrs {
+		if !bytes.Equal(b.AltUAddrs[i], bcmp.AltUAddrs[i]) {
+			return false
+		}
+	}
+	return b.QuicPort == bcmp.QuicPort
 }
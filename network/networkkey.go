@@ -0,0 +1,120 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var (
+	// ErrNoNetworkMAC is returned if a peer of a private swarm presents no network access MAC
+	ErrNoNetworkMAC = errors.New("no network access MAC")
+	// ErrInvalidNetworkMAC is returned if none of the MACs of the peer is made with the network key
+	ErrInvalidNetworkMAC = errors.New("network access MAC not made with the network key")
+)
+
+// NetworkKey is the pre-shared secret of a private swarm. Nodes present in the bzz handshake
+// the MAC of their underlay id and overlay address made with the key, and reject the peers
+// without one, so that only nodes configured with the key join the swarm.
+//
+// The key is rotated with a grace period during which the previous key is still used:
+// the node presents the MACs made with both keys and accepts the peers presenting either,
+// so that the nodes of the swarm can switch to the new key one by one.
+type NetworkKey struct {
+	mtx      sync.RWMutex
+	current  []byte
+	previous []byte    // key rotated out, nil if not in the grace period
+	graceEnd time.Time // end of the grace period of the previous key
+}
+
+// NewNetworkKey creates a NetworkKey with the pre-shared secret
+func NewNetworkKey(key []byte) *NetworkKey {
+	return &NetworkKey{current: key}
+}
+
+// Rotate replaces the key, the previous key is presented and accepted for the grace period
+func (k *NetworkKey) Rotate(key []byte, grace time.Duration) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.previous = k.current
+	k.current = key
+	k.graceEnd = time.Now().Add(grace)
+}
+
+// GraceEnd returns the end of the grace period of the previous key,
+// the zero time if the key was not rotated
+func (k *NetworkKey) GraceEnd() time.Time {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	return k.graceEnd
+}
+
+// keys returns the keys in use, the previous key only during its grace period
+// caller must hold the lock
+func (k *NetworkKey) keys() [][]byte {
+	keys := [][]byte{k.current}
+	if k.previous != nil && time.Now().Before(k.graceEnd) {
+		keys = append(keys, k.previous)
+	}
+	return keys
+}
+
+// MACs returns the MACs the node with the underlay id and overlay address presents to its peers
+func (k *NetworkKey) MACs(id enode.ID, overlay []byte) [][]byte {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	var macs [][]byte
+	for _, key := range k.keys() {
+		macs = append(macs, networkMAC(key, id, overlay))
+	}
+	return macs
+}
+
+// Verify returns an error if none of the MACs presented by the peer with
+// the underlay id and overlay address is made with a key in use
+func (k *NetworkKey) Verify(id enode.ID, overlay []byte, macs [][]byte) error {
+	if len(macs) == 0 {
+		return ErrNoNetworkMAC
+	}
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	for _, key := range k.keys() {
+		expected := networkMAC(key, id, overlay)
+		for _, mac := range macs {
+			if hmac.Equal(mac, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidNetworkMAC
+}
+
+// networkMAC is the MAC of the underlay id and the overlay address of a node made with the key,
+// the underlay id is authenticated by the transport so that MACs cannot be reused by other nodes
+func networkMAC(key []byte, id enode.ID, overlay []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("swarm-network-key"))
+	mac.Write(id[:])
+	mac.Write(overlay)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	p2ptest "github.com/ethersphere/swarm/p2p/testing"
+)
+
+// TestNetworkKey tests the verification of network access MACs and the rotation of the key
+func TestNetworkKey(t *testing.T) {
+	oldKey, newKey := []byte("old network key"), []byte("new network key")
+	key := NewNetworkKey(oldKey)
+	addr := RandomBzzAddr()
+	id := enode.ID{1}
+
+	macs := key.MACs(id, addr.Over())
+	if len(macs) != 1 {
+		t.Fatalf("expected 1 MAC, got %d", len(macs))
+	}
+	if err := key.Verify(id, addr.Over(), macs); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(id, addr.Over(), nil); err != ErrNoNetworkMAC {
+		t.Fatalf("expected error %v, got %v", ErrNoNetworkMAC, err)
+	}
+	// the MAC is bound to the underlay id and the overlay address
+	if err := key.Verify(enode.ID{2}, addr.Over(), macs); err != ErrInvalidNetworkMAC {
+		t.Fatalf("expected error %v, got %v", ErrInvalidNetworkMAC, err)
+	}
+	if err := key.Verify(id, RandomBzzAddr().Over(), macs); err != ErrInvalidNetworkMAC {
+		t.Fatalf("expected error %v, got %v", ErrInvalidNetworkMAC, err)
+	}
+
+	// during the grace period the MACs made with both keys are presented and accepted
+	key.Rotate(newKey, time.Hour)
+	rotated := key.MACs(id, addr.Over())
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 MACs, got %d", len(rotated))
+	}
+	if err := key.Verify(id, addr.Over(), macs); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewNetworkKey(newKey).Verify(id, addr.Over(), rotated); err != nil {
+		t.Fatal(err)
+	}
+
+	// after the grace period only the MACs made with the new key are
+	key.Rotate(newKey, 0)
+	if err := key.Verify(id, addr.Over(), macs); err != ErrInvalidNetworkMAC {
+		t.Fatalf("expected error %v, got %v", ErrInvalidNetworkMAC, err)
+	}
+	if err := key.Verify(id, addr.Over(), rotated); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBzzHandshakeNetworkKey tests that only peers presenting a MAC made with the network key
+// complete the bzz handshake and that the peers with the previous key are dropped after a rotation,
+// while the peers announcing MACs made with the new key during the grace period are kept
+func TestBzzHandshakeNetworkKey(t *testing.T) {
+	networkKey := []byte("network key")
+
+	t.Run("valid", func(t *testing.T) {
+		s, key := newBzzNetworkKeyTester(t, networkKey)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+		rhs.NetworkMACs = NewNetworkKey(networkKey).MACs(node.ID(), rhs.Addr.Over())
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.NetworkMACs = key.MACs(s.addr.ID(), s.addr.Over())
+		if err := s.testHandshake(lhs, rhs); err != nil {
+			t.Fatal(err)
+		}
+
+		// the peer presenting only the previous key is dropped at the end of the grace period
+		if err := s.bzz.RotateNetworkKey([]byte("new network key"), 100*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		err := s.TestExchanges(p2ptest.Exchange{
+			Expects: []p2ptest.Expect{
+				{
+					Code: 2,
+					Msg:  &NetworkMACsMsg{MACs: key.MACs(s.addr.ID(), s.addr.Over())},
+					Peer: node.ID(),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.TestDisconnected(&p2ptest.Disconnect{Peer: node.ID(), Error: errors.New("subprotocol error")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rotated by both", func(t *testing.T) {
+		s, key := newBzzNetworkKeyTester(t, networkKey)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+		rhs.NetworkMACs = NewNetworkKey(networkKey).MACs(node.ID(), rhs.Addr.Over())
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.NetworkMACs = key.MACs(s.addr.ID(), s.addr.Over())
+		if err := s.testHandshake(lhs, rhs); err != nil {
+			t.Fatal(err)
+		}
+
+		// the MACs made with both keys are announced to the peer during the grace period
+		newKey := []byte("new network key")
+		grace := 500 * time.Millisecond
+		if err := s.bzz.RotateNetworkKey(newKey, grace); err != nil {
+			t.Fatal(err)
+		}
+		err := s.TestExchanges(p2ptest.Exchange{
+			Expects: []p2ptest.Expect{
+				{
+					Code: 2,
+					Msg:  &NetworkMACsMsg{MACs: key.MACs(s.addr.ID(), s.addr.Over())},
+					Peer: node.ID(),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the peer rotates its key too and announces its new MACs
+		err = s.TestExchanges(p2ptest.Exchange{
+			Triggers: []p2ptest.Trigger{
+				{
+					Code: 2,
+					Msg:  &NetworkMACsMsg{MACs: NewNetworkKey(newKey).MACs(node.ID(), rhs.Addr.Over())},
+					Peer: node.ID(),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the peer is kept after the end of the grace period
+		time.Sleep(2 * grace)
+		s.bzz.mtx.Lock()
+		_, ok := s.bzz.peers[node.ID()]
+		s.bzz.mtx.Unlock()
+		if !ok {
+			t.Fatal("expected peer with the new key to stay connected after the grace period")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		s, key := newBzzNetworkKeyTester(t, networkKey)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+		rhs.NetworkMACs = NewNetworkKey([]byte("other network key")).MACs(node.ID(), rhs.Addr.Over())
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.NetworkMACs = key.MACs(s.addr.ID(), s.addr.Over())
+		err := s.testHandshake(
+			lhs,
+			rhs,
+			&p2ptest.Disconnect{Peer: node.ID(), Error: fmt.Errorf("message handler: (msg code 0): network access denied: %v", ErrInvalidNetworkMAC)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("no MAC", func(t *testing.T) {
+		s, key := newBzzNetworkKeyTester(t, networkKey)
+		defer s.Stop()
+		node := s.Nodes[0]
+
+		lhs := correctBzzHandshake(s.addr, false)
+		lhs.NetworkMACs = key.MACs(s.addr.ID(), s.addr.Over())
+		err := s.testHandshake(
+			lhs,
+			newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false),
+			&p2ptest.Disconnect{Peer: node.ID(), Error: fmt.Errorf("message handler: (msg code 0): network access denied: %v", ErrNoNetworkMAC)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// newBzzNetworkKeyTester creates a bzz handshake tester for a node of a private swarm with the network key
+func newBzzNetworkKeyTester(t *testing.T, networkKey []byte) (*bzzTester, *NetworkKey) {
+	t.Helper()
+
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record enr.Record
+	record.Set(NewENRAddrEntry(PrivateKeyToBzzKey(prvkey)))
+	if err := enode.SignV4(&record, prvkey); err != nil {
+		t.Fatal(err)
+	}
+	nod, err := enode.New(enode.V4ID{}, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := getENRBzzAddr(nod)
+	key := NewNetworkKey(networkKey)
+
+	config := &BzzConfig{
+		Address:    addr,
+		HiveParams: NewHiveParams(),
+		NetworkID:  DefaultTestNetworkID,
+		NetworkKey: key,
+	}
+	bzz := NewBzz(config, NewKademlia(addr.OAddr, NewKadParams()), nil, nil, nil, nil, nil)
+	return &bzzTester{
+		addr:           addr,
+		ProtocolTester: p2ptest.NewProtocolTester(prvkey, 1, bzz.runBzz),
+		bzz:            bzz,
+	}, key
+}
@@ -55,8 +55,14 @@ func (d *Peer) Key() string {
 	return d.key
 }
 
-// Label returns a short string representation for debugging purposes
+// Label returns a short string representation for debugging purposes,
+// the label assigned to the peer if it has one
 func (d *Peer) Label() string {
+	if d.kad != nil {
+		if label := d.kad.labels.Lookup(d.BzzAddr); label != "" {
+			return label
+		}
+	}
 	return d.key[:4]
 }
 
@@ -39,8 +39,15 @@ var (
 	capabilitiesPush          = 1
 	capabilitiesRelayRetrieve = 4
 	capabilitiesRelayPush     = 5
+	capabilitiesRelayPss      = 6
+	capabilitiesMediaStream   = 7
+	capabilitiesRelayNat      = 8
+	capabilitiesQuic          = 9
 	capabilitiesStorer        = 15
 
+	// flags that can be advertised on top of the light and full presets
+	optionalCapabilities = []int{capabilitiesRelayPss, capabilitiesMediaStream, capabilitiesRelayNat, capabilitiesQuic}
+
 	// temporary presets to emulate the legacy LightNode/full node regime
 	fullCapability  *capability.Capability
 	lightCapability *capability.Capability
@@ -57,17 +64,19 @@ var DefaultTestNetworkID = rand.Uint64()
 // BzzSpec is the spec of the generic swarm handshake
 var BzzSpec = &protocols.Spec{
 	Name:       "bzz",
-	Version:    14,
+	Version:    21,
 	MaxMsgSize: 10 * 1024 * 1024,
 	Messages: []interface{}{
 		HandshakeMsg{},
+		CapabilitiesMsg{},
+		NetworkMACsMsg{},
 	},
 }
 
 // DiscoverySpec is the spec for the bzz discovery subprotocols
 var DiscoverySpec = &protocols.Spec{
 	Name:       "hive",
-	Version:    11,
+	Version:    13,
 	MaxMsgSize: 10 * 1024 * 1024,
 	Messages: []interface{}{
 		peersMsg{},
@@ -89,7 +98,7 @@ func newLightCapability() *capability.Capability {
 	return c
 }
 func isLightCapability(c *capability.Capability) bool {
-	return lightCapability.IsSameAs(c)
+	return lightCapability.IsSameAs(withoutOptionalCapabilities(c))
 }
 
 // temporary convenience functions for legacy "full node"
@@ -104,17 +113,114 @@ func newFullCapability() *capability.Capability {
 }
 
 func isFullCapability(c *capability.Capability) bool {
-	return fullCapability.IsSameAs(c)
+	return fullCapability.IsSameAs(withoutOptionalCapabilities(c))
+}
+
+// withoutOptionalCapabilities returns a copy of the capability with the optional flags unset
+func withoutOptionalCapabilities(c *capability.Capability) *capability.Capability {
+	if c == nil {
+		return nil
+	}
+	base := capability.NewCapability(c.Id, len(c.Cap))
+	copy(base.Cap, c.Cap)
+	for _, flag := range optionalCapabilities {
+		base.Unset(flag)
+	}
+	return base
+}
+
+// withCapabilities returns a copy of the capability with the given flags set as in the src capability
+func withCapabilities(c, src *capability.Capability, flags ...int) *capability.Capability {
+	cp := capability.NewCapability(c.Id, len(c.Cap))
+	copy(cp.Cap, c.Cap)
+	for _, flag := range flags {
+		if src != nil && flag < len(src.Cap) && src.Cap[flag] {
+			cp.Set(flag)
+		}
+	}
+	return cp
+}
+
+// IsStorer returns whether the node with the address stores chunks of its neighbourhood
+// nodes not advertising the legacy light/full capability are considered to be storers
+func IsStorer(addr *BzzAddr) bool {
+	return isStorer(addr.Capabilities)
+}
+
+// IsRetrievalRelay returns whether the node with the address serves and forwards retrieve requests
+// nodes not advertising the legacy light/full capability are considered to be relays
+func IsRetrievalRelay(addr *BzzAddr) bool {
+	return hasCapability(addr.Capabilities, capabilitiesRelayRetrieve)
+}
+
+// IsPssRelay returns whether the node with the address forwards pss messages of other nodes
+// nodes not advertising the legacy light/full capability are considered to be relays
+func IsPssRelay(addr *BzzAddr) bool {
+	return hasCapability(addr.Capabilities, capabilitiesRelayPss)
+}
+
+// IsMediaStreamer returns whether the node with the address serves media streams over its HTTP gateway
+// unlike the other flags it is only considered set if advertised
+func IsMediaStreamer(addr *BzzAddr) bool {
+	return advertisesCapability(addr.Capabilities, capabilitiesMediaStream)
+}
+
+// IsNatRelay returns whether the node with the address is publicly reachable and relays
+// the connections of peers behind NATs, it is only considered set if advertised
+func IsNatRelay(addr *BzzAddr) bool {
+	return advertisesCapability(addr.Capabilities, capabilitiesRelayNat)
+}
+
+// IsQuic returns whether the node with the address accepts connections over QUIC
+// on its QUIC port, it is only considered set if advertised
+func IsQuic(addr *BzzAddr) bool {
+	return advertisesCapability(addr.Capabilities, capabilitiesQuic)
+}
+
+// advertisesCapability returns whether the flag of the legacy light/full capability is set
+// nodes not advertising the capability are considered to have no flags set
+func advertisesCapability(caps *capability.Capabilities, flag int) bool {
+	if caps == nil {
+		return false
+	}
+	c := caps.Get(CapabilityID)
+	return c != nil && len(c.Cap) > flag && c.Cap[flag]
+}
+
+// isStorer returns whether the storer flag of the legacy light/full capability is set
+func isStorer(caps *capability.Capabilities) bool {
+	return hasCapability(caps, capabilitiesStorer)
+}
+
+// hasCapability returns whether the flag of the legacy light/full capability is set
+// nodes not advertising the capability are considered to have all flags set
+func hasCapability(caps *capability.Capabilities, flag int) bool {
+	if caps == nil {
+		return true
+	}
+	c := caps.Get(CapabilityID)
+	if c == nil || len(c.Cap) <= flag {
+		return true
+	}
+	return c.Cap[flag]
 }
 
 // BzzConfig captures the config params used by the hive
 type BzzConfig struct {
-	Address      *BzzAddr
-	HiveParams   *HiveParams
-	NetworkID    uint64
-	LightNode    bool // temporarily kept as we still only define light/full on operational level
-	BootnodeMode bool
-	SyncEnabled  bool
+	Address          *BzzAddr
+	HiveParams       *HiveParams
+	NetworkID        uint64
+	LightNode        bool // temporarily kept as we still only define light/full on operational level
+	BootnodeMode     bool
+	SyncEnabled      bool
+	Identity         IdentityProvider // verifies the identities of peers in private swarms, nil to accept all peers
+	NetworkKey       *NetworkKey      // pre-shared secret of private swarms, nil to accept all peers
+	Zone             string           // deployment zone of the node announced to peers, e.g. a datacenter
+	PssRelayDisabled bool             // advertise not forwarding the pss messages of other nodes
+	MediaStream      bool             // advertise serving media streams over the HTTP gateway
+	NatRelay         bool             // advertise relaying the connections of peers behind NATs
+	Quic             bool             // advertise accepting connections over QUIC on the port set with SetQuicPort
+	AltUnderlays     []string         // additional host:port addresses the node is reachable on, e.g. over IPv6
 }
 
 // Bzz is the swarm protocol bundle
@@ -124,10 +230,19 @@ type Bzz struct {
 	localAddr     *BzzAddr
 	mtx           sync.Mutex
 	handshakes    map[enode.ID]*HandshakeMsg
+	peers         map[enode.ID]*protocols.Peer // peers with an established bzz handshake
+	quit          chan struct{}
 	streamerSpec  *protocols.Spec
 	streamerRun   func(*BzzPeer) error
 	retrievalSpec *protocols.Spec
 	retrievalRun  func(*BzzPeer) error
+	identity      IdentityProvider
+	networkKey    *NetworkKey
+	graceTimer    *time.Timer                // revalidates the peers at the end of the grace period of a rotated network key
+	established   map[enode.ID]*HandshakeMsg // handshakes of the peers in peers, to revalidate their identities
+	zone          string
+	altUnderlays  []string // additional host:port addresses advertised with the enode of the node
+	quicPort      uint16   // UDP port QUIC connections are accepted on, advertised with the underlay address
 }
 
 // NewBzz is the swarm protocol constructor
@@ -141,10 +256,17 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 		NetworkID:     config.NetworkID,
 		localAddr:     config.Address,
 		handshakes:    make(map[enode.ID]*HandshakeMsg),
+		peers:         make(map[enode.ID]*protocols.Peer),
+		quit:          make(chan struct{}),
 		streamerRun:   streamerRun,
 		streamerSpec:  streamerSpec,
 		retrievalRun:  retrievalRun,
 		retrievalSpec: retrievalSpec,
+		identity:      config.Identity,
+		networkKey:    config.NetworkKey,
+		altUnderlays:  config.AltUnderlays,
+		established:   make(map[enode.ID]*HandshakeMsg),
+		zone:          config.Zone,
 	}
 
 	if config.BootnodeMode {
@@ -161,26 +283,182 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 
 	bzz.localAddr.Capabilities = kad.Capabilities
 	// temporary soon-to-be-legacy light/full, as above
+	c := newFullCapability()
 	if config.LightNode {
-		bzz.localAddr.Capabilities.Add(newLightCapability())
-	} else {
-		bzz.localAddr.Capabilities.Add(newFullCapability())
+		c = newLightCapability()
+	}
+	if !config.PssRelayDisabled {
+		c.Set(capabilitiesRelayPss)
+	}
+	if config.MediaStream {
+		c.Set(capabilitiesMediaStream)
+	}
+	if config.NatRelay {
+		c.Set(capabilitiesRelayNat)
+	}
+	if config.Quic {
+		c.Set(capabilitiesQuic)
 	}
+	bzz.localAddr.Capabilities.Add(c)
 
 	return bzz
 }
 
+// Start starts announcing changes of the local capabilities to connected peers
+// and starts the hive
+func (b *Bzz) Start(server *p2p.Server) error {
+	changes, unsubscribe := b.localAddr.Capabilities.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-changes:
+				b.announceCapabilities()
+			case <-b.quit:
+				return
+			}
+		}
+	}()
+	if b.networkKey != nil {
+		b.scheduleRevalidation(b.networkKey.GraceEnd())
+	}
+	return b.Hive.Start(server)
+}
+
 // Stop Implements node.Service
 func (b *Bzz) Stop() error {
+	close(b.quit)
+	b.mtx.Lock()
+	if b.graceTimer != nil {
+		b.graceTimer.Stop()
+	}
+	b.mtx.Unlock()
 	return b.Hive.Stop()
 }
 
+// RotateNetworkKey replaces the network key of the private swarm, the previous key is
+// presented and accepted for the grace period, after which the peers presenting
+// only MACs made with the previous key are dropped; the MACs made with both keys are
+// announced to the connected peers, so that the peers rotating their key during the
+// grace period keep the connection
+func (b *Bzz) RotateNetworkKey(key []byte, grace time.Duration) error {
+	if b.networkKey == nil {
+		return errors.New("not a private swarm")
+	}
+	b.networkKey.Rotate(key, grace)
+	b.announceNetworkMACs()
+	b.scheduleRevalidation(b.networkKey.GraceEnd())
+	return nil
+}
+
+// announceNetworkMACs sends the current network access MACs of the node to all connected peers
+func (b *Bzz) announceNetworkMACs() {
+	b.mtx.Lock()
+	peers := make([]*protocols.Peer, 0, len(b.peers))
+	for _, p := range b.peers {
+		peers = append(peers, p)
+	}
+	b.mtx.Unlock()
+
+	msg := &NetworkMACsMsg{MACs: b.networkKey.MACs(b.localAddr.ID(), b.localAddr.Over())}
+	for _, p := range peers {
+		go func(p *protocols.Peer) {
+			ctx, cancel := context.WithTimeout(context.Background(), bzzHandshakeTimeout)
+			defer cancel()
+			if err := p.Send(ctx, msg); err != nil {
+				log.Warn("failed to announce network access MACs", "peer", p.ID(), "err", err)
+			}
+		}(p)
+	}
+}
+
+// scheduleRevalidation revalidates the peers at the end of the grace period of the network key
+func (b *Bzz) scheduleRevalidation(graceEnd time.Time) {
+	if graceEnd.IsZero() {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.graceTimer != nil {
+		b.graceTimer.Stop()
+	}
+	b.graceTimer = time.AfterFunc(time.Until(graceEnd), b.RevalidatePeers)
+}
+
+// announceCapabilities sends the local capabilities to all connected peers
+// so that they can renegotiate the subprotocols without reconnecting
+func (b *Bzz) announceCapabilities() {
+	caps := b.localAddr.Capabilities
+	if err := checkCapabilities(caps); err != nil {
+		log.Error("not announcing invalid capabilities", "caps", caps, "err", err)
+		return
+	}
+	b.mtx.Lock()
+	peers := make([]*protocols.Peer, 0, len(b.peers))
+	for _, p := range b.peers {
+		peers = append(peers, p)
+	}
+	b.mtx.Unlock()
+
+	log.Debug("announcing capabilities", "caps", caps, "peers", len(peers))
+	msg := &CapabilitiesMsg{Capabilities: caps}
+	for _, p := range peers {
+		go func(p *protocols.Peer) {
+			ctx, cancel := context.WithTimeout(context.Background(), bzzHandshakeTimeout)
+			defer cancel()
+			if err := p.Send(ctx, msg); err != nil {
+				log.Warn("failed to announce capabilities", "peer", p.ID(), "err", err)
+			}
+		}(p)
+	}
+}
+
+// LightNode returns whether the local node advertises the light capability,
+// in which case it does not store the chunks of its neighbourhood
+func (b *Bzz) LightNode() bool {
+	return !isStorer(b.localAddr.Capabilities)
+}
+
+// SetLightNode switches the local node between light and full mode at runtime
+// the changed capability is announced to connected peers, which stop or start
+// offering their pull sync streams accordingly
+func (b *Bzz) SetLightNode(light bool) error {
+	if light == b.LightNode() {
+		return nil
+	}
+	log.Info("switching node mode", "light", light)
+	c := newFullCapability()
+	if light {
+		c = newLightCapability()
+	}
+	// the optional flags are kept across mode switches
+	return b.localAddr.Capabilities.Update(withCapabilities(c, b.localAddr.Capabilities.Get(CapabilityID), optionalCapabilities...))
+}
+
+// SetQuicPort sets the UDP port QUIC connections are accepted on, it is advertised
+// with the underlay address set by UpdateLocalAddr
+func (b *Bzz) SetQuicPort(port uint16) {
+	b.quicPort = port
+}
+
 // UpdateLocalAddr updates underlayaddress of the running node
 func (b *Bzz) UpdateLocalAddr(byteaddr []byte) *BzzAddr {
+	var alts [][]byte
+	if len(b.altUnderlays) > 0 {
+		node, err := enode.ParseV4(string(byteaddr))
+		if err == nil {
+			alts, err = AltUnderlays(node, b.altUnderlays)
+		}
+		if err != nil {
+			log.Error("not advertising alternative underlay addresses", "err", err)
+		}
+	}
 	b.localAddr = b.localAddr.Update(&BzzAddr{
 		UAddr:        byteaddr,
 		OAddr:        b.localAddr.OAddr,
 		Capabilities: b.localAddr.Capabilities,
+		AltUAddrs:    alts,
+		QuicPort:     b.quicPort,
 	})
 
 	return b.localAddr
@@ -234,6 +512,7 @@ func (b *Bzz) Protocols() []p2p.Protocol {
 
 // APIs returns the APIs offered by bzz
 // * hive
+// * capabilities and light node mode
 // Bzz implements the node.Service interface
 func (b *Bzz) APIs() []rpc.API {
 	return []rpc.API{
@@ -247,9 +526,29 @@ func (b *Bzz) APIs() []rpc.API {
 			Version:   "4.0",
 			Service:   capability.NewAPI(b.Kademlia.Capabilities),
 		},
+		{
+			Namespace: "bzz",
+			Version:   "4.0",
+			Service:   &LightNodeAPI{bzz: b},
+		},
 	}
 }
 
+// LightNodeAPI exposes the light node mode of the local node over RPC
+type LightNodeAPI struct {
+	bzz *Bzz
+}
+
+// LightNode returns whether the node runs in light mode
+func (a *LightNodeAPI) LightNode() bool {
+	return a.bzz.LightNode()
+}
+
+// SetLightNode switches the node between light and full mode
+func (a *LightNodeAPI) SetLightNode(light bool) error {
+	return a.bzz.SetLightNode(light)
+}
+
 // RunProtocol is a wrapper for swarm subprotocols
 // returns a p2p protocol run function that can be assigned to p2p.Protocol#Run field
 // arguments:
@@ -277,9 +576,15 @@ func (b *Bzz) RunProtocol(spec *protocols.Spec, run func(*BzzPeer) error) func(*
 		peer := &BzzPeer{
 			Peer:       protocols.NewPeer(p, rw, spec),
 			BzzAddr:    handshake.peerAddr,
+			Zone:       handshake.peerZone,
 			lastActive: time.Now(),
 		}
 
+		// protocol violations of the peer lower its reputation
+		peer.SetBreakHandler(func(err error) {
+			b.Kademlia.PeerScores().RecordViolation(peer.Over())
+		})
+
 		log.Debug("peer created", "addr", handshake.peerAddr.String())
 
 		return run(peer)
@@ -294,12 +599,23 @@ func (b *Bzz) performHandshake(p *protocols.Peer, handshake *HandshakeMsg) error
 		close(handshake.done)
 		cancel()
 	}()
-	rsh, err := p.Handshake(ctx, handshake, b.checkHandshake)
+	rsh, err := p.Handshake(ctx, handshake, func(hs interface{}) error {
+		if err := b.checkHandshake(hs); err != nil {
+			return err
+		}
+		if err := b.checkNetworkKey(p.ID(), hs.(*HandshakeMsg).Addr, hs.(*HandshakeMsg).NetworkMACs); err != nil {
+			return err
+		}
+		return b.checkIdentity(p.ID(), hs.(*HandshakeMsg))
+	})
 	if err != nil {
 		handshake.err = err
 		return err
 	}
 	handshake.peerAddr = rsh.(*HandshakeMsg).Addr
+	handshake.peerCredential = rsh.(*HandshakeMsg).Credential
+	handshake.peerZone = rsh.(*HandshakeMsg).Zone
+	handshake.peerNetworkMACs = rsh.(*HandshakeMsg).NetworkMACs
 	return nil
 }
 
@@ -319,13 +635,61 @@ func (b *Bzz) runBzz(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 
 		return err
 	}
-	// fail if we get another handshake
-	msg, err := rw.ReadMsg()
-	if err != nil {
+
+	b.mtx.Lock()
+	b.peers[p.ID()] = peer
+	b.established[p.ID()] = handshake
+	b.mtx.Unlock()
+	defer func() {
+		b.mtx.Lock()
+		delete(b.peers, p.ID())
+		delete(b.established, p.ID())
+		b.mtx.Unlock()
+	}()
+
+	return peer.Run(b.handleMsg(p.ID(), handshake.peerAddr))
+}
+
+// handleMsg is the message handler of the bzz base protocol after the handshake
+func (b *Bzz) handleMsg(id enode.ID, addr *BzzAddr) func(context.Context, interface{}) error {
+	return func(ctx context.Context, msg interface{}) error {
+		switch msg := msg.(type) {
+		case *CapabilitiesMsg:
+			return b.handleCapabilitiesMsg(addr, msg)
+		case *NetworkMACsMsg:
+			return b.handleNetworkMACsMsg(id, addr, msg)
+		case *HandshakeMsg:
+			// fail if we get another handshake
+			return errors.New("received multiple handshakes")
+		}
+		return fmt.Errorf("unknown message type: %T", msg)
+	}
+}
+
+// handleCapabilitiesMsg updates the capabilities of the peer with the announced ones
+// subscribers of kademlia capability changes renegotiate their subprotocols with the peer
+func (b *Bzz) handleCapabilitiesMsg(addr *BzzAddr, msg *CapabilitiesMsg) error {
+	if err := checkCapabilities(msg.Capabilities); err != nil {
 		return err
 	}
-	msg.Discard()
-	return errors.New("received multiple handshakes")
+	log.Debug("peer capabilities changed", "peer", addr, "caps", msg.Capabilities)
+	b.Kademlia.UpdateCapabilities(addr, msg.Capabilities)
+	return nil
+}
+
+// handleNetworkMACsMsg replaces the network access MACs of the peer revalidated at the end
+// of the grace period of a rotated network key with the announced ones, the peer is dropped
+// if none of them is made with a key in use
+func (b *Bzz) handleNetworkMACsMsg(id enode.ID, addr *BzzAddr, msg *NetworkMACsMsg) error {
+	if err := b.checkNetworkKey(id, addr, msg.MACs); err != nil {
+		return protocols.Break(err)
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if handshake, ok := b.established[id]; ok {
+		handshake.peerNetworkMACs = msg.MACs
+	}
+	return nil
 }
 
 // BzzPeer is the bzz protocol view of a protocols.Peer (itself an extension of p2p.Peer)
@@ -333,6 +697,7 @@ func (b *Bzz) runBzz(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 type BzzPeer struct {
 	*protocols.Peer           // represents the connection for online peers
 	*BzzAddr                  // remote address -> implements Addr interface = protocols.Peer
+	Zone            string    // deployment zone announced by the remote node, empty if not set
 	lastActive      time.Time // time is updated whenever mutexes are releasing
 }
 
@@ -349,6 +714,17 @@ func (p *BzzPeer) ID() enode.ID {
 	return p.Peer.ID()
 }
 
+// CapabilitiesMsg announces the changed capabilities of a node to its connected peers
+type CapabilitiesMsg struct {
+	Capabilities *capability.Capabilities
+}
+
+// NetworkMACsMsg announces the network access MACs of a node of a private swarm
+// to its connected peers after a rotation of the network key
+type NetworkMACsMsg struct {
+	MACs [][]byte
+}
+
 /*
  Handshake
 
@@ -356,14 +732,26 @@ func (p *BzzPeer) ID() enode.ID {
 * NetworkID: 8 byte integer network identifier
 * Addr: the address advertised by the node including underlay and overlay connecctions
 * Capabilities: the capabilities bitvector
+* Credential: the identity credential of the node in private swarms, empty otherwise
+* Zone: the deployment zone of the node, empty if not set
+* NetworkMACs: the MACs of the node made with the network key in private swarms, empty otherwise
 */
 type HandshakeMsg struct {
-	Version   uint64
-	NetworkID uint64
-	Addr      *BzzAddr
+	Version     uint64
+	NetworkID   uint64
+	Addr        *BzzAddr
+	Credential  []byte
+	Zone        string
+	NetworkMACs [][]byte
 
 	// peerAddr is the address received in the peer handshake
 	peerAddr *BzzAddr
+	// peerCredential is the credential received in the peer handshake
+	peerCredential []byte
+	// peerZone is the deployment zone received in the peer handshake
+	peerZone string
+	// peerNetworkMACs are the network access MACs received in the peer handshake
+	peerNetworkMACs [][]byte
 
 	init chan bool
 	done chan struct{}
@@ -384,9 +772,61 @@ func (b *Bzz) checkHandshake(hs interface{}) error {
 	if rhs.Version != uint64(BzzSpec.Version) {
 		return fmt.Errorf("version mismatch %d (!= %d)", rhs.Version, BzzSpec.Version)
 	}
+	return checkCapabilities(rhs.Addr.Capabilities)
+}
+
+// checkIdentity verifies the credential of the peer with the identity provider
+func (b *Bzz) checkIdentity(id enode.ID, rhs *HandshakeMsg) error {
+	if b.identity == nil {
+		return nil
+	}
+	if err := b.identity.Verify(id, rhs.Addr, rhs.Credential); err != nil {
+		return fmt.Errorf("identity verification failed: %v", err)
+	}
+	return nil
+}
+
+// checkNetworkKey verifies that the peer presents a MAC made with the network key
+func (b *Bzz) checkNetworkKey(id enode.ID, addr *BzzAddr, macs [][]byte) error {
+	if b.networkKey == nil {
+		return nil
+	}
+	if err := b.networkKey.Verify(id, addr.Over(), macs); err != nil {
+		return fmt.Errorf("network access denied: %v", err)
+	}
+	return nil
+}
+
+// RevalidatePeers verifies the credentials and network access MACs of the connected peers
+// again and drops the peers failing verification, typically after revocations and rotations
+// of the network key
+func (b *Bzz) RevalidatePeers() {
+	if b.identity == nil && b.networkKey == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for id, peer := range b.peers {
+		handshake := b.established[id]
+		if err := b.checkNetworkKey(id, handshake.peerAddr, handshake.peerNetworkMACs); err != nil {
+			peer.Drop(err.Error())
+			continue
+		}
+		if b.identity == nil {
+			continue
+		}
+		if err := b.identity.Verify(id, handshake.peerAddr, handshake.peerCredential); err != nil {
+			peer.Drop(fmt.Sprintf("identity verification failed: %v", err))
+		}
+	}
+}
+
+// checkCapabilities validates capabilities advertised by a node
+func checkCapabilities(caps *capability.Capabilities) error {
 	// temporary check for valid capability settings, legacy full/light
-	if !isFullCapability(rhs.Addr.Capabilities.Get(0)) && !isLightCapability(rhs.Addr.Capabilities.Get(0)) {
-		return fmt.Errorf("invalid capabilities setting: %s", rhs.Addr.Capabilities)
+	// with any of the optional flags
+	if caps == nil || !isFullCapability(caps.Get(0)) && !isLightCapability(caps.Get(0)) {
+		return fmt.Errorf("invalid capabilities setting: %s", caps)
 	}
 	return nil
 }
@@ -409,9 +849,16 @@ func (b *Bzz) GetOrCreateHandshake(peerID enode.ID) (*HandshakeMsg, bool) {
 			Version:   uint64(BzzSpec.Version),
 			NetworkID: b.NetworkID,
 			Addr:      b.localAddr,
+			Zone:      b.zone,
 			init:      make(chan bool, 1),
 			done:      make(chan struct{}),
 		}
+		if b.identity != nil {
+			handshake.Credential = b.identity.Credential()
+		}
+		if b.networkKey != nil {
+			handshake.NetworkMACs = b.networkKey.MACs(b.localAddr.ID(), b.localAddr.Over())
+		}
 		// when handhsake is first created for a remote peer
 		// it is initialised with the init
 		handshake.init <- true
@@ -37,7 +37,7 @@ import (
 )
 
 const (
-	TestProtocolVersion = 14
+	TestProtocolVersion = 21
 )
 
 var TestProtocolNetworkID = DefaultTestNetworkID
@@ -414,3 +414,203 @@ func TestBzzHandshakeLightNode(t *testing.T) {
 		})
 	}
 }
+
+// TestBzzHandshakeZone tests that the deployment zone of the peer is received in the handshake
+func TestBzzHandshakeZone(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := newBzzHandshakeTester(1, prvkey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pt.Stop()
+
+	node := pt.Nodes[0]
+	rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+	rhs.Zone = "eu-west-1a"
+	err = pt.testHandshake(correctBzzHandshake(pt.addr, false), rhs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-pt.bzz.handshakes[node.ID()].done:
+		if zone := pt.bzz.handshakes[node.ID()].peerZone; zone != rhs.Zone {
+			t.Fatalf("expected peer zone %q, got %q", rhs.Zone, zone)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("test timeout")
+	}
+}
+
+// TestBzzCapabilitiesMsg tests that capability changes are announced to connected peers
+// and that capabilities announced by peers update their address
+func TestBzzCapabilitiesMsg(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := newBzzHandshakeTester(1, prvkey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pt.Stop()
+
+	node := pt.Nodes[0]
+	addr := NewBzzAddrFromEnode(node)
+
+	err = pt.testHandshake(
+		correctBzzHandshake(pt.addr, false),
+		newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, addr, false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the peer announces it became a light node
+	lightCaps := capability.NewCapabilities()
+	lightCaps.Add(newLightCapability())
+	err = pt.TestExchanges(p2ptest.Exchange{
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 1,
+				Msg:  &CapabilitiesMsg{Capabilities: lightCaps},
+				Peer: node.ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake, _ := pt.bzz.GetOrCreateHandshake(node.ID())
+	deadline := time.After(10 * time.Second)
+	for handshake.peerAddr.Capabilities.String() != lightCaps.String() {
+		select {
+		case <-deadline:
+			t.Fatalf("peer capabilities not updated, got %v, want %v", handshake.peerAddr.Capabilities, lightCaps)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if IsStorer(handshake.peerAddr) {
+		t.Fatal("expected light peer not to be a storer")
+	}
+
+	// local capabilities change is announced to the peer
+	if err := pt.bzz.localAddr.Capabilities.Update(newLightCapability()); err != nil {
+		t.Fatal(err)
+	}
+	pt.bzz.announceCapabilities()
+	err = pt.TestExchanges(p2ptest.Exchange{
+		Expects: []p2ptest.Expect{
+			{
+				Code: 1,
+				Msg:  &CapabilitiesMsg{Capabilities: pt.bzz.localAddr.Capabilities},
+				Peer: node.ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBzzSetLightNode checks that switching the light node mode at runtime
+// updates the local capabilities and the local storer status of the kademlia
+func TestBzzSetLightNode(t *testing.T) {
+	bzz := newBzz(RandomBzzAddr(), false)
+	if bzz.LightNode() || !bzz.Kademlia.IsStorer() {
+		t.Fatal("expected full node to be a storer")
+	}
+
+	changes, unsubscribe := bzz.localAddr.Capabilities.Subscribe()
+	defer unsubscribe()
+
+	if err := bzz.SetLightNode(true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatal("expected capabilities change to be signalled")
+	}
+	if !bzz.LightNode() || bzz.Kademlia.IsStorer() {
+		t.Fatal("expected light node not to be a storer")
+	}
+	if !isLightCapability(bzz.localAddr.Capabilities.Get(CapabilityID)) {
+		t.Fatalf("expected light capability, got %v", bzz.localAddr.Capabilities)
+	}
+
+	// setting the same mode is not announced
+	if err := bzz.SetLightNode(true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("unexpected capabilities change")
+	default:
+	}
+
+	if err := bzz.SetLightNode(false); err != nil {
+		t.Fatal(err)
+	}
+	if bzz.LightNode() || !bzz.Kademlia.IsStorer() {
+		t.Fatal("expected full node to be a storer")
+	}
+}
+
+// TestOptionalCapabilities checks that the optional capability flags are accepted on top of
+// the light and full presets, and that they are kept when switching the light node mode
+func TestOptionalCapabilities(t *testing.T) {
+	c := newFullCapability()
+	c.Set(capabilitiesRelayPss)
+	c.Set(capabilitiesMediaStream)
+	c.Set(capabilitiesRelayNat)
+	c.Set(capabilitiesQuic)
+	caps := capability.NewCapabilities()
+	caps.Add(c)
+	if err := checkCapabilities(caps); err != nil {
+		t.Fatal(err)
+	}
+	addr := RandomBzzAddr().WithCapabilities(caps)
+	if !IsPssRelay(addr) || !IsMediaStreamer(addr) || !IsNatRelay(addr) || !IsQuic(addr) || !IsRetrievalRelay(addr) || !IsStorer(addr) {
+		t.Fatalf("expected all flags to be set, got %v", caps)
+	}
+
+	// unknown flags are refused
+	c.Set(10)
+	if err := checkCapabilities(caps); err == nil {
+		t.Fatal("expected capabilities with unknown flags to be invalid")
+	}
+
+	// nodes not advertising the capability relay, but do not stream or relay connections
+	addr = RandomBzzAddr()
+	if !IsPssRelay(addr) || !IsRetrievalRelay(addr) || IsMediaStreamer(addr) || IsNatRelay(addr) || IsQuic(addr) {
+		t.Fatal("expected node without capabilities to relay but not stream or relay connections")
+	}
+
+	config := &BzzConfig{
+		Address:          RandomBzzAddr(),
+		HiveParams:       NewHiveParams(),
+		NetworkID:        DefaultTestNetworkID,
+		PssRelayDisabled: true,
+		MediaStream:      true,
+		NatRelay:         true,
+		Quic:             true,
+	}
+	bzz := NewBzz(config, NewKademlia(config.Address.OAddr, NewKadParams()), nil, nil, nil, nil, nil)
+	if IsPssRelay(bzz.localAddr) || !IsMediaStreamer(bzz.localAddr) || !IsNatRelay(bzz.localAddr) || !IsQuic(bzz.localAddr) {
+		t.Fatalf("expected configured flags to be advertised, got %v", bzz.localAddr.Capabilities)
+	}
+	if err := bzz.SetLightNode(true); err != nil {
+		t.Fatal(err)
+	}
+	if IsRetrievalRelay(bzz.localAddr) || IsPssRelay(bzz.localAddr) || !IsMediaStreamer(bzz.localAddr) || !IsNatRelay(bzz.localAddr) || !IsQuic(bzz.localAddr) {
+		t.Fatalf("expected optional flags to be kept in light mode, got %v", bzz.localAddr.Capabilities)
+	}
+	if err := checkCapabilities(bzz.localAddr.Capabilities); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package quic runs the devp2p connections of the bzz protocols over QUIC. A node
+// listening for QUIC connections advertises the quic capability and the UDP port
+// of the listener in its bzz address. Peers dial it over QUIC, falling back to TCP
+// if the dial fails, and run RLPx over a single QUIC stream, which authenticates
+// the nodes as on TCP connections. The TLS certificates of the QUIC handshake are
+// self-signed and not verified.
+//
+// The transport is built with the quic tag. The vendored quic-go release supports
+// Go 1.13 and 1.14 only, on newer toolchains and without the tag New returns
+// ErrDisabled.
+package quic
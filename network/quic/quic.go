@@ -0,0 +1,336 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build quic && !go1.15
+// +build quic,!go1.15
+
+package quic
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/log"
+	quicgo "github.com/lucas-clemente/quic-go"
+)
+
+var (
+	// DialTimeout is the time the QUIC handshake and the stream are expected to be established in
+	DialTimeout = 10 * time.Second
+	// HandshakeTimeout is the time the QUIC handshake is given before the dial falls back
+	// to TCP, short as peers with blocked or dead UDP ports never answer
+	HandshakeTimeout = 3 * time.Second
+	// IdleTimeout is the time a connection without activity is closed after
+	IdleTimeout = 60 * time.Second
+
+	dialCounter     = metrics.NewRegisteredCounter("network/quic/dial", nil)
+	acceptCounter   = metrics.NewRegisteredCounter("network/quic/accept", nil)
+	fallbackCounter = metrics.NewRegisteredCounter("network/quic/fallback", nil)
+	refusedCounter  = metrics.NewRegisteredCounter("network/quic/refused", nil)
+)
+
+// protocol is the ALPN protocol negotiated in the TLS handshake
+const protocol = "bzz"
+
+// defaultDialRatio is the ratio of the peers the p2p server dials if not configured
+const defaultDialRatio = 3
+
+// inboundConn is the value of the unexported flag the p2p server sets up inbound
+// connections with, counting them against its inbound peers
+const inboundConn = 4
+
+// Transport accepts QUIC connections of peers and dials peers accepting them,
+// it implements the p2p.NodeDialer interface and must be set as the dialer in
+// the config of the server before it is started
+type Transport struct {
+	addr     string                      // UDP address the listener is bound to
+	tls      *tls.Config                 // self-signed certificate of the node
+	config   *quicgo.Config              // settings of the QUIC connections
+	fallback p2p.NodeDialer              // dials nodes not accepting QUIC connections
+	mtx      sync.Mutex                  // protects the fields below
+	ports    func(*enode.Node) int       // port a node accepts QUIC connections on, 0 if none
+	ln       quicgo.Listener             // listener of the QUIC connections, set on start
+	quit     chan struct{}               // closed on stop
+	conns    map[quicgo.Session]struct{} // QUIC connections running RLPx
+	pending  int                         // accepted connections not set up as peers yet
+	wg       sync.WaitGroup
+}
+
+// New creates a transport listening on the UDP address, nodes are dialed over TCP
+// until the ports they accept QUIC connections on are set
+func New(addr string) (*Transport, error) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return &Transport{
+		addr: addr,
+		tls: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{protocol},
+			MinVersion:   tls.VersionTLS13,
+			// the nodes are authenticated by the RLPx handshake
+			InsecureSkipVerify: true,
+		},
+		config: &quicgo.Config{
+			HandshakeTimeout: HandshakeTimeout,
+			MaxIdleTimeout:   IdleTimeout,
+			KeepAlive:        true,
+		},
+		fallback: p2p.TCPDialer{Dialer: &net.Dialer{Timeout: DialTimeout}},
+		conns:    make(map[quicgo.Session]struct{}),
+	}, nil
+}
+
+// SetPorts sets the function returning the port a node accepts QUIC connections on,
+// 0 if it does not
+func (t *Transport) SetPorts(ports func(*enode.Node) int) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.ports = ports
+}
+
+// Start listens for QUIC connections and hands them to the server
+func (t *Transport) Start(srv *p2p.Server) error {
+	ln, err := quicgo.ListenAddr(t.addr, t.tls, t.config)
+	if err != nil {
+		return err
+	}
+	quit := make(chan struct{})
+	t.mtx.Lock()
+	t.ln = ln
+	t.quit = quit
+	t.mtx.Unlock()
+	log.Info("listening for QUIC connections", "addr", ln.Addr())
+	t.wg.Add(1)
+	go t.listen(srv, ln, quit)
+	return nil
+}
+
+// Stop closes the listener and the QUIC connections
+func (t *Transport) Stop() error {
+	t.mtx.Lock()
+	ln, quit := t.ln, t.quit
+	t.ln, t.quit = nil, nil
+	for qc := range t.conns {
+		qc.CloseWithError(0, "shutdown")
+	}
+	t.mtx.Unlock()
+	if ln == nil {
+		return nil
+	}
+	close(quit)
+	err := ln.Close()
+	t.wg.Wait()
+	return err
+}
+
+// Port returns the UDP port the transport listens on, 0 if not started
+func (t *Transport) Port() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.ln == nil {
+		return 0
+	}
+	return t.ln.Addr().(*net.UDPAddr).Port
+}
+
+// Dial connects to the node over QUIC if it advertises accepting QUIC connections
+// and over the fallback dialer otherwise or if the QUIC dial fails
+func (t *Transport) Dial(dest *enode.Node) (net.Conn, error) {
+	t.mtx.Lock()
+	ports := t.ports
+	t.mtx.Unlock()
+	var port int
+	if ports != nil {
+		port = ports(dest)
+	}
+	if port == 0 {
+		return t.fallback.Dial(dest)
+	}
+	conn, err := t.dial(dest, port)
+	if err != nil {
+		log.Debug("quic: dial failed, falling back", "node", dest.ID(), "err", err)
+		fallbackCounter.Inc(1)
+		return t.fallback.Dial(dest)
+	}
+	dialCounter.Inc(1)
+	return conn, nil
+}
+
+func (t *Transport) dial(dest *enode.Node, port int) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DialTimeout)
+	defer cancel()
+	addr := &net.UDPAddr{IP: dest.IP(), Port: port}
+	qc, err := quicgo.DialAddrContext(ctx, addr.String(), t.tls, t.config)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := qc.OpenStreamSync(ctx)
+	if err != nil {
+		qc.CloseWithError(0, "")
+		return nil, err
+	}
+	return t.track(qc, stream), nil
+}
+
+func (t *Transport) listen(srv *p2p.Server, ln quicgo.Listener, quit chan struct{}) {
+	defer t.wg.Done()
+	for {
+		qc, err := ln.Accept(context.Background())
+		if err != nil {
+			select {
+			case <-quit:
+			default:
+				log.Error("quic: accept failed", "err", err)
+			}
+			return
+		}
+		t.wg.Add(1)
+		go t.accept(srv, qc)
+	}
+}
+
+// accept waits for the stream the dialer runs RLPx over and hands it to the server
+func (t *Transport) accept(srv *p2p.Server, qc quicgo.Session) {
+	defer t.wg.Done()
+	if !t.reserve(srv) {
+		log.Debug("quic: too many inbound connections", "addr", qc.RemoteAddr())
+		refusedCounter.Inc(1)
+		qc.CloseWithError(0, "too many peers")
+		return
+	}
+	// once set up, the connection is counted by the server as one of its inbound peers
+	defer t.release()
+	ctx, cancel := context.WithTimeout(context.Background(), DialTimeout)
+	defer cancel()
+	stream, err := qc.AcceptStream(ctx)
+	if err != nil {
+		log.Debug("quic: no stream accepted", "addr", qc.RemoteAddr(), "err", err)
+		qc.CloseWithError(0, "")
+		return
+	}
+	acceptCounter.Inc(1)
+	// errors are logged by the server, which closes the connection
+	srv.SetupConn(t.track(qc, stream), inboundConn, nil)
+}
+
+// reserve takes an inbound slot for an accepted connection if the inbound peers
+// of the server, over TCP and QUIC, and the connections being set up leave one
+func (t *Transport) reserve(srv *p2p.Server) bool {
+	inbound := 0
+	for _, p := range srv.Peers() {
+		if p.Inbound() {
+			inbound++
+		}
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if inbound+t.pending >= maxInbound(srv) {
+		return false
+	}
+	t.pending++
+	return true
+}
+
+// release frees the slot taken by reserve
+func (t *Transport) release() {
+	t.mtx.Lock()
+	t.pending--
+	t.mtx.Unlock()
+}
+
+// maxInbound returns the number of inbound connections the server accepts,
+// computed as by the p2p package
+func maxInbound(srv *p2p.Server) int {
+	if srv.NoDiscovery || srv.NoDial {
+		return srv.MaxPeers
+	}
+	ratio := srv.DialRatio
+	if ratio == 0 {
+		ratio = defaultDialRatio
+	}
+	return srv.MaxPeers - srv.MaxPeers/ratio
+}
+
+// track registers the connection to be closed on stop
+func (t *Transport) track(qc quicgo.Session, stream quicgo.Stream) *conn {
+	t.mtx.Lock()
+	t.conns[qc] = struct{}{}
+	t.mtx.Unlock()
+	return &conn{Stream: stream, qc: qc, t: t}
+}
+
+func (t *Transport) untrack(qc quicgo.Session) {
+	t.mtx.Lock()
+	delete(t.conns, qc)
+	t.mtx.Unlock()
+}
+
+// conn is the net.Conn of a QUIC stream, closing it closes the QUIC connection
+type conn struct {
+	quicgo.Stream
+	qc   quicgo.Session
+	t    *Transport
+	once sync.Once
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.qc.LocalAddr()
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.qc.RemoteAddr()
+}
+
+func (c *conn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.Stream.Close()
+		err = c.qc.CloseWithError(0, "")
+		c.t.untrack(c.qc)
+	})
+	return err
+}
+
+// selfSignedCertificate generates the TLS certificate of the QUIC handshakes
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
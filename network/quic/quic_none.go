@@ -0,0 +1,62 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !quic || go1.15
+// +build !quic go1.15
+
+package quic
+
+import (
+	"errors"
+	"net"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// ErrDisabled is returned by a transport built without QUIC support
+var ErrDisabled = errors.New("quic: transport not built, build with the quic tag and Go 1.13 or 1.14")
+
+// Transport is the QUIC transport, no transport can be created in this build
+type Transport struct{}
+
+// New returns ErrDisabled
+func New(addr string) (*Transport, error) {
+	return nil, ErrDisabled
+}
+
+// SetPorts does nothing
+func (t *Transport) SetPorts(ports func(*enode.Node) int) {}
+
+// Start returns ErrDisabled
+func (t *Transport) Start(srv *p2p.Server) error {
+	return ErrDisabled
+}
+
+// Stop does nothing
+func (t *Transport) Stop() error {
+	return nil
+}
+
+// Port returns 0 as no connections are accepted
+func (t *Transport) Port() int {
+	return 0
+}
+
+// Dial returns ErrDisabled
+func (t *Transport) Dial(dest *enode.Node) (net.Conn, error) {
+	return nil, ErrDisabled
+}
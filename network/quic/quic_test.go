@@ -0,0 +1,233 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build quic && !go1.15
+// +build quic,!go1.15
+
+package quic
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// newServer starts a p2p server dialing over the transport and running a protocol
+// that keeps the peers connected
+func newServer(t *testing.T, tr *Transport) *p2p.Server {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &p2p.Server{
+		Config: p2p.Config{
+			PrivateKey:  key,
+			MaxPeers:    10,
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			Protocols: []p2p.Protocol{{
+				Name:    "test",
+				Version: 1,
+				Length:  1,
+				Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+					for {
+						msg, err := rw.ReadMsg()
+						if err != nil {
+							return err
+						}
+						msg.Discard()
+					}
+				},
+			}},
+		},
+	}
+	if tr != nil {
+		srv.Dialer = tr
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// newTransport creates a transport accepting QUIC connections on a local port
+func newTransport(t *testing.T) *Transport {
+	t.Helper()
+	tr, err := New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// waitPeer waits for the server to be connected to a peer and returns its remote address,
+// giving a dial the time of a failed QUIC handshake and the TCP fallback
+func waitPeer(t *testing.T, srv *p2p.Server) net.Addr {
+	t.Helper()
+	deadline := time.Now().Add(HandshakeTimeout + DialTimeout + 5*time.Second)
+	for time.Now().Before(deadline) {
+		if peers := srv.Peers(); len(peers) > 0 {
+			return peers[0].RemoteAddr()
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for peer")
+	return nil
+}
+
+// TestDialQuic checks that nodes advertising the QUIC listener are connected over QUIC,
+// also if dialed before the transport of the dialer is started
+func TestDialQuic(t *testing.T) {
+	lt := newTransport(t)
+	listener := newServer(t, lt)
+	defer listener.Stop()
+	if err := lt.Start(listener); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Stop()
+
+	dt := newTransport(t)
+	dt.SetPorts(func(*enode.Node) int { return lt.Port() })
+	dialer := newServer(t, dt)
+	defer dialer.Stop()
+	dialer.AddPeer(listener.Self())
+
+	if _, ok := waitPeer(t, dialer).(*net.UDPAddr); !ok {
+		t.Fatal("expected dialer to be connected over QUIC")
+	}
+	if _, ok := waitPeer(t, listener).(*net.UDPAddr); !ok {
+		t.Fatal("expected listener to be connected over QUIC")
+	}
+	if !listener.Peers()[0].Inbound() {
+		t.Fatal("expected the QUIC peer of the listener to be inbound")
+	}
+	if err := dt.Start(dialer); err != nil {
+		t.Fatal(err)
+	}
+	if err := dt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDialFallback checks that nodes not advertising QUIC and nodes QUIC dials
+// fail to are connected over TCP
+func TestDialFallback(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		accepts bool
+	}{
+		{name: "not advertised", accepts: false},
+		{name: "dial failed", accepts: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the listener runs no transport, no port accepts QUIC connections
+			listener := newServer(t, nil)
+			defer listener.Stop()
+
+			accepts := tc.accepts
+			dt := newTransport(t)
+			dt.SetPorts(func(node *enode.Node) int {
+				if !accepts {
+					return 0
+				}
+				return node.TCP()
+			})
+			dialer := newServer(t, dt)
+			defer dialer.Stop()
+			if err := dt.Start(dialer); err != nil {
+				t.Fatal(err)
+			}
+			defer dt.Stop()
+
+			dialer.AddPeer(listener.Self())
+
+			if _, ok := waitPeer(t, dialer).(*net.TCPAddr); !ok {
+				t.Fatal("expected dialer to be connected over TCP")
+			}
+		})
+	}
+}
+
+// TestInboundLimit checks that QUIC connections beyond the inbound peers of the server are refused
+func TestInboundLimit(t *testing.T) {
+	lt := newTransport(t)
+	listener := newServer(t, lt)
+	defer listener.Stop()
+	if err := lt.Start(listener); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Stop()
+	// the inbound connections of the server are taken by connections being set up
+	lt.mtx.Lock()
+	lt.pending = maxInbound(listener)
+	lt.mtx.Unlock()
+
+	dt := newTransport(t)
+	conn, err := dt.dial(listener.Self(), lt.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	if peers := listener.Peers(); len(peers) != 0 {
+		t.Fatalf("expected no peers, got %d", len(peers))
+	}
+}
+
+// TestInboundLimitTCP checks that the inbound peers of the server connected over TCP
+// count against the QUIC connections it accepts
+func TestInboundLimitTCP(t *testing.T) {
+	lt := newTransport(t)
+	listener := newServer(t, lt)
+	defer listener.Stop()
+	if err := lt.Start(listener); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Stop()
+
+	// one inbound slot is left, it is taken by a peer dialing over TCP
+	lt.mtx.Lock()
+	lt.pending = maxInbound(listener) - 1
+	lt.mtx.Unlock()
+	dialer := newServer(t, nil)
+	defer dialer.Stop()
+	dialer.AddPeer(listener.Self())
+	if _, ok := waitPeer(t, listener).(*net.TCPAddr); !ok {
+		t.Fatal("expected listener to be connected over TCP")
+	}
+
+	dt := newTransport(t)
+	conn, err := dt.dial(listener.Self(), lt.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	if peers := listener.Peers(); len(peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(peers))
+	}
+}
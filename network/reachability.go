@@ -0,0 +1,133 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// UnderlayStats are the outcomes of the dials of an underlay address
+type UnderlayStats struct {
+	Dials       uint64    `json:"dials"`
+	Failures    uint64    `json:"failures"`
+	LastSuccess time.Time `json:"lastSuccess"` // zero if never connected
+}
+
+// reachability tests the underlay addresses of peers by the outcomes of the dials,
+// so that peers advertising several addresses, e.g. over IPv4 and IPv6, are dialed
+// on the one they were last reached on, or else on those failing the least
+type reachability struct {
+	mtx     sync.Mutex
+	stats   map[string]*UnderlayStats // by underlay address
+	dialing map[string]string         // underlay address dialed by overlay address, until the peer connects
+}
+
+func newReachability() *reachability {
+	return &reachability{
+		stats:   make(map[string]*UnderlayStats),
+		dialing: make(map[string]string),
+	}
+}
+
+// dial returns the node of the underlay address the peer is dialed on.
+// A peer is dialed again only if the previous dial did not connect, which is
+// recorded as a failure of the address dialed.
+func (r *reachability) dial(addr *BzzAddr) (*enode.Node, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if under, ok := r.dialing[string(addr.Over())]; ok {
+		r.stat(under).Failures++
+	}
+
+	unders := addr.Unders()
+	best := unders[0]
+	for _, under := range unders[1:] {
+		if r.prefer(under, best) {
+			best = under
+		}
+	}
+	node, err := enode.ParseV4(string(best))
+	if err != nil {
+		return nil, err
+	}
+	r.dialing[string(addr.Over())] = string(best)
+	r.stat(string(best)).Dials++
+	return node, nil
+}
+
+// prefer returns whether the underlay address a is preferred to b:
+// the one reached last, else the one with fewer failed dials
+func (r *reachability) prefer(a, b []byte) bool {
+	var sa, sb UnderlayStats
+	if s, ok := r.stats[string(a)]; ok {
+		sa = *s
+	}
+	if s, ok := r.stats[string(b)]; ok {
+		sb = *s
+	}
+	if !sa.LastSuccess.Equal(sb.LastSuccess) {
+		return sa.LastSuccess.After(sb.LastSuccess)
+	}
+	return sa.Failures < sb.Failures
+}
+
+// connected records that the peer connected, on the underlay address dialed
+// if the connection is outbound to it
+func (r *reachability) connected(addr *BzzAddr, remote net.Addr, inbound bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	under, ok := r.dialing[string(addr.Over())]
+	if !ok {
+		return
+	}
+	delete(r.dialing, string(addr.Over()))
+	if inbound {
+		return
+	}
+	node, err := enode.ParseV4(under)
+	if err != nil {
+		return
+	}
+	if tcp, ok := remote.(*net.TCPAddr); ok && tcp.IP.Equal(node.IP()) && tcp.Port == node.TCP() {
+		r.stat(under).LastSuccess = time.Now()
+	}
+}
+
+// stat returns the stats of the underlay address, it must be called with the lock held
+func (r *reachability) stat(under string) *UnderlayStats {
+	s, ok := r.stats[under]
+	if !ok {
+		s = &UnderlayStats{}
+		r.stats[under] = s
+	}
+	return s
+}
+
+// all returns the stats of the underlay addresses dialed
+func (r *reachability) all() map[string]UnderlayStats {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	stats := make(map[string]UnderlayStats, len(r.stats))
+	for under, s := range r.stats {
+		stats[under] = *s
+	}
+	return stats
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// TestAltUnderlays checks that the alternative underlay addresses are advertised
+// with the enode of the node and invalid addresses are refused
+func TestAltUnderlays(t *testing.T) {
+	node := enode.NewV4(&newTestKey(t).PublicKey, net.IP{127, 0, 0, 1}, 30399, 30399)
+	alts, err := AltUnderlays(node, []string{"[2001:db8::1]:30400", "10.0.0.1:30401"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []*net.TCPAddr{{IP: net.ParseIP("2001:db8::1"), Port: 30400}, {IP: net.IP{10, 0, 0, 1}, Port: 30401}} {
+		alt, err := enode.ParseV4(string(alts[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alt.ID() != node.ID() || !alt.IP().Equal(want.IP) || alt.TCP() != want.Port {
+			t.Fatalf("expected underlay %v of node %v, got %v", want, node.ID(), alt)
+		}
+	}
+	for _, addr := range []string{"localhost:30400", "10.0.0.1", "10.0.0.1:0"} {
+		if _, err := AltUnderlays(node, []string{addr}); err == nil {
+			t.Fatalf("expected underlay %q to be invalid", addr)
+		}
+	}
+}
+
+// TestReachability checks that peers are dialed on the underlay address they were
+// last reached on, and that the addresses failing the dials are avoided
+func TestReachability(t *testing.T) {
+	key := newTestKey(t)
+	v4 := enode.NewV4(&key.PublicKey, net.IP{10, 0, 0, 1}, 30399, 30399)
+	v6 := enode.NewV4(&key.PublicKey, net.ParseIP("2001:db8::1"), 30399, 30399)
+	addr := NewBzzAddrFromEnode(v4)
+	addr.AltUAddrs = [][]byte{[]byte(v6.URLv4())}
+	r := newReachability()
+
+	dial := func(want *enode.Node) {
+		t.Helper()
+		node, err := r.dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !node.IP().Equal(want.IP()) {
+			t.Fatalf("expected dial on %v, got %v", want.IP(), node.IP())
+		}
+	}
+	// the preferred address is dialed first, the other once it fails
+	dial(v4)
+	dial(v6)
+	r.connected(addr, &net.TCPAddr{IP: v6.IP(), Port: v6.TCP()}, false)
+	// the address reached is dialed again
+	dial(v6)
+	dial(v6)
+	if stats := r.all()[v6.URLv4()]; stats.Dials != 3 || stats.Failures != 1 || stats.LastSuccess.IsZero() {
+		t.Fatalf("unexpected stats of the reached address: %+v", stats)
+	}
+	if stats := r.all()[v4.URLv4()]; stats.Dials != 1 || stats.Failures != 1 || !stats.LastSuccess.IsZero() {
+		t.Fatalf("unexpected stats of the failing address: %+v", stats)
+	}
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+// API is the RPC API of the retrieval protocol
+type API struct {
+	r *Retrieval
+}
+
+// NewAPI creates the RPC API of the retrieval protocol
+func NewAPI(r *Retrieval) *API {
+	return &API{r: r}
+}
+
+// RetrievalBreakers returns the state of the circuit breakers of the peers by hex overlay address
+func (a *API) RetrievalBreakers() map[string]BreakerStats {
+	return a.r.BreakerStats()
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	// BreakerWindow is the number of the latest retrievals of a peer its failure rate is computed over
+	BreakerWindow = 20
+	// BreakerMinRequests is the number of retrievals of a peer needed before its breaker can trip
+	BreakerMinRequests = 10
+	// BreakerFailureRate is the ratio of failed retrievals at which the breaker of a peer trips
+	BreakerFailureRate = 0.5
+	// BreakerCooldown is the time after which a tripped breaker lets a probe request through
+	BreakerCooldown = 10 * time.Second
+
+	breakerTrips = metrics.NewRegisteredCounter("network/retrieve/breaker/trips", nil)
+)
+
+// states of the circuit breaker of a peer
+const (
+	BreakerClosed   = "closed"    // requests are routed to the peer
+	BreakerOpen     = "open"      // requests are not routed to the peer
+	BreakerHalfOpen = "half-open" // a probe request is routed to the peer to test its recovery
+)
+
+// BreakerStats is the state of the circuit breaker of a peer
+type BreakerStats struct {
+	State    string    `json:"state"`
+	Requests int       `json:"requests"` // retrievals in the window
+	Failures int       `json:"failures"` // failed retrievals in the window
+	Trips    uint64    `json:"trips"`    // number of times the breaker tripped
+	OpenedAt time.Time `json:"openedAt"` // time the breaker last tripped, zero if it never did
+}
+
+// breaker stops routing retrieve requests to the peers with a high rate of failed
+// retrievals among their latest ones, until a probe request is delivered after the cooldown.
+// Unlike the reputation scores, it reacts within a few requests and recovers with a single one.
+type breaker struct {
+	mtx   sync.Mutex
+	peers map[string]*peerBreaker // by overlay address
+}
+
+// peerBreaker is the circuit breaker of a peer
+type peerBreaker struct {
+	results  []bool // outcomes of the latest retrievals, oldest first
+	open     bool
+	probing  bool // whether the probe request of the half-open breaker is in flight
+	trips    uint64
+	openedAt time.Time
+}
+
+func newBreaker() *breaker {
+	return &breaker{
+		peers: make(map[string]*peerBreaker),
+	}
+}
+
+// state returns the state of the breaker, it must be called with the lock held
+func (pb *peerBreaker) state() string {
+	if !pb.open {
+		return BreakerClosed
+	}
+	if time.Since(pb.openedAt) < BreakerCooldown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// allow returns whether requests can be routed to the peer
+func (b *breaker) allow(addr []byte) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	pb, ok := b.peers[string(addr)]
+	if !ok {
+		return true
+	}
+	switch pb.state() {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return !pb.probing
+	}
+	return true
+}
+
+// sent records that a request is routed to the peer, which is the probe if the breaker is half-open
+func (b *breaker) sent(addr []byte) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if pb, ok := b.peers[string(addr)]; ok && pb.state() == BreakerHalfOpen {
+		pb.probing = true
+	}
+}
+
+// record records the outcome of a retrieval from the peer and trips or resets its breaker
+func (b *breaker) record(addr []byte, delivered bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	pb, ok := b.peers[string(addr)]
+	if !ok {
+		pb = &peerBreaker{}
+		b.peers[string(addr)] = pb
+	}
+	if pb.open {
+		// only the outcome of the probe counts, others were sent before the breaker tripped
+		if !pb.probing {
+			return
+		}
+		pb.probing = false
+		if delivered {
+			pb.open = false
+			pb.results = pb.results[:0]
+		} else {
+			pb.openedAt = time.Now()
+		}
+		return
+	}
+	pb.results = append(pb.results, delivered)
+	if len(pb.results) > BreakerWindow {
+		pb.results = pb.results[len(pb.results)-BreakerWindow:]
+	}
+	if len(pb.results) < BreakerMinRequests {
+		return
+	}
+	if float64(failures(pb.results)) >= BreakerFailureRate*float64(len(pb.results)) {
+		pb.open = true
+		pb.openedAt = time.Now()
+		pb.trips++
+		breakerTrips.Inc(1)
+	}
+}
+
+// release ends the probe of the peer without an outcome, when the request was outrun by another delivery
+func (b *breaker) release(addr []byte) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if pb, ok := b.peers[string(addr)]; ok {
+		pb.probing = false
+	}
+}
+
+// remove forgets the breaker of the peer
+func (b *breaker) remove(addr []byte) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.peers, string(addr))
+}
+
+// stats returns the state of the breakers by hex overlay address
+func (b *breaker) stats() map[string]BreakerStats {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	stats := make(map[string]BreakerStats, len(b.peers))
+	for addr, pb := range b.peers {
+		stats[hex.EncodeToString([]byte(addr))] = BreakerStats{
+			State:    pb.state(),
+			Requests: len(pb.results),
+			Failures: failures(pb.results),
+			Trips:    pb.trips,
+			OpenedAt: pb.openedAt,
+		}
+	}
+	return stats
+}
+
+// failures returns the number of failed retrievals among the outcomes
+func failures(results []bool) (n int) {
+	for _, delivered := range results {
+		if !delivered {
+			n++
+		}
+	}
+	return n
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
@@ -31,9 +32,15 @@ import (
 // retrievals for that peer
 type Peer struct {
 	*network.BzzPeer
-	logger     log.Logger             // logger with base and peer address
-	mtx        sync.Mutex             // synchronize retrievals
-	retrievals map[uint]chunk.Address // current ongoing retrievals
+	logger     log.Logger          // logger with base and peer address
+	mtx        sync.Mutex          // synchronize retrievals
+	retrievals map[uint]*retrieval // current ongoing retrievals
+}
+
+// retrieval is an outgoing retrieve request awaiting delivery
+type retrieval struct {
+	addr   chunk.Address
+	sentAt time.Time
 }
 
 // NewPeer is the constructor for Peer
@@ -41,7 +48,7 @@ func NewPeer(peer *network.BzzPeer, baseKey *network.BzzAddr) *Peer {
 	return &Peer{
 		BzzPeer:    peer,
 		logger:     log.NewBaseAddressLogger(baseKey.ShortString(), "peer", peer.BzzAddr.ShortString()),
-		retrievals: make(map[uint]chunk.Address),
+		retrievals: make(map[uint]*retrieval),
 	}
 }
 
@@ -50,29 +57,40 @@ func NewPeer(peer *network.BzzPeer, baseKey *network.BzzAddr) *Peer {
 func (p *Peer) addRetrieval(ruid uint, addr storage.Address) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
-	p.retrievals[ruid] = addr
+	p.retrievals[ruid] = &retrieval{
+		addr:   addr,
+		sentAt: time.Now(),
+	}
 }
 
-func (p *Peer) expireRetrieval(ruid uint) {
+// expireRetrieval removes the retrieval, it returns when the request was sent
+// and false if it was already delivered
+func (p *Peer) expireRetrieval(ruid uint) (time.Time, bool) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
+	v, ok := p.retrievals[ruid]
+	if !ok {
+		return time.Time{}, false
+	}
 	delete(p.retrievals, ruid)
+	return v.sentAt, true
 }
 
 // chunkReceived is called upon ChunkDelivery message reception
 // it is meant to idenfify unsolicited chunk deliveries
-func (p *Peer) checkRequest(ruid uint, addr storage.Address) error {
+// it returns the time elapsed since the retrieve request was sent
+func (p *Peer) checkRequest(ruid uint, addr storage.Address) (time.Duration, error) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 	v, ok := p.retrievals[ruid]
 	if !ok {
-		return errors.New("cannot find ruid")
+		return 0, errors.New("cannot find ruid")
 	}
 	delete(p.retrievals, ruid) // since we got the delivery we wanted - it is safe to delete the retrieve request
-	if !bytes.Equal(v, addr) {
-		return errors.New("retrieve request found but address does not match")
+	if !bytes.Equal(v.addr, addr) {
+		return 0, errors.New("retrieve request found but address does not match")
 	}
 
-	return nil
+	return time.Since(v.sentAt), nil
 }
@@ -58,7 +58,7 @@ var (
 
 	spec = &protocols.Spec{
 		Name:       "bzz-retrieve",
-		Version:    2,
+		Version:    3,
 		MaxMsgSize: 10 * 1024 * 1024,
 		Messages: []interface{}{
 			ChunkDelivery{},
@@ -80,6 +80,17 @@ func (rr *RetrieveRequest) Price() *protocols.Price {
 	}
 }
 
+// PriceEpoch returns the epoch of the prices of the request
+// RetrieveRequest implements the protocols.EpochMessage interface
+func (rr *RetrieveRequest) PriceEpoch() uint64 {
+	return rr.Epoch
+}
+
+// SetPriceEpoch sets the epoch of the prices of the request
+func (rr *RetrieveRequest) SetPriceEpoch(epoch uint64) {
+	rr.Epoch = epoch
+}
+
 // Price is the method through which a message type marks itself
 // as implementing the protocols.Price protocol and thus
 // as swap-enabled message
@@ -91,17 +102,31 @@ func (cd *ChunkDelivery) Price() *protocols.Price {
 	}
 }
 
+// PriceEpoch returns the epoch of the prices of the delivery
+// ChunkDelivery implements the protocols.EpochMessage interface
+func (cd *ChunkDelivery) PriceEpoch() uint64 {
+	return cd.Epoch
+}
+
+// SetPriceEpoch sets the epoch of the prices of the delivery
+func (cd *ChunkDelivery) SetPriceEpoch(epoch uint64) {
+	cd.Epoch = epoch
+}
+
 // Retrieval holds state and handles protocol messages for the `bzz-retrieve` protocol
 type Retrieval struct {
 	netStore    *storage.NetStore
 	baseAddress *network.BzzAddr
 	kad         *network.Kademlia
 	kademliaLB  *network.KademliaLoadBalancer
+	scheduler   *scheduler         // global scheduler of outgoing retrieve requests
+	breaker     *breaker           // stops routing requests to peers failing retrievals
 	mtx         sync.RWMutex       // protect peer map
 	peers       map[enode.ID]*Peer // compatible peers
 	spec        *protocols.Spec    // protocol spec
 	logger      log.Logger         // custom logger to append a basekey
 	quit        chan struct{}      // shutdown channel
+	zone        string             // deployment zone whose peers are preferred, empty for no preference
 }
 
 // New returns a new instance of the retrieval protocol handler
@@ -111,6 +136,8 @@ func New(kad *network.Kademlia, ns *storage.NetStore, baseKey *network.BzzAddr,
 		baseAddress: baseKey,
 		kad:         kad,
 		kademliaLB:  network.NewKademliaLoadBalancer(kad, false),
+		scheduler:   newScheduler(DefaultMaxActiveRequests),
+		breaker:     newBreaker(),
 		peers:       make(map[enode.ID]*Peer),
 		spec:        spec,
 		logger:      log.NewBaseAddressLogger(baseKey.ShortString()),
@@ -123,6 +150,19 @@ func New(kad *network.Kademlia, ns *storage.NetStore, baseKey *network.BzzAddr,
 	return r
 }
 
+// PreferZone sets the deployment zone whose peers are preferred when peers of the same
+// proximity order are candidates for a request, to keep the traffic within the zone.
+// No zone is preferred if it is empty. It must be called before the protocol is run.
+func (r *Retrieval) PreferZone(zone string) {
+	r.zone = zone
+}
+
+// SetBandwidth sets the bandwidth manager limiting the traffic of the protocol,
+// it must be called before the protocol is run
+func (r *Retrieval) SetBandwidth(b *protocols.Bandwidth) {
+	r.spec.Bandwidth = b
+}
+
 func (r *Retrieval) addPeer(p *Peer) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
@@ -134,6 +174,8 @@ func (r *Retrieval) removePeer(p *Peer) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 	delete(r.peers, p.ID())
+	r.netStore.Latencies.Remove(p.ID())
+	r.breaker.remove(p.Over())
 	retrievalPeers.Update(int64(len(r.peers)))
 }
 
@@ -216,7 +258,12 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 	}
 
 	r.kademliaLB.EachBinDesc(req.Addr, func(bin network.LBBin) bool {
-		for _, lbPeer := range bin.LBPeers {
+		// peer of the bin outside of the preferred zone, selected if none is in the zone
+		var outOfZone *network.LBPeer
+		// peer of the bin with a low reputation score, selected if no other is eligible
+		var lowScore *network.LBPeer
+		for i := range bin.LBPeers {
+			lbPeer := &bin.LBPeers[i]
 			id := lbPeer.Peer.ID()
 
 			// skip peer that does not support retrieval
@@ -224,6 +271,11 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 				continue
 			}
 
+			// skip peer that does not serve retrieve requests of others, e.g. light nodes
+			if !network.IsRetrievalRelay(lbPeer.Peer.BzzAddr) {
+				continue
+			}
+
 			// do not send request back to peer who asked us. maybe merge with SkipPeer at some point
 			if bytes.Equal(req.Origin.Bytes(), id.Bytes()) {
 				continue
@@ -260,6 +312,25 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 				return false
 			}
 
+			// skip peer whose circuit breaker is open
+			if !r.breaker.allow(lbPeer.Peer.Over()) {
+				continue
+			}
+
+			if r.kad.PeerScores().Score(lbPeer.Peer.Over()) < network.LowPeerScore {
+				if lowScore == nil {
+					lowScore = lbPeer
+				}
+				continue
+			}
+
+			if r.zone != "" && lbPeer.Peer.Zone != r.zone {
+				if outOfZone == nil {
+					outOfZone = lbPeer
+				}
+				continue
+			}
+
 			retPeer = lbPeer.Peer
 
 			// sp could be nil, if we encountered a peer that is not registered for delivery, i.e. doesn't support the `stream` protocol
@@ -273,6 +344,17 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 			}
 		}
 
+		fallback := outOfZone
+		if fallback == nil {
+			fallback = lowScore
+		}
+		if fallback != nil {
+			retPeer = fallback.Peer
+			selectedPeerPo = bin.ProximityOrder
+			fallback.AddUseCount()
+			return false
+		}
+
 		return true
 	})
 
@@ -310,8 +392,10 @@ func (r *Retrieval) handleRetrieveRequest(ctx context.Context, p *Peer, msg *Ret
 	defer cancel()
 
 	req := &storage.Request{
-		Addr:   msg.Addr,
-		Origin: p.ID(),
+		Addr:     msg.Addr,
+		Origin:   p.ID(),
+		Priority: storage.PriorityData,
+		Client:   p.ID().String(),
 	}
 	chunk, err := r.netStore.Get(ctx, chunk.ModeGetRequest, req)
 	if err != nil {
@@ -341,11 +425,15 @@ func (r *Retrieval) handleRetrieveRequest(ctx context.Context, p *Peer, msg *Ret
 // we treat the chunk as a chunk received in syncing
 func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *ChunkDelivery) error {
 	p.logger.Debug("retrieval.handleChunkDelivery", "ref", msg.Addr)
-	err := p.checkRequest(msg.Ruid, msg.Addr)
+	latency, err := p.checkRequest(msg.Ruid, msg.Addr)
 	if err != nil {
 		unsolicitedChunkDelivery.Inc(1)
 		return protocols.Break(fmt.Errorf("unsolicited chunk delivery from peer, ruid %d, addr %s: %w", msg.Ruid, msg.Addr, err))
 	}
+	// feed the delivery latency to the netstore request scheduler
+	r.netStore.Latencies.Record(p.ID(), latency)
+	r.kad.PeerScores().RecordRetrieval(p.Over(), true, latency)
+	r.breaker.record(p.Over(), true)
 	var osp opentracing.Span
 	ctx, osp = spancontext.StartSpan(
 		ctx,
@@ -354,7 +442,7 @@ func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *Chunk
 	processReceivedChunksCount.Inc(1)
 
 	// count how many chunks we receive for retrieve requests per peer
-	peermetric := fmt.Sprintf("network/retrieve/chunk/delivery/%x", p.BzzAddr.Over()[:16])
+	peermetric := fmt.Sprintf("network/retrieve/chunk/delivery/%s", r.kad.PeerMetricName(p.BzzAddr))
 	metrics.GetOrRegisterCounter(peermetric, nil).Inc(1)
 
 	peerPO := chunk.Proximity(p.BzzAddr.Over(), msg.Addr)
@@ -389,6 +477,12 @@ func (r *Retrieval) RequestFromPeers(ctx context.Context, req *storage.Request,
 	r.logger.Debug("retrieval.requestFromPeers", "req.Addr", req.Addr, "localID", localID)
 	metrics.GetOrRegisterCounter("network/retrieve/request_from_peers", nil).Inc(1)
 
+	// wait for our turn among all the concurrent retrievals
+	release, err := r.scheduler.acquire(ctx, req.Priority, req.Client)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
 	const maxFindPeerRetries = 5
 	retries := 0
 
@@ -396,6 +490,7 @@ FINDPEER:
 	sp, err := r.findPeerLB(ctx, req)
 	if err != nil {
 		r.logger.Trace(err.Error())
+		release()
 		return nil, func() {}, err
 	}
 
@@ -406,6 +501,7 @@ FINDPEER:
 		retries++
 		if retries == maxFindPeerRetries {
 			r.logger.Trace("max find peer retries reached", "max retries", maxFindPeerRetries, "ref", req.Addr)
+			release()
 			return nil, func() {}, ErrNoPeerFound
 		}
 
@@ -418,12 +514,24 @@ FINDPEER:
 	}
 	protoPeer.logger.Trace("sending retrieve request", "ref", ret.Addr, "origin", localID, "ruid", ret.Ruid)
 	protoPeer.addRetrieval(ret.Ruid, ret.Addr)
+	r.breaker.sent(protoPeer.Over())
 	cleanup := func() {
-		protoPeer.expireRetrieval(ret.Ruid)
+		// requests still pending after the search timeout count against the reputation of the peer,
+		// the ones cleaned up earlier were outrun by another delivery
+		if sentAt, ok := protoPeer.expireRetrieval(ret.Ruid); ok {
+			if time.Since(sentAt) >= timeouts.SearchTimeout {
+				r.kad.PeerScores().RecordRetrieval(protoPeer.Over(), false, 0)
+				r.breaker.record(protoPeer.Over(), false)
+			} else {
+				r.breaker.release(protoPeer.Over())
+			}
+		}
+		release()
 	}
 	err = protoPeer.Send(ctx, ret)
 	if err != nil {
 		protoPeer.logger.Trace("error sending retrieve request to peer", "ruid", ret.Ruid, "err", err)
+		r.breaker.record(protoPeer.Over(), false)
 		cleanup()
 		return nil, func() {}, err
 	}
@@ -432,6 +540,16 @@ FINDPEER:
 	return &spID, cleanup, nil
 }
 
+// SchedulerStats returns the state of the global retrieval scheduler
+func (r *Retrieval) SchedulerStats() *SchedulerStats {
+	return r.scheduler.stats()
+}
+
+// BreakerStats returns the state of the circuit breakers of the peers by hex overlay address
+func (r *Retrieval) BreakerStats() map[string]BreakerStats {
+	return r.breaker.stats()
+}
+
 func (r *Retrieval) Start(server *p2p.Server) error {
 	r.logger.Info("starting bzz-retrieve")
 	return nil
@@ -463,7 +581,14 @@ func (r *Retrieval) runProtocol(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 }
 
 func (r *Retrieval) APIs() []rpc.API {
-	return nil
+	return []rpc.API{
+		{
+			Namespace: "bzz",
+			Version:   "1.0",
+			Service:   NewAPI(r),
+			Public:    false,
+		},
+	}
 }
 
 func (r *Retrieval) Spec() *protocols.Spec {
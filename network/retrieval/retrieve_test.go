@@ -519,7 +519,114 @@ func TestRequestFromPeers(t *testing.T) {
 	}
 }
 
-//TestHasPriceImplementation is to check that Retrieval provides priced messages
+// TestRequestFromPeersPreferZone tests that among peers of the same proximity order
+// the peers of the preferred zone are selected, and other peers only if there are none
+func TestRequestFromPeersPreferZone(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	to := network.NewKademlia(addr.OAddr, network.NewKadParams())
+
+	// both peers have proximity order 3 with the chunk
+	ids := []enode.ID{
+		enode.HexID("3431c3939e1ee2a6345e976a8234f9870152d64879f30bc272a074f6859e75e8"),
+		enode.HexID("4431c3939e1ee2a6345e976a8234f9870152d64879f30bc272a074f6859e75e8"),
+	}
+	zones := []string{"a", "b"}
+	for i, id := range ids {
+		oaddr := make([]byte, len(hash0))
+		copy(oaddr, hash0[:])
+		oaddr[0] ^= 0x10
+		oaddr[31] ^= byte(i + 1)
+		protocolsPeer := protocols.NewPeer(p2p.NewPeer(id, "dummy", []p2p.Cap{{Name: "bzz-retrieve", Version: 1}}), nil, nil)
+		to.On(network.NewPeer(&network.BzzPeer{
+			BzzAddr: network.NewBzzAddr(oaddr, nil),
+			Peer:    protocolsPeer,
+			Zone:    zones[i],
+		}, to))
+	}
+
+	s := New(to, nil, addr, nil)
+	s.PreferZone("b")
+	for i := 0; i < 4; i++ {
+		p, err := s.findPeerLB(context.Background(), storage.NewRequest(storage.Address(hash0[:])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ID() != ids[1] {
+			t.Fatalf("expected peer in the preferred zone %v, got %v", ids[1], p.ID())
+		}
+	}
+
+	// peers outside of the preferred zone are selected if none is in the zone
+	s.PreferZone("c")
+	if _, err := s.findPeerLB(context.Background(), storage.NewRequest(storage.Address(hash0[:]))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRequestFromPeersBreaker tests that requests are not routed to a peer failing
+// retrievals until the probe request after the cooldown is delivered
+func TestRequestFromPeersBreaker(t *testing.T) {
+	defer func(cooldown time.Duration) { BreakerCooldown = cooldown }(BreakerCooldown)
+	BreakerCooldown = 50 * time.Millisecond
+
+	dummyPeerID := enode.HexID("3431c3939e1ee2a6345e976a8234f9870152d64879f30bc272a074f6859e75e8")
+	addr := network.RandomBzzAddr()
+	to := network.NewKademlia(addr.OAddr, network.NewKadParams())
+	peerAddr := network.RandomBzzAddr()
+	protocolsPeer := protocols.NewPeer(p2p.NewPeer(dummyPeerID, "dummy", []p2p.Cap{{Name: "bzz-retrieve", Version: 1}}), nil, nil)
+	to.On(network.NewPeer(&network.BzzPeer{
+		BzzAddr: peerAddr,
+		Peer:    protocolsPeer,
+	}, to))
+
+	s := New(to, nil, addr, nil)
+	findPeer := func() error {
+		_, err := s.findPeerLB(context.Background(), storage.NewRequest(storage.Address(hash0[:])))
+		return err
+	}
+	state := func() string {
+		return s.BreakerStats()[hex.EncodeToString(peerAddr.Over())].State
+	}
+
+	for i := 0; i < BreakerMinRequests; i++ {
+		if err := findPeer(); err != nil {
+			t.Fatal(err)
+		}
+		s.breaker.sent(peerAddr.Over())
+		s.breaker.record(peerAddr.Over(), i%2 == 0)
+	}
+	if state() != BreakerOpen {
+		t.Fatalf("expected breaker to be %s, got %s", BreakerOpen, state())
+	}
+	if err := findPeer(); err != ErrNoPeerFound {
+		t.Fatalf("expected error %v, got %v", ErrNoPeerFound, err)
+	}
+
+	time.Sleep(BreakerCooldown)
+	if state() != BreakerHalfOpen {
+		t.Fatalf("expected breaker to be %s, got %s", BreakerHalfOpen, state())
+	}
+	if err := findPeer(); err != nil {
+		t.Fatal(err)
+	}
+	// only a single probe is routed to the peer
+	s.breaker.sent(peerAddr.Over())
+	if err := findPeer(); err != ErrNoPeerFound {
+		t.Fatalf("expected error %v, got %v", ErrNoPeerFound, err)
+	}
+	s.breaker.record(peerAddr.Over(), true)
+	if state() != BreakerClosed {
+		t.Fatalf("expected breaker to be %s, got %s", BreakerClosed, state())
+	}
+	if err := findPeer(); err != nil {
+		t.Fatal(err)
+	}
+	if trips := s.BreakerStats()[hex.EncodeToString(peerAddr.Over())].Trips; trips != 1 {
+		t.Fatalf("expected 1 trip, got %d", trips)
+	}
+}
+
+// TestHasPriceImplementation is to check that Retrieval provides priced messages
 func TestHasPriceImplementation(t *testing.T) {
 	price := (&ChunkDelivery{}).Price()
 	if price == nil || price.Value == 0 {
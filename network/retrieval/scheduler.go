@@ -0,0 +1,219 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// DefaultMaxActiveRequests is the default number of retrieve requests which
+// can be in flight at the same time across all downloads
+var DefaultMaxActiveRequests = 512
+
+// scheduler is the global retrieval scheduler shared by all downloads.
+// It caps the number of in-flight retrieve requests and when the cap is reached,
+// it queues the requests in priority lanes (see storage.Priority).
+// A free slot is always granted to the highest priority lane with waiting
+// requests, and within a lane the clients waiting are served round robin,
+// so that a single large download can not starve the others.
+type scheduler struct {
+	mtx     sync.Mutex
+	max     int                                              // max number of active requests
+	active  int                                              // number of active requests
+	waiting int                                              // number of queued requests
+	lanes   [storage.NumPriorities][]*clientWaiters          // clients with waiting requests per lane
+	clients [storage.NumPriorities]map[string]*clientWaiters // clients per lane by identifier
+	cursor  [storage.NumPriorities]int                       // round robin cursor per lane
+}
+
+// clientWaiters are the queued requests of a single client in a priority lane
+type clientWaiters struct {
+	client  string
+	waiters []chan struct{}
+}
+
+func newScheduler(max int) *scheduler {
+	s := &scheduler{
+		max: max,
+	}
+	for i := range s.clients {
+		s.clients[i] = make(map[string]*clientWaiters)
+	}
+	return s
+}
+
+// acquire waits for a slot to send a retrieve request with priority p on behalf of client.
+// It returns a function that must be called to release the slot once the request
+// is either delivered or expired. It returns an error if the context is done before a
+// slot is granted.
+func (s *scheduler) acquire(ctx context.Context, p storage.Priority, client string) (func(), error) {
+	if p < 0 || int(p) >= storage.NumPriorities {
+		return nil, fmt.Errorf("invalid priority %d", p)
+	}
+
+	s.mtx.Lock()
+	if s.active < s.max && s.waiting == 0 {
+		s.active++
+		s.mtx.Unlock()
+		return s.releaseFunc(), nil
+	}
+
+	granted := make(chan struct{})
+	cw, ok := s.clients[p][client]
+	if !ok {
+		cw = &clientWaiters{client: client}
+		s.clients[p][client] = cw
+		s.lanes[p] = append(s.lanes[p], cw)
+	}
+	cw.waiters = append(cw.waiters, granted)
+	s.waiting++
+	metrics.GetOrRegisterCounter(fmt.Sprintf("network/retrieve/scheduler/queued/%d", p), nil).Inc(1)
+	s.mtx.Unlock()
+
+	select {
+	case <-granted:
+		return s.releaseFunc(), nil
+	case <-ctx.Done():
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if !s.removeWaiter(p, cw, granted) {
+			// the slot was granted concurrently, give it to the next in line
+			s.active--
+			s.dispatch()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaseFunc returns a function releasing a slot which can be called multiple times
+func (s *scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.active--
+			s.dispatch()
+		})
+	}
+}
+
+// dispatch grants free slots to the waiting requests
+// must be called with the lock held
+func (s *scheduler) dispatch() {
+	for s.active < s.max && s.waiting > 0 {
+		granted := s.next()
+		if granted == nil {
+			return
+		}
+		s.waiting--
+		s.active++
+		close(granted)
+	}
+}
+
+// next pops the next waiting request from the highest priority lane
+// serving the clients of the lane round robin
+// must be called with the lock held
+func (s *scheduler) next() chan struct{} {
+	for p := storage.NumPriorities - 1; p >= 0; p-- {
+		lane := s.lanes[p]
+		if len(lane) == 0 {
+			continue
+		}
+		i := s.cursor[p] % len(lane)
+		cw := lane[i]
+		granted := cw.waiters[0]
+		cw.waiters = cw.waiters[1:]
+		if len(cw.waiters) == 0 {
+			s.removeClient(p, i)
+		} else {
+			s.cursor[p] = (i + 1) % len(lane)
+		}
+		return granted
+	}
+	return nil
+}
+
+// removeWaiter removes a queued request which is no longer interested in a slot
+// it returns false if the request was not found, i.e. the slot was already granted
+// must be called with the lock held
+func (s *scheduler) removeWaiter(p storage.Priority, cw *clientWaiters, granted chan struct{}) bool {
+	for i, c := range cw.waiters {
+		if c != granted {
+			continue
+		}
+		cw.waiters = append(cw.waiters[:i], cw.waiters[i+1:]...)
+		s.waiting--
+		if len(cw.waiters) == 0 {
+			for j, l := range s.lanes[p] {
+				if l == cw {
+					s.removeClient(int(p), j)
+					break
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// removeClient removes the client at index i of lane p which has no more waiting requests
+// must be called with the lock held
+func (s *scheduler) removeClient(p int, i int) {
+	cw := s.lanes[p][i]
+	delete(s.clients[p], cw.client)
+	s.lanes[p] = append(s.lanes[p][:i], s.lanes[p][i+1:]...)
+	if len(s.lanes[p]) == 0 {
+		s.cursor[p] = 0
+	} else {
+		if s.cursor[p] > i {
+			s.cursor[p]--
+		}
+		s.cursor[p] %= len(s.lanes[p])
+	}
+}
+
+// SchedulerStats is the state of the retrieval scheduler
+type SchedulerStats struct {
+	Active  int   // number of in-flight retrieve requests
+	Max     int   // max number of in-flight retrieve requests
+	Waiting []int // number of queued requests per priority lane, lowest priority first
+}
+
+// stats returns the current state of the scheduler
+func (s *scheduler) stats() *SchedulerStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	st := &SchedulerStats{
+		Active:  s.active,
+		Max:     s.max,
+		Waiting: make([]int, storage.NumPriorities),
+	}
+	for p, lane := range s.lanes {
+		for _, cw := range lane {
+			st.Waiting[p] += len(cw.waiters)
+		}
+	}
+	return st
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/storage"
+)
+
+// TestSchedulerPriority checks that when the scheduler is saturated, released slots
+// are granted to the highest priority lane first, and round robin among the clients of a lane
+func TestSchedulerPriority(t *testing.T) {
+	s := newScheduler(1)
+
+	release, err := s.acquire(context.Background(), storage.PriorityData, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type waiter struct {
+		name     string
+		priority storage.Priority
+		client   string
+	}
+	waiters := []waiter{
+		{"bg", storage.PriorityBackgroundData, "a"},
+		{"a1", storage.PriorityData, "a"},
+		{"a2", storage.PriorityData, "a"},
+		{"a3", storage.PriorityData, "a"},
+		{"b1", storage.PriorityData, "b"},
+		{"meta", storage.PriorityMetadata, "b"},
+	}
+
+	order := make(chan string, len(waiters))
+	releases := make(chan func(), len(waiters))
+	for i, w := range waiters {
+		w := w
+		go func() {
+			release, err := s.acquire(context.Background(), w.priority, w.client)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- w.name
+			releases <- release
+		}()
+		// make sure waiters are queued in order
+		waitForWaiting(t, s, i+1)
+	}
+
+	release()
+
+	exp := []string{"meta", "a1", "b1", "a2", "a3", "bg"}
+	for _, e := range exp {
+		select {
+		case got := <-order:
+			if got != e {
+				t.Fatalf("expected %s to be granted, got %s", e, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %s", e)
+		}
+		(<-releases)()
+	}
+
+	st := s.stats()
+	if st.Active != 0 {
+		t.Fatalf("expected no active requests, got %d", st.Active)
+	}
+}
+
+// TestSchedulerCancel checks that a request whose context is done
+// while queued does not hold on to a slot
+func TestSchedulerCancel(t *testing.T) {
+	s := newScheduler(1)
+
+	release, err := s.acquire(context.Background(), storage.PriorityData, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, storage.PriorityData, "b"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if st := s.stats(); st.Waiting[storage.PriorityData] != 0 {
+		t.Fatalf("expected no waiting requests, got %d", st.Waiting[storage.PriorityData])
+	}
+
+	// releasing twice must not free more than one slot
+	release()
+	release()
+	if st := s.stats(); st.Active != 0 {
+		t.Fatalf("expected no active requests, got %d", st.Active)
+	}
+
+	if _, err := s.acquire(context.Background(), storage.PriorityData, "b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForWaiting(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		s.mtx.Lock()
+		waiting := s.waiting
+		s.mtx.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d queued requests", n)
+}
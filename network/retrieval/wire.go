@@ -20,8 +20,9 @@ import "github.com/ethersphere/swarm/storage"
 
 // RetrieveRequest is the protocol msg for chunk retrieve requests
 type RetrieveRequest struct {
-	Ruid uint
-	Addr storage.Address
+	Ruid  uint
+	Addr  storage.Address
+	Epoch uint64 // epoch of the prices agreed by the peers the request is priced from
 }
 
 // ChunkDelivery is the protocol msg for delivering a solicited chunk to a peer
@@ -29,4 +30,5 @@ type ChunkDelivery struct {
 	Ruid  uint
 	Addr  storage.Address
 	SData []byte
+	Epoch uint64 // epoch of the prices agreed by the peers the delivery is priced from
 }
@@ -0,0 +1,190 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/pot"
+)
+
+const (
+	// LowPeerScore is the score below which peers are only selected for routing
+	// requests if no better scored peer is eligible
+	LowPeerScore = 0.5
+
+	scoreLatencyReference = time.Second // average delivery latency halving the score
+	scoreLatencyWeight    = 0.2         // weight of the latest latency in the moving average
+)
+
+// PeerScore is the reputation of a peer built from its behaviour
+type PeerScore struct {
+	Retrievals        uint64        `json:"retrievals"`        // chunks delivered for retrieve requests
+	RetrievalFailures uint64        `json:"retrievalFailures"` // retrieve requests not served in time
+	Latency           time.Duration `json:"latency"`           // moving average of the retrieval delivery latency
+	Syncs             uint64        `json:"syncs"`             // pull sync batches completed
+	SyncFailures      uint64        `json:"syncFailures"`      // pull sync batches failed or timed out
+	Violations        uint64        `json:"violations"`        // protocol violations the peer was dropped for
+	Score             float64       `json:"score"`             // reputation between 0 and 1
+}
+
+// score computes the reputation as the product of the retrieval and sync success rates,
+// a latency factor and a factor decreasing with the protocol violations,
+// peers without recorded behaviour have the score 1
+func (s *PeerScore) score() float64 {
+	retrieval := float64(s.Retrievals+1) / float64(s.Retrievals+s.RetrievalFailures+1)
+	sync := float64(s.Syncs+1) / float64(s.Syncs+s.SyncFailures+1)
+	latency := float64(scoreLatencyReference) / float64(scoreLatencyReference+s.Latency)
+	violations := 1 / float64(s.Violations+1)
+	return retrieval * sync * latency * violations
+}
+
+// PeerScores tracks the behaviour of peers by overlay address to score their reputation,
+// which is used to evict peers from overfull kademlia bins and to route requests
+// the scores are kept in memory for the lifetime of the node so that reconnecting
+// peers keep their reputation
+type PeerScores struct {
+	mu     sync.RWMutex
+	scores map[string]*PeerScore // scores by hex overlay address
+}
+
+// NewPeerScores creates an empty PeerScores
+func NewPeerScores() *PeerScores {
+	return &PeerScores{
+		scores: make(map[string]*PeerScore),
+	}
+}
+
+// update applies f to the score of the overlay address, nil-safe
+func (s *PeerScores) update(addr []byte, f func(*PeerScore)) {
+	if s == nil {
+		return
+	}
+	key := hex.EncodeToString(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps, ok := s.scores[key]
+	if !ok {
+		ps = new(PeerScore)
+		s.scores[key] = ps
+	}
+	f(ps)
+}
+
+// RecordRetrieval records a retrieve request served by the peer with the delivery latency,
+// or a failure if the request was not served in time
+func (s *PeerScores) RecordRetrieval(addr []byte, ok bool, latency time.Duration) {
+	s.update(addr, func(ps *PeerScore) {
+		if !ok {
+			ps.RetrievalFailures++
+			return
+		}
+		ps.Retrievals++
+		if ps.Latency == 0 {
+			ps.Latency = latency
+			return
+		}
+		ps.Latency = time.Duration(scoreLatencyWeight*float64(latency) + (1-scoreLatencyWeight)*float64(ps.Latency))
+	})
+}
+
+// RecordSync records a completed pull sync batch from the peer, or a failed one
+func (s *PeerScores) RecordSync(addr []byte, ok bool) {
+	s.update(addr, func(ps *PeerScore) {
+		if ok {
+			ps.Syncs++
+		} else {
+			ps.SyncFailures++
+		}
+	})
+}
+
+// RecordViolation records a protocol violation of the peer
+func (s *PeerScores) RecordViolation(addr []byte) {
+	metrics.GetOrRegisterCounter("network/scores/violations", nil).Inc(1)
+	s.update(addr, func(ps *PeerScore) {
+		ps.Violations++
+	})
+}
+
+// Score returns the reputation of the overlay address between 0 and 1,
+// 1 for peers without recorded behaviour or if the scores are nil
+func (s *PeerScores) Score(addr []byte) float64 {
+	if s == nil {
+		return 1
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ps, ok := s.scores[hex.EncodeToString(addr)]
+	if !ok {
+		return 1
+	}
+	return ps.score()
+}
+
+// All returns the scores by hex overlay address
+func (s *PeerScores) All() map[string]PeerScore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scores := make(map[string]PeerScore, len(s.scores))
+	for k, v := range s.scores {
+		ps := *v
+		ps.Score = v.score()
+		scores[k] = ps
+	}
+	return scores
+}
+
+// SetPeerScores sets the scores used to evict peers from bins holding more than
+// MaxBinSize peers, it must be called before the kademlia is used
+func (k *Kademlia) SetPeerScores(s *PeerScores) {
+	k.scores = s
+}
+
+// PeerScores returns the scores of the peers, nil if not set
+func (k *Kademlia) PeerScores() *PeerScores {
+	return k.scores
+}
+
+// evictionCandidate returns the lowest scored connected peer in the bin of proximity order po
+// if the bin holds more than MaxBinSize peers and is shallower than the neighbourhood depth,
+// nil otherwise or if scores are not set
+// must be called with the lock held
+func (k *Kademlia) evictionCandidate(po int) *Peer {
+	if k.scores == nil || po >= depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base) {
+		return nil
+	}
+	var candidate *Peer
+	lowest := 2.0
+	k.defaultIndex.conns.EachBin(k.base, Pof, po, func(bin *pot.Bin) bool {
+		if bin.ProximityOrder != po || bin.Size <= k.MaxBinSize {
+			return false
+		}
+		bin.ValIterator(func(val pot.Val) bool {
+			p := val.(*entry).conn
+			if score := k.scores.Score(p.Over()); score < lowest {
+				candidate, lowest = p, score
+			}
+			return true
+		})
+		return false
+	}, true)
+	return candidate
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// TestPeerScores tests that the recorded behaviour of peers lowers their scores
+func TestPeerScores(t *testing.T) {
+	var nilScores *PeerScores
+	nilScores.RecordViolation([]byte{1})
+	if score := nilScores.Score([]byte{1}); score != 1 {
+		t.Fatalf("expected score 1 without scores, got %v", score)
+	}
+
+	s := NewPeerScores()
+	good, slow, failing, violating := []byte{1}, []byte{2}, []byte{3}, []byte{4}
+	if score := s.Score(good); score != 1 {
+		t.Fatalf("expected score 1 for unknown peer, got %v", score)
+	}
+	for i := 0; i < 10; i++ {
+		s.RecordRetrieval(good, true, 10*time.Millisecond)
+		s.RecordSync(good, true)
+		s.RecordRetrieval(slow, true, 2*time.Second)
+		s.RecordRetrieval(failing, false, 0)
+		s.RecordSync(failing, false)
+	}
+	// a single violation halves the score, more bring it below LowPeerScore
+	s.RecordViolation(violating)
+	s.RecordViolation(violating)
+
+	scores := s.All()
+	if len(scores) != 4 {
+		t.Fatalf("expected 4 scores, got %d", len(scores))
+	}
+	if ps := scores["01"]; ps.Retrievals != 10 || ps.Syncs != 10 || ps.Latency != 10*time.Millisecond {
+		t.Fatalf("unexpected score of good peer %+v", ps)
+	}
+	if score := s.Score(good); score < 0.95 {
+		t.Fatalf("expected good peer to score high, got %v", score)
+	}
+	for name, addr := range map[string][]byte{"slow": slow, "failing": failing, "violating": violating} {
+		if score := s.Score(addr); score >= LowPeerScore {
+			t.Fatalf("expected %s peer to score low, got %v", name, score)
+		}
+	}
+	if s.Score(failing) >= s.Score(slow) {
+		t.Fatal("expected failing peer to score lower than slow peer")
+	}
+}
+
+// TestKademliaEviction tests that the lowest scored peer is evicted from a bin outside
+// the neighbourhood holding more than MaxBinSize peers
+func TestKademliaEviction(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.MaxBinSize = 2
+	scores := NewPeerScores()
+	tk.SetPeerScores(scores)
+
+	on := func(s string) *Peer {
+		p := tk.newTestKadPeer(s)
+		p.BzzPeer.Peer = protocols.NewPeer(p2p.NewPeer(enode.ID{}, s, nil), nil, nil)
+		tk.Kademlia.On(p)
+		return p
+	}
+	// neighbourhood of depth 1
+	on("01000000")
+	on("00100000")
+
+	worst := tk.newTestKadPeer("11000000")
+	scores.RecordViolation(worst.Over())
+	on("10000000")
+	on("11000000")
+	if p := tk.evictionCandidate(0); p != nil {
+		t.Fatalf("expected no eviction from bin of MaxBinSize peers, got %v", p)
+	}
+	on("10100000")
+	p := tk.evictionCandidate(0)
+	if p == nil || !bytes.Equal(p.Over(), worst.Over()) {
+		t.Fatalf("expected lowest scored peer to be evicted, got %v", p)
+	}
+
+	// bins within the neighbourhood are not evicted from
+	if p := tk.evictionCandidate(1); p != nil {
+		t.Fatalf("expected no eviction within the neighbourhood, got %v", p)
+	}
+
+	// without scores no peer is evicted
+	tk.SetPeerScores(nil)
+	if p := tk.evictionCandidate(0); p != nil {
+		t.Fatalf("expected no eviction without scores, got %v", p)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/golang/snappy"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// BatchDelay is the time offered and wanted hashes are held for to be sent
+	// in a single frame with the ones of the other ranges synced with the peer
+	BatchDelay = 10 * time.Millisecond
+	// MaxBatchHashes is the number of offered hashes above which a frame is sent without waiting
+	MaxBatchHashes = 16 * BatchSize
+
+	batchFrameCount   = metrics.GetOrRegisterCounter("network/stream/batch/frames", nil)
+	batchMessageCount = metrics.GetOrRegisterCounter("network/stream/batch/messages", nil)
+	batchRawBytes     = metrics.GetOrRegisterCounter("network/stream/batch/raw_bytes", nil)
+	batchEncodedBytes = metrics.GetOrRegisterCounter("network/stream/batch/encoded_bytes", nil)
+)
+
+var (
+	errInvalidBatch    = errors.New("invalid batch")
+	errInvalidDeltaEnc = errors.New("invalid delta encoded hashes")
+)
+
+// Batch is a frame of the OfferedHashes and WantedHashes messages of the ranges of
+// all bins synced with a peer that were ready at about the same time. The hashes of the offers
+// are delta encoded and the frame is snappy compressed.
+type Batch struct {
+	Frame []byte
+}
+
+// batchFrame is the RLP encoded content of a Batch, the hashes of the offers are delta encoded
+type batchFrame struct {
+	Offers []OfferedHashes
+	Wants  []WantedHashes
+}
+
+// encodeBatch encodes the offers and wants in a Batch
+func encodeBatch(offers []OfferedHashes, wants []WantedHashes) (*Batch, error) {
+	frame := batchFrame{
+		Offers: make([]OfferedHashes, len(offers)),
+		Wants:  wants,
+	}
+	raw := 0
+	for i, o := range offers {
+		frame.Offers[i] = OfferedHashes{
+			Ruid:      o.Ruid,
+			LastIndex: o.LastIndex,
+			Hashes:    deltaEncode(o.Hashes),
+		}
+		raw += len(o.Hashes)
+	}
+	for _, w := range wants {
+		raw += len(w.BitVector)
+	}
+	data, err := rlp.EncodeToBytes(frame)
+	if err != nil {
+		return nil, err
+	}
+	b := &Batch{Frame: snappy.Encode(nil, data)}
+	batchRawBytes.Inc(int64(raw))
+	batchEncodedBytes.Inc(int64(len(b.Frame)))
+	return b, nil
+}
+
+// decode returns the offers and wants of the batch
+func (b *Batch) decode() ([]OfferedHashes, []WantedHashes, error) {
+	n, err := snappy.DecodedLen(b.Frame)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidBatch, err)
+	}
+	if n > int(Spec.MaxMsgSize) {
+		return nil, nil, fmt.Errorf("%w: decoded size %d too large", errInvalidBatch, n)
+	}
+	data, err := snappy.Decode(nil, b.Frame)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidBatch, err)
+	}
+	var frame batchFrame
+	if err := rlp.DecodeBytes(data, &frame); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidBatch, err)
+	}
+	for i := range frame.Offers {
+		hashes, err := deltaDecode(frame.Offers[i].Hashes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: ruid %d: %v", errInvalidBatch, frame.Offers[i].Ruid, err)
+		}
+		frame.Offers[i].Hashes = hashes
+	}
+	return frame.Offers, frame.Wants, nil
+}
+
+// deltaEncode encodes the concatenated hashes as the number of leading bytes
+// each hash shares with the previous one followed by the rest of the hash.
+// The hashes offered for a bin share the prefix of the neighbourhood of the peer,
+// so that the deeper the bin, the shorter its encoding.
+func deltaEncode(hashes []byte) []byte {
+	enc := make([]byte, 0, len(hashes)+len(hashes)/HashSize)
+	var prev []byte
+	for i := 0; i+HashSize <= len(hashes); i += HashSize {
+		hash := hashes[i : i+HashSize]
+		shared := 0
+		for prev != nil && shared < HashSize-1 && hash[shared] == prev[shared] {
+			shared++
+		}
+		enc = append(enc, byte(shared))
+		enc = append(enc, hash[shared:]...)
+		prev = hash
+	}
+	return enc
+}
+
+// deltaDecode decodes the concatenated hashes encoded by deltaEncode
+func deltaDecode(enc []byte) ([]byte, error) {
+	hashes := make([]byte, 0, len(enc))
+	var prev []byte
+	for len(enc) > 0 {
+		shared := int(enc[0])
+		if shared >= HashSize || prev == nil && shared > 0 {
+			return nil, errInvalidDeltaEnc
+		}
+		rest := HashSize - shared
+		if len(enc) < 1+rest {
+			return nil, errInvalidDeltaEnc
+		}
+		start := len(hashes)
+		hashes = append(hashes, prev[:shared]...)
+		hashes = append(hashes, enc[1:1+rest]...)
+		prev = hashes[start:]
+		enc = enc[1+rest:]
+	}
+	return hashes, nil
+}
+
+// batcher holds the offered and wanted hashes sent to a peer for BatchDelay
+// and sends them in a single Batch
+type batcher struct {
+	mtx     sync.Mutex
+	pending *pendingBatch
+	send    func(context.Context, interface{}) error
+}
+
+// pendingBatch is the batch filled by the senders until it is flushed
+type pendingBatch struct {
+	offers []OfferedHashes
+	wants  []WantedHashes
+	hashes int
+	once   sync.Once
+	done   chan struct{} // closed when the batch is sent
+	err    error         // the error of the send
+}
+
+func newBatcher(send func(context.Context, interface{}) error) *batcher {
+	return &batcher{send: send}
+}
+
+// add adds the OfferedHashes or WantedHashes message to the pending batch and
+// blocks until the batch is sent, returning the error of the send
+func (b *batcher) add(ctx context.Context, msg interface{}) error {
+	b.mtx.Lock()
+	pb := b.pending
+	if pb == nil {
+		pb = &pendingBatch{done: make(chan struct{})}
+		b.pending = pb
+		time.AfterFunc(BatchDelay, func() { b.flush(pb) })
+	}
+	switch msg := msg.(type) {
+	case OfferedHashes:
+		pb.offers = append(pb.offers, msg)
+		pb.hashes += len(msg.Hashes) / HashSize
+	case WantedHashes:
+		pb.wants = append(pb.wants, msg)
+	default:
+		b.mtx.Unlock()
+		return fmt.Errorf("message type %T not batched", msg)
+	}
+	full := pb.hashes >= MaxBatchHashes
+	b.mtx.Unlock()
+
+	if full {
+		b.flush(pb)
+	}
+	select {
+	case <-pb.done:
+		return pb.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush sends the pending batch once
+func (b *batcher) flush(pb *pendingBatch) {
+	pb.once.Do(func() {
+		b.mtx.Lock()
+		if b.pending == pb {
+			b.pending = nil
+		}
+		b.mtx.Unlock()
+
+		defer close(pb.done)
+		batch, err := encodeBatch(pb.offers, pb.wants)
+		if err != nil {
+			pb.err = err
+			return
+		}
+		batchFrameCount.Inc(1)
+		batchMessageCount.Inc(int64(len(pb.offers) + len(pb.wants)))
+		pb.err = b.send(context.Background(), batch)
+	})
+}
+
+// handleBatch handles the offers and wants of the batch as separate messages,
+// concurrently as they would be by the protocol peer
+func (r *Registry) handleBatch(ctx context.Context, p *Peer, msg *Batch) error {
+	offers, wants, err := msg.decode()
+	if err != nil {
+		return protocols.Break(err)
+	}
+	var g errgroup.Group
+	for i := range offers {
+		o := &offers[i]
+		g.Go(func() error {
+			return r.clientHandleOfferedHashes(ctx, p, o)
+		})
+	}
+	for i := range wants {
+		w := &wants[i]
+		g.Go(func() error {
+			return r.serverHandleWantedHashes(ctx, p, w)
+		})
+	}
+	return g.Wait()
+}
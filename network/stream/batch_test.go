@@ -0,0 +1,167 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestDeltaEncoding tests that hashes are delta encoded to less bytes the longer
+// the prefixes they share and decoded to the same hashes
+func TestDeltaEncoding(t *testing.T) {
+	hashes := make([]byte, 4*HashSize)
+	copy(hashes, testutil.RandomBytes(1, len(hashes)))
+	// the second and third hashes share 2 and 31 bytes with the previous one
+	copy(hashes[HashSize:HashSize+2], hashes[:2])
+	copy(hashes[2*HashSize:3*HashSize-1], hashes[HashSize:2*HashSize-1])
+	hashes[3*HashSize] = hashes[2*HashSize] + 1
+
+	enc := deltaEncode(hashes)
+	if want := 4 + 4*HashSize - 2 - 31; len(enc) != want {
+		t.Fatalf("expected encoding of %d bytes, got %d", want, len(enc))
+	}
+	dec, err := deltaDecode(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, hashes) {
+		t.Fatalf("expected decoded hashes %x, got %x", hashes, dec)
+	}
+
+	for _, enc := range [][]byte{
+		{1},       // first hash with a shared prefix
+		{0, 1, 2}, // truncated hash
+		append(enc[:len(enc):len(enc)], HashSize, 0), // shared prefix of a full hash
+		append(enc[:len(enc):len(enc)], HashSize-1),  // missing last byte
+	} {
+		if _, err := deltaDecode(enc); err != errInvalidDeltaEnc {
+			t.Fatalf("expected error %v, got %v", errInvalidDeltaEnc, err)
+		}
+	}
+}
+
+// TestBatchEncoding tests that the offers and wants of a batch are decoded as encoded
+func TestBatchEncoding(t *testing.T) {
+	offers := []OfferedHashes{
+		{Ruid: 1, LastIndex: 10, Hashes: testutil.RandomBytes(2, 3*HashSize)},
+		{Ruid: 2, LastIndex: 20, Hashes: []byte{}},
+	}
+	wants := []WantedHashes{
+		{Ruid: 3, BitVector: []byte{5}},
+		{Ruid: 4, BitVector: []byte{}},
+	}
+	b, err := encodeBatch(offers, wants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decOffers, decWants, err := b.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decOffers) != len(offers) || len(decWants) != len(wants) {
+		t.Fatalf("expected %d offers and %d wants, got %d and %d", len(offers), len(wants), len(decOffers), len(decWants))
+	}
+	for i, o := range offers {
+		d := decOffers[i]
+		if d.Ruid != o.Ruid || d.LastIndex != o.LastIndex || !bytes.Equal(d.Hashes, o.Hashes) {
+			t.Fatalf("expected offer %v, got %v", o, d)
+		}
+	}
+	for i, w := range wants {
+		d := decWants[i]
+		if d.Ruid != w.Ruid || !bytes.Equal(d.BitVector, w.BitVector) {
+			t.Fatalf("expected want %v, got %v", w, d)
+		}
+	}
+
+	if _, _, err := (&Batch{Frame: []byte{1, 2, 3}}).decode(); !errors.Is(err, errInvalidBatch) {
+		t.Fatalf("expected error %v, got %v", errInvalidBatch, err)
+	}
+}
+
+// TestBatcher tests that the messages added within the batch delay are sent in a single batch
+// and that a batch with enough hashes is sent without waiting
+func TestBatcher(t *testing.T) {
+	defer func(d time.Duration, n int) { BatchDelay, MaxBatchHashes = d, n }(BatchDelay, MaxBatchHashes)
+	BatchDelay = 50 * time.Millisecond
+	MaxBatchHashes = 4
+
+	var (
+		mtx     sync.Mutex
+		batches []*Batch
+	)
+	b := newBatcher(func(_ context.Context, msg interface{}) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		batches = append(batches, msg.(*Batch))
+		return nil
+	})
+	sent := func() []*Batch {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return batches
+	}
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 0 {
+				errc <- b.add(context.Background(), WantedHashes{Ruid: uint(i)})
+				return
+			}
+			errc <- b.add(context.Background(), OfferedHashes{Ruid: uint(i), Hashes: testutil.RandomBytes(i, HashSize)})
+		}(i)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(sent()); n != 1 {
+		t.Fatalf("expected 1 batch sent, got %d", n)
+	}
+	offers, wants, err := sent()[0].decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers) != 2 || len(wants) != 1 {
+		t.Fatalf("expected 2 offers and 1 want in the batch, got %d and %d", len(offers), len(wants))
+	}
+
+	start := time.Now()
+	if err := b.add(context.Background(), OfferedHashes{Ruid: 4, Hashes: testutil.RandomBytes(4, 4*HashSize)}); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) >= BatchDelay {
+		t.Fatal("expected a full batch to be sent without waiting")
+	}
+	if n := len(sent()); n != 2 {
+		t.Fatalf("expected 2 batches sent, got %d", n)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/network/stream/intervals"
+	"github.com/ethersphere/swarm/state"
+)
+
+// checkpointKeyPrefix prefixes the state store keys of the sync checkpoints
+const checkpointKeyPrefix = "sync-checkpoint|"
+
+var (
+	checkpointResumeCount = metrics.GetOrRegisterCounter("network/stream/checkpoint/resume", nil)
+	checkpointResetCount  = metrics.GetOrRegisterCounter("network/stream/checkpoint/reset", nil)
+)
+
+// syncCheckpoint is the cursor of a stream reported by the peer when it was last synced,
+// persisted with the checksum of the intervals synced so that syncing is resumed
+// from the saved position after a restart only if the intervals are still valid
+type syncCheckpoint struct {
+	Cursor   uint64
+	Checksum []byte
+}
+
+// checkpointChecksum is the checksum of the cursor and the intervals of the stream with the key
+func checkpointChecksum(key string, cursor uint64, i *intervals.Intervals) ([]byte, error) {
+	data, err := i.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	c := make([]byte, 8)
+	binary.BigEndian.PutUint64(c, cursor)
+	return crypto.Keccak256([]byte(key), c, data), nil
+}
+
+// checkpointKey is the state store key of the sync checkpoint of the stream of the peer
+func (p *Peer) checkpointKey(stream ID) string {
+	return checkpointKeyPrefix + p.peerStreamIntervalKey(stream)
+}
+
+// saveCheckpoint persists the cursor of the stream with the checksum of its intervals
+// caller must hold the lock
+func (p *Peer) saveCheckpoint(stream ID, cursor uint64, i *intervals.Intervals) error {
+	sum, err := checkpointChecksum(p.peerStreamIntervalKey(stream), cursor, i)
+	if err != nil {
+		return err
+	}
+	return p.intervalsStore.Put(p.checkpointKey(stream), &syncCheckpoint{Cursor: cursor, Checksum: sum})
+}
+
+// checkpointCursor returns the cursor saved in the checkpoint of the stream, 0 if none
+// caller must hold the lock
+func (p *Peer) checkpointCursor(stream ID) (uint64, error) {
+	var c syncCheckpoint
+	err := p.intervalsStore.Get(p.checkpointKey(stream), &c)
+	if err == state.ErrNotFound {
+		return 0, nil
+	}
+	return c.Cursor, err
+}
+
+// resumeCheckpoint validates the intervals synced from the stream against the saved checkpoint
+// and the cursor the peer reports on reconnect. The intervals are resumed from if the checksum
+// matches and the cursor did not go back, otherwise the peer reindexed its chunks, e.g. after
+// a database migration, or the intervals are corrupt, and they are reset to sync the stream anew.
+// It returns whether the intervals were reset.
+func (p *Peer) resumeCheckpoint(stream ID, cursor uint64) (reset bool, err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	key := p.peerStreamIntervalKey(stream)
+	i := &intervals.Intervals{}
+	switch err := p.intervalsStore.Get(key, i); err {
+	case nil:
+	case state.ErrNotFound:
+		i = intervals.NewIntervals(1)
+		if err := p.intervalsStore.Put(key, i); err != nil {
+			return false, err
+		}
+	default:
+		return false, err
+	}
+
+	var c syncCheckpoint
+	switch err := p.intervalsStore.Get(p.checkpointKey(stream), &c); err {
+	case nil:
+		sum, err := checkpointChecksum(key, c.Cursor, i)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case !bytes.Equal(sum, c.Checksum):
+			p.logger.Warn("sync checkpoint checksum mismatch, syncing stream anew", "stream", stream)
+			reset = true
+		case cursor < c.Cursor:
+			p.logger.Warn("peer cursor went back, syncing stream anew", "stream", stream, "cursor", cursor, "checkpoint", c.Cursor)
+			reset = true
+		}
+	case state.ErrNotFound:
+		// intervals synced before checkpoints were saved are resumed from
+	default:
+		return false, err
+	}
+
+	if reset {
+		checkpointResetCount.Inc(1)
+		i = intervals.NewIntervals(1)
+		if err := p.intervalsStore.Put(key, i); err != nil {
+			return false, err
+		}
+	} else {
+		checkpointResumeCount.Inc(1)
+	}
+	return reset, p.saveCheckpoint(stream, cursor, i)
+}
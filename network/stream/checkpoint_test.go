@@ -0,0 +1,91 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/stream/intervals"
+	"github.com/ethersphere/swarm/state"
+)
+
+// TestSyncCheckpoint tests that the intervals synced from a stream are resumed from
+// on reconnect unless the cursor of the peer went back or the checkpoint does not match them
+func TestSyncCheckpoint(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	p := newPeer(&network.BzzPeer{BzzAddr: network.RandomBzzAddr()}, network.RandomBzzAddr(), store, nil)
+	stream := NewID(syncStreamName, encodeSyncKey(1))
+
+	checkNext := func(t *testing.T, want uint64) {
+		t.Helper()
+		from, _, _, err := p.nextInterval(stream, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from != want {
+			t.Fatalf("expected next interval from %d, got %d", want, from)
+		}
+	}
+	resume := func(t *testing.T, cursor uint64, wantReset bool) {
+		t.Helper()
+		reset, err := p.resumeCheckpoint(stream, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reset != wantReset {
+			t.Fatalf("expected reset %t, got %t", wantReset, reset)
+		}
+	}
+
+	resume(t, 10, false)
+	checkNext(t, 1)
+	if err := p.addInterval(stream, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// the peer synced more chunks while disconnected
+	resume(t, 20, false)
+	checkNext(t, 11)
+
+	// the peer reindexed its chunks
+	resume(t, 5, true)
+	checkNext(t, 1)
+
+	// intervals not matching the checkpoint
+	if err := p.addInterval(stream, 1, 5); err != nil {
+		t.Fatal(err)
+	}
+	i := intervals.NewIntervals(1)
+	i.Add(1, 100)
+	if err := store.Put(p.peerStreamIntervalKey(stream), i); err != nil {
+		t.Fatal(err)
+	}
+	resume(t, 5, true)
+	checkNext(t, 1)
+
+	// intervals synced before checkpoints were saved
+	if err := store.Delete(p.checkpointKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(p.peerStreamIntervalKey(stream), i); err != nil {
+		t.Fatal(err)
+	}
+	resume(t, 5, false)
+	checkNext(t, 101)
+}
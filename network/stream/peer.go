@@ -44,6 +44,7 @@ type Peer struct {
 	openOffers         map[uint]offer    // maintain open offers on the server side
 	clientOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the client side
 	serverOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the server side
+	batcher            *batcher          // sends the offered and wanted hashes of the ranges in batches
 
 	quit chan struct{} // closed when peer is going offline
 }
@@ -62,6 +63,7 @@ func newPeer(peer *network.BzzPeer, baseAddress *network.BzzAddr, i state.Store,
 		quit:               make(chan struct{}),
 		logger:             log.NewBaseAddressLogger(baseAddress.ShortString(), "peer", peer.BzzAddr.ShortString()),
 	}
+	p.batcher = newBatcher(peer.Send)
 	return p
 }
 
@@ -172,7 +174,15 @@ func (p *Peer) addInterval(stream ID, start, end uint64) (err error) {
 		return err
 	}
 	i.Add(start, end)
-	return p.intervalsStore.Put(peerStreamKey, i)
+	if err = p.intervalsStore.Put(peerStreamKey, i); err != nil {
+		return err
+	}
+	// keep the checksum of the checkpoint in line with the intervals
+	cursor, err := p.checkpointCursor(stream)
+	if err != nil {
+		return err
+	}
+	return p.saveCheckpoint(stream, cursor, i)
 }
 
 func (p *Peer) nextInterval(stream ID, ceil uint64) (start, end uint64, empty bool, err error) {
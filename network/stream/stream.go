@@ -36,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/events"
 	"github.com/ethersphere/swarm/network"
 	bv "github.com/ethersphere/swarm/network/bitvector"
 	"github.com/ethersphere/swarm/network/stream/intervals"
@@ -81,7 +82,7 @@ var (
 	// Protocol spec
 	Spec = &protocols.Spec{
 		Name:       "bzz-stream",
-		Version:    8,
+		Version:    10,
 		MaxMsgSize: 10 * 1024 * 1024,
 		Messages: []interface{}{
 			StreamInfoReq{},
@@ -90,6 +91,7 @@ var (
 			OfferedHashes{},
 			ChunkDelivery{},
 			WantedHashes{},
+			Batch{},
 		},
 	}
 
@@ -111,6 +113,8 @@ type Registry struct {
 	lastReceivedChunkTimeMu sync.RWMutex              // synchronize access to lastReceivedChunkTime
 	lastReceivedChunkTime   time.Time                 // last received chunk time
 	logger                  log.Logger                // the logger for the registry. appends base address to all logs
+	scores                  *network.PeerScores       // records the sync reliability of peers, nil if not set
+	events                  *events.Bus               // bus stalled syncs are published on, nil if not set
 }
 
 // New creates a new stream protocol handler
@@ -131,6 +135,24 @@ func New(intervalsStore state.Store, address *network.BzzAddr, providers ...Stre
 	return r
 }
 
+// SetPeerScores sets the scores the completed and failed batches of peers are recorded in,
+// it must be called before the registry is started
+func (r *Registry) SetPeerScores(s *network.PeerScores) {
+	r.scores = s
+}
+
+// SetEvents sets the bus stalled syncs are published on,
+// it must be called before the registry is started
+func (r *Registry) SetEvents(b *events.Bus) {
+	r.events = b
+}
+
+// SetBandwidth sets the bandwidth manager limiting the traffic of the protocol,
+// it must be called before the registry is started
+func (r *Registry) SetBandwidth(b *protocols.Bandwidth) {
+	r.spec.Bandwidth = b
+}
+
 // Run is being dispatched when 2 nodes connect
 func (r *Registry) Run(bp *network.BzzPeer) error {
 	sp := newPeer(bp, r.address, r.intervalsStore, r.providers)
@@ -159,6 +181,8 @@ func (r *Registry) HandleMsg(p *Peer) func(context.Context, interface{}) error {
 			return r.serverHandleWantedHashes(ctx, p, msg)
 		case *ChunkDelivery:
 			return r.clientHandleChunkDelivery(ctx, p, msg)
+		case *Batch:
+			return r.handleBatch(ctx, p, msg)
 
 		default:
 			// todo: maybe a special error for unknown message, or at least just log it
@@ -244,6 +268,11 @@ func (r *Registry) clientHandleStreamInfoRes(ctx context.Context, p *Peer, msg *
 			continue
 		}
 
+		// resume from the intervals synced before a reconnect or restart if still valid
+		if _, err := p.resumeCheckpoint(s.Stream, s.Cursor); err != nil {
+			return protocols.Break(fmt.Errorf("resuming sync checkpoint of stream %s: %w", s.Stream, err))
+		}
+
 		p.logger.Debug("setting stream cursor", "stream", s.Stream, "cursor", s.Cursor)
 		p.setCursor(s.Stream, s.Cursor)
 
@@ -410,7 +439,7 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 				Hashes:    []byte{},
 			}
 
-			if err := p.Send(ctx, offered); err != nil {
+			if err := p.batcher.add(ctx, offered); err != nil {
 				return protocols.Break(fmt.Errorf("sending empty live offered hashes, ruid %d: %w", msg.Ruid, err))
 			}
 			return nil
@@ -438,7 +467,7 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 	} else {
 		batchSizeGauge.Update(int64(l))
 	}
-	if err := p.Send(ctx, offered); err != nil {
+	if err := p.batcher.add(ctx, offered); err != nil {
 		p.mtx.Lock()
 		delete(p.openOffers, msg.Ruid)
 		p.mtx.Unlock()
@@ -502,7 +531,7 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 	// the upstream peer in order to mitigate a leak on `offer`s
 	if !provider.WantStream(p, w.stream) {
 		wantedHashesMsg.BitVector = []byte{}
-		if err := p.Send(ctx, wantedHashesMsg); err != nil {
+		if err := p.batcher.add(ctx, wantedHashesMsg); err != nil {
 			return protocols.Break(fmt.Errorf("sending empty wanted hashes:  %w", err))
 		}
 		return nil
@@ -548,7 +577,7 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 		if err := p.sealWant(w); err != nil {
 			return protocols.Break(fmt.Errorf("persisting interval from %d, to %d: %w", w.from, w.to, err))
 		}
-		if err := p.Send(ctx, wantedHashesMsg); err != nil {
+		if err := p.batcher.add(ctx, wantedHashesMsg); err != nil {
 			return protocols.Break(fmt.Errorf("sending wanted hashes: %w", err))
 		}
 
@@ -562,7 +591,7 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 		errc = r.clientSealBatch(ctx, p, provider, w) // poll for the completion of the batch in a separate goroutine
 	}
 
-	if err := p.Send(ctx, wantedHashesMsg); err != nil {
+	if err := p.batcher.add(ctx, wantedHashesMsg); err != nil {
 		return protocols.Break(fmt.Errorf("sending wanted hashes: %w", err))
 	}
 
@@ -570,8 +599,10 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 	case err := <-errc:
 		if err != nil {
 			streamBatchFail.Inc(1)
+			r.scores.RecordSync(p.Over(), false)
 			return protocols.Break(fmt.Errorf("sealing batch from %d, to %d: %w", w.from, w.to, err))
 		}
+		r.scores.RecordSync(p.Over(), true)
 
 		// seal the interval
 		if err := p.sealWant(w); err != nil {
@@ -579,6 +610,11 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 		}
 	case <-time.After(timeouts.SyncBatchTimeout):
 		p.logger.Error("batch has timed out", "ruid", w.ruid)
+		r.scores.RecordSync(p.Over(), false)
+		r.events.Publish(events.SyncStalled, &events.SyncData{
+			Peer:   p.ID().String(),
+			Stream: w.stream.String(),
+		})
 		close(w.closeC) // signal the polling goroutine to terminate
 		p.mtx.Lock()
 		delete(p.openWants, msg.Ruid)
@@ -678,8 +714,9 @@ func (r *Registry) serverHandleWantedHashes(ctx context.Context, p *Peer, msg *W
 	// append the chunks to the chunk delivery message. when reaching maxFrameSize send the current batch
 	for _, v := range chunks {
 		chunkD := DeliveredChunk{
-			Addr: v.Address(),
-			Data: v.Data(),
+			Addr:  v.Address(),
+			Data:  v.Data(),
+			Stamp: v.Stamp(),
 		}
 		cd.Chunks = append(cd.Chunks, chunkD)
 
@@ -754,6 +791,9 @@ func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *
 	chunks := make([]chunk.Chunk, len(msg.Chunks))
 	for i, dc := range msg.Chunks {
 		chunks[i] = chunk.NewChunk(dc.Addr, dc.Data)
+		if len(dc.Stamp) > 0 {
+			chunks[i] = chunks[i].WithStamp(dc.Stamp)
+		}
 	}
 
 	startPut := time.Now()
@@ -1023,6 +1063,9 @@ func (r *Registry) PeerInfo() (*PeerInfo, error) {
 	}
 	info.Intervals = make(map[string]string)
 	if err := r.intervalsStore.Iterate("", func(key, value []byte) (stop bool, err error) {
+		if strings.HasPrefix(string(key), checkpointKeyPrefix) {
+			return false, nil
+		}
 		i := new(intervals.Intervals)
 		if err := i.UnmarshalBinary(value); err != nil {
 			return true, err
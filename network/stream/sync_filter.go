@@ -0,0 +1,134 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"math"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+var (
+	responsibilityGauge = metrics.GetOrRegisterGaugeFloat64("network/stream/sync_provider/responsibility", nil)
+	filteredBinsCount   = metrics.GetOrRegisterCounter("network/stream/sync_provider/filter/bins", nil)
+	filteredChunksCount = metrics.GetOrRegisterCounter("network/stream/sync_provider/filter/chunks", nil)
+)
+
+// SyncFilter limits the pull syncing subscriptions of a node.
+// Nodes with limited storage can sync only the proximity order bins close
+// to their address, the chunks outside of the range are not requested from peers.
+// If Tags are set, only the chunks uploaded locally with one of the tags
+// are offered to peers.
+type SyncFilter struct {
+	MinPO int      // lowest proximity order bin to sync
+	MaxPO int      // highest proximity order bin to sync, 0 for no limit
+	Tags  []uint32 // uids of the upload tags which chunks are offered
+}
+
+// binAllowed returns true if the proximity order bin is in the range of the filter
+func (f *SyncFilter) binAllowed(bin int) bool {
+	if f == nil {
+		return true
+	}
+	if bin < f.MinPO {
+		return false
+	}
+	return f.MaxPO <= 0 || bin <= f.MaxPO
+}
+
+// filterBins returns the bins that are in the range of the filter
+func (f *SyncFilter) filterBins(bins []int) (r []int) {
+	for _, bin := range bins {
+		if !f.binAllowed(bin) {
+			filteredBinsCount.Inc(1)
+			continue
+		}
+		r = append(r, bin)
+	}
+	return r
+}
+
+// tagAllowed returns true if the chunk uploaded with the tag can be offered to peers
+func (f *SyncFilter) tagAllowed(tag uint32) bool {
+	if f == nil || len(f.Tags) == 0 {
+		return true
+	}
+	for _, t := range f.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// responsibility returns the fraction of the nearest neighbourhood address space
+// that is synced with the filter, given the neighbourhood depth and the highest
+// proximity order bin, which holds all the chunks that are closer.
+// Proximity order bin po covers 2^-(po+1) of the address space, while the
+// neighbourhood of depth covers 2^-depth.
+func (f *SyncFilter) responsibility(depth, max int) float64 {
+	if f == nil {
+		return 1
+	}
+	start := depth
+	if f.MinPO > start {
+		start = f.MinPO
+	}
+	if start > max {
+		return 0
+	}
+	r := math.Pow(2, float64(depth-start))
+	if f.MaxPO > 0 && f.MaxPO < max {
+		if f.MaxPO < start {
+			return 0
+		}
+		r -= math.Pow(2, float64(depth-f.MaxPO-1))
+	}
+	return r
+}
+
+// filterDescriptors forwards the descriptors of chunks with tags allowed by the filter.
+// The returned stop function must be called instead of the one of the subscription.
+func (f *SyncFilter) filterDescriptors(descriptors <-chan chunk.Descriptor, stop func()) (<-chan chunk.Descriptor, func()) {
+	if f == nil || len(f.Tags) == 0 {
+		return descriptors, stop
+	}
+	filtered := make(chan chunk.Descriptor)
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	go func() {
+		defer close(filtered)
+		for d := range descriptors {
+			if !f.tagAllowed(d.Tag) {
+				filteredChunksCount.Inc(1)
+				continue
+			}
+			select {
+			case filtered <- d:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return filtered, func() {
+		quitOnce.Do(func() { close(quit) })
+		stop()
+	}
+}
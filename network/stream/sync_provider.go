@@ -47,17 +47,19 @@ var (
 )
 
 type syncProvider struct {
-	netStore                *storage.NetStore // netstore
-	kad                     *network.Kademlia // kademlia
-	name                    string            // name of the stream we are responsible for
-	syncBinsOnlyWithinDepth bool              // true means streams are established only within depth, false means outside of depth too
-	autostart               bool              // start fetching streams automatically when cursors arrive from peer
-	quit                    chan struct{}     // shutdown
-	cacheMtx                sync.RWMutex      // synchronization primitive to protect cache
-	cache                   *lru.Cache        // cache to minimize load on netstore
-	setCacheMtx             sync.RWMutex      // set cache mutex
-	setCache                *lru.Cache        // cache to reduce load on localstore to not set the same chunk as synced
-	logger                  log.Logger        // logger that appends the base address to loglines
+	netStore                *storage.NetStore    // netstore
+	kad                     *network.Kademlia    // kademlia
+	name                    string               // name of the stream we are responsible for
+	syncBinsOnlyWithinDepth bool                 // true means streams are established only within depth, false means outside of depth too
+	filter                  *SyncFilter          // limits the synced bins and offered chunks, nil for no limits
+	stamps                  chunk.StampValidator // validates the postage stamps of delivered chunks, nil for no validation
+	autostart               bool                 // start fetching streams automatically when cursors arrive from peer
+	quit                    chan struct{}        // shutdown
+	cacheMtx                sync.RWMutex         // synchronization primitive to protect cache
+	cache                   *lru.Cache           // cache to minimize load on netstore
+	setCacheMtx             sync.RWMutex         // set cache mutex
+	setCache                *lru.Cache           // cache to reduce load on localstore to not set the same chunk as synced
+	logger                  log.Logger           // logger that appends the base address to loglines
 }
 
 // NewSyncProvider creates a new sync provider that is used by the stream protocol to sink data and control its behaviour
@@ -65,6 +67,13 @@ type syncProvider struct {
 // established only within depth ( >=depth ). This is needed for Push Sync. When set to false, the streams are
 // established on all bins as they did traditionally with Pull Sync.
 func NewSyncProvider(ns *storage.NetStore, kad *network.Kademlia, baseAddr *network.BzzAddr, autostart bool, syncOnlyWithinDepth bool) StreamProvider {
+	return NewSyncProviderWithFilter(ns, kad, baseAddr, autostart, syncOnlyWithinDepth, nil, nil)
+}
+
+// NewSyncProviderWithFilter creates a new sync provider which subscriptions are limited by the filter
+// and which only stores delivered chunks with postage stamps accepted by the stamp validator.
+// A nil filter does not limit syncing, a nil stamp validator accepts all chunks.
+func NewSyncProviderWithFilter(ns *storage.NetStore, kad *network.Kademlia, baseAddr *network.BzzAddr, autostart bool, syncOnlyWithinDepth bool, filter *SyncFilter, stamps chunk.StampValidator) StreamProvider {
 	c, err := lru.New(cacheCapacity)
 	if err != nil {
 		panic(err)
@@ -74,10 +83,12 @@ func NewSyncProvider(ns *storage.NetStore, kad *network.Kademlia, baseAddr *netw
 		panic(err)
 	}
 
-	return &syncProvider{
+	s := &syncProvider{
 		netStore:                ns,
 		kad:                     kad,
 		syncBinsOnlyWithinDepth: syncOnlyWithinDepth,
+		filter:                  filter,
+		stamps:                  stamps,
 		autostart:               autostart,
 		name:                    syncStreamName,
 		quit:                    make(chan struct{}),
@@ -85,6 +96,31 @@ func NewSyncProvider(ns *storage.NetStore, kad *network.Kademlia, baseAddr *netw
 		setCache:                sc,
 		logger:                  log.NewBaseAddressLogger(baseAddr.ShortString()),
 	}
+	go s.measureResponsibility()
+	return s
+}
+
+// measureResponsibility updates the metric of the fraction of the
+// neighbourhood responsibility that is synced whenever the depth changes
+func (s *syncProvider) measureResponsibility() {
+	depthChangeSignal, unsubscribeDepthChangeSignal := s.kad.SubscribeToNeighbourhoodDepthChange()
+	defer unsubscribeDepthChangeSignal()
+
+	for {
+		r := s.filter.responsibility(s.kad.NeighbourhoodDepth(), s.kad.MaxProxDisplay)
+		responsibilityGauge.Update(r)
+		if r < 1 {
+			s.logger.Debug("syncing only a part of the neighbourhood", "responsibility", r)
+		}
+		select {
+		case _, ok := <-depthChangeSignal:
+			if !ok {
+				return
+			}
+		case <-s.quit:
+			return
+		}
+	}
 }
 
 // NeedData checks if we need to retrieve the supplied addrs from the upstream peer
@@ -171,7 +207,7 @@ func (s *syncProvider) Get(ctx context.Context, addr ...chunk.Address) ([]chunk.
 	// if not - save in a slice and fallback later to localstore in one go
 	for i, a := range addr {
 		if v, ok := s.cache.Get(a.Hex()); ok {
-			retChunks[i] = chunk.NewChunk(a, v.([]byte))
+			retChunks[i] = v.(chunk.Chunk)
 			metrics.GetOrRegisterCounter("network/stream/sync_provider/get/cachehit", nil).Inc(1)
 		} else {
 			lsChunks = append(lsChunks, a)
@@ -192,7 +228,7 @@ func (s *syncProvider) Get(ctx context.Context, addr ...chunk.Address) ([]chunk.
 	// merge the results together
 	for i, ch := range chunks {
 		ch := ch
-		s.cache.Add(ch.Address().Hex(), ch.Data())
+		s.cache.Add(ch.Address().Hex(), ch)
 		retChunks[indices[i]] = ch
 	}
 	return retChunks, nil
@@ -229,13 +265,15 @@ func (s *syncProvider) Set(ctx context.Context, addrs ...chunk.Address) error {
 }
 
 // Put the given chunks to the local storage
+// Chunks with invalid postage stamps are not stored and reported as not seen.
 func (s *syncProvider) Put(ctx context.Context, ch ...chunk.Chunk) (exists []bool, err error) {
-	seen, err := s.netStore.Put(ctx, chunk.ModePutSync, ch...)
+	valid, indices := s.validateStamps(ch)
+	seen, err := s.netStore.PutBatch(ctx, chunk.ModePutSync, valid)
 	for i, v := range seen {
 		if v {
 			if putSeenTestHook != nil {
 				// call the test function if it is set
-				putSeenTestHook(ch[i].Address(), s.netStore.LocalID)
+				putSeenTestHook(valid[i].Address(), s.netStore.LocalID)
 			}
 		}
 	}
@@ -243,10 +281,34 @@ func (s *syncProvider) Put(ctx context.Context, ch ...chunk.Chunk) (exists []boo
 		s.cacheMtx.Lock()
 		defer s.cacheMtx.Unlock()
 		for _, c := range chunks {
-			s.cache.Add(c.Address().Hex(), c.Data())
+			s.cache.Add(c.Address().Hex(), c)
+		}
+	}(valid...)
+	if len(valid) == len(ch) || err != nil {
+		return seen, err
+	}
+	exists = make([]bool, len(ch))
+	for i, v := range seen {
+		exists[indices[i]] = v
+	}
+	return exists, nil
+}
+
+// validateStamps returns the chunks with valid postage stamps and their indexes
+func (s *syncProvider) validateStamps(chs []chunk.Chunk) (valid []chunk.Chunk, indices []int) {
+	if s.stamps == nil {
+		return chs, nil
+	}
+	for i, ch := range chs {
+		if err := s.stamps.ValidateStamp(ch); err != nil {
+			metrics.GetOrRegisterCounter("network/stream/sync_provider/put/invalid-stamp", nil).Inc(1)
+			s.logger.Debug("dropping chunk with invalid postage stamp", "chunk", ch.Address(), "err", err)
+			continue
 		}
-	}(ch...)
-	return seen, err
+		valid = append(valid, ch)
+		indices = append(indices, i)
+	}
+	return valid, indices
 }
 
 // Function used only in tests to detect chunks that are synced
@@ -260,7 +322,7 @@ func (s *syncProvider) Subscribe(ctx context.Context, key interface{}, from, to
 	bin := key.(uint8)
 	log.Debug("syncProvider.Subscribe", "bin", bin, "from", from, "to", to)
 
-	return s.netStore.SubscribePull(ctx, bin, from, to)
+	return s.filter.filterDescriptors(s.netStore.SubscribePull(ctx, bin, from, to))
 }
 
 // Cursor gets the cursor from the localstore for a given stream key
@@ -282,11 +344,15 @@ func (s *syncProvider) Cursor(k string) (cursor uint64, err error) {
 // WantStream checks if we are interested in a given stream for a peer
 func (s *syncProvider) WantStream(p *Peer, streamID ID) bool {
 	p.logger.Debug("syncProvider.WantStream", "stream", streamID)
+	// only sync with peers that store chunks, and only if we store them too
+	if !network.IsStorer(p.BzzAddr) || !s.kad.IsStorer() {
+		return false
+	}
 	po := chunk.Proximity(p.BzzAddr.Over(), s.kad.BaseAddr())
 	depth := s.kad.NeighbourhoodDepth()
 
 	// check all subscriptions that should exist for this peer
-	subBins, _ := syncSubscriptionsDiff(po, -1, depth, s.kad.MaxProxDisplay, s.syncBinsOnlyWithinDepth)
+	subBins, _ := s.subscriptionsDiff(po, -1, depth)
 	v, err := parseSyncKey(streamID.Key)
 	if err != nil {
 		return false
@@ -301,9 +367,12 @@ var (
 // InitPeer creates and maintains the streams per peer.
 // Runs per peer, in a separate goroutine
 // when the depth changes on our node
-//  - peer moves from out-of-depth to depth
-//  - peer moves from depth to out-of-depth
-//  - depth changes, and peer stays in depth, but we need more or less
+//   - peer moves from out-of-depth to depth
+//   - peer moves from depth to out-of-depth
+//   - depth changes, and peer stays in depth, but we need more or less
+//   - peer announces that it starts or stops storing chunks
+//   - our node switches between light and full mode
+//
 // peer connects and disconnects quickly
 func (s *syncProvider) InitPeer(p *Peer) {
 	p.logger.Debug("syncProvider.InitPeer")
@@ -319,10 +388,37 @@ func (s *syncProvider) InitPeer(p *Peer) {
 	po := chunk.Proximity(p.BzzAddr.Over(), s.kad.BaseAddr())
 	depth := s.kad.NeighbourhoodDepth()
 
-	p.logger.Debug("update syncing subscriptions: initial", "po", po, "depth", depth)
+	// subscribe before checking the capabilities, not to miss a change
+	capsChanges := s.kad.SubscribeToCapabilityChanges()
+	defer capsChanges.Unsubscribe()
+	localChanges, unsubscribeLocalChanges := s.kad.Capabilities.Subscribe()
+	defer unsubscribeLocalChanges()
+
+	// streams are only maintained while both nodes store chunks
+	storer, local := network.IsStorer(p.BzzAddr), s.kad.IsStorer()
+	p.logger.Debug("update syncing subscriptions: initial", "po", po, "depth", depth, "storer", storer, "local", local)
 
-	subBins, quitBins := syncSubscriptionsDiff(po, -1, depth, s.kad.MaxProxDisplay, s.syncBinsOnlyWithinDepth)
-	s.updateSyncSubscriptions(p, subBins, quitBins)
+	if storer && local {
+		subBins, quitBins := s.subscriptionsDiff(po, -1, depth)
+		s.updateSyncSubscriptions(p, subBins, quitBins)
+	}
+
+	// renegotiate the streams: subscribe to all bins if syncing became possible,
+	// quit all of them if it stopped
+	renegotiate := func(nstorer, nlocal bool) {
+		was := storer && local
+		storer, local = nstorer, nlocal
+		if was == (storer && local) {
+			return
+		}
+		bins, _ := s.subscriptionsDiff(po, -1, depth)
+		p.logger.Debug("update syncing subscriptions: capabilities changed", "po", po, "depth", depth, "storer", storer, "local", local, "bins", bins)
+		if storer && local {
+			s.updateSyncSubscriptions(p, bins, nil)
+		} else {
+			s.updateSyncSubscriptions(p, nil, bins)
+		}
+	}
 
 	depthChangeSignal, unsubscribeDepthChangeSignal := s.kad.SubscribeToNeighbourhoodDepthChange()
 	defer unsubscribeDepthChangeSignal()
@@ -336,10 +432,26 @@ func (s *syncProvider) InitPeer(p *Peer) {
 
 			// update subscriptions for this peer when depth changes
 			ndepth := s.kad.NeighbourhoodDepth()
-			subs, quits := syncSubscriptionsDiff(po, depth, ndepth, s.kad.MaxProxDisplay, s.syncBinsOnlyWithinDepth)
-			p.logger.Debug("update syncing subscriptions", "po", po, "depth", depth, "sub", subs, "quit", quits)
-			s.updateSyncSubscriptions(p, subs, quits)
+			if storer && local {
+				subs, quits := s.subscriptionsDiff(po, depth, ndepth)
+				p.logger.Debug("update syncing subscriptions", "po", po, "depth", depth, "sub", subs, "quit", quits)
+				s.updateSyncSubscriptions(p, subs, quits)
+			}
 			depth = ndepth
+		case msg, ok := <-capsChanges.ReceiveChannel():
+			if !ok {
+				return
+			}
+			change := msg.(network.CapabilityChange)
+			if change.Peer.ID() != p.ID() {
+				continue
+			}
+			renegotiate(network.IsStorer(p.BzzAddr), local)
+		case _, ok := <-localChanges:
+			if !ok {
+				return
+			}
+			renegotiate(storer, s.kad.IsStorer())
 		case <-s.quit:
 			return
 		case <-p.quit:
@@ -381,6 +493,13 @@ func (s *syncProvider) updateSyncSubscriptions(p *Peer, subBins, quitBins []int)
 	}
 }
 
+// subscriptionsDiff calculates the syncing subscriptions diff for a peer
+// with the bins that are not in the range of the sync filter left out
+func (s *syncProvider) subscriptionsDiff(peerPO, prevDepth, newDepth int) (subBins, quitBins []int) {
+	subBins, quitBins = syncSubscriptionsDiff(peerPO, prevDepth, newDepth, s.kad.MaxProxDisplay, s.syncBinsOnlyWithinDepth)
+	return s.filter.filterBins(subBins), s.filter.filterBins(quitBins)
+}
+
 // syncSubscriptionsDiff calculates to which proximity order bins a peer
 // (with po peerPO) needs to be subscribed after kademlia neighbourhood depth
 // change from prevDepth to newDepth. Max argument limits the number of
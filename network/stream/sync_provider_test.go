@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/network"
 )
 
@@ -188,3 +189,93 @@ func TestSyncSubscriptionsDiff(t *testing.T) {
 		}
 	}
 }
+
+// TestSyncFilterBins validates that only the bins in the range
+// of the sync filter are subscribed to and quit.
+func TestSyncFilterBins(t *testing.T) {
+	bins := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for _, tc := range []struct {
+		filter *SyncFilter
+		want   []int
+	}{
+		{
+			filter: nil,
+			want:   bins,
+		},
+		{
+			filter: &SyncFilter{MinPO: 8},
+			want:   []int{8, 9, 10, 11, 12, 13, 14, 15, 16},
+		},
+		{
+			filter: &SyncFilter{MinPO: 2, MaxPO: 4},
+			want:   []int{2, 3, 4},
+		},
+		{
+			filter: &SyncFilter{MaxPO: 1},
+			want:   []int{0, 1},
+		},
+	} {
+		got := tc.filter.filterBins(bins)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("filter %+v: got bins %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+// TestSyncFilterResponsibility validates the fraction of the neighbourhood
+// that is synced with different sync filters.
+func TestSyncFilterResponsibility(t *testing.T) {
+	max := network.NewKadParams().MaxProxDisplay
+	for _, tc := range []struct {
+		filter *SyncFilter
+		depth  int
+		want   float64
+	}{
+		{filter: nil, depth: 4, want: 1},
+		{filter: &SyncFilter{}, depth: 4, want: 1},
+		{filter: &SyncFilter{MinPO: 2}, depth: 4, want: 1},
+		{filter: &SyncFilter{MinPO: 5}, depth: 4, want: 0.5},
+		{filter: &SyncFilter{MinPO: 6}, depth: 4, want: 0.25},
+		{filter: &SyncFilter{MaxPO: 4}, depth: 4, want: 0.5},
+		{filter: &SyncFilter{MinPO: 5, MaxPO: 5}, depth: 4, want: 0.25},
+		{filter: &SyncFilter{MaxPO: 3}, depth: 4, want: 0},
+		{filter: &SyncFilter{MinPO: max + 1}, depth: 4, want: 0},
+	} {
+		got := tc.filter.responsibility(tc.depth, max)
+		if got != tc.want {
+			t.Errorf("filter %+v, depth %v: got responsibility %v, want %v", tc.filter, tc.depth, got, tc.want)
+		}
+	}
+}
+
+// TestSyncFilterDescriptors validates that only the chunks uploaded
+// with the tags of the sync filter are offered.
+func TestSyncFilterDescriptors(t *testing.T) {
+	filter := &SyncFilter{Tags: []uint32{1, 3}}
+
+	descriptors := make(chan chunk.Descriptor)
+	stopped := make(chan struct{})
+	filtered, stop := filter.filterDescriptors(descriptors, func() { close(stopped) })
+
+	go func() {
+		defer close(descriptors)
+		for i := uint64(0); i < 6; i++ {
+			descriptors <- chunk.Descriptor{BinID: i, Tag: uint32(i % 4)}
+		}
+	}()
+
+	var got []uint64
+	for d := range filtered {
+		got = append(got, d.BinID)
+	}
+	if want := []uint64{1, 3, 5}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got bin ids %v, want %v", got, want)
+	}
+
+	stop()
+	select {
+	case <-stopped:
+	default:
+		t.Error("subscription not stopped")
+	}
+}
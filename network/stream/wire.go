@@ -129,8 +129,9 @@ type ChunkDelivery struct {
 
 // DeliveredChunk encapsulates a particular chunk's underlying data within a ChunkDelivery message
 type DeliveredChunk struct {
-	Addr storage.Address //chunk address
-	Data []byte          //chunk data
+	Addr  storage.Address //chunk address
+	Data  []byte          //chunk data
+	Stamp []byte          //chunk postage stamp, empty if the chunk is not stamped
 }
 
 // StreamState is a message exchanged between two nodes to notify of changes or errors in a stream's state
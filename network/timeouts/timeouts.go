@@ -25,3 +25,14 @@ var SyncBatchTimeout = 10 * time.Second
 // Within serverCollectBatch - If at least one chunk is added to the batch and no new chunks
 // are added in BatchTimeout period, the batch will be returned.
 var BatchTimeout = 2 * time.Second
+
+// HedgeMinDelay is the minimum time the NetStore waits for a delivery before issuing a parallel
+// retrieve request for the same chunk to another peer
+var HedgeMinDelay = 50 * time.Millisecond
+
+// RecoveryTimeout is the additional time a node waits for missing content to be re-uploaded
+// after it has published a recovery request for a chunk
+var RecoveryTimeout = 30 * time.Second
+
+// RecoveryRetryInterval is the time between retrieve attempts of a chunk after a recovery request
+var RecoveryRetryInterval = 2 * time.Second
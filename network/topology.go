@@ -0,0 +1,174 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/pot"
+)
+
+// Topology is a graph description of the view of the overlay network of the local node,
+// in a node-link form that visualization tools accept as JSON, or in the DOT language
+type Topology struct {
+	Self  string         `json:"self"`  // overlay address of the local node
+	Depth int            `json:"depth"` // neighbourhood depth
+	Nodes []TopologyNode `json:"nodes"` // the local node and the known peers
+	Links []TopologyLink `json:"links"` // connections of the local node
+}
+
+// TopologyNode is a node of the topology graph
+type TopologyNode struct {
+	ID        string `json:"id"`              // overlay address
+	Bin       int    `json:"bin"`             // proximity order to the local node, -1 for the local node
+	Connected bool   `json:"connected"`       // true if the peer is connected
+	Self      bool   `json:"self"`            // true for the local node
+	Label     string `json:"label,omitempty"` // label assigned to the peer
+}
+
+// TopologyLink is a connection between the local node and a peer
+type TopologyLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Bin    int    `json:"bin"`
+}
+
+// Topology returns the graph description of the kademlia table
+func (k *Kademlia) Topology() *Topology {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	self := hex.EncodeToString(k.base)
+	t := &Topology{
+		Self:  self,
+		Depth: depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base),
+		Nodes: []TopologyNode{{ID: self, Bin: -1, Connected: true, Self: true, Label: k.labels.Get(k.base)}},
+		Links: []TopologyLink{},
+	}
+	connected := make(map[string]bool)
+	k.defaultIndex.conns.EachNeighbour(k.base, Pof, func(val pot.Val, po int) bool {
+		id := hex.EncodeToString(val.(*entry).Address())
+		connected[id] = true
+		t.Links = append(t.Links, TopologyLink{Source: self, Target: id, Bin: po})
+		return true
+	})
+	k.defaultIndex.addrs.EachNeighbour(k.base, Pof, func(val pot.Val, po int) bool {
+		e := val.(*entry)
+		id := hex.EncodeToString(e.Address())
+		t.Nodes = append(t.Nodes, TopologyNode{ID: id, Bin: po, Connected: connected[id], Label: k.labels.Lookup(e.BzzAddr)})
+		return true
+	})
+	sort.Slice(t.Nodes[1:], func(i, j int) bool {
+		a, b := t.Nodes[i+1], t.Nodes[j+1]
+		if a.Bin != b.Bin {
+			return a.Bin < b.Bin
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(t.Links, func(i, j int) bool {
+		a, b := t.Links[i], t.Links[j]
+		if a.Bin != b.Bin {
+			return a.Bin < b.Bin
+		}
+		return a.Target < b.Target
+	})
+	return t
+}
+
+// WatchTopology calls f with the topology of the kademlia table and then again whenever
+// it changes, checked every interval, until the context is done or f returns an error
+func (k *Kademlia) WatchTopology(ctx context.Context, interval time.Duration, f func(*Topology) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *Topology
+	for {
+		if t := k.Topology(); last == nil || !reflect.DeepEqual(t, last) {
+			if err := f(t); err != nil {
+				return err
+			}
+			last = t
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// DOT returns the topology in the DOT language of graphviz, the known peers are grouped
+// in clusters by bin, the connected peers are linked to the local node and the bins
+// of the neighbourhood are highlighted
+func (t *Topology) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph kademlia {\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf("%s depth %d", label(t.Self), t.Depth))
+	fmt.Fprintf(&b, "\tnode [shape=box, style=rounded];\n")
+	fmt.Fprintf(&b, "\t%q [label=%q, shape=doublecircle];\n", t.Self, label(t.Self))
+
+	bins := make(map[int][]TopologyNode)
+	var pos []int
+	for _, n := range t.Nodes {
+		if n.Self {
+			continue
+		}
+		if _, ok := bins[n.Bin]; !ok {
+			pos = append(pos, n.Bin)
+		}
+		bins[n.Bin] = append(bins[n.Bin], n)
+	}
+	sort.Ints(pos)
+	for _, po := range pos {
+		fmt.Fprintf(&b, "\tsubgraph cluster_bin_%d {\n", po)
+		if po >= t.Depth {
+			fmt.Fprintf(&b, "\t\tlabel=\"bin %d (neighbourhood)\";\n\t\tcolor=blue;\n", po)
+		} else {
+			fmt.Fprintf(&b, "\t\tlabel=\"bin %d\";\n", po)
+		}
+		for _, n := range bins[po] {
+			style := "rounded,dashed"
+			if n.Connected {
+				style = "rounded"
+			}
+			name := label(n.ID)
+			if n.Label != "" {
+				name = fmt.Sprintf("%s\n%s", n.Label, name)
+			}
+			fmt.Fprintf(&b, "\t\t%q [label=%q, style=%q];\n", n.ID, name, style)
+		}
+		fmt.Fprintf(&b, "\t}\n")
+	}
+	for _, l := range t.Links {
+		fmt.Fprintf(&b, "\t%q -- %q;\n", l.Source, l.Target)
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+// label returns the short form of the hex address shown in the graph
+func label(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
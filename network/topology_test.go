@@ -0,0 +1,82 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/swarm/pot"
+)
+
+// TestTopology tests the graph description of the kademlia table
+func TestTopology(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.On("10000000", "11000000", "01000000", "00100000")
+	tk.Register("00010000")
+
+	topology := tk.Topology()
+	if topology.Self != hex.EncodeToString(tk.BaseAddr()) {
+		t.Fatalf("expected self %x, got %s", tk.BaseAddr(), topology.Self)
+	}
+	if topology.Depth != tk.NeighbourhoodDepth() {
+		t.Fatalf("expected depth %d, got %d", tk.NeighbourhoodDepth(), topology.Depth)
+	}
+
+	id := func(s string) string {
+		return hex.EncodeToString(pot.NewAddressFromString(s))
+	}
+	expNodes := []TopologyNode{
+		{ID: topology.Self, Bin: -1, Connected: true, Self: true},
+		{ID: id("10000000"), Bin: 0, Connected: true},
+		{ID: id("11000000"), Bin: 0, Connected: true},
+		{ID: id("01000000"), Bin: 1, Connected: true},
+		{ID: id("00100000"), Bin: 2, Connected: true},
+		{ID: id("00010000"), Bin: 3},
+	}
+	if len(topology.Nodes) != len(expNodes) {
+		t.Fatalf("expected %d nodes, got %d", len(expNodes), len(topology.Nodes))
+	}
+	for i, n := range expNodes {
+		if topology.Nodes[i] != n {
+			t.Fatalf("node %d: expected %+v, got %+v", i, n, topology.Nodes[i])
+		}
+	}
+	if len(topology.Links) != 4 {
+		t.Fatalf("expected 4 links, got %d", len(topology.Links))
+	}
+	for _, l := range topology.Links {
+		if l.Source != topology.Self {
+			t.Fatalf("expected link from self, got %s", l.Source)
+		}
+	}
+
+	dot := topology.DOT()
+	if !strings.HasPrefix(dot, "graph kademlia {") {
+		t.Fatalf("expected graph, got %s", dot)
+	}
+	if n := strings.Count(dot, " -- "); n != 4 {
+		t.Fatalf("expected 4 edges, got %d", n)
+	}
+	if n := strings.Count(dot, "subgraph cluster_bin_"); n != 4 {
+		t.Fatalf("expected 4 bins, got %d", n)
+	}
+	if n := strings.Count(dot, "dashed"); n != 1 {
+		t.Fatalf("expected 1 peer not connected, got %d", n)
+	}
+}
@@ -85,6 +85,31 @@ func (p *Price) For(payer Payer, size uint32) int64 {
 	return int64(price)
 }
 
+// PriceOracle is consulted by the accounting for the current price of a message exchanged with a peer,
+// in place of the price defined by the message type
+type PriceOracle interface {
+	// Price returns the price of the message exchanged with the peer, nil for the price defined by
+	// the message type. The payer is the role of the local node in the exchange, as for Price.For
+	Price(peer *Peer, msg PricedMessage, payer Payer) (*Price, error)
+}
+
+// EpochMessage is a priced message carrying the epoch of the prices it is priced from,
+// so that both peers price it the same while their prices change
+type EpochMessage interface {
+	PricedMessage
+	// PriceEpoch returns the epoch of the prices of the message
+	PriceEpoch() uint64
+	// SetPriceEpoch sets the epoch of the prices of the message
+	SetPriceEpoch(epoch uint64)
+}
+
+// EpochPriceOracle is a price oracle which prices messages by epochs of prices
+type EpochPriceOracle interface {
+	PriceOracle
+	// PriceEpoch returns the epoch of the current prices of the message sent to the peer
+	PriceEpoch(peer *Peer, msg EpochMessage) uint64
+}
+
 // Balance is the actual accounting instance
 // Balance defines the operations needed for accounting
 // Implementations internally maintain the balance for every peer
@@ -102,14 +127,19 @@ type Balance interface {
 // Accounting implements the Hook interface
 // It interfaces to the balances through the Balance interface
 type Accounting struct {
-	Balance // interface to accounting logic
+	Balance             // interface to accounting logic
+	Oracle  PriceOracle // consulted for the prices of messages, nil for the prices defined by the message types
 }
 
 // NewAccounting creates a new instance of Accounting
+// If the balance also implements PriceOracle, it is consulted for the prices of messages
 func NewAccounting(balance Balance) *Accounting {
 	ah := &Accounting{
 		Balance: balance,
 	}
+	if oracle, ok := balance.(PriceOracle); ok {
+		ah.Oracle = oracle
+	}
 	return ah
 }
 
@@ -131,6 +161,18 @@ func (ah *Accounting) Apply(peer *Peer, costToLocalNode int64, size uint32) erro
 	return err
 }
 
+// Stamp sets the epoch of the current prices of a message sent to the peer
+// if the message and the price oracle support epochs of prices
+func (ah *Accounting) Stamp(peer *Peer, msg interface{}) {
+	epochMessage, ok := msg.(EpochMessage)
+	if !ok {
+		return
+	}
+	if oracle, ok := ah.Oracle.(EpochPriceOracle); ok {
+		epochMessage.SetPriceEpoch(oracle.PriceEpoch(peer, epochMessage))
+	}
+}
+
 // Validate calculates the cost for the local node sending or receiving a msg to/from a peer querying the message for its price.
 // It returns either the signed cost for the local node as int64 or an error, signaling that the accounting operation would fail
 // (no change has been applied at this point)
@@ -143,7 +185,17 @@ func (ah *Accounting) Validate(peer *Peer, size uint32, msg interface{}, payer P
 		return 0, nil
 	}
 	// evaluate the price for receiving messages
-	costToLocalNode := pricedMessage.Price().For(payer, size)
+	price := pricedMessage.Price()
+	if ah.Oracle != nil {
+		p, err := ah.Oracle.Price(peer, pricedMessage, payer)
+		if err != nil {
+			return 0, err
+		}
+		if p != nil {
+			price = p
+		}
+	}
+	costToLocalNode := price.For(payer, size)
 	// check that the operation would perform correctly
 	err := ah.Check(costToLocalNode, peer)
 	if err != nil {
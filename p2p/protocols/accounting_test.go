@@ -172,6 +172,96 @@ func TestBalance(t *testing.T) {
 	checkAccountingTestCases(t, testCases, acc, peer, balance, false)
 }
 
+// dummy price oracle doubling the prices of the messages paid by the local node
+type dummyOracle struct{}
+
+func (o *dummyOracle) Price(peer *Peer, msg PricedMessage, payer Payer) (*Price, error) {
+	price := *msg.Price()
+	if price.Payer != payer {
+		return nil, nil
+	}
+	price.Value *= 2
+	return &price, nil
+}
+
+// dummy balance which also is a price oracle
+type dummyOracleBalance struct {
+	dummyBalance
+	dummyOracle
+}
+
+// TestBalancePriceOracle tests that the accounting consults the price oracle
+// of the balance for the prices of messages
+func TestBalancePriceOracle(t *testing.T) {
+	balance := &dummyOracleBalance{}
+	spec := createTestSpec()
+	acc := NewAccounting(balance)
+	if acc.Oracle == nil {
+		t.Fatal("expected the balance to be used as price oracle")
+	}
+	id := adapters.RandomNodeConfig().ID
+	peer := NewPeer(p2p.NewPeer(id, "testPeer", nil), &dummyRW{}, spec)
+
+	for _, c := range []struct {
+		payer Payer
+		want  int64
+	}{
+		{Sender, -198},
+		{Receiver, 99},
+	} {
+		cost, err := acc.Validate(peer, 0, &perUnitMsgSenderPays{}, c.payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := acc.Apply(peer, cost, 0); err != nil {
+			t.Fatal(err)
+		}
+		if balance.amount != c.want {
+			t.Fatalf("expected balance to be %d but is %d", c.want, balance.amount)
+		}
+	}
+}
+
+// dummy message carrying the epoch of its prices
+type epochMsg struct {
+	perUnitMsgSenderPays
+	Epoch uint64
+}
+
+func (m *epochMsg) PriceEpoch() uint64 {
+	return m.Epoch
+}
+
+func (m *epochMsg) SetPriceEpoch(epoch uint64) {
+	m.Epoch = epoch
+}
+
+// dummy price oracle pricing messages in epoch 7
+type dummyEpochOracle struct {
+	dummyOracle
+}
+
+func (o *dummyEpochOracle) PriceEpoch(peer *Peer, msg EpochMessage) uint64 {
+	return 7
+}
+
+// TestAccountingStamp tests that messages sent are stamped with the epoch of their prices
+// only if the price oracle prices messages by epochs
+func TestAccountingStamp(t *testing.T) {
+	id := adapters.RandomNodeConfig().ID
+	peer := NewPeer(p2p.NewPeer(id, "testPeer", nil), &dummyRW{}, createTestSpec())
+
+	msg := &epochMsg{}
+	(&Accounting{Balance: &dummyBalance{}, Oracle: &dummyOracle{}}).Stamp(peer, msg)
+	if msg.Epoch != 0 {
+		t.Fatalf("expected epoch 0 without epoch price oracle, got %d", msg.Epoch)
+	}
+	(&Accounting{Balance: &dummyBalance{}, Oracle: &dummyEpochOracle{}}).Stamp(peer, msg)
+	if msg.Epoch != 7 {
+		t.Fatalf("expected epoch 7, got %d", msg.Epoch)
+	}
+}
+
 func checkAccountingTestCases(t *testing.T, cases []testCase, acc *Accounting, peer *Peer, balance *dummyBalance, send bool) {
 	t.Helper()
 	for _, c := range cases {
@@ -0,0 +1,263 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"golang.org/x/time/rate"
+)
+
+// BandwidthVersion is the textual version number of the bandwidth API
+const BandwidthVersion = "1.0"
+
+// ErrInvalidBandwidthLimits is returned when setting negative bandwidth limits
+var ErrInvalidBandwidthLimits = errors.New("invalid bandwidth limits")
+
+// bandwidth metrics
+var (
+	// how many times sending or receiving messages have been delayed by the bandwidth limits
+	mBandwidthUploadDelays   = metrics.NewRegisteredCounter("bandwidth/upload/delays", nil)
+	mBandwidthDownloadDelays = metrics.NewRegisteredCounter("bandwidth/download/delays", nil)
+)
+
+// BandwidthLimits are the rates in bytes per second the traffic of the protocols is limited to, 0 for no limit
+type BandwidthLimits struct {
+	Upload       int64 // rate of the messages sent to all peers
+	Download     int64 // rate of the messages received from all peers
+	PeerUpload   int64 // rate of the messages sent to every peer
+	PeerDownload int64 // rate of the messages received from every peer
+}
+
+// validate checks that the limits are not negative
+func (l *BandwidthLimits) validate() error {
+	if l.Upload < 0 || l.Download < 0 || l.PeerUpload < 0 || l.PeerDownload < 0 {
+		return ErrInvalidBandwidthLimits
+	}
+	return nil
+}
+
+// PeerBandwidth is the traffic with a connected peer
+type PeerBandwidth struct {
+	Peer       enode.ID // the peer
+	Uploaded   int64    // bytes of the messages sent to the peer
+	Downloaded int64    // bytes of the messages received from the peer
+}
+
+// peerBandwidth limits the traffic with a peer
+type peerBandwidth struct {
+	upload     *rate.Limiter
+	download   *rate.Limiter
+	uploaded   int64
+	downloaded int64
+	refs       int // number of protocols running with the peer
+}
+
+// Bandwidth limits the traffic of the protocols sharing it with token buckets, globally
+// and per peer. Messages are sent or read once the buckets hold their size, so limiting
+// the download also slows down the peers sending through the flow control of the connection.
+type Bandwidth struct {
+	lock     sync.Mutex
+	limits   BandwidthLimits
+	upload   *rate.Limiter
+	download *rate.Limiter
+	peers    map[enode.ID]*peerBandwidth
+}
+
+// NewBandwidth creates the bandwidth manager with the limits, no limits if nil
+func NewBandwidth(limits *BandwidthLimits) (*Bandwidth, error) {
+	if limits == nil {
+		limits = &BandwidthLimits{}
+	}
+	if err := limits.validate(); err != nil {
+		return nil, err
+	}
+	return &Bandwidth{
+		limits:   *limits,
+		upload:   newBandwidthLimiter(limits.Upload),
+		download: newBandwidthLimiter(limits.Download),
+		peers:    make(map[enode.ID]*peerBandwidth),
+	}, nil
+}
+
+// newBandwidthLimiter returns a token bucket of the rate holding the traffic of a second
+func newBandwidthLimiter(limit int64) *rate.Limiter {
+	if limit == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(limit), int(limit))
+}
+
+// Limits returns the current limits
+func (b *Bandwidth) Limits() BandwidthLimits {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.limits
+}
+
+// SetLimits changes the limits, also for the connected peers
+func (b *Bandwidth) SetLimits(limits BandwidthLimits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// the buckets are replaced as their burst cannot be changed
+	b.limits = limits
+	b.upload = newBandwidthLimiter(limits.Upload)
+	b.download = newBandwidthLimiter(limits.Download)
+	for _, p := range b.peers {
+		p.upload = newBandwidthLimiter(limits.PeerUpload)
+		p.download = newBandwidthLimiter(limits.PeerDownload)
+	}
+	return nil
+}
+
+// Peers returns the traffic with the connected peers
+func (b *Bandwidth) Peers() []PeerBandwidth {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	peers := make([]PeerBandwidth, 0, len(b.peers))
+	for id, p := range b.peers {
+		peers = append(peers, PeerBandwidth{
+			Peer:       id,
+			Uploaded:   p.uploaded,
+			Downloaded: p.downloaded,
+		})
+	}
+	return peers
+}
+
+// addPeer starts limiting the traffic with the peer for a protocol running with it
+func (b *Bandwidth) addPeer(id enode.ID) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p, ok := b.peers[id]
+	if !ok {
+		p = &peerBandwidth{
+			upload:   newBandwidthLimiter(b.limits.PeerUpload),
+			download: newBandwidthLimiter(b.limits.PeerDownload),
+		}
+		b.peers[id] = p
+	}
+	p.refs++
+}
+
+// removePeer stops limiting the traffic with the peer once no protocol runs with it
+func (b *Bandwidth) removePeer(id enode.ID) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p, ok := b.peers[id]
+	if !ok {
+		return
+	}
+	if p.refs--; p.refs == 0 {
+		delete(b.peers, id)
+	}
+}
+
+// waitUpload blocks until a message of the size can be sent to the peer
+func (b *Bandwidth) waitUpload(ctx context.Context, id enode.ID, size int) error {
+	b.lock.Lock()
+	limiters := []*rate.Limiter{b.upload}
+	if p := b.peers[id]; p != nil {
+		p.uploaded += int64(size)
+		limiters = append(limiters, p.upload)
+	}
+	b.lock.Unlock()
+	delayed, err := wait(ctx, limiters, size)
+	if delayed {
+		mBandwidthUploadDelays.Inc(1)
+	}
+	return err
+}
+
+// waitDownload blocks until a message of the size can be read from the peer
+func (b *Bandwidth) waitDownload(ctx context.Context, id enode.ID, size int) error {
+	b.lock.Lock()
+	limiters := []*rate.Limiter{b.download}
+	if p := b.peers[id]; p != nil {
+		p.downloaded += int64(size)
+		limiters = append(limiters, p.download)
+	}
+	b.lock.Unlock()
+	delayed, err := wait(ctx, limiters, size)
+	if delayed {
+		mBandwidthDownloadDelays.Inc(1)
+	}
+	return err
+}
+
+// wait takes the size from the token buckets, in portions not exceeding their burst
+// so that large messages pass at the rate, and returns whether it was delayed
+func wait(ctx context.Context, limiters []*rate.Limiter, size int) (delayed bool, err error) {
+	for _, l := range limiters {
+		if l.Limit() == rate.Inf {
+			continue
+		}
+		for n := size; n > 0; {
+			k := n
+			if burst := l.Burst(); k > burst {
+				k = burst
+			}
+			n -= k
+			r := l.ReserveN(time.Now(), k)
+			d := r.Delay()
+			if d == 0 {
+				continue
+			}
+			delayed = true
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				r.Cancel()
+				return delayed, ctx.Err()
+			}
+		}
+	}
+	return delayed, nil
+}
+
+// BandwidthApi provides an API to change the bandwidth limits at runtime
+type BandwidthApi struct {
+	bandwidth *Bandwidth
+}
+
+// NewBandwidthApi creates a new BandwidthApi
+func NewBandwidthApi(b *Bandwidth) *BandwidthApi {
+	return &BandwidthApi{b}
+}
+
+// Limits returns the current bandwidth limits
+func (a *BandwidthApi) Limits() BandwidthLimits {
+	return a.bandwidth.Limits()
+}
+
+// SetLimits changes the bandwidth limits
+func (a *BandwidthApi) SetLimits(limits BandwidthLimits) error {
+	return a.bandwidth.SetLimits(limits)
+}
+
+// Peers returns the traffic with the connected peers
+func (a *BandwidthApi) Peers() []PeerBandwidth {
+	return a.bandwidth.Peers()
+}
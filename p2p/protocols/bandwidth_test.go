@@ -0,0 +1,107 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// TestBandwidthLimits tests setting the bandwidth limits
+func TestBandwidthLimits(t *testing.T) {
+	if _, err := NewBandwidth(&BandwidthLimits{Upload: -1}); err != ErrInvalidBandwidthLimits {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidBandwidthLimits)
+	}
+	b, err := NewBandwidth(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := b.Limits(); l != (BandwidthLimits{}) {
+		t.Fatalf("got limits %+v, want none", l)
+	}
+	limits := BandwidthLimits{Upload: 1, Download: 2, PeerUpload: 3, PeerDownload: 4}
+	if err := b.SetLimits(limits); err != nil {
+		t.Fatal(err)
+	}
+	if l := b.Limits(); l != limits {
+		t.Fatalf("got limits %+v, want %+v", l, limits)
+	}
+	if err := b.SetLimits(BandwidthLimits{PeerDownload: -1}); err != ErrInvalidBandwidthLimits {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidBandwidthLimits)
+	}
+}
+
+// TestBandwidthWait tests that the traffic is delayed by the global and peer limits
+// and that the traffic with the peers is recorded
+func TestBandwidthWait(t *testing.T) {
+	b, err := NewBandwidth(&BandwidthLimits{Upload: 10000, PeerDownload: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id enode.ID
+	b.addPeer(id)
+	ctx := context.Background()
+
+	// the buckets hold the traffic of a second
+	start := time.Now()
+	if err := b.waitUpload(ctx, id, 10000); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.waitDownload(ctx, id, 10000); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("got delay %v within the burst", d)
+	}
+
+	start = time.Now()
+	if err := b.waitUpload(ctx, id, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("got upload delay %v, want at least 400ms", d)
+	}
+	// messages larger than the burst pass at the rate, the download bucket
+	// refilled by half during the upload delay
+	start = time.Now()
+	if err := b.waitDownload(ctx, id, 15000); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Fatalf("got download delay %v, want at least 900ms", d)
+	}
+
+	peers := b.Peers()
+	if len(peers) != 1 || peers[0].Uploaded != 15000 || peers[0].Downloaded != 25000 {
+		t.Fatalf("got peer traffic %+v, want 15000 bytes uploaded and 25000 downloaded", peers)
+	}
+
+	// waiting ends with the context, the upload bucket refilled during the download delay
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.waitUpload(cctx, id, 20000); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	b.removePeer(id)
+	if peers := b.Peers(); len(peers) != 0 {
+		t.Fatalf("got %d peers after removal, want 0", len(peers))
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Textual version number of capture API
+const CaptureVersion = "1.0"
+
+// DefaultCaptureSize is the default number of messages kept by a capture
+const DefaultCaptureSize = 10000
+
+var errCaptureNotStarted = errors.New("message capture not started")
+
+// activeCapture is the capture messages are recorded into, a nil *Capture if capturing is off
+var activeCapture atomic.Value
+
+func init() {
+	activeCapture.Store((*Capture)(nil))
+}
+
+// CaptureParams selects the messages to capture
+type CaptureParams struct {
+	Size      int        // number of most recent messages kept, DefaultCaptureSize if 0
+	Peers     []enode.ID // peers to capture the messages of, all if empty
+	Protocols []string   // names of the protocols to capture the messages of, all if empty
+}
+
+// CapturedMsg is a recorded protocol message. Captured messages serialised to JSON
+// can be replayed with ReplayCapture, e.g. against a node in a simulation.
+type CapturedMsg struct {
+	Seq      uint64        `json:"seq"`      // order of the message in the capture
+	Time     time.Time     `json:"time"`     // time the message was sent or received
+	Peer     enode.ID      `json:"peer"`     // remote peer
+	Protocol string        `json:"protocol"` // protocol name
+	Version  uint          `json:"version"`  // protocol version
+	Inbound  bool          `json:"inbound"`  // true if the message was received from the peer
+	Code     uint64        `json:"code"`     // message code
+	Type     string        `json:"type"`     // message type
+	Payload  hexutil.Bytes `json:"payload"`  // RLP encoding of the message, without the tracing context
+}
+
+// Decode decodes the captured message into the message type of the protocol spec
+func (m *CapturedMsg) Decode(spec *Spec) (interface{}, error) {
+	val, ok := spec.NewMsg(m.Code)
+	if !ok {
+		return nil, fmt.Errorf("invalid message code: %v", m.Code)
+	}
+	if err := rlp.DecodeBytes(m.Payload, val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// Capture records the messages of selected peers and protocols into a ring buffer
+type Capture struct {
+	lock      sync.Mutex
+	peers     map[enode.ID]bool
+	protocols map[string]bool
+	msgs      []CapturedMsg // ring buffer of captured messages
+	seq       uint64        // number of captured messages
+}
+
+// StartCapture starts capturing messages, replacing the running capture
+func StartCapture(params CaptureParams) *Capture {
+	if params.Size <= 0 {
+		params.Size = DefaultCaptureSize
+	}
+	c := &Capture{
+		peers:     make(map[enode.ID]bool),
+		protocols: make(map[string]bool),
+		msgs:      make([]CapturedMsg, params.Size),
+	}
+	for _, id := range params.Peers {
+		c.peers[id] = true
+	}
+	for _, name := range params.Protocols {
+		c.protocols[name] = true
+	}
+	activeCapture.Store(c)
+	return c
+}
+
+// StopCapture stops capturing messages and returns the stopped capture, nil if none was running
+func StopCapture() *Capture {
+	c := activeCapture.Load().(*Capture)
+	activeCapture.Store((*Capture)(nil))
+	return c
+}
+
+// capturing returns the running capture if it records the messages of the peer
+func capturing(p *Peer) *Capture {
+	c := activeCapture.Load().(*Capture)
+	if c == nil {
+		return nil
+	}
+	if len(c.peers) > 0 && !c.peers[p.ID()] {
+		return nil
+	}
+	if len(c.protocols) > 0 && !c.protocols[p.spec.Name] {
+		return nil
+	}
+	return c
+}
+
+// record adds a message to the ring buffer
+func (c *Capture) record(p *Peer, inbound bool, code uint64, msg interface{}, payload []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.msgs[c.seq%uint64(len(c.msgs))] = CapturedMsg{
+		Seq:      c.seq,
+		Time:     time.Now(),
+		Peer:     p.ID(),
+		Protocol: p.spec.Name,
+		Version:  p.spec.Version,
+		Inbound:  inbound,
+		Code:     code,
+		Type:     fmt.Sprintf("%T", msg),
+		Payload:  payload,
+	}
+	c.seq++
+}
+
+// Messages returns the captured messages in the order they were recorded
+func (c *Capture) Messages() []CapturedMsg {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	size := uint64(len(c.msgs))
+	start := uint64(0)
+	if c.seq > size {
+		start = c.seq - size
+	}
+	msgs := make([]CapturedMsg, 0, c.seq-start)
+	for seq := start; seq < c.seq; seq++ {
+		msgs = append(msgs, c.msgs[seq%size])
+	}
+	return msgs
+}
+
+// ReplayCapture writes the captured messages received from the peer over the protocol
+// to the message writer, in their original order. Replayed messages are not wrapped
+// with the tracing context, so the receiving protocol should not expect one.
+func ReplayCapture(msgs []CapturedMsg, peer enode.ID, protocol string, w p2p.MsgWriter) error {
+	for _, m := range msgs {
+		if !m.Inbound || m.Peer != peer || m.Protocol != protocol {
+			continue
+		}
+		err := w.WriteMsg(p2p.Msg{
+			Code:    m.Code,
+			Size:    uint32(len(m.Payload)),
+			Payload: bytes.NewReader(m.Payload),
+		})
+		if err != nil {
+			return fmt.Errorf("replaying message %d: %w", m.Seq, err)
+		}
+	}
+	return nil
+}
+
+// CaptureApi provides an API to capture protocol messages for debugging
+type CaptureApi struct{}
+
+// NewCaptureApi creates a new CaptureApi
+func NewCaptureApi() *CaptureApi {
+	return &CaptureApi{}
+}
+
+// Start starts capturing the messages of the peers and protocols, all if empty,
+// keeping the size most recent ones
+func (a *CaptureApi) Start(peers []enode.ID, protocols []string, size int) {
+	StartCapture(CaptureParams{
+		Size:      size,
+		Peers:     peers,
+		Protocols: protocols,
+	})
+}
+
+// Stop stops capturing messages and returns the captured ones
+func (a *CaptureApi) Stop() ([]CapturedMsg, error) {
+	c := StopCapture()
+	if c == nil {
+		return nil, errCaptureNotStarted
+	}
+	return c.Messages(), nil
+}
+
+// Dump returns the messages captured so far
+func (a *CaptureApi) Dump() ([]CapturedMsg, error) {
+	c := activeCapture.Load().(*Capture)
+	if c == nil {
+		return nil, errCaptureNotStarted
+	}
+	return c.Messages(), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// TestCapture tests that messages exchanged with a peer are captured
+// and that the received ones can be replayed to a protocol
+func TestCapture(t *testing.T) {
+	spec := &Spec{
+		Name:       "capture",
+		Version:    1,
+		MaxMsgSize: 1024,
+		Messages:   []interface{}{hs0{}, kill{}},
+	}
+	id := enode.ID{1}
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	sender := NewPeer(p2p.NewPeer(id, "remote", nil), remote, spec)
+	receiver := NewPeer(p2p.NewPeer(id, "local", nil), local, spec)
+
+	c := StartCapture(CaptureParams{Size: 3, Protocols: []string{"capture"}})
+	defer StopCapture()
+
+	received := make(chan interface{}, 10)
+	handle := func(ctx context.Context, msg interface{}) error {
+		received <- msg
+		return nil
+	}
+	go receiver.Run(handle)
+
+	msgs := []interface{}{&hs0{1}, &kill{enode.ID{2}}, &hs0{3}}
+	for _, msg := range msgs {
+		if err := sender.Send(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		<-received
+	}
+
+	// the ring buffer keeps the last 3 of the 6 captured messages
+	captured := c.Messages()
+	if len(captured) != 3 {
+		t.Fatalf("expected 3 captured messages, got %d", len(captured))
+	}
+	if captured[0].Seq != 3 || captured[2].Seq != 5 {
+		t.Fatalf("expected messages 3 to 5, got %d to %d", captured[0].Seq, captured[2].Seq)
+	}
+	last := captured[2]
+	if !last.Inbound || last.Code != 0 || last.Protocol != "capture" {
+		t.Fatalf("unexpected captured message %+v", last)
+	}
+	decoded, err := last.Decode(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, msgs[2]) {
+		t.Fatalf("expected %v, got %v", msgs[2], decoded)
+	}
+
+	StopCapture()
+
+	// replay the received messages to another protocol instance
+	replayLocal, replayRemote := p2p.MsgPipe()
+	defer replayLocal.Close()
+	replayed := NewPeer(p2p.NewPeer(id, "replay", nil), replayLocal, spec)
+	go replayed.Run(handle)
+	if err := ReplayCapture(captured, id, "capture", replayRemote); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range captured {
+		if !m.Inbound {
+			continue
+		}
+		select {
+		case msg := <-received:
+			expected, _ := m.Decode(spec)
+			if !reflect.DeepEqual(msg, expected) {
+				t.Fatalf("expected replayed %v, got %v", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for replayed message")
+		}
+	}
+}
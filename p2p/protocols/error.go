@@ -16,6 +16,8 @@
 
 package protocols
 
+import "fmt"
+
 // HandlerError wraps standard error
 // This error is handled specially by protocol.Run
 // It causes the protocol to return with ErrHandler(err)
@@ -38,3 +40,21 @@ func (e *breakError) Unwrap() error { return e.err }
 func (w *breakError) Error() string {
 	return w.err.Error()
 }
+
+// PanicError is returned by the event loop in place of a message handler that panicked
+type PanicError struct {
+	Value interface{} // value the handler panicked with
+	Stack []byte      // stack trace of the panic
+}
+
+// Error implements function of the standard go error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("message handler panicked: %v", e.Value)
+}
+
+// PanicHandler is implemented by the MsgReadWriters of peers whose panicking message handlers
+// are taken care of by the caller of the protocol, e.g. a supervisor.
+// Without it, the peer is dropped when a message handler panics.
+type PanicHandler interface {
+	HandlePanic(err *PanicError)
+}
@@ -0,0 +1,291 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// DefaultMeteringMaxDelay is the default maximum delay of a message of a peer exceeding the soft limit
+const DefaultMeteringMaxDelay = time.Second
+
+// metering metrics are registered in the accounting registry
+var (
+	// how many times messages of peers exceeding the soft limit have been delayed
+	mMeteringDelays = metrics.NewRegisteredCounterForced("account/metering/delays", metrics.AccountingRegistry)
+)
+
+// MeteringParams configures the accounting-only metering
+type MeteringParams struct {
+	SoftLimit   int64         // balance a peer can owe before its messages are delayed, 0 for no limit
+	RefreshRate int64         // units of the balances settled every second for free, 0 for none
+	MaxDelay    time.Duration // maximum delay of a message of a peer exceeding the soft limit, DefaultMeteringMaxDelay if 0
+}
+
+// PeerTraffic is the metered traffic with a peer
+type PeerTraffic struct {
+	Peer        enode.ID  // the peer
+	Balance     int64     // units owed by the peer, negative if owed to the peer
+	UnitsCredit int64     // total units credited to the local node
+	UnitsDebit  int64     // total units debited from the local node
+	MsgCredit   int64     // number of messages credited to the local node
+	MsgDebit    int64     // number of messages debited from the local node
+	Delays      int64     // number of messages delayed because the peer exceeded the soft limit
+	LastActive  time.Time // time of the last accounted message
+	refreshed   time.Time // time up to which the balance has been refreshed
+}
+
+// Metering implements the Balance interface recording the traffic with every peer
+// without settling the balances. Instead of dropping peers, messages of peers owing
+// more than the soft limit are delayed, while their balances are refreshed at
+// a constant rate.
+type Metering struct {
+	params  *MeteringParams
+	lock    sync.Mutex
+	traffic map[enode.ID]*PeerTraffic
+	now     func() time.Time // time source, replaced in tests
+	sleep   func(time.Duration)
+}
+
+// NewMetering creates the accounting-only metering
+func NewMetering(params *MeteringParams) *Metering {
+	if params == nil {
+		params = &MeteringParams{}
+	}
+	if params.MaxDelay == 0 {
+		params.MaxDelay = DefaultMeteringMaxDelay
+	}
+	return &Metering{
+		params:  params,
+		traffic: make(map[enode.ID]*PeerTraffic),
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// Add records the amount in the traffic with the peer
+// positive amount = credit local node
+// negative amount = debit local node
+func (m *Metering) Add(amount int64, peer *Peer) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	t := m.peerTraffic(peer.ID(), now)
+	m.refresh(t, now)
+	t.Balance += amount
+	if amount > 0 {
+		t.UnitsCredit += amount
+		t.MsgCredit++
+	} else {
+		t.UnitsDebit -= amount
+		t.MsgDebit++
+	}
+	t.LastActive = now
+	metrics.GetOrRegisterGauge(balanceGaugeName(peer.ID()), metrics.AccountingRegistry).Update(t.Balance)
+	return nil
+}
+
+// RemovePeer unregisters the balance gauge of a disconnected peer, its traffic is kept
+func (m *Metering) RemovePeer(peer enode.ID) {
+	metrics.AccountingRegistry.Unregister(balanceGaugeName(peer))
+}
+
+// balanceGaugeName returns the name of the gauge of the balance with the peer
+func balanceGaugeName(peer enode.ID) string {
+	return fmt.Sprintf("account/metering/peer/%s/balance", peer.TerminalString())
+}
+
+// Check never fails, but applies backpressure by delaying the message
+// if the amount would make the peer owe more than the soft limit
+func (m *Metering) Check(amount int64, peer *Peer) error {
+	if delay := m.delay(amount, peer.ID()); delay > 0 {
+		mMeteringDelays.Inc(1)
+		m.sleep(delay)
+	}
+	return nil
+}
+
+// delay returns how long a message with the amount is delayed
+// it is the time needed to refresh the balance exceeding the soft limit, at most the maximum delay
+func (m *Metering) delay(amount int64, peer enode.ID) time.Duration {
+	if amount <= 0 || m.params.SoftLimit <= 0 {
+		return 0
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	t := m.peerTraffic(peer, now)
+	m.refresh(t, now)
+	excess := t.Balance + amount - m.params.SoftLimit
+	if excess <= 0 {
+		return 0
+	}
+	t.Delays++
+	if m.params.RefreshRate <= 0 {
+		return m.params.MaxDelay
+	}
+	delay := time.Duration(excess) * time.Second / time.Duration(m.params.RefreshRate)
+	if delay > m.params.MaxDelay || delay < 0 {
+		delay = m.params.MaxDelay
+	}
+	return delay
+}
+
+// peerTraffic returns the traffic with the peer, created if there was none
+// the caller is expected to hold m.lock
+func (m *Metering) peerTraffic(peer enode.ID, now time.Time) *PeerTraffic {
+	t, ok := m.traffic[peer]
+	if !ok {
+		t = &PeerTraffic{Peer: peer, LastActive: now, refreshed: now}
+		m.traffic[peer] = t
+	}
+	return t
+}
+
+// refresh settles the part of the balance refreshed since the last refresh
+// only the time worth whole units is consumed, the remainder is carried over
+// so that frequent refreshes do not lose it
+func (m *Metering) refresh(t *PeerTraffic, now time.Time) {
+	rate := m.params.RefreshRate
+	if rate <= 0 || t.Balance == 0 {
+		t.refreshed = now
+		return
+	}
+	elapsed := now.Sub(t.refreshed)
+	if elapsed <= 0 {
+		return
+	}
+	units := int64(elapsed.Seconds() * float64(rate))
+	balance := t.Balance
+	if balance < 0 {
+		balance = -balance
+	}
+	if units >= balance {
+		t.Balance = 0
+		t.refreshed = now
+		return
+	}
+	if t.Balance > 0 {
+		t.Balance -= units
+	} else {
+		t.Balance += units
+	}
+	t.refreshed = t.refreshed.Add(time.Duration(units) * time.Second / time.Duration(rate))
+}
+
+// PeerTraffic returns the traffic with the peer, nil if there was none
+// the balance is the refreshed balance at the time of the call
+func (m *Metering) PeerTraffic(peer enode.ID) *PeerTraffic {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	t, ok := m.traffic[peer]
+	if !ok {
+		return nil
+	}
+	traffic := *t
+	m.refresh(&traffic, m.now())
+	return &traffic
+}
+
+// Traffic returns the traffic with all peers, ordered by peer
+func (m *Metering) Traffic() []PeerTraffic {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	traffic := make([]PeerTraffic, 0, len(m.traffic))
+	for _, t := range m.traffic {
+		pt := *t
+		m.refresh(&pt, now)
+		traffic = append(traffic, pt)
+	}
+	sort.Slice(traffic, func(i, j int) bool {
+		return traffic[i].Peer.String() < traffic[j].Peer.String()
+	})
+	return traffic
+}
+
+// WriteCSV writes the traffic with all peers in CSV format, with a header row
+func (m *Metering) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"peer", "balance", "units_credit", "units_debit", "msg_credit", "msg_debit", "delays", "last_active"}); err != nil {
+		return err
+	}
+	for _, t := range m.Traffic() {
+		record := []string{
+			t.Peer.String(),
+			strconv.FormatInt(t.Balance, 10),
+			strconv.FormatInt(t.UnitsCredit, 10),
+			strconv.FormatInt(t.UnitsDebit, 10),
+			strconv.FormatInt(t.MsgCredit, 10),
+			strconv.FormatInt(t.MsgDebit, 10),
+			strconv.FormatInt(t.Delays, 10),
+			t.LastActive.UTC().Format(time.RFC3339),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// MeteringApi provides an API to access the traffic metered with the peers
+type MeteringApi struct {
+	metering *Metering
+}
+
+// NewMeteringApi creates a new MeteringApi
+func NewMeteringApi(m *Metering) *MeteringApi {
+	return &MeteringApi{m}
+}
+
+// Traffic returns the traffic with all peers
+func (a *MeteringApi) Traffic() []PeerTraffic {
+	return a.metering.Traffic()
+}
+
+// PeerTraffic returns the traffic with the peer
+func (a *MeteringApi) PeerTraffic(peer enode.ID) (*PeerTraffic, error) {
+	t := a.metering.PeerTraffic(peer)
+	if t == nil {
+		return nil, fmt.Errorf("no traffic with peer %s", peer)
+	}
+	return t, nil
+}
+
+// CSV returns the traffic with all peers in CSV format
+func (a *MeteringApi) CSV() (string, error) {
+	var b strings.Builder
+	if err := a.metering.WriteCSV(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
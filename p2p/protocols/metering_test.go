@@ -0,0 +1,137 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+)
+
+// TestMetering tests that the metering records the traffic with a peer,
+// refreshes its balance over time and delays its messages over the soft limit
+func TestMetering(t *testing.T) {
+	m := NewMetering(&MeteringParams{
+		SoftLimit:   100,
+		RefreshRate: 10,
+		MaxDelay:    5 * time.Second,
+	})
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+	var slept time.Duration
+	m.sleep = func(d time.Duration) { slept += d }
+
+	id := adapters.RandomNodeConfig().ID
+	peer := NewPeer(p2p.NewPeer(id, "testPeer", nil), &dummyRW{}, createTestSpec())
+
+	if err := m.Check(80, peer); err != nil {
+		t.Fatal(err)
+	}
+	if slept != 0 {
+		t.Fatalf("expected no delay under the soft limit, got %v", slept)
+	}
+	m.Add(80, peer)
+	m.Add(-30, peer)
+
+	traffic := m.PeerTraffic(id)
+	if traffic.Balance != 50 || traffic.UnitsCredit != 80 || traffic.UnitsDebit != 30 || traffic.MsgCredit != 1 || traffic.MsgDebit != 1 {
+		t.Fatalf("unexpected traffic %+v", traffic)
+	}
+
+	// exceeding the soft limit by 20 units delays the message for 2 seconds
+	if err := m.Check(70, peer); err != nil {
+		t.Fatal(err)
+	}
+	if slept != 2*time.Second {
+		t.Fatalf("expected delay of 2s, got %v", slept)
+	}
+
+	// the balance is refreshed at 10 units per second
+	now = now.Add(3 * time.Second)
+	if traffic := m.PeerTraffic(id); traffic.Balance != 20 || traffic.Delays != 1 {
+		t.Fatalf("unexpected traffic after refresh %+v", traffic)
+	}
+	now = now.Add(time.Minute)
+	if traffic := m.PeerTraffic(id); traffic.Balance != 0 {
+		t.Fatalf("expected balance to be refreshed to 0, got %d", traffic.Balance)
+	}
+
+	// the delay is capped
+	slept = 0
+	m.Check(1000, peer)
+	if slept != 5*time.Second {
+		t.Fatalf("expected delay of 5s, got %v", slept)
+	}
+
+	var b bytes.Buffer
+	if err := m.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 CSV lines, got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[1], id.String()+",0,80,30,1,1,2,") {
+		t.Fatalf("unexpected CSV record %q", lines[1])
+	}
+}
+
+// TestMeteringFrequentTraffic tests that the balance of a peer is refreshed when its messages
+// and queries of its traffic are more frequent than the time worth a unit of the refresh rate,
+// and that the balance gauge of the peer is unregistered once it is removed
+func TestMeteringFrequentTraffic(t *testing.T) {
+	m := NewMetering(&MeteringParams{
+		RefreshRate: 10,
+	})
+	start := time.Unix(1000, 0)
+	now := start
+	m.now = func() time.Time { return now }
+
+	id := adapters.RandomNodeConfig().ID
+	peer := NewPeer(p2p.NewPeer(id, "testPeer", nil), &dummyRW{}, createTestSpec())
+
+	m.Add(100, peer)
+	// a message and a query every 50ms, each worth half a unit of the refresh
+	for i := 0; i < 20; i++ {
+		now = now.Add(50 * time.Millisecond)
+		m.Add(1, peer)
+		m.PeerTraffic(id)
+	}
+	traffic := m.PeerTraffic(id)
+	if traffic.Balance != 110 {
+		t.Fatalf("expected balance of 110 after refreshing 10 units, got %d", traffic.Balance)
+	}
+	// queries do not change the time of the last accounted message
+	now = now.Add(time.Second)
+	if traffic := m.PeerTraffic(id); !traffic.LastActive.Equal(start.Add(time.Second)) {
+		t.Fatalf("expected last activity at %v, got %v", start.Add(time.Second), traffic.LastActive)
+	}
+
+	name := balanceGaugeName(id)
+	if metrics.AccountingRegistry.Get(name) == nil {
+		t.Fatal("expected balance gauge of the peer to be registered")
+	}
+	m.RemovePeer(id)
+	if metrics.AccountingRegistry.Get(name) != nil {
+		t.Fatal("expected balance gauge of the removed peer to be unregistered")
+	}
+}
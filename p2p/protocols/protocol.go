@@ -34,6 +34,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -63,6 +64,11 @@ type Hook interface {
 	Validate(peer *Peer, size uint32, msg interface{}, payer Payer) (int64, error)
 }
 
+// Stamper is a Hook which sets fields of the messages sent to a peer before they are encoded
+type Stamper interface {
+	Stamp(peer *Peer, msg interface{})
+}
+
 // Spec is a protocol specification including its name and version as well as
 // the types of messages which are exchanged
 type Spec struct {
@@ -85,6 +91,9 @@ type Spec struct {
 	//hook for accounting (could be extended to multiple hooks in the future)
 	Hook Hook
 
+	// Bandwidth limits the traffic of the protocol, nil for no limits
+	Bandwidth *Bandwidth
+
 	initOnce sync.Once
 	codes    map[reflect.Type]uint64
 	types    map[uint64]reflect.Type
@@ -146,9 +155,11 @@ type Peer struct {
 	encode          func(context.Context, interface{}) (interface{}, int, error)
 	decode          func(p2p.Msg) (context.Context, []byte, error)
 	wg              sync.WaitGroup
-	running         bool         // if running is true async go routines are dispatched in the event loop
-	mtx             sync.RWMutex // guards running
-	handleMsgPauser MsgPauser    //  message pauser, should be used only in tests
+	running         bool              // if running is true async go routines are dispatched in the event loop
+	mtx             sync.RWMutex      // guards running
+	handleMsgPauser MsgPauser         //  message pauser, should be used only in tests
+	onBreak         func(error)       // called with the errors the peer is dropped for, nil if not set
+	onPanic         func(*PanicError) // called with the panics of message handlers, nil to drop the peer
 }
 
 // NewPeer constructs a new peer
@@ -162,13 +173,23 @@ func NewPeer(peer *p2p.Peer, rw p2p.MsgReadWriter, spec *Spec) *Peer {
 		encode = encodeWithoutContext
 		decode = decodeWithoutContext
 	}
-	return &Peer{
+	p := &Peer{
 		Peer:   peer,
 		rw:     rw,
 		spec:   spec,
 		encode: encode,
 		decode: decode,
 	}
+	if h, ok := rw.(PanicHandler); ok {
+		p.onPanic = h.HandlePanic
+	}
+	return p
+}
+
+// SetBreakHandler sets the function called with the error of a message handler
+// breaking the protocol before the peer is dropped, it must be called before Run
+func (p *Peer) SetBreakHandler(f func(error)) {
+	p.onBreak = f
 }
 
 // Run starts the forever loop that handles incoming messages.
@@ -176,6 +197,10 @@ func NewPeer(peer *p2p.Peer, rw p2p.MsgReadWriter, spec *Spec) *Peer {
 // from the remote peer, a returned error causes the loop to exit
 // resulting in disconnection of the protocol
 func (p *Peer) Run(handler func(ctx context.Context, msg interface{}) error) error {
+	if b := p.spec.Bandwidth; b != nil {
+		b.addPeer(p.ID())
+		defer b.removePeer(p.ID())
+	}
 	if err := p.run(handler); err != nil && err != io.EOF {
 		return err
 	}
@@ -220,7 +245,18 @@ func (p *Peer) run(handler func(ctx context.Context, msg interface{}) error) err
 			err := p.handleMsg(msg, handler)
 			if err != nil {
 				var e *breakError
-				if errors.As(err, &e) {
+				var pe *PanicError
+				if errors.As(err, &pe) {
+					if p.onPanic != nil {
+						p.onPanic(pe)
+						return
+					}
+					log.Error("message handler panicked, dropping peer", "peer", p.ID(), "panic", pe.Value, "stack trace", string(pe.Stack))
+					p.Drop(err.Error())
+				} else if errors.As(err, &e) {
+					if p.onBreak != nil {
+						p.onBreak(err)
+					}
 					p.Drop(err.Error())
 				} else {
 					log.Trace(err.Error())
@@ -237,6 +273,13 @@ func (p *Peer) readMsg() (p2p.Msg, error) {
 			metrics.GetOrRegisterCounter("peer/readMsg/error", nil).Inc(1)
 			return msg, fmt.Errorf("peer.readMsg, err: %w", err)
 		}
+		return msg, err
+	}
+	// delaying the message delays the next read, slowing down the peer through the flow control of the connection
+	if b := p.spec.Bandwidth; b != nil {
+		if err := b.waitDownload(context.Background(), p.ID(), int(msg.Size)); err != nil {
+			return msg, err
+		}
 	}
 
 	return msg, err
@@ -290,6 +333,10 @@ func (p *Peer) Send(ctx context.Context, msg interface{}) error {
 		return fmt.Errorf("invalid message type %v ", code)
 	}
 
+	if stamper, ok := p.spec.Hook.(Stamper); ok {
+		stamper.Stamp(p, msg)
+	}
+
 	wmsg, size, err := p.encode(ctx, msg)
 	if err != nil {
 		return err
@@ -304,6 +351,21 @@ func (p *Peer) Send(ctx context.Context, msg interface{}) error {
 		size = len(r)
 	}
 
+	// record the message if it is captured
+	if c := capturing(p); c != nil {
+		payload, err := rlp.EncodeToBytes(msg)
+		if err != nil {
+			return err
+		}
+		c.record(p, false, code, msg, payload)
+	}
+
+	if b := p.spec.Bandwidth; b != nil {
+		if err := b.waitUpload(ctx, p.ID(), size); err != nil {
+			return err
+		}
+	}
+
 	// if the accounting hook is set, do accounting logic
 	if p.spec.Hook != nil {
 		// validate that this operation would succeed...
@@ -349,9 +411,15 @@ func (p *Peer) receive(handler func(ctx context.Context, msg interface{}) error)
 // * checks for out-of-range message codes,
 // * handles decoding with reflection,
 // * call handlers as callbacks
-func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg interface{}) error) error {
+func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg interface{}) error) (err error) {
 	// make sure that the payload has been fully consumed
 	defer msg.Discard()
+	// a panicking handler only fails the message
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
 
 	if msg.Size > p.spec.MaxMsgSize {
 		return Break(fmt.Errorf("message too long: %v > %v", msg.Size, p.spec.MaxMsgSize))
@@ -371,6 +439,10 @@ func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg inter
 		return Break(fmt.Errorf("invalid message (RLP error): <= %v: %w", msg, err))
 	}
 
+	if c := capturing(p); c != nil {
+		c.record(p, true, msg.Code, val, msgBytes)
+	}
+
 	// if the accounting hook is set, do accounting logic
 	if p.spec.Hook != nil {
 		size := uint32(len(msgBytes))
@@ -407,9 +479,10 @@ func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg inter
 
 // Handshake negotiates a handshake on the peer connection
 // * arguments
-//   * context
-//   * the local handshake to be sent to the remote peer
-//   * function to be called on the remote handshake (can be nil)
+//   - context
+//   - the local handshake to be sent to the remote peer
+//   - function to be called on the remote handshake (can be nil)
+//
 // * expects a remote handshake back of the same type
 // * the dialing peer needs to send the handshake first and then waits for remote
 // * the listening peer waits for the remote handshake and then sends it
@@ -446,6 +446,25 @@ func TestPeer_Receive(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("ERROR - handler panic", func(t *testing.T) {
+		rw := &dummyRW{}
+		peer := NewPeer(nil, rw, createTestSpec())
+		rw.msg = &struct {
+			Content string
+		}{
+			"test content",
+		}
+
+		handler := func(ctx context.Context, msg interface{}) error {
+			panic("test panic")
+		}
+
+		var pe *PanicError
+		if err := peer.receive(handler); !errors.As(err, &pe) || pe.Value != "test panic" {
+			t.Fatalf("expected the panic to be returned as error, got %v", err)
+		}
+	})
 }
 
 func TestPeer_Run(t *testing.T) {
@@ -0,0 +1,71 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pinservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// requestTimeout is the max time the API waits for the response of a provider
+var requestTimeout = 10 * time.Second
+
+// API is the RPC API of the pinning service
+type API struct {
+	s *PinService
+}
+
+// NewAPI creates the RPC API of the pinning service
+func NewAPI(s *PinService) *API {
+	return &API{s: s}
+}
+
+// Pin asks the provider peer to pin the content with the root address
+func (a *API) Pin(ctx context.Context, peer enode.ID, addr hexutil.Bytes, raw bool) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return a.s.Pin(ctx, peer, chunk.Address(addr), raw)
+}
+
+// Status returns the status of the content with the root address on the provider peer
+func (a *API) Status(ctx context.Context, peer enode.ID, addr hexutil.Bytes) (Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return a.s.Status(ctx, peer, chunk.Address(addr))
+}
+
+// Challenge asks the provider peer to prove that it stores the content with the root address.
+// It returns false if the provider fails the challenge.
+func (a *API) Challenge(ctx context.Context, peer enode.ID, addr hexutil.Bytes) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	err := a.s.Challenge(ctx, peer, chunk.Address(addr))
+	if errors.Is(err, ErrInvalidProof) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Providers returns the ids of the connected pinning providers
+func (a *API) Providers() []enode.ID {
+	return a.s.Providers()
+}
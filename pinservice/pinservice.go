@@ -0,0 +1,364 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pinservice implements a protocol by which nodes, typically light nodes,
+// ask pinning providers among their peers to pin content on their behalf, query
+// the status of the pins and challenge the providers to prove that they store
+// the pinned chunks.
+package pinservice
+
+import (
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// Status is the status of content pinned by a provider
+type Status uint8
+
+// Statuses of pinned content
+const (
+	StatusUnknown Status = iota // the provider was not asked to pin the content
+	StatusPinning               // the content is being fetched
+	StatusPinned                // all chunks of the content are pinned
+	StatusFailed                // the content could not be fetched or pinned
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPinning:
+		return "pinning"
+	case StatusPinned:
+		return "pinned"
+	case StatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+var (
+	// ErrPeerNotFound is returned for requests to peers that are not connected
+	ErrPeerNotFound = errors.New("peer not found")
+	// ErrNoProvider is returned for requests to peers that do not provide pinning
+	ErrNoProvider = errors.New("peer is not a pinning provider")
+	// ErrInvalidProof is returned if a provider fails a challenge
+	ErrInvalidProof = errors.New("invalid proof of storage")
+)
+
+// PinService implements node.Service
+var _ node.Service = &PinService{}
+
+// PinService handles the pinning service protocol. All nodes can request pins
+// from providers, nodes with a Provider serve the requests of their peers.
+type PinService struct {
+	fileStore   *storage.FileStore          // to retrieve chunks for challenges
+	provider    *Provider                   // pins content for peers, nil if the node is not a provider
+	peers       map[enode.ID]*Peer          // connected peers
+	peersMtx    sync.RWMutex                // protects peers
+	requests    map[uint64]chan interface{} // open requests by id, receiving the response
+	requestsMtx sync.Mutex                  // protects requests
+}
+
+// Peer is a peer connected with the pinning service protocol
+type Peer struct {
+	*protocols.Peer
+	provider bool // if the peer provides pinning
+}
+
+// New creates a PinService retrieving chunks with the file store. The provider
+// serves pin requests of peers, it can be nil for nodes that only request pins.
+func New(fileStore *storage.FileStore, provider *Provider) *PinService {
+	return &PinService{
+		fileStore: fileStore,
+		provider:  provider,
+		peers:     make(map[enode.ID]*Peer),
+		requests:  make(map[uint64]chan interface{}),
+	}
+}
+
+// Run is the protocol run function
+func (s *PinService) Run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := protocols.NewPeer(p, rw, Spec)
+	hs, err := peer.Handshake(context.TODO(), Handshake{Provider: s.provider != nil}, nil)
+	if err != nil {
+		return err
+	}
+	sp := &Peer{
+		Peer:     peer,
+		provider: hs.(*Handshake).Provider,
+	}
+
+	s.peersMtx.Lock()
+	s.peers[sp.ID()] = sp
+	s.peersMtx.Unlock()
+	defer func() {
+		s.peersMtx.Lock()
+		delete(s.peers, sp.ID())
+		s.peersMtx.Unlock()
+	}()
+
+	return peer.Run(s.handleMsg(sp))
+}
+
+// handleMsg returns the message handler for the peer
+func (s *PinService) handleMsg(p *Peer) func(context.Context, interface{}) error {
+	return func(ctx context.Context, msg interface{}) error {
+		switch msg := msg.(type) {
+		case *PinRequest:
+			return s.handlePinRequest(ctx, p, msg)
+		case *StatusRequest:
+			return s.handleStatusRequest(ctx, p, msg)
+		case *ChallengeRequest:
+			return s.handleChallengeRequest(ctx, p, msg)
+		case *PinResponse:
+			s.deliver(msg.ID, msg)
+		case *StatusResponse:
+			s.deliver(msg.ID, msg)
+		case *ChallengeResponse:
+			s.deliver(msg.ID, msg)
+		default:
+			return fmt.Errorf("unknown message type: %T", msg)
+		}
+		return nil
+	}
+}
+
+func (s *PinService) handlePinRequest(ctx context.Context, p *Peer, msg *PinRequest) error {
+	res := &PinResponse{ID: msg.ID}
+	if s.provider == nil {
+		res.Err = ErrNoProvider.Error()
+	} else {
+		log.Debug("pinservice: pin request", "peer", p.ID(), "root", msg.Addr)
+		s.provider.Pin(msg.Addr, msg.Raw)
+	}
+	return p.Send(ctx, res)
+}
+
+func (s *PinService) handleStatusRequest(ctx context.Context, p *Peer, msg *StatusRequest) error {
+	res := &StatusResponse{ID: msg.ID}
+	if s.provider == nil {
+		res.Err = ErrNoProvider.Error()
+	} else {
+		status, err := s.provider.Status(msg.Addr)
+		res.Status = status
+		if err != nil {
+			res.Err = err.Error()
+		}
+	}
+	return p.Send(ctx, res)
+}
+
+func (s *PinService) handleChallengeRequest(ctx context.Context, p *Peer, msg *ChallengeRequest) error {
+	res := &ChallengeResponse{ID: msg.ID}
+	if s.provider == nil {
+		res.Err = ErrNoProvider.Error()
+	} else {
+		proof, err := s.provider.Prove(ctx, msg.Root, msg.Addr, msg.Nonce)
+		res.Proof = proof
+		if err != nil {
+			res.Err = err.Error()
+		}
+	}
+	return p.Send(ctx, res)
+}
+
+// deliver passes a response to the open request with the id
+func (s *PinService) deliver(id uint64, msg interface{}) {
+	s.requestsMtx.Lock()
+	c, ok := s.requests[id]
+	s.requestsMtx.Unlock()
+	if !ok {
+		log.Debug("pinservice: response to unknown request", "id", id)
+		return
+	}
+	select {
+	case c <- msg:
+	default:
+	}
+}
+
+// request sends the message created with a new request id to the provider
+// and waits for the response
+func (s *PinService) request(ctx context.Context, peer enode.ID, newMsg func(id uint64) interface{}) (interface{}, error) {
+	s.peersMtx.RLock()
+	p, ok := s.peers[peer]
+	s.peersMtx.RUnlock()
+	if !ok {
+		return nil, ErrPeerNotFound
+	}
+	if !p.provider {
+		return nil, ErrNoProvider
+	}
+
+	id := rand.Uint64()
+	c := make(chan interface{}, 1)
+	s.requestsMtx.Lock()
+	s.requests[id] = c
+	s.requestsMtx.Unlock()
+	defer func() {
+		s.requestsMtx.Lock()
+		delete(s.requests, id)
+		s.requestsMtx.Unlock()
+	}()
+
+	if err := p.Send(ctx, newMsg(id)); err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-c:
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Pin asks the provider to pin the content with the root address.
+// The provider fetches the content in the background, use Status to follow it.
+func (s *PinService) Pin(ctx context.Context, peer enode.ID, addr chunk.Address, raw bool) error {
+	res, err := s.request(ctx, peer, func(id uint64) interface{} {
+		return &PinRequest{ID: id, Addr: addr, Raw: raw}
+	})
+	if err != nil {
+		return err
+	}
+	if e := res.(*PinResponse).Err; e != "" {
+		return errors.New(e)
+	}
+	return nil
+}
+
+// Status returns the status of the content with the root address on the provider
+func (s *PinService) Status(ctx context.Context, peer enode.ID, addr chunk.Address) (Status, error) {
+	res, err := s.request(ctx, peer, func(id uint64) interface{} {
+		return &StatusRequest{ID: id, Addr: addr}
+	})
+	if err != nil {
+		return StatusUnknown, err
+	}
+	r := res.(*StatusResponse)
+	if r.Err != "" {
+		return r.Status, errors.New(r.Err)
+	}
+	return r.Status, nil
+}
+
+// Challenge asks the provider to prove that it stores a randomly selected chunk of
+// the content with the root address. The chunk is retrieved to verify the proof.
+// It returns ErrInvalidProof if the provider fails the challenge.
+func (s *PinService) Challenge(ctx context.Context, peer enode.ID, root chunk.Address) error {
+	var refs []storage.Reference
+	err := s.fileStore.Walk(ctx, storage.Address(root), func(ref storage.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	addr := chunk.Address(refs[rand.Intn(len(refs))][:s.fileStore.HashSize()])
+	ch, err := s.fileStore.ChunkStore.Get(ctx, chunk.ModeGetRequest, addr)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 32)
+	if _, err := crand.Read(nonce); err != nil {
+		return err
+	}
+
+	res, err := s.request(ctx, peer, func(id uint64) interface{} {
+		return &ChallengeRequest{ID: id, Root: root, Addr: addr, Nonce: nonce}
+	})
+	if err != nil {
+		return err
+	}
+	r := res.(*ChallengeResponse)
+	if r.Err != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, r.Err)
+	}
+	if string(r.Proof) != string(proof(nonce, ch.Data())) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// Providers returns the ids of the connected peers that provide pinning
+func (s *PinService) Providers() []enode.ID {
+	s.peersMtx.RLock()
+	defer s.peersMtx.RUnlock()
+	var ids []enode.ID
+	for id, p := range s.peers {
+		if p.provider {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Protocols returns the p2p protocol
+func (s *PinService) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{
+			Name:    Spec.Name,
+			Version: Spec.Version,
+			Length:  Spec.Length(),
+			Run:     s.Run,
+		},
+	}
+}
+
+// APIs return APIs defined on the node service
+func (s *PinService) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "pinservice",
+			Version:   "1.0",
+			Service:   NewAPI(s),
+			Public:    false,
+		},
+	}
+}
+
+// Start starts the PinService node service
+func (s *PinService) Start(server *p2p.Server) error {
+	log.Info("pinservice starting...")
+	return nil
+}
+
+// Stop stops the PinService node service
+func (s *PinService) Stop() error {
+	log.Info("pinservice shutting down...")
+	if s.provider != nil {
+		s.provider.Close()
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pinservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// TestPinService tests that a client gets content pinned by a provider,
+// follows the status of the pin and challenges the provider to prove storage
+func TestPinService(t *testing.T) {
+	fileStore, provider, cleanup := newTestProvider(t)
+	defer cleanup()
+
+	providerService := New(fileStore, provider)
+	clientService := New(fileStore, nil)
+	providerID, clientID := enode.ID{1}, enode.ID{2}
+	disconnect := connect(t, providerService, providerID, clientService, clientID)
+	defer disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data := make([]byte, 3*chunk.DefaultSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the content is not pinned yet, so the provider fails the challenge
+	if err := clientService.Challenge(ctx, providerID, chunk.Address(addr)); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidProof, err)
+	}
+
+	if err := clientService.Pin(ctx, providerID, chunk.Address(addr), true); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		status, err := clientService.Status(ctx, providerID, chunk.Address(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == StatusPinned {
+			break
+		}
+		if status != StatusPinning {
+			t.Fatalf("expected status %v, got %v", StatusPinning, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := clientService.Challenge(ctx, providerID, chunk.Address(addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the client is not a provider
+	if providers := clientService.Providers(); len(providers) != 1 || providers[0] != providerID {
+		t.Fatalf("expected providers [%v], got %v", providerID, providers)
+	}
+	if providers := providerService.Providers(); len(providers) != 0 {
+		t.Fatalf("expected no providers, got %v", providers)
+	}
+	if err := providerService.Pin(ctx, clientID, chunk.Address(addr), true); err != ErrNoProvider {
+		t.Fatalf("expected error %v, got %v", ErrNoProvider, err)
+	}
+}
+
+// connect runs the protocol of the services over a message pipe
+func connect(t *testing.T, a *PinService, aID enode.ID, b *PinService, bID enode.ID) func() {
+	t.Helper()
+
+	aRW, bRW := p2p.MsgPipe()
+	go a.Run(p2p.NewPeer(bID, "b", nil), newBufferedRW(aRW))
+	go b.Run(p2p.NewPeer(aID, "a", nil), newBufferedRW(bRW))
+
+	// wait for the handshakes
+	for i := 0; i < 100; i++ {
+		a.peersMtx.RLock()
+		_, aOK := a.peers[bID]
+		a.peersMtx.RUnlock()
+		b.peersMtx.RLock()
+		_, bOK := b.peers[aID]
+		b.peersMtx.RUnlock()
+		if aOK && bOK {
+			return func() { aRW.Close() }
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for the handshakes")
+	return nil
+}
+
+// bufferedRW reads messages from the pipe in the background, so that both peers
+// can send their handshakes before receiving, as the peers are neither inbound
+// nor outbound on a message pipe
+type bufferedRW struct {
+	p2p.MsgReadWriter
+	msgs chan p2p.Msg
+	err  error
+}
+
+func newBufferedRW(rw p2p.MsgReadWriter) *bufferedRW {
+	b := &bufferedRW{
+		MsgReadWriter: rw,
+		msgs:          make(chan p2p.Msg, 100),
+	}
+	go func() {
+		defer close(b.msgs)
+		for {
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				b.err = err
+				return
+			}
+			data, err := ioutil.ReadAll(msg.Payload)
+			if err != nil {
+				b.err = err
+				return
+			}
+			msg.Payload = bytes.NewReader(data)
+			b.msgs <- msg
+		}
+	}()
+	return b
+}
+
+func (b *bufferedRW) ReadMsg() (p2p.Msg, error) {
+	msg, ok := <-b.msgs
+	if !ok {
+		return msg, b.err
+	}
+	return msg, nil
+}
+
+func newTestProvider(t *testing.T) (*storage.FileStore, *Provider, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "swarm-pinservice-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateStore, err := state.NewDBStore(filepath.Join(dir, "state-store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := localstore.New(filepath.Join(dir, "localstore"), make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := chunk.NewTags()
+	fileStore := storage.NewFileStore(db, db, storage.NewFileStoreParams(), tags)
+	feeds, err := feed.NewTestHandler(filepath.Join(dir, "feeds"), &feed.HandlerParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := api.NewAPI(fileStore, nil, nil, feeds.Handler, nil, tags)
+	pinAPI := pin.NewAPI(db, stateStore, nil, tags, a)
+	provider := NewProvider(a, fileStore, pinAPI, db)
+
+	return fileStore, provider, func() {
+		provider.Close()
+		feeds.Close()
+		db.Close()
+		stateStore.Close()
+		os.RemoveAll(dir)
+	}
+}
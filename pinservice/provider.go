@@ -0,0 +1,198 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pinservice
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/ethersphere/swarm/storage/pin"
+)
+
+// PinTimeout is the max time a provider spends on fetching the content of a pin request
+var PinTimeout = 30 * time.Minute
+
+var (
+	errNotPinned      = errors.New("content is not pinned")
+	errChunkNotPinned = errors.New("chunk is not pinned")
+)
+
+// Provider fetches and pins content on behalf of the peers of the node
+// and proves that it stores the pinned chunks
+type Provider struct {
+	api       *api.API
+	fileStore *storage.FileStore
+	pinAPI    *pin.API
+	db        *localstore.DB
+	mtx       sync.Mutex
+	pins      map[string]*pinState // state of the pins requested since startup by root address
+	quit      chan struct{}
+}
+
+// pinState is the state of a pin requested by a peer
+type pinState struct {
+	status Status
+	err    error
+}
+
+// NewProvider creates a Provider retrieving content with the file store and
+// pinning it with the pin API in the local store
+func NewProvider(a *api.API, fileStore *storage.FileStore, pinAPI *pin.API, db *localstore.DB) *Provider {
+	return &Provider{
+		api:       a,
+		fileStore: fileStore,
+		pinAPI:    pinAPI,
+		db:        db,
+		pins:      make(map[string]*pinState),
+		quit:      make(chan struct{}),
+	}
+}
+
+// Pin fetches all chunks of the content with the root address in the
+// background and pins them once they are stored locally
+func (p *Provider) Pin(addr chunk.Address, raw bool) {
+	key := addr.Hex()
+	p.mtx.Lock()
+	if s, ok := p.pins[key]; ok && s.status != StatusFailed {
+		p.mtx.Unlock()
+		return
+	}
+	p.pins[key] = &pinState{status: StatusPinning}
+	p.mtx.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), PinTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-p.quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		err := p.fetch(ctx, addr, raw)
+		if err == nil {
+			err = p.pinAPI.PinFiles(addr, raw, "")
+		}
+		state := &pinState{status: StatusPinned}
+		if err != nil {
+			log.Debug("pinservice: pin failed", "root", key, "err", err)
+			state = &pinState{status: StatusFailed, err: err}
+		} else {
+			log.Debug("pinservice: pinned", "root", key)
+		}
+		p.mtx.Lock()
+		p.pins[key] = state
+		p.mtx.Unlock()
+	}()
+}
+
+// Status returns the status of the content with the root address and the error
+// if pinning it failed
+func (p *Provider) Status(addr chunk.Address) (Status, error) {
+	p.mtx.Lock()
+	s, ok := p.pins[addr.Hex()]
+	p.mtx.Unlock()
+	if ok {
+		return s.status, s.err
+	}
+	// the content may have been pinned before startup or locally
+	pins, err := p.pinAPI.ListPins()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	for _, info := range pins {
+		if info.Address.Hex() == addr.Hex() {
+			return StatusPinned, nil
+		}
+	}
+	return StatusUnknown, nil
+}
+
+// Prove returns the proof that the chunk with the address of the content with
+// the root address is pinned: the Keccak256 hash of the nonce and the chunk data
+func (p *Provider) Prove(ctx context.Context, root, addr chunk.Address, nonce []byte) ([]byte, error) {
+	status, _ := p.Status(root)
+	if status != StatusPinned {
+		return nil, errNotPinned
+	}
+	if _, err := p.db.Get(ctx, chunk.ModeGetPin, addr); err != nil {
+		return nil, errChunkNotPinned
+	}
+	ch, err := p.db.Get(ctx, chunk.ModeGetLookup, addr)
+	if err != nil {
+		return nil, err
+	}
+	return proof(nonce, ch.Data()), nil
+}
+
+// Close aborts the pins in progress
+func (p *Provider) Close() {
+	close(p.quit)
+}
+
+// fetch retrieves all chunks of the content with the root address, including
+// the files referenced by the manifest if the content is not raw
+func (p *Provider) fetch(ctx context.Context, addr chunk.Address, raw bool) error {
+	// pinning is not interactive, so do not compete with downloads for retrievals
+	ctx = sctx.SetBackground(ctx)
+	refs := []storage.Address{storage.Address(addr)}
+	if !raw {
+		walker, err := p.api.NewManifestWalker(ctx, storage.Address(addr), p.api.Decryptor(ctx, ""), nil)
+		if err != nil {
+			return err
+		}
+		err = walker.Walk(func(entry *api.ManifestEntry) error {
+			ref, err := hex.DecodeString(entry.Hash)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, ref)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	hashSize := p.fileStore.HashSize()
+	for _, ref := range refs {
+		err := p.fileStore.Walk(ctx, ref, func(r storage.Reference) error {
+			_, err := p.fileStore.ChunkStore.Get(ctx, chunk.ModeGetRequest, storage.Address(r[:hashSize]))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proof computes the proof of storage of the chunk data for the nonce
+func proof(nonce, data []byte) []byte {
+	return crypto.Keccak256(nonce, data)
+}
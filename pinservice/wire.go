@@ -0,0 +1,84 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pinservice
+
+import (
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// Spec is the protocol spec for the pinning service
+var Spec = &protocols.Spec{
+	Name:       "pinservice",
+	Version:    1,
+	MaxMsgSize: 10 * 1024,
+	Messages: []interface{}{
+		Handshake{},
+		PinRequest{},
+		PinResponse{},
+		StatusRequest{},
+		StatusResponse{},
+		ChallengeRequest{},
+		ChallengeResponse{},
+	},
+}
+
+// Handshake is exchanged when peers connect
+type Handshake struct {
+	Provider bool // indicates if the node pins content on behalf of its peers
+}
+
+// PinRequest asks a provider to pin the content with the root address
+type PinRequest struct {
+	ID   uint64        // request id
+	Addr chunk.Address // root address of the content
+	Raw  bool          // true if the content is a raw file, false for a manifest
+}
+
+// PinResponse is sent by the provider when a pin request is accepted or rejected
+type PinResponse struct {
+	ID  uint64 // request id
+	Err string // reason of rejection, empty if accepted
+}
+
+// StatusRequest asks a provider for the status of the pinned content with the root address
+type StatusRequest struct {
+	ID   uint64        // request id
+	Addr chunk.Address // root address of the content
+}
+
+// StatusResponse is the response to a StatusRequest
+type StatusResponse struct {
+	ID     uint64 // request id
+	Status Status // status of the content
+	Err    string // error of the failed pin, if any
+}
+
+// ChallengeRequest asks a provider to prove that it stores a chunk of pinned content
+type ChallengeRequest struct {
+	ID    uint64        // request id
+	Root  chunk.Address // root address of the pinned content
+	Addr  chunk.Address // address of the challenged chunk
+	Nonce []byte        // random nonce that the proof must commit to
+}
+
+// ChallengeResponse carries the proof of storage for a ChallengeRequest
+type ChallengeResponse struct {
+	ID    uint64 // request id
+	Proof []byte // Keccak256 hash of the nonce and the chunk data
+	Err   string // reason if no proof can be given
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package postage
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Textual version number of postage API
+const APIVersion = "1.0"
+
+// API provides the issuance of postage batches over RPC
+type API struct {
+	issuer *Issuer
+}
+
+// NewAPI creates a new API
+func NewAPI(issuer *Issuer) *API {
+	return &API{
+		issuer: issuer,
+	}
+}
+
+// CreateBatch issues a new batch of capacity chunks, valid for ttl seconds or without expiry if ttl is 0
+func (a *API) CreateBatch(capacity uint64, ttl uint64) (*Batch, error) {
+	return a.issuer.CreateBatch(capacity, time.Duration(ttl)*time.Second)
+}
+
+// Batch returns the batch with the id
+func (a *API) Batch(id common.Hash) (*Batch, error) {
+	return a.issuer.batches.Get(id)
+}
+
+// Batches returns all locally issued batches
+func (a *API) Batches() ([]*Batch, error) {
+	return a.issuer.batches.Batches()
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package postage
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/state"
+)
+
+// key prefix of the batches in the state store
+const batchKeyPrefix = "postage_batch_"
+
+// Batch is a prepaid amount of chunks that can be stamped by its owner
+type Batch struct {
+	ID       common.Hash    // batch identifier
+	Owner    common.Address // address of the key signing the stamps
+	Capacity uint64         // number of chunks that can be stamped
+	Issued   uint64         // number of chunks stamped, known only to the owner
+	Expiry   int64          // unix time after which the stamps are invalid, 0 for no expiry
+}
+
+// Expired reports if the stamps of the batch are no longer valid
+func (b *Batch) Expired() bool {
+	return b.Expiry != 0 && time.Now().Unix() > b.Expiry
+}
+
+// BatchStore gives access to the batches stamps are validated against
+type BatchStore interface {
+	Get(id common.Hash) (*Batch, error)
+}
+
+// LocalBatchStore is a BatchStore of batches issued locally, persisted in a state store
+type LocalBatchStore struct {
+	store state.Store
+	lock  sync.Mutex // serialises the updates of the issued counts
+}
+
+// NewLocalBatchStore creates a new LocalBatchStore
+func NewLocalBatchStore(store state.Store) *LocalBatchStore {
+	return &LocalBatchStore{
+		store: store,
+	}
+}
+
+// Get returns the batch with the id
+func (s *LocalBatchStore) Get(id common.Hash) (*Batch, error) {
+	var b Batch
+	err := s.store.Get(batchKeyPrefix+id.Hex(), &b)
+	if err == state.ErrNotFound {
+		return nil, ErrUnknownBatch
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Put saves the batch
+func (s *LocalBatchStore) Put(b *Batch) error {
+	return s.store.Put(batchKeyPrefix+b.ID.Hex(), b)
+}
+
+// Batches returns all batches
+func (s *LocalBatchStore) Batches() (batches []*Batch, err error) {
+	err = s.store.Iterate(batchKeyPrefix, func(key, value []byte) (bool, error) {
+		if !strings.HasPrefix(string(key), batchKeyPrefix) {
+			return true, nil
+		}
+		var b Batch
+		if err := json.Unmarshal(value, &b); err != nil {
+			return true, err
+		}
+		batches = append(batches, &b)
+		return false, nil
+	})
+	return batches, err
+}
+
+// Issuer issues batches owned by the local key and stamps chunks with them
+type Issuer struct {
+	key     *ecdsa.PrivateKey
+	batches *LocalBatchStore
+}
+
+// NewIssuer creates a new Issuer
+func NewIssuer(key *ecdsa.PrivateKey, batches *LocalBatchStore) *Issuer {
+	return &Issuer{
+		key:     key,
+		batches: batches,
+	}
+}
+
+// Owner returns the address of the owner of the issued batches
+func (i *Issuer) Owner() common.Address {
+	return crypto.PubkeyToAddress(i.key.PublicKey)
+}
+
+// CreateBatch issues a new batch of the given capacity, valid for ttl or without expiry if ttl is 0
+func (i *Issuer) CreateBatch(capacity uint64, ttl time.Duration) (*Batch, error) {
+	b := &Batch{
+		Owner:    i.Owner(),
+		Capacity: capacity,
+	}
+	if _, err := rand.Read(b.ID[:]); err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		b.Expiry = time.Now().Add(ttl).Unix()
+	}
+	if err := i.batches.Put(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Stamp stamps the chunk address with the batch, using up one unit of its capacity
+func (i *Issuer) Stamp(batchID common.Hash, addr chunk.Address) (*Stamp, error) {
+	i.batches.lock.Lock()
+	defer i.batches.lock.Unlock()
+
+	b, err := i.batches.Get(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if b.Owner != i.Owner() {
+		return nil, ErrUnknownBatch
+	}
+	if b.Expired() {
+		return nil, ErrBatchExpired
+	}
+	if b.Issued >= b.Capacity {
+		return nil, ErrBatchFull
+	}
+	s, err := NewStamp(func(digest []byte) ([]byte, error) {
+		return crypto.Sign(digest, i.key)
+	}, batchID, addr)
+	if err != nil {
+		return nil, err
+	}
+	b.Issued++
+	if err := i.batches.Put(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
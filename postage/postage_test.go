@@ -0,0 +1,178 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package postage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage/localstore"
+)
+
+// TestIssueAndValidate tests that stamps issued with a batch are validated
+// and that the capacity and the expiry of the batch are enforced
+func TestIssueAndValidate(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := NewLocalBatchStore(state.NewInmemoryStore())
+	issuer := NewIssuer(key, batches)
+	validator := NewValidator(batches, nil, true)
+
+	b, err := issuer.CreateBatch(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := chunk.NewChunk(make([]byte, 32), []byte("data"))
+	if err := validator.ValidateStamp(ch); err != ErrStampRequired {
+		t.Fatalf("expected error %v, got %v", ErrStampRequired, err)
+	}
+
+	stamp, err := issuer.Stamp(b.ID, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := stamp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.ValidateStamp(ch.WithStamp(enc)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stamp is not valid for another chunk
+	other := chunk.NewChunk(common.Hash{1}.Bytes(), []byte("data")).WithStamp(enc)
+	if err := validator.ValidateStamp(other); err != ErrInvalidStamp {
+		t.Fatalf("expected error %v, got %v", ErrInvalidStamp, err)
+	}
+
+	if _, err := issuer.Stamp(b.ID, other.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Stamp(b.ID, other.Address()); err != ErrBatchFull {
+		t.Fatalf("expected error %v, got %v", ErrBatchFull, err)
+	}
+
+	// stamps of an expired batch are invalid
+	b, err = batches.Get(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Issued != 2 {
+		t.Fatalf("expected 2 issued stamps, got %d", b.Issued)
+	}
+	b.Expiry = time.Now().Add(-time.Minute).Unix()
+	if err := batches.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.ValidateStamp(ch.WithStamp(enc)); err != ErrBatchExpired {
+		t.Fatalf("expected error %v, got %v", ErrBatchExpired, err)
+	}
+}
+
+// TestTrustedIssuers tests that stamps of unknown batches are only accepted from trusted issuers
+func TestTrustedIssuers(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := NewIssuer(key, NewLocalBatchStore(state.NewInmemoryStore()))
+	b, err := issuer.CreateBatch(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := chunk.NewChunk(make([]byte, 32), []byte("data"))
+	stamp, err := issuer.Stamp(b.ID, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := stamp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch = ch.WithStamp(enc)
+
+	batches := NewLocalBatchStore(state.NewInmemoryStore())
+	if err := NewValidator(batches, nil, false).ValidateStamp(ch); err != ErrUnknownBatch {
+		t.Fatalf("expected error %v, got %v", ErrUnknownBatch, err)
+	}
+	if err := NewValidator(batches, []common.Address{issuer.Owner()}, false).ValidateStamp(ch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStampingStore tests that chunks uploaded with a batch in the context are stamped
+func TestStampingStore(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := NewLocalBatchStore(state.NewInmemoryStore())
+	issuer := NewIssuer(key, batches)
+	b, err := issuer.CreateBatch(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "postage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewStampingStore(db, issuer)
+
+	stamped := chunk.NewChunk(common.Hash{1}.Bytes(), []byte("stamped"))
+	ctx := sctx.SetPostageBatch(context.Background(), b.ID.Bytes())
+	if _, err := store.Put(ctx, chunk.ModePutUpload, stamped); err != nil {
+		t.Fatal(err)
+	}
+	unstamped := chunk.NewChunk(common.Hash{2}.Bytes(), []byte("unstamped"))
+	if _, err := store.Put(context.Background(), chunk.ModePutUpload, unstamped); err != nil {
+		t.Fatal(err)
+	}
+
+	validator := NewValidator(batches, nil, true)
+	ch, err := db.Get(context.Background(), chunk.ModeGetRequest, stamped.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.ValidateStamp(ch); err != nil {
+		t.Fatal(err)
+	}
+	ch, err = db.Get(context.Background(), chunk.ModeGetRequest, unstamped.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Stamp() != nil {
+		t.Fatalf("expected no stamp, got %x", ch.Stamp())
+	}
+}
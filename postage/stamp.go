@@ -0,0 +1,100 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package postage implements postage stamps, the admission layer of chunks:
+// uploaded chunks are stamped with prepaid batches, and storers validate
+// the stamps of chunks before accepting them from the network.
+//
+// Batches are either issued locally, which is meant for private networks where
+// the stamps of trusted issuers are accepted, or backed by a contract, in which
+// case the BatchStore needs to be implemented by a contract backend.
+package postage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// lengths of the stamp encoding
+const (
+	signatureLength = 65 // secp256k1 signature with recovery id
+	StampSize       = common.HashLength + signatureLength
+)
+
+// errors of stamp validation
+var (
+	ErrInvalidStamp  = errors.New("invalid postage stamp")
+	ErrStampRequired = errors.New("postage stamp required")
+	ErrUnknownBatch  = errors.New("unknown postage batch")
+	ErrBatchExpired  = errors.New("postage batch expired")
+	ErrBatchFull     = errors.New("postage batch capacity reached")
+)
+
+// Stamp proves that the storage of a chunk is paid for by a batch
+type Stamp struct {
+	BatchID common.Hash // batch the chunk is stamped with
+	Sig     []byte      // signature of the chunk address and the batch by the owner of the batch
+}
+
+// NewStamp signs the chunk address with the batch owner's key
+func NewStamp(sign func([]byte) ([]byte, error), batchID common.Hash, addr chunk.Address) (*Stamp, error) {
+	sig, err := sign(stampDigest(batchID, addr))
+	if err != nil {
+		return nil, err
+	}
+	return &Stamp{
+		BatchID: batchID,
+		Sig:     sig,
+	}, nil
+}
+
+// stampDigest is the signed digest of a stamp
+func stampDigest(batchID common.Hash, addr chunk.Address) []byte {
+	return crypto.Keccak256(addr, batchID[:])
+}
+
+// Owner recovers the address of the batch owner who signed the stamp of the chunk
+func (s *Stamp) Owner(addr chunk.Address) (common.Address, error) {
+	pub, err := crypto.SigToPub(stampDigest(s.BatchID, addr), s.Sig)
+	if err != nil {
+		return common.Address{}, ErrInvalidStamp
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// MarshalBinary encodes the stamp as the batch id followed by the signature
+func (s *Stamp) MarshalBinary() ([]byte, error) {
+	if len(s.Sig) != signatureLength {
+		return nil, ErrInvalidStamp
+	}
+	b := make([]byte, 0, StampSize)
+	b = append(b, s.BatchID[:]...)
+	return append(b, s.Sig...), nil
+}
+
+// UnmarshalBinary decodes the stamp from its binary encoding
+func (s *Stamp) UnmarshalBinary(b []byte) error {
+	if len(b) != StampSize {
+		return fmt.Errorf("%w: length %d", ErrInvalidStamp, len(b))
+	}
+	copy(s.BatchID[:], b[:common.HashLength])
+	s.Sig = append([]byte(nil), b[common.HashLength:]...)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package postage
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+)
+
+// StampingStore stamps the chunks put with the postage batch set in the context
+// using the issuer. Chunks put with a context without a batch are not stamped.
+type StampingStore struct {
+	chunk.Store
+	issuer *Issuer
+}
+
+// NewStampingStore creates a new StampingStore
+func NewStampingStore(store chunk.Store, issuer *Issuer) *StampingStore {
+	return &StampingStore{
+		Store:  store,
+		issuer: issuer,
+	}
+}
+
+// Put stamps the chunks if the context has a batch and puts them to the store
+func (s *StampingStore) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err error) {
+	batchID := sctx.GetPostageBatch(ctx)
+	if batchID == nil {
+		return s.Store.Put(ctx, mode, chs...)
+	}
+	for i, ch := range chs {
+		stamp, err := s.issuer.Stamp(common.BytesToHash(batchID), ch.Address())
+		if err != nil {
+			return nil, err
+		}
+		b, err := stamp.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		chs[i] = ch.WithStamp(b)
+	}
+	return s.Store.Put(ctx, mode, chs...)
+}
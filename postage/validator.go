@@ -0,0 +1,90 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package postage
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// Validator validates the stamps of chunks against batches.
+// It implements chunk.StampValidator.
+type Validator struct {
+	batches  BatchStore
+	issuers  map[common.Address]bool // owners whose stamps are accepted without a known batch
+	required bool                    // whether chunks without stamps are rejected
+}
+
+// NewValidator creates a new Validator. Stamps of unknown batches are accepted
+// if they are signed by one of the trusted issuers, as in private networks
+// batches are not shared between nodes. If required is false, chunks without
+// stamps are accepted, but garbage collected before the stamped ones.
+func NewValidator(batches BatchStore, issuers []common.Address, required bool) *Validator {
+	v := &Validator{
+		batches:  batches,
+		issuers:  make(map[common.Address]bool),
+		required: required,
+	}
+	for _, issuer := range issuers {
+		v.issuers[issuer] = true
+	}
+	return v
+}
+
+// ValidateStamp validates the stamp of the chunk
+func (v *Validator) ValidateStamp(ch chunk.Chunk) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.GetOrRegisterCounter("postage/validate/invalid", nil).Inc(1)
+		}
+	}()
+
+	if ch.Stamp() == nil {
+		if v.required {
+			return ErrStampRequired
+		}
+		metrics.GetOrRegisterCounter("postage/validate/unstamped", nil).Inc(1)
+		return nil
+	}
+	var s Stamp
+	if err := s.UnmarshalBinary(ch.Stamp()); err != nil {
+		return err
+	}
+	owner, err := s.Owner(ch.Address())
+	if err != nil {
+		return err
+	}
+	b, err := v.batches.Get(s.BatchID)
+	switch err {
+	case nil:
+		if b.Owner != owner {
+			return ErrInvalidStamp
+		}
+		if b.Expired() {
+			return ErrBatchExpired
+		}
+	case ErrUnknownBatch:
+		if !v.issuers[owner] {
+			return ErrUnknownBatch
+		}
+	default:
+		return err
+	}
+	metrics.GetOrRegisterCounter("postage/validate/valid", nil).Inc(1)
+	return nil
+}
@@ -21,11 +21,13 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/subscription"
 )
 
 // Wrapper for receiving pss messages when using the pss API
@@ -51,13 +53,24 @@ func NewAPI(ps *Pss) *API {
 //
 // All incoming messages to the node matching this topic will be encapsulated in the APIMsg
 // struct and sent to the subscriber
-func (pssapi *API) Receive(ctx context.Context, topic message.Topic, raw bool, prox bool) (*rpc.Subscription, error) {
+//
+// The optional opts select the buffering of the messages for slow subscribers, by
+// default the handling of the messages of the topic pauses while the buffer is full
+func (pssapi *API) Receive(ctx context.Context, topic message.Topic, raw bool, prox bool, opts *subscription.Options) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return nil, fmt.Errorf("Subscribe not supported")
 	}
 
+	if err := pssapi.checkTopic(topic); err != nil {
+		return nil, err
+	}
+
 	psssub := notifier.CreateSubscription()
+	n, err := subscription.New(notifier, psssub, opts, subscription.Pause)
+	if err != nil {
+		return nil, err
+	}
 
 	hndlr := NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
 		apimsg := &APIMsg{
@@ -65,7 +78,7 @@ func (pssapi *API) Receive(ctx context.Context, topic message.Topic, raw bool, p
 			Asymmetric: asymmetric,
 			Key:        keyid,
 		}
-		if err := notifier.Notify(psssub.ID, apimsg); err != nil {
+		if err := n.Notify(apimsg); err != nil {
 			log.Warn(fmt.Sprintf("notification on pss sub topic rpc (sub %v) msg %v failed!", psssub.ID, msg))
 		}
 		return nil
@@ -80,12 +93,8 @@ func (pssapi *API) Receive(ctx context.Context, topic message.Topic, raw bool, p
 	deregf := pssapi.Register(&topic, hndlr)
 	go func() {
 		defer deregf()
-		select {
-		case err := <-psssub.Err():
-			log.Warn(fmt.Sprintf("caught subscription error in pss sub topic %x: %v", topic, err))
-		case <-notifier.Closed():
-			log.Warn("rpc sub notifier closed")
-		}
+		<-n.Closed()
+		log.Debug(fmt.Sprintf("pss sub topic %x closed, %d messages dropped", topic, n.Dropped()))
 	}()
 
 	return psssub, nil
@@ -160,6 +169,9 @@ func (pssapi *API) SendAsym(pubkeyhex string, topic message.Topic, msg hexutil.B
 	if err := validateMsg(msg); err != nil {
 		return err
 	}
+	if err := pssapi.checkTopic(topic); err != nil {
+		return err
+	}
 	return pssapi.Pss.SendAsym(pubkeyhex, topic, msg[:])
 }
 
@@ -167,6 +179,9 @@ func (pssapi *API) SendSym(symkeyhex string, topic message.Topic, msg hexutil.By
 	if err := validateMsg(msg); err != nil {
 		return err
 	}
+	if err := pssapi.checkTopic(topic); err != nil {
+		return err
+	}
 	return pssapi.Pss.SendSym(symkeyhex, topic, msg[:])
 }
 
@@ -174,9 +189,48 @@ func (pssapi *API) SendRaw(addr hexutil.Bytes, topic message.Topic, msg hexutil.
 	if err := validateMsg(msg); err != nil {
 		return err
 	}
+	if err := pssapi.checkTopic(topic); err != nil {
+		return err
+	}
 	return pssapi.Pss.SendRaw(PssAddress(addr), topic, msg[:], pssapi.Pss.msgTTL)
 }
 
+// SendRawExt sends a raw message like SendRaw, with the hop limit, the time to live and
+// the caching by relays of the message set by the optional opts
+func (pssapi *API) SendRawExt(addr hexutil.Bytes, topic message.Topic, msg hexutil.Bytes, opts *SendRawOptions) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	if err := pssapi.checkTopic(topic); err != nil {
+		return err
+	}
+	return pssapi.Pss.SendRawExt(PssAddress(addr), topic, msg[:], opts)
+}
+
+// Broadcast sends the message to all nodes within the proximity order po of the target
+// address, encrypted with the symmetric key if symkeyid is given and raw otherwise
+func (pssapi *API) Broadcast(target hexutil.Bytes, po int, topic message.Topic, msg hexutil.Bytes, symkeyid string) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	if err := pssapi.checkTopic(topic); err != nil {
+		return err
+	}
+	return pssapi.Pss.Broadcast(PssAddress(target), po, topic, msg[:], symkeyid)
+}
+
+// Ping probes whether the peer with the public key is reachable through the address hint,
+// returning the round trip time and the estimated hops to and from the peer
+func (pssapi *API) Ping(ctx context.Context, pubkey hexutil.Bytes, addr PssAddress) (*PingResult, error) {
+	return pssapi.Pss.Ping(ctx, common.ToHex(pubkey), addr)
+}
+
+// GetCacheStats returns the statistics of the cache of message digests
+// that suppresses duplicate messages
+func (pssapi *API) GetCacheStats() *CacheStats {
+	return pssapi.cacheStats()
+}
+
 func (pssapi *API) GetPeerTopics(pubkeyhex string) ([]message.Topic, error) {
 	topics, _, err := pssapi.Pss.GetPublickeyPeers(pubkeyhex)
 	return topics, err
@@ -187,6 +241,33 @@ func (pssapi *API) GetPeerAddress(pubkeyhex string, topic message.Topic) (PssAdd
 	return pssapi.Pss.getPeerAddress(pubkeyhex, topic)
 }
 
+// SetTopicPolicy sets the inbound policy of the topic to open, known-keys or handshake
+func (pssapi *API) SetTopicPolicy(topic message.Topic, policy TopicPolicy) error {
+	return pssapi.Pss.SetTopicPolicy(topic, policy)
+}
+
+// GetTopicPolicy returns the inbound policy of the topic
+func (pssapi *API) GetTopicPolicy(topic message.Topic) TopicPolicy {
+	return pssapi.Pss.GetTopicPolicy(topic)
+}
+
+// GetTopicPolicies returns the inbound policies of the topics that are not open, by hex encoded topic
+func (pssapi *API) GetTopicPolicies() map[string]TopicPolicy {
+	policies := make(map[string]TopicPolicy)
+	for topic, policy := range pssapi.Pss.GetTopicPolicies() {
+		policies[topic.String()] = policy
+	}
+	return policies
+}
+
+// checkTopic returns an error if rpc clients are not allowed to use the topic
+func (pssapi *API) checkTopic(topic message.Topic) error {
+	if pssapi.Pss.topicBlocked != nil && pssapi.Pss.topicBlocked(topic) {
+		return fmt.Errorf("topic %s is blocked", topic.String())
+	}
+	return nil
+}
+
 func validateMsg(msg []byte) error {
 	if len(msg) == 0 {
 		return errors.New("invalid message length")
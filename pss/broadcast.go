@@ -0,0 +1,151 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// broadcastTopic is the topic of the envelopes of area broadcasts, see Broadcast
+var broadcastTopic = message.NewTopic([]byte("pss:broadcast"))
+
+// broadcastMsg is the envelope of a message broadcast to all nodes within a proximity
+// order of a target address. It is not encrypted so that relays can keep the message
+// within the area, the payload it carries is raw or symmetrically encrypted as the
+// flags of the message say
+type broadcastMsg struct {
+	Target  []byte // leftmost bytes of the target address covering the proximity order
+	PO      uint
+	Topic   message.Topic
+	Payload []byte
+}
+
+// Broadcast sends a message to all nodes whose address shares at least po leftmost bits
+// with the target address, which lets applications announce services to an area of the
+// network. Nodes relay the message within the area, and drop the copies they have
+// already seen.
+//
+// The message is encrypted with the symmetric key if symkeyid is given, and sent raw
+// otherwise. Recipients receive it on the topic like any other message.
+func (p *Pss) Broadcast(target PssAddress, po int, topic message.Topic, msg []byte, symkeyid string) error {
+	defer metrics.GetOrRegisterResettingTimer("pss/broadcast", nil).UpdateSince(time.Now())
+
+	if err := validateAddress(target); err != nil {
+		return err
+	}
+	if po < 0 || po > len(target)*8 {
+		return fmt.Errorf("proximity order %d out of range of a %d byte target address", po, len(target))
+	}
+	flags := message.Flags{
+		Raw: true,
+	}
+	payload := msg
+	if symkeyid != "" {
+		symkey, err := p.GetSymmetricKey(symkeyid)
+		if err != nil {
+			return fmt.Errorf("missing valid send symkey %s: %v", symkeyid, err)
+		}
+		payload, err = p.wrap(msg, false, symkey)
+		if err != nil {
+			return err
+		}
+		flags = message.Flags{
+			Symmetric: true,
+		}
+	}
+	envelope, err := rlp.EncodeToBytes(&broadcastMsg{
+		Target:  target[:(po+7)/8],
+		PO:      uint(po),
+		Topic:   topic,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	// nodes not aware of broadcasts still flood the message to all nodes
+	// matching the whole bytes of the target address
+	pssMsg := message.New(flags)
+	pssMsg.To = target[:po/8]
+	pssMsg.Expire = uint32(time.Now().Add(p.msgTTL).Unix())
+	pssMsg.Payload = envelope
+	pssMsg.Topic = broadcastTopic
+
+	p.addFwdCache(pssMsg)
+	p.enqueue(pssMsg)
+	return nil
+}
+
+// processBroadcast relays a broadcast within its area, and passes the message it carries
+// to the handlers of its topic if the node is within the area
+func (p *Pss) processBroadcast(pssmsg *message.Message) error {
+	msg, err := decodeBroadcast(pssmsg)
+	if err != nil {
+		return err
+	}
+	if len(pssmsg.To) < addressLength {
+		p.relay(pssmsg)
+	}
+	if po, _ := network.Pof(p.BaseAddr(), broadcastTarget(msg), 0); po < int(msg.PO) {
+		return nil
+	}
+	metrics.GetOrRegisterCounter("pss/broadcast/received", nil).Inc(1)
+
+	raw := pssmsg.Flags.Raw
+	if raw {
+		if r, ok := p.isRawTopicHandlerCaps(msg.Topic); ok && !r {
+			return nil
+		}
+	}
+	// the carried message is addressed to the node so that it is not relayed again
+	inner := message.New(pssmsg.Flags)
+	inner.To = p.BaseAddr()
+	inner.Expire = pssmsg.Expire
+	inner.Topic = msg.Topic
+	inner.Payload = msg.Payload
+	if err := p.process(inner, raw, false); err != nil {
+		log.Trace("pss broadcast not processed", "topic", label(msg.Topic[:]), "err", err)
+	}
+	return nil
+}
+
+// decodeBroadcast returns the envelope of a broadcast message
+func decodeBroadcast(pssmsg *message.Message) (*broadcastMsg, error) {
+	var msg broadcastMsg
+	if err := rlp.DecodeBytes(pssmsg.Payload, &msg); err != nil {
+		return nil, fmt.Errorf("invalid broadcast: %v", err)
+	}
+	if int(msg.PO) > addressLength*8 || len(msg.Target) < (int(msg.PO)+7)/8 || len(msg.Target) > addressLength {
+		return nil, errors.New("invalid broadcast target")
+	}
+	return &msg, nil
+}
+
+// broadcastTarget returns the target address of the broadcast padded to full length
+func broadcastTarget(msg *broadcastMsg) []byte {
+	target := make([]byte, addressLength)
+	copy(target, msg.Target)
+	return target
+}
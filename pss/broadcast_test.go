@@ -0,0 +1,120 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// TestBroadcast tests that broadcasts reach the nodes within their area once,
+// and no nodes outside of it
+func TestBroadcast(t *testing.T) {
+	var nodes [3]*Pss
+	for i := range nodes {
+		key, err := ethCrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = newTestPssStart(key, nil, nil, false)
+		if nodes[i] == nil {
+			t.Fatal("could not create pss")
+		}
+		defer nodes[i].outbox.Stop()
+	}
+	a, b, c := nodes[0], nodes[1], nodes[2]
+
+	topic := message.NewTopic([]byte("broadcast"))
+	bC := make(chan []byte, 10)
+	cC := make(chan []byte, 10)
+	for n, msgC := range map[*Pss]chan []byte{b: bC, c: cC} {
+		msgC := msgC
+		n.Register(&topic, NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
+			msgC <- msg
+			return nil
+		}).WithRaw())
+	}
+
+	// a sends the messages to both other nodes, and to b twice
+	a.outbox.SetForward(func(msg *message.Message) error {
+		go func() {
+			for _, n := range []*Pss{b, b, c} {
+				n.handlePssMsg(context.Background(), msg)
+			}
+		}()
+		return nil
+	})
+	for _, n := range []*Pss{b, c} {
+		n.outbox.SetForward(func(msg *message.Message) error {
+			return nil
+		})
+	}
+	for _, n := range nodes {
+		n.outbox.Start()
+	}
+
+	// the area includes b but not c
+	po, _ := network.Pof(b.BaseAddr(), c.BaseAddr(), 0)
+	target := b.BaseAddr()
+	po++
+
+	symkeyid, err := b.GenerateSymmetricKey(topic, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symkey, err := b.GetSymmetricKey(symkeyid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendkeyid, err := a.SetSymmetricKey(symkey, topic, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keyid := range []string{"", sendkeyid} {
+		payload := []byte("announcement " + keyid)
+		if err := a.Broadcast(target, po, topic, payload, keyid); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-bC:
+			if !bytes.Equal(msg, payload) {
+				t.Fatalf("got message %x, want %x", msg, payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("broadcast not received within the area")
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(bC) != 0 {
+		t.Fatalf("got %d duplicate messages", len(bC))
+	}
+	if len(cC) != 0 {
+		t.Fatalf("got %d messages outside of the area", len(cC))
+	}
+
+	if err := a.Broadcast(target[:1], 9, topic, []byte("x"), ""); err == nil {
+		t.Fatal("expected error for proximity order beyond the target address")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+// key of the digests of the forward cache in the state store
+const fwdCacheStoreKey = "pss_fwdcache"
+
+// fwdCacheEntry is a persisted digest of the forward cache
+type fwdCacheEntry struct {
+	Digest  hexutil.Bytes
+	Expires time.Time
+}
+
+// CacheStats are the statistics of the cache of message digests that suppresses
+// the processing and forwarding of duplicate messages
+type CacheStats struct {
+	Size      int           // number of digests in the cache
+	Capacity  int           // maximum number of digests, 0 for no limit
+	TTL       time.Duration // time the digests are kept
+	Hits      uint64        // number of duplicate messages suppressed
+	Misses    uint64        // number of messages not found in the cache
+	Evictions uint64        // number of digests evicted before expiring to keep within the capacity
+}
+
+// SetCacheStore sets the store the digests of the forward cache are persisted in and loads
+// the digests persisted before, so that messages seen shortly before a restart are not
+// processed or forwarded again. It must be called before the pss node service is started
+func (p *Pss) SetCacheStore(store state.Store) error {
+	p.cacheStore = store
+	var entries []fwdCacheEntry
+	if err := store.Get(fwdCacheStoreKey, &entries); err != nil {
+		if err == state.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		var digest message.Digest
+		if len(e.Digest) != len(digest) {
+			continue
+		}
+		copy(digest[:], e.Digest)
+		if err := p.forwardCache.AddUntil(digest, e.Expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveFwdCache persists the digests of the forward cache, if a store is set
+func (p *Pss) saveFwdCache() error {
+	if p.cacheStore == nil {
+		return nil
+	}
+	var entries []fwdCacheEntry
+	p.forwardCache.Range(func(key interface{}, expiresAt time.Time) bool {
+		digest := key.(message.Digest)
+		entries = append(entries, fwdCacheEntry{
+			Digest:  digest[:],
+			Expires: expiresAt,
+		})
+		return true
+	})
+	return p.cacheStore.Put(fwdCacheStoreKey, entries)
+}
+
+// cacheStats returns the statistics of the forward cache
+func (p *Pss) cacheStats() *CacheStats {
+	stats := p.forwardCache.Stats()
+	return &CacheStats{
+		Size:      stats.Count,
+		Capacity:  p.forwardCache.Capacity,
+		TTL:       p.forwardCache.EntryTTL,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+	}
+}
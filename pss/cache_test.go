@@ -0,0 +1,70 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"testing"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+// TestCacheStore tests that the digests of the forward cache are restored
+// from the store and counted in the cache statistics
+func TestCacheStore(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	key, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := message.New(message.Flags{})
+	msg.To = make([]byte, addressLength)
+	msg.Expire = uint32(time.Now().Add(time.Minute).Unix())
+	msg.Payload = []byte("duplicate")
+
+	ps := newTestPssStart(key, nil, nil, false)
+	if err := ps.SetCacheStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.addFwdCache(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.saveFwdCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message is a duplicate for the restarted node
+	ps = newTestPssStart(key, nil, nil, false)
+	if ps.checkFwdCache(msg) {
+		t.Fatal("expected message not to be cached without the store")
+	}
+	if err := ps.SetCacheStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if !ps.checkFwdCache(msg) {
+		t.Fatal("expected message to be cached after restoring the cache")
+	}
+
+	stats := NewAPI(ps).GetCacheStats()
+	if stats.Size != 1 || stats.Hits != 1 || stats.Misses != 1 || stats.TTL != defaultDigestCacheTTL {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+}
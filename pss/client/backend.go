@@ -0,0 +1,145 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !noclient,!noprotocol
+
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// backend is the pss node a client works with, over rpc or in the same process
+type backend interface {
+	baseAddr() (string, error)
+	setPeerPublicKey(pubkeyid string, topic message.Topic, addr pss.PssAddress) error
+	getAddress(topic message.Topic, symkeyid string) (pss.PssAddress, error)
+	subscribe(ctx context.Context, topic message.Topic, msgC chan pss.APIMsg) (subscription, error)
+	addHandshake(topic message.Topic) error
+	handshake(pubkeyid string, topic message.Topic, sync bool, flush bool) ([]string, error)
+	getHandshakeKeys(pubkeyid string, topic message.Topic, in bool, out bool) ([]string, error)
+	getHandshakeKeyCapacity(symkeyid string) (uint16, error)
+	getHandshakePublicKey(symkeyid string) (string, error)
+	sendSym(symkeyid string, topic message.Topic, msg []byte) error
+	ping(pubkeyid string, addr pss.PssAddress) (*pss.PingResult, error)
+}
+
+// subscription to the messages of a topic, implemented by rpc.ClientSubscription
+type subscription interface {
+	Unsubscribe()
+	Err() <-chan error
+}
+
+// rpcBackend is a pss node connected to over rpc
+type rpcBackend struct {
+	client *rpc.Client
+	mu     sync.RWMutex
+}
+
+func (b *rpcBackend) rpcClient() *rpc.Client {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.client
+}
+
+// replaces the connection to the node, returning the previous one
+func (b *rpcBackend) setRPCClient(client *rpc.Client) *rpc.Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.client
+	b.client = client
+	return old
+}
+
+func (b *rpcBackend) call(result interface{}, method string, args ...interface{}) error {
+	return b.rpcClient().Call(result, method, args...)
+}
+
+func (b *rpcBackend) baseAddr() (string, error) {
+	var addr string
+	err := b.call(&addr, "pss_baseAddr")
+	return addr, err
+}
+
+func (b *rpcBackend) setPeerPublicKey(pubkeyid string, topic message.Topic, addr pss.PssAddress) error {
+	return b.call(nil, "pss_setPeerPublicKey", pubkeyid, topic.String(), hexutil.Encode(addr[:]))
+}
+
+func (b *rpcBackend) getAddress(topic message.Topic, symkeyid string) (pss.PssAddress, error) {
+	var addrhex string
+	if err := b.call(&addrhex, "pss_getAddress", topic.String(), false, symkeyid); err != nil {
+		return nil, err
+	}
+	addr, err := hexutil.Decode(addrhex)
+	if err != nil {
+		return nil, err
+	}
+	return pss.PssAddress(addr), nil
+}
+
+func (b *rpcBackend) subscribe(ctx context.Context, topic message.Topic, msgC chan pss.APIMsg) (subscription, error) {
+	sub, err := b.rpcClient().Subscribe(ctx, "pss", msgC, "receive", topic.String(), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (b *rpcBackend) addHandshake(topic message.Topic) error {
+	return b.call(nil, "pss_addHandshake", topic.String())
+}
+
+func (b *rpcBackend) handshake(pubkeyid string, topic message.Topic, sync bool, flush bool) ([]string, error) {
+	var symkeyids []string
+	err := b.call(&symkeyids, "pss_handshake", pubkeyid, topic.String(), sync, flush)
+	return symkeyids, err
+}
+
+func (b *rpcBackend) getHandshakeKeys(pubkeyid string, topic message.Topic, in bool, out bool) ([]string, error) {
+	var symkeyids []string
+	err := b.call(&symkeyids, "pss_getHandshakeKeys", pubkeyid, topic.String(), in, out)
+	return symkeyids, err
+}
+
+func (b *rpcBackend) getHandshakeKeyCapacity(symkeyid string) (uint16, error) {
+	var symkeycap uint16
+	err := b.call(&symkeycap, "pss_getHandshakeKeyCapacity", symkeyid)
+	return symkeycap, err
+}
+
+func (b *rpcBackend) getHandshakePublicKey(symkeyid string) (string, error) {
+	var pubkeyid string
+	err := b.call(&pubkeyid, "pss_getHandshakePublicKey", symkeyid)
+	return pubkeyid, err
+}
+
+func (b *rpcBackend) sendSym(symkeyid string, topic message.Topic, msg []byte) error {
+	return b.call(nil, "pss_sendSym", symkeyid, topic.String(), hexutil.Encode(msg))
+}
+
+func (b *rpcBackend) ping(pubkeyid string, addr pss.PssAddress) (*pss.PingResult, error) {
+	var res pss.PingResult
+	if err := b.call(&res, "pss_ping", pubkeyid, hexutil.Encode(addr)); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -25,7 +25,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -39,6 +38,9 @@ import (
 const (
 	handshakeRetryTimeout = 1000
 	handshakeRetryCount   = 3
+	defaultIdleTimeout    = time.Minute
+	reconnectBackoffMin   = 250 * time.Millisecond
+	reconnectBackoffMax   = 30 * time.Second
 )
 
 // The pss client provides devp2p emulation over pss RPC API,
@@ -46,26 +48,44 @@ const (
 type Client struct {
 	BaseAddrHex string
 
+	// lifecycle callbacks of the peers, must be set before RunProtocol is called
+	OnPeerAdded   func(pubkeyid string, topic message.Topic)
+	OnPeerRemoved func(pubkeyid string, topic message.Topic, err error) // err is the cause, nil on RemovePssPeer and Close
+	OnKeyExpired  func(pubkeyid string, topic message.Topic, symkeyid string)
+
+	// peers not heard from for longer are probed and removed if unreachable,
+	// must be set before RunProtocol is called
+	IdleTimeout time.Duration
+
 	// peers
 	peerPool map[message.Topic]map[string]*pssRPCRW
 	protos   map[message.Topic]*p2p.Protocol
 
-	// rpc connections
-	rpc  *rpc.Client
-	subs []*rpc.ClientSubscription
+	// pss node
+	node      backend
+	rpc       *rpcBackend // set for clients connected over rpc
+	subs      []subscription
+	subsMu    sync.Mutex
+	endpoints []string // endpoints to reconnect to, in order of failover
+	endpoint  int      // index of the endpoint connected to
 
 	// channels
-	topicsC chan []byte
-	quitC   chan struct{}
+	topicsC    chan []byte
+	quitC      chan struct{}
+	reconnectC chan struct{}
+	msgCs      map[message.Topic]chan pss.APIMsg // incoming messages of the protocols by topic, guarded by subsMu
 
 	poolMu sync.Mutex
+	gcOnce sync.Once
 }
 
 // implements p2p.MsgReadWriter
 type pssRPCRW struct {
 	*Client
 	topic    string
+	pssTopic message.Topic
 	msgC     chan []byte
+	closeC   chan struct{}
 	addr     pss.PssAddress
 	pubKeyId string
 	lastSeen time.Time
@@ -74,21 +94,29 @@ type pssRPCRW struct {
 
 func (c *Client) newpssRPCRW(pubkeyid string, addr pss.PssAddress, topicobj message.Topic) (*pssRPCRW, error) {
 	topic := topicobj.String()
-	err := c.rpc.Call(nil, "pss_setPeerPublicKey", pubkeyid, topic, hexutil.Encode(addr[:]))
+	err := c.node.setPeerPublicKey(pubkeyid, topicobj, addr)
 	if err != nil {
 		return nil, fmt.Errorf("setpeer %s %s: %v", topic, pubkeyid, err)
 	}
 	return &pssRPCRW{
 		Client:   c,
 		topic:    topic,
+		pssTopic: topicobj,
 		msgC:     make(chan []byte),
+		closeC:   make(chan struct{}),
 		addr:     addr,
 		pubKeyId: pubkeyid,
+		lastSeen: time.Now(),
 	}, nil
 }
 
 func (rw *pssRPCRW) ReadMsg() (p2p.Msg, error) {
-	msg := <-rw.msgC
+	var msg []byte
+	select {
+	case msg = <-rw.msgC:
+	case <-rw.closeC:
+		return p2p.Msg{}, errors.New("connection closed")
+	}
 	log.Trace("pssrpcrw read", "msg", msg)
 	pmsg, err := pss.ToP2pMsg(msg)
 	if err != nil {
@@ -106,7 +134,17 @@ func (rw *pssRPCRW) ReadMsg() (p2p.Msg, error) {
 // - any api calls fail
 // - handshake retries are exhausted without reply,
 // - send fails
+//
+// the peer is removed from the pool if the write fails
 func (rw *pssRPCRW) WriteMsg(msg p2p.Msg) error {
+	if err := rw.writeMsg(msg); err != nil {
+		rw.removePeer(rw.pssTopic, rw, err)
+		return err
+	}
+	return nil
+}
+
+func (rw *pssRPCRW) writeMsg(msg p2p.Msg) error {
 	log.Trace("got writemsg pssclient", "msg", msg)
 	if rw.closed {
 		return fmt.Errorf("connection closed")
@@ -123,28 +161,35 @@ func (rw *pssRPCRW) WriteMsg(msg p2p.Msg) error {
 	}
 
 	// Get the keys we have
-	var symkeyids []string
-	err = rw.Client.rpc.Call(&symkeyids, "pss_getHandshakeKeys", rw.pubKeyId, rw.topic, false, true)
+	symkeyids, err := rw.node.getHandshakeKeys(rw.pubKeyId, rw.pssTopic, false, true)
 	if err != nil {
 		return err
 	}
-
-	// Check the capacity of the first key
-	var symkeycap uint16
-	if len(symkeyids) > 0 {
-		err = rw.Client.rpc.Call(&symkeycap, "pss_getHandshakeKeyCapacity", symkeyids[0])
+	// all keys expired, wait for new ones
+	if len(symkeyids) == 0 {
+		symkeyid, err := rw.handshake(handshakeRetryCount, true, false)
 		if err != nil {
 			return err
 		}
+		symkeyids = []string{symkeyid}
+	}
+
+	// Check the capacity of the first key
+	symkeycap, err := rw.node.getHandshakeKeyCapacity(symkeyids[0])
+	if err != nil {
+		return err
 	}
 
-	err = rw.Client.rpc.Call(nil, "pss_sendSym", symkeyids[0], rw.topic, hexutil.Encode(pmsg))
+	err = rw.node.sendSym(symkeyids[0], rw.pssTopic, pmsg)
 	if err != nil {
 		return err
 	}
 
 	// If this is the last message it is valid for, initiate new handshake
 	if symkeycap == 1 {
+		if rw.OnKeyExpired != nil {
+			rw.OnKeyExpired(rw.pubKeyId, rw.pssTopic, symkeyids[0])
+		}
 		var retries int
 		var sync bool
 		// if it's the only remaining key, make sure we don't continue until we have new ones for further writes
@@ -165,13 +210,12 @@ func (rw *pssRPCRW) WriteMsg(msg p2p.Msg) error {
 // returns first new symkeyid upon successful execution
 func (rw *pssRPCRW) handshake(retries int, sync bool, flush bool) (string, error) {
 
-	var symkeyids []string
 	var i int
 	// request new keys
 	// if the key buffer was depleted, make this as a blocking call and try several times before giving up
 	for i = 0; i < 1+retries; i++ {
 		log.Debug("handshake attempt pssrpcrw", "pubkeyid", rw.pubKeyId, "topic", rw.topic, "sync", sync)
-		err := rw.Client.rpc.Call(&symkeyids, "pss_handshake", rw.pubKeyId, rw.topic, sync, flush)
+		symkeyids, err := rw.node.handshake(rw.pubKeyId, rw.pssTopic, sync, flush)
 		if err == nil {
 			var keyid string
 			if sync {
@@ -191,7 +235,19 @@ func (rw *pssRPCRW) handshake(retries int, sync bool, flush bool) (string, error
 //
 // Provides direct access to the rpc object
 func NewClient(rpcurl string) (*Client, error) {
-	rpcclient, err := rpc.Dial(rpcurl)
+	return NewClientWithEndpoints([]string{rpcurl})
+}
+
+// NewClientWithEndpoints connects to the first of the rpc endpoints that can be dialed
+//
+// When the connection is lost, the client reconnects with exponential backoff,
+// failing over to the other endpoints in order, and registers its protocols
+// and peers on the node again.
+func NewClientWithEndpoints(rpcurls []string) (*Client, error) {
+	if len(rpcurls) == 0 {
+		return nil, errors.New("no rpc endpoints")
+	}
+	rpcclient, endpoint, err := dialEndpoints(rpcurls, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -200,27 +256,45 @@ func NewClient(rpcurl string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	client.endpoints = rpcurls
+	client.endpoint = endpoint
+	go client.reconnectLoop()
 	return client, nil
 }
 
 // Main constructor
 //
 // The 'rpcclient' parameter allows passing a in-memory rpc client to act as the remote websocket RPC.
+// The client does not reconnect if the connection is lost.
 func NewClientWithRPC(rpcclient *rpc.Client) (*Client, error) {
+	node := &rpcBackend{client: rpcclient}
+	client, err := newClientWithBackend(node)
+	if err != nil {
+		return nil, err
+	}
+	client.rpc = node
+	return client, nil
+}
+
+func newClientWithBackend(node backend) (*Client, error) {
 	client := newClient()
-	client.rpc = rpcclient
-	err := client.rpc.Call(&client.BaseAddrHex, "pss_baseAddr")
+	client.node = node
+	baseAddr, err := node.baseAddr()
 	if err != nil {
 		return nil, fmt.Errorf("cannot get pss node baseaddress: %v", err)
 	}
+	client.BaseAddrHex = baseAddr
 	return client, nil
 }
 
 func newClient() (client *Client) {
 	client = &Client{
-		quitC:    make(chan struct{}),
-		peerPool: make(map[message.Topic]map[string]*pssRPCRW),
-		protos:   make(map[message.Topic]*p2p.Protocol),
+		IdleTimeout: defaultIdleTimeout,
+		quitC:       make(chan struct{}),
+		reconnectC:  make(chan struct{}, 1),
+		msgCs:       make(map[message.Topic]chan pss.APIMsg),
+		peerPool:    make(map[message.Topic]map[string]*pssRPCRW),
+		protos:      make(map[message.Topic]*p2p.Protocol),
 	}
 	return
 }
@@ -234,18 +308,18 @@ func newClient() (client *Client) {
 // this peer object is instantiated, and the protocol is run on it.
 func (c *Client) RunProtocol(ctx context.Context, proto *p2p.Protocol) error {
 	topicobj := message.NewTopic([]byte(fmt.Sprintf("%s:%d", proto.Name, proto.Version)))
-	topichex := topicobj.String()
 	msgC := make(chan pss.APIMsg)
 	c.peerPool[topicobj] = make(map[string]*pssRPCRW)
-	sub, err := c.rpc.Subscribe(ctx, "pss", msgC, "receive", topichex, false, false)
-	if err != nil {
-		return fmt.Errorf("pss event subscription failed: %v", err)
-	}
-	c.subs = append(c.subs, sub)
-	err = c.rpc.Call(nil, "pss_addHandshake", topichex)
+	err := c.subscribe(ctx, topicobj, msgC)
 	if err != nil {
-		return fmt.Errorf("pss handshake activation failed: %v", err)
+		return err
 	}
+	c.subsMu.Lock()
+	c.msgCs[topicobj] = msgC
+	c.subsMu.Unlock()
+	c.gcOnce.Do(func() {
+		go c.probePeers()
+	})
 
 	// dispatch incoming messages
 	go func() {
@@ -258,37 +332,36 @@ func (c *Client) RunProtocol(ctx context.Context, proto *p2p.Protocol) error {
 				}
 				// we get passed the symkeyid
 				// need the symkey itself to resolve to peer's pubkey
-				var pubkeyid string
-				err = c.rpc.Call(&pubkeyid, "pss_getHandshakePublicKey", msg.Key)
+				pubkeyid, err := c.node.getHandshakePublicKey(msg.Key)
 				if err != nil || pubkeyid == "" {
 					log.Trace("proto err or no pubkey", "err", err, "symkeyid", msg.Key)
 					continue
 				}
 				// if we don't have the peer on this protocol already, create it
 				// this is more or less the same as AddPssPeer, less the handshake initiation
-				if c.peerPool[topicobj][pubkeyid] == nil {
-					var addrhex string
-					err := c.rpc.Call(&addrhex, "pss_getAddress", topichex, false, msg.Key)
+				c.poolMu.Lock()
+				rw := c.peerPool[topicobj][pubkeyid]
+				c.poolMu.Unlock()
+				if rw == nil {
+					addr, err := c.node.getAddress(topicobj, msg.Key)
 					if err != nil {
 						log.Trace(err.Error())
 						continue
 					}
-					addrbytes, err := hexutil.Decode(addrhex)
+					rw, err = c.newpssRPCRW(pubkeyid, addr, topicobj)
 					if err != nil {
-						log.Trace(err.Error())
 						break
 					}
-					addr := pss.PssAddress(addrbytes)
-					rw, err := c.newpssRPCRW(pubkeyid, addr, topicobj)
-					if err != nil {
-						break
-					}
-					c.peerPool[topicobj][pubkeyid] = rw
-					p := p2p.NewPeer(enode.ID{}, fmt.Sprintf("%v", addr), []p2p.Cap{})
-					go proto.Run(p, c.peerPool[topicobj][pubkeyid])
+					c.addPeer(topicobj, proto, rw)
 				}
+				c.poolMu.Lock()
+				rw.lastSeen = time.Now()
+				c.poolMu.Unlock()
 				go func() {
-					c.peerPool[topicobj][pubkeyid].msgC <- msg.Msg
+					select {
+					case rw.msgC <- msg.Msg:
+					case <-rw.closeC:
+					}
 				}()
 			case <-c.quitC:
 				return
@@ -302,12 +375,235 @@ func (c *Client) RunProtocol(ctx context.Context, proto *p2p.Protocol) error {
 
 // Always call this to ensure that we exit cleanly
 func (c *Client) Close() error {
+	select {
+	case <-c.quitC:
+		return nil
+	default:
+		close(c.quitC)
+	}
+	c.subsMu.Lock()
 	for _, s := range c.subs {
 		s.Unsubscribe()
 	}
+	c.subsMu.Unlock()
+	var rws []*pssRPCRW
+	c.poolMu.Lock()
+	for _, peers := range c.peerPool {
+		for _, rw := range peers {
+			rws = append(rws, rw)
+		}
+	}
+	c.poolMu.Unlock()
+	for _, rw := range rws {
+		c.removePeer(rw.pssTopic, rw, nil)
+	}
 	return nil
 }
 
+// subscribes to the messages of the topic and activates handshakes on it,
+// a reconnect is triggered when the subscription fails
+func (c *Client) subscribe(ctx context.Context, topic message.Topic, msgC chan pss.APIMsg) error {
+	sub, err := c.node.subscribe(ctx, topic, msgC)
+	if err != nil {
+		return fmt.Errorf("pss event subscription failed: %v", err)
+	}
+	c.subsMu.Lock()
+	c.subs = append(c.subs, sub)
+	c.subsMu.Unlock()
+	go func() {
+		// the error is nil on unsubscribe and when the connection is closed by the client
+		if err := <-sub.Err(); err != nil {
+			log.Warn("pss client subscription failed", "topic", topic, "err", err)
+			select {
+			case c.reconnectC <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	err = c.node.addHandshake(topic)
+	if err != nil {
+		return fmt.Errorf("pss handshake activation failed: %v", err)
+	}
+	return nil
+}
+
+// dials the endpoints in order starting with the one at index start,
+// returns the connection to the first one that can be dialed and its index
+func dialEndpoints(rpcurls []string, start int) (*rpc.Client, int, error) {
+	var err error
+	for i := range rpcurls {
+		endpoint := (start + i) % len(rpcurls)
+		var rpcclient *rpc.Client
+		rpcclient, err = rpc.Dial(rpcurls[endpoint])
+		if err == nil {
+			return rpcclient, endpoint, nil
+		}
+		log.Debug("pss client dial failed", "endpoint", rpcurls[endpoint], "err", err)
+	}
+	return nil, 0, err
+}
+
+// reconnects with exponential backoff when a subscription fails
+func (c *Client) reconnectLoop() {
+	for {
+		select {
+		case <-c.reconnectC:
+		case <-c.quitC:
+			return
+		}
+		backoff := reconnectBackoffMin
+		for {
+			err := c.reconnect()
+			if err == nil {
+				break
+			}
+			log.Warn("pss client reconnect failed", "err", err, "retry", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-c.quitC:
+				return
+			}
+			backoff *= 2
+			if backoff > reconnectBackoffMax {
+				backoff = reconnectBackoffMax
+			}
+		}
+	}
+}
+
+// connects to the first endpoint that can be dialed, starting with the current one,
+// and registers the protocols and peers on the node again
+func (c *Client) reconnect() error {
+	rpcclient, endpoint, err := dialEndpoints(c.endpoints, c.endpoint)
+	if err != nil {
+		return err
+	}
+	c.rpc.setRPCClient(rpcclient).Close()
+	if err := c.register(); err != nil {
+		// retry with the next endpoint
+		c.endpoint = (endpoint + 1) % len(c.endpoints)
+		return err
+	}
+	c.endpoint = endpoint
+	log.Info("pss client reconnected", "endpoint", c.endpoints[endpoint])
+	return nil
+}
+
+// registers the protocols and peers of the client on the node connected to
+func (c *Client) register() error {
+	baseAddr, err := c.node.baseAddr()
+	if err != nil {
+		return fmt.Errorf("cannot get pss node baseaddress: %v", err)
+	}
+	c.BaseAddrHex = baseAddr
+
+	msgCs := make(map[message.Topic]chan pss.APIMsg)
+	c.subsMu.Lock()
+	for topic, msgC := range c.msgCs {
+		msgCs[topic] = msgC
+	}
+	c.subsMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectBackoffMax)
+	defer cancel()
+	for topic, msgC := range msgCs {
+		if err := c.subscribe(ctx, topic, msgC); err != nil {
+			return err
+		}
+	}
+	var rws []*pssRPCRW
+	c.poolMu.Lock()
+	for _, peers := range c.peerPool {
+		for _, rw := range peers {
+			rws = append(rws, rw)
+		}
+	}
+	c.poolMu.Unlock()
+	for _, rw := range rws {
+		if err := c.node.setPeerPublicKey(rw.pubKeyId, rw.pssTopic, rw.addr); err != nil {
+			return fmt.Errorf("setpeer %s %s: %v", rw.topic, rw.pubKeyId, err)
+		}
+	}
+	return nil
+}
+
+// adds the peer to the pool and runs the protocol on it,
+// the peer is removed when the protocol returns
+func (c *Client) addPeer(topic message.Topic, proto *p2p.Protocol, rw *pssRPCRW) {
+	c.poolMu.Lock()
+	c.peerPool[topic][rw.pubKeyId] = rw
+	c.poolMu.Unlock()
+	if c.OnPeerAdded != nil {
+		c.OnPeerAdded(rw.pubKeyId, topic)
+	}
+	p := p2p.NewPeer(enode.ID{}, fmt.Sprintf("%v", rw.addr), []p2p.Cap{})
+	go func() {
+		err := proto.Run(p, rw)
+		c.removePeer(topic, rw, err)
+	}()
+}
+
+// removes the peer of the read writer from the pool unless it was replaced,
+// and ends the protocol running on it
+func (c *Client) removePeer(topic message.Topic, rw *pssRPCRW, err error) {
+	c.poolMu.Lock()
+	if c.peerPool[topic][rw.pubKeyId] != rw {
+		c.poolMu.Unlock()
+		return
+	}
+	delete(c.peerPool[topic], rw.pubKeyId)
+	rw.closed = true
+	close(rw.closeC)
+	c.poolMu.Unlock()
+	if c.OnPeerRemoved != nil {
+		c.OnPeerRemoved(rw.pubKeyId, topic, err)
+	}
+}
+
+// probes the peers not heard from for a while, and removes the unreachable ones
+// before writes to them fail on handshakes that are never answered
+func (c *Client) probePeers() {
+	ticker := time.NewTicker(c.IdleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.pruneIdlePeers(c.IdleTimeout)
+		case <-c.quitC:
+			return
+		}
+	}
+}
+
+// pings the peers not heard from for longer than idle, and removes the ones not replying
+func (c *Client) pruneIdlePeers(idle time.Duration) {
+	type idlePeer struct {
+		topic message.Topic
+		rw    *pssRPCRW
+	}
+	var peers []idlePeer
+	c.poolMu.Lock()
+	for topic, rws := range c.peerPool {
+		for _, rw := range rws {
+			if time.Since(rw.lastSeen) > idle {
+				peers = append(peers, idlePeer{topic, rw})
+			}
+		}
+	}
+	c.poolMu.Unlock()
+
+	for _, p := range peers {
+		_, err := p.rw.node.ping(p.rw.pubKeyId, p.rw.addr)
+		if err != nil {
+			log.Debug("removing unreachable pss client peer", "pubkey", p.rw.pubKeyId, "topic", p.rw.topic, "err", err)
+			c.removePeer(p.topic, p.rw, err)
+			continue
+		}
+		c.poolMu.Lock()
+		p.rw.lastSeen = time.Now()
+		c.poolMu.Unlock()
+	}
+}
+
 // Add a pss peer (public key) and run the protocol on it
 //
 // client.RunProtocol with matching topic must have been
@@ -331,23 +627,21 @@ func (c *Client) AddPssPeer(pubkeyid string, addr []byte, spec *protocols.Spec)
 		if err != nil {
 			return err
 		}
-		c.poolMu.Lock()
-		c.peerPool[topic][pubkeyid] = rw
-		c.poolMu.Unlock()
-		p := p2p.NewPeer(enode.ID{}, fmt.Sprintf("%v", addr), []p2p.Cap{})
-		go c.protos[topic].Run(p, c.peerPool[topic][pubkeyid])
+		c.addPeer(topic, c.protos[topic], rw)
 	}
 	return nil
 }
 
 // Remove a pss peer
 //
-// TODO: underlying cleanup
+// The protocol running on the peer is ended
 func (c *Client) RemovePssPeer(pubkeyid string, spec *protocols.Spec) {
 	log.Debug("closing pss client peer", "pubkey", pubkeyid, "protoname", spec.Name, "protoversion", spec.Version)
-	c.poolMu.Lock()
-	defer c.poolMu.Unlock()
 	topic := pss.ProtocolTopic(spec)
-	c.peerPool[topic][pubkeyid].closed = true
-	delete(c.peerPool[topic], pubkeyid)
+	c.poolMu.Lock()
+	rw := c.peerPool[topic][pubkeyid]
+	c.poolMu.Unlock()
+	if rw != nil {
+		c.removePeer(topic, rw, nil)
+	}
 }
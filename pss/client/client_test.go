@@ -21,6 +21,8 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -35,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
 	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/testutil"
 )
@@ -67,14 +70,28 @@ func init() {
 
 // ping pong exchange across one expired symkey
 func TestClientHandshake(t *testing.T) {
+	t.Run("rpc", func(t *testing.T) {
+		testClientHandshake(t, false)
+	})
+	t.Run("inproc", func(t *testing.T) {
+		testClientHandshake(t, true)
+	})
+}
+
+func testClientHandshake(t *testing.T, inproc bool) {
 	sendLimit = 3
 
-	clients, err := setupNetwork(2)
+	clients, pssNodes, err := setupNetwork(2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	lpsc, err := NewClientWithRPC(clients[0])
+	var lpsc *Client
+	if inproc {
+		lpsc, err = NewClientWithPss(pssNodes[0])
+	} else {
+		lpsc, err = NewClientWithRPC(clients[0])
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,6 +99,18 @@ func TestClientHandshake(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	addedC := make(chan string, 1)
+	removedC := make(chan string, 1)
+	expiredC := make(chan string, sendLimit+1)
+	lpsc.OnPeerAdded = func(pubkeyid string, topic message.Topic) {
+		addedC <- pubkeyid
+	}
+	lpsc.OnPeerRemoved = func(pubkeyid string, topic message.Topic, err error) {
+		removedC <- pubkeyid
+	}
+	lpsc.OnKeyExpired = func(pubkeyid string, topic message.Topic, symkeyid string) {
+		expiredC <- symkeyid
+	}
 	lpssping := &pss.Ping{
 		OutC: make(chan bool),
 		InC:  make(chan bool),
@@ -148,6 +177,9 @@ func TestClientHandshake(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if added := <-addedC; added != rpubkey {
+		t.Fatalf("got added peer %s, want %s", added, rpubkey)
+	}
 
 	time.Sleep(time.Second)
 
@@ -157,9 +189,20 @@ func TestClientHandshake(t *testing.T) {
 		log.Warn("ok", "idx", i, "got", got)
 		time.Sleep(time.Second)
 	}
+	if len(expiredC) == 0 {
+		t.Fatal("expected expired key after reaching its send limit")
+	}
 
+	// reachable peers are kept on probing
+	lpsc.pruneIdlePeers(0)
 	rw := lpsc.peerPool[pss.PingTopic][rpubkey]
+	if rw == nil || rw.closed {
+		t.Fatal("expected reachable peer to be kept")
+	}
 	lpsc.RemovePssPeer(rpubkey, pss.PingProtocol)
+	if removed := <-removedC; removed != rpubkey {
+		t.Fatalf("got removed peer %s, want %s", removed, rpubkey)
+	}
 	if err := rw.WriteMsg(p2p.Msg{
 		Size:    3,
 		Payload: bytes.NewReader([]byte("foo")),
@@ -168,11 +211,78 @@ func TestClientHandshake(t *testing.T) {
 	}
 }
 
-func setupNetwork(numnodes int) (clients []*rpc.Client, err error) {
+// pss rpc api stub recording the topics of the handshakes activated on it
+type failoverAPI struct {
+	handshakeC chan string
+}
+
+func (api *failoverAPI) BaseAddr() string {
+	return "0x00"
+}
+
+func (api *failoverAPI) AddHandshake(topic string) error {
+	api.handshakeC <- topic
+	return nil
+}
+
+func (api *failoverAPI) Receive(ctx context.Context, topic string, raw bool, prox bool) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	return notifier.CreateSubscription(), nil
+}
+
+// tests that the client fails over to the next endpoint when the connection is lost,
+// and runs its protocols on it again
+func TestClientFailover(t *testing.T) {
+	var servers [2]*rpc.Server
+	var apis [2]*failoverAPI
+	var endpoints []string
+	for i := range servers {
+		apis[i] = &failoverAPI{handshakeC: make(chan string, 1)}
+		servers[i] = rpc.NewServer()
+		if err := servers[i].RegisterName("pss", apis[i]); err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(servers[i].WebsocketHandler([]string{"*"}))
+		defer ts.Close()
+		defer servers[i].Stop()
+		endpoints = append(endpoints, "ws"+strings.TrimPrefix(ts.URL, "http"))
+	}
+
+	psc, err := NewClientWithEndpoints(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := psc.RunProtocol(ctx, pss.NewPingProtocol(&pss.Ping{})); err != nil {
+		t.Fatal(err)
+	}
+	topic := pss.PingTopic.String()
+	if got := <-apis[0].handshakeC; got != topic {
+		t.Fatalf("got handshake on topic %s, want %s", got, topic)
+	}
+
+	servers[0].Stop()
+	select {
+	case got := <-apis[1].handshakeC:
+		if got != topic {
+			t.Fatalf("got handshake on topic %s, want %s", got, topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("protocol not run on the failover endpoint")
+	}
+}
+
+func setupNetwork(numnodes int) (clients []*rpc.Client, pssNodes []*pss.Pss, err error) {
 	nodes := make([]*simulations.Node, numnodes)
 	clients = make([]*rpc.Client, numnodes)
+	pssNodes = make([]*pss.Pss, numnodes)
 	if numnodes < 2 {
-		return nil, fmt.Errorf("Minimum two nodes in network")
+		return nil, nil, fmt.Errorf("Minimum two nodes in network")
 	}
 	adapter := adapters.NewSimAdapter(services)
 	net := simulations.NewNetwork(adapter, &simulations.NetworkConfig{
@@ -184,30 +294,31 @@ func setupNetwork(numnodes int) (clients []*rpc.Client, err error) {
 		nodeconf.Services = []string{"bzz", "pss"}
 		nodes[i], err = net.NewNodeWithConfig(nodeconf)
 		if err != nil {
-			return nil, fmt.Errorf("error creating node 1: %v", err)
+			return nil, nil, fmt.Errorf("error creating node 1: %v", err)
 		}
 		err = net.Start(nodes[i].ID())
 		if err != nil {
-			return nil, fmt.Errorf("error starting node 1: %v", err)
+			return nil, nil, fmt.Errorf("error starting node 1: %v", err)
 		}
 		if i > 0 {
 			err = net.Connect(nodes[i].ID(), nodes[i-1].ID())
 			if err != nil {
-				return nil, fmt.Errorf("error connecting nodes: %v", err)
+				return nil, nil, fmt.Errorf("error connecting nodes: %v", err)
 			}
 		}
 		clients[i], err = nodes[i].Client()
 		if err != nil {
-			return nil, fmt.Errorf("create node 1 rpc client fail: %v", err)
+			return nil, nil, fmt.Errorf("create node 1 rpc client fail: %v", err)
 		}
+		pssNodes[i] = nodes[i].Node.(*adapters.SimNode).Service("pss").(*pss.Pss)
 	}
 	if numnodes > 2 {
 		err = net.Connect(nodes[0].ID(), nodes[len(nodes)-1].ID())
 		if err != nil {
-			return nil, fmt.Errorf("error connecting first and last nodes")
+			return nil, nil, fmt.Errorf("error connecting first and last nodes")
 		}
 	}
-	return clients, nil
+	return clients, pssNodes, nil
 }
 
 func newServices() adapters.Services {
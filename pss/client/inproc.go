@@ -0,0 +1,135 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !noclient,!noprotocol,!nopsshandshake
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// NewClientWithPss creates a client of a pss node in the same process
+//
+// The client calls the node directly instead of through its RPC API, and works
+// as a client connected over RPC otherwise. The handshake controller of the node
+// must be set, see pss.SetHandshakeController.
+func NewClientWithPss(ps *pss.Pss) (*Client, error) {
+	node := &pssBackend{
+		pss: ps,
+		api: pss.NewAPI(ps),
+	}
+	for _, api := range ps.APIs() {
+		if handshakes, ok := api.Service.(*pss.HandshakeAPI); ok {
+			node.handshakes = handshakes
+		}
+	}
+	if node.handshakes == nil {
+		return nil, errors.New("pss node has no handshake controller")
+	}
+	return newClientWithBackend(node)
+}
+
+// pssBackend is a pss node in the same process
+type pssBackend struct {
+	pss        *pss.Pss
+	api        *pss.API
+	handshakes *pss.HandshakeAPI
+}
+
+func (b *pssBackend) baseAddr() (string, error) {
+	return hexutil.Encode(b.pss.BaseAddr()), nil
+}
+
+func (b *pssBackend) setPeerPublicKey(pubkeyid string, topic message.Topic, addr pss.PssAddress) error {
+	return b.api.SetPeerPublicKey(common.FromHex(pubkeyid), topic, addr)
+}
+
+func (b *pssBackend) getAddress(topic message.Topic, symkeyid string) (pss.PssAddress, error) {
+	return b.api.GetAddress(topic, false, symkeyid)
+}
+
+func (b *pssBackend) subscribe(ctx context.Context, topic message.Topic, msgC chan pss.APIMsg) (subscription, error) {
+	sub := &pssSubscription{
+		errC:  make(chan error),
+		quitC: make(chan struct{}),
+	}
+	sub.deregister = b.pss.Register(&topic, pss.NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
+		select {
+		case msgC <- pss.APIMsg{Msg: msg, Asymmetric: asymmetric, Key: keyid}:
+		case <-sub.quitC:
+		}
+		return nil
+	}))
+	return sub, nil
+}
+
+func (b *pssBackend) addHandshake(topic message.Topic) error {
+	return b.handshakes.AddHandshake(topic)
+}
+
+func (b *pssBackend) handshake(pubkeyid string, topic message.Topic, sync bool, flush bool) ([]string, error) {
+	return b.handshakes.Handshake(pubkeyid, topic, sync, flush)
+}
+
+func (b *pssBackend) getHandshakeKeys(pubkeyid string, topic message.Topic, in bool, out bool) ([]string, error) {
+	return b.handshakes.GetHandshakeKeys(pubkeyid, topic, in, out)
+}
+
+func (b *pssBackend) getHandshakeKeyCapacity(symkeyid string) (uint16, error) {
+	return b.handshakes.GetHandshakeKeyCapacity(symkeyid)
+}
+
+func (b *pssBackend) getHandshakePublicKey(symkeyid string) (string, error) {
+	return b.handshakes.GetHandshakePublicKey(symkeyid)
+}
+
+func (b *pssBackend) sendSym(symkeyid string, topic message.Topic, msg []byte) error {
+	return b.handshakes.SendSym(symkeyid, topic, msg)
+}
+
+func (b *pssBackend) ping(pubkeyid string, addr pss.PssAddress) (*pss.PingResult, error) {
+	return b.pss.Ping(context.Background(), pubkeyid, addr)
+}
+
+// pssSubscription is the handler of a topic registered on a pss node in the same process
+type pssSubscription struct {
+	deregister func()
+	errC       chan error
+	quitC      chan struct{}
+	once       sync.Once
+}
+
+func (sub *pssSubscription) Unsubscribe() {
+	sub.once.Do(func() {
+		sub.deregister()
+		close(sub.quitC)
+		close(sub.errC)
+	})
+}
+
+// Err never delivers an error, the channel is closed on unsubscribe
+func (sub *pssSubscription) Err() <-chan error {
+	return sub.errC
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/pss"
+)
+
+// APIs returns the RPC API of the registry
+func (r *Registry) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "discovery",
+			Version:   "1.0",
+			Service:   NewAPI(r),
+			Public:    false,
+		},
+	}
+}
+
+// API is the RPC API of the service registry
+type API struct {
+	r *Registry
+}
+
+// NewAPI creates the RPC API of the service registry
+func NewAPI(r *Registry) *API {
+	return &API{r: r}
+}
+
+// Register publishes the service provided by the node with the address hint and metadata,
+// keeping it registered with records living for ttl seconds, 0 for the default
+func (a *API) Register(ctx context.Context, name string, address hexutil.Bytes, metadata map[string]string, ttl uint64) error {
+	return a.r.Register(ctx, name, pss.PssAddress(address), metadata, time.Duration(ttl)*time.Second)
+}
+
+// Deregister stops publishing the service and marks its record expired
+func (a *API) Deregister(ctx context.Context, name string) error {
+	return a.r.Deregister(ctx, name)
+}
+
+// Resolve returns the record of the service with the name
+func (a *API) Resolve(ctx context.Context, name string) (*Service, error) {
+	return a.r.Resolve(ctx, name)
+}
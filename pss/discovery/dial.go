@@ -0,0 +1,52 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !nopssprotocol
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// Dial resolves the service with the name and runs the pss protocol with its node
+// as a peer on the topic, encrypted with the public key of the node
+func (r *Registry) Dial(ctx context.Context, name string, proto *pss.Protocol, topic message.Topic) (*Service, p2p.MsgReadWriter, error) {
+	service, err := r.Resolve(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubkey, err := crypto.UnmarshalPubkey(service.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key of service %q: %w", name, err)
+	}
+	if err := proto.SetPeerPublicKey(pubkey, topic, service.Address); err != nil {
+		return nil, nil, err
+	}
+	peer := p2p.NewPeer(enode.PubkeyToIDV4(pubkey), name, nil)
+	rw, err := proto.AddPeer(peer, topic, true, service.PublicKey.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return service, rw, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package discovery is a registry of named services provided over pss, built on top
+// of Swarm feeds.
+//
+// A service record maps the name of a service to the public key and the address hint
+// of the pss node providing it, along with metadata of the service. Records are
+// published as updates of a feed which topic and owner are both derived from the name,
+// so that any node knowing the name of a service can resolve it, and register it.
+// Records are signed by the key of the providing node, and expire after their time
+// to live unless the node registers them again.
+//
+// As anyone can publish to the feed of a name, the latest registration of a name
+// replaces the previous ones. Applications should check the public key of a resolved
+// service when it matters which node provides it.
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// DefaultTTL is the time to live of service records registered without one
+const DefaultTTL = time.Hour
+
+var (
+	// ErrNotFound is returned when no service is registered under the name
+	ErrNotFound = errors.New("service not found")
+	// ErrExpired is returned when the latest record of the service has expired
+	ErrExpired = errors.New("service record expired")
+	// ErrReadOnly is returned when registering services with a registry without a key
+	ErrReadOnly = errors.New("read only registry")
+)
+
+// topicName is the name of the feed topics of service records
+const topicName = "pss-discovery"
+
+// Service is the record of a named service
+type Service struct {
+	Name      string            `json:"name"`
+	PublicKey hexutil.Bytes     `json:"publicKey"` // public key of the providing pss node
+	Address   pss.PssAddress    `json:"address"`   // address hint of the providing pss node
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Expires   time.Time         `json:"expires"`
+}
+
+// record is a service record signed by the providing node
+type record struct {
+	Service   Service       `json:"service"`
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// registration is a service the node keeps registered
+type registration struct {
+	service Service
+	ttl     time.Duration
+	quitC   chan struct{}
+}
+
+// Registry registers and resolves named services
+type Registry struct {
+	handler *feed.Handler
+	key     *ecdsa.PrivateKey // key of the pss node signing the records, nil for read only registries
+
+	mu            sync.Mutex
+	registrations map[string]*registration // services registered by the node by name
+	wg            sync.WaitGroup
+}
+
+// New creates a registry publishing records signed by the key of the pss node.
+// With a nil key services can only be resolved.
+func New(handler *feed.Handler, key *ecdsa.PrivateKey) *Registry {
+	return &Registry{
+		handler:       handler,
+		key:           key,
+		registrations: make(map[string]*registration),
+	}
+}
+
+// Register publishes the service with the address hint and metadata, and publishes it
+// again before it expires until it is deregistered or the registry is closed
+func (r *Registry) Register(ctx context.Context, name string, address pss.PssAddress, metadata map[string]string, ttl time.Duration) error {
+	if r.key == nil {
+		return ErrReadOnly
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	reg := &registration{
+		service: Service{
+			Name:      name,
+			PublicKey: crypto.FromECDSAPub(&r.key.PublicKey),
+			Address:   address,
+			Metadata:  metadata,
+		},
+		ttl:   ttl,
+		quitC: make(chan struct{}),
+	}
+	if err := r.publish(ctx, reg.service, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.registrations[name]; ok {
+		close(prev.quitC)
+	}
+	r.registrations[name] = reg
+	r.wg.Add(1)
+	go r.refresh(reg)
+	return nil
+}
+
+// Deregister stops publishing the service and publishes an expired record of it
+func (r *Registry) Deregister(ctx context.Context, name string) error {
+	r.mu.Lock()
+	reg, ok := r.registrations[name]
+	if ok {
+		close(reg.quitC)
+		delete(r.registrations, name)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return r.publish(ctx, reg.service, time.Now())
+}
+
+// Resolve returns the latest record of the service with the name, or ErrNotFound
+// if there is none and ErrExpired if it has expired
+func (r *Registry) Resolve(ctx context.Context, name string) (*Service, error) {
+	signer, err := serviceSigner(name)
+	if err != nil {
+		return nil, err
+	}
+	fd := serviceFeed(name, signer)
+	if _, err := r.handler.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		if ferr, ok := err.(*feed.Error); ok && ferr.Code() == feed.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	_, data, err := r.handler.GetContent(fd)
+	if err != nil {
+		return nil, err
+	}
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid service record: %w", err)
+	}
+	if rec.Service.Name != name {
+		return nil, fmt.Errorf("service record of %q under name %q", rec.Service.Name, name)
+	}
+	if err := rec.verify(); err != nil {
+		return nil, err
+	}
+	if !rec.Service.Expires.After(time.Now()) {
+		return nil, ErrExpired
+	}
+	return &rec.Service, nil
+}
+
+// Close stops publishing the registered services, their records expire
+// after their time to live
+func (r *Registry) Close() {
+	r.mu.Lock()
+	for name, reg := range r.registrations {
+		close(reg.quitC)
+		delete(r.registrations, name)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// refresh publishes the service again when half of its time to live has passed
+func (r *Registry) refresh(reg *registration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(reg.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), reg.ttl/2)
+			if err := r.publish(ctx, reg.service, time.Now().Add(reg.ttl)); err != nil {
+				log.Warn("discovery: service registration failed", "name", reg.service.Name, "err", err)
+			}
+			cancel()
+		case <-reg.quitC:
+			return
+		}
+	}
+}
+
+// publish signs the record of the service and publishes it to the feed of its name
+func (r *Registry) publish(ctx context.Context, service Service, expires time.Time) error {
+	service.Expires = expires.UTC().Truncate(time.Second)
+	sig, err := crypto.Sign(service.digest(), r.key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&record{
+		Service:   service,
+		Signature: sig,
+	})
+	if err != nil {
+		return err
+	}
+	if len(data) > feed.MaxUpdateDataLength {
+		return fmt.Errorf("service record too large, max length is %d", feed.MaxUpdateDataLength)
+	}
+
+	signer, err := serviceSigner(service.Name)
+	if err != nil {
+		return err
+	}
+	request, err := r.handler.NewRequest(ctx, serviceFeed(service.Name, signer))
+	if err != nil {
+		return err
+	}
+	request.SetData(data)
+	if err := request.Sign(signer); err != nil {
+		return err
+	}
+	_, err = r.handler.Update(ctx, request)
+	return err
+}
+
+// verify checks that the record is signed by the node providing the service
+func (rec *record) verify() error {
+	pub, err := crypto.SigToPub(rec.Service.digest(), rec.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid service record signature: %w", err)
+	}
+	if hexutil.Encode(crypto.FromECDSAPub(pub)) != rec.Service.PublicKey.String() {
+		return errors.New("service record not signed by the providing node")
+	}
+	return nil
+}
+
+// digest returns the hash of the service that is signed in its record
+func (s *Service) digest() []byte {
+	// marshaling the fields of the service cannot fail
+	data, _ := json.Marshal(s)
+	return crypto.Keccak256(data)
+}
+
+// serviceFeed returns the feed of the records of the service with the name
+func serviceFeed(name string, signer *feed.GenericSigner) *feed.Feed {
+	// the topic name is valid and the related content is hashed to fit the topic
+	topic, _ := feed.NewTopic(topicName, crypto.Keccak256([]byte(name)))
+	return &feed.Feed{
+		Topic: topic,
+		User:  signer.Address(),
+	}
+}
+
+// serviceSigner returns the signer of the feed of the service with the name,
+// which key is derived from the name so that anyone knowing it can publish
+func serviceSigner(name string) (*feed.GenericSigner, error) {
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte(topicName), []byte(name)))
+	if err != nil {
+		return nil, err
+	}
+	return feed.NewGenericSigner(key), nil
+}
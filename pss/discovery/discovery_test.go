@@ -0,0 +1,156 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/storage/feed"
+)
+
+func newTestHandler(t *testing.T) (handler *feed.Handler, cleanup func()) {
+	t.Helper()
+
+	datadir, err := ioutil.TempDir("", "discovery-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	th, err := feed.NewTestHandler(datadir, &feed.HandlerParams{})
+	if err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	return th.Handler, func() {
+		th.Close()
+		os.RemoveAll(datadir)
+	}
+}
+
+// TestRegistry validates that registered services are resolved by name
+// until they are deregistered
+func TestRegistry(t *testing.T) {
+	handler, cleanup := newTestHandler(t)
+	defer cleanup()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(handler, key)
+	defer r.Close()
+	resolver := New(handler, nil)
+	ctx := context.Background()
+
+	if _, err := resolver.Resolve(ctx, "chat"); err != ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+	if err := resolver.Register(ctx, "chat", nil, nil, 0); err != ErrReadOnly {
+		t.Fatalf("got error %v, want %v", err, ErrReadOnly)
+	}
+
+	addr := []byte{0x12, 0x34}
+	if err := r.Register(ctx, "chat", addr, map[string]string{"version": "1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	service, err := resolver.Resolve(ctx, "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(service.PublicKey, crypto.FromECDSAPub(&key.PublicKey)) {
+		t.Fatalf("got public key %x", service.PublicKey)
+	}
+	if !bytes.Equal(service.Address, addr) {
+		t.Fatalf("got address %x, want %x", service.Address, addr)
+	}
+	if service.Metadata["version"] != "1" {
+		t.Fatalf("got metadata %v", service.Metadata)
+	}
+	if service.Expires.Before(time.Now().Add(DefaultTTL - time.Minute)) {
+		t.Fatalf("got expiry %v", service.Expires)
+	}
+	if _, err := resolver.Resolve(ctx, "mail"); err != ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	if err := r.Deregister(ctx, "chat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve(ctx, "chat"); err != ErrExpired {
+		t.Fatalf("got error %v, want %v", err, ErrExpired)
+	}
+	if err := r.Deregister(ctx, "chat"); err != ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+// TestRegistryRefresh validates that registered services are published again
+// before their records expire
+func TestRegistryRefresh(t *testing.T) {
+	handler, cleanup := newTestHandler(t)
+	defer cleanup()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(handler, key)
+	defer r.Close()
+	ctx := context.Background()
+
+	if err := r.Register(ctx, "chat", nil, nil, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2500 * time.Millisecond)
+	if _, err := r.Resolve(ctx, "chat"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRegistryForgedRecord validates that records not signed by the node
+// providing the service are rejected
+func TestRegistryForgedRecord(t *testing.T) {
+	handler, cleanup := newTestHandler(t)
+	defer cleanup()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(handler, key)
+	ctx := context.Background()
+
+	service := Service{
+		Name:      "chat",
+		PublicKey: crypto.FromECDSAPub(&other.PublicKey),
+	}
+	if err := r.publish(ctx, service, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Resolve(ctx, "chat"); err == nil {
+		t.Fatal("expected error resolving forged record")
+	}
+}
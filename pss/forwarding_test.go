@@ -11,6 +11,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/capability"
 	"github.com/ethersphere/swarm/p2p/protocols"
 	"github.com/ethersphere/swarm/pot"
 	"github.com/ethersphere/swarm/pss/message"
@@ -236,6 +237,56 @@ func TestForwardBasic(t *testing.T) {
 	}
 }
 
+// TestForwardNonRelay tests that peers advertising not to relay pss messages
+// are only selected for the messages addressed to them
+func TestForwardNonRelay(t *testing.T) {
+	baseAddrBytes := make([]byte, 32)
+	for i := 0; i < len(baseAddrBytes); i++ {
+		baseAddrBytes[i] = 0xFF
+	}
+	base := pot.NewAddressFromBytes(baseAddrBytes)
+	relay := pot.RandomAddressAt(base, 2)
+	nonRelay := pot.RandomAddressAt(base, 5)
+
+	kad := network.NewKademlia(base[:], network.NewKadParams())
+	ps := createPss(t, kad)
+	defer ps.Stop()
+	addPeers(kad, []pot.Address{relay})
+	// the capability is advertised without the pss relay flag
+	caps := capability.NewCapabilities()
+	caps.Add(capability.NewCapability(network.CapabilityID, 16))
+	p := newTestDiscoveryPeer(nonRelay, kad)
+	p.BzzAddr = p.BzzAddr.WithCapabilities(caps)
+	kad.On(p)
+
+	received := make(map[pot.Address]int)
+	defer func() { sendFunc = sendMsg }()
+	sendFunc = func(_ *Pss, sp *network.Peer, _ *message.Message) bool {
+		received[pot.NewAddressFromBytes(sp.Address())]++
+		return true
+	}
+
+	// message addressed close to the non relaying peer is forwarded by the relay
+	a := pot.RandomAddressAt(nonRelay, 64)
+	if err := ps.forward(newTestMsg(a[:])); err != nil {
+		t.Fatal(err)
+	}
+	if received[nonRelay] != 0 {
+		t.Fatal("expected non relaying peer not to be sent a message addressed to another node")
+	}
+	if received[relay] != 1 {
+		t.Fatalf("expected relay to be sent the message once, got %d", received[relay])
+	}
+
+	// message addressed to the non relaying peer reaches it
+	if err := ps.forward(newTestMsg(nonRelay[:])); err != nil {
+		t.Fatal(err)
+	}
+	if received[nonRelay] != 1 {
+		t.Fatalf("expected non relaying peer to be sent its message once, got %d", received[nonRelay])
+	}
+}
+
 // this function tests the forwarding of a single message. the recipient address is passed as param,
 // along with addresses of all peers, and indices of those peers which are expected to receive the message.
 func testForwardMsg(t *testing.T, ps *Pss, c *testCase) {
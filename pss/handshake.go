@@ -50,12 +50,17 @@ const (
 )
 
 // symmetric key exchange message payload
+//
+// Limit, Capacity and Expiry are the parameters proposed by the sender
+// for the topic, see HandshakeTopicParams
 type handshakeMsg struct {
-	From    []byte
-	Limit   uint16
-	Keys    [][]byte
-	Request uint8
-	Topic   message.Topic
+	From     []byte
+	Limit    uint16
+	Keys     [][]byte
+	Request  uint8
+	Topic    message.Topic
+	Capacity uint8
+	Expiry   uint32 // ms
 }
 
 // internal representation of an individual symmetric key
@@ -69,9 +74,14 @@ type handshakeKey struct {
 
 // container for all in- and outgoing keys
 // for one particular peer (public key) and topic
+//
+// params are the parameters negotiated with the peer,
+// once the peer sent its proposal
 type handshake struct {
-	outKeys []handshakeKey
-	inKeys  []handshakeKey
+	outKeys    []handshakeKey
+	inKeys     []handshakeKey
+	params     HandshakeTopicParams
+	negotiated bool
 }
 
 // Initialization parameters for the HandshakeController
@@ -91,6 +101,42 @@ type HandshakeParams struct {
 	SymKeyCapacity       uint8
 }
 
+// Key exchange parameters of a topic
+//
+// The parameters are proposed to the peer in every handshake message,
+// and the smaller of the two proposals is used by both parties
+type HandshakeTopicParams struct {
+	SymKeySendLimit     uint16        // amount of messages a symkey is valid for
+	SymKeyCapacity      uint8         // max number of symkeys to hold per direction
+	SymKeyExpiryTimeout time.Duration // time to wait before allowing garbage collection of an expired symkey
+}
+
+// min returns the smaller of the parameters of p and o,
+// unset parameters of o are ignored
+func (p HandshakeTopicParams) min(o HandshakeTopicParams) HandshakeTopicParams {
+	if o.SymKeySendLimit > 0 && o.SymKeySendLimit < p.SymKeySendLimit {
+		p.SymKeySendLimit = o.SymKeySendLimit
+	}
+	if o.SymKeyCapacity > 0 && o.SymKeyCapacity < p.SymKeyCapacity {
+		p.SymKeyCapacity = o.SymKeyCapacity
+	}
+	if o.SymKeyExpiryTimeout > 0 && o.SymKeyExpiryTimeout < p.SymKeyExpiryTimeout {
+		p.SymKeyExpiryTimeout = o.SymKeyExpiryTimeout
+	}
+	return p
+}
+
+// Key exchange state with a peer on a topic
+//
+// The parameters are the ones negotiated with the peer if Negotiated is set,
+// otherwise the ones proposed by this node
+type HandshakeInfo struct {
+	HandshakeTopicParams
+	Negotiated bool
+	InKeys     int // number of valid incoming symkeys
+	OutKeys    int // number of valid outgoing symkeys
+}
+
 // Sane defaults for HandshakeController initialization
 func NewHandshakeParams() *HandshakeParams {
 	return &HandshakeParams{
@@ -114,6 +160,7 @@ type HandshakeController struct {
 	symKeyCapacity       uint8
 	symKeyIndex          map[string]*handshakeKey
 	handshakes           map[string]map[message.Topic]*handshake
+	topicParams          map[message.Topic]HandshakeTopicParams // parameters proposed on topics, see SetHandshakeParams
 	deregisterFuncs      map[message.Topic]func()
 }
 
@@ -130,6 +177,7 @@ func SetHandshakeController(pss *Pss, params *HandshakeParams) error {
 		symKeyCapacity:       params.SymKeyCapacity,
 		symKeyIndex:          make(map[string]*handshakeKey),
 		handshakes:           make(map[string]map[message.Topic]*handshake),
+		topicParams:          make(map[message.Topic]HandshakeTopicParams),
 		deregisterFuncs:      make(map[message.Topic]func()),
 	}
 	api := &HandshakeAPI{
@@ -146,6 +194,64 @@ func SetHandshakeController(pss *Pss, params *HandshakeParams) error {
 	return nil
 }
 
+// Returns the parameters this node proposes on the topic
+func (ctl *HandshakeController) proposalNoLock(topic *message.Topic) HandshakeTopicParams {
+	if params, ok := ctl.topicParams[*topic]; ok {
+		return params
+	}
+	return HandshakeTopicParams{
+		SymKeySendLimit:     ctl.symKeySendLimit,
+		SymKeyCapacity:      ctl.symKeyCapacity,
+		SymKeyExpiryTimeout: ctl.symKeyExpiryTimeout,
+	}
+}
+
+// Returns the parameters in use with the peer (public key) on the topic,
+// the proposal of this node until the peer sent its own
+func (ctl *HandshakeController) params(pubkeyid string, topic *message.Topic) HandshakeTopicParams {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	return ctl.paramsNoLock(pubkeyid, topic)
+}
+
+func (ctl *HandshakeController) paramsNoLock(pubkeyid string, topic *message.Topic) HandshakeTopicParams {
+	if hs, ok := ctl.handshakes[pubkeyid][*topic]; ok && hs.negotiated {
+		return hs.params
+	}
+	return ctl.proposalNoLock(topic)
+}
+
+// Negotiates the parameters with the peer (public key) on the topic
+// from the proposal in the key exchange message
+//
+// The limits of the incoming keys already issued to the peer are
+// lowered to the negotiated limit
+func (ctl *HandshakeController) negotiate(pubkeyid string, keymsg *handshakeMsg) HandshakeTopicParams {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	if _, ok := ctl.handshakes[pubkeyid]; !ok {
+		ctl.handshakes[pubkeyid] = make(map[message.Topic]*handshake)
+	}
+	hs := ctl.handshakes[pubkeyid][keymsg.Topic]
+	if hs == nil {
+		hs = &handshake{}
+		ctl.handshakes[pubkeyid][keymsg.Topic] = hs
+	}
+	hs.params = ctl.proposalNoLock(&keymsg.Topic).min(HandshakeTopicParams{
+		SymKeySendLimit:     keymsg.Limit,
+		SymKeyCapacity:      keymsg.Capacity,
+		SymKeyExpiryTimeout: time.Duration(keymsg.Expiry) * time.Millisecond,
+	})
+	hs.negotiated = true
+	for i := range hs.inKeys {
+		if hs.inKeys[i].limit > hs.params.SymKeySendLimit {
+			hs.inKeys[i].limit = hs.params.SymKeySendLimit
+		}
+	}
+	log.Trace("handshake negotiated", "pubkey", pubkeyid, "topic", keymsg.Topic, "limit", hs.params.SymKeySendLimit, "capacity", hs.params.SymKeyCapacity, "expiry", hs.params.SymKeyExpiryTimeout)
+	return hs.params
+}
+
 // Return all unexpired symmetric keys from store by
 // peer (public key), topic and specified direction
 func (ctl *HandshakeController) validKeys(pubkeyid string, topic *message.Topic, in bool) (validkeys []*string) {
@@ -194,7 +300,7 @@ func (ctl *HandshakeController) updateKeys(pubkeyid string, topic *message.Topic
 		keystore = &(ctl.handshakes[pubkeyid][*topic].inKeys)
 	} else {
 		keystore = &(ctl.handshakes[pubkeyid][*topic].outKeys)
-		expire = expire.Add(time.Millisecond * ctl.symKeyExpiryTimeout)
+		expire = expire.Add(ctl.paramsNoLock(pubkeyid, topic).SymKeyExpiryTimeout)
 	}
 	for _, storekey := range *keystore {
 		storekey.expiredAt = expire
@@ -285,6 +391,21 @@ func (ctl *HandshakeController) clean() {
 	}
 }
 
+// isHandshakeKey reports whether the symmetric key was exchanged
+// by a handshake and can still be used
+func isHandshakeKey(symkeyid string) bool {
+	if ctrlSingleton == nil {
+		return false
+	}
+	ctrlSingleton.lock.Lock()
+	defer ctrlSingleton.lock.Unlock()
+	key, ok := ctrlSingleton.symKeyIndex[symkeyid]
+	if !ok || key.count >= key.limit {
+		return false
+	}
+	return key.expiredAt.IsZero() || key.expiredAt.After(time.Now())
+}
+
 func (ctl *HandshakeController) getSymKey(symkeyid string) *handshakeKey {
 	ctl.lock.Lock()
 	defer ctl.lock.Unlock()
@@ -342,6 +463,8 @@ func (ctl *HandshakeController) registerSymKeyUse(symkeyid string) error {
 //   1) leftmost bytes in new address do not match stored
 //   2) else, if new address is longer
 func (ctl *HandshakeController) handleKeys(pubkeyid string, keymsg *handshakeMsg) error {
+	params := ctl.negotiate(pubkeyid, keymsg)
+
 	// new keys from peer
 	if len(keymsg.Keys) > 0 {
 		log.Debug("received handshake keys", "pubkeyid", pubkeyid, "from", keymsg.From, "count", len(keymsg.Keys))
@@ -356,15 +479,19 @@ func (ctl *HandshakeController) handleKeys(pubkeyid string, keymsg *handshakeMsg
 			sendsymkeyids = append(sendsymkeyids, sendsymkeyid)
 		}
 		if len(sendsymkeyids) > 0 {
-			ctl.updateKeys(pubkeyid, &keymsg.Topic, false, sendsymkeyids, keymsg.Limit)
+			ctl.updateKeys(pubkeyid, &keymsg.Topic, false, sendsymkeyids, params.SymKeySendLimit)
 
 			ctl.alertHandshake(pubkeyid, sendsymkeyids)
 		}
 	}
 
-	// peer request for keys
+	// peer request for keys, up to the negotiated capacity
 	if keymsg.Request > 0 {
-		_, err := ctl.sendKey(pubkeyid, &keymsg.Topic, keymsg.Request)
+		request := keymsg.Request
+		if request > params.SymKeyCapacity {
+			request = params.SymKeyCapacity
+		}
+		_, err := ctl.sendKey(pubkeyid, &keymsg.Topic, request)
 		if err != nil {
 			return err
 		}
@@ -375,10 +502,12 @@ func (ctl *HandshakeController) handleKeys(pubkeyid string, keymsg *handshakeMsg
 
 // Send key exchange to peer (public key) valid for `topic`
 // Will send number of keys specified by `keycount` with
-// validity limits specified in `msglimit`
+// validity limits negotiated with the peer
 // If number of valid outgoing keys is less than the ideal/max
 // amount, a request is sent for the amount of keys to make up
 // the difference
+//
+// The parameters proposed by this node for the topic are sent along
 func (ctl *HandshakeController) sendKey(pubkeyid string, topic *message.Topic, keycount uint8) ([]string, error) {
 
 	var requestcount uint8
@@ -397,11 +526,16 @@ func (ctl *HandshakeController) sendKey(pubkeyid string, topic *message.Topic, k
 	}
 	ctl.lock.Unlock()
 
+	ctl.lock.Lock()
+	proposal := ctl.proposalNoLock(topic)
+	params := ctl.paramsNoLock(pubkeyid, topic)
+	ctl.lock.Unlock()
+
 	// check if buffer is not full
 	outkeys := ctl.validKeys(pubkeyid, topic, false)
-	if len(outkeys) < int(ctl.symKeyCapacity) {
+	if len(outkeys) < int(params.SymKeyCapacity) {
 		//requestcount = uint8(self.symKeyCapacity - uint8(len(outkeys)))
-		requestcount = ctl.symKeyCapacity
+		requestcount = params.SymKeyCapacity
 	}
 	// return if there's nothing to be accomplished
 	if requestcount == 0 && keycount == 0 {
@@ -420,17 +554,19 @@ func (ctl *HandshakeController) sendKey(pubkeyid string, topic *message.Topic, k
 			return []string{}, fmt.Errorf("GET Generated outgoing symkey fail (pubkey %x topic %x): %v", pubkeyid, topic, err)
 		}
 	}
-	ctl.updateKeys(pubkeyid, topic, true, recvkeyids, ctl.symKeySendLimit)
+	ctl.updateKeys(pubkeyid, topic, true, recvkeyids, params.SymKeySendLimit)
 
 	// encode and send the message
 	recvkeymsg := &handshakeMsg{
-		From:    ctl.pss.BaseAddr(),
-		Keys:    recvkeys,
-		Request: requestcount,
-		Limit:   ctl.symKeySendLimit,
-		Topic:   *topic,
-	}
-	log.Debug("sending our symkeys", "pubkey", pubkeyid, "symkeys", recvkeyids, "limit", ctl.symKeySendLimit, "requestcount", requestcount, "keycount", len(recvkeys))
+		From:     ctl.pss.BaseAddr(),
+		Keys:     recvkeys,
+		Request:  requestcount,
+		Limit:    proposal.SymKeySendLimit,
+		Topic:    *topic,
+		Capacity: proposal.SymKeyCapacity,
+		Expiry:   uint32(proposal.SymKeyExpiryTimeout / time.Millisecond),
+	}
+	log.Debug("sending our symkeys", "pubkey", pubkeyid, "symkeys", recvkeyids, "limit", params.SymKeySendLimit, "requestcount", requestcount, "keycount", len(recvkeys))
 	recvkeybytes, err := rlp.EncodeToBytes(recvkeymsg)
 	if err != nil {
 		return []string{}, fmt.Errorf("rlp keymsg encode fail: %v", err)
@@ -483,11 +619,11 @@ type HandshakeAPI struct {
 func (api *HandshakeAPI) Handshake(pubkeyid string, topic message.Topic, sync bool, flush bool) (keys []string, err error) {
 	var hsc chan []string
 	var keycount uint8
+	capacity := api.ctrl.params(pubkeyid, &topic).SymKeyCapacity
 	if flush {
-		keycount = api.ctrl.symKeyCapacity
-	} else {
-		validkeys := api.ctrl.validKeys(pubkeyid, &topic, false)
-		keycount = api.ctrl.symKeyCapacity - uint8(len(validkeys))
+		keycount = capacity
+	} else if validkeys := api.ctrl.validKeys(pubkeyid, &topic, false); len(validkeys) < int(capacity) {
+		keycount = capacity - uint8(len(validkeys))
 	}
 	if keycount == 0 {
 		return keys, errors.New("Incoming symmetric key store is already full")
@@ -514,10 +650,50 @@ func (api *HandshakeAPI) Handshake(pubkeyid string, topic message.Topic, sync bo
 
 // Activate handshake functionality on a topic
 func (api *HandshakeAPI) AddHandshake(topic message.Topic) error {
-	api.ctrl.deregisterFuncs[topic] = api.ctrl.pss.Register(&topic, NewHandler(api.ctrl.handler))
+	hndlr := NewHandler(api.ctrl.handler)
+	hndlr.keyExchange = true
+	api.ctrl.deregisterFuncs[topic] = api.ctrl.pss.Register(&topic, hndlr)
 	return nil
 }
 
+// Set the key exchange parameters proposed to peers on a topic
+//
+// The parameters negotiated with a peer take effect on the next
+// key exchange with the peer
+func (api *HandshakeAPI) SetHandshakeParams(topic message.Topic, params HandshakeTopicParams) error {
+	if params.SymKeySendLimit == 0 || params.SymKeyCapacity == 0 {
+		return errors.New("symkey send limit and capacity must be set")
+	}
+	if params.SymKeyExpiryTimeout <= 0 {
+		return errors.New("symkey expiry timeout must be set")
+	}
+	api.ctrl.lock.Lock()
+	defer api.ctrl.lock.Unlock()
+	api.ctrl.topicParams[topic] = params
+	return nil
+}
+
+// Returns the key exchange parameters negotiated with
+// a peer (public key) on a topic and the number of valid keys
+//
+// Fails if no keys were exchanged with the peer on the topic
+func (api *HandshakeAPI) GetHandshakeInfo(pubkeyid string, topic message.Topic) (*HandshakeInfo, error) {
+	api.ctrl.lock.Lock()
+	hs, ok := api.ctrl.handshakes[pubkeyid][topic]
+	if !ok {
+		api.ctrl.lock.Unlock()
+		return nil, fmt.Errorf("no handshake with %s on topic %s", pubkeyid, topic)
+	}
+	info := &HandshakeInfo{
+		HandshakeTopicParams: api.ctrl.paramsNoLock(pubkeyid, &topic),
+		Negotiated:           hs.negotiated,
+	}
+	api.ctrl.lock.Unlock()
+	info.InKeys = len(api.ctrl.validKeys(pubkeyid, &topic, true))
+	info.OutKeys = len(api.ctrl.validKeys(pubkeyid, &topic, false))
+	return info, nil
+}
+
 // Deactivate handshake functionality on a topic
 func (api *HandshakeAPI) RemoveHandshake(topic *message.Topic) error {
 	if _, ok := api.ctrl.deregisterFuncs[*topic]; ok {
@@ -25,3 +25,9 @@ const (
 func NewHandshakeParams() interface{} {
 	return nil
 }
+
+// isHandshakeKey reports whether the symmetric key was exchanged by a handshake,
+// which is never the case without handshakes
+func isHandshakeKey(symkeyid string) bool {
+	return false
+}
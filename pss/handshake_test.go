@@ -22,9 +22,94 @@ import (
 	"testing"
 	"time"
 
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
 )
 
+// TestHandshakeNegotiate tests that the smaller of the proposed key exchange parameters
+// are used with a peer, and that the incoming keys issued before are limited accordingly
+func TestHandshakeNegotiate(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	if err := SetHandshakeController(ps, NewHandshakeParams()); err != nil {
+		t.Fatal(err)
+	}
+	ctl := ctrlSingleton
+	api := &HandshakeAPI{ctrl: ctl}
+
+	topic := message.NewTopic([]byte("negotiate"))
+	proposal := HandshakeTopicParams{
+		SymKeySendLimit:     100,
+		SymKeyCapacity:      2,
+		SymKeyExpiryTimeout: 5 * time.Second,
+	}
+	if err := api.SetHandshakeParams(topic, HandshakeTopicParams{SymKeyCapacity: 2}); err == nil {
+		t.Fatal("expected error on params without send limit")
+	}
+	if err := api.SetHandshakeParams(topic, proposal); err != nil {
+		t.Fatal(err)
+	}
+
+	pubkeyid := "0x0123"
+	if _, err := api.GetHandshakeInfo(pubkeyid, topic); err == nil {
+		t.Fatal("expected error on info without handshake")
+	}
+
+	// a key issued to the peer before its proposal is known
+	symkeyid := "inkey"
+	ctl.handshakes[pubkeyid] = map[message.Topic]*handshake{
+		topic: {inKeys: []handshakeKey{{symKeyID: &symkeyid, pubKeyID: &pubkeyid, limit: proposal.SymKeySendLimit}}},
+	}
+	info, err := api.GetHandshakeInfo(pubkeyid, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Negotiated || info.HandshakeTopicParams != proposal || info.InKeys != 1 {
+		t.Fatalf("got info before negotiation %+v", info)
+	}
+
+	for _, tc := range []struct {
+		msg  handshakeMsg
+		want HandshakeTopicParams
+	}{
+		{
+			msg:  handshakeMsg{Limit: 50, Capacity: 4, Expiry: 10000},
+			want: HandshakeTopicParams{SymKeySendLimit: 50, SymKeyCapacity: 2, SymKeyExpiryTimeout: 5 * time.Second},
+		},
+		{
+			msg:  handshakeMsg{Limit: 200, Capacity: 1, Expiry: 1000},
+			want: HandshakeTopicParams{SymKeySendLimit: 100, SymKeyCapacity: 1, SymKeyExpiryTimeout: time.Second},
+		},
+		{
+			// peers not proposing parameters
+			msg:  handshakeMsg{Limit: 256},
+			want: proposal,
+		},
+	} {
+		tc.msg.Topic = topic
+		if got := ctl.negotiate(pubkeyid, &tc.msg); got != tc.want {
+			t.Fatalf("negotiated %+v from %+v, want %+v", got, tc.msg, tc.want)
+		}
+		info, err := api.GetHandshakeInfo(pubkeyid, topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Negotiated || info.HandshakeTopicParams != tc.want {
+			t.Fatalf("got info %+v, want negotiated %+v", info, tc.want)
+		}
+	}
+
+	// issued keys are only ever limited further
+	if limit := ctl.handshakes[pubkeyid][topic].inKeys[0].limit; limit != 50 {
+		t.Fatalf("got incoming key limit %d, want 50", limit)
+	}
+}
+
 // asymmetrical key exchange between two directly connected peers
 // full address, partial address (8 bytes) and empty address
 func TestHandshake(t *testing.T) {
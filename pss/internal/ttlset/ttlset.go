@@ -1,6 +1,7 @@
 package ttlset
 
 import (
+	"container/list"
 	"sync"
 	"time"
 
@@ -11,24 +12,37 @@ import (
 type Config struct {
 	EntryTTL time.Duration // time after which items are removed
 	Clock    clock.Clock   // time reference
+	Capacity int           // maximum number of entries, the least recently added are evicted beyond it, 0 for no limit
+}
+
+// Stats are the counters of a TTLSet
+type Stats struct {
+	Count     int    // number of entries in the set
+	Hits      uint64 // number of Has calls finding the key
+	Misses    uint64 // number of Has calls not finding the key
+	Evictions uint64 // number of entries evicted before expiring to keep within the capacity
 }
 
 // TTLSet implements a Set that automatically removes expired keys
 // after a predefined expiration time
 type TTLSet struct {
 	Config
-	set  map[interface{}]setEntry
-	lock sync.RWMutex
+	set   map[interface{}]setEntry
+	order *list.List // keys in order of addition, to evict from the front
+	stats Stats
+	lock  sync.RWMutex
 }
 
 type setEntry struct {
 	expiresAt time.Time
+	elem      *list.Element
 }
 
 // New instances a TTLSet
 func New(config *Config) *TTLSet {
 	ts := &TTLSet{
 		set:    make(map[interface{}]setEntry),
+		order:  list.New(),
 		Config: *config,
 	}
 	return ts
@@ -36,18 +50,41 @@ func New(config *Config) *TTLSet {
 
 // Add adds a new key to the set
 func (ts *TTLSet) Add(key interface{}) error {
-	var entry setEntry
-	var ok bool
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.add(key, ts.Clock.Now().Add(ts.EntryTTL))
+	return nil
+}
 
+// AddUntil adds a key to the set that expires at the given time,
+// for restoring the entries of a set
+func (ts *TTLSet) AddUntil(key interface{}, expiresAt time.Time) error {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
+	if expiresAt.After(ts.Clock.Now()) {
+		ts.add(key, expiresAt)
+	}
+	return nil
+}
 
-	if entry, ok = ts.set[key]; !ok {
-		entry = setEntry{}
+func (ts *TTLSet) add(key interface{}, expiresAt time.Time) {
+	entry, ok := ts.set[key]
+	if ok {
+		ts.order.MoveToBack(entry.elem)
+	} else {
+		entry.elem = ts.order.PushBack(key)
 	}
-	entry.expiresAt = ts.Clock.Now().Add(ts.EntryTTL)
+	entry.expiresAt = expiresAt
 	ts.set[key] = entry
-	return nil
+	for ts.Capacity > 0 && len(ts.set) > ts.Capacity {
+		ts.remove(ts.order.Front().Value)
+		ts.stats.Evictions++
+	}
+}
+
+func (ts *TTLSet) remove(key interface{}) {
+	ts.order.Remove(ts.set[key].elem)
+	delete(ts.set, key)
 }
 
 // Has returns whether or not a key is already/still in the set
@@ -58,10 +95,12 @@ func (ts *TTLSet) Has(key interface{}) bool {
 	entry, ok := ts.set[key]
 	if ok {
 		if entry.expiresAt.After(ts.Clock.Now()) {
+			ts.stats.Hits++
 			return true
 		}
-		delete(ts.set, key) // since we're holding the lock, take the chance to delete a expired record
+		ts.remove(key) // since we're holding the lock, take the chance to delete a expired record
 	}
+	ts.stats.Misses++
 	return false
 }
 
@@ -71,7 +110,7 @@ func (ts *TTLSet) GC() {
 	defer ts.lock.Unlock()
 	for k, v := range ts.set {
 		if v.expiresAt.Before(ts.Clock.Now()) {
-			delete(ts.set, k)
+			ts.remove(k)
 		}
 	}
 }
@@ -82,3 +121,26 @@ func (ts *TTLSet) Count() int {
 	defer ts.lock.Unlock()
 	return len(ts.set)
 }
+
+// Stats returns the counters of the set
+func (ts *TTLSet) Stats() Stats {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	stats := ts.stats
+	stats.Count = len(ts.set)
+	return stats
+}
+
+// Range calls f with the entries of the set that have not expired
+// and their expiry time, until f returns false
+func (ts *TTLSet) Range(f func(key interface{}, expiresAt time.Time) bool) {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	now := ts.Clock.Now()
+	for e := ts.order.Front(); e != nil; e = e.Next() {
+		expiresAt := ts.set[e.Value].expiresAt
+		if expiresAt.After(now) && !f(e.Value, expiresAt) {
+			return
+		}
+	}
+}
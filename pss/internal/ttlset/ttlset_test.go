@@ -148,3 +148,52 @@ func TestGC(t *testing.T) {
 	}
 
 }
+
+func TestTTLSetCapacity(t *testing.T) {
+	testClock := clock.NewMock(time.Unix(0, 0))
+	testSet := ttlset.New(&ttlset.Config{
+		EntryTTL: 10 * time.Second,
+		Clock:    testClock,
+		Capacity: 2,
+	})
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if err := testSet.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "b" is the least recently added when "c" exceeds the capacity
+	if testSet.Has("b") {
+		t.Fatal("expected b to be evicted")
+	}
+	if !testSet.Has("a") || !testSet.Has("c") {
+		t.Fatal("expected a and c to remain in the set")
+	}
+	stats := testSet.Stats()
+	if stats.Count != 2 || stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// entries are restored with their expiry time, expired ones are skipped
+	restored := ttlset.New(&ttlset.Config{
+		EntryTTL: 10 * time.Second,
+		Clock:    testClock,
+	})
+	testClock.Add(5 * time.Second)
+	testSet.Range(func(key interface{}, expiresAt time.Time) bool {
+		if err := restored.AddUntil(key, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	})
+	if err := restored.AddUntil("d", testClock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Count() != 2 || !restored.Has("a") || !restored.Has("c") {
+		t.Fatal("expected a and c to be restored")
+	}
+	testClock.Add(5 * time.Second)
+	if restored.Has("a") {
+		t.Fatal("expected restored entry to expire with its original expiry time")
+	}
+}
@@ -9,17 +9,28 @@ import (
 
 // Flags represents the possible PSS message flags
 type Flags struct {
-	Raw       bool // message is flagged as raw or with external encryption
-	Symmetric bool // message is symmetrically encrypted
+	Raw       bool  // message is flagged as raw or with external encryption
+	Symmetric bool  // message is symmetrically encrypted
+	NoCache   bool  // message is not kept by relays to retry forwarding
+	Hops      uint8 // number of hops the message can still be forwarded, 0 for no limit
 }
 
+// MaxHops is the largest hop limit of a message
+const MaxHops = 1<<hopsBits - 1
+
 const flagsLength = 1
 const flagSymmetric = 1 << 0
 const flagRaw = 1 << 1
+const flagNoCache = 1 << 2
+const hopsShift = 3
+const hopsBits = 5
 
 // ErrIncorrectFlagsFieldLength is returned when the incoming flags field length is incorrect
 var ErrIncorrectFlagsFieldLength = errors.New("Incorrect flags field length in message")
 
+// ErrHopsTooLarge is returned when the hop limit of a message is larger than MaxHops
+var ErrHopsTooLarge = errors.New("Hop limit of message too large")
+
 // DecodeRLP implements the rlp.Decoder interface
 func (f *Flags) DecodeRLP(s *rlp.Stream) error {
 	flagsBytes, err := s.Bytes()
@@ -31,6 +42,8 @@ func (f *Flags) DecodeRLP(s *rlp.Stream) error {
 	}
 	f.Symmetric = flagsBytes[0]&flagSymmetric != 0
 	f.Raw = flagsBytes[0]&flagRaw != 0
+	f.NoCache = flagsBytes[0]&flagNoCache != 0
+	f.Hops = flagsBytes[0] >> hopsShift
 	return nil
 }
 
@@ -43,6 +56,13 @@ func (f *Flags) EncodeRLP(w io.Writer) error {
 	if f.Symmetric {
 		flags |= flagSymmetric
 	}
+	if f.NoCache {
+		flags |= flagNoCache
+	}
+	if f.Hops > MaxHops {
+		return ErrHopsTooLarge
+	}
+	flags |= f.Hops << hopsShift
 
 	return rlp.Encode(w, []byte{flags})
 }
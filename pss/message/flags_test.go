@@ -52,6 +52,31 @@ func TestFlags(t *testing.T) {
 
 }
 
+func TestFlagsHops(t *testing.T) {
+	for _, f := range []message.Flags{
+		{NoCache: true},
+		{Raw: true, Hops: 1},
+		{Symmetric: true, NoCache: true, Hops: message.MaxHops},
+	} {
+		bytes, err := rlp.EncodeToBytes(&f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f2 message.Flags
+		if err := rlp.DecodeBytes(bytes, &f2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f, f2) {
+			t.Fatalf("Expected RLP decoding to return %v. Got %v", f, f2)
+		}
+	}
+
+	f := message.Flags{Hops: message.MaxHops + 1}
+	if _, err := rlp.EncodeToBytes(&f); err != message.ErrHopsTooLarge {
+		t.Fatalf("Expected an message.ErrHopsTooLarge error. Got %v", err)
+	}
+}
+
 func TestFlagsErrors(t *testing.T) {
 	var f2 message.Flags
 	err := rlp.DecodeBytes([]byte{0x82, 0xFF, 0xFF}, &f2)
@@ -0,0 +1,113 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !nopssprotocol
+
+package pss
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// Frame of a message of a protocol multiplexed over a topic
+//
+// Msg is the serialized ProtocolMsg of the protocol identified by ID
+type MuxMsg struct {
+	ID  uint64
+	Msg []byte
+}
+
+// Multiplexer of devp2p protocol emulations over a single pss topic
+//
+// The protocols are identified by the ID in the frame of their messages, so that
+// apps composed of several protocols need a single topic and a single key exchange
+// with each peer
+type Mux struct {
+	*Pss
+	topic     *message.Topic
+	protocols map[uint64]*Protocol
+	mu        sync.RWMutex
+}
+
+// Creates a multiplexer of protocols over the topic
+//
+// Its Handle method is to be passed to pss.Register() for the topic
+func NewMux(ps *Pss, topic *message.Topic) *Mux {
+	return &Mux{
+		Pss:       ps,
+		topic:     topic,
+		protocols: make(map[uint64]*Protocol),
+	}
+}
+
+// Activates devp2p emulation of a protocol with the identifier on the topic of the multiplexer
+//
+// The options are the same as for RegisterProtocol. Fails if the identifier is already in use.
+func (m *Mux) RegisterProtocol(id uint64, spec *protocols.Spec, targetprotocol *p2p.Protocol, options *ProtocolParams) (*Protocol, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.protocols[id]; ok {
+		return nil, fmt.Errorf("protocol id %d already registered on topic %s", id, m.topic)
+	}
+	pp, err := RegisterProtocol(m.Pss, m.topic, spec, targetprotocol, options)
+	if err != nil {
+		return nil, err
+	}
+	pp.mux = &id
+	m.protocols[id] = pp
+	return pp, nil
+}
+
+// Generic handler for incoming messages of the multiplexed protocols
+//
+// To be passed to pss.Register()
+//
+// Passes the message to the handler of the protocol identified in its frame,
+// see Protocol.Handle. Fails if the frame cannot be decoded or no protocol
+// is registered with its identifier
+func (m *Mux) Handle(msg []byte, peer *p2p.Peer, asymmetric bool, keyid string) error {
+	var frame MuxMsg
+	if err := rlp.DecodeBytes(msg, &frame); err != nil {
+		return fmt.Errorf("pss mux handler unable to decode frame: %v", err)
+	}
+	m.mu.RLock()
+	pp, ok := m.protocols[frame.ID]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no protocol with id %d on topic %s", frame.ID, m.topic)
+	}
+	return pp.Handle(frame.Msg, peer, asymmetric, keyid)
+}
+
+// muxSendFunc wraps the messages sent by the send function in frames with the protocol identifier
+func muxSendFunc(id uint64, send func(string, message.Topic, []byte) error) func(string, message.Topic, []byte) error {
+	return func(key string, topic message.Topic, msg []byte) error {
+		frame, err := rlp.EncodeToBytes(&MuxMsg{
+			ID:  id,
+			Msg: msg,
+		})
+		if err != nil {
+			return err
+		}
+		return send(key, topic, frame)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !nopssprotocol,!nopssping
+
+package pss
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// tests that several protocols share a topic and that their messages
+// reach only the same protocol of the peer
+func TestMux(t *testing.T) {
+	topic := message.NewTopic([]byte("mux"))
+
+	var nodes [2]*Pss
+	var muxes [2]*Mux
+	var pubkeyids [2]string
+	// pings by node and protocol id
+	pings := make([]map[uint64]*Ping, 2)
+	pps := make([]map[uint64]*Protocol, 2)
+	for i := range nodes {
+		key, err := ethCrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps := newTestPssStart(key, nil, nil, false)
+		if ps == nil {
+			t.Fatal("could not create pss")
+		}
+		nodes[i] = ps
+		pubkeyids[i] = common.ToHex(ethCrypto.FromECDSAPub(&key.PublicKey))
+
+		muxes[i] = NewMux(ps, &topic)
+		pings[i] = make(map[uint64]*Ping)
+		pps[i] = make(map[uint64]*Protocol)
+		for _, id := range []uint64{1, 2} {
+			ping := &Ping{
+				Pong: true,
+				OutC: make(chan bool),
+				InC:  make(chan bool, 1),
+			}
+			pp, err := muxes[i].RegisterProtocol(id, PingProtocol, NewPingProtocol(ping), &ProtocolParams{Asymmetric: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pings[i][id] = ping
+			pps[i][id] = pp
+		}
+		if _, err := muxes[i].RegisterProtocol(1, PingProtocol, NewPingProtocol(&Ping{}), &ProtocolParams{Asymmetric: true}); err == nil {
+			t.Fatal("expected error registering protocol id twice")
+		}
+		ps.Register(&topic, NewHandler(muxes[i].Handle))
+	}
+	for i, ps := range nodes {
+		peer := nodes[1-i]
+		ps.outbox.SetForward(func(msg *message.Message) error {
+			return peer.handlePssMsg(context.Background(), msg)
+		})
+		ps.outbox.Start()
+		defer ps.outbox.Stop()
+		if err := ps.SetPeerPublicKey(&peer.privateKey.PublicKey, topic, peer.BaseAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ping on the second protocol gets the pong of the second protocol of the peer
+	if _, err := pps[0][2].AddPeer(p2p.NewPeer(enode.ID{}, "peer", nil), topic, true, pubkeyids[1]); err != nil {
+		t.Fatal(err)
+	}
+	pings[0][2].OutC <- false
+	for _, want := range []struct {
+		ping *Ping
+		pong bool
+	}{
+		{pings[1][2], false},
+		{pings[0][2], true},
+	} {
+		select {
+		case pong := <-want.ping.InC:
+			if pong != want.pong {
+				t.Fatalf("got pong %v, want %v", pong, want.pong)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for ping")
+		}
+	}
+	for i := range nodes {
+		select {
+		case <-pings[i][1].InC:
+			t.Fatalf("node %d: message on the other protocol", i)
+		default:
+		}
+	}
+
+	// frames of unknown protocols and malformed frames are rejected
+	msg, err := NewProtocolMsg(0, &PingMsg{Created: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := rlp.EncodeToBytes(&MuxMsg{ID: 3, Msg: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := muxes[1].Handle(frame, p2p.NewPeer(enode.ID{}, "peer", nil), true, pubkeyids[0]); err == nil {
+		t.Fatal("expected error on frame of unknown protocol")
+	}
+	if err := muxes[1].Handle(msg, p2p.NewPeer(enode.ID{}, "peer", nil), true, pubkeyids[0]); err == nil {
+		t.Fatal("expected error on malformed frame")
+	}
+}
@@ -139,6 +139,13 @@ func (o *Outbox) processOutbox() {
 				if err := o.forwardFunc(msg.msg); err != nil {
 					metrics.GetOrRegisterCounter("pss/forward/err", nil).Inc(1)
 					log.Debug(err.Error())
+					if msg.msg.Flags.NoCache {
+						metrics.GetOrRegisterCounter("pss/forward/nocache", nil).Inc(1)
+						log.Debug("Message not cached, won't be requeued")
+						o.free(slot)
+						metrics.GetOrRegisterGauge("pss/outbox/len", nil).Update(int64(o.Len()))
+						return
+					}
 					limit := msg.startedAt.Add(o.maxRetryTime)
 					now := o.clock.Now()
 					if now.After(limit) {
@@ -18,6 +18,7 @@ package outbox_test
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -263,3 +264,41 @@ func TestMessageRetriesExpired(t *testing.T) {
 	}
 
 }
+
+func TestMessageNoCache(t *testing.T) {
+	var forwards int32
+	failForwardFunction := func(msg *message.Message) error {
+		atomic.AddInt32(&forwards, 1)
+		return errors.New("forward error")
+	}
+	testOutbox := outbox.NewMock(&outbox.Config{
+		NumberSlots: 1,
+		Forward:     failForwardFunction,
+	})
+
+	testOutbox.Start()
+	defer testOutbox.Stop()
+
+	msg := testOutbox.NewOutboxMessage(&message.Message{
+		Flags: message.Flags{NoCache: true},
+	})
+	completionC := make(chan struct{})
+	go func() {
+		testOutbox.Enqueue(msg)
+		completionC <- struct{}{}
+	}()
+	expectNotTimeout(t, completionC)
+
+	// the message is not requeued after the failed forward
+	iterations := 0
+	for testOutbox.Len() != 0 && iterations < 10 {
+		time.Sleep(10 * time.Millisecond)
+		iterations++
+	}
+	if numMessages := testOutbox.Len(); numMessages != 0 {
+		t.Fatalf("Expected no messages in outbox, instead got %v", numMessages)
+	}
+	if n := atomic.LoadInt32(&forwards); n != 1 {
+		t.Fatalf("Expected one forward, instead got %v", n)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// TopicPolicy is the policy applied to the incoming messages on a topic before its handlers run
+type TopicPolicy string
+
+const (
+	TopicPolicyOpen      TopicPolicy = "open"       // all messages are handled, the default
+	TopicPolicyKnownKeys TopicPolicy = "known-keys" // only messages from public keys or with symmetric keys set for the topic
+	TopicPolicyHandshake TopicPolicy = "handshake"  // only messages with symmetric keys exchanged by the pss handshake
+)
+
+// SetTopicPolicy sets the inbound policy of the topic
+func (p *Pss) SetTopicPolicy(topic message.Topic, policy TopicPolicy) error {
+	switch policy {
+	case TopicPolicyOpen, TopicPolicyKnownKeys, TopicPolicyHandshake:
+	default:
+		return fmt.Errorf("invalid topic policy %q", policy)
+	}
+	p.topicPoliciesMu.Lock()
+	defer p.topicPoliciesMu.Unlock()
+	if policy == TopicPolicyOpen {
+		delete(p.topicPolicies, topic)
+	} else {
+		p.topicPolicies[topic] = policy
+	}
+	log.Debug("pss topic policy set", "topic", label(topic[:]), "policy", policy)
+	return nil
+}
+
+// GetTopicPolicy returns the inbound policy of the topic
+func (p *Pss) GetTopicPolicy(topic message.Topic) TopicPolicy {
+	p.topicPoliciesMu.RLock()
+	defer p.topicPoliciesMu.RUnlock()
+	if policy, ok := p.topicPolicies[topic]; ok {
+		return policy
+	}
+	return TopicPolicyOpen
+}
+
+// GetTopicPolicies returns the topics with policies other than open
+func (p *Pss) GetTopicPolicies() map[message.Topic]TopicPolicy {
+	p.topicPoliciesMu.RLock()
+	defer p.topicPoliciesMu.RUnlock()
+	policies := make(map[message.Topic]TopicPolicy, len(p.topicPolicies))
+	for topic, policy := range p.topicPolicies {
+		policies[topic] = policy
+	}
+	return policies
+}
+
+// isInboundAllowed reports whether the policy of the topic allows
+// the handlers to receive a message with the given encryption and key
+func (p *Pss) isInboundAllowed(topic message.Topic, raw bool, asymmetric bool, keyid string) bool {
+	var allowed bool
+	switch p.GetTopicPolicy(topic) {
+	case TopicPolicyOpen:
+		return true
+	case TopicPolicyKnownKeys:
+		if !raw {
+			p.mx.RLock()
+			if asymmetric {
+				allowed = p.pubKeyPool[keyid][topic] != nil
+			} else {
+				allowed = p.symKeyPool[keyid][topic] != nil
+			}
+			p.mx.RUnlock()
+		}
+	case TopicPolicyHandshake:
+		if !raw && !asymmetric {
+			allowed = isHandshakeKey(keyid)
+		}
+	}
+	if !allowed {
+		metrics.GetOrRegisterCounter("pss/policy/refused", nil).Inc(1)
+		log.Trace("pss message refused by topic policy", "topic", label(topic[:]), "raw", raw, "asymmetric", asymmetric)
+	}
+	return allowed
+}
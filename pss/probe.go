@@ -0,0 +1,174 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+const (
+	// time to wait for the reply to a liveness probe
+	defaultProbeTimeout = 10 * time.Second
+)
+
+var (
+	// probeTopic is the topic of liveness probes between pss nodes, see Ping
+	probeTopic = message.NewTopic([]byte("pss:probe"))
+
+	// ErrProbeTimeout is returned by Ping when the peer does not reply in time
+	ErrProbeTimeout = errors.New("pss peer did not reply to probe")
+)
+
+// probeMsg is the payload of a liveness probe and of its reply
+type probeMsg struct {
+	Nonce uint64
+	Pong  bool
+	From  PssAddress // address hint of the prober to send the reply to
+	Hops  uint8      // estimated hops of the probe, set on replies
+}
+
+// PingResult is the outcome of a liveness probe of a peer
+type PingResult struct {
+	RTT        time.Duration // round trip time of the probe
+	Hops       uint8         // estimated number of hops from the node to the peer, 0 if unknown
+	ReturnHops uint8         // estimated number of hops from the peer to the node, 0 if unknown
+}
+
+// pendingProbe is a probe waiting for its reply
+type pendingProbe struct {
+	pubkeyid string
+	replyC   chan probeReply
+}
+
+type probeReply struct {
+	hops       uint8
+	returnHops uint8
+}
+
+// Ping probes whether the peer with the public key is reachable through the address hint,
+// and measures the round trip time and the number of hops to and from it.
+//
+// The probe is encrypted with the public key of the peer, which replies to an address
+// hint of the node of the same length as the one given.
+func (p *Pss) Ping(ctx context.Context, pubkeyid string, address PssAddress) (*PingResult, error) {
+	defer metrics.GetOrRegisterResettingTimer("pss/ping", nil).UpdateSince(time.Now())
+
+	pubkey := common.FromHex(pubkeyid)
+	if _, err := p.Crypto.UnmarshalPublicKey(pubkey); err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal pubkey: %x", pubkeyid)
+	}
+	if err := validateAddress(address); err != nil {
+		return nil, err
+	}
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	probe := &probeMsg{
+		Nonce: binary.BigEndian.Uint64(nonce[:]),
+		From:  p.BaseAddr()[:len(address)],
+	}
+	payload, err := rlp.EncodeToBytes(probe)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &pendingProbe{
+		pubkeyid: common.ToHex(pubkey),
+		replyC:   make(chan probeReply, 1),
+	}
+	p.probesMu.Lock()
+	p.probes[probe.Nonce] = pending
+	p.probesMu.Unlock()
+	defer func() {
+		p.probesMu.Lock()
+		delete(p.probes, probe.Nonce)
+		p.probesMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, defaultProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := p.sendHops(address, probeTopic, payload, true, pubkey, message.MaxHops); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-pending.replyC:
+		return &PingResult{
+			RTT:        time.Since(start),
+			Hops:       reply.hops,
+			ReturnHops: reply.returnHops,
+		}, nil
+	case <-ctx.Done():
+		metrics.GetOrRegisterCounter("pss/ping/timeout", nil).Inc(1)
+		return nil, ErrProbeTimeout
+	case <-p.quitC:
+		return nil, errors.New("pss stopped")
+	}
+}
+
+// handleProbe replies to a probe, or passes a reply to the pending probe it belongs to.
+// hops is the remaining hop limit of the message on arrival
+func (p *Pss) handleProbe(payload []byte, pubkeyid string, hops uint8) error {
+	var msg probeMsg
+	if err := rlp.DecodeBytes(payload, &msg); err != nil {
+		return fmt.Errorf("invalid probe: %v", err)
+	}
+	if !msg.Pong {
+		reply, err := rlp.EncodeToBytes(&probeMsg{
+			Nonce: msg.Nonce,
+			Pong:  true,
+			Hops:  probeHops(hops),
+		})
+		if err != nil {
+			return err
+		}
+		return p.sendHops(msg.From, probeTopic, reply, true, common.FromHex(pubkeyid), message.MaxHops)
+	}
+
+	p.probesMu.Lock()
+	pending, ok := p.probes[msg.Nonce]
+	p.probesMu.Unlock()
+	// only the probed peer can reply
+	if !ok || pending.pubkeyid != pubkeyid {
+		return nil
+	}
+	select {
+	case pending.replyC <- probeReply{hops: msg.Hops, returnHops: probeHops(hops)}:
+	default:
+	}
+	return nil
+}
+
+// probeHops estimates the number of hops a probe took from its remaining hop limit,
+// probes are sent with the largest limit and each relay decrements it
+func probeHops(remaining uint8) uint8 {
+	if remaining == 0 {
+		return 0
+	}
+	return message.MaxHops - remaining + 1
+}
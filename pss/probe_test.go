@@ -0,0 +1,79 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// TestPing tests probing the liveness of a peer and the estimates of its distance
+func TestPing(t *testing.T) {
+	var nodes [2]*Pss
+	for i := range nodes {
+		key, err := ethCrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = newTestPssStart(key, nil, nil, false)
+		if nodes[i] == nil {
+			t.Fatal("could not create pss")
+		}
+		defer nodes[i].outbox.Stop()
+	}
+	a, b := nodes[0], nodes[1]
+	// messages from a are relayed by one node on their way to b
+	a.outbox.SetForward(func(msg *message.Message) error {
+		msg.Flags.Hops--
+		go b.handlePssMsg(context.Background(), msg)
+		return nil
+	})
+	b.outbox.SetForward(func(msg *message.Message) error {
+		go a.handlePssMsg(context.Background(), msg)
+		return nil
+	})
+	a.outbox.Start()
+	b.outbox.Start()
+
+	pubkeyid := common.ToHex(ethCrypto.FromECDSAPub(b.PublicKey()))
+	res, err := a.Ping(context.Background(), pubkeyid, b.BaseAddr()[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RTT <= 0 {
+		t.Fatalf("got rtt %v", res.RTT)
+	}
+	if res.Hops != 2 || res.ReturnHops != 1 {
+		t.Fatalf("got hops %d and %d, want 2 and 1", res.Hops, res.ReturnHops)
+	}
+
+	// a peer with another key does not reply
+	key, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := a.Ping(ctx, common.ToHex(ethCrypto.FromECDSAPub(&key.PublicKey)), b.BaseAddr()); err != ErrProbeTimeout {
+		t.Fatalf("got error %v, want %v", err, ErrProbeTimeout)
+	}
+}
@@ -20,6 +20,7 @@ package pss
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -29,13 +30,33 @@ import (
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/p2p/protocols"
 	"github.com/ethersphere/swarm/pss/message"
+	"github.com/golang/snappy"
 )
 
 const (
 	IsActiveProtocol = true
 )
 
+const (
+	// upper bound of the bytes added to a protocol message on its way to the peer:
+	// the ProtocolMsg and Mux frames, the ratchet envelope, the size field, padding,
+	// signature and encryption of the message wrapping, and the pss message envelope
+	protocolMsgOverhead = 1024
+
+	// MaxProtocolMsgSize is the size up to which protocol messages are sent over pss
+	// however well they compress, larger messages up to the devp2p limit are sent
+	// if they compress enough
+	MaxProtocolMsgSize = defaultMaxMsgSize - protocolMsgOverhead
+)
+
+// ErrProtocolMsgTooLarge is returned on writing a protocol message that does
+// not fit in a pss message, even compressed
+var ErrProtocolMsgTooLarge = errors.New("protocol message too large for pss")
+
 // Convenience wrapper for devp2p protocol messages for transport over pss
+//
+// Payloads written by PssReadWriter are snappy compressed if that makes
+// them smaller, Size is always the size of the uncompressed payload
 type ProtocolMsg struct {
 	Code       uint64
 	Size       uint32
@@ -64,9 +85,11 @@ func NewProtocolMsg(code uint64, msg interface{}) ([]byte, error) {
 // Protocol options to be passed to a new Protocol instance
 //
 // The parameters specify which encryption schemes to allow
+// and optionally the schemas of the message payloads by code
 type ProtocolParams struct {
 	Asymmetric bool
 	Symmetric  bool
+	Schemas    map[uint64]*MessageSchema
 }
 
 // PssReadWriter bridges pss send/receive with devp2p protocol send/receive
@@ -96,19 +119,35 @@ func (prw *PssReadWriter) WriteMsg(msg p2p.Msg) error {
 	if prw.closed {
 		return fmt.Errorf("connection closed")
 	}
+	if msg.Size > defaultMaxMsgSize {
+		return fmt.Errorf("%w: %d bytes", ErrProtocolMsgTooLarge, msg.Size)
+	}
 	rlpdata := make([]byte, msg.Size)
 	msg.Payload.Read(rlpdata)
-	pmsg, err := rlp.EncodeToBytes(ProtocolMsg{
-		Code:    msg.Code,
-		Size:    msg.Size,
-		Payload: rlpdata,
-	})
+	pmsg, err := encodeProtocolMsg(msg.Code, rlpdata)
 	if err != nil {
 		return err
 	}
+	if len(pmsg) > MaxProtocolMsgSize {
+		return fmt.Errorf("%w: %d bytes, %d compressed", ErrProtocolMsgTooLarge, msg.Size, len(pmsg))
+	}
 	return prw.sendFunc(prw.key, *prw.topic, pmsg)
 }
 
+// encodeProtocolMsg serializes a ProtocolMsg with the payload,
+// compressed if that makes it smaller
+func encodeProtocolMsg(code uint64, rlpdata []byte) ([]byte, error) {
+	payload := rlpdata
+	if compressed := snappy.Encode(nil, rlpdata); len(compressed) < len(rlpdata) {
+		payload = compressed
+	}
+	return rlp.EncodeToBytes(ProtocolMsg{
+		Code:    code,
+		Size:    uint32(len(rlpdata)),
+		Payload: payload,
+	})
+}
+
 // Injects a p2p.Msg into the MsgReadWriter, so that it appears on the associated p2p.MsgReader
 func (prw *PssReadWriter) injectMsg(msg p2p.Msg) error {
 	log.Trace(fmt.Sprintf("pssrw injectmsg: %v", msg))
@@ -127,6 +166,9 @@ type Protocol struct {
 	Asymmetric   bool
 	Symmetric    bool
 	poolMu       sync.RWMutex
+	schemas      map[uint64]*MessageSchema // payload constraints by message code
+	schemaMu     sync.RWMutex
+	mux          *uint64 // identifier of the protocol if it is multiplexed, see Mux
 }
 
 // Activates devp2p emulation over a specific pss topic
@@ -148,6 +190,12 @@ func RegisterProtocol(ps *Pss, topic *message.Topic, spec *protocols.Spec, targe
 		symKeyRWPool: make(map[string]p2p.MsgReadWriter),
 		Asymmetric:   options.Asymmetric,
 		Symmetric:    options.Symmetric,
+		schemas:      make(map[uint64]*MessageSchema),
+	}
+	for code, schema := range options.Schemas {
+		if err := pp.RegisterSchema(code, schema); err != nil {
+			return nil, err
+		}
 	}
 	return pp, nil
 }
@@ -161,13 +209,25 @@ func RegisterProtocol(ps *Pss, topic *message.Topic, spec *protocols.Spec, targe
 // pss keypool
 //
 // Fails if protocol is not valid for the message encryption scheme,
-// if adding a new peer fails, or if the message is not a serialized
-// p2p.Msg (which it always will be if it is sent from this object).
+// if adding a new peer fails, if the message is not a serialized
+// p2p.Msg (which it always will be if it is sent from this object)
+// or if its payload does not satisfy the schema registered for its code.
 func (p *Protocol) Handle(msg []byte, peer *p2p.Peer, asymmetric bool, keyid string) error {
 	var vrw *PssReadWriter
 	if p.Asymmetric != asymmetric && p.Symmetric == !asymmetric {
 		return fmt.Errorf("invalid protocol encryption")
-	} else if (!p.isActiveSymKey(keyid, *p.topic) && !asymmetric) ||
+	}
+
+	payload, err := decodeProtocolMsg(msg)
+	if err != nil {
+		return fmt.Errorf("could not decode pssmsg")
+	}
+	// malformed payloads are rejected before a peer is added for them
+	if err := p.checkSchema(payload); err != nil {
+		return err
+	}
+
+	if (!p.isActiveSymKey(keyid, *p.topic) && !asymmetric) ||
 		(!p.isActiveAsymKey(keyid, *p.topic) && asymmetric) {
 
 		rw, err := p.AddPeer(peer, *p.topic, asymmetric, keyid)
@@ -179,10 +239,7 @@ func (p *Protocol) Handle(msg []byte, peer *p2p.Peer, asymmetric bool, keyid str
 		vrw = rw.(*PssReadWriter)
 	}
 
-	pmsg, err := ToP2pMsg(msg)
-	if err != nil {
-		return fmt.Errorf("could not decode pssmsg")
-	}
+	pmsg := newP2pMsg(payload)
 
 	if asymmetric {
 		p.poolMu.RLock()
@@ -221,17 +278,46 @@ func (p *Protocol) isActiveAsymKey(key string, topic message.Topic) bool {
 
 // Creates a serialized (non-buffered) version of a p2p.Msg, used in the specialized internal p2p.MsgReadwriter implementations
 func ToP2pMsg(msg []byte) (p2p.Msg, error) {
+	payload, err := decodeProtocolMsg(msg)
+	if err != nil {
+		return p2p.Msg{}, err
+	}
+	return newP2pMsg(payload), nil
+}
+
+// decodeProtocolMsg decodes a serialized ProtocolMsg,
+// decompressing its payload if it is compressed
+func decodeProtocolMsg(msg []byte) (*ProtocolMsg, error) {
 	payload := &ProtocolMsg{}
 	if err := rlp.DecodeBytes(msg, payload); err != nil {
-		return p2p.Msg{}, fmt.Errorf("pss protocol handler unable to decode payload as p2p message: %v", err)
+		return nil, fmt.Errorf("pss protocol handler unable to decode payload as p2p message: %v", err)
+	}
+	if uint32(len(payload.Payload)) == payload.Size {
+		return payload, nil
+	}
+	if payload.Size > defaultMaxMsgSize {
+		return nil, fmt.Errorf("pss protocol message size %d too large", payload.Size)
+	}
+	n, err := snappy.DecodedLen(payload.Payload)
+	if err != nil || uint32(n) != payload.Size {
+		return nil, fmt.Errorf("pss protocol message payload does not match size %d", payload.Size)
 	}
+	data, err := snappy.Decode(nil, payload.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("pss protocol handler unable to decompress payload: %v", err)
+	}
+	payload.Payload = data
+	return payload, nil
+}
 
+// newP2pMsg creates a p2p.Msg with the code and payload of the ProtocolMsg
+func newP2pMsg(payload *ProtocolMsg) p2p.Msg {
 	return p2p.Msg{
 		Code:       payload.Code,
 		Size:       uint32(len(payload.Payload)),
 		ReceivedAt: time.Now(),
 		Payload:    bytes.NewBuffer(payload.Payload),
-	}, nil
+	}
 }
 
 // Runs an emulated pss Protocol on the specified peer,
@@ -252,6 +338,9 @@ func (p *Protocol) AddPeer(peer *p2p.Peer, topic message.Topic, asymmetric bool,
 	} else {
 		rw.sendFunc = p.Pss.SendSym
 	}
+	if p.mux != nil {
+		rw.sendFunc = muxSendFunc(*p.mux, rw.sendFunc)
+	}
 	if asymmetric {
 		if !p.Pss.isPubKeyStored(key) {
 			return nil, fmt.Errorf("asym key does not exist: %s", key)
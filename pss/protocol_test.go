@@ -19,7 +19,9 @@ package pss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"testing"
@@ -28,7 +30,10 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss/message"
 )
 
 type protoCtrl struct {
@@ -164,3 +169,153 @@ func testProtocol(t *testing.T) {
 		t.Fatalf("expected error on write")
 	}
 }
+
+// tests that payloads not satisfying the schema of their message code are rejected
+// before a peer is added for them
+func TestProtocolSchema(t *testing.T) {
+	kad := network.NewKademlia(network.RandomBzzAddr().Over(), network.NewKadParams())
+	ps := createPss(t, kad)
+	defer ps.Stop()
+
+	schema := &MessageSchema{
+		MaxSize: 64,
+		Validate: func(msg interface{}) error {
+			if !msg.(*PingMsg).Pong {
+				return errors.New("not a pong")
+			}
+			return nil
+		},
+	}
+	pp, err := RegisterProtocol(ps, &PingTopic, PingProtocol, NewPingProtocol(&Ping{}), &ProtocolParams{
+		Asymmetric: true,
+		Schemas:    map[uint64]*MessageSchema{0: schema},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.RegisterSchema(1, schema); err == nil {
+		t.Fatal("expected error registering schema of unknown message code")
+	}
+	if err := pp.RegisterSchema(0, &MessageSchema{MinSize: 8, MaxSize: 4}); err == nil {
+		t.Fatal("expected error registering schema with invalid size bounds")
+	}
+
+	peer := p2p.NewPeer(enode.ID{}, "test", nil)
+	for _, tc := range []struct {
+		name string
+		msg  interface{}
+	}{
+		{"oversized", make([]byte, 100)},
+		{"malformed", "not a ping"},
+		{"invalid", &PingMsg{Created: time.Now()}},
+	} {
+		msg, err := NewProtocolMsg(0, tc.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pp.Handle(msg, peer, true, "key"); err == nil {
+			t.Fatalf("%s: expected payload to be rejected", tc.name)
+		}
+		if len(pp.pubKeyRWPool) != 0 {
+			t.Fatalf("%s: expected no peer to be added for rejected payload", tc.name)
+		}
+	}
+
+	msg, err := NewProtocolMsg(0, &PingMsg{Created: time.Now(), Pong: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := decodeProtocolMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.checkSchema(payload); err != nil {
+		t.Fatalf("expected valid payload to be accepted, got %v", err)
+	}
+
+	// without a schema any payload is accepted
+	if err := pp.RegisterSchema(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = NewProtocolMsg(0, "not a ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err = decodeProtocolMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.checkSchema(payload); err != nil {
+		t.Fatalf("expected payload to be accepted without schema, got %v", err)
+	}
+}
+
+// tests that protocol messages are compressed when that makes them smaller and
+// that messages up to the devp2p limit are sent if they fit in a pss message
+func TestProtocolMsgSize(t *testing.T) {
+	var sent []byte
+	prw := &PssReadWriter{
+		topic: &PingTopic,
+		sendFunc: func(_ string, _ message.Topic, msg []byte) error {
+			sent = msg
+			return nil
+		},
+	}
+	write := func(data []byte) error {
+		sent = nil
+		return prw.WriteMsg(p2p.Msg{
+			Code:    1,
+			Size:    uint32(len(data)),
+			Payload: bytes.NewReader(data),
+		})
+	}
+	check := func(name string, data []byte) {
+		payload, err := decodeProtocolMsg(sent)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if payload.Code != 1 || !bytes.Equal(payload.Payload, data) {
+			t.Fatalf("%s: payload mismatch", name)
+		}
+	}
+
+	small := []byte("ping")
+	if err := write(small); err != nil {
+		t.Fatal(err)
+	}
+	check("small", small)
+
+	// a compressible message of the devp2p limit exceeds the pss budget uncompressed
+	large := make([]byte, defaultMaxMsgSize)
+	if err := write(large); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) > MaxProtocolMsgSize/2 {
+		t.Fatalf("expected compressed message, got %d bytes", len(sent))
+	}
+	check("compressible", large)
+
+	// incompressible messages must fit in the budget
+	random := make([]byte, MaxProtocolMsgSize)
+	rand.Read(random)
+	if err := write(random); !errors.Is(err, ErrProtocolMsgTooLarge) {
+		t.Fatalf("expected ErrProtocolMsgTooLarge, got %v", err)
+	}
+	random = random[:MaxProtocolMsgSize-32]
+	if err := write(random); err != nil {
+		t.Fatal(err)
+	}
+	check("incompressible", random)
+
+	if err := write(make([]byte, defaultMaxMsgSize+1)); !errors.Is(err, ErrProtocolMsgTooLarge) {
+		t.Fatalf("expected ErrProtocolMsgTooLarge beyond the devp2p limit, got %v", err)
+	}
+
+	// compressed payloads must decompress to their declared size
+	malformed, err := rlp.EncodeToBytes(ProtocolMsg{Code: 1, Size: 100, Payload: []byte("not snappy")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeProtocolMsg(malformed); err == nil {
+		t.Fatal("expected error decoding payload not matching its size")
+	}
+}
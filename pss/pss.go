@@ -41,6 +41,8 @@ import (
 	"github.com/ethersphere/swarm/pss/internal/ttlset"
 	"github.com/ethersphere/swarm/pss/message"
 	"github.com/ethersphere/swarm/pss/outbox"
+	"github.com/ethersphere/swarm/pss/ratchet"
+	"github.com/ethersphere/swarm/state"
 	"github.com/tilinna/clock"
 )
 
@@ -48,7 +50,7 @@ const (
 	defaultMsgTTL              = time.Second * 120
 	defaultDigestCacheTTL      = time.Second * 30
 	defaultSymKeyCacheCapacity = 512
-	defaultMaxMsgSize          = 1024 * 1024
+	defaultMaxMsgSize          = 1<<24 - 1 // the devp2p limit, so that the messages of protocols emulated over pss fit
 	defaultCleanInterval       = time.Minute * 10
 	defaultOutboxCapacity      = 50
 	protocolName               = "pss"
@@ -94,6 +96,7 @@ type peer struct {
 type Params struct {
 	MsgTTL              time.Duration
 	CacheTTL            time.Duration
+	CacheCapacity       int // maximum number of message digests kept to suppress duplicates, 0 for no limit
 	privateKey          *ecdsa.PrivateKey
 	SymKeyCacheCapacity int
 	AllowRaw            bool // If true, enables sending and receiving messages without builtin pss encryption
@@ -123,8 +126,9 @@ type Pss struct {
 	forwardCache *ttlset.TTLSet
 	gcTicker     *ticker.Ticker
 
-	privateKey *ecdsa.PrivateKey // pss can have it's own independent key
-	auxAPIs    []rpc.API         // builtins (handshake, test) can add APIs
+	privateKey   *ecdsa.PrivateKey        // pss can have it's own independent key
+	auxAPIs      []rpc.API                // builtins (handshake, test) can add APIs
+	topicBlocked func(message.Topic) bool // topics rpc clients can not send or receive messages on, see SetTopicFilter
 
 	// sending and forwarding
 	peers   map[string]*protocols.Peer // keep track of all peers sitting on the pssmsg routing layer
@@ -139,6 +143,18 @@ type Pss struct {
 	handlersMu         sync.RWMutex
 	topicHandlerCaps   map[message.Topic]*handlerCaps // caches capabilities of each topic's handlers
 	topicHandlerCapsMu sync.RWMutex
+	topicPolicies      map[message.Topic]TopicPolicy // inbound policies of the topics that are not open
+	topicPoliciesMu    sync.RWMutex
+
+	// double ratchet states by peer public key and topic, see AddRatchet
+	ratchets     map[string]map[message.Topic]*ratchet.State
+	ratchetsMu   sync.Mutex
+	ratchetStore state.Store // persists the ratchet states, see SetRatchetStore
+	cacheStore   state.Store // persists the forward cache, see SetCacheStore
+
+	// liveness probes waiting for their reply by nonce, see Ping
+	probes   map[uint64]*pendingProbe
+	probesMu sync.Mutex
 
 	// process
 	quitC chan struct{}
@@ -177,10 +193,14 @@ func New(k *network.Kademlia, params *Params) (*Pss, error) {
 
 		handlers:         make(map[message.Topic]map[*handler]bool),
 		topicHandlerCaps: make(map[message.Topic]*handlerCaps),
+		topicPolicies:    make(map[message.Topic]TopicPolicy),
+		ratchets:         make(map[string]map[message.Topic]*ratchet.State),
+		probes:           make(map[uint64]*pendingProbe),
 	}
 	ps.forwardCache = ttlset.New(&ttlset.Config{
 		EntryTTL: params.CacheTTL,
 		Clock:    clock,
+		Capacity: params.CacheCapacity,
 	})
 	ps.gcTicker = ticker.New(&ticker.Config{
 		Clock:    clock,
@@ -188,6 +208,9 @@ func New(k *network.Kademlia, params *Params) (*Pss, error) {
 		Callback: func() {
 			ps.forwardCache.GC()
 			metrics.GetOrRegisterCounter("pss/cleanfwdcache", nil).Inc(1)
+			if err := ps.saveFwdCache(); err != nil {
+				log.Warn("pss forward cache not persisted", "err", err)
+			}
 		},
 	})
 	ps.outbox = outbox.NewOutbox(&outbox.Config{
@@ -239,6 +262,9 @@ func (p *Pss) Stop() error {
 	if err := p.gcTicker.Stop(); err != nil {
 		return err
 	}
+	if err := p.saveFwdCache(); err != nil {
+		log.Warn("pss forward cache not persisted", "err", err)
+	}
 	close(p.quitC)
 	p.outbox.Stop()
 	p.kademliaLB.Stop()
@@ -306,6 +332,20 @@ func (p *Pss) addAPI(api rpc.API) {
 	p.auxAPIs = append(p.auxAPIs, api)
 }
 
+// SetTopicFilter makes the pss API refuse to send and receive messages
+// on the topics for which blocked returns true
+// must be run before node is started
+func (p *Pss) SetTopicFilter(blocked func(message.Topic) bool) {
+	p.topicBlocked = blocked
+}
+
+// SetBandwidth sets the bandwidth manager limiting the traffic of the protocol,
+// including the chunks push synced over pss
+// must be run before node is started
+func (p *Pss) SetBandwidth(b *protocols.Bandwidth) {
+	spec.Bandwidth = b
+}
+
 // Returns the swarm Kademlia address of the pss node
 func (p *Pss) BaseAddr() []byte {
 	return p.Kademlia.BaseAddr()
@@ -473,13 +513,13 @@ func (p *Pss) handlePssMsg(ctx context.Context, pssmsg *message.Message) error {
 	isRecipient := p.isSelfPossibleRecipient(pssmsg, isProx)
 	if !isRecipient {
 		log.Trace("pss msg forwarding ===>", "pss", hex.EncodeToString(p.BaseAddr()), "prox", isProx)
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
 		return nil
 	}
 
 	log.Trace("pss msg processing <===", "pss", hex.EncodeToString(p.BaseAddr()), "prox", isProx, "raw", isRaw, "topic", label(pssmsg.Topic[:]))
 	if err := p.process(pssmsg, isRaw, isProx); err != nil {
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
 	}
 	return nil
 }
@@ -490,6 +530,10 @@ func (p *Pss) handlePssMsg(ctx context.Context, pssmsg *message.Message) error {
 func (p *Pss) process(pssmsg *message.Message, raw bool, prox bool) error {
 	defer metrics.GetOrRegisterResettingTimer("pss/process", nil).UpdateSince(time.Now())
 
+	if pssmsg.Topic == broadcastTopic {
+		return p.processBroadcast(pssmsg)
+	}
+
 	var payload []byte
 	var from PssAddress
 	var asymmetric bool
@@ -497,6 +541,7 @@ func (p *Pss) process(pssmsg *message.Message, raw bool, prox bool) error {
 	var keyFunc func(pssMsg *message.Message) ([]byte, string, PssAddress, error)
 
 	psstopic := pssmsg.Topic
+	hops := pssmsg.Flags.Hops
 
 	if raw {
 		payload = pssmsg.Payload
@@ -513,10 +558,23 @@ func (p *Pss) process(pssmsg *message.Message, raw bool, prox bool) error {
 		if err != nil {
 			return errors.New("decryption failed")
 		}
+		if asymmetric && psstopic != probeTopic {
+			payload, err = p.ratchetDecrypt(keyid, psstopic, payload)
+			if err != nil {
+				return errors.New("ratchet decryption failed")
+			}
+		}
 	}
 
 	if len(pssmsg.To) < addressLength || prox {
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
+	}
+	// probes are answered by pss itself and not passed to handlers
+	if asymmetric && psstopic == probeTopic {
+		if err := p.handleProbe(payload, keyid, hops); err != nil {
+			log.Debug("pss probe handling failed", "pubkey", keyid, "err", err)
+		}
+		return nil
 	}
 	p.executeHandlers(psstopic, payload, from, raw, prox, asymmetric, keyid)
 	return nil
@@ -537,6 +595,7 @@ func (p *Pss) executeHandlers(topic message.Topic, payload []byte, from PssAddre
 
 	handlers := p.getHandlers(topic)
 	peer := p2p.NewPeer(enode.ID{}, hex.EncodeToString(from), []p2p.Cap{})
+	allowed := p.isInboundAllowed(topic, raw, asymmetric, keyid)
 	for _, h := range handlers {
 		if !h.caps.raw && raw {
 			log.Warn("norawhandler")
@@ -546,6 +605,10 @@ func (p *Pss) executeHandlers(topic message.Topic, payload []byte, from PssAddre
 			log.Warn("noproxhandler")
 			continue
 		}
+		// key exchange handlers receive all messages so that handshakes can be established
+		if !allowed && !h.keyExchange {
+			continue
+		}
 		err := (h.f)(payload, peer, asymmetric, keyid)
 		if err != nil {
 			log.Warn("Pss handler failed", "err", err)
@@ -590,20 +653,60 @@ func (p *Pss) enqueue(msg *message.Message) {
 	p.outbox.Enqueue(outboxMsg)
 }
 
+// relay enqueues a received message for forwarding, unless it is out of hops
+func (p *Pss) relay(msg *message.Message) {
+	if msg.Flags.Hops > 0 {
+		if msg.Flags.Hops == 1 {
+			metrics.GetOrRegisterCounter("pss/hops/exceeded", nil).Inc(1)
+			log.Trace("pss msg out of hops, not forwarding", "pss", hex.EncodeToString(p.BaseAddr()), "to", hex.EncodeToString(msg.To))
+			return
+		}
+		msg.Flags.Hops--
+	}
+	p.enqueue(msg)
+}
+
+// SendRawOptions are the envelope settings of a raw message sent with SendRawExt
+type SendRawOptions struct {
+	Hops    uint8  // number of hops the message is forwarded at most, 0 for no limit
+	TTL     uint32 // seconds until the message expires, 0 for the default of the node
+	NoCache bool   // relays do not keep the message to retry forwarding it
+}
+
 // Send a raw message (any encryption is responsibility of calling client)
 //
 // Will fail if raw messages are disallowed
 func (p *Pss) SendRaw(address PssAddress, topic message.Topic, msg []byte, messageTTL time.Duration) error {
+	return p.sendRaw(address, topic, msg, message.Flags{Raw: true}, messageTTL)
+}
+
+// SendRawExt sends a raw message with the hop limit, the time to live and the caching
+// of the envelope set by the options
+func (p *Pss) SendRawExt(address PssAddress, topic message.Topic, msg []byte, opts *SendRawOptions) error {
+	flags := message.Flags{
+		Raw: true,
+	}
+	ttl := p.msgTTL
+	if opts != nil {
+		if opts.Hops > message.MaxHops {
+			return fmt.Errorf("hop limit %d larger than %d", opts.Hops, message.MaxHops)
+		}
+		flags.Hops = opts.Hops
+		flags.NoCache = opts.NoCache
+		if opts.TTL > 0 {
+			ttl = time.Duration(opts.TTL) * time.Second
+		}
+	}
+	return p.sendRaw(address, topic, msg, flags, ttl)
+}
+
+func (p *Pss) sendRaw(address PssAddress, topic message.Topic, msg []byte, pssMsgParams message.Flags, messageTTL time.Duration) error {
 	defer metrics.GetOrRegisterResettingTimer("pss/send/raw", nil).UpdateSince(time.Now())
 
 	if err := validateAddress(address); err != nil {
 		return err
 	}
 
-	pssMsgParams := message.Flags{
-		Raw: true,
-	}
-
 	pssMsg := message.New(pssMsgParams)
 	pssMsg.To = address
 	pssMsg.Expire = uint32(time.Now().Add(messageTTL).Unix())
@@ -642,6 +745,10 @@ func (p *Pss) SendAsym(pubkeyid string, topic message.Topic, msg []byte) error {
 	if !ok {
 		return fmt.Errorf("invalid topic '%s' for pubkey '%s'", topic.String(), pubkeyid)
 	}
+	msg, err := p.ratchetEncrypt(pubkeyid, topic, msg)
+	if err != nil {
+		return fmt.Errorf("ratchet encryption failed: %v", err)
+	}
 	return p.send(psp.address, topic, msg, true, common.FromHex(pubkeyid))
 }
 
@@ -650,10 +757,38 @@ func (p *Pss) SendAsym(pubkeyid string, topic message.Topic, msg []byte) error {
 // and wraps the message payload in it.
 // TODO: Implement proper message padding
 func (p *Pss) send(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+	return p.sendHops(to, topic, msg, asymmetric, key, 0)
+}
+
+// sendHops sends a message like send, forwarded at most the given number of hops, 0 for no limit
+func (p *Pss) sendHops(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte, hops uint8) error {
 	metrics.GetOrRegisterCounter("pss/send", nil).Inc(1)
 
+	envelope, err := p.wrap(msg, asymmetric, key)
+	if err != nil {
+		return err
+	}
+	log.Trace("pssmsg wrap done", "env", envelope, "mparams payload", hex.EncodeToString(msg), "to", hex.EncodeToString(to), "asym", asymmetric, "key", hex.EncodeToString(key))
+
+	// prepare for devp2p transport
+	pssMsgParams := message.Flags{
+		Symmetric: !asymmetric,
+		Hops:      hops,
+	}
+	pssMsg := message.New(pssMsgParams)
+	pssMsg.To = to
+	pssMsg.Expire = uint32(time.Now().Add(p.msgTTL).Unix())
+	pssMsg.Payload = envelope
+	pssMsg.Topic = topic
+
+	p.enqueue(pssMsg)
+	return nil
+}
+
+// wrap encrypts the message with the public key of the recipient or the symmetric key
+func (p *Pss) wrap(msg []byte, asymmetric bool, key []byte) ([]byte, error) {
 	if key == nil || bytes.Equal(key, []byte{}) {
-		return fmt.Errorf("Zero length key passed to pss send")
+		return nil, fmt.Errorf("Zero length key passed to pss send")
 	}
 	wrapParams := &crypto.WrapParams{
 		Sender: p.privateKey,
@@ -661,7 +796,7 @@ func (p *Pss) send(to []byte, topic message.Topic, msg []byte, asymmetric bool,
 	if asymmetric {
 		pk, err := p.Crypto.UnmarshalPublicKey(key)
 		if err != nil {
-			return fmt.Errorf("Cannot unmarshal pubkey: %x", key)
+			return nil, fmt.Errorf("Cannot unmarshal pubkey: %x", key)
 		}
 		wrapParams.Receiver = pk
 	} else {
@@ -670,22 +805,9 @@ func (p *Pss) send(to []byte, topic message.Topic, msg []byte, asymmetric bool,
 	// set up outgoing message container, which does encryption and envelope wrapping
 	envelope, err := p.Crypto.Wrap(msg, wrapParams)
 	if err != nil {
-		return fmt.Errorf("failed to perform message encapsulation and encryption: %v", err)
-	}
-	log.Trace("pssmsg wrap done", "env", envelope, "mparams payload", hex.EncodeToString(msg), "to", hex.EncodeToString(to), "asym", asymmetric, "key", hex.EncodeToString(key))
-
-	// prepare for devp2p transport
-	pssMsgParams := message.Flags{
-		Symmetric: !asymmetric,
+		return nil, fmt.Errorf("failed to perform message encapsulation and encryption: %v", err)
 	}
-	pssMsg := message.New(pssMsgParams)
-	pssMsg.To = to
-	pssMsg.Expire = uint32(time.Now().Add(p.msgTTL).Unix())
-	pssMsg.Payload = envelope
-	pssMsg.Topic = topic
-
-	p.enqueue(pssMsg)
-	return nil
+	return envelope, nil
 }
 
 // sendFunc is a helper function that tries to send a message and returns true on success.
@@ -743,6 +865,13 @@ func (p *Pss) forward(msg *message.Message) error {
 	// luminosity is the opposite of darkness. the more bytes are removed from the address, the higher is darkness,
 	// but the luminosity is less. here luminosity equals the number of bits given in the destination address.
 	luminosityRadius := len(msg.To) * 8
+	// broadcasts light up all the bits of the target address in their envelope
+	if msg.Topic == broadcastTopic {
+		if bmsg, err := decodeBroadcast(msg); err == nil {
+			to = broadcastTarget(bmsg)
+			luminosityRadius = int(bmsg.PO)
+		}
+	}
 
 	// proximity order function matching up to neighbourhoodDepth bits (po <= neighbourhoodDepth)
 	pof := pot.DefaultPof(neighbourhoodDepth)
@@ -769,6 +898,10 @@ func (p *Pss) forward(msg *message.Message) error {
 			return false
 		}
 		for _, lbPeer := range bin.LBPeers {
+			// peers not relaying pss messages are only sent the messages addressed to them
+			if bin.ProximityOrder < luminosityRadius && !network.IsPssRelay(lbPeer.Peer.BzzAddr) {
+				continue
+			}
 			if sendFunc(p, lbPeer.Peer, msg) {
 				lbPeer.AddUseCount()
 				sent++
@@ -102,6 +102,125 @@ func TestAPITopic(t *testing.T) {
 	}
 }
 
+// TestTopicPolicy tests that the inbound policies of topics are enforced before the handlers run
+func TestTopicPolicy(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	if err := SetHandshakeController(ps, NewHandshakeParams()); err != nil {
+		t.Fatal(err)
+	}
+
+	topic := message.NewTopic([]byte("policy"))
+	var handled int
+	ps.Register(&topic, NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
+		handled++
+		return nil
+	}).WithRaw())
+
+	peerKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.SetPeerPublicKey(&peerKey.PublicKey, topic, PssAddress{}); err != nil {
+		t.Fatal(err)
+	}
+	knownPubKey := common.ToHex(ps.Crypto.SerializePublicKey(&peerKey.PublicKey))
+	knownSymKey, err := ps.GenerateSymmetricKey(topic, PssAddress{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshakeSymKey, err := ps.GenerateSymmetricKey(topic, PssAddress{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrlSingleton.symKeyIndex[handshakeSymKey] = &handshakeKey{symKeyID: &handshakeSymKey, limit: 10}
+
+	type msg struct {
+		raw, asymmetric bool
+		keyid           string
+	}
+	raw := msg{raw: true}
+	unknownAsym := msg{asymmetric: true, keyid: "0x1234"}
+	knownAsym := msg{asymmetric: true, keyid: knownPubKey}
+	knownSym := msg{keyid: knownSymKey}
+	handshakeSym := msg{keyid: handshakeSymKey}
+
+	for _, tc := range []struct {
+		policy  TopicPolicy
+		allowed []msg
+		refused []msg
+	}{
+		{
+			policy:  TopicPolicyOpen,
+			allowed: []msg{raw, unknownAsym, knownAsym, knownSym, handshakeSym},
+		},
+		{
+			policy:  TopicPolicyKnownKeys,
+			allowed: []msg{knownAsym, knownSym, handshakeSym},
+			refused: []msg{raw, unknownAsym},
+		},
+		{
+			policy:  TopicPolicyHandshake,
+			allowed: []msg{handshakeSym},
+			refused: []msg{raw, unknownAsym, knownAsym, knownSym},
+		},
+	} {
+		if err := ps.SetTopicPolicy(topic, tc.policy); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range tc.allowed {
+			handled = 0
+			ps.executeHandlers(topic, []byte("hello"), nil, m.raw, false, m.asymmetric, m.keyid)
+			if handled != 1 {
+				t.Fatalf("policy %s: message %+v not handled", tc.policy, m)
+			}
+		}
+		for _, m := range tc.refused {
+			handled = 0
+			ps.executeHandlers(topic, []byte("hello"), nil, m.raw, false, m.asymmetric, m.keyid)
+			if handled != 0 {
+				t.Fatalf("policy %s: message %+v handled", tc.policy, m)
+			}
+		}
+	}
+
+	if err := ps.SetTopicPolicy(topic, "closed"); err == nil {
+		t.Fatal("expected error for invalid policy")
+	}
+	if policies := ps.GetTopicPolicies(); len(policies) != 1 || policies[topic] != TopicPolicyHandshake {
+		t.Fatalf("got policies %v, want %s for topic", policies, TopicPolicyHandshake)
+	}
+}
+
+// TestAPITopicFilter tests that the API refuses to send messages on blocked topics
+func TestAPITopicFilter(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+
+	blocked := message.NewTopic([]byte("blocked"))
+	allowed := message.NewTopic([]byte("allowed"))
+	ps.SetTopicFilter(func(topic message.Topic) bool {
+		return topic == blocked
+	})
+	api := NewAPI(ps)
+
+	err = api.SendRaw(hexutil.Bytes{}, blocked, hexutil.Bytes("hello"))
+	if err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Fatalf("expected blocked topic error, got %v", err)
+	}
+	if err := api.checkTopic(allowed); err != nil {
+		t.Fatalf("allowed topic: %v", err)
+	}
+}
+
 // test if we can insert into cache, match items with cache and cache expiry
 
 // matching of address hints; whether a message could be or is for the node
@@ -154,6 +273,86 @@ func TestAddressMatch(t *testing.T) {
 
 }
 
+// verifies that relayed messages are forwarded with one less hop until they run out of hops,
+// and that the envelope settings of raw messages are applied on send
+func TestHopLimit(t *testing.T) {
+	localaddr := network.RandomBzzAddr().Over()
+	kad := network.NewKademlia(localaddr, network.NewKadParams())
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Could not generate private key: %v", err)
+	}
+	ps, err := New(kad, NewParams().WithPrivateKey(privkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwardC := make(chan *message.Message, 1)
+	ps.outbox.SetForward(func(msg *message.Message) error {
+		forwardC <- msg
+		return nil
+	})
+	ps.outbox.Start()
+	defer ps.outbox.Stop()
+
+	remoteaddr := make([]byte, len(localaddr))
+	copy(remoteaddr, localaddr)
+	remoteaddr[0] ^= 0x80
+
+	for i, tc := range []struct {
+		hops    uint8
+		forward bool
+		want    uint8
+	}{
+		{hops: 0, forward: true, want: 0},
+		{hops: 3, forward: true, want: 2},
+		{hops: 2, forward: true, want: 1},
+		{hops: 1, forward: false},
+	} {
+		msg := &message.Message{
+			To:      remoteaddr,
+			Flags:   message.Flags{Raw: true, Hops: tc.hops},
+			Expire:  uint32(time.Now().Add(time.Minute).Unix()),
+			Payload: []byte{byte(i)},
+		}
+		if err := ps.handlePssMsg(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-forwardC:
+			if !tc.forward {
+				t.Fatalf("message with %d hops forwarded", tc.hops)
+			}
+			if msg.Flags.Hops != tc.want {
+				t.Fatalf("message with %d hops forwarded with %d hops, want %d", tc.hops, msg.Flags.Hops, tc.want)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if tc.forward {
+				t.Fatalf("message with %d hops not forwarded", tc.hops)
+			}
+		}
+	}
+
+	err = ps.SendRawExt(remoteaddr, message.Topic{}, []byte("foo"), &SendRawOptions{Hops: message.MaxHops + 1})
+	if err == nil {
+		t.Fatal("expected error on send with too large hop limit")
+	}
+	err = ps.SendRawExt(remoteaddr, message.Topic{}, []byte("foo"), &SendRawOptions{Hops: 5, TTL: 3600, NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-forwardC:
+		if msg.Flags.Hops != 5 || !msg.Flags.NoCache || !msg.Flags.Raw {
+			t.Fatalf("got flags %+v", msg.Flags)
+		}
+		if expire := int64(msg.Expire) - time.Now().Unix(); expire < 3590 || expire > 3600 {
+			t.Fatalf("got message expiring in %ds, want 3600s", expire)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not sent")
+	}
+}
+
 // verify that node can be set as recipient regardless of explicit message address match if minimum one handler of a topic is explicitly set to allow it
 // note that in these tests we use the raw capability on handlers for convenience
 func TestAddressMatchProx(t *testing.T) {
@@ -0,0 +1,211 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/pss/ratchet"
+	"github.com/ethersphere/swarm/state"
+)
+
+// prefix of the state store keys of the ratchet states
+const ratchetStorePrefix = "pss_ratchet_"
+
+// ratchet state of a conversation persisted in the state store,
+// encrypted with a key derived from the private key of the node
+type ratchetRecord struct {
+	PubKey string
+	Topic  message.Topic
+	State  []byte
+}
+
+// SetRatchetStore sets the store the ratchet states are persisted in and loads the
+// states persisted before, it must be called before the pss node service is started
+func (p *Pss) SetRatchetStore(store state.Store) error {
+	p.ratchetsMu.Lock()
+	defer p.ratchetsMu.Unlock()
+	p.ratchetStore = store
+	return store.Iterate(ratchetStorePrefix, func(key, value []byte) (bool, error) {
+		var r ratchetRecord
+		if err := json.Unmarshal(value, &r); err != nil {
+			return true, err
+		}
+		data, err := p.ratchetCipher(false, r.State)
+		if err != nil {
+			return true, fmt.Errorf("ratchet state %s: %v", key, err)
+		}
+		s := new(ratchet.State)
+		if err := rlp.DecodeBytes(data, s); err != nil {
+			return true, err
+		}
+		if p.ratchets[r.PubKey] == nil {
+			p.ratchets[r.PubKey] = make(map[message.Topic]*ratchet.State)
+		}
+		p.ratchets[r.PubKey][r.Topic] = s
+		return false, nil
+	})
+}
+
+// AddRatchet enables the double ratchet mode of the asymmetric messages exchanged with
+// the peer (public key) on the topic. The peer must enable it for this node as well.
+//
+// Each message is encrypted with a new key evolved from the previous ones, before it is
+// encrypted for the peer, so that compromised keys do not reveal past messages.
+// The messages are sent and received as usual, see SendAsym.
+func (p *Pss) AddRatchet(pubkeyid string, topic message.Topic) error {
+	pubkey, err := p.Crypto.UnmarshalPublicKey(common.FromHex(pubkeyid))
+	if err != nil {
+		return fmt.Errorf("Cannot unmarshal pubkey: %x", pubkeyid)
+	}
+	pubkeyid = common.ToHex(p.Crypto.SerializePublicKey(pubkey))
+
+	p.ratchetsMu.Lock()
+	defer p.ratchetsMu.Unlock()
+	if _, ok := p.ratchets[pubkeyid][topic]; ok {
+		return nil
+	}
+	s, err := ratchet.New(p.privateKey, pubkey, topic[:])
+	if err != nil {
+		return err
+	}
+	if err := p.saveRatchet(pubkeyid, topic, s); err != nil {
+		return err
+	}
+	if p.ratchets[pubkeyid] == nil {
+		p.ratchets[pubkeyid] = make(map[message.Topic]*ratchet.State)
+	}
+	p.ratchets[pubkeyid][topic] = s
+	return nil
+}
+
+// RemoveRatchet disables the double ratchet mode with the peer (public key) on the topic
+// and removes its state
+func (p *Pss) RemoveRatchet(pubkeyid string, topic message.Topic) error {
+	pubkeyid = strings.ToLower(pubkeyid)
+	p.ratchetsMu.Lock()
+	defer p.ratchetsMu.Unlock()
+	if _, ok := p.ratchets[pubkeyid][topic]; !ok {
+		return fmt.Errorf("no ratchet with %s on topic %s", pubkeyid, topic)
+	}
+	delete(p.ratchets[pubkeyid], topic)
+	if len(p.ratchets[pubkeyid]) == 0 {
+		delete(p.ratchets, pubkeyid)
+	}
+	if p.ratchetStore == nil {
+		return nil
+	}
+	return p.ratchetStore.Delete(ratchetStoreKey(pubkeyid, topic))
+}
+
+// ratchetEncrypt encrypts the message to the peer (public key) on the topic with the next
+// ratchet key, messages of conversations without the ratchet mode are returned as they are
+func (p *Pss) ratchetEncrypt(pubkeyid string, topic message.Topic, msg []byte) ([]byte, error) {
+	pubkeyid = strings.ToLower(pubkeyid)
+	p.ratchetsMu.Lock()
+	defer p.ratchetsMu.Unlock()
+	s, ok := p.ratchets[pubkeyid][topic]
+	if !ok {
+		return msg, nil
+	}
+	msg, err := s.Encrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, p.saveRatchet(pubkeyid, topic, s)
+}
+
+// ratchetDecrypt decrypts the payload of a message from the peer (public key) on the topic,
+// payloads of conversations without the ratchet mode are returned as they are
+func (p *Pss) ratchetDecrypt(pubkeyid string, topic message.Topic, payload []byte) ([]byte, error) {
+	p.ratchetsMu.Lock()
+	defer p.ratchetsMu.Unlock()
+	s, ok := p.ratchets[pubkeyid][topic]
+	if !ok {
+		return payload, nil
+	}
+	payload, err := s.Decrypt(payload)
+	if err != nil {
+		metrics.GetOrRegisterCounter("pss/process/ratchet/fail", nil).Inc(1)
+		log.Warn("pss ratchet decryption failed", "pubkey", pubkeyid, "topic", topic, "err", err)
+		return nil, err
+	}
+	if err := p.saveRatchet(pubkeyid, topic, s); err != nil {
+		log.Error("pss ratchet state not saved", "pubkey", pubkeyid, "topic", topic, "err", err)
+	}
+	return payload, nil
+}
+
+// saveRatchet persists the ratchet state encrypted in the ratchet store, if there is one
+func (p *Pss) saveRatchet(pubkeyid string, topic message.Topic, s *ratchet.State) error {
+	if p.ratchetStore == nil {
+		return nil
+	}
+	data, err := rlp.EncodeToBytes(s)
+	if err != nil {
+		return err
+	}
+	data, err = p.ratchetCipher(true, data)
+	if err != nil {
+		return err
+	}
+	return p.ratchetStore.Put(ratchetStoreKey(pubkeyid, topic), &ratchetRecord{
+		PubKey: pubkeyid,
+		Topic:  topic,
+		State:  data,
+	})
+}
+
+// ratchetCipher encrypts or decrypts persisted ratchet states
+// with AES-GCM keyed with the hash of the private key of the node
+func (p *Pss) ratchetCipher(encrypt bool, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(ethCrypto.Keccak256(ethCrypto.FromECDSA(p.privateKey), []byte("pss ratchet state")))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if encrypt {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := crand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return aead.Seal(nonce, nonce, data, nil), nil
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ratchet state too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func ratchetStoreKey(pubkeyid string, topic message.Topic) string {
+	return ratchetStorePrefix + pubkeyid + "_" + topic.String()
+}
@@ -0,0 +1,342 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ratchet implements the double ratchet key evolution of the messages
+// of a pss conversation between two parties.
+//
+// Every message is encrypted with its own key derived from a chain key, which
+// advances with every message. Whenever a party receives a message with a new
+// ratchet key of its peer, it starts new chains from a Diffie-Hellman exchange
+// with a new key pair of its own. Compromised keys reveal neither past messages,
+// nor, once the ratchet turned, future ones.
+//
+// The secret the states start from is derived from the keys of the parties. The
+// party with the smaller public key starts the first ratchet; the other party can
+// send its first messages on a chain derived from the secret only, until it
+// receives a message.
+package ratchet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// MaxSkip is the maximum number of message keys of missed messages kept
+// to decrypt the messages when they arrive out of order
+const MaxSkip = 1000
+
+const keyLength = 32
+
+var (
+	ErrTooManySkipped = errors.New("too many skipped messages")
+	ErrDecrypt        = errors.New("message decryption failed")
+)
+
+var (
+	infoSecret    = []byte("pss ratchet secret")
+	infoRoot      = []byte("pss ratchet root")
+	infoResponder = []byte("pss ratchet responder")
+	infoMessage   = []byte("pss ratchet message")
+)
+
+// State is the ratchet state of a party of a conversation
+type State struct {
+	RootKey   []byte
+	SendChain []byte
+	RecvChain []byte
+	SendKey   []byte // private key of the ratchet key pair of the party
+	RecvKey   []byte // compressed public ratchet key of the peer
+	SendN     uint32 // number of messages sent on the sending chain
+	RecvN     uint32 // number of messages received on the receiving chain
+	PrevN     uint32 // number of messages sent on the previous sending chain
+	Skipped   []SkippedKey
+}
+
+// SkippedKey is the message key of a message not received yet
+type SkippedKey struct {
+	RatchetKey []byte
+	N          uint32
+	Key        []byte
+}
+
+// header of a message, authenticated along with the payload
+type header struct {
+	RatchetKey []byte
+	PrevN      uint32
+	N          uint32
+}
+
+// encrypted message
+type envelope struct {
+	Header     header
+	Ciphertext []byte
+}
+
+// New creates the ratchet state of the party with the key of a conversation with
+// the peer, the info binds the conversation to a context both parties share
+func New(key *ecdsa.PrivateKey, peer *ecdsa.PublicKey, info []byte) (*State, error) {
+	shared, err := dh(key, peer)
+	if err != nil {
+		return nil, err
+	}
+	secret := kdf(info, shared, infoSecret, keyLength)
+	responderChain := kdf(nil, secret, infoResponder, keyLength)
+
+	s := &State{
+		RootKey: secret,
+	}
+	if bytes.Compare(ethCrypto.CompressPubkey(&key.PublicKey), ethCrypto.CompressPubkey(peer)) > 0 {
+		// the responder sends on the chain derived from the secret until it receives a message
+		s.SendKey = ethCrypto.FromECDSA(key)
+		s.SendChain = responderChain
+		return s, nil
+	}
+	// the initiator starts the first ratchet and receives the first messages of the responder
+	// on the chain derived from the secret
+	ratchetKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	shared, err = dh(ratchetKey, peer)
+	if err != nil {
+		return nil, err
+	}
+	s.RootKey, s.SendChain = kdfRoot(secret, shared)
+	s.SendKey = ethCrypto.FromECDSA(ratchetKey)
+	s.RecvKey = ethCrypto.CompressPubkey(peer)
+	s.RecvChain = responderChain
+	return s, nil
+}
+
+// Encrypt encrypts the message with the next key of the sending chain
+func (s *State) Encrypt(msg []byte) ([]byte, error) {
+	key, err := ethCrypto.ToECDSA(s.SendKey)
+	if err != nil {
+		return nil, err
+	}
+	h := header{
+		RatchetKey: ethCrypto.CompressPubkey(&key.PublicKey),
+		PrevN:      s.PrevN,
+		N:          s.SendN,
+	}
+	ad, err := rlp.EncodeToBytes(&h)
+	if err != nil {
+		return nil, err
+	}
+	var messageKey []byte
+	messageKey, s.SendChain = kdfChain(s.SendChain)
+	s.SendN++
+	ciphertext, err := seal(messageKey, msg, ad)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(&envelope{
+		Header:     h,
+		Ciphertext: ciphertext,
+	})
+}
+
+// Decrypt decrypts the message, advancing the ratchet if the message carries a new
+// ratchet key of the peer. The state is only changed if the message is decrypted.
+func (s *State) Decrypt(data []byte) ([]byte, error) {
+	var e envelope
+	if err := rlp.DecodeBytes(data, &e); err != nil {
+		return nil, err
+	}
+	ad, err := rlp.EncodeToBytes(&e.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	// messages arriving out of order
+	for i, skipped := range s.Skipped {
+		if skipped.N == e.Header.N && bytes.Equal(skipped.RatchetKey, e.Header.RatchetKey) {
+			msg, err := open(skipped.Key, e.Ciphertext, ad)
+			if err != nil {
+				return nil, err
+			}
+			s.Skipped = append(s.Skipped[:i:i], s.Skipped[i+1:]...)
+			return msg, nil
+		}
+	}
+
+	next := s.clone()
+	if !bytes.Equal(e.Header.RatchetKey, next.RecvKey) {
+		if err := next.skip(e.Header.PrevN); err != nil {
+			return nil, err
+		}
+		if err := next.ratchet(e.Header.RatchetKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := next.skip(e.Header.N); err != nil {
+		return nil, err
+	}
+	var messageKey []byte
+	messageKey, next.RecvChain = kdfChain(next.RecvChain)
+	next.RecvN++
+	msg, err := open(messageKey, e.Ciphertext, ad)
+	if err != nil {
+		return nil, err
+	}
+	*s = *next
+	return msg, nil
+}
+
+// skip keeps the message keys of the receiving chain up to the message n
+func (s *State) skip(n uint32) error {
+	if len(s.RecvChain) == 0 {
+		return nil
+	}
+	if n > s.RecvN+MaxSkip {
+		return ErrTooManySkipped
+	}
+	for ; s.RecvN < n; s.RecvN++ {
+		var messageKey []byte
+		messageKey, s.RecvChain = kdfChain(s.RecvChain)
+		s.Skipped = append(s.Skipped, SkippedKey{
+			RatchetKey: s.RecvKey,
+			N:          s.RecvN,
+			Key:        messageKey,
+		})
+	}
+	if len(s.Skipped) > MaxSkip {
+		s.Skipped = s.Skipped[len(s.Skipped)-MaxSkip:]
+	}
+	return nil
+}
+
+// ratchet starts new chains with the new ratchet key of the peer
+func (s *State) ratchet(peerKey []byte) error {
+	peer, err := ethCrypto.DecompressPubkey(peerKey)
+	if err != nil {
+		return err
+	}
+	key, err := ethCrypto.ToECDSA(s.SendKey)
+	if err != nil {
+		return err
+	}
+	shared, err := dh(key, peer)
+	if err != nil {
+		return err
+	}
+	s.PrevN = s.SendN
+	s.SendN = 0
+	s.RecvN = 0
+	s.RecvKey = peerKey
+	s.RootKey, s.RecvChain = kdfRoot(s.RootKey, shared)
+
+	key, err = ethCrypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	shared, err = dh(key, peer)
+	if err != nil {
+		return err
+	}
+	s.SendKey = ethCrypto.FromECDSA(key)
+	s.RootKey, s.SendChain = kdfRoot(s.RootKey, shared)
+	return nil
+}
+
+func (s *State) clone() *State {
+	c := *s
+	c.Skipped = append([]SkippedKey(nil), s.Skipped...)
+	return &c
+}
+
+// dh returns the Diffie-Hellman shared secret of the key pairs
+func dh(key *ecdsa.PrivateKey, peer *ecdsa.PublicKey) ([]byte, error) {
+	return ecies.ImportECDSA(key).GenerateShared(ecies.ImportECDSAPublic(peer), keyLength, 0)
+}
+
+// kdfRoot derives the next root key and a chain key from the root key and a shared secret
+func kdfRoot(rootKey, shared []byte) ([]byte, []byte) {
+	out := kdf(rootKey, shared, infoRoot, 2*keyLength)
+	return out[:keyLength], out[keyLength:]
+}
+
+// kdfChain derives the message key and the next chain key from a chain key
+func kdfChain(chainKey []byte) ([]byte, []byte) {
+	return hmacSum(chainKey, []byte{1}), hmacSum(chainKey, []byte{2})
+}
+
+// kdf is the HMAC-SHA256 based key derivation function of RFC 5869
+func kdf(salt, secret, info []byte, length int) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	prk := hmacSum(salt, secret)
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		t = hmacSum(prk, t, info, []byte{i})
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+func hmacSum(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// seal encrypts and authenticates the message and the associated data
+// with the AES-GCM key and nonce derived from the message key
+func seal(messageKey, msg, ad []byte) ([]byte, error) {
+	aead, nonce, err := newAEAD(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, msg, ad), nil
+}
+
+// open decrypts and authenticates a message encrypted with seal
+func open(messageKey, ciphertext, ad []byte) ([]byte, error) {
+	aead, nonce, err := newAEAD(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return msg, nil
+}
+
+func newAEAD(messageKey []byte) (cipher.AEAD, []byte, error) {
+	out := kdf(nil, messageKey, infoMessage, keyLength+12)
+	block, err := aes.NewCipher(out[:keyLength])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, out[keyLength:], nil
+}
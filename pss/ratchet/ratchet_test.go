@@ -0,0 +1,184 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package ratchet
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func newStates(t *testing.T) (*State, *State) {
+	t.Helper()
+	keyA, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(keyA, &keyB.PublicKey, []byte("topic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(keyB, &keyA.PublicKey, []byte("topic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func send(t *testing.T, s *State, msg string) []byte {
+	t.Helper()
+	data, err := s.Encrypt([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func receive(t *testing.T, s *State, data []byte, want string) {
+	t.Helper()
+	msg, err := s.Decrypt(data)
+	if err != nil {
+		t.Fatalf("decrypting %q: %v", want, err)
+	}
+	if string(msg) != want {
+		t.Fatalf("got message %q, want %q", msg, want)
+	}
+}
+
+// TestConversation tests that either party can send first and that the parties
+// exchange messages in both directions, in and out of order
+func TestConversation(t *testing.T) {
+	for _, first := range []int{0, 1} {
+		t.Run(fmt.Sprintf("party %d first", first), func(t *testing.T) {
+			a, b := newStates(t)
+			parties := []*State{a, b}
+			from, to := parties[first], parties[1-first]
+
+			receive(t, to, send(t, from, "1"), "1")
+			receive(t, to, send(t, from, "2"), "2")
+			receive(t, from, send(t, to, "3"), "3")
+
+			// out of order, across a ratchet
+			m4 := send(t, to, "4")
+			m5 := send(t, to, "5")
+			receive(t, to, send(t, from, "6"), "6")
+			m7 := send(t, to, "7")
+			receive(t, from, m7, "7")
+			receive(t, from, m5, "5")
+			receive(t, from, m4, "4")
+			if len(from.Skipped) != 0 {
+				t.Fatalf("got %d skipped keys, want none", len(from.Skipped))
+			}
+		})
+	}
+}
+
+// TestResponderFirst tests that the messages the responder sends before receiving
+// are decrypted after its first ratchet
+func TestResponderFirst(t *testing.T) {
+	a, b := newStates(t)
+	initiator, responder := a, b
+	if len(a.RecvChain) == 0 {
+		initiator, responder = b, a
+	}
+	m1 := send(t, responder, "1")
+	receive(t, responder, send(t, initiator, "2"), "2")
+	receive(t, initiator, send(t, responder, "3"), "3")
+	receive(t, initiator, m1, "1")
+}
+
+// TestForwardSecrecy tests that the keys of decrypted messages are not kept
+func TestForwardSecrecy(t *testing.T) {
+	a, b := newStates(t)
+	m := send(t, a, "1")
+	receive(t, b, m, "1")
+	if _, err := b.Decrypt(m); err == nil {
+		t.Fatal("expected error decrypting a message again")
+	}
+	// the keys of the state after the ratchet do not decrypt the messages before
+	receive(t, a, send(t, b, "2"), "2")
+	receive(t, b, send(t, a, "3"), "3")
+	for _, s := range []*State{a, b} {
+		if _, err := s.clone().Decrypt(m); err == nil {
+			t.Fatal("expected error decrypting an old message")
+		}
+	}
+}
+
+// TestInvalid tests that messages failing to decrypt leave the state unchanged
+func TestInvalid(t *testing.T) {
+	a, b := newStates(t)
+	receive(t, b, send(t, a, "1"), "1")
+
+	m := send(t, a, "2")
+	tampered := append([]byte(nil), m...)
+	tampered[len(tampered)-1] ^= 1
+	before, err := rlp.EncodeToBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Decrypt(tampered); err != ErrDecrypt {
+		t.Fatalf("got error %v, want %v", err, ErrDecrypt)
+	}
+	after, err := rlp.EncodeToBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("state changed by invalid message")
+	}
+	receive(t, b, m, "2")
+
+	var e envelope
+	if err := rlp.DecodeBytes(send(t, a, "3"), &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Header.N += MaxSkip + 1
+	data, err := rlp.EncodeToBytes(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Decrypt(data); err != ErrTooManySkipped {
+		t.Fatalf("got error %v, want %v", err, ErrTooManySkipped)
+	}
+}
+
+// TestEncoding tests that the states continue the conversation after encoding
+func TestEncoding(t *testing.T) {
+	a, b := newStates(t)
+	for i := 0; i < 3; i++ {
+		data, err := rlp.EncodeToBytes(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a = new(State)
+		if err := rlp.DecodeBytes(data, a); err != nil {
+			t.Fatal(err)
+		}
+		m := send(t, a, "a")
+		send(t, a, "lost")
+		receive(t, b, m, "a")
+		a, b = b, a
+	}
+}
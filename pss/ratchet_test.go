@@ -0,0 +1,161 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+// ratchet test node, forwarding the messages it sends on the channel
+// and receiving the messages on the topic on another one
+type ratchetNode struct {
+	*Pss
+	key      *ecdsa.PrivateKey
+	pubkeyid string
+	sentC    chan *message.Message
+	recvC    chan []byte
+}
+
+func newRatchetNode(t *testing.T, key *ecdsa.PrivateKey, store state.Store, topic message.Topic) *ratchetNode {
+	t.Helper()
+	ps := newTestPssStart(key, nil, nil, false)
+	if ps == nil {
+		t.Fatal("could not create pss")
+	}
+	n := &ratchetNode{
+		Pss:      ps,
+		key:      key,
+		pubkeyid: common.ToHex(ethCrypto.FromECDSAPub(&key.PublicKey)),
+		sentC:    make(chan *message.Message, 1),
+		recvC:    make(chan []byte, 1),
+	}
+	ps.outbox.SetForward(func(msg *message.Message) error {
+		n.sentC <- msg
+		return nil
+	})
+	ps.outbox.Start()
+	if err := ps.SetRatchetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	ps.Register(&topic, NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
+		n.recvC <- msg
+		return nil
+	}))
+	return n
+}
+
+// sends the message from the node to the other one and checks that it is received
+func (n *ratchetNode) send(t *testing.T, to *ratchetNode, topic message.Topic, msg string) {
+	t.Helper()
+	if err := n.SendAsym(to.pubkeyid, topic, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	var pssmsg *message.Message
+	select {
+	case pssmsg = <-n.sentC:
+	case <-time.After(time.Second):
+		t.Fatal("message not sent")
+	}
+	// the asymmetrically encrypted payload is encrypted with the ratchet
+	payload, _, _, err := to.processAsym(pssmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(payload, []byte(msg)) {
+		t.Fatalf("message %q not encrypted with the ratchet", msg)
+	}
+	if err := to.handlePssMsg(context.Background(), pssmsg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-to.recvC:
+		if string(got) != msg {
+			t.Fatalf("got message %q, want %q", got, msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("message %q not received", msg)
+	}
+}
+
+// TestRatchet tests the exchange of asymmetric messages in the double ratchet mode
+// and that the ratchet states are persisted
+func TestRatchet(t *testing.T) {
+	topic := message.NewTopic([]byte("ratchet"))
+	keyA, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeA := state.NewInmemoryStore()
+	defer storeA.Close()
+	storeB := state.NewInmemoryStore()
+	defer storeB.Close()
+
+	a := newRatchetNode(t, keyA, storeA, topic)
+	defer a.outbox.Stop()
+	b := newRatchetNode(t, keyB, storeB, topic)
+	defer b.outbox.Stop()
+
+	for _, n := range []struct{ self, peer *ratchetNode }{{a, b}, {b, a}} {
+		if err := n.self.SetPeerPublicKey(&n.peer.key.PublicKey, topic, n.peer.BaseAddr()); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.self.AddRatchet(n.peer.pubkeyid, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a.send(t, b, topic, "one")
+	b.send(t, a, topic, "two")
+	a.send(t, b, topic, "three")
+
+	// the ratchet state is loaded from the store on restart
+	b2 := newRatchetNode(t, keyB, storeB, topic)
+	defer b2.outbox.Stop()
+	a.send(t, b2, topic, "four")
+	if err := b2.SetPeerPublicKey(&keyA.PublicKey, topic, a.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	b2.send(t, a, topic, "five")
+
+	if err := b2.RemoveRatchet(a.pubkeyid, topic); err != nil {
+		t.Fatal(err)
+	}
+	var stored int
+	if err := storeB.Iterate(ratchetStorePrefix, func(key, value []byte) (bool, error) {
+		stored++
+		return false, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Fatalf("got %d stored ratchet states, want none", stored)
+	}
+}
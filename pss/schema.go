@@ -0,0 +1,97 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !nopssprotocol
+
+package pss
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/log"
+)
+
+// MessageSchema constrains the payloads accepted for a message code of a pss protocol
+//
+// Payloads of peers not satisfying the schema are rejected before they reach
+// the protocol handlers
+type MessageSchema struct {
+	MinSize  uint32                      // minimum size of the RLP payload in bytes
+	MaxSize  uint32                      // maximum size of the RLP payload in bytes, 0 for no limit
+	Decode   bool                        // whether the payload must RLP decode into the message type of the code in the protocol spec
+	Validate func(msg interface{}) error // optional check of the decoded message, implies Decode
+}
+
+// RegisterSchema sets the schema for the payloads of the message code
+// a nil schema removes the constraints of the code
+func (p *Protocol) RegisterSchema(code uint64, schema *MessageSchema) error {
+	if code >= p.spec.Length() {
+		return fmt.Errorf("unknown message code %d for protocol %s", code, p.spec.Name)
+	}
+	if schema != nil && schema.MaxSize > 0 && schema.MinSize > schema.MaxSize {
+		return fmt.Errorf("minimum payload size %d exceeds maximum %d", schema.MinSize, schema.MaxSize)
+	}
+	p.schemaMu.Lock()
+	defer p.schemaMu.Unlock()
+	if schema == nil {
+		delete(p.schemas, code)
+		return nil
+	}
+	p.schemas[code] = schema
+	return nil
+}
+
+// checkSchema validates the payload of a message with the schema registered for its code
+// messages of codes without a schema are accepted
+func (p *Protocol) checkSchema(msg *ProtocolMsg) error {
+	p.schemaMu.RLock()
+	schema := p.schemas[msg.Code]
+	p.schemaMu.RUnlock()
+	if schema == nil {
+		return nil
+	}
+	err := schema.check(p, msg)
+	if err != nil {
+		log.Debug("rejecting pss protocol message", "protocol", p.spec.Name, "code", msg.Code, "err", err)
+		metrics.GetOrRegisterCounter(fmt.Sprintf("pss/protocol/%s/%d/rejected", p.spec.Name, msg.Code), nil).Inc(1)
+	}
+	return err
+}
+
+func (s *MessageSchema) check(p *Protocol, msg *ProtocolMsg) error {
+	size := uint32(len(msg.Payload))
+	if size < s.MinSize || s.MaxSize > 0 && size > s.MaxSize {
+		return fmt.Errorf("payload size %d of message code %d out of schema bounds", size, msg.Code)
+	}
+	if !s.Decode && s.Validate == nil {
+		return nil
+	}
+	val, ok := p.spec.NewMsg(msg.Code)
+	if !ok {
+		return fmt.Errorf("unknown message code %d", msg.Code)
+	}
+	if err := rlp.DecodeBytes(msg.Payload, val); err != nil {
+		return fmt.Errorf("invalid payload of message code %d: %v", msg.Code, err)
+	}
+	if s.Validate != nil {
+		if err := s.Validate(val); err != nil {
+			return fmt.Errorf("invalid message code %d: %v", msg.Code, err)
+		}
+	}
+	return nil
+}
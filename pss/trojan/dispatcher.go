@@ -0,0 +1,113 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package trojan
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+)
+
+// Store is the storage interface trojan chunks are uploaded to.
+// Chunks put in upload mode are push synced to their neighbourhood.
+type Store interface {
+	Put(context.Context, chunk.ModePut, ...chunk.Chunk) ([]bool, error)
+}
+
+// Handler is called with the trojan messages received on a topic
+type Handler func(ctx context.Context, m *Message)
+
+// Dispatcher sends trojan messages by uploading trojan chunks and delivers
+// the trojan chunks stored by the node to the handlers of their topic
+type Dispatcher struct {
+	store    Store
+	handlers map[Topic]map[*Handler]struct{}
+	mu       sync.RWMutex
+}
+
+// NewDispatcher creates a Dispatcher uploading trojan chunks to the store
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		handlers: make(map[Topic]map[*Handler]struct{}),
+	}
+}
+
+// Send wraps the payload in a trojan chunk targeted at one of the targets
+// and uploads it
+func (d *Dispatcher) Send(ctx context.Context, targets [][]byte, topic Topic, payload []byte) error {
+	m, err := NewMessage(topic, payload)
+	if err != nil {
+		return err
+	}
+	ch, err := m.Wrap(ctx, targets)
+	if err != nil {
+		return err
+	}
+	if _, err := d.store.Put(ctx, chunk.ModePutUpload, ch); err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter("trojan/send", nil).Inc(1)
+	return nil
+}
+
+// Register adds a handler for messages on the topic
+// and returns a function that removes it
+func (d *Dispatcher) Register(topic Topic, h Handler) (deregister func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hs, ok := d.handlers[topic]
+	if !ok {
+		hs = make(map[*Handler]struct{})
+		d.handlers[topic] = hs
+	}
+	hs[&h] = struct{}{}
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(hs, &h)
+		if len(hs) == 0 {
+			delete(d.handlers, topic)
+		}
+	}
+}
+
+// Deliver calls the handlers registered for the topic of the trojan message
+// in the chunk. Chunks that are not trojan chunks are ignored.
+func (d *Dispatcher) Deliver(ctx context.Context, ch chunk.Chunk) {
+	m, err := Unwrap(ch)
+	if err != nil {
+		return
+	}
+	d.mu.RLock()
+	hs := make([]Handler, 0, len(d.handlers[m.Topic]))
+	for h := range d.handlers[m.Topic] {
+		hs = append(hs, *h)
+	}
+	d.mu.RUnlock()
+	if len(hs) == 0 {
+		return
+	}
+	log.Trace("delivering trojan message", "ref", ch.Address(), "handlers", len(hs))
+	metrics.GetOrRegisterCounter("trojan/deliver", nil).Inc(1)
+	for _, h := range hs {
+		h(ctx, m)
+	}
+}
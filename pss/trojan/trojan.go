@@ -0,0 +1,213 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package trojan implements trojan chunks: pss messages disguised as content
+// addressed chunks. The nonce of a trojan chunk is mined so that its address falls
+// into one of the target neighbourhoods, where the chunk is delivered by push
+// syncing like any other chunk, and the nodes storing it can recognise the message.
+package trojan
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// NonceSize is the size of the nonce that is mined to target the chunk address
+	NonceSize = 32
+	// TopicSize is the size of a trojan message topic
+	TopicSize = 32
+	// MessageSize is the size of a serialised trojan message including padding
+	MessageSize = chunk.DefaultSize - NonceSize
+	// MaxPayloadSize is the maximal size of the payload of a trojan message
+	MaxPayloadSize = MessageSize - TopicSize - 2
+	// MaxTargetSize is the maximal length of a target address prefix
+	MaxTargetSize = 2
+	// MaxTargets is the maximal number of targets of a trojan message
+	MaxTargets = 256
+	// MaxMiningIterations is the number of nonces tried before mining fails, 16 times
+	// the expected number for a single target of MaxTargetSize
+	MaxMiningIterations = 1 << 20
+)
+
+var (
+	// ErrPayloadTooBig is returned when the message payload exceeds MaxPayloadSize
+	ErrPayloadTooBig = errors.New("trojan message payload too big")
+	// ErrEmptyTargets is returned when a message is wrapped without targets
+	ErrEmptyTargets = errors.New("trojan message targets are empty")
+	// ErrVarLenTargets is returned when targets of different lengths are given
+	ErrVarLenTargets = errors.New("trojan message targets have different lengths")
+	// ErrTargetTooLong is returned when a target exceeds MaxTargetSize
+	ErrTargetTooLong = errors.New("trojan message target too long")
+	// ErrTooManyTargets is returned when more than MaxTargets targets are given
+	ErrTooManyTargets = errors.New("too many trojan message targets")
+	// ErrMiningFailed is returned when no nonce is found in MaxMiningIterations
+	ErrMiningFailed = errors.New("trojan chunk mining failed")
+	// ErrNotTrojan is returned when a chunk can not be unwrapped as a trojan message
+	ErrNotTrojan = errors.New("chunk is not a trojan chunk")
+)
+
+// Topic is the topic of a trojan message, used to dispatch it to handlers
+type Topic [TopicSize]byte
+
+// NewTopic creates a topic from the hash of the given name
+func NewTopic(name string) Topic {
+	var t Topic
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(name))
+	copy(t[:], h.Sum(nil))
+	return t
+}
+
+// Message is the payload of a trojan chunk
+type Message struct {
+	Topic   Topic
+	Payload []byte
+}
+
+// NewMessage creates a trojan message with the given topic and payload
+func NewMessage(topic Topic, payload []byte) (*Message, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooBig
+	}
+	return &Message{
+		Topic:   topic,
+		Payload: payload,
+	}, nil
+}
+
+// MarshalBinary serialises the message as topic, payload length and payload,
+// padded with random bytes to MessageSize
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if len(m.Payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooBig
+	}
+	data := make([]byte, MessageSize)
+	copy(data, m.Topic[:])
+	binary.BigEndian.PutUint16(data[TopicSize:], uint16(len(m.Payload)))
+	n := copy(data[TopicSize+2:], m.Payload)
+	if _, err := rand.Read(data[TopicSize+2+n:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UnmarshalBinary deserialises a message serialised with MarshalBinary
+func (m *Message) UnmarshalBinary(data []byte) error {
+	if len(data) != MessageSize {
+		return ErrNotTrojan
+	}
+	length := int(binary.BigEndian.Uint16(data[TopicSize:]))
+	if length > MaxPayloadSize {
+		return ErrNotTrojan
+	}
+	copy(m.Topic[:], data[:TopicSize])
+	m.Payload = make([]byte, length)
+	copy(m.Payload, data[TopicSize+2:])
+	return nil
+}
+
+// Wrap serialises the message into a chunk with an address that has one of
+// the targets as prefix. All targets must have the same length, the time
+// needed to mine the nonce grows exponentially with it, so it is limited to
+// MaxTargetSize. Mining stops when the context is done or after MaxMiningIterations.
+func (m *Message) Wrap(ctx context.Context, targets [][]byte) (chunk.Chunk, error) {
+	if len(targets) == 0 {
+		return nil, ErrEmptyTargets
+	}
+	if len(targets) > MaxTargets {
+		return nil, ErrTooManyTargets
+	}
+	prefixLen := len(targets[0])
+	if prefixLen > MaxTargetSize {
+		return nil, ErrTargetTooLong
+	}
+	for _, t := range targets[1:] {
+		if len(t) != prefixLen {
+			return nil, ErrVarLenTargets
+		}
+	}
+	msg, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 8+chunk.DefaultSize)
+	binary.LittleEndian.PutUint64(data[:8], uint64(chunk.DefaultSize))
+	nonce := data[8 : 8+NonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	copy(data[8+NonceSize:], msg)
+
+	hasher := storage.MakeHashFunc(storage.DefaultHash)()
+	for i := 0; i < MaxMiningIterations; i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		hasher.Reset()
+		hasher.SetSpanBytes(data[:8])
+		hasher.Write(data[8:])
+		addr := hasher.Sum(nil)
+		if hasPrefix(addr, targets) {
+			return chunk.NewChunk(addr, data), nil
+		}
+		incrementNonce(nonce)
+	}
+	return nil, ErrMiningFailed
+}
+
+// Unwrap extracts the trojan message from the chunk
+func Unwrap(ch chunk.Chunk) (*Message, error) {
+	data := ch.Data()
+	if len(data) != 8+chunk.DefaultSize {
+		return nil, ErrNotTrojan
+	}
+	m := new(Message)
+	if err := m.UnmarshalBinary(data[8+NonceSize:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// hasPrefix returns true if addr starts with one of the prefixes
+func hasPrefix(addr []byte, prefixes [][]byte) bool {
+	for _, p := range prefixes {
+		if bytes.HasPrefix(addr, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// incrementNonce increments the nonce as a big endian number
+func incrementNonce(nonce []byte) {
+	for i := len(nonce) - 1; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package trojan
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// TestWrapUnwrap checks that a wrapped message is a valid content addressed
+// chunk in one of the target neighbourhoods and unwraps to the same message
+func TestWrapUnwrap(t *testing.T) {
+	topic := NewTopic("test")
+	payload := []byte("trojan payload")
+	m, err := NewMessage(topic, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := [][]byte{{0x12}, {0xab}}
+	ch, err := m.Wrap(context.Background(), targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasPrefix(ch.Address(), targets) {
+		t.Fatalf("chunk address %s not in targets", ch.Address())
+	}
+	validator := storage.NewContentAddressValidator(storage.MakeHashFunc(storage.DefaultHash))
+	if !validator.Validate(ch) {
+		t.Fatal("trojan chunk is not content addressed")
+	}
+
+	got, err := Unwrap(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Topic != topic {
+		t.Fatalf("got topic %x, want %x", got.Topic, topic)
+	}
+	if !bytes.Equal(got.Payload, payload) {
+		t.Fatalf("got payload %x, want %x", got.Payload, payload)
+	}
+
+	if _, err := Unwrap(storage.GenerateRandomChunk(100)); err != ErrNotTrojan {
+		t.Fatalf("got error %v, want %v", err, ErrNotTrojan)
+	}
+}
+
+// TestWrapErrors checks invalid payloads and targets
+func TestWrapErrors(t *testing.T) {
+	if _, err := NewMessage(NewTopic("test"), make([]byte, MaxPayloadSize+1)); err != ErrPayloadTooBig {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadTooBig)
+	}
+	m, err := NewMessage(NewTopic("test"), make([]byte, MaxPayloadSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wrap(context.Background(), nil); err != ErrEmptyTargets {
+		t.Fatalf("got error %v, want %v", err, ErrEmptyTargets)
+	}
+	if _, err := m.Wrap(context.Background(), [][]byte{{1}, {1, 2}}); err != ErrVarLenTargets {
+		t.Fatalf("got error %v, want %v", err, ErrVarLenTargets)
+	}
+	if _, err := m.Wrap(context.Background(), [][]byte{make([]byte, MaxTargetSize+1)}); err != ErrTargetTooLong {
+		t.Fatalf("got error %v, want %v", err, ErrTargetTooLong)
+	}
+	if _, err := m.Wrap(context.Background(), make([][]byte, MaxTargets+1)); err != ErrTooManyTargets {
+		t.Fatalf("got error %v, want %v", err, ErrTooManyTargets)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Wrap(ctx, [][]byte{{1, 2}}); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+type mockStore struct {
+	chunks []chunk.Chunk
+}
+
+func (s *mockStore) Put(_ context.Context, _ chunk.ModePut, chs ...chunk.Chunk) ([]bool, error) {
+	s.chunks = append(s.chunks, chs...)
+	return make([]bool, len(chs)), nil
+}
+
+// TestDispatcher checks that sent messages are delivered to the handlers of the topic
+func TestDispatcher(t *testing.T) {
+	store := &mockStore{}
+	d := NewDispatcher(store)
+	topic := NewTopic("test")
+
+	var got [][]byte
+	deregister := d.Register(topic, func(_ context.Context, m *Message) {
+		got = append(got, m.Payload)
+	})
+	var other int
+	d.Register(NewTopic("other"), func(context.Context, *Message) {
+		other++
+	})
+
+	if err := d.Send(context.Background(), [][]byte{{0}}, topic, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.chunks) != 1 {
+		t.Fatalf("got %d uploaded chunks, want 1", len(store.chunks))
+	}
+	d.Deliver(context.Background(), store.chunks[0])
+	if len(got) != 1 || string(got[0]) != "hello" {
+		t.Fatalf("got messages %q, want [hello]", got)
+	}
+	if other != 0 {
+		t.Fatalf("got %d messages on other topic, want 0", other)
+	}
+
+	deregister()
+	d.Deliver(context.Background(), store.chunks[0])
+	if len(got) != 1 {
+		t.Fatalf("got %d messages after deregister, want 1", len(got))
+	}
+}
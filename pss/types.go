@@ -59,8 +59,9 @@ type handlerCaps struct {
 
 // Handler defines code to be executed upon reception of content.
 type handler struct {
-	f    HandlerFunc
-	caps *handlerCaps
+	f           HandlerFunc
+	caps        *handlerCaps
+	keyExchange bool // whether the handler exchanges keys and is exempt from topic policies
 }
 
 // NewHandler returns a new message handler
@@ -0,0 +1,88 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// APIs is a node.Service interface method
+func (p *Pusher) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "swarm",
+			Version:   "1.0",
+			Service:   NewAPI(p),
+			Public:    false,
+		},
+	}
+}
+
+// API exposes the push sync progress of uploads
+type API struct {
+	pusher *Pusher
+}
+
+// NewAPI creates a new API instance
+func NewAPI(p *Pusher) *API {
+	return &API{
+		pusher: p,
+	}
+}
+
+// SyncStatus is the push sync progress of an upload
+type SyncStatus struct {
+	Uid      uint32        `json:"uid"`      // uid of the tag of the upload
+	Address  chunk.Address `json:"address"`  // root hash of the upload
+	Total    int64         `json:"total"`    // number of chunks to be synced, zero if not yet known
+	Synced   int64         `json:"synced"`   // number of chunks synced
+	Pending  int64         `json:"pending"`  // number of chunks not yet synced
+	Receipts int           `json:"receipts"` // number of receipts collected from storer nodes
+	Done     bool          `json:"done"`     // whether all the chunks are synced
+}
+
+// SyncStatus returns the push sync progress of the upload with the given root hash
+func (a *API) SyncStatus(rootHash chunk.Address) (*SyncStatus, error) {
+	tag, err := a.pusher.tags.GetByAddress(rootHash)
+	if err != nil {
+		return nil, err
+	}
+	synced, total, err := tag.Status(chunk.StateSynced)
+	status := &SyncStatus{
+		Uid:      tag.Uid,
+		Address:  tag.Address,
+		Synced:   synced,
+		Receipts: len(a.pusher.Receipts(tag.Uid)),
+	}
+	// the total is not known until the whole upload is split and stored
+	if err == nil {
+		status.Total = total
+		status.Pending = total - synced
+		status.Done = synced == total
+	}
+	return status, nil
+}
+
+// Receipts returns the receipts collected for the chunks of the upload with the given root hash
+func (a *API) Receipts(rootHash chunk.Address) ([]*Receipt, error) {
+	tag, err := a.pusher.tags.GetByAddress(rootHash)
+	if err != nil {
+		return nil, err
+	}
+	return a.pusher.Receipts(tag.Uid), nil
+}
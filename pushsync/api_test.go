@@ -0,0 +1,68 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// TestAPISyncStatus tests that the sync status of an upload is reported by its root hash
+func TestAPISyncStatus(t *testing.T) {
+	tags := chunk.NewTags()
+	tag, err := tags.Create("upload", 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pusher{
+		tags:        tags,
+		tagReceipts: make(map[uint32]map[string]*Receipt),
+	}
+	api := NewAPI(p)
+
+	root := make(chunk.Address, 32)
+	root[0] = 1
+	if _, err := api.SyncStatus(root); err == nil {
+		t.Fatal("expected error for unknown root hash")
+	}
+
+	tag.IncN(chunk.StateSplit, 4)
+	tag.DoneSplit(root)
+	tag.IncN(chunk.StateStored, 4)
+	tag.IncN(chunk.StateSynced, 3)
+	for i := byte(0); i < 3; i++ {
+		p.addReceipt(tag.Uid, &receiptMsg{Addr: []byte{i}})
+	}
+
+	status, err := api.SyncStatus(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Uid != tag.Uid || status.Total != 4 || status.Synced != 3 || status.Pending != 1 || status.Receipts != 3 || status.Done {
+		t.Fatalf("unexpected sync status %+v", status)
+	}
+
+	tag.Inc(chunk.StateSynced)
+	status, err = api.SyncStatus(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Pending != 0 || !status.Done {
+		t.Fatalf("expected upload to be synced, got %+v", status)
+	}
+}
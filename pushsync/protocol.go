@@ -17,19 +17,34 @@
 package pushsync
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"crypto/rand"
+	"errors"
 	"io"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
+// the topics carry the version of the messages sent on them, as nodes can not decode
+// the messages of other versions; receipts are sent on the topic of the version of the
+// chunk message they respond to
 const (
-	pssChunkTopic   = "PUSHSYNC_CHUNKS"   // pss topic for chunks
-	pssReceiptTopic = "PUSHSYNC_RECEIPTS" // pss topic for statement of custody receipts
+	pssChunkTopic   = "PUSHSYNC_CHUNKS_3"   // pss topic for chunks
+	pssReceiptTopic = "PUSHSYNC_RECEIPTS_3" // pss topic for signed statement of custody receipts
+
+	unstampedChunkTopic   = "PUSHSYNC_CHUNKS_2"   // pss topic for chunks of nodes predating postage stamps
+	unstampedReceiptTopic = "PUSHSYNC_RECEIPTS_2" // pss topic for the signed receipts they expect
+
+	legacyChunkTopic   = "PUSHSYNC_CHUNKS"   // pss topic for chunks of nodes predating signed receipts
+	legacyReceiptTopic = "PUSHSYNC_RECEIPTS" // pss topic for the unsigned receipts they expect
 )
 
+var errInvalidReceiptSig = errors.New("receipt not signed by storer")
+
 // PubSub is a Postal Service interface needed to send/receive chunks and receipts for push syncing
 type PubSub interface {
 	Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func()
@@ -44,14 +59,57 @@ type chunkMsg struct {
 	Data   []byte // chunk data
 	Origin []byte // originator - need this for sending receipt back to origin
 	Nonce  []byte // nonce to make multiple instances of send immune to deduplication cache
+	Stamp  []byte // postage stamp of the chunk, empty if the chunk is not stamped
+
+	unstamped bool // received on the topic of nodes predating postage stamps
+	legacy    bool // received on the legacy topic, answered with an unsigned receipt
+}
+
+// unstampedChunkMsg is the chunk message of nodes predating postage stamps,
+// nodes predating signed receipts send the same message on the legacy topic
+type unstampedChunkMsg struct {
+	Addr   []byte
+	Data   []byte
+	Origin []byte
+	Nonce  []byte
 }
 
 // receiptMsg is a statement of custody response to receiving a push-synced chunk
-// it is currently a notification only (contains no proof) sent to the originator
+// sent to the originator. It is signed by the storer node, but contains no proof of storage.
 // Nonce is there to make multiple responses immune to deduplication cache
 type receiptMsg struct {
-	Addr  []byte // chunk address
-	Nonce []byte // nonce to make multiple instances of send immune to deduplication cache
+	Addr   []byte // chunk address
+	Nonce  []byte // nonce to make multiple instances of send immune to deduplication cache
+	Storer []byte // overlay address of the storer node
+	Sig    []byte // signature of the storer over the chunk address
+}
+
+// legacyReceiptMsg is the unsigned receipt expected by nodes predating signed receipts
+type legacyReceiptMsg struct {
+	Addr  []byte
+	Nonce []byte
+}
+
+// signReceipt signs the address of a stored chunk with the key of the storer
+func signReceipt(key *ecdsa.PrivateKey, addr []byte) ([]byte, error) {
+	return crypto.Sign(crypto.Keccak256(addr), key)
+}
+
+// verifyReceipt checks that the signature of the receipt was made by its storer
+func verifyReceipt(rmsg *receiptMsg) error {
+	pub, err := crypto.SigToPub(crypto.Keccak256(rmsg.Addr), rmsg.Sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(storerAddress(pub), rmsg.Storer) {
+		return errInvalidReceiptSig
+	}
+	return nil
+}
+
+// storerAddress returns the overlay address of the node with the given public key
+func storerAddress(pub *ecdsa.PublicKey) []byte {
+	return crypto.Keccak256(crypto.FromECDSAPub(pub))
 }
 
 func decodeChunkMsg(msg []byte) (*chunkMsg, error) {
@@ -63,6 +121,32 @@ func decodeChunkMsg(msg []byte) (*chunkMsg, error) {
 	return &chmsg, nil
 }
 
+// decodeUnstampedChunkMsg decodes the chunk message of a node predating postage stamps
+func decodeUnstampedChunkMsg(msg []byte) (*chunkMsg, error) {
+	var chmsg unstampedChunkMsg
+	err := rlp.DecodeBytes(msg, &chmsg)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkMsg{
+		Addr:      chmsg.Addr,
+		Data:      chmsg.Data,
+		Origin:    chmsg.Origin,
+		Nonce:     chmsg.Nonce,
+		unstamped: true,
+	}, nil
+}
+
+// decodeLegacyChunkMsg decodes the chunk message of a node predating signed receipts
+func decodeLegacyChunkMsg(msg []byte) (*chunkMsg, error) {
+	chmsg, err := decodeUnstampedChunkMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	chmsg.legacy = true
+	return chmsg, nil
+}
+
 func decodeReceiptMsg(msg []byte) (*receiptMsg, error) {
 	var rmsg receiptMsg
 	err := rlp.DecodeBytes(msg, &rmsg)
@@ -24,8 +24,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
 )
 
 // TestProtocol tests the push sync protocol
@@ -51,7 +55,11 @@ func TestProtocol(t *testing.T) {
 			log.Debug("closest node?", "n", n, "n%storerCnt", n%storerCnt, "storer", j)
 			return n%storerCnt == j
 		}
-		storers[j] = NewStorer(&testStore{store}, &testPubSub{lb, isClosestTo})
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		storers[j] = NewStorer(&testStore{store}, &testPubSub{lb, isClosestTo}, key, nil)
 	}
 
 	tags, tagIDs := setupTags(chunkCnt, tagCnt)
@@ -77,6 +85,17 @@ func TestProtocol(t *testing.T) {
 		if len(synced) == chunkCnt {
 			expTotal := int64(chunkCnt / tagCnt)
 			checkTags(t, expTotal, tagIDs[:tagCnt-1], tags)
+			for _, tagID := range tagIDs[:tagCnt-1] {
+				receipts := p.Receipts(tagID)
+				if int64(len(receipts)) != expTotal {
+					t.Fatalf("expected %v receipts for tag %v, got %v", expTotal, tagID, len(receipts))
+				}
+				for _, r := range receipts {
+					if err := verifyReceipt(&receiptMsg{Addr: r.Addr, Storer: r.Storer, Sig: r.Signature}); err != nil {
+						t.Fatalf("invalid receipt for chunk %v: %v", r.Addr, err)
+					}
+				}
+			}
 			for i := uint64(0); i < uint64(chunkCnt); i++ {
 				if n := synced[int(i)]; n != 1 {
 					t.Fatalf("expected to receive exactly 1 receipt for chunk %v, got %v", i, n)
@@ -94,6 +113,149 @@ func TestProtocol(t *testing.T) {
 	}
 }
 
+// TestReceiptSignature tests that receipts are only accepted if signed by their storer
+func TestReceiptSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := make([]byte, 32)
+	sig, err := signReceipt(key, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rmsg := &receiptMsg{Addr: addr, Storer: storerAddress(&key.PublicKey), Sig: sig}
+	if err := verifyReceipt(rmsg); err != nil {
+		t.Fatalf("expected valid receipt, got %v", err)
+	}
+
+	// receipt claiming a different storer
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rmsg.Storer = storerAddress(&other.PublicKey)
+	if err := verifyReceipt(rmsg); err != errInvalidReceiptSig {
+		t.Fatalf("expected error %v, got %v", errInvalidReceiptSig, err)
+	}
+
+	// receipt for a different chunk
+	rmsg.Storer = storerAddress(&key.PublicKey)
+	rmsg.Addr = make([]byte, 32)
+	rmsg.Addr[0] = 1
+	if err := verifyReceipt(rmsg); err != errInvalidReceiptSig {
+		t.Fatalf("expected error %v, got %v", errInvalidReceiptSig, err)
+	}
+}
+
+// TestStorerInactive tests that chunks are neither stored nor receipted while the storer is inactive
+func TestStorerInactive(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &sync.Map{}
+	lb := newLoopBack()
+	var receipts int
+	lb.Register(pssReceiptTopic, false, func(msg []byte, _ *p2p.Peer) error {
+		receipts++
+		return nil
+	})
+	s := NewStorer(&testStore{store}, &testPubSub{lb, func([]byte) bool { return true }}, key, nil)
+	defer s.Close()
+	var active bool
+	s.SetActive(func() bool { return active })
+
+	ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+	chmsg := &chunkMsg{Addr: ch.Address(), Data: ch.Data(), Origin: testBaseAddr, Nonce: []byte{0}}
+	if err := s.processChunkMsg(context.Background(), chmsg); err != nil {
+		t.Fatal(err)
+	}
+	idx := binary.BigEndian.Uint64(ch.Address()[:8])
+	if _, ok := store.Load(idx); ok {
+		t.Fatal("expected chunk not to be stored by inactive storer")
+	}
+	if receipts != 0 {
+		t.Fatalf("expected no receipts, got %d", receipts)
+	}
+
+	active = true
+	if err := s.processChunkMsg(context.Background(), chmsg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Load(idx); !ok {
+		t.Fatal("expected chunk to be stored by active storer")
+	}
+	if receipts != 1 {
+		t.Fatalf("expected 1 receipt, got %d", receipts)
+	}
+}
+
+// TestStorerLegacy tests that chunks of nodes predating postage stamps are stored and
+// answered with signed receipts and chunks of nodes predating signed receipts with
+// unsigned receipts, on the receipt topics of their versions
+func TestStorerLegacy(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		chunkTopic   string
+		receiptTopic string
+		signed       bool
+	}{
+		{name: "unstamped", chunkTopic: unstampedChunkTopic, receiptTopic: unstampedReceiptTopic, signed: true},
+		{name: "unsigned receipts", chunkTopic: legacyChunkTopic, receiptTopic: legacyReceiptTopic},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			store := &sync.Map{}
+			lb := newLoopBack()
+			var receipts, versionReceipts int
+			lb.Register(pssReceiptTopic, false, func(msg []byte, _ *p2p.Peer) error {
+				receipts++
+				return nil
+			})
+			signed := tc.signed
+			lb.Register(tc.receiptTopic, false, func(msg []byte, _ *p2p.Peer) error {
+				if signed {
+					rmsg, err := decodeReceiptMsg(msg)
+					if err != nil {
+						return err
+					}
+					if err := verifyReceipt(rmsg); err != nil {
+						return err
+					}
+				} else {
+					var rmsg legacyReceiptMsg
+					if err := rlp.DecodeBytes(msg, &rmsg); err != nil {
+						return err
+					}
+				}
+				versionReceipts++
+				return nil
+			})
+			s := NewStorer(&testStore{store}, &testPubSub{lb, func([]byte) bool { return true }}, key, nil)
+			defer s.Close()
+
+			ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+			msg, err := rlp.EncodeToBytes(&unstampedChunkMsg{Addr: ch.Address(), Data: ch.Data(), Origin: testBaseAddr, Nonce: []byte{0}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := lb.Send(ch.Address(), tc.chunkTopic, msg); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := store.Load(binary.BigEndian.Uint64(ch.Address()[:8])); !ok {
+				t.Fatal("expected chunk to be stored")
+			}
+			if receipts != 0 || versionReceipts != 1 {
+				t.Fatalf("expected 1 receipt on %s and none on %s, got %d and %d", tc.receiptTopic, pssReceiptTopic, versionReceipts, receipts)
+			}
+		})
+	}
+}
+
 type testStore struct {
 	store *sync.Map
 }
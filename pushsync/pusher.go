@@ -22,6 +22,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -42,7 +43,14 @@ type DB interface {
 	Set(context.Context, chunk.ModeSet, ...storage.Address) error
 }
 
-var retryInterval = 10 * time.Second // time interval between retries
+var (
+	retryInterval = 10 * time.Second // time interval between retries
+	dedupTimeout  = 3 * time.Second  // max time waiting for the neighbourhood probe of a chunk
+)
+
+// Probe checks if a chunk is already stored in its neighbourhood,
+// it returns the overlay address of the storer node if it is
+type Probe func(context.Context, chunk.Address) ([]byte, bool)
 
 // Pusher takes care of the push syncing
 type Pusher struct {
@@ -51,13 +59,28 @@ type Pusher struct {
 	quit           chan struct{}          // channel to signal quitting on all loops
 	closedChunks   chan struct{}          // channel to signal sync loop terminated
 	closedReceipts chan struct{}          // channel to signal sync loop terminated
+	closedSends    chan struct{}          // channel to signal send loop terminated
+	queue          *sendQueue             // chunks waiting to be sent, by tag priority and rate limit
 	pushed         map[string]*pushedItem // cache of items push-synced
 	pushedMu       sync.Mutex
 	syncedAddrs    []storage.Address
 	syncedAddrsMu  sync.Mutex
-	receipts       chan []byte // channel to receive receipts
-	ps             PubSub      // PubSub interface to send chunks and receive receipts
-	logger         log.Logger  // custom logger
+	receipts       chan *receiptMsg               // channel to receive receipts
+	tagReceipts    map[uint32]map[string]*Receipt // receipts of synced chunks by tag
+	tagReceiptsMu  sync.RWMutex
+	probe          Probe        // probe to deduplicate chunks of tags with deduplication enabled
+	probeMu        sync.RWMutex // protects probe
+	ps             PubSub       // PubSub interface to send chunks and receive receipts
+	logger         log.Logger   // custom logger
+}
+
+// Receipt is a statement of custody for a push-synced chunk by the storer node
+// receipts for chunks that the node itself is closest to or that were found
+// already stored in their neighbourhood are not signed
+type Receipt struct {
+	Addr      chunk.Address `json:"address"`   // chunk address
+	Storer    hexutil.Bytes `json:"storer"`    // overlay address of the storer node
+	Signature hexutil.Bytes `json:"signature"` // signature of the storer over the chunk address
 }
 
 // pushedItem captures the info needed for the pusher about a chunk during the
@@ -65,6 +88,7 @@ type Pusher struct {
 type pushedItem struct {
 	tag      *chunk.Tag       // tag for the chunk
 	shortcut bool             // if the chunk receipt was sent by self
+	dedup    bool             // if the chunk was found stored in its neighbourhood
 	sentAt   time.Time        // first sent at time
 	synced   bool             // set when chunk got synced
 	span     opentracing.Span // roundtrip span
@@ -82,31 +106,40 @@ func NewPusher(store DB, ps PubSub, tags *chunk.Tags) *Pusher {
 		quit:           make(chan struct{}),
 		closedChunks:   make(chan struct{}),
 		closedReceipts: make(chan struct{}),
+		closedSends:    make(chan struct{}),
+		queue:          newSendQueue(),
 		pushed:         make(map[string]*pushedItem),
-		receipts:       make(chan []byte),
+		receipts:       make(chan *receiptMsg),
+		tagReceipts:    make(map[uint32]map[string]*Receipt),
 		ps:             ps,
 		logger:         log.New("self", label(ps.BaseAddr())),
 	}
 	go p.chunksWorker()
 	go p.receiptsWorker()
+	go p.sendsWorker()
 	return p
 }
 
+// SetProbe sets the probe used to skip sending chunks already stored in their neighbourhood
+// it is only consulted for chunks of tags with deduplication enabled
+func (p *Pusher) SetProbe(probe Probe) {
+	p.probeMu.Lock()
+	defer p.probeMu.Unlock()
+	p.probe = probe
+}
+
 // Close closes the pusher
 func (p *Pusher) Close() {
 	close(p.quit)
 	timer := time.After(3 * time.Second)
-	select {
-	case <-p.closedReceipts:
+	for _, closed := range []chan struct{}{p.closedReceipts, p.closedChunks, p.closedSends} {
 		select {
-		case <-p.closedChunks:
-			// all closed
-			return
+		case <-closed:
 		case <-timer:
+			log.Error("timeout closing pusher")
+			return
 		}
-	case <-timer:
 	}
-	log.Error("timeout closing pusher")
 }
 
 // sync starts a forever loop that pushes chunks to their neighbourhood
@@ -152,12 +185,9 @@ func (p *Pusher) chunksWorker() {
 			}
 
 			metrics.GetOrRegisterCounter("pusher/send-chunk/send-to-sync", nil).Inc(1)
-			// send the chunk and ignore the error
-
-			if err := p.sendChunkMsg(ch); err != nil {
-				metrics.GetOrRegisterCounter("pusher/send-chunk-msg/err", nil).Inc(1)
-				p.logger.Error("error sending chunk", "addr", ch.Address().Hex(), "err", err)
-			}
+			// queue the chunk to be sent according to the priority and rate limit of its tag
+			tag, _ := p.tags.Get(ch.TagID())
+			p.queue.push(ch, tag)
 
 			// retry interval timer triggers starting from new
 		case <-timer.C:
@@ -196,6 +226,9 @@ func (p *Pusher) chunksWorker() {
 				}
 				p.pushedMu.Unlock()
 
+				p.pruneReceipts()
+				p.queue.prune(p.tags)
+
 				// we don't want to record the first iteration
 				if chunksInBatch != -1 {
 					// hack: this measurement is NOT a timer, but we want a histogram for chunks in batch, so it fits the data structure
@@ -222,6 +255,54 @@ func (p *Pusher) chunksWorker() {
 	}
 }
 
+// sendsWorker is a forever loop sending the queued chunks in the order
+// defined by the priorities and rate limits of their tags
+func (p *Pusher) sendsWorker() {
+	defer close(p.closedSends)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		ch, wait := p.queue.pop()
+		if ch != nil {
+			if p.deduplicate(ch) {
+				continue
+			}
+			// send the chunk and ignore the error
+			if err := p.sendChunkMsg(ch); err != nil {
+				metrics.GetOrRegisterCounter("pusher/send-chunk-msg/err", nil).Inc(1)
+				p.logger.Error("error sending chunk", "addr", ch.Address().Hex(), "err", err)
+			}
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			continue
+		}
+
+		// nothing to send now: wait for new chunks or for rate limits to allow sending
+		var delay <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			delay = timer.C
+		}
+		select {
+		case <-p.queue.wakeup:
+		case <-delay:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
 func (p *Pusher) receiptsWorker() {
 	defer close(p.closedReceipts)
 
@@ -234,7 +315,8 @@ func (p *Pusher) receiptsWorker() {
 	for {
 		select {
 		// handle incoming receipts
-		case addr := <-p.receipts:
+		case receipt := <-p.receipts:
+			addr := receipt.Addr
 			hexaddr := hex.EncodeToString(addr)
 			p.logger.Trace("got receipt", "addr", hexaddr)
 			metrics.GetOrRegisterCounter("pusher/receipts/all", nil).Inc(1)
@@ -256,6 +338,7 @@ func (p *Pusher) receiptsWorker() {
 			if item.tag != nil {
 				// finish span for pushsync roundtrip, only have this span if we have a tag
 				item.span.Finish()
+				p.addReceipt(item.tag.Uid, receipt)
 			}
 
 			totalDuration := time.Since(item.sentAt)
@@ -274,6 +357,42 @@ func (p *Pusher) receiptsWorker() {
 	}
 }
 
+// deduplicate probes the neighbourhood of the chunk if its tag has deduplication enabled
+// if the chunk is already stored there, it is receipted locally instead of being sent
+func (p *Pusher) deduplicate(ch chunk.Chunk) bool {
+	p.probeMu.RLock()
+	probe := p.probe
+	p.probeMu.RUnlock()
+	if probe == nil {
+		return false
+	}
+	tag, err := p.tags.Get(ch.TagID())
+	if err != nil || !tag.Dedup() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dedupTimeout)
+	defer cancel()
+	storer, ok := probe(ctx, ch.Address())
+	if !ok {
+		return false
+	}
+	// count the chunk only once even if it is queued again before the receipt is processed
+	p.pushedMu.Lock()
+	item, found := p.pushed[ch.Address().Hex()]
+	first := found && !item.dedup
+	if first {
+		item.dedup = true
+	}
+	p.pushedMu.Unlock()
+	if first {
+		metrics.GetOrRegisterCounter("pusher/dedup", nil).Inc(1)
+		tag.Inc(chunk.StateDeduplicated)
+	}
+	p.logger.Trace("chunk stored in neighbourhood: push receipt locally", "ref", label(ch.Address()))
+	go p.pushReceipt(&receiptMsg{Addr: ch.Address(), Storer: storer})
+	return true
+}
+
 // handleReceiptMsg is a handler for pssReceiptTopic that
 // - deserialises receiptMsg and
 // - sends the receipted address on a channel
@@ -283,18 +402,60 @@ func (p *Pusher) handleReceiptMsg(msg []byte) error {
 		return err
 	}
 	p.logger.Trace("handleReceiptMsg", "receipt", hex.EncodeToString(receipt.Addr))
-	go p.pushReceipt(receipt.Addr)
+	if err := verifyReceipt(receipt); err != nil {
+		metrics.GetOrRegisterCounter("pusher/receipts/invalid", nil).Inc(1)
+		return err
+	}
+	go p.pushReceipt(receipt)
 	return nil
 }
 
-// pushReceipt just inserts the address into the channel
-func (p *Pusher) pushReceipt(addr []byte) {
+// pushReceipt just inserts the receipt into the channel
+func (p *Pusher) pushReceipt(receipt *receiptMsg) {
 	select {
-	case p.receipts <- addr:
+	case p.receipts <- receipt:
 	case <-p.quit:
 	}
 }
 
+// addReceipt records the receipt of a synced chunk for the tag
+func (p *Pusher) addReceipt(uid uint32, receipt *receiptMsg) {
+	p.tagReceiptsMu.Lock()
+	defer p.tagReceiptsMu.Unlock()
+	receipts, ok := p.tagReceipts[uid]
+	if !ok {
+		receipts = make(map[string]*Receipt)
+		p.tagReceipts[uid] = receipts
+	}
+	receipts[hex.EncodeToString(receipt.Addr)] = &Receipt{
+		Addr:      receipt.Addr,
+		Storer:    receipt.Storer,
+		Signature: receipt.Sig,
+	}
+}
+
+// Receipts returns the receipts collected for the chunks of the tag with the given uid
+func (p *Pusher) Receipts(uid uint32) []*Receipt {
+	p.tagReceiptsMu.RLock()
+	defer p.tagReceiptsMu.RUnlock()
+	receipts := make([]*Receipt, 0, len(p.tagReceipts[uid]))
+	for _, r := range p.tagReceipts[uid] {
+		receipts = append(receipts, r)
+	}
+	return receipts
+}
+
+// pruneReceipts drops the receipts of tags that no longer exist
+func (p *Pusher) pruneReceipts() {
+	p.tagReceiptsMu.Lock()
+	defer p.tagReceiptsMu.Unlock()
+	for uid := range p.tagReceipts {
+		if _, err := p.tags.Get(uid); err != nil {
+			delete(p.tagReceipts, uid)
+		}
+	}
+}
+
 // sendChunkMsg sends chunks to their destination
 // using the PubSub interface Send method (e.g., pss neighbourhood addressing)
 func (p *Pusher) sendChunkMsg(ch chunk.Chunk) error {
@@ -305,6 +466,7 @@ func (p *Pusher) sendChunkMsg(ch chunk.Chunk) error {
 		Addr:   ch.Address(),
 		Data:   ch.Data(),
 		Nonce:  newNonce(),
+		Stamp:  ch.Stamp(),
 	}
 	msg, err := rlp.EncodeToBytes(cmsg)
 	if err != nil {
@@ -361,7 +523,7 @@ func (p *Pusher) needToSync(ch chunk.Chunk) bool {
 		if p.ps.IsClosestTo(addr) {
 			p.logger.Trace("self is closest to ref: push receipt locally", "ref", hexaddr)
 			item.shortcut = true
-			go p.pushReceipt(addr)
+			go p.pushReceipt(&receiptMsg{Addr: addr, Storer: p.ps.BaseAddr()})
 			return false
 		}
 		p.logger.Trace("self is not the closest to ref: send chunk to neighbourhood", "ref", hexaddr)
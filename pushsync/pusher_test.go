@@ -17,6 +17,7 @@
 package pushsync
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/hex"
@@ -26,6 +27,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -68,6 +70,11 @@ func TestPusher(t *testing.T) {
 
 	lb := newLoopBack()
 
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	respond := func(msg []byte, _ *p2p.Peer) error {
 		chmsg, err := decodeChunkMsg(msg)
 		if err != nil {
@@ -77,7 +84,11 @@ func TestPusher(t *testing.T) {
 		// check outgoing chunk messages
 		idx := int(binary.BigEndian.Uint64(chmsg.Addr[:8]))
 		// respond ~ mock storer protocol
-		receipt := &receiptMsg{Addr: chmsg.Addr}
+		sig, err := signReceipt(key, chmsg.Addr)
+		if err != nil {
+			errf("error signing receipt: %v", err)
+		}
+		receipt := &receiptMsg{Addr: chmsg.Addr, Storer: storerAddress(&key.PublicKey), Sig: sig}
 		rmsg, err := rlp.EncodeToBytes(receipt)
 		if err != nil {
 			errf("error encoding receipt message: %v", err)
@@ -121,6 +132,86 @@ func TestPusher(t *testing.T) {
 
 }
 
+// TestPusherDedup tests that chunks of tags with deduplication enabled which the probe
+// finds in their neighbourhood are receipted without being sent
+func TestPusherDedup(t *testing.T) {
+	chunkCnt := 64
+	tagCnt := 2
+
+	lb := newLoopBack()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	sentIdx := make(map[int]bool)
+	lb.Register(pssChunkTopic, false, func(msg []byte, _ *p2p.Peer) error {
+		chmsg, err := decodeChunkMsg(msg)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		sentIdx[int(binary.BigEndian.Uint64(chmsg.Addr[:8]))] = true
+		mu.Unlock()
+		sig, err := signReceipt(key, chmsg.Addr)
+		if err != nil {
+			return err
+		}
+		rmsg, err := rlp.EncodeToBytes(&receiptMsg{Addr: chmsg.Addr, Storer: storerAddress(&key.PublicKey), Sig: sig})
+		if err != nil {
+			return err
+		}
+		return lb.Send(chmsg.Origin, pssReceiptTopic, rmsg)
+	})
+
+	tags, tagIDs := setupTags(chunkCnt, tagCnt)
+	tag, err := tags.Get(tagIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetDedup(true)
+
+	// the probe finds every chunk with an index divisible by 4
+	probeStorer := []byte{1, 2, 3}
+	probe := func(_ context.Context, addr chunk.Address) ([]byte, bool) {
+		return probeStorer, binary.BigEndian.Uint64(addr[:8])%4 == 0
+	}
+
+	tp := newTestPushSyncIndex(chunkCnt, tagIDs, tags, &sync.Map{})
+	p := NewPusher(tp, &testPubSub{lb, func([]byte) bool { return false }}, tags)
+	defer p.Close()
+	p.SetProbe(probe)
+
+	synced := make(map[int]bool)
+	for len(synced) < chunkCnt {
+		select {
+		case i := <-tp.synced:
+			synced[i] = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for all chunks to be synced")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < chunkCnt; i++ {
+		// only chunks of the tag with deduplication enabled are probed
+		dedup := i%tagCnt == 0 && i%4 == 0
+		if sentIdx[i] == dedup {
+			t.Fatalf("chunk %d: expected sent %v", i, !dedup)
+		}
+	}
+	if n := tag.Get(chunk.StateDeduplicated); n != int64(chunkCnt/4) {
+		t.Fatalf("expected %d deduplicated chunks, got %d", chunkCnt/4, n)
+	}
+	for _, r := range p.Receipts(tag.Uid) {
+		dedup := binary.BigEndian.Uint64(r.Addr[:8])%4 == 0
+		if dedup != bytes.Equal(r.Storer, probeStorer) {
+			t.Fatalf("chunk %x: unexpected storer %x", r.Addr, r.Storer)
+		}
+	}
+}
+
 type testPubSub struct {
 	*loopBack
 	isClosestTo func([]byte) bool
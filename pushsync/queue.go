@@ -0,0 +1,236 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"golang.org/x/time/rate"
+)
+
+// sendQueue holds the chunks waiting to be push synced. Chunks are grouped
+// by tag into priority lanes: the highest priority lane with a sendable
+// chunk is always served first, tags within a lane are served round robin
+// and each tag can be limited to a number of bytes per second.
+type sendQueue struct {
+	mtx      sync.Mutex
+	lanes    [chunk.PriorityHigh + 1][]*tagQueue // tag queues per priority
+	next     [chunk.PriorityHigh + 1]int         // round robin cursor per lane
+	tags     map[uint32]*tagQueue                // tag queues by tag uid
+	limiters map[uint32]*tagLimiter              // rate limiters by tag uid, kept while the tag queue is empty
+	queued   map[string]struct{}                 // addresses of queued chunks
+	wakeup   chan struct{}                       // signals a new chunk has been queued
+}
+
+// tagQueue is the fifo queue of chunks belonging to a single tag
+type tagQueue struct {
+	tag     *chunk.Tag // nil for untagged chunks
+	chunks  []chunk.Chunk
+	limiter *tagLimiter
+}
+
+// tagLimiter limits the rate at which the chunks of a tag are sent
+type tagLimiter struct {
+	tag     *chunk.Tag
+	limit   int64         // rate limit the limiter was configured with
+	limiter *rate.Limiter // nil if unlimited
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		tags:     make(map[uint32]*tagQueue),
+		limiters: make(map[uint32]*tagLimiter),
+		queued:   make(map[string]struct{}),
+		wakeup:   make(chan struct{}, 1),
+	}
+}
+
+// push adds a chunk to the queue of its tag, tag may be nil.
+// chunks already waiting in the queue are ignored.
+func (q *sendQueue) push(ch chunk.Chunk, tag *chunk.Tag) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	addr := ch.Address().Hex()
+	if _, ok := q.queued[addr]; ok {
+		return
+	}
+	q.queued[addr] = struct{}{}
+
+	var uid uint32
+	if tag != nil {
+		uid = tag.Uid
+	}
+	tq, ok := q.tags[uid]
+	if !ok {
+		// reuse the limiter of the tag so that draining its queue does not reset the rate limit
+		tl, ok := q.limiters[uid]
+		if !ok || tl.tag != tag {
+			tl = &tagLimiter{tag: tag}
+			q.limiters[uid] = tl
+		}
+		tq = &tagQueue{tag: tag, limiter: tl}
+		q.tags[uid] = tq
+		p := priority(tag)
+		q.lanes[p] = append(q.lanes[p], tq)
+	}
+	tq.chunks = append(tq.chunks, ch)
+
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the next chunk to be sent. If no chunk can be sent
+// because of rate limits, it returns the time to wait before retrying.
+// If the queue is empty it returns nil and 0.
+func (q *sendQueue) pop() (chunk.Chunk, time.Duration) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.rebalance()
+
+	var wait time.Duration
+	now := time.Now()
+	for p := len(q.lanes) - 1; p >= 0; p-- {
+		lane := q.lanes[p]
+		for i := 0; i < len(lane); i++ {
+			idx := (q.next[p] + i) % len(lane)
+			tq := lane[idx]
+			ch := tq.chunks[0]
+
+			if d := tq.limiter.reserve(now, len(ch.Data())); d > 0 {
+				if wait == 0 || d < wait {
+					wait = d
+				}
+				continue
+			}
+
+			tq.chunks = tq.chunks[1:]
+			delete(q.queued, ch.Address().Hex())
+			if len(tq.chunks) == 0 {
+				q.remove(p, idx)
+			} else {
+				q.next[p] = (idx + 1) % len(lane)
+			}
+			return ch, 0
+		}
+	}
+	return nil, wait
+}
+
+// prune drops the rate limiters of tags with no queued chunks
+// that are either done syncing or no longer present in tags
+func (q *sendQueue) prune(tags *chunk.Tags) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for uid, tl := range q.limiters {
+		if _, ok := q.tags[uid]; ok {
+			continue
+		}
+		if tl.tag != nil && !tl.tag.Done(chunk.StateSynced) {
+			if t, err := tags.Get(uid); err == nil && t == tl.tag {
+				continue
+			}
+		}
+		delete(q.limiters, uid)
+	}
+}
+
+// rebalance moves tag queues whose priority has changed to their new lane
+func (q *sendQueue) rebalance() {
+	for p := range q.lanes {
+		for i := 0; i < len(q.lanes[p]); i++ {
+			tq := q.lanes[p][i]
+			if np := priority(tq.tag); int(np) != p {
+				q.lanes[p] = append(q.lanes[p][:i], q.lanes[p][i+1:]...)
+				q.lanes[np] = append(q.lanes[np], tq)
+				i--
+			}
+		}
+		if len(q.lanes[p]) > 0 {
+			q.next[p] %= len(q.lanes[p])
+		} else {
+			q.next[p] = 0
+		}
+	}
+}
+
+// remove deletes the emptied tag queue at index i of lane p,
+// the rate limiter of the tag is kept until pruned
+func (q *sendQueue) remove(p int, i int) {
+	tq := q.lanes[p][i]
+	var uid uint32
+	if tq.tag != nil {
+		uid = tq.tag.Uid
+	}
+	delete(q.tags, uid)
+	q.lanes[p] = append(q.lanes[p][:i], q.lanes[p][i+1:]...)
+	if len(q.lanes[p]) == 0 || q.next[p] > i {
+		q.next[p] = 0
+	} else {
+		q.next[p] %= len(q.lanes[p])
+	}
+}
+
+// reserve reserves n bytes to be sent for the tag
+// it returns 0 if the bytes can be sent now, otherwise the duration to wait
+func (tl *tagLimiter) reserve(now time.Time, n int) time.Duration {
+	var limit int64
+	if tl.tag != nil {
+		limit = tl.tag.GetRateLimit()
+	}
+	if limit <= 0 {
+		tl.limiter = nil
+		tl.limit = 0
+		return 0
+	}
+	if tl.limiter == nil || tl.limit != limit {
+		// burst must allow at least a full chunk to be sent at once
+		burst := int(limit)
+		if burst < chunk.DefaultSize+8 {
+			burst = chunk.DefaultSize + 8
+		}
+		tl.limiter = rate.NewLimiter(rate.Limit(limit), burst)
+		tl.limit = limit
+	}
+	r := tl.limiter.ReserveN(now, n)
+	if !r.OK() {
+		return 0
+	}
+	if d := r.DelayFrom(now); d > 0 {
+		r.CancelAt(now)
+		return d
+	}
+	return 0
+}
+
+// priority returns the push sync priority for a tag, untagged chunks have normal priority
+func priority(tag *chunk.Tag) chunk.Priority {
+	if tag == nil {
+		return chunk.PriorityNormal
+	}
+	p := tag.GetPriority()
+	if p > chunk.PriorityHigh {
+		return chunk.PriorityHigh
+	}
+	return p
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+)
+
+func newQueueTestChunk(i int, size int) chunk.Chunk {
+	addr := make([]byte, 32)
+	binary.BigEndian.PutUint64(addr, uint64(i))
+	return storage.NewChunk(addr, make([]byte, size))
+}
+
+// TestSendQueuePriority checks that chunks of high priority tags are popped before
+// chunks of lower priority tags, regardless of the order they were queued in
+func TestSendQueuePriority(t *testing.T) {
+	q := newSendQueue()
+
+	background := chunk.NewTag(1, "archive", 0, false)
+	background.SetPriority(chunk.PriorityBackground)
+	high := chunk.NewTag(2, "site", 0, false)
+	high.SetPriority(chunk.PriorityHigh)
+
+	for i := 0; i < 5; i++ {
+		q.push(newQueueTestChunk(i, 0), background)
+	}
+	q.push(newQueueTestChunk(5, 0), nil)
+	for i := 6; i < 8; i++ {
+		q.push(newQueueTestChunk(i, 0), high)
+	}
+	// already queued chunks are ignored
+	q.push(newQueueTestChunk(0, 0), background)
+
+	exp := []int{6, 7, 5, 0, 1, 2, 3, 4}
+	for _, e := range exp {
+		ch, _ := q.pop()
+		if ch == nil {
+			t.Fatalf("expected chunk %d, got none", e)
+		}
+		if got := int(binary.BigEndian.Uint64(ch.Address()[:8])); got != e {
+			t.Fatalf("expected chunk %d, got %d", e, got)
+		}
+	}
+	if ch, wait := q.pop(); ch != nil || wait != 0 {
+		t.Fatalf("expected empty queue, got chunk %v wait %v", ch, wait)
+	}
+}
+
+// TestSendQueueRoundRobin checks that tags of the same priority are served in turns
+func TestSendQueueRoundRobin(t *testing.T) {
+	q := newSendQueue()
+
+	a := chunk.NewTag(1, "a", 0, false)
+	b := chunk.NewTag(2, "b", 0, false)
+	for i := 0; i < 3; i++ {
+		q.push(newQueueTestChunk(i, 0), a)
+	}
+	for i := 3; i < 6; i++ {
+		q.push(newQueueTestChunk(i, 0), b)
+	}
+
+	exp := []int{0, 3, 1, 4, 2, 5}
+	for _, e := range exp {
+		ch, _ := q.pop()
+		if got := int(binary.BigEndian.Uint64(ch.Address()[:8])); got != e {
+			t.Fatalf("expected chunk %d, got %d", e, got)
+		}
+	}
+}
+
+// TestSendQueueRateLimit checks that a rate limited tag is held back
+// while other tags of lower priority can still be served
+func TestSendQueueRateLimit(t *testing.T) {
+	q := newSendQueue()
+
+	limited := chunk.NewTag(1, "limited", 0, false)
+	limited.SetPriority(chunk.PriorityHigh)
+	limited.SetRateLimit(chunk.DefaultSize)
+	other := chunk.NewTag(2, "other", 0, false)
+	other.SetPriority(chunk.PriorityBackground)
+
+	q.push(newQueueTestChunk(0, chunk.DefaultSize), limited)
+	q.push(newQueueTestChunk(1, chunk.DefaultSize), limited)
+	q.push(newQueueTestChunk(2, chunk.DefaultSize), other)
+
+	// burst allows the first chunk of the limited tag to be sent immediately
+	ch, _ := q.pop()
+	if got := int(binary.BigEndian.Uint64(ch.Address()[:8])); got != 0 {
+		t.Fatalf("expected chunk 0, got %d", got)
+	}
+	// the limited tag must wait, so the background tag is served
+	ch, _ = q.pop()
+	if got := int(binary.BigEndian.Uint64(ch.Address()[:8])); got != 2 {
+		t.Fatalf("expected chunk 2, got %d", got)
+	}
+	ch, wait := q.pop()
+	if ch != nil {
+		t.Fatal("expected rate limited tag to be held back")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait between 0 and 1s, got %v", wait)
+	}
+
+	// lifting the limit releases the chunk
+	limited.SetRateLimit(0)
+	ch, _ = q.pop()
+	if ch == nil {
+		t.Fatal("expected chunk after lifting rate limit")
+	}
+}
+
+// TestSendQueueRateLimitDrained checks that the rate limit of a tag still applies
+// after its queue drains, until the tag is done or removed
+func TestSendQueueRateLimitDrained(t *testing.T) {
+	q := newSendQueue()
+	tags := chunk.NewTags()
+
+	tag, err := tags.Create("limited", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetRateLimit(chunk.DefaultSize)
+
+	q.push(newQueueTestChunk(0, chunk.DefaultSize), tag)
+	if ch, _ := q.pop(); ch == nil {
+		t.Fatal("expected chunk 0 to be sent within the burst")
+	}
+
+	// the drained tag keeps its limiter, so a new chunk gets no fresh burst
+	q.prune(tags)
+	q.push(newQueueTestChunk(1, chunk.DefaultSize), tag)
+	ch, wait := q.pop()
+	if ch != nil {
+		t.Fatal("expected rate limited tag to be held back after draining")
+	}
+	if wait <= 0 {
+		t.Fatalf("expected positive wait, got %v", wait)
+	}
+
+	// once the tag is drained and removed its limiter is dropped
+	tag.SetRateLimit(0)
+	if ch, _ := q.pop(); ch == nil {
+		t.Fatal("expected chunk 1 after lifting rate limit")
+	}
+	tags.Delete(tag.Uid)
+	q.prune(tags)
+	if _, ok := q.limiters[tag.Uid]; ok {
+		t.Fatal("expected limiter of removed tag to be pruned")
+	}
+
+	// the limiter of a tag done syncing is dropped too
+	done, err := tags.Create("done", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done.SetRateLimit(chunk.DefaultSize)
+	q.push(newQueueTestChunk(2, chunk.DefaultSize), done)
+	if ch, _ := q.pop(); ch == nil {
+		t.Fatal("expected chunk 2 to be sent within the burst")
+	}
+	q.prune(tags)
+	if _, ok := q.limiters[done.Uid]; !ok {
+		t.Fatal("expected limiter of tag still syncing to be kept")
+	}
+	done.Inc(chunk.StateStored)
+	done.Inc(chunk.StateSynced)
+	q.prune(tags)
+	if _, ok := q.limiters[done.Uid]; ok {
+		t.Fatal("expected limiter of synced tag to be pruned")
+	}
+}
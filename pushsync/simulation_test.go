@@ -210,7 +210,7 @@ func newServiceFunc(ctx *adapters.ServiceContext, bucket *sync.Map) (node.Servic
 	bucket.Store(bucketKeyPushSyncer, p)
 
 	// setup storer
-	s := NewStorer(netStore, pubSub)
+	s := NewStorer(netStore, pubSub, privKey, nil)
 
 	cleanup := func() {
 		p.Close()
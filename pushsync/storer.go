@@ -18,7 +18,9 @@ package pushsync
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/hex"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -37,10 +39,14 @@ type Store interface {
 
 // Storer is the object used by the push-sync server side protocol
 type Storer struct {
-	store      Store      // store to put chunks in, and retrieve them from
-	ps         PubSub     // pubsub interface to receive chunks and send receipts
-	deregister func()     // deregister the registered handler when Storer is closed
-	logger     log.Logger // custom logger
+	store      Store                // store to put chunks in, and retrieve them from
+	ps         PubSub               // pubsub interface to receive chunks and send receipts
+	key        *ecdsa.PrivateKey    // key to sign receipts with
+	stamps     chunk.StampValidator // validates postage stamps of chunks, nil for no validation
+	deregister func()               // deregister the registered handler when Storer is closed
+	logger     log.Logger           // custom logger
+	activeMu   sync.RWMutex         // protects active
+	active     func() bool          // whether the node currently stores chunks, nil for always
 }
 
 // NewStorer constructs a Storer
@@ -48,17 +54,34 @@ type Storer struct {
 // that fall within their area of responsibility.
 // The protocol makes sure that
 // - the chunks are stored and synced to their nearest neighbours and
-// - a statement of custody receipt is sent as a response to the originator
+// - a statement of custody receipt signed with the key is sent as a response to the originator
+// Chunks with postage stamps not accepted by the stamp validator are dropped,
+// a nil stamp validator accepts all chunks.
 // it sets a cancel function that deregisters the handler
-func NewStorer(store Store, ps PubSub) *Storer {
+func NewStorer(store Store, ps PubSub, key *ecdsa.PrivateKey, stamps chunk.StampValidator) *Storer {
 	s := &Storer{
 		store:  store,
 		ps:     ps,
+		key:    key,
+		stamps: stamps,
 		logger: log.New("self", label(ps.BaseAddr())),
 	}
-	s.deregister = ps.Register(pssChunkTopic, true, func(msg []byte, _ *p2p.Peer) error {
-		return s.handleChunkMsg(msg)
+	deregister := ps.Register(pssChunkTopic, true, func(msg []byte, _ *p2p.Peer) error {
+		return s.handleChunkMsg(msg, decodeChunkMsg)
 	})
+	// chunks of nodes predating postage stamps are stored without stamps
+	deregisterUnstamped := ps.Register(unstampedChunkTopic, true, func(msg []byte, _ *p2p.Peer) error {
+		return s.handleChunkMsg(msg, decodeUnstampedChunkMsg)
+	})
+	// chunks of nodes predating signed receipts are stored and answered with unsigned receipts
+	deregisterLegacy := ps.Register(legacyChunkTopic, true, func(msg []byte, _ *p2p.Peer) error {
+		return s.handleChunkMsg(msg, decodeLegacyChunkMsg)
+	})
+	s.deregister = func() {
+		deregister()
+		deregisterUnstamped()
+		deregisterLegacy()
+	}
 	return s
 }
 
@@ -67,11 +90,26 @@ func (s *Storer) Close() {
 	s.deregister()
 }
 
-// handleChunkMsg is called by the pss dispatcher on pssChunkTopic msgs
-// - deserialises chunkMsg and
+// SetActive sets the function reporting whether the node currently takes storer duties
+// chunks received while it returns false, e.g. in light mode, are neither stored nor receipted
+func (s *Storer) SetActive(active func() bool) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	s.active = active
+}
+
+// isActive returns whether received chunks are stored
+func (s *Storer) isActive() bool {
+	s.activeMu.RLock()
+	defer s.activeMu.RUnlock()
+	return s.active == nil || s.active()
+}
+
+// handleChunkMsg is called by the pss dispatcher on pssChunkTopic, unstampedChunkTopic and legacyChunkTopic msgs
+// - deserialises chunkMsg with the decoder of the topic and
 // - calls storer.processChunkMsg function
-func (s *Storer) handleChunkMsg(msg []byte) error {
-	chmsg, err := decodeChunkMsg(msg)
+func (s *Storer) handleChunkMsg(msg []byte, decode func([]byte) (*chunkMsg, error)) error {
+	chmsg, err := decode(msg)
 	if err != nil {
 		return err
 	}
@@ -93,7 +131,20 @@ func (s *Storer) handleChunkMsg(msg []byte) error {
 // Upon receiving the chunk is saved and a statement of custody
 // receipt message is sent as a response to the originator.
 func (s *Storer) processChunkMsg(ctx context.Context, chmsg *chunkMsg) error {
+	if !s.isActive() {
+		s.logger.Trace("not storing chunk in light mode", "ref", label(chmsg.Addr))
+		return nil
+	}
 	ch := storage.NewChunk(chmsg.Addr, chmsg.Data)
+	if len(chmsg.Stamp) > 0 {
+		ch = ch.WithStamp(chmsg.Stamp)
+	}
+	if s.stamps != nil {
+		if err := s.stamps.ValidateStamp(ch); err != nil {
+			s.logger.Debug("dropping chunk with invalid postage stamp", "ref", label(chmsg.Addr), "err", err)
+			return err
+		}
+	}
 	if _, err := s.store.Put(ctx, chunk.ModePutSync, ch); err != nil {
 		return err
 	}
@@ -108,6 +159,8 @@ func (s *Storer) processChunkMsg(ctx context.Context, chmsg *chunkMsg) error {
 
 // sendReceiptMsg sends a statement of custody receipt message
 // to the originator of a push-synced chunk message.
+// The receipt is signed by the storer so that the originator can verify who stored the chunk,
+// unless the chunk message was received on the legacy topic.
 // Including a unique nonce makes the receipt immune to deduplication cache
 func (s *Storer) sendReceiptMsg(ctx context.Context, chmsg *chunkMsg) error {
 	ctx, osp := spancontext.StartSpan(ctx, "send.receipt")
@@ -117,15 +170,37 @@ func (s *Storer) sendReceiptMsg(ctx context.Context, chmsg *chunkMsg) error {
 	osp.SetTag("addr", hexaddr)
 	osp.LogFields(olog.String("origin", hex.EncodeToString(chmsg.Origin)))
 
+	to := chmsg.Origin
+	if chmsg.legacy {
+		msg, err := rlp.EncodeToBytes(&legacyReceiptMsg{
+			Addr:  chmsg.Addr,
+			Nonce: newNonce(),
+		})
+		if err != nil {
+			return err
+		}
+		s.logger.Trace("sendReceiptMsg", "addr", hexaddr, "to", label(to), "legacy", true)
+		return s.ps.Send(to, legacyReceiptTopic, msg)
+	}
+
+	sig, err := signReceipt(s.key, chmsg.Addr)
+	if err != nil {
+		return err
+	}
 	rmsg := &receiptMsg{
-		Addr:  chmsg.Addr,
-		Nonce: newNonce(),
+		Addr:   chmsg.Addr,
+		Nonce:  newNonce(),
+		Storer: storerAddress(&s.key.PublicKey),
+		Sig:    sig,
 	}
 	msg, err := rlp.EncodeToBytes(rmsg)
 	if err != nil {
 		return err
 	}
-	to := chmsg.Origin
+	topic := pssReceiptTopic
+	if chmsg.unstamped {
+		topic = unstampedReceiptTopic
+	}
 	s.logger.Trace("sendReceiptMsg", "addr", hexaddr, "to", label(to))
-	return s.ps.Send(to, pssReceiptTopic, msg)
+	return s.ps.Send(to, topic, msg)
 }
@@ -6,6 +6,15 @@ type (
 	HTTPRequestIDKey struct{}
 	requestHostKey   struct{}
 	tagKey           struct{}
+	backgroundKey    struct{}
+	metadataKey      struct{}
+	clientKey        struct{}
+	postageBatchKey  struct{}
+	recoveryKey      struct{}
+	chunkingKey      struct{}
+	compressionKey   struct{}
+	masterKeyKey     struct{}
+	encryptionKeyKey struct{}
 )
 
 // SetHost sets the http request host in the context
@@ -35,3 +44,132 @@ func GetTag(ctx context.Context) uint32 {
 	}
 	return 0
 }
+
+// SetBackground marks the retrievals done with the context as background work,
+// which is served after interactive retrievals
+func SetBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackground returns true if retrievals done with the context are background work
+func IsBackground(ctx context.Context) bool {
+	v, ok := ctx.Value(backgroundKey{}).(bool)
+	return ok && v
+}
+
+// SetMetadata marks the chunks retrieved with the context as metadata
+// (manifest or intermediate tree chunks), which are served before data chunks
+func SetMetadata(ctx context.Context, metadata bool) context.Context {
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// IsMetadata returns true if the chunks retrieved with the context are metadata
+func IsMetadata(ctx context.Context) bool {
+	v, ok := ctx.Value(metadataKey{}).(bool)
+	return ok && v
+}
+
+// SetClient sets the identifier of the client on behalf of which retrievals are done
+func SetClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// GetClient gets the identifier of the client on behalf of which retrievals are done
+func GetClient(ctx context.Context) string {
+	v, ok := ctx.Value(clientKey{}).(string)
+	if ok {
+		return v
+	}
+	return ""
+}
+
+// SetPostageBatch sets the id of the postage batch the uploaded chunks are stamped with
+func SetPostageBatch(ctx context.Context, batchID []byte) context.Context {
+	return context.WithValue(ctx, postageBatchKey{}, batchID)
+}
+
+// GetPostageBatch gets the id of the postage batch the uploaded chunks are stamped with
+func GetPostageBatch(ctx context.Context) []byte {
+	v, ok := ctx.Value(postageBatchKey{}).([]byte)
+	if ok {
+		return v
+	}
+	return nil
+}
+
+// SetRecoveryTargets sets the address prefixes of the neighbourhoods that are asked
+// to re-upload chunks that can not be retrieved
+func SetRecoveryTargets(ctx context.Context, targets [][]byte) context.Context {
+	return context.WithValue(ctx, recoveryKey{}, targets)
+}
+
+// GetRecoveryTargets gets the address prefixes of the neighbourhoods that are asked
+// to re-upload chunks that can not be retrieved
+func GetRecoveryTargets(ctx context.Context) [][]byte {
+	v, ok := ctx.Value(recoveryKey{}).([][]byte)
+	if ok {
+		return v
+	}
+	return nil
+}
+
+// SetContentDefinedChunking marks the documents stored with the context to be split
+// with content-defined chunking
+func SetContentDefinedChunking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, chunkingKey{}, true)
+}
+
+// IsContentDefinedChunking returns true if the documents stored with the context are
+// split with content-defined chunking
+func IsContentDefinedChunking(ctx context.Context) bool {
+	v, ok := ctx.Value(chunkingKey{}).(bool)
+	return ok && v
+}
+
+// SetCompression sets the compression algorithm of the data chunks of the documents
+// stored with the context
+func SetCompression(ctx context.Context, compression string) context.Context {
+	return context.WithValue(ctx, compressionKey{}, compression)
+}
+
+// GetCompression returns the compression algorithm of the data chunks of the documents
+// stored with the context, an empty string if they are not compressed
+func GetCompression(ctx context.Context) string {
+	v, ok := ctx.Value(compressionKey{}).(string)
+	if ok {
+		return v
+	}
+	return ""
+}
+
+// SetMasterKey sets the master key the encryption keys of the documents
+// stored with the context are derived from per path
+func SetMasterKey(ctx context.Context, key []byte) context.Context {
+	return context.WithValue(ctx, masterKeyKey{}, key)
+}
+
+// GetMasterKey returns the master key the encryption keys of the documents
+// stored with the context are derived from, nil if they are random
+func GetMasterKey(ctx context.Context) []byte {
+	v, ok := ctx.Value(masterKeyKey{}).([]byte)
+	if ok {
+		return v
+	}
+	return nil
+}
+
+// SetEncryptionKey sets the key the encryption keys of the chunks of
+// the document stored with the context are derived from
+func SetEncryptionKey(ctx context.Context, key []byte) context.Context {
+	return context.WithValue(ctx, encryptionKeyKey{}, key)
+}
+
+// GetEncryptionKey returns the key the encryption keys of the chunks of the
+// document stored with the context are derived from, nil if they are random
+func GetEncryptionKey(ctx context.Context) []byte {
+	v, ok := ctx.Value(encryptionKeyKey{}).([]byte)
+	if ok {
+		return v
+	}
+	return nil
+}
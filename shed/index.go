@@ -43,6 +43,7 @@ type Item struct {
 	BinID           uint64
 	PinCounter      uint64 // maintains the no of time a chunk is pinned
 	Tag             uint32
+	Stamp           []byte // encoded postage stamp
 }
 
 // Merge is a helper method to construct a new
@@ -70,6 +71,9 @@ func (i Item) Merge(i2 Item) (new Item) {
 	if i.Tag == 0 {
 		i.Tag = i2.Tag
 	}
+	if i.Stamp == nil {
+		i.Stamp = i2.Stamp
+	}
 	return i
 }
 
@@ -0,0 +1,311 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Placeholders that are expanded in the arguments of external nodes
+const (
+	ExternalDataDirPlaceholder   = "{datadir}"
+	ExternalAPIPortPlaceholder   = "{apiport}"
+	ExternalDebugPortPlaceholder = "{debugport}"
+	ExternalP2PPortPlaceholder   = "{p2pport}"
+)
+
+// ExternalAdapter manages nodes of other Swarm implementations (e.g. Bee) that are
+// executed locally. The nodes are expected to expose a Bee compatible debug API,
+// which is used to detect when the node is ready and to read its addresses.
+type ExternalAdapter struct {
+	config ExternalAdapterConfig
+}
+
+// ExternalAdapterConfig is used to configure an ExternalAdapter
+type ExternalAdapterConfig struct {
+	// Path to the executable
+	ExecutablePath string `json:"executable"`
+	// BaseDataDirectory stores all the nodes' data directories
+	BaseDataDirectory string `json:"basedir"`
+	// Args are prepended to the node arguments. Placeholders are expanded
+	// with the values allocated for every node.
+	Args []string `json:"args"`
+	// HealthPath is polled on the debug API until the node reports to be healthy
+	HealthPath string `json:"healthPath"`
+	// AddressesPath is the debug API path that returns the node addresses
+	AddressesPath string `json:"addressesPath"`
+}
+
+// DefaultExternalAdapterConfig returns the configuration to run Bee nodes
+// with the given executable and base data directory
+func DefaultExternalAdapterConfig(executablePath, baseDataDirectory string) ExternalAdapterConfig {
+	return ExternalAdapterConfig{
+		ExecutablePath:    executablePath,
+		BaseDataDirectory: baseDataDirectory,
+		Args: []string{
+			"start",
+			"--data-dir", ExternalDataDirPlaceholder,
+			"--api-addr", "localhost:" + ExternalAPIPortPlaceholder,
+			"--debug-api-enable",
+			"--debug-api-addr", "localhost:" + ExternalDebugPortPlaceholder,
+			"--p2p-addr", "localhost:" + ExternalP2PPortPlaceholder,
+		},
+		HealthPath:    "/health",
+		AddressesPath: "/addresses",
+	}
+}
+
+// ExternalNode is a node of another Swarm implementation that is executed locally
+type ExternalNode struct {
+	adapter  *ExternalAdapter
+	config   NodeConfig
+	cmd      *exec.Cmd
+	info     NodeInfo
+	waitChan chan error
+}
+
+// NewExternalAdapter creates an ExternalAdapter by receiving an ExternalAdapterConfig
+func NewExternalAdapter(config ExternalAdapterConfig) (*ExternalAdapter, error) {
+	if _, err := os.Stat(config.BaseDataDirectory); os.IsNotExist(err) {
+		return nil, fmt.Errorf("'%s' directory does not exist", config.BaseDataDirectory)
+	}
+
+	if _, err := os.Stat(config.ExecutablePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("'%s' executable does not exist", config.ExecutablePath)
+	}
+
+	absExec, err := filepath.Abs(config.ExecutablePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get absolute path for %s: %v", config.ExecutablePath, err)
+	}
+	config.ExecutablePath = absExec
+
+	absDir, err := filepath.Abs(config.BaseDataDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("could not get absolute path for %s: %v", config.BaseDataDirectory, err)
+	}
+	config.BaseDataDirectory = absDir
+
+	a := &ExternalAdapter{
+		config: config,
+	}
+	return a, nil
+}
+
+// NewNode creates a new node
+func (a ExternalAdapter) NewNode(config NodeConfig) Node {
+	info := NodeInfo{
+		ID: config.ID,
+	}
+	node := &ExternalNode{
+		config:   config,
+		adapter:  &a,
+		info:     info,
+		waitChan: make(chan error, 1),
+	}
+	return node
+}
+
+// Snapshot returns a snapshot of the adapter
+func (a ExternalAdapter) Snapshot() AdapterSnapshot {
+	return AdapterSnapshot{
+		Type:   "external",
+		Config: a.config,
+	}
+}
+
+// Info returns the node info
+func (n *ExternalNode) Info() NodeInfo {
+	return n.info
+}
+
+// Start starts the node
+func (n *ExternalNode) Start() error {
+	if n.cmd != nil {
+		return fmt.Errorf("node %s is already running", n.config.ID)
+	}
+
+	dir := n.dataDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create node directory: %s", err)
+	}
+
+	ports := make([]string, 3)
+	for i := range ports {
+		port, err := freePort()
+		if err != nil {
+			return fmt.Errorf("could not allocate port for node %s: %v", n.config.ID, err)
+		}
+		ports[i] = strconv.Itoa(port)
+	}
+	apiPort, debugPort, p2pPort := ports[0], ports[1], ports[2]
+
+	r := strings.NewReplacer(
+		ExternalDataDirPlaceholder, dir,
+		ExternalAPIPortPlaceholder, apiPort,
+		ExternalDebugPortPlaceholder, debugPort,
+		ExternalP2PPortPlaceholder, p2pPort,
+	)
+	args := []string{filepath.Base(n.adapter.config.ExecutablePath)}
+	for _, arg := range append(n.adapter.config.Args, n.config.Args...) {
+		args = append(args, r.Replace(arg))
+	}
+
+	n.cmd = &exec.Cmd{
+		Path:   n.adapter.config.ExecutablePath,
+		Args:   args,
+		Dir:    dir,
+		Env:    n.config.Env,
+		Stdout: n.config.Stdout,
+		Stderr: n.config.Stderr,
+	}
+	if err := n.cmd.Start(); err != nil {
+		n.cmd = nil
+		return fmt.Errorf("error starting node %s: %s", n.config.ID, err)
+	}
+	go func(cmd *exec.Cmd, waitCh chan error) {
+		waitCh <- cmd.Wait()
+	}(n.cmd, n.waitChan)
+
+	var err error
+	defer func() {
+		if err != nil {
+			n.Stop()
+		}
+	}()
+
+	debugURL := fmt.Sprintf("http://localhost:%s", debugPort)
+	err = n.waitHealthy(debugURL)
+	if err != nil {
+		return err
+	}
+
+	var addresses struct {
+		Overlay  string   `json:"overlay"`
+		Underlay []string `json:"underlay"`
+	}
+	err = getJSON(debugURL+n.adapter.config.AddressesPath, &addresses)
+	if err != nil {
+		return fmt.Errorf("could not get addresses of node %s: %v", n.config.ID, err)
+	}
+
+	n.info = NodeInfo{
+		ID:          n.config.ID,
+		BzzAddr:     "0x" + strings.TrimPrefix(addresses.Overlay, "0x"),
+		HTTPListen:  fmt.Sprintf("http://localhost:%s", apiPort),
+		DebugListen: debugURL,
+	}
+	if len(addresses.Underlay) > 0 {
+		n.info.Enode = addresses.Underlay[0]
+	}
+	return nil
+}
+
+// waitHealthy polls the health endpoint of the debug API until it succeeds,
+// the process exits or the startup timeout is reached
+func (n *ExternalNode) waitHealthy(debugURL string) error {
+	var err error
+	for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(200 * time.Millisecond) {
+		select {
+		case werr := <-n.waitChan:
+			n.waitChan <- werr
+			return fmt.Errorf("node %s exited during startup: %v", n.config.ID, werr)
+		default:
+		}
+		var res *http.Response
+		res, err = http.Get(debugURL + n.adapter.config.HealthPath)
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			return nil
+		}
+		err = fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return fmt.Errorf("node %s did not become healthy: %v", n.config.ID, err)
+}
+
+// Stop stops the node
+func (n *ExternalNode) Stop() error {
+	if n.cmd == nil {
+		return nil
+	}
+	defer func() {
+		n.cmd = nil
+	}()
+	// Try to gracefully terminate the process
+	if err := n.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return n.cmd.Process.Kill()
+	}
+
+	// Wait for the process to terminate or timeout
+	select {
+	case err := <-n.waitChan:
+		return err
+	case <-time.After(20 * time.Second):
+		return n.cmd.Process.Kill()
+	}
+}
+
+// Snapshot returns a snapshot of the node
+func (n *ExternalNode) Snapshot() (NodeSnapshot, error) {
+	snap := NodeSnapshot{
+		Config: n.config,
+	}
+	adapterSnap := n.adapter.Snapshot()
+	snap.Adapter = &adapterSnap
+	return snap, nil
+}
+
+// dataDir returns the path to the data directory that the node should use
+func (n *ExternalNode) dataDir() string {
+	return filepath.Join(n.adapter.config.BaseDataDirectory, string(n.config.ID))
+}
+
+// freePort returns a TCP port that is currently not in use
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// getJSON decodes the JSON response of a GET request to url into v
+func getJSON(url string, v interface{}) error {
+	res, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,309 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package interop runs retrieval, sync and pss scenarios across nodes of
+// different Swarm implementations started with the simulation package, in order
+// to catch wire format drift between them early.
+package interop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/simulation"
+	"github.com/gorilla/websocket"
+)
+
+// Client abstracts the APIs of a node of a specific implementation
+// that are exercised by the interop scenarios
+type Client interface {
+	// ID returns the simulation node ID
+	ID() simulation.NodeID
+	// Overlay returns the hex encoded overlay address of the node
+	Overlay() string
+	// Upload stores data on the node and returns the hex encoded reference
+	Upload(ctx context.Context, data []byte) (string, error)
+	// Download retrieves the data with the given reference through the node
+	Download(ctx context.Context, ref string) ([]byte, error)
+	// Has reports whether the chunk with the given address is stored locally
+	Has(ctx context.Context, addr string) (bool, error)
+	// SendPss sends a raw pss message on the topic to the node with the given overlay
+	SendPss(ctx context.Context, topic string, to string, msg []byte) error
+	// ReceivePss subscribes to raw pss messages on the topic. The returned
+	// function cancels the subscription.
+	ReceivePss(ctx context.Context, topic string) (<-chan []byte, func(), error)
+	// Close releases the resources held by the client
+	Close() error
+}
+
+// SwarmClient is a Client for nodes of this implementation
+type SwarmClient struct {
+	info simulation.NodeInfo
+	rpc  *rpc.Client
+}
+
+// NewSwarmClient creates a Client for the Swarm node with the given ID in the simulation
+func NewSwarmClient(sim *simulation.Simulation, id simulation.NodeID) (*SwarmClient, error) {
+	node, err := sim.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sim.RPCClient(id)
+	if err != nil {
+		return nil, err
+	}
+	return &SwarmClient{
+		info: node.Info(),
+		rpc:  client,
+	}, nil
+}
+
+// ID returns the simulation node ID
+func (c *SwarmClient) ID() simulation.NodeID {
+	return c.info.ID
+}
+
+// Overlay returns the hex encoded overlay address of the node
+func (c *SwarmClient) Overlay() string {
+	return strings.TrimPrefix(c.info.BzzAddr, "0x")
+}
+
+// Upload stores data on the node and returns the hex encoded reference
+func (c *SwarmClient) Upload(ctx context.Context, data []byte) (string, error) {
+	res, err := do(ctx, http.MethodPost, c.info.HTTPListen+"/bzz-raw:/", nil, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(res)), nil
+}
+
+// Download retrieves the data with the given reference through the node
+func (c *SwarmClient) Download(ctx context.Context, ref string) ([]byte, error) {
+	return do(ctx, http.MethodGet, c.info.HTTPListen+"/bzz-raw:/"+ref, nil, nil)
+}
+
+// Has reports whether the chunk with the given address is stored locally
+func (c *SwarmClient) Has(ctx context.Context, addr string) (bool, error) {
+	var has string
+	if err := c.rpc.CallContext(ctx, &has, "bzz_has", []string{strings.TrimPrefix(addr, "0x")}); err != nil {
+		return false, err
+	}
+	return has == "1", nil
+}
+
+// SendPss sends a raw pss message on the topic to the node with the given overlay
+func (c *SwarmClient) SendPss(ctx context.Context, topic string, to string, msg []byte) error {
+	addr, err := hexutil.Decode("0x" + strings.TrimPrefix(to, "0x"))
+	if err != nil {
+		return err
+	}
+	return c.rpc.CallContext(ctx, nil, "pss_sendRaw", hexutil.Bytes(addr), message.NewTopic([]byte(topic)), hexutil.Bytes(msg))
+}
+
+// ReceivePss subscribes to raw pss messages on the topic
+func (c *SwarmClient) ReceivePss(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	msgC := make(chan pss.APIMsg)
+	sub, err := c.rpc.Subscribe(ctx, "pss", msgC, "receive", message.NewTopic([]byte(topic)), true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan []byte)
+	quit := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case msg := <-msgC:
+				select {
+				case out <- msg.Msg:
+				case <-quit:
+					return
+				}
+			case <-sub.Err():
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	cancel := func() {
+		sub.Unsubscribe()
+		close(quit)
+	}
+	return out, cancel, nil
+}
+
+// Close releases the RPC connection
+func (c *SwarmClient) Close() error {
+	c.rpc.Close()
+	return nil
+}
+
+// BeeClient is a Client for Bee nodes started with the simulation ExternalAdapter
+type BeeClient struct {
+	info simulation.NodeInfo
+	// Header is added to every API request, e.g. to select a postage batch
+	Header http.Header
+}
+
+// NewBeeClient creates a Client for the Bee node with the given ID in the simulation
+func NewBeeClient(sim *simulation.Simulation, id simulation.NodeID) (*BeeClient, error) {
+	node, err := sim.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return newBeeClient(node.Info()), nil
+}
+
+func newBeeClient(info simulation.NodeInfo) *BeeClient {
+	return &BeeClient{
+		info:   info,
+		Header: make(http.Header),
+	}
+}
+
+// ID returns the simulation node ID
+func (c *BeeClient) ID() simulation.NodeID {
+	return c.info.ID
+}
+
+// Overlay returns the hex encoded overlay address of the node
+func (c *BeeClient) Overlay() string {
+	return strings.TrimPrefix(c.info.BzzAddr, "0x")
+}
+
+// Upload stores data on the node and returns the hex encoded reference
+func (c *BeeClient) Upload(ctx context.Context, data []byte) (string, error) {
+	res, err := do(ctx, http.MethodPost, c.info.HTTPListen+"/bytes", c.Header, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	var ref struct {
+		Reference string `json:"reference"`
+	}
+	if err := json.Unmarshal(res, &ref); err != nil {
+		return "", err
+	}
+	return ref.Reference, nil
+}
+
+// Download retrieves the data with the given reference through the node
+func (c *BeeClient) Download(ctx context.Context, ref string) ([]byte, error) {
+	return do(ctx, http.MethodGet, c.info.HTTPListen+"/bytes/"+ref, c.Header, nil)
+}
+
+// Has reports whether the chunk with the given address is stored locally
+func (c *BeeClient) Has(ctx context.Context, addr string) (bool, error) {
+	_, err := do(ctx, http.MethodGet, c.info.DebugListen+"/chunks/"+strings.TrimPrefix(addr, "0x"), c.Header, nil)
+	if err == errNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SendPss sends a raw pss message on the topic to the node with the given overlay.
+// The message is targeted at the first two bytes of the overlay.
+func (c *BeeClient) SendPss(ctx context.Context, topic string, to string, msg []byte) error {
+	to = strings.TrimPrefix(to, "0x")
+	if len(to) < 4 {
+		return fmt.Errorf("invalid overlay %q", to)
+	}
+	_, err := do(ctx, http.MethodPost, c.info.HTTPListen+"/pss/send/"+topic+"/"+to[:4], c.Header, bytes.NewReader(msg))
+	return err
+}
+
+// ReceivePss subscribes to raw pss messages on the topic
+func (c *BeeClient) ReceivePss(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	url := "ws" + strings.TrimPrefix(c.info.HTTPListen, "http") + "/pss/subscribe/" + topic
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, c.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan []byte)
+	quit := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case out <- msg:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	cancel := func() {
+		close(quit)
+		conn.Close()
+	}
+	return out, cancel, nil
+}
+
+// Close is a noop as the client does not hold any connections
+func (c *BeeClient) Close() error {
+	return nil
+}
+
+var errNotFound = errors.New("not found")
+
+// do sends an HTTP request and returns the response body, failing on
+// responses with a status other than 200 OK or 201 Created
+func do(ctx context.Context, method, url string, header http.Header, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, errNotFound
+	}
+	return nil, fmt.Errorf("%s %s: unexpected status %s", method, url, res.Status)
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package interop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/simulation"
+)
+
+// TestRetrievalBee checks the retrieval scenario against a mock of the Bee API
+func TestRetrievalBee(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		chunks = make(map[string][]byte)
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bytes", func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256(data)
+		ref := hex.EncodeToString(sum[:])
+		mu.Lock()
+		chunks[ref] = data
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"reference":"` + ref + `"}`))
+	})
+	mux.HandleFunc("/bytes/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		data, ok := chunks[strings.TrimPrefix(r.URL.Path, "/bytes/")]
+		mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := newBeeClient(simulation.NodeInfo{ID: "bee", HTTPListen: srv.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Retrieval(ctx, client, client, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Download(ctx, "00"); err != errNotFound {
+		t.Fatalf("got error %v, want %v", err, errNotFound)
+	}
+}
+
+// TestInterop runs all scenarios between a Swarm and an external node.
+// The path to the external executable is read from SWARM_INTEROP_EXECUTABLE,
+// additional arguments from SWARM_INTEROP_ARGS.
+func TestInterop(t *testing.T) {
+	execPath := "../../build/bin/swarm"
+	if _, err := os.Stat(execPath); err != nil {
+		t.Skip("swarm binary not found. build it before running the test")
+	}
+	externalPath := os.Getenv("SWARM_INTEROP_EXECUTABLE")
+	if externalPath == "" {
+		t.Skip("SWARM_INTEROP_EXECUTABLE is not set")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "test-interop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	adapter, err := simulation.NewExecAdapter(simulation.ExecAdapterConfig{
+		ExecutablePath:    execPath,
+		BaseDataDirectory: tmpdir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := simulation.NewExternalAdapter(simulation.DefaultExternalAdapterConfig(externalPath, tmpdir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := simulation.NewSimulation(adapter)
+	defer sim.StopAll()
+
+	nodes, err := sim.CreateClusterWithBootnode("swarm", 1, []string{"--bzznetworkid", "499"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sim.InitWithAdapter(simulation.NodeConfig{
+		ID:     "external",
+		Args:   strings.Fields(os.Getenv("SWARM_INTEROP_ARGS")),
+		Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard,
+	}, external)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Start("external"); err != nil {
+		t.Fatal(err)
+	}
+
+	swarmClient, err := NewSwarmClient(sim, nodes[1].Info().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer swarmClient.Close()
+	beeClient, err := NewBeeClient(sim, "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := []Client{swarmClient, beeClient}
+
+	for _, pair := range [][2]Client{{swarmClient, beeClient}, {beeClient, swarmClient}} {
+		from, to := pair[0], pair[1]
+		name := string(from.ID()) + "->" + string(to.ID())
+		t.Run("retrieval/"+name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := Retrieval(ctx, from, to, 10000); err != nil {
+				t.Fatal(err)
+			}
+		})
+		t.Run("sync/"+name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := Sync(ctx, from, clients, 1000); err != nil {
+				t.Fatal(err)
+			}
+		})
+		t.Run("pss/"+name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := Pss(ctx, from, to, "interop"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
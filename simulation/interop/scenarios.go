@@ -0,0 +1,156 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package interop
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// pollInterval is the interval between attempts of scenario steps that
+// depend on the propagation of data in the network
+var pollInterval = 500 * time.Millisecond
+
+// Retrieval uploads random data of the given size to the uploader and checks
+// that the downloader retrieves the same data
+func Retrieval(ctx context.Context, uploader, downloader Client, size int) error {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	ref, err := uploader.Upload(ctx, data)
+	if err != nil {
+		return fmt.Errorf("upload to %s: %v", uploader.ID(), err)
+	}
+	return poll(ctx, func() error {
+		got, err := downloader.Download(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("download %s from %s: %v", ref, downloader.ID(), err)
+		}
+		if !bytes.Equal(got, data) {
+			return fmt.Errorf("download %s from %s: data mismatch", ref, downloader.ID())
+		}
+		return nil
+	})
+}
+
+// Sync uploads a single chunk of random data to the uploader and checks that
+// it is synced to the node among nodes that is closest to the chunk address
+func Sync(ctx context.Context, uploader Client, nodes []Client, size int) error {
+	if size > chunk.DefaultSize {
+		return fmt.Errorf("size %d exceeds chunk size", size)
+	}
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	ref, err := uploader.Upload(ctx, data)
+	if err != nil {
+		return fmt.Errorf("upload to %s: %v", uploader.ID(), err)
+	}
+	closest, err := closestNode(ref, nodes)
+	if err != nil {
+		return err
+	}
+	return poll(ctx, func() error {
+		has, err := closest.Has(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("chunk %s not synced to %s", ref, closest.ID())
+		}
+		return nil
+	})
+}
+
+// Pss sends a random message on the topic from the sender to the recipient
+// and checks that the recipient receives it
+func Pss(ctx context.Context, sender, recipient Client, topic string) error {
+	msgC, cancel, err := recipient.ReceivePss(ctx, topic)
+	if err != nil {
+		return fmt.Errorf("subscribe on %s: %v", recipient.ID(), err)
+	}
+	defer cancel()
+
+	msg := make([]byte, 32)
+	if _, err := rand.Read(msg); err != nil {
+		return err
+	}
+	if err := sender.SendPss(ctx, topic, recipient.Overlay(), msg); err != nil {
+		return fmt.Errorf("send from %s: %v", sender.ID(), err)
+	}
+	for {
+		select {
+		case got, ok := <-msgC:
+			if !ok {
+				return fmt.Errorf("subscription on %s closed", recipient.ID())
+			}
+			if bytes.Equal(got, msg) {
+				return nil
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("message not received by %s: %v", recipient.ID(), ctx.Err())
+		}
+	}
+}
+
+// closestNode returns the node with the overlay address closest to ref
+func closestNode(ref string, nodes []Client) (Client, error) {
+	addr, err := hex.DecodeString(strings.TrimPrefix(ref, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %q: %v", ref, err)
+	}
+	var closest Client
+	po := -1
+	for _, n := range nodes {
+		overlay, err := hex.DecodeString(n.Overlay())
+		if err != nil {
+			return nil, fmt.Errorf("invalid overlay of %s: %v", n.ID(), err)
+		}
+		if p := chunk.Proximity(overlay, addr); p > po {
+			closest, po = n, p
+		}
+	}
+	if closest == nil {
+		return nil, fmt.Errorf("no nodes")
+	}
+	return closest, nil
+}
+
+// poll calls f until it succeeds or the context is done, in which
+// case the last error is returned
+func poll(ctx context.Context, f func() error) error {
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(pollInterval):
+		}
+	}
+}
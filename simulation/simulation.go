@@ -84,6 +84,8 @@ func getAdapterFromSnapshotConfig(snapshot *AdapterSnapshot) (Adapter, error) {
 		adapter, err = NewDockerAdapter(snapshot.Config.(DockerAdapterConfig))
 	case "kubernetes":
 		adapter, err = NewKubernetesAdapter(snapshot.Config.(KubernetesAdapterConfig))
+	case "external":
+		adapter, err = NewExternalAdapter(snapshot.Config.(ExternalAdapterConfig))
 	default:
 		return nil, fmt.Errorf("unknown adapter type: %s", t)
 	}
@@ -185,6 +187,13 @@ func (s *AdapterSnapshot) detectConfigurationType() error {
 			return err
 		}
 		s.Config = config
+	case "external":
+		var config ExternalAdapterConfig
+		err := json.Unmarshal(adapterconfig, &config)
+		if err != nil {
+			return err
+		}
+		s.Config = config
 	default:
 		return fmt.Errorf("unknown adapter type: %s", t)
 	}
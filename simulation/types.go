@@ -48,6 +48,7 @@ type NodeInfo struct {
 	RPCListen   string // RPC listener address. Should be a valid ipc or websocket path
 	HTTPListen  string // HTTP listener address: e.g. http://localhost:8500
 	PprofListen string // PProf listener address: e.g http://localhost:6060
+	DebugListen string // Debug API listener address of external nodes: e.g http://localhost:1635
 }
 
 // Snapshot is a snapshot of a simulation. It contains snapshots of:
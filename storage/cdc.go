@@ -0,0 +1,344 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"golang.org/x/crypto/sha3"
+)
+
+/*
+Content-defined chunking splits the data at boundaries found with a rolling hash of
+the content instead of at fixed offsets, so that an edit of a large file only changes
+the chunks around the edit and the edited version shares most chunks with the prior one.
+
+Data chunks are regular content addressed chunks of variable length. Since the offset
+of a data chunk can not be computed from its index, intermediate chunks list the
+references of their children together with the size of their subtrees:
+
+	span 8 bytes | (reference | size 8 bytes)*
+
+The most significant bit of the size is set if the child is an intermediate chunk.
+Intermediate chunks are cut at content-defined boundaries as well. The root of the
+tree is always an intermediate chunk, and its reference is suffixed with the
+ContentDefinedChunking byte to tell it apart from fixed size chunked content.
+*/
+
+// ContentDefinedChunking is the byte appended to the root address of content split
+// with content-defined chunking
+const ContentDefinedChunking byte = 0xcd
+
+// Names of the chunking schemes, as selected for uploads and recorded in manifests
+const (
+	ChunkingFixed          = "fixed"
+	ChunkingContentDefined = "content-defined"
+)
+
+const (
+	cdcMinSize      = 1024              // minimum length of a data chunk, except the last one
+	cdcMaxSize      = chunk.DefaultSize // maximum length of a data chunk
+	cdcMask         = 1<<11 - 1         // a boundary is found on average every 2048 bytes after the minimum length
+	cdcBranchMask   = 1<<4 - 1          // intermediate chunks have 16 children on average
+	cdcSizeLength   = 8
+	cdcIntermediate = 1 << 63 // set in the size of a child that is an intermediate chunk
+)
+
+// gearTable holds the random values the rolling gear hash is computed with
+var gearTable [256]uint64
+
+func init() {
+	h := sha3.NewLegacyKeccak256()
+	for i := range gearTable {
+		h.Reset()
+		h.Write([]byte{byte(i)})
+		gearTable[i] = binary.LittleEndian.Uint64(h.Sum(nil))
+	}
+}
+
+// cdcEntry is a child of an intermediate chunk of a content-defined chunked tree
+type cdcEntry struct {
+	ref          Reference
+	size         int64
+	intermediate bool
+}
+
+// IsContentDefined returns true if the reference is the root of content split
+// with content-defined chunking
+func IsContentDefined(ref Reference) bool {
+	return len(ref) == AddressLength+1 && ref[AddressLength] == ContentDefinedChunking
+}
+
+// Chunking returns the name of the chunking scheme the content with the root reference was split with
+func Chunking(ref Reference) string {
+	if IsContentDefined(ref) {
+		return ChunkingContentDefined
+	}
+	return ChunkingFixed
+}
+
+// ContentDefinedSplit splits the data into chunks at content-defined boundaries, stores
+// them with the putter and returns the root reference suffixed with ContentDefinedChunking
+func ContentDefinedSplit(ctx context.Context, data io.Reader, putter Putter) (Address, func(context.Context) error, error) {
+	defer putter.Close()
+	if putter.RefSize() != AddressLength {
+		return nil, nil, fmt.Errorf("content-defined chunking is not supported with references of %d bytes", putter.RefSize())
+	}
+
+	var (
+		level  []cdcEntry
+		reader = bufio.NewReader(data)
+		buf    = make([]byte, cdcSizeLength, cdcSizeLength+cdcMaxSize)
+		h      uint64
+	)
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size := len(buf) - cdcSizeLength
+		binary.LittleEndian.PutUint64(buf[:cdcSizeLength], uint64(size))
+		ref, err := putter.Put(ctx, ChunkData(append([]byte{}, buf...)))
+		if err != nil {
+			return err
+		}
+		level = append(level, cdcEntry{ref: ref, size: int64(size)})
+		buf = buf[:cdcSizeLength]
+		h = 0
+		return nil
+	}
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		buf = append(buf, c)
+		h = h<<1 + gearTable[c]
+		if size := len(buf) - cdcSizeLength; size >= cdcMaxSize || size >= cdcMinSize && h&cdcMask == 0 {
+			if err := flush(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if len(buf) > cdcSizeLength || len(level) == 0 {
+		if err := flush(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the root is an intermediate chunk even if the data fits in a single data chunk
+	for {
+		var err error
+		level, err = cdcLevel(ctx, putter, level)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(level) == 1 {
+			break
+		}
+	}
+	root := make(Address, 0, AddressLength+1)
+	root = append(append(root, level[0].ref...), ContentDefinedChunking)
+	return root, putter.Wait, nil
+}
+
+// cdcLevel stores the intermediate chunks of the given level of the tree and returns
+// the entries of the level above. Every intermediate chunk has at least two children
+// unless the level has a single entry, so the number of entries at least halves.
+func cdcLevel(ctx context.Context, putter Putter, level []cdcEntry) ([]cdcEntry, error) {
+	entryLength := int(putter.RefSize()) + cdcSizeLength
+	branches := chunk.DefaultSize / entryLength
+
+	var (
+		next  []cdcEntry
+		group []cdcEntry
+	)
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data := make([]byte, cdcSizeLength+len(group)*entryLength)
+		var span int64
+		for i, e := range group {
+			offset := cdcSizeLength + i*entryLength
+			copy(data[offset:], e.ref)
+			size := uint64(e.size)
+			if e.intermediate {
+				size |= cdcIntermediate
+			}
+			binary.LittleEndian.PutUint64(data[offset+len(e.ref):], size)
+			span += e.size
+		}
+		binary.LittleEndian.PutUint64(data[:cdcSizeLength], uint64(span))
+		ref, err := putter.Put(ctx, ChunkData(data))
+		if err != nil {
+			return err
+		}
+		next = append(next, cdcEntry{ref: ref, size: span, intermediate: true})
+		group = group[:0]
+		return nil
+	}
+	for _, e := range level {
+		group = append(group, e)
+		if len(group) >= branches || len(group) >= 2 && e.ref[len(e.ref)-1]&cdcBranchMask == 0 {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(group) > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// cdcEntries parses the children of an intermediate chunk
+func cdcEntries(chunkData ChunkData, refSize int64) ([]cdcEntry, error) {
+	entryLength := refSize + cdcSizeLength
+	if len(chunkData) < cdcSizeLength || int64(len(chunkData)-cdcSizeLength)%entryLength != 0 {
+		return nil, fmt.Errorf("invalid intermediate chunk length %d", len(chunkData))
+	}
+	entries := make([]cdcEntry, (int64(len(chunkData))-cdcSizeLength)/entryLength)
+	for i := range entries {
+		offset := cdcSizeLength + int64(i)*entryLength
+		size := binary.LittleEndian.Uint64(chunkData[offset+refSize:])
+		entries[i] = cdcEntry{
+			ref:          Reference(chunkData[offset : offset+refSize]),
+			size:         int64(size &^ cdcIntermediate),
+			intermediate: size&cdcIntermediate != 0,
+		}
+	}
+	return entries, nil
+}
+
+// readAtContentDefined implements ReadAt for content split with content-defined chunking
+func (r *LazyChunkReader) readAtContentDefined(b []byte, off int64) (int, error) {
+	size, err := r.Size(r.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+	length := int64(len(b))
+	if off+length > size {
+		length = size - off
+	}
+	if err := r.joinContentDefined(r.ctx, b[:length], off, r.chunkData); err != nil {
+		if cerr := r.ctx.Err(); cerr != nil {
+			return 0, cerr
+		}
+		return 0, err
+	}
+	if off+int64(len(b)) >= size {
+		return int(length), io.EOF
+	}
+	return len(b), nil
+}
+
+// joinContentDefined reads the data at offset off of the subtree of the intermediate
+// chunk into b, retrieving the overlapping children concurrently
+func (r *LazyChunkReader) joinContentDefined(ctx context.Context, b []byte, off int64, chunkData ChunkData) error {
+	entries, err := cdcEntries(chunkData, r.hashSize)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		errC  = make(chan error, len(entries))
+		start int64
+		end   = off + int64(len(b))
+	)
+	for _, e := range entries {
+		childStart, childEnd := start, start+e.size
+		start = childEnd
+		if childEnd <= off || childStart >= end {
+			continue
+		}
+		lo, hi := off, end
+		if childStart > lo {
+			lo = childStart
+		}
+		if childEnd < hi {
+			hi = childEnd
+		}
+		wg.Add(1)
+		go func(e cdcEntry, dst []byte, childOff int64) {
+			defer wg.Done()
+			cctx := ctx
+			if e.intermediate {
+				cctx = sctx.SetMetadata(ctx, true)
+			}
+			data, err := r.getter.Get(cctx, e.ref)
+			if err != nil {
+				errC <- fmt.Errorf("chunk %x not found: %v", []byte(e.ref), err)
+				return
+			}
+			if e.intermediate {
+				if err := r.joinContentDefined(ctx, dst, childOff, data); err != nil {
+					errC <- err
+				}
+				return
+			}
+			if int64(len(data))-cdcSizeLength < childOff+int64(len(dst)) {
+				errC <- fmt.Errorf("chunk %x incomplete, data length %d", []byte(e.ref), len(data))
+				return
+			}
+			copy(dst, data[cdcSizeLength+childOff:])
+		}(e, b[lo-off:hi-off], lo-childStart)
+	}
+	wg.Wait()
+	close(errC)
+	return <-errC
+}
+
+// walkContentDefined descends into the children of the intermediate chunk of content
+// split with content-defined chunking
+func walkContentDefined(ctx context.Context, getter *hasherStore, chunkData ChunkData, walkFn func(Reference) error) error {
+	entries, err := cdcEntries(chunkData, getter.RefSize())
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := walkFn(e.ref); err != nil {
+			return err
+		}
+		if !e.intermediate {
+			continue
+		}
+		data, err := getter.Get(sctx.SetMetadata(ctx, true), e.ref)
+		if err != nil {
+			return err
+		}
+		if err := walkContentDefined(ctx, getter, data, walkFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestContentDefinedChunking tests that content split with content-defined chunking
+// is retrieved correctly with reads at any offset
+func TestContentDefinedChunking(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileStore, cleanup, err := NewLocalFileStore(dir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx := sctx.SetContentDefinedChunking(context.Background())
+	for _, size := range []int{1, 1000, 4096, 5000, 100000, 1000000} {
+		data := testutil.RandomBytes(size, size)
+		addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(size), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !IsContentDefined(Reference(addr)) {
+			t.Fatalf("size %d: expected content-defined reference, got %x", size, addr)
+		}
+
+		reader, isEncrypted := fileStore.Retrieve(context.Background(), addr)
+		if isEncrypted {
+			t.Fatalf("size %d: expected unencrypted content", size)
+		}
+		got, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: retrieved data does not match", size)
+		}
+
+		for _, off := range []int{0, size / 3, size - 1} {
+			b := make([]byte, 3000)
+			n, err := reader.ReadAt(b, int64(off))
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			expected := data[off:]
+			if len(expected) > len(b) {
+				expected = expected[:len(b)]
+			}
+			if !bytes.Equal(b[:n], expected) {
+				t.Fatalf("size %d: read at offset %d does not match", size, off)
+			}
+		}
+	}
+}
+
+// TestContentDefinedChunkingDeduplication tests that an edited version of a document
+// split with content-defined chunking shares most chunks with the prior version
+func TestContentDefinedChunkingDeduplication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileStore, cleanup, err := NewLocalFileStore(dir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	data := testutil.RandomBytes(1, 1000000)
+	edited := append(append(append([]byte{}, data[:500000]...), []byte("an insertion that shifts the rest of the data")...), data[500000:]...)
+
+	refs := func(data []byte, contentDefined bool) map[string]bool {
+		ctx := context.Background()
+		if contentDefined {
+			ctx = sctx.SetContentDefinedChunking(ctx)
+		}
+		addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		refs := make(map[string]bool)
+		err = fileStore.Walk(ctx, addr, func(ref Reference) error {
+			refs[string(ref)] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return refs
+	}
+	shared := func(a, b map[string]bool) float64 {
+		var n int
+		for ref := range b {
+			if a[ref] {
+				n++
+			}
+		}
+		return float64(n) / float64(len(b))
+	}
+
+	if s := shared(refs(data, true), refs(edited, true)); s < 0.9 {
+		t.Fatalf("expected at least 90%% shared chunks with content-defined chunking, got %.2f", s)
+	}
+	// with fixed size chunking the insertion shifts all the following chunks
+	if s := shared(refs(data, false), refs(edited, false)); s > 0.6 {
+		t.Fatalf("expected at most 60%% shared chunks with fixed size chunking, got %.2f", s)
+	}
+}
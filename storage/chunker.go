@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/spancontext"
 	opentracing "github.com/opentracing/opentracing-go"
 	olog "github.com/opentracing/opentracing-go/log"
@@ -371,6 +372,8 @@ type LazyChunkReader struct {
 	hashSize  int64 // inherit from chunker
 	depth     int
 	getter    Getter
+
+	contentDefined bool // the tree is split with content-defined chunking
 }
 
 func (tc *TreeChunker) Join(ctx context.Context) *LazyChunkReader {
@@ -403,7 +406,8 @@ func (r *LazyChunkReader) Size(ctx context.Context, quitC chan bool) (n int64, e
 	log.Debug("lazychunkreader.size", "addr", r.addr)
 	if r.chunkData == nil {
 		startTime := time.Now()
-		chunkData, err := r.getter.Get(cctx, Reference(r.addr))
+		// the root chunk is needed for any read, so it is retrieved with metadata priority
+		chunkData, err := r.getter.Get(sctx.SetMetadata(cctx, true), Reference(r.addr))
 		if err != nil {
 			metrics.GetOrRegisterResettingTimer("lcr/getter/get/err", nil).UpdateSince(startTime)
 			return 0, err
@@ -441,6 +445,9 @@ func (r *LazyChunkReader) ReadAt(b []byte, off int64) (read int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	if r.contentDefined {
+		return r.readAtContentDefined(b, off)
+	}
 	quitC := make(chan bool)
 	size, err := r.Size(cctx, quitC)
 	if err != nil {
@@ -475,6 +482,10 @@ func (r *LazyChunkReader) ReadAt(b []byte, off int64) (read int, err error) {
 	if err != nil {
 		log.Debug("lazychunkreader.readat.errc", "err", err)
 		close(quitC)
+		// report the cancellation of the read rather than the chunks that could not be retrieved
+		if cerr := cctx.Err(); cerr != nil {
+			return 0, cerr
+		}
 		return 0, err
 	}
 	if off+int64(len(b)) >= size {
@@ -529,11 +540,24 @@ func (r *LazyChunkReader) join(ctx context.Context, b []byte, off int64, eoff in
 		if depth > 1 {
 			wg.Wait()
 		}
+		// do not retrieve further chunks if the read is cancelled
+		if err := ctx.Err(); err != nil {
+			select {
+			case errC <- err:
+			case <-quitC:
+			}
+			return
+		}
 		wg.Add(1)
 		go func(j int64) {
 			childAddress := chunkData[8+j*r.hashSize : 8+(j+1)*r.hashSize]
 			startTime := time.Now()
-			chunkData, err := r.getter.Get(ctx, Reference(childAddress))
+			// intermediate tree chunks are retrieved with metadata priority
+			cctx := ctx
+			if depth-1 > r.depth {
+				cctx = sctx.SetMetadata(ctx, true)
+			}
+			chunkData, err := r.getter.Get(cctx, Reference(childAddress))
 			if err != nil {
 				metrics.GetOrRegisterResettingTimer("lcr/getter/get/err", nil).UpdateSince(startTime)
 				select {
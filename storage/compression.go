@@ -0,0 +1,92 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/golang/snappy"
+)
+
+/*
+Compression of chunk payloads shrinks the data chunks of compressible content before
+they are stored. A data chunk is compressed if its compressed payload is shorter than
+the original one; the flag is set in its span to tell it apart:
+
+	span | CompressedSpan 8 bytes | snappy block
+
+The span still holds the length of the original payload, so the offsets in the tree
+are unchanged and the joiner only decompresses the data chunks as they are retrieved.
+Encrypted chunks are padded to the full chunk size, so only unencrypted content is
+compressed.
+*/
+
+// CompressedSpan is the flag set in the span of a compressed data chunk
+const CompressedSpan uint64 = 1 << 63
+
+// Names of the compression algorithms, as selected for uploads and recorded in manifests
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+)
+
+// IsCompressed returns true if the chunk data is a compressed data chunk
+func IsCompressed(chunkData ChunkData) bool {
+	return len(chunkData) >= 8 && chunkData.Size()&CompressedSpan != 0
+}
+
+// isDataChunk returns true if the chunk data is a data chunk, the payload of which
+// is as long as its span
+func isDataChunk(chunkData ChunkData) bool {
+	return len(chunkData) >= 8 && chunkData.Size() == uint64(len(chunkData)-8)
+}
+
+// compressChunkData compresses the payload of a data chunk, it returns the chunk data
+// unchanged if the payload does not shrink
+func compressChunkData(chunkData ChunkData) ChunkData {
+	payload := chunkData[8:]
+	c := make(ChunkData, 8+snappy.MaxEncodedLen(len(payload)))
+	encoded := snappy.Encode(c[8:], payload)
+	if len(encoded) >= len(payload) {
+		return chunkData
+	}
+	binary.LittleEndian.PutUint64(c[:8], uint64(len(payload))|CompressedSpan)
+	return c[:8+len(encoded)]
+}
+
+// decompressChunkData restores the original data of a compressed data chunk
+func decompressChunkData(chunkData ChunkData) (ChunkData, error) {
+	size := chunkData.Size() &^ CompressedSpan
+	if size > chunk.DefaultSize {
+		return nil, fmt.Errorf("invalid compressed chunk: span %d", size)
+	}
+	n, err := snappy.DecodedLen(chunkData[8:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed chunk: %v", err)
+	}
+	if uint64(n) != size {
+		return nil, fmt.Errorf("invalid compressed chunk: decoded length %d, span %d", n, size)
+	}
+	c := make(ChunkData, 8+n)
+	if _, err := snappy.Decode(c[8:], chunkData[8:]); err != nil {
+		return nil, fmt.Errorf("invalid compressed chunk: %v", err)
+	}
+	binary.LittleEndian.PutUint64(c[:8], size)
+	return c, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestCompression tests that compressible content is stored in compressed data chunks,
+// retrieved correctly with reads at any offset and accounted in the tag
+func TestCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tags := chunk.NewTags()
+	fileStore, cleanup, err := NewLocalFileStore(dir, make([]byte, 32), tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	for _, chunking := range []string{ChunkingFixed, ChunkingContentDefined} {
+		for _, size := range []int{1000, 4096, 5000, 100000, 1000000} {
+			// repeating a short random sequence makes the content compressible
+			data := bytes.Repeat(testutil.RandomBytes(size, 100), size/100+1)[:size]
+
+			tag, err := tags.Create("compression", 0, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := sctx.SetCompression(sctx.SetTag(context.Background(), tag.Uid), CompressionSnappy)
+			if chunking == ChunkingContentDefined {
+				ctx = sctx.SetContentDefinedChunking(ctx)
+			}
+			addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(size), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if r := tag.CompressionRatio(); r <= 1 {
+				t.Fatalf("%s size %d: expected compression ratio above 1, got %v", chunking, size, r)
+			}
+			if tag.RawBytes != int64(size) {
+				t.Fatalf("%s size %d: expected %d raw bytes, got %d", chunking, size, size, tag.RawBytes)
+			}
+
+			var compressed int
+			err = fileStore.Walk(context.Background(), addr, func(ref Reference) error {
+				ch, err := fileStore.ChunkStore.Get(context.Background(), chunk.ModeGetRequest, Address(ref[:AddressLength]))
+				if err != nil {
+					return err
+				}
+				if IsCompressed(ch.Data()) {
+					compressed++
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed == 0 {
+				t.Fatalf("%s size %d: expected compressed data chunks", chunking, size)
+			}
+
+			reader, _ := fileStore.Retrieve(context.Background(), addr)
+			got, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s size %d: retrieved data does not match", chunking, size)
+			}
+			for _, off := range []int{0, size / 3, size - 1} {
+				b := make([]byte, 3000)
+				n, err := reader.ReadAt(b, int64(off))
+				if err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				expected := data[off:]
+				if len(expected) > len(b) {
+					expected = expected[:len(b)]
+				}
+				if !bytes.Equal(b[:n], expected) {
+					t.Fatalf("%s size %d: read at offset %d does not match", chunking, size, off)
+				}
+			}
+		}
+	}
+}
+
+// TestCompressionIncompressible tests that data chunks of incompressible content
+// are stored as they are
+func TestCompressionIncompressible(t *testing.T) {
+	data := testutil.RandomBytes(1, chunk.DefaultSize)
+	chunkData := newTestChunkData(data)
+	if !isDataChunk(chunkData) {
+		t.Fatal("expected a data chunk")
+	}
+	if c := compressChunkData(chunkData); IsCompressed(c) || !bytes.Equal(c, chunkData) {
+		t.Fatal("expected incompressible chunk data to be unchanged")
+	}
+
+	chunkData = newTestChunkData(make([]byte, chunk.DefaultSize))
+	c := compressChunkData(chunkData)
+	if !IsCompressed(c) || len(c) >= len(chunkData) {
+		t.Fatalf("expected compressed chunk data, got length %d", len(c))
+	}
+	d, err := decompressChunkData(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d, chunkData) {
+		t.Fatal("decompressed chunk data does not match")
+	}
+}
+
+// newTestChunkData returns the chunk data of a data chunk with the payload
+func newTestChunkData(payload []byte) ChunkData {
+	c := make(ChunkData, 8+len(payload))
+	binary.LittleEndian.PutUint64(c[:8], uint64(len(payload)))
+	copy(c[8:], payload)
+	return c
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	bip39 "github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// hkdfSalt is the salt of the extraction of the path keys from the master key
+var hkdfSalt = []byte("swarm-encryption-path-key")
+
+// ErrInvalidMasterKey is returned by ParseMasterKey if the master key is neither
+// a hex encoded key of KeyLength bytes nor a BIP-39 mnemonic with a valid checksum
+var ErrInvalidMasterKey = errors.New("invalid master key")
+
+// DeriveKey derives the key of the content at the path from the master key
+// with HKDF-SHA256, so that different paths are encrypted with unrelated keys
+// and the master key is not exposed by any of them.
+func DeriveKey(master Key, path string) Key {
+	// extract a pseudorandom key from the master key
+	mac := hmac.New(sha256.New, hkdfSalt)
+	mac.Write(master)
+	prk := mac.Sum(nil)
+	// expand it with the path as info, a single block is KeyLength long
+	mac = hmac.New(sha256.New, prk)
+	mac.Write([]byte(path))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
+
+// ChunkKey returns the key of the chunk with the data derived from the key
+// of the content, so that the same data is encrypted to the same chunk and
+// different data never with the same key.
+func ChunkKey(key Key, data []byte) Key {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// KeyFromMnemonic returns the master key of the mnemonic and the optional passphrase,
+// the first KeyLength bytes of the seed of the BIP-39 seed derivation.
+func KeyFromMnemonic(mnemonic, passphrase string) Key {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), 2048, KeyLength, sha512.New)
+}
+
+// ParseMasterKey parses a master key given either as a hex encoded key
+// or as a mnemonic of whitespace separated words of the BIP-39 English
+// wordlist, whose checksum is verified.
+func ParseMasterKey(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+	if len(strings.Fields(s)) > 1 {
+		if _, err := bip39.EntropyFromMnemonic(s); err != nil {
+			return nil, ErrInvalidMasterKey
+		}
+		return KeyFromMnemonic(s, ""), nil
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(key) != KeyLength {
+		return nil, ErrInvalidMasterKey
+	}
+	return key, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestDeriveKey validates that the path keys are deterministic,
+// different for different paths and different from the master key.
+func TestDeriveKey(t *testing.T) {
+	master := GenerateRandomKey(KeyLength)
+	key := DeriveKey(master, "index.html")
+	if len(key) != KeyLength {
+		t.Fatalf("got key length %v, want %v", len(key), KeyLength)
+	}
+	if !bytes.Equal(key, DeriveKey(master, "index.html")) {
+		t.Error("derived different keys for the same path")
+	}
+	if bytes.Equal(key, DeriveKey(master, "style.css")) {
+		t.Error("derived the same key for different paths")
+	}
+	if bytes.Equal(key, master) {
+		t.Error("derived the master key")
+	}
+
+	data := []byte("some data")
+	if !bytes.Equal(ChunkKey(key, data), ChunkKey(key, data)) {
+		t.Error("derived different keys for the same chunk")
+	}
+	if bytes.Equal(ChunkKey(key, data), ChunkKey(key, []byte("other data"))) {
+		t.Error("derived the same key for different chunks")
+	}
+}
+
+// TestParseMasterKey validates parsing of hex encoded master keys and mnemonics,
+// and that other input is refused.
+func TestParseMasterKey(t *testing.T) {
+	// BIP-39 test vector
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e5349553"
+	if got := hex.EncodeToString(KeyFromMnemonic(mnemonic, "TREZOR")); got != want {
+		t.Errorf("got mnemonic key %s, want %s", got, want)
+	}
+
+	key, err := ParseMasterKey(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, KeyFromMnemonic(mnemonic, "")) {
+		t.Error("mnemonic not parsed")
+	}
+	key, err = ParseMasterKey("0x" + want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(key) != want {
+		t.Errorf("got key %x, want %s", key, want)
+	}
+	for _, s := range []string{
+		"",
+		"0x1234",
+		"notakey",
+		"not a key",
+		// words not in the wordlist
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon swarm",
+		// invalid checksum
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+	} {
+		if _, err := ParseMasterKey(s); err != ErrInvalidMasterKey {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrInvalidMasterKey)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// BatchUpdate is the new content of one feed in a batch of updates
+type BatchUpdate struct {
+	Feed Feed   // feed to update, its user is always the signer of the batch
+	Data []byte // new content of the feed
+}
+
+// batchEntry keeps track of a signed update of the batch and of the content it replaces
+type batchEntry struct {
+	request  *Request
+	previous []byte // latest content of the feed before the batch, nil if the feed had no updates
+}
+
+// UpdateBatch signs and publishes updates to several feeds as a unit.
+// All updates are prepared and signed before any of them is published, so that an invalid
+// update or a signing failure leaves every feed untouched. If publishing one of the updates fails,
+// the feeds already updated are rolled back by publishing their previous content again.
+// The addresses of the published updates are returned in the order of the batch.
+func (h *Handler) UpdateBatch(ctx context.Context, signer Signer, updates []*BatchUpdate) ([]storage.Address, error) {
+	if len(updates) == 0 {
+		return nil, NewError(ErrInvalidValue, "batch has no updates")
+	}
+
+	entries := make([]*batchEntry, len(updates))
+	seen := make(map[uint64]bool)
+	for i, u := range updates {
+		fd := u.Feed
+		fd.User = signer.Address()
+		key := fd.mapKey()
+		if seen[key] {
+			return nil, NewErrorf(ErrInvalidValue, "feed %s appears more than once in the batch", fd.Hex())
+		}
+		seen[key] = true
+
+		request, err := h.NewRequest(ctx, &fd)
+		if err != nil {
+			return nil, err
+		}
+		request.SetData(u.Data)
+		if err := request.Sign(signer); err != nil {
+			return nil, err
+		}
+		if _, err := request.toChunk(); err != nil {
+			return nil, err
+		}
+		entry := &batchEntry{request: request}
+		if cached := h.get(&fd); cached != nil {
+			entry.previous = cached.data
+		}
+		entries[i] = entry
+	}
+
+	addrs := make([]storage.Address, len(entries))
+	for i, entry := range entries {
+		addr, err := h.Update(ctx, entry.request)
+		if err != nil {
+			return nil, h.rollbackBatch(ctx, signer, entries[:i], err)
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+// rollbackBatch restores the content the published entries had before the batch
+// and returns the error that caused the batch to fail, including any rollback failures
+func (h *Handler) rollbackBatch(ctx context.Context, signer Signer, published []*batchEntry, cause error) error {
+	var failed []string
+	for _, entry := range published {
+		fd := entry.request.Feed
+		request := NewFirstRequest(fd.Topic)
+		request.Epoch = lookup.GetNextEpoch(entry.request.Epoch, TimestampProvider.Now().Time)
+		request.SetData(entry.previous)
+		err := request.Sign(signer)
+		if err == nil {
+			_, err = h.Update(ctx, request)
+		}
+		if err != nil {
+			log.Error("feed batch rollback failed", "feed", fd.Hex(), "err", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", fd.Hex(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return NewErrorf(ErrIO, "batch update failed: %v, rollback failed for %s", cause, strings.Join(failed, ", "))
+	}
+	return NewErrorf(ErrIO, "batch update failed and was rolled back: %v", cause)
+}
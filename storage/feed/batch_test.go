@@ -0,0 +1,157 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+	"github.com/ethersphere/swarm/storage/localstore"
+)
+
+// failingStore fails the put with the given number, counting from one
+type failingStore struct {
+	chunk.Store
+	mu     sync.Mutex
+	puts   int
+	failAt int
+}
+
+func (s *failingStore) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) ([]bool, error) {
+	s.mu.Lock()
+	s.puts++
+	fail := s.puts == s.failAt
+	s.mu.Unlock()
+	if fail {
+		return nil, errors.New("put failed")
+	}
+	return s.Store.Put(ctx, mode, chs...)
+}
+
+// TestUpdateBatch tests that a batch of feed updates is published as a whole,
+// and that the feeds already updated are rolled back when a later update fails
+func TestUpdateBatch(t *testing.T) {
+	timeProvider := &fakeTimeProvider{
+		currentTime: startTime.Time,
+	}
+	TimestampProvider = timeProvider
+	signer := newAliceSigner()
+
+	datadir, err := ioutil.TempDir("", "feed-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, err := localstore.New(datadir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &failingStore{Store: db}
+	rh, err := NewTestHandlerWithStore(datadir, store, &HandlerParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rh.Close()
+
+	var feeds []Feed
+	for _, name := range []string{"root", "version", "changelog"} {
+		topic, _ := NewTopic(name, nil)
+		feeds = append(feeds, Feed{Topic: topic, User: signer.Address()})
+	}
+
+	latest := func(fd Feed) []byte {
+		t.Helper()
+		if _, err := rh.Lookup(context.Background(), NewQueryLatest(&fd, lookup.NoClue)); err != nil {
+			if err.(*Error).code == ErrNotFound {
+				return nil
+			}
+			t.Fatal(err)
+		}
+		_, data, err := rh.GetContent(&fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	if _, err := rh.UpdateBatch(context.Background(), signer, nil); err == nil {
+		t.Fatal("expected error for empty batch")
+	}
+	if _, err := rh.UpdateBatch(context.Background(), signer, []*BatchUpdate{
+		{Feed: feeds[0], Data: []byte("a")},
+		{Feed: feeds[0], Data: []byte("b")},
+	}); err == nil {
+		t.Fatal("expected error for duplicate feed")
+	}
+	if store.puts != 0 {
+		t.Fatalf("invalid batches published %d chunks", store.puts)
+	}
+
+	addrs, err := rh.UpdateBatch(context.Background(), signer, []*BatchUpdate{
+		{Feed: feeds[0], Data: []byte("root v1")},
+		{Feed: feeds[1], Data: []byte("version v1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("got %d addresses, want 2", len(addrs))
+	}
+
+	timeProvider.FastForward(Day)
+
+	// the third update of the batch fails, the first two must be rolled back
+	store.failAt = store.puts + 3
+	_, err = rh.UpdateBatch(context.Background(), signer, []*BatchUpdate{
+		{Feed: feeds[0], Data: []byte("root v2")},
+		{Feed: feeds[1], Data: []byte("version v2")},
+		{Feed: feeds[2], Data: []byte("changelog v2")},
+	})
+	if err == nil {
+		t.Fatal("expected batch to fail")
+	}
+
+	timeProvider.Tick()
+	for i, want := range [][]byte{[]byte("root v1"), []byte("version v1"), nil} {
+		if got := latest(feeds[i]); !bytes.Equal(got, want) {
+			t.Fatalf("feed %d: got %q, want %q", i, got, want)
+		}
+	}
+
+	timeProvider.Tick()
+	if _, err := rh.UpdateBatch(context.Background(), signer, []*BatchUpdate{
+		{Feed: feeds[0], Data: []byte("root v3")},
+		{Feed: feeds[1], Data: []byte("version v3")},
+		{Feed: feeds[2], Data: []byte("changelog v3")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	timeProvider.Tick()
+	for i, want := range []string{"root v3", "version v3", "changelog v3"} {
+		if got := latest(feeds[i]); string(got) != want {
+			t.Fatalf("feed %d: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -28,6 +28,12 @@ updatedata = Feed|Epoch|data
 The full update data that goes in the chunk payload is:
 updatedata|sign(updatedata)
 
+A multi-signer feed is owned by a set of n keys, and an update is valid only if it
+is signed by k of them. The user address of such a feed is derived from the
+signer set, and the signer set is stored with the first update of the feed and
+repeated in every following one. Its chunk payload is:
+updatedata|signers|signatures|k|n|number of signatures
+
 Structure Summary:
 
 Request: Feed Update with signature
@@ -25,8 +25,10 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
 )
@@ -36,11 +38,14 @@ type Handler struct {
 	HashSize   int
 	cache      map[uint64]*cacheEntry
 	cacheLock  sync.RWMutex
+
+	hints *hintCache // where the latest updates of feeds were last found and how often they are updated
 }
 
 // HandlerParams pass parameters to the Handler constructor NewHandler
 // Signer and TimestampProvider are mandatory parameters
 type HandlerParams struct {
+	HintStore state.Store // persists the lookup hints of feeds across restarts, hints are kept in memory if nil
 }
 
 // hashPool contains a pool of ready hashers
@@ -59,6 +64,7 @@ func init() {
 func NewHandler(params *HandlerParams) *Handler {
 	fh := &Handler{
 		cache: make(map[uint64]*cacheEntry),
+		hints: newHintCache(params.HintStore),
 	}
 
 	for i := 0; i < hasherCount; i++ {
@@ -123,20 +129,40 @@ func (h *Handler) GetContent(feed *Feed) (storage.Address, []byte, error) {
 // just add the desired data and sign it.
 // The resulting structure can then be signed and passed to Handler.Update to be verified and sent
 func (h *Handler) NewRequest(ctx context.Context, feed *Feed) (request *Request, err error) {
+	request, _, err = h.newRequest(ctx, feed, TimestampProvider.Now().Time)
+	return request, err
+}
+
+// NewRequestAt prepares a Request like NewRequest for an update at the given time, so that
+// an update for a future epoch can be signed in advance and scheduled for publishing.
+// The time cannot be earlier than the latest update of the feed.
+func (h *Handler) NewRequestAt(ctx context.Context, feed *Feed, at uint64) (*Request, error) {
+	request, latest, err := h.newRequest(ctx, feed, at)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && at < latest.Epoch.Time {
+		return nil, NewErrorf(ErrInvalidValue, "time %d is earlier than the latest update at %d", at, latest.Epoch.Time)
+	}
+	return request, nil
+}
+
+// newRequest prepares a Request for an update at the given time and returns it
+// together with the latest update of the feed, nil if the feed has no updates
+func (h *Handler) newRequest(ctx context.Context, feed *Feed, now uint64) (request *Request, feedUpdate *cacheEntry, err error) {
 	if feed == nil {
-		return nil, NewError(ErrInvalidValue, "feed cannot be nil")
+		return nil, nil, NewError(ErrInvalidValue, "feed cannot be nil")
 	}
 
-	now := TimestampProvider.Now().Time
 	request = new(Request)
 	request.Header.Version = ProtocolVersion
 
 	query := NewQueryLatest(feed, lookup.NoClue)
 
-	feedUpdate, err := h.Lookup(ctx, query)
+	feedUpdate, err = h.Lookup(ctx, query)
 	if err != nil {
 		if err.(*Error).code != ErrNotFound {
-			return nil, err
+			return nil, nil, err
 		}
 		// not finding updates means that there is a network error
 		// or that the feed really does not have updates
@@ -151,7 +177,7 @@ func (h *Handler) NewRequest(ctx context.Context, feed *Feed) (request *Request,
 		request.Epoch = lookup.GetFirstEpoch(now)
 	}
 
-	return request, nil
+	return request, feedUpdate, nil
 }
 
 // Lookup retrieves a specific or latest feed update
@@ -159,19 +185,19 @@ func (h *Handler) NewRequest(ctx context.Context, feed *Feed) (request *Request,
 // See the `query` documentation and helper functions:
 // `NewQueryLatest` and `NewQuery`
 func (h *Handler) Lookup(ctx context.Context, query *Query) (*cacheEntry, error) {
-
 	timeLimit := query.TimeLimit
 	if timeLimit == 0 { // if time limit is set to zero, the user wants to get the latest update
 		timeLimit = TimestampProvider.Now().Time
 	}
-
-	if query.Hint == lookup.NoClue { // try to use our cache
-		entry := h.get(&query.Feed)
-		if entry != nil && entry.Epoch.Time <= timeLimit { // avoid bad hints
-			query.Hint = entry.Epoch
-		}
+	request, err := h.lookup(ctx, &query.Feed, timeLimit, query.Hint)
+	if err != nil {
+		return nil, err
 	}
+	return h.updateCache(request)
+}
 
+// lookup finds the latest update of the feed before the time limit without caching it
+func (h *Handler) lookup(ctx context.Context, feed *Feed, timeLimit uint64, hint lookup.Epoch) (*Request, error) {
 	// we can't look for anything without a store
 	if h.chunkStore == nil {
 		return nil, NewError(ErrInit, "Call Handler.SetStore() before performing lookups")
@@ -179,12 +205,11 @@ func (h *Handler) Lookup(ctx context.Context, query *Query) (*cacheEntry, error)
 
 	var readCount int32
 
-	// Invoke the lookup engine.
 	// The callback will be called every time the lookup algorithm needs to guess
-	requestPtr, err := lookup.Lookup(ctx, timeLimit, query.Hint, func(ctx context.Context, epoch lookup.Epoch, now uint64) (interface{}, error) {
+	read := func(ctx context.Context, epoch lookup.Epoch, now uint64) (interface{}, error) {
 		atomic.AddInt32(&readCount, 1)
 		id := ID{
-			Feed:  query.Feed,
+			Feed:  *feed,
 			Epoch: epoch,
 		}
 		ctx, cancel := context.WithTimeout(ctx, defaultRetrieveTimeout)
@@ -203,11 +228,29 @@ func (h *Handler) Lookup(ctx context.Context, query *Query) (*cacheEntry, error)
 		if err := request.fromChunk(ch); err != nil {
 			return nil, nil
 		}
+		// updates of multi-signer feeds are only valid with the signatures of the threshold of their signers
+		if request.signers != nil {
+			if err := request.Verify(); err != nil {
+				log.Debug("Invalid multi-signer feed update", "addr", ch.Address(), "err", err)
+				return nil, nil
+			}
+		}
 		if request.Time <= timeLimit {
 			return &request, nil
 		}
 		return nil, nil
-	})
+	}
+
+	if hint == lookup.NoClue { // try to use our caches
+		var err error
+		hint, err = h.hint(ctx, feed, timeLimit, read)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Invoke the lookup engine.
+	requestPtr, err := lookup.Lookup(ctx, timeLimit, hint, read)
 	if err != nil {
 		return nil, err
 	}
@@ -218,8 +261,43 @@ func (h *Handler) Lookup(ctx context.Context, query *Query) (*cacheEntry, error)
 	if request == nil {
 		return nil, NewError(ErrNotFound, "no feed updates found")
 	}
-	return h.updateCache(request)
+	return request, nil
+}
 
+// hint returns the epoch the lookup of the latest update of the feed before the time limit
+// starts from. It is the epoch of the last known update, or the epoch where the latest update
+// is predicted from the observed frequency of updates if an update is found there.
+func (h *Handler) hint(ctx context.Context, feed *Feed, timeLimit uint64, read lookup.ReadFunc) (lookup.Epoch, error) {
+	hint := lookup.NoClue
+	known := h.hints.get(feed)
+	if known != nil && known.Epoch.Time <= timeLimit { // avoid bad hints
+		hint = known.Epoch
+	}
+	entry := h.get(feed)
+	if entry != nil && entry.Epoch.Time <= timeLimit && entry.Epoch.Time >= hint.Time {
+		hint = entry.Epoch
+	}
+	if hint == lookup.NoClue || known == nil {
+		return hint, nil
+	}
+
+	predicted := (&lookupHint{Epoch: hint, Interval: known.Interval}).predict(timeLimit)
+	if predicted.Equals(hint) {
+		return hint, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, hintProbeTimeout)
+	defer cancel()
+	value, err := read(ctx, predicted, timeLimit)
+	if err != nil && err != context.DeadlineExceeded {
+		return lookup.NoClue, err
+	}
+	// updates found in epochs of higher levels can be older than the last known update
+	if value == nil || value.(*Request).Epoch.Time <= hint.Time {
+		metrics.GetOrRegisterCounter("feed/lookup/hint/miss", nil).Inc(1)
+		return hint, nil
+	}
+	metrics.GetOrRegisterCounter("feed/lookup/hint/hit", nil).Inc(1)
+	return value.(*Request).Epoch, nil
 }
 
 // update feed updates cache with specified content
@@ -238,6 +316,7 @@ func (h *Handler) updateCache(request *Request) (*cacheEntry, error) {
 	entry.lastKey = updateAddr
 	entry.Update = request.Update
 	entry.Reader = bytes.NewReader(entry.data)
+	h.hints.observe(&request.Feed, request.Epoch)
 	return entry, nil
 }
 
@@ -270,6 +349,8 @@ func (h *Handler) Update(ctx context.Context, r *Request) (updateAddr storage.Ad
 		return nil, err
 	}
 
+	h.hints.observe(&r.Feed, r.Epoch)
+
 	// update our feed updates map cache entry if the new update is older than the one we have, if we have it.
 	if feedUpdate != nil && r.Epoch.After(feedUpdate.Epoch) {
 		feedUpdate.Epoch = r.Epoch
@@ -298,3 +379,14 @@ func (h *Handler) set(feed *Feed, feedUpdate *cacheEntry) {
 	defer h.cacheLock.Unlock()
 	h.cache[mapKey] = feedUpdate
 }
+
+// Latest returns the ids of the latest known updates of the feeds with cached updates
+func (h *Handler) Latest() []ID {
+	h.cacheLock.RLock()
+	defer h.cacheLock.RUnlock()
+	ids := make([]ID, 0, len(h.cache))
+	for _, entry := range h.cache {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
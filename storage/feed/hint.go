@@ -0,0 +1,136 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+const (
+	hintKeyPrefix         = "feedhint_" // prefix of the keys of the hints in the state store
+	maxPredictedUpdates   = 64          // max number of updates followed when predicting the epoch of the latest update
+	hintIntervalSmoothing = 4           // weight of the previous interval in the moving average of update intervals
+)
+
+// hintProbeTimeout is the time the read of the predicted epoch of the latest update
+// is given before the lookup falls back to the last known epoch
+var hintProbeTimeout = 250 * time.Millisecond
+
+// lookupHint is where the latest update of a feed was last found, together with the
+// observed frequency of the updates of the feed
+type lookupHint struct {
+	Epoch    lookup.Epoch `json:"epoch"`    // epoch of the latest update found
+	Interval uint64       `json:"interval"` // moving average of the seconds between updates, 0 if unknown
+}
+
+// predict returns the epoch where the latest update before the given time is expected,
+// assuming that the feed kept being updated at the observed interval since the update of the hint
+func (h *lookupHint) predict(now uint64) lookup.Epoch {
+	epoch := h.Epoch
+	if h.Interval == 0 || now <= epoch.Time {
+		return epoch
+	}
+	n := (now - epoch.Time) / h.Interval
+	if n > maxPredictedUpdates {
+		// too far from the last known update for the prediction to be reliable
+		return epoch
+	}
+	for i := uint64(1); i <= n; i++ {
+		epoch = lookup.GetNextEpoch(epoch, h.Epoch.Time+i*h.Interval)
+	}
+	return epoch
+}
+
+// hintCache keeps the lookup hints of feeds, persisting them in the state store if it is set
+type hintCache struct {
+	store state.Store
+	hints map[uint64]*lookupHint
+	mu    sync.Mutex
+}
+
+func newHintCache(store state.Store) *hintCache {
+	return &hintCache{
+		store: store,
+		hints: make(map[uint64]*lookupHint),
+	}
+}
+
+// get returns the lookup hint of the feed, nil if there is none
+func (c *hintCache) get(feed *Feed) *lookupHint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.load(feed)
+	if h == nil {
+		return nil
+	}
+	hint := *h
+	return &hint
+}
+
+// observe records the epoch of the latest update of the feed found by a lookup,
+// updating the observed interval between updates if the update is newer than the known one
+func (c *hintCache) observe(feed *Feed, epoch lookup.Epoch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.load(feed)
+	switch {
+	case h == nil:
+		h = &lookupHint{Epoch: epoch}
+		c.hints[feed.mapKey()] = h
+	case epoch.Time > h.Epoch.Time:
+		interval := epoch.Time - h.Epoch.Time
+		if h.Interval != 0 {
+			interval = ((hintIntervalSmoothing-1)*h.Interval + interval) / hintIntervalSmoothing
+		}
+		h.Epoch = epoch
+		h.Interval = interval
+	default:
+		return
+	}
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Put(hintKeyPrefix+feed.Hex(), h); err != nil {
+		log.Warn("Could not persist feed lookup hint", "feed", feed.Hex(), "err", err)
+	}
+}
+
+// load returns the hint of the feed from memory, or from the state store if it is
+// not loaded yet. It must be called with the lock held.
+func (c *hintCache) load(feed *Feed) *lookupHint {
+	key := feed.mapKey()
+	if h, ok := c.hints[key]; ok {
+		return h
+	}
+	if c.store == nil {
+		return nil
+	}
+	h := new(lookupHint)
+	if err := c.store.Get(hintKeyPrefix+feed.Hex(), h); err != nil {
+		if err != state.ErrNotFound {
+			log.Warn("Could not load feed lookup hint", "feed", feed.Hex(), "err", err)
+		}
+		return nil
+	}
+	c.hints[key] = h
+	return h
+}
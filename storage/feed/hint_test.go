@@ -0,0 +1,136 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// TestLookupHint tests that the lookup hints of feeds are persisted and that lookups
+// start from the epoch predicted from the observed frequency of updates
+func TestLookupHint(t *testing.T) {
+	timeProvider := &fakeTimeProvider{
+		currentTime: startTime.Time,
+	}
+	signer := newAliceSigner()
+
+	rh, datadir, teardownTest, err := setupTest(timeProvider, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownTest()
+	defer os.RemoveAll(datadir)
+
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	rh.hints = newHintCache(store)
+
+	topic, _ := NewTopic("Regular updates", nil)
+	fd := Feed{
+		Topic: topic,
+		User:  signer.Address(),
+	}
+
+	const interval = 60
+	var epochs []lookup.Epoch
+	var epoch lookup.Epoch
+	update := func(T uint64) {
+		request := NewFirstRequest(fd.Topic)
+		request.Epoch = lookup.GetNextEpoch(epoch, T)
+		request.data = generateData(T)
+		if err := request.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rh.Update(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+		epoch = request.Epoch
+		epochs = append(epochs, epoch)
+	}
+
+	for i := uint64(0); i < 5; i++ {
+		update(startTime.Time + i*interval)
+	}
+
+	// the hint of the publisher is persisted with the interval of the updates
+	hint := newHintCache(store).get(&fd)
+	if hint == nil {
+		t.Fatal("expected persisted hint")
+	}
+	if !hint.Epoch.Equals(epochs[4]) || hint.Interval != interval {
+		t.Fatalf("expected hint at %s with interval %d, got %s with interval %d", epochs[4].String(), interval, hint.Epoch.String(), hint.Interval)
+	}
+
+	// a reader knows the hint of the fifth update, while the feed is updated further
+	reader := NewHandler(&HandlerParams{HintStore: store})
+	reader.SetStore(rh.chunkStore)
+	reader.hints.get(&fd)
+	for i := uint64(5); i < 10; i++ {
+		update(startTime.Time + i*interval)
+	}
+	now := startTime.Time + 9*interval + interval/2
+
+	if predicted := hint.predict(now); !predicted.Equals(epochs[9]) {
+		t.Fatalf("expected predicted epoch %s, got %s", epochs[9].String(), predicted.String())
+	}
+
+	// count the reads of the lookup algorithm
+	var reads int32
+	defer func(l lookup.Algorithm) { lookup.Lookup = l }(lookup.Lookup)
+	algorithm := lookup.Lookup
+	lookup.Lookup = func(ctx context.Context, now uint64, hint lookup.Epoch, read lookup.ReadFunc) (interface{}, error) {
+		return algorithm(ctx, now, hint, func(ctx context.Context, epoch lookup.Epoch, now uint64) (interface{}, error) {
+			atomic.AddInt32(&reads, 1)
+			return read(ctx, epoch, now)
+		})
+	}
+
+	lookupLatest := func(h *Handler) int32 {
+		atomic.StoreInt32(&reads, 0)
+		if _, err := h.Lookup(context.Background(), NewQuery(&fd, now, lookup.NoClue)); err != nil {
+			t.Fatal(err)
+		}
+		_, content, err := h.GetContent(&fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, generateData(startTime.Time+9*interval)) {
+			t.Fatalf("expected content of the latest update, got %q", content)
+		}
+		return atomic.LoadInt32(&reads)
+	}
+
+	hinted := lookupLatest(reader)
+	fresh := NewHandler(&HandlerParams{})
+	fresh.SetStore(rh.chunkStore)
+	unhinted := lookupLatest(fresh)
+	// the hinted lookup does an additional read of the predicted epoch
+	if hinted+1 >= unhinted {
+		t.Fatalf("expected fewer reads with the hint, got %d reads with and %d without the hint", hinted+1, unhinted)
+	}
+
+	if hint := reader.hints.get(&fd); !hint.Epoch.Equals(epochs[9]) {
+		t.Fatalf("expected hint updated to %s, got %s", epochs[9].String(), hint.Epoch.String())
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+const (
+	// APIVersion is the version of the RPC API of feeds
+	APIVersion = "1.0"
+
+	// DefaultHistoryLimit is the number of updates returned by a history query without a limit
+	DefaultHistoryLimit = 100
+)
+
+// HistoryEntry is a past update of a feed
+type HistoryEntry struct {
+	Time        uint64          `json:"time"`        // timestamp of the update
+	Epoch       lookup.Epoch    `json:"epoch"`       // epoch the update is placed at
+	Address     storage.Address `json:"address"`     // address of the update chunk
+	PayloadHash common.Hash     `json:"payloadHash"` // keccak256 hash of the update data
+}
+
+// History calls fn with the updates of the feed with timestamps between from and to inclusive,
+// starting with the latest one. The epoch grid is walked backwards by looking up the latest
+// update before the previous one found, until fn was called limit times or there are no earlier
+// updates in the range. If to is 0, the history starts from the latest update. If limit is not
+// positive, DefaultHistoryLimit updates are returned at most.
+func (h *Handler) History(ctx context.Context, feed *Feed, from, to uint64, limit int, fn func(*HistoryEntry) error) error {
+	if to == 0 {
+		to = TimestampProvider.Now().Time
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	for n := 0; n < limit && to >= from; n++ {
+		request, err := h.lookup(ctx, feed, to, lookup.NoClue)
+		if err != nil {
+			if e, ok := err.(*Error); ok && e.Code() == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		if request.Time < from {
+			return nil
+		}
+		err = fn(&HistoryEntry{
+			Time:        request.Time,
+			Epoch:       request.Epoch,
+			Address:     request.Addr(),
+			PayloadHash: crypto.Keccak256Hash(request.data),
+		})
+		if err != nil {
+			return err
+		}
+		if request.Time == 0 {
+			return nil
+		}
+		to = request.Time - 1
+	}
+	return nil
+}
+
+// API is the RPC API of feeds
+type API struct {
+	h *Handler
+	s *Scheduler
+}
+
+// NewAPI creates the RPC API of feeds, updates cannot be scheduled if the scheduler is nil
+func NewAPI(h *Handler, s *Scheduler) *API {
+	return &API{h: h, s: s}
+}
+
+// History returns the updates of the feed of the user on the topic with timestamps between
+// fromTime and toTime inclusive, latest first. If toTime is 0, the history starts from the latest
+// update. If limit is not positive, DefaultHistoryLimit updates are returned at most.
+func (a *API) History(ctx context.Context, topic Topic, user common.Address, fromTime, toTime uint64, limit int) ([]*HistoryEntry, error) {
+	fd := &Feed{
+		Topic: topic,
+		User:  user,
+	}
+	entries := make([]*HistoryEntry, 0)
+	err := a.h.History(ctx, fd, fromTime, toTime, limit, func(entry *HistoryEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
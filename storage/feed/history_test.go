@@ -0,0 +1,143 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// TestHistory tests that the past updates of a feed in a time range are returned latest first
+func TestHistory(t *testing.T) {
+	timeProvider := &fakeTimeProvider{
+		currentTime: startTime.Time,
+	}
+	signer := newAliceSigner()
+
+	rh, datadir, teardownTest, err := setupTest(timeProvider, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownTest()
+	defer os.RemoveAll(datadir)
+
+	topic, _ := NewTopic("History", nil)
+	fd := Feed{
+		Topic: topic,
+		User:  signer.Address(),
+	}
+
+	// publish one update every year since Unix 0, irregularly in the last months
+	var times []uint64
+	for T := uint64(0); T < 10*Year; T += Year {
+		times = append(times, T)
+	}
+	times = append(times, 10*Year+Day, 10*Year+Day+1, 10*Year+Month)
+	var epoch lookup.Epoch
+	for _, T := range times {
+		request := NewFirstRequest(fd.Topic)
+		request.Epoch = lookup.GetNextEpoch(epoch, T)
+		request.data = generateData(T)
+		if err := request.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rh.Update(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+		epoch = request.Epoch
+	}
+	timeProvider.Set(11 * Year)
+
+	for _, tc := range []struct {
+		name     string
+		from, to uint64
+		limit    int
+		want     []uint64
+	}{
+		{
+			name: "all",
+			want: reverse(times),
+		},
+		{
+			name: "range",
+			from: 2 * Year,
+			to:   5*Year + Day,
+			want: []uint64{5 * Year, 4 * Year, 3 * Year, 2 * Year},
+		},
+		{
+			name:  "limit",
+			limit: 3,
+			want:  []uint64{10*Year + Month, 10*Year + Day + 1, 10*Year + Day},
+		},
+		{
+			name: "first",
+			to:   Year - 1,
+			want: []uint64{0},
+		},
+		{
+			name: "empty",
+			from: 10*Year + Month + 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := NewAPI(rh.Handler, nil).History(context.Background(), fd.Topic, fd.User, tc.from, tc.to, tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tc.want) {
+				t.Fatalf("got %d updates, want %d", len(entries), len(tc.want))
+			}
+			for i, entry := range entries {
+				if entry.Time != tc.want[i] {
+					t.Fatalf("update %d: got time %d, want %d", i, entry.Time, tc.want[i])
+				}
+				if entry.PayloadHash != crypto.Keccak256Hash(generateData(tc.want[i])) {
+					t.Fatalf("update %d: payload hash mismatch", i)
+				}
+				id := ID{Feed: fd, Epoch: entry.Epoch}
+				if !bytes.Equal(entry.Address, id.Addr()) {
+					t.Fatalf("update %d: got address %s, want %s", i, entry.Address, id.Addr())
+				}
+			}
+		})
+	}
+
+	// the history does not change the latest update of the feed
+	if _, err := rh.Lookup(context.Background(), NewQueryLatest(&fd, lookup.NoClue)); err != nil {
+		t.Fatal(err)
+	}
+	_, content, err := rh.GetContent(&fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, generateData(times[len(times)-1])) {
+		t.Fatalf("expected content of the latest update, got %q", content)
+	}
+}
+
+func reverse(times []uint64) []uint64 {
+	r := make([]uint64, len(times))
+	for i, t := range times {
+		r[len(times)-1-i] = t
+	}
+	return r
+}
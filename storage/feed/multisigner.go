@@ -0,0 +1,324 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// MaxSigners is the maximum number of keys of a multi-signer feed
+const MaxSigners = 32
+
+// multiSignerFlag is set in the first padding byte of the header of multi-signer feed updates
+const multiSignerFlag uint8 = 1
+
+// Multi-signer section layout, appended to the update instead of the signature:
+// signers n * common.AddressLength bytes
+// signatures k * signatureLength bytes
+// threshold 1 byte
+// n 1 byte
+// k 1 byte
+const multiSignerTrailerLength = 3
+
+// SignerSet is the set of keys that jointly own a multi-signer feed. An update of
+// the feed is valid only if it is signed by at least Threshold of the Signers.
+// The user address of a multi-signer feed is derived from its signer set, so the set
+// is stored with the first update of the feed and repeated in every following update,
+// which makes each update chunk verifiable on its own.
+type SignerSet struct {
+	Threshold uint8            `json:"threshold"`
+	Signers   []common.Address `json:"signers"`
+}
+
+// NewSignerSet returns the set of the given signers with a threshold of k signatures
+func NewSignerSet(k int, signers ...common.Address) (*SignerSet, error) {
+	sorted := make([]common.Address, len(signers))
+	copy(sorted, signers)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+	s := &SignerSet{
+		Threshold: uint8(k),
+		Signers:   sorted,
+	}
+	if k < 1 || k > len(signers) {
+		return nil, NewErrorf(ErrInvalidValue, "invalid threshold %d of %d signers", k, len(signers))
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// validate checks that the signers are sorted and unique and that the threshold can be met
+func (s *SignerSet) validate() error {
+	if len(s.Signers) == 0 || len(s.Signers) > MaxSigners {
+		return NewErrorf(ErrInvalidValue, "number of signers must be between 1 and %d", MaxSigners)
+	}
+	if s.Threshold < 1 || int(s.Threshold) > len(s.Signers) {
+		return NewErrorf(ErrInvalidValue, "invalid threshold %d of %d signers", s.Threshold, len(s.Signers))
+	}
+	for i := 1; i < len(s.Signers); i++ {
+		if bytes.Compare(s.Signers[i-1][:], s.Signers[i][:]) >= 0 {
+			return NewError(ErrInvalidValue, "signers must be sorted and unique")
+		}
+	}
+	return nil
+}
+
+// Address returns the user address of the feeds owned by the signer set
+func (s *SignerSet) Address() (addr common.Address) {
+	hasher := hashPool.Get().(hash.Hash)
+	defer hashPool.Put(hasher)
+	hasher.Reset()
+	hasher.Write([]byte{s.Threshold})
+	for _, signer := range s.Signers {
+		hasher.Write(signer[:])
+	}
+	copy(addr[:], hasher.Sum(nil)[12:])
+	return addr
+}
+
+// Contains returns true if the address is one of the signers
+func (s *SignerSet) Contains(addr common.Address) bool {
+	i := sort.Search(len(s.Signers), func(i int) bool {
+		return bytes.Compare(s.Signers[i][:], addr[:]) >= 0
+	})
+	return i < len(s.Signers) && s.Signers[i] == addr
+}
+
+// SetSigners makes the request an update of the multi-signer feed owned by the signer set
+func (r *Request) SetSigners(signers *SignerSet) {
+	r.signers = signers
+	r.signatures = nil
+	r.Signature = nil
+	r.binaryData = nil
+	r.Feed.User = signers.Address()
+	r.Header.Padding[0] |= multiSignerFlag
+	r.idAddr = r.Addr()
+}
+
+// Signers returns the signer set of a multi-signer feed update, or nil if the
+// feed has a single owner
+func (r *Request) Signers() *SignerSet {
+	return r.signers
+}
+
+// Signatures returns the signatures collected for a multi-signer feed update
+func (r *Request) Signatures() []Signature {
+	return r.signatures
+}
+
+// Cosign adds the signature of one of the signers of a multi-signer feed update
+func (r *Request) Cosign(signer Signer) error {
+	if r.signers == nil {
+		return NewError(ErrInvalidValue, "Cosign called on a single owner feed update. Call .SetSigners() first.")
+	}
+	digest, err := r.GetDigest()
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return err
+	}
+	return r.AddSignature(signature)
+}
+
+// AddSignature adds a signature of the update digest created by one of the signers
+// of a multi-signer feed update, so that the signers do not need to share their keys
+func (r *Request) AddSignature(signature Signature) error {
+	if r.signers == nil {
+		return NewError(ErrInvalidValue, "AddSignature called on a single owner feed update. Call .SetSigners() first.")
+	}
+	digest, err := r.GetDigest()
+	if err != nil {
+		return err
+	}
+	signer, err := getUserAddr(digest, signature)
+	if err != nil {
+		return NewError(ErrInvalidSignature, "Error verifying signature")
+	}
+	if !r.signers.Contains(signer) {
+		return NewErrorf(ErrUnauthorized, "%s is not a signer of the feed", signer.Hex())
+	}
+	for _, s := range r.signatures {
+		if addr, _ := getUserAddr(digest, s); addr == signer {
+			return NewErrorf(ErrInvalidValue, "%s already signed the update", signer.Hex())
+		}
+	}
+	r.signatures = append(r.signatures, signature)
+	return nil
+}
+
+// verifySigners checks that the update is signed by enough distinct signers of
+// the signer set the feed user address is derived from
+func (r *Request) verifySigners(digest common.Hash) error {
+	if err := r.signers.validate(); err != nil {
+		return err
+	}
+	if r.signers.Address() != r.Feed.User {
+		return NewError(ErrInvalidSignature, "Signer set does not match update user address")
+	}
+	if len(r.signatures) < int(r.signers.Threshold) {
+		return NewErrorf(ErrInvalidSignature, "Update has %d signatures, %d required", len(r.signatures), r.signers.Threshold)
+	}
+	signed := make(map[common.Address]bool)
+	for _, signature := range r.signatures {
+		signer, err := getUserAddr(digest, signature)
+		if err != nil {
+			return err
+		}
+		if !r.signers.Contains(signer) || signed[signer] {
+			return NewError(ErrInvalidSignature, "Update signed by an invalid or duplicate signer")
+		}
+		signed[signer] = true
+	}
+	return nil
+}
+
+// multiSignerLength returns the length of the multi-signer section of the update
+func (r *Request) multiSignerLength() int {
+	return len(r.signers.Signers)*common.AddressLength + len(r.signatures)*signatureLength + multiSignerTrailerLength
+}
+
+// multiSignerPut serializes the signer set and the signatures into the given slice
+func (r *Request) multiSignerPut(serializedData []byte) {
+	var cursor int
+	for _, signer := range r.signers.Signers {
+		copy(serializedData[cursor:], signer[:])
+		cursor += common.AddressLength
+	}
+	for _, signature := range r.signatures {
+		copy(serializedData[cursor:], signature[:])
+		cursor += signatureLength
+	}
+	serializedData[cursor] = r.signers.Threshold
+	serializedData[cursor+1] = uint8(len(r.signers.Signers))
+	serializedData[cursor+2] = uint8(len(r.signatures))
+}
+
+// multiSignerGet reads the signer set and the signatures from the end of the chunk
+// data and returns the length of the multi-signer section
+func (r *Request) multiSignerGet(chunkdata []byte) (int, error) {
+	if len(chunkdata) < minimumUpdateDataLength+multiSignerTrailerLength {
+		return 0, NewError(ErrNothingToReturn, "chunk too short to be a multi-signer feed update chunk")
+	}
+	trailer := chunkdata[len(chunkdata)-multiSignerTrailerLength:]
+	n, k := int(trailer[1]), int(trailer[2])
+	length := n*common.AddressLength + k*signatureLength + multiSignerTrailerLength
+	if len(chunkdata)-length < minimumUpdateDataLength {
+		return 0, NewError(ErrCorruptData, "invalid multi-signer section length")
+	}
+
+	cursor := len(chunkdata) - length
+	signers := &SignerSet{
+		Threshold: trailer[0],
+		Signers:   make([]common.Address, n),
+	}
+	for i := range signers.Signers {
+		copy(signers.Signers[i][:], chunkdata[cursor:])
+		cursor += common.AddressLength
+	}
+	signatures := make([]Signature, k)
+	for i := range signatures {
+		copy(signatures[i][:], chunkdata[cursor:])
+		cursor += signatureLength
+	}
+	r.signers = signers
+	r.signatures = signatures
+	return length, nil
+}
+
+// isMultiSigner returns true if the header marks a multi-signer feed update
+func (h *Header) isMultiSigner() bool {
+	return h.Padding[0]&multiSignerFlag != 0
+}
+
+// setSigners makes the request a multi-signer feed update with the given
+// signer set and hex encoded signatures
+func (r *Request) setSigners(signers *SignerSet, signatures []string) error {
+	if err := signers.validate(); err != nil {
+		return err
+	}
+	r.signers = signers
+	r.signatures = nil
+	r.Feed.User = signers.Address()
+	r.Header.Padding[0] |= multiSignerFlag
+	for _, s := range signatures {
+		sigBytes, err := hexutil.Decode(s)
+		if err != nil || len(sigBytes) != signatureLength {
+			return NewError(ErrInvalidSignature, "Cannot decode signature")
+		}
+		var signature Signature
+		copy(signature[:], sigBytes)
+		r.signatures = append(r.signatures, signature)
+	}
+	r.idAddr = r.Addr()
+	return nil
+}
+
+// signersFromValues reads the signer set and the signatures of a multi-signer
+// feed update from a string key-value store, if they are set
+func (r *Request) signersFromValues(values Values) error {
+	if values.Get("signers") == "" {
+		return nil
+	}
+	threshold, err := strconv.ParseUint(values.Get("threshold"), 10, 8)
+	if err != nil {
+		return NewError(ErrInvalidValue, "Invalid signer threshold")
+	}
+	signers := &SignerSet{
+		Threshold: uint8(threshold),
+	}
+	for _, s := range strings.Split(values.Get("signers"), ",") {
+		if !common.IsHexAddress(s) {
+			return NewErrorf(ErrInvalidValue, "Invalid signer address %q", s)
+		}
+		signers.Signers = append(signers.Signers, common.HexToAddress(s))
+	}
+	var signatures []string
+	if s := values.Get("signatures"); s != "" {
+		signatures = strings.Split(s, ",")
+	}
+	return r.setSigners(signers, signatures)
+}
+
+// appendSignersValues serializes the signer set and the signatures of a multi-signer
+// feed update into the provided string key-value store
+func (r *Request) appendSignersValues(values Values) {
+	signers := make([]string, len(r.signers.Signers))
+	for i, signer := range r.signers.Signers {
+		signers[i] = signer.Hex()
+	}
+	values.Set("signers", strings.Join(signers, ","))
+	values.Set("threshold", strconv.Itoa(int(r.signers.Threshold)))
+	if len(r.signatures) > 0 {
+		signatures := make([]string, len(r.signatures))
+		for i, signature := range r.signatures {
+			signatures[i] = hexutil.Encode(signature[:])
+		}
+		values.Set("signatures", strings.Join(signatures, ","))
+	}
+}
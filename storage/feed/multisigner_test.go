@@ -0,0 +1,159 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// TestMultiSignerFeed tests that updates of a multi-signer feed are only valid
+// with the signatures of the threshold of its signers and that they can be looked up
+func TestMultiSignerFeed(t *testing.T) {
+	timeProvider := &fakeTimeProvider{
+		currentTime: startTime.Time,
+	}
+	alice, bob, charlie := newAliceSigner(), newBobSigner(), newCharlieSigner()
+
+	rh, _, teardownTest, err := setupTest(timeProvider, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownTest()
+
+	signers, err := NewSignerSet(2, charlie.Address(), alice.Address(), bob.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignerSet(4, charlie.Address(), alice.Address(), bob.Address()); err == nil {
+		t.Fatal("expected error for threshold higher than the number of signers")
+	}
+	if _, err := NewSignerSet(1, alice.Address(), alice.Address()); err == nil {
+		t.Fatal("expected error for duplicate signers")
+	}
+
+	topic, _ := NewTopic(subtopicName, nil)
+	request := NewFirstRequest(topic)
+	request.SetSigners(signers)
+	request.SetData([]byte("multi"))
+	if request.Feed.User != signers.Address() {
+		t.Fatalf("expected feed user %x, got %x", signers.Address(), request.Feed.User)
+	}
+	if err := request.Sign(alice); err == nil {
+		t.Fatal("expected error signing a multi-signer feed update with a single signer")
+	}
+
+	if err := request.Cosign(alice); err != nil {
+		t.Fatal(err)
+	}
+	if request.IsUpdate() {
+		t.Fatal("expected update not to be signed below the threshold")
+	}
+	if _, err := request.toChunk(); err == nil {
+		t.Fatal("expected error creating a chunk below the threshold")
+	}
+	if err := request.Cosign(alice); err == nil {
+		t.Fatal("expected error for a duplicate signature")
+	}
+	outsider, _ := crypto.GenerateKey()
+	if err := request.Cosign(NewGenericSigner(outsider)); err == nil {
+		t.Fatal("expected error for a signature of a key that is not a signer")
+	}
+	if err := request.Cosign(bob); err != nil {
+		t.Fatal(err)
+	}
+	if !request.IsUpdate() {
+		t.Fatal("expected update to be signed at the threshold")
+	}
+
+	ch, err := request.toChunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rh.Validate(ch) {
+		t.Fatal("expected valid multi-signer feed update chunk")
+	}
+
+	// an update that lowers the threshold of the signer set is not valid
+	forged := *request
+	forged.signatures = request.signatures[:1]
+	forged.binaryData = nil
+	if _, err := forged.GetDigest(); err != nil {
+		t.Fatal(err)
+	}
+	forged.signers = &SignerSet{Threshold: 1, Signers: signers.Signers}
+	forgedChunk, err := forged.toChunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rh.Validate(forgedChunk) {
+		t.Fatal("expected invalid chunk with a changed threshold")
+	}
+
+	// the update can be looked up with the user address of the signer set
+	ctx := context.Background()
+	if _, err := rh.Update(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	fd := Feed{
+		Topic: topic,
+		User:  signers.Address(),
+	}
+	entry, err := rh.Lookup(ctx, NewQueryLatest(&fd, lookup.NoClue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entry.data, []byte("multi")) {
+		t.Fatalf("expected data %q, got %q", "multi", entry.data)
+	}
+
+	// the signer set and the signatures survive serialization
+	j, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Request
+	if err := json.Unmarshal(j, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	values := make(KV)
+	data := request.AppendValues(values)
+	var fromValues Request
+	if err := fromValues.FromValues(values, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fromValues.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	var fromChunk Request
+	if err := fromChunk.fromChunk(storage.NewChunk(ch.Address(), ch.Data())); err != nil {
+		t.Fatal(err)
+	}
+	if fromChunk.Signers().Address() != signers.Address() || len(fromChunk.Signatures()) != 2 {
+		t.Fatal("expected signer set and signatures to be read from the chunk")
+	}
+}
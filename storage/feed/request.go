@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
 )
@@ -33,6 +34,9 @@ type Request struct {
 	Signature  *Signature
 	idAddr     storage.Address // cached chunk address for the update (not serialized, for internal use)
 	binaryData []byte          // cached serialized data (does not get serialized again!, for efficiency/internal use)
+
+	signers    *SignerSet  // signer set of a multi-signer feed update, nil for single owner feeds
+	signatures []Signature // signatures of a multi-signer feed update
 }
 
 // updateRequestJSON represents a JSON-serialized UpdateRequest
@@ -41,6 +45,9 @@ type updateRequestJSON struct {
 	ProtocolVersion uint8  `json:"protocolVersion"`
 	Data            string `json:"data,omitempty"`
 	Signature       string `json:"signature,omitempty"`
+
+	Signers    *SignerSet `json:"signers,omitempty"`
+	Signatures []string   `json:"signatures,omitempty"`
 }
 
 // Request layout
@@ -66,10 +73,16 @@ func NewFirstRequest(topic Topic) *Request {
 func (r *Request) SetData(data []byte) {
 	r.data = data
 	r.Signature = nil
+	r.signatures = nil
+	r.binaryData = nil
 }
 
 // IsUpdate returns true if this request models a signed update or otherwise it is a signature request
+// A multi-signer feed update is signed once it has the signatures of the threshold of its signers
 func (r *Request) IsUpdate() bool {
+	if r.signers != nil {
+		return len(r.signatures) >= int(r.signers.Threshold)
+	}
 	return r.Signature != nil
 }
 
@@ -78,7 +91,7 @@ func (r *Request) Verify() (err error) {
 	if len(r.data) == 0 {
 		return NewError(ErrInvalidValue, "Update does not contain data")
 	}
-	if r.Signature == nil {
+	if r.Signature == nil && r.signers == nil {
 		return NewError(ErrInvalidSignature, "Missing signature field")
 	}
 
@@ -87,10 +100,17 @@ func (r *Request) Verify() (err error) {
 		return err
 	}
 
-	// get the address of the signer (which also checks that it's a valid signature)
-	r.Feed.User, err = getUserAddr(digest, *r.Signature)
-	if err != nil {
-		return err
+	if r.signers != nil {
+		// the user address of a multi-signer feed is derived from its signer set
+		if err := r.verifySigners(digest); err != nil {
+			return err
+		}
+	} else {
+		// get the address of the signer (which also checks that it's a valid signature)
+		r.Feed.User, err = getUserAddr(digest, *r.Signature)
+		if err != nil {
+			return err
+		}
 	}
 
 	// check that the lookup information contained in the chunk matches the updateAddr (chunk search key)
@@ -105,6 +125,9 @@ func (r *Request) Verify() (err error) {
 
 // Sign executes the signature to validate the update message
 func (r *Request) Sign(signer Signer) error {
+	if r.signers != nil {
+		return NewError(ErrInvalidValue, "Sign called on a multi-signer feed update. Call .Cosign() instead.")
+	}
 	r.Feed.User = signer.Address()
 	r.binaryData = nil           //invalidate serialized data
 	digest, err := r.GetDigest() // computes digest and serializes into .binaryData
@@ -157,12 +180,24 @@ func (r *Request) toChunk() (storage.Chunk, error) {
 	// Check that the update is signed and serialized
 	// For efficiency, data is serialized during signature and cached in
 	// the binaryData field when computing the signature digest in .getDigest()
-	if r.Signature == nil || r.binaryData == nil {
+	if !r.IsUpdate() || r.binaryData == nil {
 		return nil, NewError(ErrInvalidSignature, "toChunk called without a valid signature or payload data. Call .Sign() first.")
 	}
 
 	updateLength := r.Update.binaryLength()
 
+	// the signer set and the signatures are the last items in the chunk data of multi-signer feed updates
+	if r.signers != nil {
+		length := updateLength + r.multiSignerLength()
+		if length > chunk.DefaultSize {
+			return nil, NewErrorf(ErrInvalidValue, "multi-signer feed update is too big (length=%d). Max length=%d", length, chunk.DefaultSize)
+		}
+		data := make([]byte, length)
+		copy(data, r.binaryData[:updateLength])
+		r.multiSignerPut(data[updateLength:])
+		return storage.NewChunk(r.idAddr, data), nil
+	}
+
 	// signature is the last item in the chunk data
 	copy(r.binaryData[updateLength:], r.Signature[:])
 
@@ -176,6 +211,25 @@ func (r *Request) fromChunk(chunk storage.Chunk) error {
 
 	chunkdata := chunk.Data()
 
+	// multi-signer feed updates are marked in the header and end with the multi-signer section
+	if len(chunkdata) > headerLength && chunkdata[1]&multiSignerFlag != 0 {
+		length, err := r.multiSignerGet(chunkdata)
+		if err != nil {
+			return err
+		}
+		if err := r.Update.binaryGet(chunkdata[:len(chunkdata)-length]); err != nil {
+			return err
+		}
+		r.Signature = nil
+		r.idAddr = chunk.Address()
+		r.binaryData = chunkdata
+		return nil
+	}
+
+	if len(chunkdata) < signatureLength {
+		return NewErrorf(ErrNothingToReturn, "chunk less than %d bytes cannot be a feed update chunk", minimumSignedUpdateLength)
+	}
+
 	//deserialize the feed update portion
 	if err := r.Update.binaryGet(chunkdata[:len(chunkdata)-signatureLength]); err != nil {
 		return err
@@ -191,6 +245,8 @@ func (r *Request) fromChunk(chunk storage.Chunk) error {
 	}
 
 	r.Signature = signature
+	r.signers = nil
+	r.signatures = nil
 	r.idAddr = chunk.Address()
 	r.binaryData = chunkdata
 
@@ -215,6 +271,9 @@ func (r *Request) FromValues(values Values, data []byte) error {
 	if err != nil {
 		return err
 	}
+	if err := r.signersFromValues(values); err != nil {
+		return err
+	}
 	r.idAddr = r.Addr()
 	return err
 }
@@ -225,7 +284,11 @@ func (r *Request) AppendValues(values Values) []byte {
 	if r.Signature != nil {
 		values.Set("signature", hexutil.Encode(r.Signature[:]))
 	}
-	return r.Update.AppendValues(values)
+	data := r.Update.AppendValues(values)
+	if r.signers != nil {
+		r.appendSignersValues(values)
+	}
+	return data
 }
 
 // fromJSON takes an update request JSON and populates an UpdateRequest
@@ -251,6 +314,12 @@ func (r *Request) fromJSON(j *updateRequestJSON) error {
 		r.idAddr = r.Addr()
 		copy(r.Signature[:], sigBytes)
 	}
+
+	if j.Signers != nil {
+		if err := r.setSigners(j.Signers, j.Signatures); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -280,6 +349,10 @@ func (r *Request) MarshalJSON() (rawData []byte, err error) {
 		ProtocolVersion: r.Header.Version,
 		Data:            dataString,
 		Signature:       signatureString,
+		Signers:         r.signers,
+	}
+	for _, signature := range r.signatures {
+		requestJSON.Signatures = append(requestJSON.Signatures, hexutil.Encode(signature[:]))
 	}
 
 	return json.Marshal(requestJSON)
@@ -0,0 +1,230 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+)
+
+const scheduleKeyPrefix = "feedschedule_" // prefix of the keys of the scheduled updates in the state store
+
+// scheduleInterval is how often the scheduler checks for updates that are due
+var scheduleInterval = time.Second
+
+// ScheduledUpdate is a signed feed update waiting to be published
+type ScheduledUpdate struct {
+	Address storage.Address `json:"address"` // address of the update chunk
+	Feed    Feed            `json:"feed"`    // feed the update belongs to
+	Time    uint64          `json:"time"`    // timestamp at which the update is published
+}
+
+// scheduledRequest is the record of a scheduled update in the state store, the request is
+// wrapped as it would otherwise be stored with the binary marshaler of its epoch
+type scheduledRequest struct {
+	Request *Request `json:"request"`
+}
+
+// Scheduler keeps feed updates signed for a future epoch and publishes them when
+// the time of their epoch has come, so that the signing key does not need to be
+// online at release time. Scheduled updates are persisted in the state store if it is set.
+type Scheduler struct {
+	h       *Handler
+	store   state.Store
+	updates map[string]*Request // scheduled updates by the hex of their address
+	mu      sync.Mutex
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler publishing updates with the handler,
+// loading the updates scheduled before a restart from the store
+func NewScheduler(h *Handler, store state.Store) (*Scheduler, error) {
+	s := &Scheduler{
+		h:       h,
+		store:   store,
+		updates: make(map[string]*Request),
+		quit:    make(chan struct{}),
+	}
+	if store == nil {
+		return s, nil
+	}
+	err := store.Iterate(scheduleKeyPrefix, func(key, value []byte) (bool, error) {
+		var record scheduledRequest
+		if err := json.Unmarshal(value, &record); err != nil {
+			return true, err
+		}
+		// verifying the restored update also serializes it for publishing
+		if err := record.Request.Verify(); err != nil {
+			log.Warn("ignoring invalid scheduled feed update", "key", string(key), "err", err)
+			return false, nil
+		}
+		s.updates[strings.TrimPrefix(string(key), scheduleKeyPrefix)] = record.Request
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start starts publishing the scheduled updates
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop stops publishing the scheduled updates, which are kept until the next start
+func (s *Scheduler) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.publishDue(TimestampProvider.Now().Time)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Schedule verifies the signed update and keeps it until the time of its epoch,
+// when it is published. Updates of epochs that have already started are published
+// on the next check.
+func (s *Scheduler) Schedule(r *Request) (storage.Address, error) {
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	addr := r.Addr()
+	key := addr.Hex()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.updates[key]; ok {
+		return nil, NewError(ErrInvalidValue, "update is already scheduled")
+	}
+	if s.store != nil {
+		if err := s.store.Put(scheduleKeyPrefix+key, &scheduledRequest{Request: r}); err != nil {
+			return nil, err
+		}
+	}
+	s.updates[key] = r
+	log.Debug("feed update scheduled", "addr", addr, "time", r.Epoch.Time)
+	return addr, nil
+}
+
+// Cancel removes the scheduled update with the given address
+func (s *Scheduler) Cancel(addr storage.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(addr.Hex())
+}
+
+// Scheduled returns the updates waiting to be published, the earliest first
+func (s *Scheduler) Scheduled() []*ScheduledUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scheduled := make([]*ScheduledUpdate, 0, len(s.updates))
+	for _, r := range s.updates {
+		scheduled = append(scheduled, &ScheduledUpdate{
+			Address: r.Addr(),
+			Feed:    r.Feed,
+			Time:    r.Epoch.Time,
+		})
+	}
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].Time < scheduled[j].Time
+	})
+	return scheduled
+}
+
+// publishDue publishes the updates with epochs starting not later than now. Updates
+// rejected as invalid are dropped, the others are retried on the next check.
+func (s *Scheduler) publishDue(now uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, r := range s.updates {
+		if r.Epoch.Time > now {
+			continue
+		}
+		if _, err := s.h.Update(context.Background(), r); err != nil {
+			if e, ok := err.(*Error); !ok || e.Code() != ErrInvalidValue {
+				log.Warn("failed to publish scheduled feed update", "addr", key, "err", err)
+				continue
+			}
+			log.Warn("dropping invalid scheduled feed update", "addr", key, "err", err)
+		}
+		if err := s.remove(key); err != nil {
+			log.Error("failed to remove scheduled feed update", "addr", key, "err", err)
+		}
+	}
+}
+
+// remove deletes the scheduled update, the lock must be held
+func (s *Scheduler) remove(key string) error {
+	if _, ok := s.updates[key]; !ok {
+		return NewError(ErrNotFound, "update is not scheduled")
+	}
+	if s.store != nil {
+		if err := s.store.Delete(scheduleKeyPrefix + key); err != nil {
+			return err
+		}
+	}
+	delete(s.updates, key)
+	return nil
+}
+
+// errNoScheduler is returned by the RPC API if updates cannot be scheduled
+var errNoScheduler = NewError(ErrInit, "feed update scheduling is not enabled")
+
+// Schedule keeps the signed update until the time of its epoch, when it is published
+func (a *API) Schedule(request *Request) (storage.Address, error) {
+	if a.s == nil {
+		return nil, errNoScheduler
+	}
+	return a.s.Schedule(request)
+}
+
+// Scheduled returns the updates waiting to be published, the earliest first
+func (a *API) Scheduled() ([]*ScheduledUpdate, error) {
+	if a.s == nil {
+		return nil, errNoScheduler
+	}
+	return a.s.Scheduled(), nil
+}
+
+// CancelScheduled removes the scheduled update with the given address
+func (a *API) CancelScheduled(addr storage.Address) error {
+	if a.s == nil {
+		return errNoScheduler
+	}
+	return a.s.Cancel(addr)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// TestScheduler tests that updates signed for a future epoch are kept until their
+// time has come, survive a restart of the scheduler and can be cancelled
+func TestScheduler(t *testing.T) {
+	timeProvider := &fakeTimeProvider{
+		currentTime: startTime.Time,
+	}
+	TimestampProvider = timeProvider
+	signer := newAliceSigner()
+
+	datadir, err := ioutil.TempDir("", "feed-schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+	rh, err := NewTestHandler(datadir, &HandlerParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rh.Close()
+
+	ctx := context.Background()
+	topic, _ := NewTopic("release", nil)
+	fd := Feed{Topic: topic, User: signer.Address()}
+	latest := func() []byte {
+		t.Helper()
+		if _, err := rh.Lookup(ctx, NewQueryLatest(&fd, lookup.NoClue)); err != nil {
+			t.Fatal(err)
+		}
+		_, data, err := rh.GetContent(&fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	newUpdate := func(at uint64, data string) *Request {
+		t.Helper()
+		request, err := rh.NewRequestAt(ctx, &fd, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.SetData([]byte(data))
+		if err := request.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		return request
+	}
+
+	now := timeProvider.Now().Time
+	if _, err := rh.Update(ctx, newUpdate(now, "teaser")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rh.NewRequestAt(ctx, &fd, now-1); err == nil {
+		t.Fatal("expected error for a time before the latest update")
+	}
+
+	store := state.NewInmemoryStore()
+	scheduler, err := NewScheduler(rh.Handler, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := now + 3600
+	addr, err := scheduler.Schedule(newUpdate(release, "release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scheduler.Schedule(newUpdate(release, "release")); err == nil {
+		t.Fatal("expected error for an update scheduled twice")
+	}
+	unsigned, err := rh.NewRequestAt(ctx, &fd, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned.SetData([]byte("unsigned"))
+	if _, err := scheduler.Schedule(unsigned); err == nil {
+		t.Fatal("expected error for an unsigned update")
+	}
+
+	// the update is not published before its time
+	timeProvider.Set(release - 1)
+	scheduler.publishDue(release - 1)
+	if data := latest(); !bytes.Equal(data, []byte("teaser")) {
+		t.Fatalf("got latest update %q before release", data)
+	}
+
+	// the scheduled update is restored from the store
+	scheduler, err = NewScheduler(rh.Handler, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled := scheduler.Scheduled()
+	if len(scheduled) != 1 || !bytes.Equal(scheduled[0].Address, addr) || scheduled[0].Time != release {
+		t.Fatalf("unexpected scheduled updates %v", scheduled)
+	}
+
+	timeProvider.Set(release)
+	scheduler.publishDue(release)
+	if data := latest(); !bytes.Equal(data, []byte("release")) {
+		t.Fatalf("got latest update %q, want %q", data, "release")
+	}
+	if scheduled := scheduler.Scheduled(); len(scheduled) != 0 {
+		t.Fatalf("got %d scheduled updates after release", len(scheduled))
+	}
+
+	addr, err = scheduler.Schedule(newUpdate(release+3600, "sequel"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Cancel(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Cancel(addr); err == nil {
+		t.Fatal("expected error cancelling an update that is not scheduled")
+	}
+	scheduler, err = NewScheduler(rh.Handler, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduled := scheduler.Scheduled(); len(scheduled) != 0 {
+		t.Fatalf("got %d scheduled updates after restart, want none", len(scheduled))
+	}
+}
@@ -18,11 +18,13 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sort"
 	"sync"
 
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/storage/localstore"
 )
 
@@ -88,11 +90,17 @@ func NewFileStore(store ChunkStore, putterStore ChunkStore, params *FileStorePar
 // report error if retrieval of chunks within requested range time out.
 // It returns a reader with the chunk data and whether the content was encrypted
 func (f *FileStore) Retrieve(ctx context.Context, addr Address) (reader *LazyChunkReader, isEncrypted bool) {
-	isEncrypted = len(addr) > f.hashFunc().Size()
 	tag, err := f.tags.GetFromContext(ctx)
 	if err != nil {
 		tag = chunk.NewTag(0, "ephemeral-retrieval-tag", 0, false)
 	}
+	if IsContentDefined(Reference(addr)) {
+		getter := NewHasherStore(f.ChunkStore, f.hashFunc, false, tag)
+		reader = TreeJoin(ctx, addr[:AddressLength], getter, 0)
+		reader.contentDefined = true
+		return reader, false
+	}
+	isEncrypted = len(addr) > f.hashFunc().Size()
 
 	getter := NewHasherStore(f.ChunkStore, f.hashFunc, isEncrypted, tag)
 	reader = TreeJoin(ctx, addr, getter, 0)
@@ -101,6 +109,8 @@ func (f *FileStore) Retrieve(ctx context.Context, addr Address) (reader *LazyChu
 
 // Store is a public API. Main entry point for document storage directly. Used by the
 // FS-aware API and httpaccess
+// Unencrypted documents are split with content-defined chunking if it is set in the context,
+// and their data chunks are compressed if a compression is set in the context.
 func (f *FileStore) Store(ctx context.Context, data io.Reader, size int64, toEncrypt bool) (addr Address, wait func(context.Context) error, err error) {
 	tag, err := f.tags.GetFromContext(ctx)
 	if err != nil {
@@ -112,9 +122,91 @@ func (f *FileStore) Store(ctx context.Context, data io.Reader, size int64, toEnc
 		//return nil, nil, err
 	}
 	putter := NewHasherStore(f.putterStore, f.hashFunc, toEncrypt, tag)
+	putter.compress = !toEncrypt && sctx.GetCompression(ctx) == CompressionSnappy
+	if toEncrypt {
+		putter.encryptionKey = sctx.GetEncryptionKey(ctx)
+	}
+	if !toEncrypt && sctx.IsContentDefinedChunking(ctx) {
+		return ContentDefinedSplit(ctx, data, putter)
+	}
 	return PyramidSplit(ctx, data, putter, putter, tag)
 }
 
+// Hash returns the swarm hash of the data, the address Store returns for the data
+// with the same context, without storing or sending any chunks. The chunking and the
+// compression set in the context are applied as by Store.
+func Hash(ctx context.Context, data io.Reader) (Address, error) {
+	fileStore := NewFileStore(&FakeChunkStore{}, &FakeChunkStore{}, NewFileStoreParams(), chunk.NewTags())
+	addr, wait, err := fileStore.Store(ctx, data, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return addr, wait(ctx)
+}
+
+// Walk calls walkFn for the address of every chunk in the merkle tree of the document
+// with the given root address, parents before their children. Only intermediate tree
+// chunks are retrieved, the addresses of data chunks are read from their parents.
+func (f *FileStore) Walk(ctx context.Context, addr Address, walkFn func(Reference) error) error {
+	contentDefined := IsContentDefined(Reference(addr))
+	if contentDefined {
+		addr = addr[:AddressLength]
+	}
+	isEncrypted := len(addr) > f.hashFunc().Size()
+	getter := NewHasherStore(f.ChunkStore, f.hashFunc, isEncrypted, chunk.NewTag(0, "ephemeral-walk-tag", 0, false))
+	if err := walkFn(Reference(addr)); err != nil {
+		return err
+	}
+	root, err := getter.Get(sctx.SetMetadata(ctx, true), Reference(addr))
+	if err != nil {
+		return err
+	}
+	if contentDefined {
+		return walkContentDefined(ctx, getter, root, walkFn)
+	}
+	return f.walk(ctx, getter, root, walkFn)
+}
+
+// walk descends into the children of the tree chunk with the given data
+func (f *FileStore) walk(ctx context.Context, getter *hasherStore, chunkData ChunkData, walkFn func(Reference) error) error {
+	if len(chunkData) < 8 {
+		return fmt.Errorf("invalid chunk data length %d", len(chunkData))
+	}
+	size := int64(chunkData.Size())
+	if size <= chunk.DefaultSize {
+		return nil
+	}
+	refSize := getter.RefSize()
+	branches := chunk.DefaultSize / refSize
+	// span of the subtree referenced by each child
+	treeSize := int64(chunk.DefaultSize)
+	for treeSize*branches < size {
+		treeSize *= branches
+	}
+	children := (int64(len(chunkData)) - 8) / refSize
+	for i := int64(0); i < children; i++ {
+		ref := Reference(chunkData[8+i*refSize : 8+(i+1)*refSize])
+		if err := walkFn(ref); err != nil {
+			return err
+		}
+		span := treeSize
+		if rest := size - i*treeSize; rest < span {
+			span = rest
+		}
+		if span <= chunk.DefaultSize {
+			continue
+		}
+		data, err := getter.Get(sctx.SetMetadata(ctx, true), ref)
+		if err != nil {
+			return err
+		}
+		if err := f.walk(ctx, getter, data, walkFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *FileStore) HashSize() int {
 	return f.hashFunc().Size()
 }
@@ -24,8 +24,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage/encryption"
 	"github.com/ethersphere/swarm/storage/localstore"
 	"github.com/ethersphere/swarm/testutil"
 )
@@ -200,3 +203,280 @@ func TestGetAllReferences(t *testing.T) {
 		}
 	}
 }
+
+// TestFileStoreWalk tests that Walk visits the addresses of all the chunks of a file
+func TestFileStoreWalk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+
+	for _, size := range []int{1024, 8192, 30000, 1000000} {
+		slice := testutil.RandomBytes(1, size)
+		ctx := context.Background()
+		addr, wait, err := fileStore.Store(ctx, bytes.NewReader(slice), int64(size), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := fileStore.GetAllReferences(ctx, bytes.NewReader(slice))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make(map[string]bool)
+		for _, a := range expected {
+			want[a.Hex()] = true
+		}
+
+		var walked int
+		err = fileStore.Walk(ctx, addr, func(ref Reference) error {
+			walked++
+			if !want[Address(ref).Hex()] {
+				t.Fatalf("size %d: unexpected reference %s", size, Address(ref).Hex())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if walked != len(expected) {
+			t.Fatalf("size %d: expected %d references, got %d", size, len(expected), walked)
+		}
+	}
+}
+
+func TestFileStoreRetrieveProgressive(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testFileStoreRetrieveProgressive(false, t) })
+	t.Run("encrypted", func(t *testing.T) { testFileStoreRetrieveProgressive(true, t) })
+}
+
+func testFileStoreRetrieveProgressive(toEncrypt bool, t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+
+	for _, size := range []int{1024, 4096, 30000, 1000000} {
+		slice := testutil.RandomBytes(1, size)
+		ctx := context.Background()
+		addr, wait, err := fileStore.Store(ctx, bytes.NewReader(slice), int64(size), toEncrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		reader := fileStore.RetrieveProgressive(ctx, addr, &ProgressiveReaderParams{Window: 4})
+		gotSize, err := reader.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotSize != int64(size) {
+			t.Fatalf("expected size %d, got %d", size, gotSize)
+		}
+		// read with a buffer not aligned to chunks
+		var got []byte
+		buf := make([]byte, 1000)
+		for {
+			n, err := reader.Read(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		reader.Close()
+		if !bytes.Equal(got, slice) {
+			t.Fatalf("size %d: retrieved data mismatch", size)
+		}
+	}
+}
+
+// blockingStore is a ChunkStore which blocks retrieving chunks other than the root chunk until released
+type blockingStore struct {
+	ChunkStore
+	root    Address
+	release chan struct{}
+}
+
+func (s *blockingStore) Get(ctx context.Context, mode chunk.ModeGet, ref Address) (Chunk, error) {
+	if !bytes.Equal(ref, s.root) {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.ChunkStore.Get(ctx, mode, ref)
+}
+
+func TestProgressiveReaderReadTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	ctx := context.Background()
+	size := 30000
+	slice := testutil.RandomBytes(1, size)
+	addr, wait, err := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags()).Store(ctx, bytes.NewReader(slice), int64(size), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &blockingStore{
+		ChunkStore: localStore,
+		root:       addr,
+		release:    make(chan struct{}),
+	}
+	fileStore := NewFileStore(store, localStore, NewFileStoreParams(), chunk.NewTags())
+	reader := fileStore.RetrieveProgressive(ctx, addr, &ProgressiveReaderParams{ReadTimeout: 50 * time.Millisecond})
+	defer reader.Close()
+
+	buf := make([]byte, size)
+	if _, err := reader.Read(buf); err != ErrReadTimeout {
+		t.Fatalf("expected error %v, got %v", ErrReadTimeout, err)
+	}
+
+	// the read can be retried once the data chunks arrive
+	close(store.release)
+	n, err := reader.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != chunk.DefaultSize {
+		t.Fatalf("expected to read a chunk of %d bytes, got %d", chunk.DefaultSize, n)
+	}
+	if !bytes.Equal(buf[:n], slice[:n]) {
+		t.Fatal("retrieved data mismatch")
+	}
+}
+
+// TestFileStoreEncryptionKey validates that encrypted data stored with an encryption
+// key in the context is stored to the same reference on every upload and retrieved,
+// while random keys store it to different references.
+func TestFileStoreEncryptionKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+
+	store := func(ctx context.Context, data []byte) Address {
+		t.Helper()
+		addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	key := encryption.GenerateRandomKey(encryption.KeyLength)
+	for _, size := range []int{1024, 8192, 30000} {
+		data := testutil.RandomBytes(1, size)
+		ctx := sctx.SetEncryptionKey(context.Background(), key)
+
+		addr := store(ctx, data)
+		if again := store(ctx, data); !bytes.Equal(again, addr) {
+			t.Fatalf("size %d: got reference %s on second upload, want %s", size, again, addr)
+		}
+		if random := store(context.Background(), data); bytes.Equal(random, addr) {
+			t.Fatalf("size %d: got the same reference with random keys", size)
+		}
+		other := sctx.SetEncryptionKey(context.Background(), encryption.GenerateRandomKey(encryption.KeyLength))
+		if bytes.Equal(store(other, data), addr) {
+			t.Fatalf("size %d: got the same reference with another key", size)
+		}
+
+		reader, _ := fileStore.Retrieve(context.Background(), addr)
+		got, err := ioutil.ReadAll(io.NewSectionReader(reader, 0, int64(size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: retrieved data does not match", size)
+		}
+	}
+}
+
+// TestHash validates that Hash returns the address the data is stored
+// to with the chunking and the compression of the context.
+func TestHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+
+	for name, ctx := range map[string]context.Context{
+		"fixed":           context.Background(),
+		"content-defined": sctx.SetContentDefinedChunking(context.Background()),
+		"snappy":          sctx.SetCompression(context.Background(), CompressionSnappy),
+	} {
+		for _, size := range []int{1024, 8192, 1000000} {
+			data := testutil.RandomBytes(1, size)
+			want, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(size), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Hash(ctx, bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s size %d: got hash %s, want %s", name, size, got, want)
+			}
+		}
+	}
+}
@@ -29,6 +29,8 @@ import (
 
 const (
 	noOfStorageWorkers = 150 // Since we want 128 data chunks to be processed parallel + few for processing tree chunks
+	noOfBatchWorkers   = 8   // number of workers storing the queued chunks in batches
+	maxStoreBatchSize  = 64  // maximal number of queued chunks stored together
 
 )
 
@@ -36,19 +38,22 @@ type hasherStore struct {
 	// nrChunks is used with atomic functions
 	// it is required to be at the start of the struct to ensure 64bit alignment for ARM, x86-32, and 32-bit MIPS architectures
 	// see: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
-	nrChunks  uint64 // number of chunks to store
-	store     ChunkStore
-	tag       *chunk.Tag
-	toEncrypt bool
-	doWait    sync.Once
-	hashFunc  SwarmHasher
-	hashSize  int           // content hash size
-	refSize   int64         // reference size (content hash + possibly encryption key)
-	errC      chan error    // global error channel
-	waitC     chan error    // global wait channel
-	doneC     chan struct{} // closed by Close() call to indicate that count is the final number of chunks
-	quitC     chan struct{} // closed to quit unterminated routines
-	workers   chan Chunk    // back pressure for limiting storage workers goroutines
+	nrChunks      uint64 // number of chunks to store
+	store         ChunkStore
+	tag           *chunk.Tag
+	toEncrypt     bool
+	encryptionKey encryption.Key // the keys of the chunks are derived from it if set, otherwise random
+	compress      bool           // whether the payloads of data chunks are compressed
+	doWait        sync.Once
+	doStore       sync.Once
+	hashFunc      SwarmHasher
+	hashSize      int           // content hash size
+	refSize       int64         // reference size (content hash + possibly encryption key)
+	errC          chan error    // global error channel
+	waitC         chan error    // global wait channel
+	doneC         chan struct{} // closed by Close() call to indicate that count is the final number of chunks
+	quitC         chan struct{} // closed to quit unterminated routines
+	workers       chan Chunk    // queue of the chunks to store, back pressure for the chunker
 }
 
 // NewHasherStore creates a hasherStore object, which implements Putter and Getter interfaces.
@@ -78,10 +83,15 @@ func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool, tag
 }
 
 // Put stores the chunkData into the ChunkStore of the hasherStore and returns the reference.
-// If hasherStore has a chunkEncryption object, the data will be encrypted.
+// If hasherStore has a chunkEncryption object, the data will be encrypted,
+// otherwise the payloads of data chunks are compressed if compression is enabled.
 // Asynchronous function, the data will not necessarily be stored when it returns.
 func (h *hasherStore) Put(ctx context.Context, chunkData ChunkData) (Reference, error) {
 	c := chunkData
+	if h.compress && !h.toEncrypt && isDataChunk(chunkData) {
+		c = compressChunkData(chunkData)
+		h.tag.AddCompressed(int64(len(chunkData)-8), int64(len(c)-8))
+	}
 	var encryptionKey encryption.Key
 	if h.toEncrypt {
 		var err error
@@ -103,7 +113,7 @@ func (h *hasherStore) Put(ctx context.Context, chunkData ChunkData) (Reference,
 
 // Get returns data of the chunk with the given reference (retrieved from the ChunkStore of hasherStore).
 // If the data is encrypted and the reference contains an encryption key, it will be decrypted before
-// return.
+// return, compressed data chunks are decompressed.
 func (h *hasherStore) Get(ctx context.Context, ref Reference) (ChunkData, error) {
 	addr, encryptionKey, err := parseReference(ref, h.hashSize)
 	if err != nil {
@@ -124,6 +134,9 @@ func (h *hasherStore) Get(ctx context.Context, ref Reference) (ChunkData, error)
 			return nil, err
 		}
 	}
+	if IsCompressed(chunkData) {
+		return decompressChunkData(chunkData)
+	}
 	return chunkData, nil
 }
 
@@ -134,14 +147,20 @@ func (h *hasherStore) Close() {
 }
 
 // Wait returns when
-//    1) the Close() function has been called and
-//    2) all the chunks which has been Put has been stored
-//    OR
-//    1) if there is error while storing chunk
+//  1. the Close() function has been called and
+//  2. all the chunks which has been Put has been stored
+//     OR
+//  1. if there is error while storing chunk
+//     OR
+//  1. the context is done
 func (h *hasherStore) Wait(ctx context.Context) error {
 	defer close(h.quitC)
-	err := <-h.waitC
-	return err
+	select {
+	case err := <-h.waitC:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (h *hasherStore) startWait(ctx context.Context) {
@@ -241,12 +260,25 @@ func (h *hasherStore) RefSize() int64 {
 }
 
 func (h *hasherStore) encrypt(chunkData ChunkData) (encryption.Key, []byte, []byte, error) {
-	key := encryption.GenerateRandomKey(encryption.KeyLength)
+	var key encryption.Key
+	data := chunkData[8:]
+	if h.encryptionKey != nil {
+		key = encryption.ChunkKey(h.encryptionKey, chunkData)
+		// padding with zeros rather than random bytes makes
+		// the encrypted chunk the same on every upload
+		if len(data) < int(chunk.DefaultSize) {
+			padded := make([]byte, chunk.DefaultSize)
+			copy(padded, data)
+			data = padded
+		}
+	} else {
+		key = encryption.GenerateRandomKey(encryption.KeyLength)
+	}
 	encryptedSpan, err := h.newSpanEncryption(key).Encrypt(chunkData[:8])
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	encryptedData, err := h.newDataEncryption(key).Encrypt(chunkData[8:])
+	encryptedData, err := h.newDataEncryption(key).Encrypt(data)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -274,22 +306,59 @@ func (h *hasherStore) newDataEncryption(key encryption.Key) encryption.Encryptio
 }
 
 func (h *hasherStore) storeChunk(ctx context.Context, ch Chunk) {
-	h.workers <- ch
 	atomic.AddUint64(&h.nrChunks, 1)
-	go func() {
-		defer func() {
-			<-h.workers
-		}()
-		seen, err := h.store.Put(ctx, chunk.ModePutUpload, ch)
-		h.tag.Inc(chunk.StateStored)
-		if err == nil && seen[0] {
-			h.tag.Inc(chunk.StateSeen)
+	h.doStore.Do(func() {
+		for i := 0; i < noOfBatchWorkers; i++ {
+			go h.storeWorker(ctx)
 		}
+	})
+	// do not wait for a free worker if the context is done, the chunk is reported
+	// as failed instead so that Wait returns
+	select {
+	case h.workers <- ch:
+	case <-ctx.Done():
+		go func() {
+			select {
+			case h.errC <- ctx.Err():
+			case <-h.quitC:
+			}
+		}()
+	}
+}
+
+// storeWorker stores the queued chunks, taking the ones queued meanwhile up to
+// maxStoreBatchSize at once so that the index updates are amortized over them
+func (h *hasherStore) storeWorker(ctx context.Context) {
+	for {
+		var batch []Chunk
 		select {
-		case h.errC <- err:
+		case ch := <-h.workers:
+			batch = append(batch, ch)
 		case <-h.quitC:
+			return
 		}
-	}()
+	queued:
+		for len(batch) < maxStoreBatchSize {
+			select {
+			case ch := <-h.workers:
+				batch = append(batch, ch)
+			default:
+				break queued
+			}
+		}
+		seen, err := chunk.PutBatch(ctx, h.store, chunk.ModePutUpload, batch)
+		for i := range batch {
+			h.tag.Inc(chunk.StateStored)
+			if err == nil && seen[i] {
+				h.tag.Inc(chunk.StateSeen)
+			}
+			select {
+			case h.errC <- err:
+			case <-h.quitC:
+				return
+			}
+		}
+	}
 }
 
 func parseReference(ref Reference, hashSize int) (Address, encryption.Key, error) {
@@ -0,0 +1,407 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package journal provides an append-only log of a single owner
+// built on top of Swarm feeds.
+//
+// Entries are appended in batches, every batch is stored as a block that references
+// the block of the previous batch, so that the blocks form a chain from the latest
+// batch back to the first one. The latest block is referenced by the head feed of the
+// journal, which topic is derived from the name of the journal. Only the owner of the
+// journal can append entries to it, while anyone knowing the name of the journal and
+// the owner address can read it.
+//
+// A Journal keeps a local index of the blocks it has read, so that reading the latest
+// entries only retrieves the blocks appended since the last read.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// DefaultCacheCapacity is the number of blocks cached by a Journal
+const DefaultCacheCapacity = 100
+
+var (
+	// ErrReadOnly is returned when appending to a journal opened without a signer
+	ErrReadOnly = errors.New("read only")
+	// ErrEmptyBatch is returned when appending no entries
+	ErrEmptyBatch = errors.New("no entries to append")
+
+	errNotFound = errors.New("not found")
+)
+
+// Journal is an append-only log of a single owner
+type Journal struct {
+	name      string
+	owner     common.Address
+	signer    feed.Signer // nil for read only journals
+	handler   *feed.Handler
+	fileStore *storage.FileStore
+	cache     *lru.Cache // blocks by reference
+
+	mu    sync.Mutex   // serializes appends and protects the index
+	index []indexEntry // contiguous blocks up to the latest known one, in order
+}
+
+// indexEntry locates a block of the journal
+type indexEntry struct {
+	first uint64 // index of the first entry of the block
+	count uint64 // number of entries in the block
+	ref   storage.Address
+	prev  storage.Address // reference of the previous block, nil for the first block
+}
+
+// block is a batch of entries appended to the journal
+type block struct {
+	prev    storage.Address
+	first   uint64
+	entries [][]byte
+}
+
+// New creates a journal with the given name, owned by the signer
+func New(name string, signer feed.Signer, handler *feed.Handler, fileStore *storage.FileStore) (*Journal, error) {
+	j, err := Open(name, signer.Address(), handler, fileStore)
+	if err != nil {
+		return nil, err
+	}
+	j.signer = signer
+	return j, nil
+}
+
+// Open opens a read only journal with the given name and owner
+func Open(name string, owner common.Address, handler *feed.Handler, fileStore *storage.FileStore) (*Journal, error) {
+	if _, err := feed.NewTopic(name, nil); err != nil {
+		return nil, err
+	}
+	cache, err := lru.New(DefaultCacheCapacity)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		name:      name,
+		owner:     owner,
+		handler:   handler,
+		fileStore: fileStore,
+		cache:     cache,
+	}, nil
+}
+
+// Owner returns the address of the owner of the journal
+func (j *Journal) Owner() common.Address {
+	return j.owner
+}
+
+// Append appends the entries to the journal as a single batch,
+// and returns the index of the first one
+func (j *Journal) Append(ctx context.Context, entries ...[]byte) (uint64, error) {
+	if j.signer == nil {
+		return 0, ErrReadOnly
+	}
+	if len(entries) == 0 {
+		return 0, ErrEmptyBatch
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// only the latest block is needed to chain the new one
+	if err := j.sync(ctx, math.MaxUint64); err != nil {
+		return 0, err
+	}
+	b := &block{
+		entries: entries,
+	}
+	if len(j.index) > 0 {
+		last := j.index[len(j.index)-1]
+		b.prev = last.ref
+		b.first = last.first + last.count
+	}
+	data := encodeBlock(b)
+	ref, wait, err := j.fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		return 0, fmt.Errorf("store block: %w", err)
+	}
+	if err := wait(ctx); err != nil {
+		return 0, fmt.Errorf("store block: %w", err)
+	}
+	if err := j.update(ctx, ref); err != nil {
+		return 0, err
+	}
+	j.cache.Add(ref.Hex(), b)
+	j.index = append(j.index, indexEntry{
+		first: b.first,
+		count: uint64(len(entries)),
+		ref:   ref,
+		prev:  b.prev,
+	})
+	return b.first, nil
+}
+
+// Len returns the number of entries in the journal
+func (j *Journal) Len(ctx context.Context) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.sync(ctx, math.MaxUint64); err != nil {
+		return 0, err
+	}
+	if len(j.index) == 0 {
+		return 0, nil
+	}
+	last := j.index[len(j.index)-1]
+	return last.first + last.count, nil
+}
+
+// Iterate calls fn for every entry of the journal from the index from, in order.
+// Iteration stops when fn returns true or an error.
+func (j *Journal) Iterate(ctx context.Context, from uint64, fn func(index uint64, data []byte) (stop bool, err error)) error {
+	j.mu.Lock()
+	err := j.sync(ctx, from)
+	index := j.index
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range index {
+		if e.first+e.count <= from {
+			continue
+		}
+		b, err := j.block(ctx, e.ref)
+		if err != nil {
+			return err
+		}
+		for i, data := range b.entries {
+			idx := b.first + uint64(i)
+			if idx < from {
+				continue
+			}
+			stop, err := fn(idx, data)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// sync extends the index with the blocks appended since the last sync,
+// and back to the block with the entry at the index from
+// it must be called with the mutex held
+func (j *Journal) sync(ctx context.Context, from uint64) error {
+	head, err := j.lookup(ctx)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var known storage.Address
+	if len(j.index) > 0 {
+		known = j.index[len(j.index)-1].ref
+	}
+	// walk back from the head until the latest known block
+	var appended []indexEntry
+	for ref := head; ref != nil && !bytes.Equal(ref, known); {
+		b, err := j.block(ctx, ref)
+		if err != nil {
+			return err
+		}
+		appended = append([]indexEntry{{
+			first: b.first,
+			count: uint64(len(b.entries)),
+			ref:   ref,
+			prev:  b.prev,
+		}}, appended...)
+		if known == nil && b.first <= from {
+			break
+		}
+		ref = b.prev
+	}
+	if len(appended) > 0 && known != nil && !bytes.Equal(appended[0].prev, known) {
+		// the known blocks are not in the chain of the head
+		j.index = nil
+	}
+	j.index = append(j.index, appended...)
+
+	// walk back from the earliest known block until the block with the entry at from
+	for len(j.index) > 0 && j.index[0].first > from && j.index[0].prev != nil {
+		ref := j.index[0].prev
+		b, err := j.block(ctx, ref)
+		if err != nil {
+			return err
+		}
+		j.index = append([]indexEntry{{
+			first: b.first,
+			count: uint64(len(b.entries)),
+			ref:   ref,
+			prev:  b.prev,
+		}}, j.index...)
+	}
+	return nil
+}
+
+// block returns the block with the reference
+func (j *Journal) block(ctx context.Context, ref storage.Address) (*block, error) {
+	if b, ok := j.cache.Get(ref.Hex()); ok {
+		return b.(*block), nil
+	}
+	reader, _ := j.fileStore.Retrieve(ctx, ref)
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve block %s: %w", ref, err)
+	}
+	b, err := decodeBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("block %s: %w", ref, err)
+	}
+	j.cache.Add(ref.Hex(), b)
+	return b, nil
+}
+
+// feed returns the head feed of the journal
+func (j *Journal) feed() *feed.Feed {
+	// the name is validated in the constructor
+	topic, _ := feed.NewTopic(j.name, nil)
+	return &feed.Feed{
+		Topic: topic,
+		User:  j.owner,
+	}
+}
+
+// lookup returns the reference of the latest block from the head feed
+func (j *Journal) lookup(ctx context.Context) (storage.Address, error) {
+	fd := j.feed()
+	if _, err := j.handler.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		if ferr, ok := err.(*feed.Error); ok && ferr.Code() == feed.ErrNotFound {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	_, data, err := j.handler.GetContent(fd)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Address(data), nil
+}
+
+// update publishes the reference of the latest block as the new update of the head feed
+func (j *Journal) update(ctx context.Context, ref storage.Address) error {
+	request, err := j.handler.NewRequest(ctx, j.feed())
+	if err != nil {
+		return err
+	}
+	request.SetData(ref)
+	if err := request.Sign(j.signer); err != nil {
+		return err
+	}
+	_, err = j.handler.Update(ctx, request)
+	return err
+}
+
+// encodeBlock serializes the block: the reference of the previous block,
+// the index of the first entry and the entries, each prefixed with its length
+func encodeBlock(b *block) []byte {
+	var buf bytes.Buffer
+	l := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) {
+		n := binary.PutUvarint(l, v)
+		buf.Write(l[:n])
+	}
+	writeUvarint(uint64(len(b.prev)))
+	buf.Write(b.prev)
+	writeUvarint(b.first)
+	writeUvarint(uint64(len(b.entries)))
+	for _, e := range b.entries {
+		writeUvarint(uint64(len(e)))
+		buf.Write(e)
+	}
+	return buf.Bytes()
+}
+
+// decodeBlock deserializes a block encoded with encodeBlock
+func decodeBlock(data []byte) (*block, error) {
+	errInvalid := errors.New("invalid block data")
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, errInvalid
+		}
+		data = data[n:]
+		return v, nil
+	}
+	readBytes := func() ([]byte, error) {
+		l, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(data)) < l {
+			return nil, errInvalid
+		}
+		v := data[:l]
+		data = data[l:]
+		return v, nil
+	}
+
+	b := &block{}
+	prev, err := readBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(prev) > 0 {
+		b.prev = storage.Address(prev)
+	}
+	if b.first, err = readUvarint(); err != nil {
+		return nil, err
+	}
+	count, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// every entry takes at least one byte
+	if count == 0 || count > uint64(len(data)) {
+		return nil, errInvalid
+	}
+	b.entries = make([][]byte, count)
+	for i := range b.entries {
+		if b.entries[i], err = readBytes(); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) > 0 {
+		return nil, errInvalid
+	}
+	return b, nil
+}
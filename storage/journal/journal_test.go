@@ -0,0 +1,182 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package journal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+)
+
+func newTestJournal(t *testing.T) (j *Journal, cleanup func()) {
+	t.Helper()
+
+	datadir, err := ioutil.TempDir("", "journal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := feed.NewTestHandler(datadir, &feed.HandlerParams{})
+	if err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	fileStore, cleanupFileStore, err := storage.NewLocalFileStore(datadir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		handler.Close()
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		cleanupFileStore()
+		handler.Close()
+		os.RemoveAll(datadir)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	j, err = New("test", feed.NewGenericSigner(key), handler.Handler, fileStore)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return j, cleanup
+}
+
+// collect returns the entries of the journal from the index from
+func collect(t *testing.T, j *Journal, from uint64) (entries []string) {
+	t.Helper()
+
+	next := from
+	err := j.Iterate(context.Background(), from, func(index uint64, data []byte) (bool, error) {
+		if index != next {
+			t.Fatalf("got entry %d, want %d", index, next)
+		}
+		next++
+		entries = append(entries, string(data))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// TestJournal validates that the entries appended to the journal in batches
+// are iterated over in order, also when the local index is empty.
+func TestJournal(t *testing.T) {
+	j, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	if n, err := j.Len(ctx); err != nil || n != 0 {
+		t.Fatalf("got length %d and error %v, want 0", n, err)
+	}
+	if entries := collect(t, j, 0); len(entries) != 0 {
+		t.Fatalf("got entries %v", entries)
+	}
+	if _, err := j.Append(ctx); err != ErrEmptyBatch {
+		t.Fatalf("got error %v, want %v", err, ErrEmptyBatch)
+	}
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		batch := make([][]byte, i+1)
+		for k := range batch {
+			batch[k] = []byte(fmt.Sprintf("entry%d", len(want)))
+			want = append(want, string(batch[k]))
+		}
+		first, err := j.Append(ctx, batch...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(first) != len(want)-len(batch) {
+			t.Fatalf("got first index %d, want %d", first, len(want)-len(batch))
+		}
+	}
+
+	// the same journal opened read only does not have anything indexed
+	r, err := Open("test", j.Owner(), j.handler, j.fileStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Append(ctx, []byte("entry")); err != ErrReadOnly {
+		t.Fatalf("got error %v, want %v", err, ErrReadOnly)
+	}
+
+	for _, journal := range []*Journal{j, r} {
+		if n, err := journal.Len(ctx); err != nil || int(n) != len(want) {
+			t.Fatalf("got length %d and error %v, want %d", n, err, len(want))
+		}
+		for _, from := range []int{12, 7, 0, len(want)} {
+			if got := collect(t, journal, uint64(from)); fmt.Sprint(got) != fmt.Sprint(want[from:]) {
+				t.Fatalf("from %d: got entries %v, want %v", from, got, want[from:])
+			}
+		}
+	}
+
+	// the read only journal reads the entries appended after it
+	if _, err := j.Append(ctx, []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, r, uint64(len(want))); fmt.Sprint(got) != "[last]" {
+		t.Fatalf("got entries %v", got)
+	}
+
+	// iteration stops when asked to
+	var count int
+	err = r.Iterate(ctx, 0, func(index uint64, data []byte) (bool, error) {
+		count++
+		return count == 3, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("got %d entries, want 3", count)
+	}
+}
+
+// TestBlockEncoding validates the serialization of the blocks.
+func TestBlockEncoding(t *testing.T) {
+	b := &block{
+		prev:    make([]byte, 32),
+		first:   300,
+		entries: [][]byte{{}, []byte("a"), make([]byte, 300)},
+	}
+	got, err := decodeBlock(encodeBlock(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(b) {
+		t.Fatalf("got block %v, want %v", got, b)
+	}
+	if _, err := decodeBlock([]byte{0, 0, 2, 1}); err == nil {
+		t.Error("expected error decoding invalid data")
+	}
+}
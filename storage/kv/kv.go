@@ -0,0 +1,304 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package kv provides a mutable key-value map of a single owner
+// built on top of Swarm feeds.
+//
+// Every key is stored as a separate feed, which topic is derived from the
+// name of the map and the key, with the value as the feed update data.
+// The keys of the map are kept in a file, referenced by the index feed of the map,
+// so that the map can be iterated over. Only the owner of the map can put values
+// into it, while anyone knowing the name of the map and the owner address can read it.
+//
+// Values and keys are cached locally, so updates of the same map published
+// from other nodes may not be visible to an already opened Store.
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// DefaultCacheCapacity is the number of values cached by a Store
+const DefaultCacheCapacity = 1000
+
+var (
+	// ErrNotFound is returned when the key is not in the map
+	ErrNotFound = errors.New("not found")
+	// ErrReadOnly is returned when putting values into a map opened without a signer
+	ErrReadOnly = errors.New("read only")
+	// ErrValueTooLarge is returned when the value does not fit into a feed update
+	ErrValueTooLarge = fmt.Errorf("value too large, max length is %d", feed.MaxUpdateDataLength)
+)
+
+var (
+	keyPrefix   = []byte("kv-key")
+	indexPrefix = []byte("kv-index")
+)
+
+// Store is a key-value map of a single owner
+type Store struct {
+	name      string
+	owner     common.Address
+	signer    feed.Signer // nil for read only maps
+	handler   *feed.Handler
+	fileStore *storage.FileStore
+	cache     *lru.Cache // values by key
+
+	mu     sync.Mutex          // serializes puts and protects the index
+	keys   map[string]struct{} // keys of the map
+	loaded bool                // true when the keys are loaded from the index
+}
+
+// New creates a key-value map with the given name, owned by the signer
+func New(name string, signer feed.Signer, handler *feed.Handler, fileStore *storage.FileStore) (*Store, error) {
+	s, err := Open(name, signer.Address(), handler, fileStore)
+	if err != nil {
+		return nil, err
+	}
+	s.signer = signer
+	return s, nil
+}
+
+// Open opens a read only key-value map with the given name and owner
+func Open(name string, owner common.Address, handler *feed.Handler, fileStore *storage.FileStore) (*Store, error) {
+	// validate the name, the topics of all keys are derived from it
+	if _, err := feed.NewTopic(name, nil); err != nil {
+		return nil, err
+	}
+	cache, err := lru.New(DefaultCacheCapacity)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		name:      name,
+		owner:     owner,
+		handler:   handler,
+		fileStore: fileStore,
+		cache:     cache,
+		keys:      make(map[string]struct{}),
+	}, nil
+}
+
+// Owner returns the address of the owner of the map
+func (s *Store) Owner() common.Address {
+	return s.owner
+}
+
+// Get returns the value stored under the key, or ErrNotFound
+func (s *Store) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if v, ok := s.cache.Get(string(key)); ok {
+		return v.([]byte), nil
+	}
+	value, err := s.lookup(ctx, s.feed(keyPrefix, key))
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Add(string(key), value)
+	return value, nil
+}
+
+// Put stores the value under the key
+func (s *Store) Put(ctx context.Context, key, value []byte) error {
+	if s.signer == nil {
+		return ErrReadOnly
+	}
+	if len(value) > feed.MaxUpdateDataLength {
+		return ErrValueTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.update(ctx, s.feed(keyPrefix, key), value); err != nil {
+		return err
+	}
+	s.cache.Add(string(key), value)
+
+	if err := s.loadIndex(ctx); err != nil {
+		return err
+	}
+	if _, ok := s.keys[string(key)]; ok {
+		return nil
+	}
+	s.keys[string(key)] = struct{}{}
+	if err := s.storeIndex(ctx); err != nil {
+		delete(s.keys, string(key))
+		return err
+	}
+	return nil
+}
+
+// Iterate calls fn for every key in the map and its value, in the order of keys.
+// Iteration stops when fn returns true or an error.
+func (s *Store) Iterate(ctx context.Context, fn func(key, value []byte) (stop bool, err error)) error {
+	s.mu.Lock()
+	err := s.loadIndex(ctx)
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, err := s.Get(ctx, []byte(k))
+		if err != nil {
+			return fmt.Errorf("get key %x: %w", k, err)
+		}
+		stop, err := fn([]byte(k), value)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// loadIndex retrieves the keys of the map if they are not already loaded
+// it must be called with the mutex held
+func (s *Store) loadIndex(ctx context.Context) error {
+	if s.loaded {
+		return nil
+	}
+	ref, err := s.lookup(ctx, s.feed(indexPrefix, nil))
+	if err == ErrNotFound {
+		// no keys were put into the map yet
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reader, _ := s.fileStore.Retrieve(ctx, storage.Address(ref))
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("retrieve index: %w", err)
+	}
+	keys, err := decodeKeys(data)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s.keys[string(k)] = struct{}{}
+	}
+	s.loaded = true
+	return nil
+}
+
+// storeIndex uploads the keys of the map and updates the index feed with their reference
+// it must be called with the mutex held
+func (s *Store) storeIndex(ctx context.Context) error {
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	data := encodeKeys(keys)
+
+	ref, wait, err := s.fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		return fmt.Errorf("store index: %w", err)
+	}
+	if err := wait(ctx); err != nil {
+		return fmt.Errorf("store index: %w", err)
+	}
+	return s.update(ctx, s.feed(indexPrefix, nil), ref)
+}
+
+// feed returns the feed of the map for the prefixed key
+func (s *Store) feed(prefix, key []byte) *feed.Feed {
+	// the name is validated in the constructor
+	topic, _ := feed.NewTopic(s.name, crypto.Keccak256(prefix, key))
+	return &feed.Feed{
+		Topic: topic,
+		User:  s.owner,
+	}
+}
+
+// lookup returns the data of the latest update of the feed
+func (s *Store) lookup(ctx context.Context, fd *feed.Feed) ([]byte, error) {
+	if _, err := s.handler.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		if ferr, ok := err.(*feed.Error); ok && ferr.Code() == feed.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	_, data, err := s.handler.GetContent(fd)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// update publishes the data as the new update of the feed
+func (s *Store) update(ctx context.Context, fd *feed.Feed, data []byte) error {
+	request, err := s.handler.NewRequest(ctx, fd)
+	if err != nil {
+		return err
+	}
+	request.SetData(data)
+	if err := request.Sign(s.signer); err != nil {
+		return err
+	}
+	_, err = s.handler.Update(ctx, request)
+	return err
+}
+
+// encodeKeys serializes the keys, each prefixed with its length
+func encodeKeys(keys []string) []byte {
+	var buf bytes.Buffer
+	l := make([]byte, binary.MaxVarintLen64)
+	for _, k := range keys {
+		n := binary.PutUvarint(l, uint64(len(k)))
+		buf.Write(l[:n])
+		buf.WriteString(k)
+	}
+	return buf.Bytes()
+}
+
+// decodeKeys deserializes the keys encoded with encodeKeys
+func decodeKeys(data []byte) (keys [][]byte, err error) {
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < l {
+			return nil, errors.New("invalid index data")
+		}
+		data = data[n:]
+		keys = append(keys, data[:l])
+		data = data[l:]
+	}
+	return keys, nil
+}
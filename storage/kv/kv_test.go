@@ -0,0 +1,165 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+)
+
+func newTestStore(t *testing.T) (s *Store, cleanup func()) {
+	t.Helper()
+
+	datadir, err := ioutil.TempDir("", "kv-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := feed.NewTestHandler(datadir, &feed.HandlerParams{})
+	if err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	fileStore, cleanupFileStore, err := storage.NewLocalFileStore(datadir, make([]byte, 32), chunk.NewTags())
+	if err != nil {
+		handler.Close()
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		cleanupFileStore()
+		handler.Close()
+		os.RemoveAll(datadir)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	s, err = New("test", feed.NewGenericSigner(key), handler.Handler, fileStore)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return s, cleanup
+}
+
+// TestStore validates that the values put into the map can be retrieved
+// and iterated over, also when the local cache is empty.
+func TestStore(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, []byte("missing")); err != ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	want := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		value := []byte(fmt.Sprintf("value%d", i))
+		if err := s.Put(ctx, key, value); err != nil {
+			t.Fatal(err)
+		}
+		want[string(key)] = value
+	}
+	// overwrite a value
+	if err := s.Put(ctx, []byte("key1"), []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	want["key1"] = []byte("updated")
+
+	// the same map opened read only does not have anything cached
+	r, err := Open("test", s.Owner(), s.handler, s.fileStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(ctx, []byte("key"), []byte("value")); err != ErrReadOnly {
+		t.Fatalf("got error %v, want %v", err, ErrReadOnly)
+	}
+
+	for _, store := range []*Store{s, r} {
+		for k, v := range want {
+			got, err := store.Get(ctx, []byte(k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, v) {
+				t.Errorf("key %s: got value %s, want %s", k, got, v)
+			}
+		}
+
+		var keys []string
+		err := store.Iterate(ctx, func(key, value []byte) (bool, error) {
+			if !bytes.Equal(value, want[string(key)]) {
+				t.Errorf("key %s: got value %s, want %s", key, value, want[string(key)])
+			}
+			keys = append(keys, string(key))
+			return false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(keys) != "[key0 key1 key2 key3 key4]" {
+			t.Errorf("got keys %v", keys)
+		}
+	}
+}
+
+// TestStoreValueTooLarge validates that values that do not
+// fit into a feed update are rejected.
+func TestStoreValueTooLarge(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	err := s.Put(context.Background(), []byte("key"), make([]byte, feed.MaxUpdateDataLength+1))
+	if err != ErrValueTooLarge {
+		t.Fatalf("got error %v, want %v", err, ErrValueTooLarge)
+	}
+}
+
+// TestKeysEncoding validates the serialization of the index.
+func TestKeysEncoding(t *testing.T) {
+	keys := []string{"", "a", string(make([]byte, 300))}
+	got, err := decodeKeys(encodeKeys(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("got %v keys, want %v", len(got), len(keys))
+	}
+	for i, k := range keys {
+		if string(got[i]) != k {
+			t.Errorf("key %v: got %x, want %x", i, got[i], k)
+		}
+	}
+	if _, err := decodeKeys([]byte{10, 1}); err == nil {
+		t.Error("expected error decoding invalid data")
+	}
+}
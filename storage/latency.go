@@ -0,0 +1,138 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// latencySamples is the number of most recent delivery latencies kept per peer and globally
+const latencySamples = 64
+
+// LatencyTracker keeps a sliding window of chunk delivery latencies per peer
+// as well as across all peers. It is used by the NetStore to decide when a
+// parallel (hedged) retrieve request should be issued for a chunk.
+type LatencyTracker struct {
+	mtx    sync.RWMutex
+	peers  map[enode.ID]*latencyWindow
+	global *latencyWindow
+}
+
+// NewLatencyTracker is the constructor for LatencyTracker
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{
+		peers:  make(map[enode.ID]*latencyWindow),
+		global: newLatencyWindow(latencySamples),
+	}
+}
+
+// Record adds a delivery latency sample for the given peer
+func (lt *LatencyTracker) Record(id enode.ID, d time.Duration) {
+	lt.mtx.Lock()
+	defer lt.mtx.Unlock()
+
+	w, ok := lt.peers[id]
+	if !ok {
+		w = newLatencyWindow(latencySamples)
+		lt.peers[id] = w
+	}
+	w.add(d)
+	lt.global.add(d)
+}
+
+// Remove drops all samples recorded for the given peer, i.e. when the peer disconnects
+func (lt *LatencyTracker) Remove(id enode.ID) {
+	lt.mtx.Lock()
+	defer lt.mtx.Unlock()
+
+	delete(lt.peers, id)
+}
+
+// Percentile returns the latency percentile p (0 < p <= 1) for the given peer.
+// If no samples are known for the peer, the global percentile is returned.
+// The second return value is false if no samples at all have been recorded.
+func (lt *LatencyTracker) Percentile(id enode.ID, p float64) (time.Duration, bool) {
+	lt.mtx.RLock()
+	defer lt.mtx.RUnlock()
+
+	if w, ok := lt.peers[id]; ok && w.len() > 0 {
+		return w.percentile(p), true
+	}
+	if lt.global.len() > 0 {
+		return lt.global.percentile(p), true
+	}
+	return 0, false
+}
+
+// GlobalPercentile returns the latency percentile p across all peers
+func (lt *LatencyTracker) GlobalPercentile(p float64) (time.Duration, bool) {
+	lt.mtx.RLock()
+	defer lt.mtx.RUnlock()
+
+	if lt.global.len() == 0 {
+		return 0, false
+	}
+	return lt.global.percentile(p), true
+}
+
+// latencyWindow is a fixed size ring buffer of latency samples
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{
+		samples: make([]time.Duration, size),
+	}
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *latencyWindow) len() int {
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	n := w.len()
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(float64(n)*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+	return sorted[i]
+}
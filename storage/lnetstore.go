@@ -21,6 +21,7 @@ import (
 
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
 )
 
 // LNetStore is a wrapper of NetStore, which implements the chunk.Store interface. It is used only by the FileStore,
@@ -37,10 +38,15 @@ func NewLNetStore(store *NetStore) *LNetStore {
 }
 
 // Get converts a chunk reference to a chunk Request (with empty Origin), handled by the NetStore, and
-// returns the requested chunk, or error.
+// returns the requested chunk, or error. The priority of the request is taken from the context.
+// Retrievals with recovery targets in the context wait additionally for missing chunks to be re-uploaded.
 func (n *LNetStore) Get(ctx context.Context, mode chunk.ModeGet, ref Address) (ch Chunk, err error) {
-	ctx, cancel := context.WithTimeout(ctx, timeouts.FetcherGlobalTimeout)
+	timeout := timeouts.FetcherGlobalTimeout
+	if n.Recover != nil && len(sctx.GetRecoveryTargets(ctx)) > 0 {
+		timeout += timeouts.RecoveryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	return n.NetStore.Get(ctx, mode, NewRequest(ref))
+	return n.NetStore.Get(ctx, mode, NewRequestWithContext(ctx, ref))
 }
@@ -0,0 +1,258 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// BackendLevelDB stores the data of chunks in the LevelDB of the indexes, the default
+	BackendLevelDB = "leveldb"
+	// BackendFiles stores the data of chunks in flat files sharded in directories,
+	// the data of chunks smaller than BackendMinSize stays in the LevelDB of the indexes
+	BackendFiles = "files"
+)
+
+// filesDir is the directory of the files backend in the directory of the localstore
+const filesDir = "files"
+
+// BackendMinSize is the size of the data of chunks below which it is stored
+// in the LevelDB of the indexes regardless of the backend
+var BackendMinSize = 1024
+
+// Backend stores the data of chunks outside of the LevelDB of the localstore, which keeps
+// the indexes. The retrieval index of a chunk records whether its data is in the backend,
+// so that a localstore is migrated from a backend to another chunk by chunk.
+type Backend interface {
+	// Put stores the data of the chunk with the address
+	Put(addr chunk.Address, data []byte) error
+	// Get returns the data of the chunk with the address, leveldb.ErrNotFound if not stored
+	Get(addr chunk.Address) ([]byte, error)
+	// Has returns whether the data of the chunk with the address is stored
+	Has(addr chunk.Address) (bool, error)
+	// Delete removes the data of the chunk with the address, if stored
+	Delete(addr chunk.Address) error
+	// Close releases the resources of the backend
+	Close() error
+}
+
+// openBackend opens the backend of the localstore in the path, chunks are written
+// to it if it is the configured backend and read from it if it has data of chunks
+// that were not migrated to the configured backend yet
+func openBackend(path, name string) (b Backend, writes bool, err error) {
+	dir := filepath.Join(path, filesDir)
+	switch name {
+	case "", BackendLevelDB:
+		if path == "" {
+			return nil, false, nil
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return nil, false, nil
+		}
+		b, err = NewFileBackend(dir)
+		return b, false, err
+	case BackendFiles:
+		if path == "" {
+			return nil, false, fmt.Errorf("chunk store backend %s requires a path", name)
+		}
+		b, err = NewFileBackend(dir)
+		return b, true, err
+	}
+	return nil, false, fmt.Errorf("unknown chunk store backend %q", name)
+}
+
+// FileBackend is a Backend storing the data of each chunk in a file, sharded
+// in directories by the first two bytes of the address to keep them small
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend creates a FileBackend storing the files in the directory
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// path returns the path of the file of the chunk with the address
+func (b *FileBackend) path(addr chunk.Address) string {
+	h := hex.EncodeToString(addr)
+	return filepath.Join(b.dir, h[:2], h[2:4], h)
+}
+
+// Put implements Backend, the file is written atomically
+func (b *FileBackend) Put(addr chunk.Address, data []byte) error {
+	path := b.path(addr)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Get implements Backend
+func (b *FileBackend) Get(addr chunk.Address) ([]byte, error) {
+	data, err := ioutil.ReadFile(b.path(addr))
+	if os.IsNotExist(err) {
+		return nil, leveldb.ErrNotFound
+	}
+	return data, err
+}
+
+// Has implements Backend
+func (b *FileBackend) Has(addr chunk.Address) (bool, error) {
+	_, err := os.Stat(b.path(addr))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete implements Backend
+func (b *FileBackend) Delete(addr chunk.Address) error {
+	err := os.Remove(b.path(addr))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Close implements Backend
+func (b *FileBackend) Close() error {
+	return nil
+}
+
+// inBackend returns whether the data of the chunk is stored in the backend
+// with the configured backend of the localstore
+func (db *DB) inBackend(data []byte) bool {
+	return db.backendWrites && len(data) >= BackendMinSize
+}
+
+// deleteBackendData removes the data of the chunks removed from the indexes from
+// the backend, it must be called after the batch removing them is written
+func (db *DB) deleteBackendData(addrs []chunk.Address) {
+	if db.backend == nil {
+		return
+	}
+	for _, addr := range addrs {
+		if err := db.backend.Delete(addr); err != nil {
+			metrics.GetOrRegisterCounter("localstore/backend/delete/error", nil).Inc(1)
+			log.Error("localstore backend delete", "addr", addr, "err", err)
+		}
+	}
+}
+
+// MigrateBackend moves the data of the chunks stored in another backend than the configured
+// one to the configured backend, returning the number of chunks moved. The localstore is
+// usable while it is migrated.
+func (db *DB) MigrateBackend() (moved int, err error) {
+	const batchSize = 1000
+	var (
+		items []shed.Item
+		start *shed.Item
+	)
+	for {
+		items = items[:0]
+		err := db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+			if len(items) == batchSize {
+				return true, nil
+			}
+			start = &item
+			// the data of chunks in the cold tier stays there
+			cold, err := db.isCold(item)
+			if err != nil || cold {
+				return err != nil, err
+			}
+			has := false
+			if db.backend != nil {
+				if has, err = db.backend.Has(item.Address); err != nil {
+					return true, err
+				}
+			}
+			if has != db.inBackend(item.Data) {
+				items = append(items, item)
+			}
+			return false, nil
+		}, &shed.IterateOptions{StartFrom: start, SkipStartFromItem: start != nil})
+		if err != nil {
+			return moved, err
+		}
+		if len(items) == 0 {
+			return moved, nil
+		}
+		n, err := db.migrateItems(items)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+	}
+}
+
+// migrateItems rewrites the retrieval index of the items with the configured backend
+func (db *DB) migrateItems(items []shed.Item) (n int, err error) {
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	batch := new(leveldb.Batch)
+	var removed []chunk.Address
+	for _, item := range items {
+		// the chunk might have been removed or collected since iterated
+		has, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			continue
+		}
+		if err := db.retrievalDataIndex.PutInBatch(batch, item); err != nil {
+			return 0, err
+		}
+		if !db.inBackend(item.Data) {
+			removed = append(removed, item.Address)
+		}
+		n++
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return 0, err
+	}
+	db.deleteBackendData(removed)
+	return n, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// S3Timeout is the timeout of the requests of an S3Backend
+var S3Timeout = 30 * time.Second
+
+// S3Config configures an S3Backend
+type S3Config struct {
+	Endpoint  string // URL of the S3 compatible service, e.g. https://s3.amazonaws.com or http://localhost:9000 for MinIO
+	Bucket    string // bucket storing the data of chunks in objects named by the hex address
+	Region    string // region of the bucket, us-east-1 if empty
+	AccessKey string // access key, requests are not signed if empty
+	SecretKey string
+}
+
+// S3Backend is a Backend storing the data of chunks in a bucket of an S3 compatible
+// object storage, addressed path style and signed with AWS Signature Version 4
+type S3Backend struct {
+	endpoint *url.URL
+	config   S3Config
+	client   *http.Client
+}
+
+// NewS3Backend creates an S3Backend with the configuration, the bucket must exist
+func NewS3Backend(config S3Config) (*S3Backend, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket not set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3Backend{
+		endpoint: u,
+		config:   config,
+		client:   &http.Client{Timeout: S3Timeout},
+	}, nil
+}
+
+// Put implements Backend
+func (b *S3Backend) Put(addr chunk.Address, data []byte) error {
+	res, err := b.do(http.MethodPut, addr, data)
+	if err != nil {
+		return err
+	}
+	return s3Error(res)
+}
+
+// Get implements Backend
+func (b *S3Backend) Get(addr chunk.Address) ([]byte, error) {
+	res, err := b.do(http.MethodGet, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, leveldb.ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, s3Error(res)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// Has implements Backend
+func (b *S3Backend) Has(addr chunk.Address) (bool, error) {
+	res, err := b.do(http.MethodHead, addr, nil)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("s3: %s", res.Status)
+}
+
+// Delete implements Backend
+func (b *S3Backend) Delete(addr chunk.Address) error {
+	res, err := b.do(http.MethodDelete, addr, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil
+	}
+	return s3Error(res)
+}
+
+// Close implements Backend
+func (b *S3Backend) Close() error {
+	return nil
+}
+
+// do sends the request for the object of the chunk with the address
+func (b *S3Backend) do(method string, addr chunk.Address, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.config.Bucket + "/" + hex.EncodeToString(addr)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if b.config.AccessKey != "" {
+		b.sign(req, body, time.Now())
+	}
+	return b.client.Do(req)
+}
+
+// sign adds the AWS Signature Version 4 authorization of the request
+func (b *S3Backend) sign(req *http.Request, body []byte, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	amzDate := t.Format("20060102T150405Z")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // no query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + b.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + b.config.SecretKey)
+	for _, s := range []string{date, b.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", b.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Error closes the body of the response and returns
+// an error with its status if it is not successful
+func s3Error(res *http.Response) error {
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(res.Body)
+	return fmt.Errorf("s3: %s: %s", res.Status, bytes.TrimSpace(msg))
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// TestFileBackend validates that the data of chunks is stored in the files
+// backend if it is not smaller than BackendMinSize and removed with the chunks.
+func TestFileBackend(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{Backend: BackendFiles})
+	defer cleanupFunc()
+
+	small := generateTestRandomChunkOfSize(BackendMinSize - 1)
+	large := generateTestRandomChunkOfSize(BackendMinSize)
+	for _, ch := range []chunk.Chunk{small, large} {
+		if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		ch   chunk.Chunk
+		want bool
+	}{
+		{ch: small, want: false},
+		{ch: large, want: true},
+	} {
+		has, err := db.backend.Has(tc.ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != tc.want {
+			t.Errorf("got chunk of size %v in backend %v, want %v", len(tc.ch.Data()), has, tc.want)
+		}
+		got, err := db.Get(context.Background(), chunk.ModeGetRequest, tc.ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), tc.ch.Data()) {
+			t.Errorf("got data of chunk of size %v %x, want %x", len(tc.ch.Data()), got.Data(), tc.ch.Data())
+		}
+	}
+
+	if err := db.Set(context.Background(), chunk.ModeSetRemove, large.Address()); err != nil {
+		t.Fatal(err)
+	}
+	has, err := db.backend.Has(large.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("got removed chunk in backend")
+	}
+}
+
+// TestDB_MigrateBackend validates that the data of chunks is moved between
+// backends and stays retrievable.
+func TestDB_MigrateBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localstore-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	baseKey := make([]byte, 32)
+
+	var chunks []chunk.Chunk
+	for i := 0; i < 10; i++ {
+		chunks = append(chunks, generateTestRandomChunkOfSize(BackendMinSize+i))
+	}
+	chunks = append(chunks, generateTestRandomChunkOfSize(BackendMinSize/2))
+
+	migrate := func(backend string, put bool, wantMoved int) {
+		db, err := New(dir, baseKey, &Options{Backend: backend})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if put {
+			if _, err := db.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		moved, err := db.MigrateBackend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != wantMoved {
+			t.Errorf("%s: got %v chunks moved, want %v", backend, moved, wantMoved)
+		}
+		for _, ch := range chunks {
+			got, err := db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Data(), ch.Data()) {
+				t.Errorf("%s: got data %x, want %x", backend, got.Data(), ch.Data())
+			}
+		}
+	}
+
+	migrate(BackendLevelDB, true, 0)
+	migrate(BackendFiles, false, 10)
+	migrate(BackendFiles, false, 0)
+	migrate(BackendLevelDB, false, 10)
+	migrate(BackendLevelDB, false, 0)
+}
+
+// TestS3Backend validates the requests of the S3Backend against a fake
+// S3 service checking the credential scope of the signatures.
+func TestS3Backend(t *testing.T) {
+	var (
+		objects = make(map[string][]byte)
+		mu      sync.Mutex
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+			http.Error(w, "invalid authorization "+auth, http.StatusForbidden)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/chunks/") {
+			http.Error(w, "no such bucket", http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet, http.MethodHead:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewS3Backend(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "chunks",
+		Region:    "eu-west-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := generateTestRandomChunk()
+	if _, err := b.Get(ch.Address()); err != leveldb.ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, leveldb.ErrNotFound)
+	}
+	if err := b.Put(ch.Address(), ch.Data()); err != nil {
+		t.Fatal(err)
+	}
+	has, err := b.Has(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Error("stored chunk not found")
+	}
+	data, err := b.Get(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, ch.Data()) {
+		t.Errorf("got data %x, want %x", data, ch.Data())
+	}
+	if err := b.Delete(ch.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := b.Has(ch.Address()); err != nil || has {
+		t.Errorf("got deleted chunk stored %v, err %v", has, err)
+	}
+}
+
+// generateTestRandomChunkOfSize returns a chunk with random
+// address and data of the size.
+func generateTestRandomChunkOfSize(size int) chunk.Chunk {
+	data := make([]byte, size)
+	rand.Read(data)
+	key := make([]byte, 32)
+	rand.Read(key)
+	return chunk.NewChunk(key, data)
+}
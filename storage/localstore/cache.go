@@ -0,0 +1,186 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// ErrInvalidCacheCapacity is returned when the chunk cache is resized to a negative capacity
+var ErrInvalidCacheCapacity = errors.New("invalid chunk cache capacity")
+
+// CacheStats are the statistics of the in-memory chunk cache of the localstore
+type CacheStats struct {
+	Capacity int     `json:"capacity"` // maximal number of cached chunks, 0 if disabled
+	Size     int     `json:"size"`     // number of cached chunks
+	Hits     uint64  `json:"hits"`     // number of reads served from the cache since start
+	Misses   uint64  `json:"misses"`   // number of reads served from the database since start
+	HitRate  float64 `json:"hitRate"`  // ratio of hits to reads
+}
+
+// chunkCache keeps the retrieval index items of recently served chunks in memory with
+// the adaptive replacement policy, which favours chunks read repeatedly over chunks read
+// once, so that a single large download does not evict the popular chunks
+type chunkCache struct {
+	arc      *lru.ARCCache // nil if disabled
+	capacity int
+	removals uint64 // number of removals from the cache, guarded by mu
+	mu       sync.RWMutex
+	hits     uint64
+	misses   uint64
+}
+
+// newChunkCache creates a chunkCache of the capacity, disabled if it is 0
+func newChunkCache(capacity int) (*chunkCache, error) {
+	c := new(chunkCache)
+	if err := c.resize(capacity); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// get returns the cached item of the chunk with the address
+func (c *chunkCache) get(addr chunk.Address) (item shed.Item, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.arc == nil {
+		return item, false
+	}
+	v, ok := c.arc.Get(string(addr))
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		metrics.GetOrRegisterCounter("localstore/cache/miss", nil).Inc(1)
+		return item, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	metrics.GetOrRegisterCounter("localstore/cache/hit", nil).Inc(1)
+	return v.(shed.Item), true
+}
+
+// generation returns the number of removals from the cache, to be passed
+// to add with the items read from the database after it is called
+func (c *chunkCache) generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.removals
+}
+
+// add caches the retrieval index item of a served chunk read in the generation,
+// unless chunks were removed since as the item may be one of them
+func (c *chunkCache) add(item shed.Item, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.arc == nil || c.removals != generation {
+		return
+	}
+	item.AccessTimestamp = 0
+	c.arc.Add(string(item.Address), item)
+}
+
+// remove evicts the chunks with the addresses removed from the localstore
+func (c *chunkCache) remove(addrs ...chunk.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removals++
+	if c.arc == nil {
+		return
+	}
+	for _, addr := range addrs {
+		c.arc.Remove(string(addr))
+	}
+}
+
+// resize changes the capacity of the cache keeping the most recently
+// used chunks that fit, a capacity of 0 disables the cache
+func (c *chunkCache) resize(capacity int) error {
+	if capacity < 0 {
+		return ErrInvalidCacheCapacity
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if capacity == 0 {
+		c.arc, c.capacity = nil, 0
+		return nil
+	}
+	arc, err := lru.NewARC(capacity)
+	if err != nil {
+		return err
+	}
+	if c.arc != nil {
+		// keys are ordered from the least to the most recently used,
+		// the ones used more than once after the ones used once
+		keys := c.arc.Keys()
+		if len(keys) > capacity {
+			keys = keys[len(keys)-capacity:]
+		}
+		for _, k := range keys {
+			if v, ok := c.arc.Peek(k); ok {
+				arc.Add(k, v)
+			}
+		}
+	}
+	c.arc, c.capacity = arc, capacity
+	return nil
+}
+
+// flush evicts all chunks from the cache
+func (c *chunkCache) flush() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.arc != nil {
+		c.arc.Purge()
+	}
+}
+
+// stats returns the statistics of the cache
+func (c *chunkCache) stats() (s CacheStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s.Capacity = c.capacity
+	if c.arc != nil {
+		s.Size = c.arc.Len()
+	}
+	s.Hits = atomic.LoadUint64(&c.hits)
+	s.Misses = atomic.LoadUint64(&c.misses)
+	if reads := s.Hits + s.Misses; reads > 0 {
+		s.HitRate = float64(s.Hits) / float64(reads)
+	}
+	return s
+}
+
+// CacheStats returns the statistics of the in-memory chunk cache
+func (db *DB) CacheStats() CacheStats {
+	return db.cache.stats()
+}
+
+// ResizeCache changes the number of chunks kept in the in-memory
+// chunk cache, a capacity of 0 disables it
+func (db *DB) ResizeCache(capacity int) error {
+	return db.cache.resize(capacity)
+}
+
+// FlushCache evicts all chunks from the in-memory chunk cache
+func (db *DB) FlushCache() {
+	db.cache.flush()
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// TestDB_cache validates that read chunks are served from the in-memory
+// cache, evicted when removed and that the cache is resized and flushed.
+func TestDB_cache(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{CacheCapacity: 10})
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(20)
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		for _, ch := range chunks[:5] {
+			got, err := db.Get(context.Background(), chunk.ModeGetLookup, ch.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Data(), ch.Data()) {
+				t.Fatalf("got data %x, want %x", got.Data(), ch.Data())
+			}
+		}
+	}
+	s := db.CacheStats()
+	if s.Size != 5 || s.Hits != 5 || s.Misses != 5 || s.HitRate != 0.5 {
+		t.Errorf("got cache stats %+v, want size 5, 5 hits and misses", s)
+	}
+
+	if err := db.Set(context.Background(), chunk.ModeSetRemove, chunks[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, chunks[0].Address()); err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+
+	// the cache keeps the most recently used chunks when shrunk
+	if err := db.ResizeCache(2); err != nil {
+		t.Fatal(err)
+	}
+	s = db.CacheStats()
+	if s.Capacity != 2 || s.Size != 2 {
+		t.Errorf("got cache capacity %v and size %v, want 2", s.Capacity, s.Size)
+	}
+	if _, ok := db.cache.get(chunks[4].Address()); !ok {
+		t.Error("most recently used chunk not cached")
+	}
+
+	db.FlushCache()
+	if s := db.CacheStats(); s.Size != 0 {
+		t.Errorf("got cache size %v after flush, want 0", s.Size)
+	}
+
+	if err := db.ResizeCache(-1); err != ErrInvalidCacheCapacity {
+		t.Errorf("got error %v, want %v", err, ErrInvalidCacheCapacity)
+	}
+	if err := db.ResizeCache(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, chunks[1].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if s := db.CacheStats(); s.Capacity != 0 || s.Size != 0 {
+		t.Errorf("got disabled cache capacity %v and size %v, want 0", s.Capacity, s.Size)
+	}
+}
+
+// TestDB_cacheRemoved validates that a chunk read from the database
+// is not cached if chunks are removed before it is added to the cache.
+func TestDB_cacheRemoved(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{CacheCapacity: 10})
+	defer cleanupFunc()
+
+	ch := generateTestRandomChunk()
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	// the chunk is read before it is removed and added to the cache after
+	generation := db.cache.generation()
+	item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(context.Background(), chunk.ModeSetRemove, ch.Address()); err != nil {
+		t.Fatal(err)
+	}
+	db.cache.add(item, generation)
+
+	if _, ok := db.cache.get(ch.Address()); ok {
+		t.Error("removed chunk cached")
+	}
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, ch.Address()); err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// streamExportMagic starts the stream export format, followed by
+// the version byte and the records of chunks until the end of the stream.
+// A record is the uvarint length prefixed address and data of the chunk
+// and the uvarint pin counter of the chunk, 0 if it is not pinned.
+var streamExportMagic = []byte("swarm-chunks")
+
+const (
+	// current stream export format version
+	streamExportVersion byte = 1
+	// maximal length of the chunk data in a stream export record
+	maxStreamExportDataLength = chunk.DefaultSize + 8
+)
+
+// gzipMagic starts gzip compressed streams
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ErrInvalidStreamExport is returned by ImportStream if
+// the data is not in the stream export format.
+var ErrInvalidStreamExport = errors.New("invalid stream export")
+
+// ExportOptions selects the chunks written by ExportStream and compresses the stream.
+type ExportOptions struct {
+	// Pinned exports only pinned chunks, with their pin counters.
+	Pinned bool
+	// MinPO and MaxPO limit the exported chunks to the proximity
+	// order range to the base key, inclusive. MaxPO 0 is chunk.MaxPO.
+	MinPO uint8
+	MaxPO uint8
+	// Since exports only chunks stored at or after the Unix time in nanoseconds.
+	Since int64
+	// Gzip compresses the stream.
+	Gzip bool
+}
+
+// ExportStream writes the chunks selected by the options to the writer in the
+// length prefixed stream export format, which, unlike the tar archive of Export,
+// keeps the pin counters. It returns the number of chunks exported.
+func (db *DB) ExportStream(w io.Writer, o *ExportOptions) (count int64, err error) {
+	if o == nil {
+		o = new(ExportOptions)
+	}
+	maxPO := o.MaxPO
+	if maxPO == 0 {
+		maxPO = chunk.MaxPO
+	}
+	if o.Gzip {
+		gw := gzip.NewWriter(w)
+		defer func() {
+			if e := gw.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = gw
+	}
+	bw := bufio.NewWriter(w)
+	defer func() {
+		if e := bw.Flush(); err == nil {
+			err = e
+		}
+	}()
+	if _, err := bw.Write(streamExportMagic); err != nil {
+		return 0, err
+	}
+	if err := bw.WriteByte(streamExportVersion); err != nil {
+		return 0, err
+	}
+
+	write := func(item shed.Item, pinCounter uint64) error {
+		if po := db.po(item.Address); po < o.MinPO || po > maxPO {
+			return nil
+		}
+		if item.StoreTimestamp < o.Since {
+			return nil
+		}
+		buf := make([]byte, binary.MaxVarintLen64)
+		for _, b := range [][]byte{item.Address, item.Data} {
+			if _, err := bw.Write(buf[:binary.PutUvarint(buf, uint64(len(b)))]); err != nil {
+				return err
+			}
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+		if _, err := bw.Write(buf[:binary.PutUvarint(buf, pinCounter)]); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	if o.Pinned {
+		err = db.pinIndex.Iterate(func(pin shed.Item) (stop bool, err error) {
+			item, err := db.retrievalDataIndex.Get(pin)
+			switch err {
+			case nil:
+			case leveldb.ErrNotFound:
+				// pinned chunks might not be stored yet
+				return false, nil
+			default:
+				return true, err
+			}
+			return false, write(item, pin.PinCounter)
+		}, nil)
+		return count, err
+	}
+	err = db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		var pinCounter uint64
+		pin, err := db.pinIndex.Get(item)
+		switch err {
+		case nil:
+			pinCounter = pin.PinCounter
+		case leveldb.ErrNotFound:
+		default:
+			return true, err
+		}
+		return false, write(item, pinCounter)
+	}, nil)
+	return count, err
+}
+
+// IsStreamExport returns whether the reader starts with the stream export format
+// rather than a tar archive of Export, peeking at the data without consuming it.
+// Gzip compressed data is assumed to be a stream export.
+func IsStreamExport(r *bufio.Reader) bool {
+	if b, err := r.Peek(len(gzipMagic)); err == nil && bytes.Equal(b, gzipMagic) {
+		return true
+	}
+	b, err := r.Peek(len(streamExportMagic))
+	return err == nil && bytes.Equal(b, streamExportMagic)
+}
+
+// ImportStream reads chunks in the stream export format, optionally gzip
+// compressed, from the reader, stores them in the database and pins them
+// as they were pinned when exported. It returns the number of chunks imported.
+func (db *DB) ImportStream(r io.Reader) (count int64, err error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(b, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gr.Close()
+		br = bufio.NewReader(gr)
+	}
+
+	header := make([]byte, len(streamExportMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, ErrInvalidStreamExport
+	}
+	if !bytes.Equal(header[:len(streamExportMagic)], streamExportMagic) {
+		return 0, ErrInvalidStreamExport
+	}
+	if v := header[len(streamExportMagic)]; v != streamExportVersion {
+		return 0, fmt.Errorf("unsupported stream export version %v", v)
+	}
+
+	ctx := context.Background()
+	chs := make([]chunk.Chunk, 0, PutBatchSize)
+	pins := make(map[string]uint64)
+	flush := func() error {
+		if len(chs) == 0 {
+			return nil
+		}
+		if _, err := db.PutBatch(ctx, chunk.ModePutUpload, chs); err != nil {
+			return err
+		}
+		for _, ch := range chs {
+			for i := uint64(0); i < pins[string(ch.Address())]; i++ {
+				if err := db.Set(ctx, chunk.ModeSetPin, ch.Address()); err != nil {
+					return err
+				}
+			}
+		}
+		count += int64(len(chs))
+		chs = chs[:0]
+		pins = make(map[string]uint64)
+		return nil
+	}
+
+	for {
+		addr, err := readStreamExportField(br, chunk.AddressLength)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		data, err := readStreamExportField(br, maxStreamExportDataLength)
+		if err != nil {
+			return count, unexpectedEOF(err)
+		}
+		pinCounter, err := binary.ReadUvarint(br)
+		if err != nil {
+			return count, unexpectedEOF(err)
+		}
+		chs = append(chs, chunk.NewChunk(addr, data))
+		if pinCounter > 0 {
+			pins[string(addr)] = pinCounter
+		}
+		if len(chs) == PutBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// readStreamExportField reads a uvarint length prefixed field of at most
+// max bytes, returning io.EOF only if the stream ends before the field.
+func readStreamExportField(r *bufio.Reader, max uint64) (field []byte, err error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > max {
+		return nil, ErrInvalidStreamExport
+	}
+	field = make([]byte, l)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return field, nil
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF
+// as the stream ended in the middle of a record.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
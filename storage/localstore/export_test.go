@@ -17,11 +17,14 @@
 package localstore
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"io/ioutil"
 	"testing"
 
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // TestExportImport constructs two databases, one to put and export
@@ -78,3 +81,105 @@ func TestExportImport(t *testing.T) {
 		}
 	}
 }
+
+// TestExportImportStream validates that chunks exported in the stream
+// format are imported with their pin counters, with and without compression,
+// and that the export filters select the chunks.
+func TestExportImportStream(t *testing.T) {
+	db1, cleanup1 := newTestDB(t, nil)
+	defer cleanup1()
+
+	chunks := generateTestRandomChunks(100)
+	if _, err := db1.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range chunks[:10] {
+		if err := db1.Set(context.Background(), chunk.ModeSetPin, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db1.Set(context.Background(), chunk.ModeSetPin, chunks[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gzip := range []bool{false, true} {
+		var buf bytes.Buffer
+		c, err := db1.ExportStream(&buf, &ExportOptions{Gzip: gzip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != 100 {
+			t.Errorf("got export count %v, want 100", c)
+		}
+		if !IsStreamExport(bufio.NewReader(bytes.NewReader(buf.Bytes()))) {
+			t.Error("stream export not detected")
+		}
+
+		db2, cleanup2 := newTestDB(t, nil)
+		c, err = db2.ImportStream(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != 100 {
+			t.Errorf("got import count %v, want 100", c)
+		}
+		for i, ch := range chunks {
+			got, err := db2.Get(context.Background(), chunk.ModeGetLookup, ch.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Data(), ch.Data()) {
+				t.Fatalf("chunk %s: got data %x, want %x", ch.Address().Hex(), got.Data(), ch.Data())
+			}
+			var want uint64
+			switch {
+			case i == 0:
+				want = 2
+			case i < 10:
+				want = 1
+			}
+			pin, err := db2.pinIndex.Get(addressToItem(ch.Address()))
+			if err != nil && err != leveldb.ErrNotFound {
+				t.Fatal(err)
+			}
+			if pin.PinCounter != want {
+				t.Errorf("chunk %v: got pin counter %v, want %v", i, pin.PinCounter, want)
+			}
+		}
+		cleanup2()
+	}
+
+	c, err := db1.ExportStream(ioutil.Discard, &ExportOptions{Pinned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 10 {
+		t.Errorf("got pinned export count %v, want 10", c)
+	}
+
+	var want int64
+	for _, ch := range chunks {
+		if po := db1.po(ch.Address()); po >= 1 && po <= 2 {
+			want++
+		}
+	}
+	c, err = db1.ExportStream(ioutil.Discard, &ExportOptions{MinPO: 1, MaxPO: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != want {
+		t.Errorf("got proximity order range export count %v, want %v", c, want)
+	}
+
+	c, err = db1.ExportStream(ioutil.Discard, &ExportOptions{Since: now() + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 {
+		t.Errorf("got export count %v of chunks stored since now, want 0", c)
+	}
+
+	if _, err := db1.ImportStream(bytes.NewReader([]byte("not a stream export"))); err != ErrInvalidStreamExport {
+		t.Errorf("got error %v, want %v", err, ErrInvalidStreamExport)
+	}
+}
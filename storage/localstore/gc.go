@@ -21,6 +21,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/events"
 	"github.com/ethersphere/swarm/shed"
 	"github.com/syndtr/goleveldb/leveldb"
 )
@@ -53,9 +55,26 @@ func (db *DB) collectGarbageWorker() {
 			// run a single collect garbage run and
 			// if done is false, gcBatchSize is reached and
 			// another collect garbage run is needed
+			start := time.Now()
 			collectedCount, done, err := db.collectGarbage()
 			if err != nil {
 				log.Error("localstore collect garbage", "err", err)
+			} else if db.events != nil {
+				size, _ := db.gcSize.Get()
+				db.events.Publish(events.GCRun, &events.GCData{
+					Collected: collectedCount,
+					Size:      size,
+					Duration:  time.Since(start),
+				})
+			}
+			// move the least recently accessed chunks to the cold
+			// tier if the hot tier is over its capacity
+			if db.cold != nil {
+				_, spillDone, err := db.spillCold()
+				if err != nil {
+					log.Error("localstore spill to cold tier", "err", err)
+				}
+				done = done && spillDone
 			}
 			// check if another gc run is needed
 			if !done {
@@ -73,6 +92,7 @@ func (db *DB) collectGarbageWorker() {
 
 // collectGarbage removes chunks from retrieval and other
 // indexes if maximal number of chunks in database is reached.
+// Chunks without postage stamps are removed before the stamped ones.
 // This function returns the number of removed chunks. If done
 // is false, another call to this function is needed to collect
 // the rest of the garbage as the batch size limit is reached.
@@ -109,19 +129,29 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 	metrics.GetOrRegisterGauge(metricName+"/gcsize", nil).Update(int64(gcSize))
 
 	done = true
-	err = db.gcIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+	var collected []chunk.Address
+	// addresses of the collected chunks, as the chunks collected from the gc index
+	// of unstamped chunks are also iterated in the gc index
+	collectedAddrs := make(map[string]struct{})
+	collect := func(item shed.Item) (stop bool, err error) {
 		if gcSize-collectedCount <= target {
 			return true, nil
 		}
+		if _, ok := collectedAddrs[string(item.Address)]; ok {
+			return false, nil
+		}
 
 		metrics.GetOrRegisterGauge(metricName+"/storets", nil).Update(item.StoreTimestamp)
 		metrics.GetOrRegisterGauge(metricName+"/accessts", nil).Update(item.AccessTimestamp)
 
-		// delete from retrieve, pull, gc
+		// delete from retrieve, pull, gc, stamp
 		db.retrievalDataIndex.DeleteInBatch(batch, item)
 		db.retrievalAccessIndex.DeleteInBatch(batch, item)
 		db.pullIndex.DeleteInBatch(batch, item)
-		db.gcIndex.DeleteInBatch(batch, item)
+		db.deleteGCInBatch(batch, item)
+		db.stampIndex.DeleteInBatch(batch, item)
+		collected = append(collected, item.Address)
+		collectedAddrs[string(item.Address)] = struct{}{}
 		collectedCount++
 		if collectedCount >= gcBatchSize {
 			// bach size limit reached,
@@ -130,19 +160,37 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 			return true, nil
 		}
 		return false, nil
-	}, nil)
+	}
+	// chunks without postage stamps are collected first, stamped chunks only
+	// if the target is not reached when the unstamped ones are used up, in
+	// which case at most the chunks collected in this run are skipped
+	err = db.gcUnstampedIndex.Iterate(collect, nil)
 	if err != nil {
 		return 0, false, err
 	}
+	if done && gcSize-collectedCount > target {
+		err = db.gcIndex.Iterate(collect, nil)
+		if err != nil {
+			return 0, false, err
+		}
+	}
 	metrics.GetOrRegisterCounter(metricName+"/collected-count", nil).Inc(int64(collectedCount))
 
 	db.gcSize.PutInBatch(batch, gcSize-collectedCount)
 
+	coldCollected, err := db.removeColdInBatch(batch, collected)
+	if err != nil {
+		return 0, false, err
+	}
+
 	err = db.shed.WriteBatch(batch)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/writebatch/err", nil).Inc(1)
 		return 0, false, err
 	}
+	db.cache.remove(collected...)
+	db.deleteBackendData(collected)
+	db.deleteColdData(coldCollected)
 	return collectedCount, done, nil
 }
 
@@ -178,7 +226,7 @@ func (db *DB) removeChunksInExcludeIndexFromGC() (err error) {
 		// Check if this item is in gcIndex and remove it
 		ok, err := db.gcIndex.Has(item)
 		if ok {
-			db.gcIndex.DeleteInBatch(batch, item)
+			db.deleteGCInBatch(batch, item)
 			if _, err := db.gcIndex.Get(item); err == nil {
 				gcSizeChange--
 			}
@@ -224,6 +272,33 @@ func (db *DB) triggerGarbageCollection() {
 	}
 }
 
+// putGCInBatch adds the item to the gc index and, if the chunk has no
+// postage stamp, to the gc index of unstamped chunks. This function
+// must be called under batchMu lock.
+func (db *DB) putGCInBatch(batch *leveldb.Batch, item shed.Item) (err error) {
+	if err := db.gcIndex.PutInBatch(batch, item); err != nil {
+		return err
+	}
+	stamped := item.Stamp != nil
+	if !stamped {
+		stamped, err = db.stampIndex.Has(item)
+		if err != nil {
+			return err
+		}
+	}
+	if stamped {
+		return nil
+	}
+	return db.gcUnstampedIndex.PutInBatch(batch, item)
+}
+
+// deleteGCInBatch removes the item from the gc indexes.
+// This function must be called under batchMu lock.
+func (db *DB) deleteGCInBatch(batch *leveldb.Batch, item shed.Item) {
+	db.gcIndex.DeleteInBatch(batch, item)
+	db.gcUnstampedIndex.DeleteInBatch(batch, item)
+}
+
 // incGCSizeInBatch changes gcSize field value
 // by change which can be negative. This function
 // must be called under batchMu lock.
@@ -254,6 +329,14 @@ func (db *DB) incGCSizeInBatch(batch *leveldb.Batch, change int64) (err error) {
 	// trigger garbage collection if we reached the capacity
 	if new >= db.capacity {
 		db.triggerGarbageCollection()
+		return nil
+	}
+	over, err := db.hotOverCapacity(new)
+	if err != nil {
+		return err
+	}
+	if over {
+		db.triggerGarbageCollection()
 	}
 	return nil
 }
@@ -291,6 +291,90 @@ func TestGCAfterPin(t *testing.T) {
 	}
 }
 
+// TestStampedGC tests that chunks with postage stamps are garbage collected
+// after the chunks without stamps, even if they are older
+func TestStampedGC(t *testing.T) {
+	chunkCount := 150
+	stampedCount := 50
+
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity: 100,
+	})
+	testHookCollectGarbageChan := make(chan uint64)
+	defer setTestHookCollectGarbage(func(collectedCount uint64) {
+		select {
+		case testHookCollectGarbageChan <- collectedCount:
+		case <-db.close:
+		}
+	})()
+	defer cleanupFunc()
+
+	stamp := make([]byte, 97)
+	addrs := make([]chunk.Address, 0)
+	for i := 0; i < chunkCount; i++ {
+		ch := generateTestRandomChunk()
+		if i < stampedCount {
+			ch = ch.WithStamp(stamp)
+		}
+
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addrs = append(addrs, ch.Address())
+	}
+
+	gcTarget := db.gcTarget()
+
+	for {
+		select {
+		case <-testHookCollectGarbageChan:
+		case <-time.After(10 * time.Second):
+			t.Fatal("collect garbage timeout")
+		}
+		gcSize, err := db.gcSize.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gcSize == gcTarget {
+			break
+		}
+	}
+
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, int(gcTarget)))
+
+	t.Run("unstamped gc index count", newItemsCountTest(db.gcUnstampedIndex, int(gcTarget)-stampedCount))
+
+	t.Run("stamped chunks are not removed", func(t *testing.T) {
+		for i := 0; i < stampedCount; i++ {
+			ch, err := db.Get(context.Background(), chunk.ModeGetRequest, addrs[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ch.Stamp(), stamp) {
+				t.Fatalf("got stamp %x, want %x", ch.Stamp(), stamp)
+			}
+		}
+	})
+
+	t.Run("oldest unstamped chunks are removed", func(t *testing.T) {
+		for i := stampedCount; i < stampedCount+chunkCount-int(gcTarget); i++ {
+			_, err := db.Get(context.Background(), chunk.ModeGetRequest, addrs[i])
+			if err != chunk.ErrChunkNotFound {
+				t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+			}
+		}
+	})
+
+	t.Run("stamp index count", newItemsCountTest(db.stampIndex, stampedCount))
+}
+
 // TestDB_collectGarbageWorker_withRequests is a helper test function
 // to test garbage collection runs by uploading, syncing and
 // requesting a number of chunks.
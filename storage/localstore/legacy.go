@@ -0,0 +1,187 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	// key prefixes of the LDBStore layout used before the localstore
+	legacyKeyIndex = byte(0)
+	legacyKeyData  = byte(6)
+
+	// suffixes of the chunk database directories during and after a legacy migration
+	legacyMigratingSuffix = ".migrating"
+	legacyBackupSuffix    = ".legacy"
+
+	// number of chunks imported in one batch
+	legacyImportBatchSize = 128
+)
+
+// legacyIndex is the value of the legacy retrieval index
+type legacyIndex struct {
+	Idx    uint64 // storage index of the chunk data
+	Access uint64 // access counter used for garbage collection
+}
+
+// LegacyChunk is a chunk read from a legacy database with its access counter
+type LegacyChunk struct {
+	chunk.Chunk
+	Access uint64
+}
+
+// IterateLegacy calls f with the chunks of the legacy database at path with the base key,
+// in the order of their access counters, so that the least recently accessed come first
+// chunks which can not be read are skipped
+func IterateLegacy(path string, baseKey []byte, f func(LegacyChunk) error) error {
+	db, err := leveldb.OpenFile(path, &opt.Options{OpenFilesCacheCapacity: 128, ErrorIfMissing: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	type entry struct {
+		addr  chunk.Address
+		index legacyIndex
+	}
+	var entries []entry
+	it := db.NewIterator(nil, nil)
+	for ok := it.Seek([]byte{legacyKeyIndex}); ok; ok = it.Next() {
+		key := it.Key()
+		if len(key) == 0 || key[0] != legacyKeyIndex {
+			break
+		}
+		var index legacyIndex
+		if err := rlp.DecodeBytes(it.Value(), &index); err != nil {
+			log.Warn("skipping legacy chunk with invalid index", "key", fmt.Sprintf("%x", key), "err", err)
+			continue
+		}
+		entries = append(entries, entry{addr: append(chunk.Address(nil), key[1:]...), index: index})
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].index.Access < entries[j].index.Access
+	})
+
+	for _, e := range entries {
+		data, err := db.Get(legacyDataKey(e.index.Idx, uint8(chunk.Proximity(baseKey, e.addr))), nil)
+		if err != nil {
+			log.Warn("skipping legacy chunk which can not be read", "ref", e.addr, "err", err)
+			continue
+		}
+		// the data of chunks is prefixed with their address
+		if len(data) < len(e.addr) || !bytes.Equal(data[:len(e.addr)], e.addr) {
+			log.Warn("skipping legacy chunk with mismatching data", "ref", e.addr)
+			continue
+		}
+		if err := f(LegacyChunk{Chunk: chunk.NewChunk(e.addr, data[len(e.addr):]), Access: e.index.Access}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyDataKey returns the key of the chunk data with the storage index in the proximity order bin
+func legacyDataKey(idx uint64, po uint8) []byte {
+	key := make([]byte, 10)
+	key[0] = legacyKeyData
+	key[1] = po
+	binary.BigEndian.PutUint64(key[2:], idx)
+	return key
+}
+
+// ImportLegacy stores the chunks of the legacy database at path with the base key
+// it returns the number of chunks imported
+// the chunks are synced to the neighbourhood and put in the garbage collection index
+// in the order they were last accessed in the legacy database
+func (db *DB) ImportLegacy(path string, baseKey []byte) (count int64, err error) {
+	batch := make([]chunk.Chunk, 0, legacyImportBatchSize)
+	put := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := db.Put(context.Background(), chunk.ModePutSync, batch...); err != nil {
+			return err
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	err = IterateLegacy(path, baseKey, func(c LegacyChunk) error {
+		batch = append(batch, c.Chunk)
+		if len(batch) < legacyImportBatchSize {
+			return nil
+		}
+		return put()
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, put()
+}
+
+// MigrateLegacyDatadir imports the chunks of the legacy database at path into a new
+// database created at the same path, the legacy database is kept as a backup
+// in the directory with the legacyBackupSuffix appended, which is returned
+// the chunks are imported into a separate directory first so that an interrupted
+// migration leaves the legacy database in place to be migrated again
+func MigrateLegacyDatadir(path string, baseKey []byte, o *Options) (backup string, count int64, err error) {
+	migrating := path + legacyMigratingSuffix
+	backup = path + legacyBackupSuffix
+	if _, err := os.Stat(backup); err == nil {
+		return "", 0, fmt.Errorf("legacy database backup %s already exists", backup)
+	}
+	// remove leftovers of an interrupted migration
+	if err := os.RemoveAll(migrating); err != nil {
+		return "", 0, err
+	}
+
+	db, err := New(migrating, baseKey, o)
+	if err != nil {
+		return "", 0, err
+	}
+	count, err = db.ImportLegacy(path, baseKey)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", count, fmt.Errorf("import legacy database: %v", err)
+	}
+
+	if err := os.Rename(path, backup); err != nil {
+		return "", count, err
+	}
+	if err := os.Rename(migrating, path); err != nil {
+		return "", count, err
+	}
+	return backup, count, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// TestMigrateLegacyDatadir writes chunks in the layout of the legacy LDBStore
+// and validates that all of them are migrated and the legacy database is kept.
+func TestMigrateLegacyDatadir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localstore-legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chunks")
+	baseKey := make([]byte, 32)
+
+	ldb, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ldb.Put([]byte{8}, []byte("purity"), nil); err != nil {
+		t.Fatal(err)
+	}
+	chunks := make([]chunk.Chunk, 10)
+	for i := range chunks {
+		ch := generateTestRandomChunk()
+		chunks[i] = ch
+		index, err := rlp.EncodeToBytes(&legacyIndex{Idx: uint64(i), Access: uint64(len(chunks) - i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ldb.Put(append([]byte{legacyKeyIndex}, ch.Address()...), index, nil); err != nil {
+			t.Fatal(err)
+		}
+		po := uint8(chunk.Proximity(baseKey, ch.Address()))
+		if err := ldb.Put(legacyDataKey(uint64(i), po), append(ch.Address(), ch.Data()...), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ldb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsLegacyDatabase(path) {
+		t.Fatal("legacy database not detected")
+	}
+
+	var got []chunk.Address
+	err = IterateLegacy(path, baseKey, func(c LegacyChunk) error {
+		got = append(got, c.Address())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the chunks are iterated from the least recently accessed
+	for i, addr := range got {
+		want := chunks[len(chunks)-1-i].Address()
+		if !bytes.Equal(addr, want) {
+			t.Fatalf("got chunk %v at %v, want %v", addr, i, want)
+		}
+	}
+
+	backup, count, err := MigrateLegacyDatadir(path, baseKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(chunks)) {
+		t.Errorf("got migrated count %v, want %v", count, len(chunks))
+	}
+	if backup != path+legacyBackupSuffix || !IsLegacyDatabase(backup) {
+		t.Errorf("legacy database not kept as backup in %s", backup)
+	}
+	if IsLegacyDatabase(path) {
+		t.Fatal("migrated database detected as legacy")
+	}
+
+	db, err := New(path, baseKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, ch := range chunks {
+		got, err := db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("chunk %v: got data %x, want %x", ch.Address(), got.Data(), ch.Data())
+		}
+	}
+
+	if _, _, err := MigrateLegacyDatadir(path, baseKey, nil); err == nil {
+		t.Error("migration with an existing backup did not fail")
+	}
+}
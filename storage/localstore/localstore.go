@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/events"
 	"github.com/ethersphere/swarm/shed"
 	"github.com/ethersphere/swarm/storage/mock"
 )
@@ -55,8 +56,9 @@ var (
 // DB is the local store implementation and holds
 // database related objects.
 type DB struct {
-	shed *shed.DB
-	tags *chunk.Tags
+	shed   *shed.DB
+	tags   *chunk.Tags
+	events *events.Bus // bus the garbage collection runs are published on, nil for none
 
 	// schema name of loaded data
 	schemaName shed.StringField
@@ -82,6 +84,9 @@ type DB struct {
 
 	// garbage collection index
 	gcIndex shed.Index
+	// garbage collection index of the chunks without postage stamps,
+	// a subset of gcIndex with the same keys collected first
+	gcUnstampedIndex shed.Index
 
 	// garbage collection exclude index for pinned contents
 	gcExcludeIndex shed.Index
@@ -89,6 +94,37 @@ type DB struct {
 	// pin files Index
 	pinIndex shed.Index
 
+	// postage stamps of chunks, chunks with stamps
+	// are garbage collected after the ones without
+	stampIndex shed.Index
+
+	// backend storing the data of chunks outside of the LevelDB,
+	// nil if no data is stored in one
+	backend Backend
+	// backendWrites is true if the data of new chunks is
+	// stored in the backend
+	backendWrites bool
+
+	// cold tier storing the data of the least recently
+	// accessed chunks, nil if not configured
+	cold Backend
+	// chunks with the data in the cold tier
+	coldIndex shed.Index
+	// field that stores number of items in cold index
+	coldSize shed.Uint64Field
+	// number of garbage collectable chunks stored locally
+	// above which chunks are moved to the cold tier
+	hotCapacity uint64
+	// number of chunks moved to and from the cold tier
+	spilled  uint64
+	recalled uint64
+
+	// in-memory cache of recently read chunks
+	cache *chunkCache
+
+	// data of the corrupted chunks found by Verify
+	quarantineIndex shed.Index
+
 	// field that stores number of intems in gc index
 	gcSize shed.Uint64Field
 
@@ -141,11 +177,26 @@ type Options struct {
 	Capacity uint64
 	// MetricsPrefix defines a prefix for metrics names.
 	MetricsPrefix string
-	Tags          *chunk.Tags
+	// CacheCapacity is the number of recently read chunks kept
+	// in memory, the cache is disabled if it is zero.
+	CacheCapacity uint
+	// Backend is the name of the backend storing the data of chunks,
+	// BackendLevelDB if empty.
+	Backend string
+	// ColdTier stores the data of the least recently accessed chunks
+	// when more than HotCapacity garbage collectable chunks are stored
+	// locally. It is not used with MockStore and closed with the DB.
+	ColdTier Backend
+	// HotCapacity is the part of Capacity kept locally with ColdTier,
+	// half of Capacity if zero.
+	HotCapacity uint64
+	Tags        *chunk.Tags
 	// PutSetCheckFunc is a function called after a Put of a chunk
 	// to verify whether that chunk needs to be Set and added to
 	// garbage collection index too
 	PutToGCCheck func([]byte) bool
+	// Events is the bus the garbage collection runs are published on.
+	Events *events.Bus
 }
 
 // New returns a new DB.  All fields and indexes are initialized
@@ -167,6 +218,7 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		capacity: o.Capacity,
 		baseKey:  baseKey,
 		tags:     o.Tags,
+		events:   o.Events,
 		// channel collectGarbageTrigger
 		// needs to be buffered with the size of 1
 		// to signal another event if it
@@ -216,6 +268,21 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	if err != nil {
 		return nil, err
 	}
+	db.cache, err = newChunkCache(int(o.CacheCapacity))
+	if err != nil {
+		return nil, err
+	}
+	db.backend, db.backendWrites, err = openBackend(path, o.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if o.MockStore == nil && o.ColdTier != nil {
+		db.cold = o.ColdTier
+		db.hotCapacity = o.HotCapacity
+		if db.hotCapacity == 0 || db.hotCapacity > db.capacity {
+			db.hotCapacity = uint64(float64(db.capacity) * defaultHotCapacityRatio)
+		}
+	}
 	// Functions for retrieval data index.
 	var (
 		encodeValueFunc func(fields shed.Item) (value []byte, err error)
@@ -243,14 +310,36 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 			b := make([]byte, 16)
 			binary.BigEndian.PutUint64(b[:8], fields.BinID)
 			binary.BigEndian.PutUint64(b[8:16], uint64(fields.StoreTimestamp))
+			// the value without data records that the data is in the backend
+			if db.inBackend(fields.Data) {
+				if err := db.backend.Put(fields.Address, fields.Data); err != nil {
+					return nil, err
+				}
+				return b, nil
+			}
 			value = append(b, fields.Data...)
 			return value, nil
 		}
 		decodeValueFunc = func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
 			e.StoreTimestamp = int64(binary.BigEndian.Uint64(value[8:16]))
 			e.BinID = binary.BigEndian.Uint64(value[:8])
-			e.Data = value[16:]
-			return e, nil
+			if len(value) > 16 {
+				e.Data = value[16:]
+				return e, nil
+			}
+			cold, err := db.isCold(keyItem)
+			if err != nil {
+				return e, err
+			}
+			switch {
+			case cold:
+				e.Data, err = db.cold.Get(keyItem.Address)
+			case db.backend != nil:
+				e.Data, err = db.backend.Get(keyItem.Address)
+			default:
+				e.Data = value[16:]
+			}
+			return e, err
 		}
 	}
 	// Index storing actual chunk address, data and bin id.
@@ -362,7 +451,7 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	// create a push syncing triggers used by SubscribePush function
 	db.pushTriggers = make([]chan struct{}, 0)
 	// gc index for removable chunk ordered by ascending last access time
-	db.gcIndex, err = db.shed.NewIndex("AccessTimestamp|BinID|Hash->nil", shed.IndexFuncs{
+	gcIndexFuncs := shed.IndexFuncs{
 		EncodeKey: func(fields shed.Item) (key []byte, err error) {
 			b := make([]byte, 16, 16+len(fields.Address))
 			binary.BigEndian.PutUint64(b[:8], uint64(fields.AccessTimestamp))
@@ -382,7 +471,14 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
 			return e, nil
 		},
-	})
+	}
+	db.gcIndex, err = db.shed.NewIndex("AccessTimestamp|BinID|Hash->nil", gcIndexFuncs)
+	if err != nil {
+		return nil, err
+	}
+	// gc index for removable chunks without postage stamps, collected before the stamped ones;
+	// chunks stored before the index was added are moved to it when they are accessed again
+	db.gcUnstampedIndex, err = db.shed.NewIndex("Unstamped|AccessTimestamp|BinID|Hash->nil", gcIndexFuncs)
 	if err != nil {
 		return nil, err
 	}
@@ -430,6 +526,70 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		return nil, err
 	}
 
+	// Create a index structure for storing postage stamps of chunks
+	db.stampIndex, err = db.shed.NewIndex("Hash->Stamp", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return fields.Stamp, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.Stamp = value
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Index of the chunks with the data in the cold tier.
+	db.coldIndex, err = db.shed.NewIndex("Hash->Cold", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return nil, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Index of the data of the corrupted chunks moved out of the other indexes.
+	db.quarantineIndex, err = db.shed.NewIndex("Hash->Quarantine", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return fields.Data, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.Data = value
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.coldSize, err = db.shed.NewUint64Field("cold-size")
+	if err != nil {
+		return nil, err
+	}
+
 	// start garbage collection worker
 	go db.collectGarbageWorker()
 	return db, nil
@@ -457,7 +617,16 @@ func (db *DB) Close() (err error) {
 		// TODO: use a logger to write a goroutine profile
 		pprof.Lookup("goroutine").WriteTo(os.Stdout, 2)
 	}
-	return db.shed.Close()
+	err = db.shed.Close()
+	for _, b := range []Backend{db.backend, db.cold} {
+		if b == nil {
+			continue
+		}
+		if e := b.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 // po computes the proximity order between the address
@@ -500,6 +669,7 @@ func chunkToItem(ch chunk.Chunk) shed.Item {
 		Address: ch.Address(),
 		Data:    ch.Data(),
 		Tag:     ch.TagID(),
+		Stamp:   ch.Stamp(),
 	}
 }
 
@@ -616,3 +616,38 @@ func TestDBDebugIndexes(t *testing.T) {
 	testIndexCounts(t, 1, 1, 0, 1, 1, 1, 1, indexCounts)
 
 }
+
+// TestContextDone checks that the database is not accessed
+// with a context that is already done.
+func TestContextDone(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ch := generateTestRandomChunk()
+	if _, err := db.Put(ctx, chunk.ModePutUpload, ch); err != context.Canceled {
+		t.Fatalf("put: expected error %v, got %v", context.Canceled, err)
+	}
+	has, err := db.Has(context.Background(), ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("chunk stored with a cancelled context")
+	}
+
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, chunk.ModeGetRequest, ch.Address()); err != context.Canceled {
+		t.Fatalf("get: expected error %v, got %v", context.Canceled, err)
+	}
+	if _, err := db.Has(ctx, ch.Address()); err != context.Canceled {
+		t.Fatalf("has: expected error %v, got %v", context.Canceled, err)
+	}
+	if err := db.Set(ctx, chunk.ModeSetSyncPush, ch.Address()); err != context.Canceled {
+		t.Fatalf("set: expected error %v, got %v", context.Canceled, err)
+	}
+}
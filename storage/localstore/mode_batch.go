@@ -0,0 +1,125 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// PutBatchSize is the maximal number of chunks PutBatch stores in a single
+// index batch, so that large batches do not hold the batch lock for long
+var PutBatchSize = 256
+
+// PutBatch stores the chunks as Put does, amortizing the index updates over
+// index batches of up to PutBatchSize chunks. If an error is returned, the
+// chunks of the batches written before it are stored.
+// PutBatch is required to implement chunk.BatchStore interface.
+func (db *DB) PutBatch(ctx context.Context, mode chunk.ModePut, chs []chunk.Chunk) (exist []bool, err error) {
+	metricName := fmt.Sprintf("localstore/PutBatch/%s", mode)
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	metrics.GetOrRegisterCounter(metricName+"/chunks", nil).Inc(int64(len(chs)))
+	defer totalTimeMetric(metricName, time.Now())
+
+	exist = make([]bool, 0, len(chs))
+	for len(chs) > 0 {
+		n := len(chs)
+		if n > PutBatchSize {
+			n = PutBatchSize
+		}
+		e, err := db.put(ctx, mode, chs[:n]...)
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+			return nil, err
+		}
+		exist = append(exist, e...)
+		chs = chs[n:]
+	}
+	return exist, nil
+}
+
+// GetBatch returns the chunks with the addresses, nil for the ones not found, unlike
+// GetMulti which fails if one of them is missing. The access timestamps and gc index
+// of the found chunks are updated together for ModeGetRequest.
+// GetBatch is required to implement chunk.BatchStore interface.
+func (db *DB) GetBatch(ctx context.Context, mode chunk.ModeGet, addrs []chunk.Address) (chunks []chunk.Chunk, err error) {
+	metricName := fmt.Sprintf("localstore/GetBatch/%s", mode)
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	defer totalTimeMetric(metricName, time.Now())
+
+	defer func() {
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case chunk.ModeGetRequest, chunk.ModeGetSync, chunk.ModeGetLookup, chunk.ModeGetPin:
+	default:
+		return nil, ErrInvalidMode
+	}
+
+	chunks = make([]chunk.Chunk, len(addrs))
+	found := make([]shed.Item, 0, len(addrs))
+	for i, addr := range addrs {
+		item, ok := db.cache.get(addr)
+		if !ok {
+			generation := db.cache.generation()
+			item, err = db.retrievalDataIndex.Get(addressToItem(addr))
+			if err == leveldb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			db.cache.add(item, generation)
+		}
+		if mode == chunk.ModeGetPin {
+			pinned, err := db.pinIndex.Get(item)
+			if err == leveldb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			item.PinCounter = pinned.PinCounter
+		}
+		found = append(found, item)
+		chunks[i], err = db.withStamp(chunk.NewChunk(item.Address, item.Data).WithPinCounter(item.PinCounter))
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics.GetOrRegisterCounter(metricName+"/found", nil).Inc(int64(len(found)))
+	metrics.GetOrRegisterCounter(metricName+"/missing", nil).Inc(int64(len(addrs) - len(found)))
+
+	if mode == chunk.ModeGetRequest && len(found) > 0 {
+		db.updateGCItems(found...)
+	}
+	return chunks, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// TestDB_PutBatch validates that PutBatch stores the chunks in multiple
+// index batches and reports the existing ones as Put.
+func TestDB_PutBatch(t *testing.T) {
+	defer func(s int) { PutBatchSize = s }(PutBatchSize)
+	PutBatchSize = 3
+
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(10)
+	if _, err := db.Put(context.Background(), chunk.ModePutSync, chunks[7]); err != nil {
+		t.Fatal(err)
+	}
+	// the first chunk is repeated in a later index batch
+	batch := append(chunks, chunks[0])
+	exist, err := db.PutBatch(context.Background(), chunk.ModePutSync, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exist) != len(batch) {
+		t.Fatalf("got %v exist values, want %v", len(exist), len(batch))
+	}
+	for i, e := range exist {
+		want := i == 7 || i == 10
+		if e != want {
+			t.Errorf("got chunk %v exists %v, want %v", i, e, want)
+		}
+	}
+	t.Run("retrieve indexes", newItemsCountTest(db.retrievalDataIndex, 10))
+	t.Run("pull index", newItemsCountTest(db.pullIndex, 10))
+}
+
+// TestDB_GetBatch validates that GetBatch returns the stored chunks
+// and nil for the missing ones.
+func TestDB_GetBatch(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(5)
+	if _, err := db.PutBatch(context.Background(), chunk.ModePutUpload, chunks[:4]); err != nil {
+		t.Fatal(err)
+	}
+	addrs := make([]chunk.Address, len(chunks))
+	for i, ch := range chunks {
+		addrs[i] = ch.Address()
+	}
+	for _, mode := range []chunk.ModeGet{chunk.ModeGetRequest, chunk.ModeGetSync, chunk.ModeGetLookup} {
+		got, err := db.GetBatch(context.Background(), mode, addrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ch := range got[:4] {
+			if ch == nil || !bytes.Equal(ch.Data(), chunks[i].Data()) {
+				t.Errorf("%v: got chunk %v %v, want %v", mode, i, ch, chunks[i])
+			}
+		}
+		if got[4] != nil {
+			t.Errorf("%v: got missing chunk %v", mode, got[4])
+		}
+	}
+	if _, err := db.GetBatch(context.Background(), chunk.ModeGet(100), addrs); err != ErrInvalidMode {
+		t.Errorf("got error %v, want %v", err, ErrInvalidMode)
+	}
+}
+
+// BenchmarkPutBatch compares storing chunks one by one with
+// storing them with PutBatch, as pull syncing and uploads do.
+//
+// # go test -benchmem -run=none github.com/ethersphere/swarm/storage/localstore -bench BenchmarkPutBatch -v
+//
+// goos: linux
+// goarch: amd64
+// pkg: github.com/ethersphere/swarm/storage/localstore
+// BenchmarkPutBatch/count_100_batch_false         	     613	   2113930 ns/op	 2071923 B/op	    3183 allocs/op
+// BenchmarkPutBatch/count_100_batch_true          	     688	   1835561 ns/op	 1689836 B/op	    1257 allocs/op
+// BenchmarkPutBatch/count_1000_batch_false        	      34	  35125011 ns/op	25190702 B/op	   31267 allocs/op
+// BenchmarkPutBatch/count_1000_batch_true         	      62	  19733230 ns/op	25416107 B/op	   11568 allocs/op
+// BenchmarkPutBatch/count_10000_batch_false       	       2	 707090224 ns/op	293096960 B/op	  635383 allocs/op
+// BenchmarkPutBatch/count_10000_batch_true        	       2	 736791240 ns/op	321054380 B/op	  498153 allocs/op
+func BenchmarkPutBatch(b *testing.B) {
+	for _, count := range []int{100, 1000, 10000} {
+		for _, batch := range []bool{false, true} {
+			b.Run(fmt.Sprintf("count %v batch %v", count, batch), func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					benchmarkPutBatch(b, count, batch)
+				}
+			})
+		}
+	}
+}
+
+// benchmarkPutBatch stores the number of chunks with ModePutSync,
+// with a single PutBatch call or with a Put call each.
+func benchmarkPutBatch(b *testing.B, count int, batch bool) {
+	b.StopTimer()
+	db, cleanupFunc := newTestDB(b, nil)
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(count)
+	b.StartTimer()
+
+	if batch {
+		if _, err := db.PutBatch(context.Background(), chunk.ModePutSync, chunks); err != nil {
+			b.Fatal(err)
+		}
+		return
+	}
+	for _, ch := range chunks {
+		if _, err := db.Put(context.Background(), chunk.ModePutSync, ch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetBatch compares getting chunks one by one with
+// getting them with a single GetBatch call.
+//
+// # go test -benchmem -run=none github.com/ethersphere/swarm/storage/localstore -bench BenchmarkGetBatch -v
+//
+// goos: linux
+// goarch: amd64
+// pkg: github.com/ethersphere/swarm/storage/localstore
+// BenchmarkGetBatch/count_100_batch_false         	    1173	    954839 ns/op	  584037 B/op	    2291 allocs/op
+// BenchmarkGetBatch/count_100_batch_true          	    3421	    348254 ns/op	  565783 B/op	    1636 allocs/op
+// BenchmarkGetBatch/count_1000_batch_false        	     106	  12137552 ns/op	 7040848 B/op	   38990 allocs/op
+// BenchmarkGetBatch/count_1000_batch_true         	     181	   6460484 ns/op	 6830121 B/op	   32424 allocs/op
+func BenchmarkGetBatch(b *testing.B) {
+	for _, count := range []int{100, 1000} {
+		for _, batch := range []bool{false, true} {
+			b.Run(fmt.Sprintf("count %v batch %v", count, batch), func(b *testing.B) {
+				benchmarkGetBatch(b, count, batch)
+			})
+		}
+	}
+}
+
+// benchmarkGetBatch gets the number of chunks with ModeGetRequest,
+// with a single GetBatch call or with a Get call each.
+func benchmarkGetBatch(b *testing.B, count int, batch bool) {
+	db, cleanupFunc := newTestDB(b, nil)
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(count)
+	if _, err := db.PutBatch(context.Background(), chunk.ModePutUpload, chunks); err != nil {
+		b.Fatal(err)
+	}
+	addrs := make([]chunk.Address, count)
+	for i, ch := range chunks {
+		addrs[i] = ch.Address()
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if batch {
+			if _, err := db.GetBatch(context.Background(), chunk.ModeGetRequest, addrs); err != nil {
+				b.Fatal(err)
+			}
+			continue
+		}
+		for _, addr := range addrs {
+			if _, err := db.Get(context.Background(), chunk.ModeGetRequest, addr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
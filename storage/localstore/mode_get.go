@@ -19,6 +19,7 @@ package localstore
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -45,6 +46,9 @@ func (db *DB) Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (
 		}
 	}()
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	out, err := db.get(mode, addr)
 	if err != nil {
 		if err == leveldb.ErrNotFound {
@@ -52,7 +56,21 @@ func (db *DB) Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (
 		}
 		return nil, err
 	}
-	return chunk.NewChunk(out.Address, out.Data).WithPinCounter(out.PinCounter), nil
+	return db.withStamp(chunk.NewChunk(out.Address, out.Data).WithPinCounter(out.PinCounter))
+}
+
+// withStamp returns the chunk with its postage stamp set
+// if the database has one for it.
+func (db *DB) withStamp(ch chunk.Chunk) (chunk.Chunk, error) {
+	item, err := db.stampIndex.Get(addressToItem(ch.Address()))
+	switch err {
+	case nil:
+		return ch.WithStamp(item.Stamp), nil
+	case leveldb.ErrNotFound:
+		return ch, nil
+	default:
+		return nil, err
+	}
 }
 
 // get returns Item from the retrieval index
@@ -60,9 +78,14 @@ func (db *DB) Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (
 func (db *DB) get(mode chunk.ModeGet, addr chunk.Address) (out shed.Item, err error) {
 	item := addressToItem(addr)
 
-	out, err = db.retrievalDataIndex.Get(item)
-	if err != nil {
-		return out, err
+	out, ok := db.cache.get(addr)
+	if !ok {
+		generation := db.cache.generation()
+		out, err = db.retrievalDataIndex.Get(item)
+		if err != nil {
+			return out, err
+		}
+		db.cache.add(out, generation)
 	}
 	switch mode {
 	// update the access timestamp and gc index
@@ -148,24 +171,38 @@ func (db *DB) updateGC(item shed.Item) (err error) {
 		return nil
 	}
 	// delete current entry from the gc index
-	db.gcIndex.DeleteInBatch(batch, item)
+	db.deleteGCInBatch(batch, item)
 	// update access timestamp
 	item.AccessTimestamp = now()
 	// update retrieve access index
 	db.retrievalAccessIndex.PutInBatch(batch, item)
+	// accessed chunks are moved back from the cold tier
+	recalled, err := db.recallInBatch(batch, item)
+	if err != nil {
+		return err
+	}
 	// add new entry to gc index
 	ok, err := db.pinIndex.Has(item)
 	if err != nil {
 		return err
 	}
 	if !ok {
-		err = db.gcIndex.PutInBatch(batch, item)
+		err = db.putGCInBatch(batch, item)
 		if err != nil {
 			return err
 		}
 	}
 
-	return db.shed.WriteBatch(batch)
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return err
+	}
+	if recalled {
+		db.deleteColdData([]chunk.Address{item.Address})
+		atomic.AddUint64(&db.recalled, 1)
+		metrics.GetOrRegisterCounter("localstore/tier/recall", nil).Inc(1)
+		db.triggerGarbageCollection()
+	}
+	return nil
 }
 
 // testHookUpdateGC is a hook that can provide
@@ -43,6 +43,9 @@ func (db *DB) GetMulti(ctx context.Context, mode chunk.ModeGet, addrs ...chunk.A
 		}
 	}()
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	out, err := db.getMulti(mode, addrs...)
 	if err != nil {
 		if err == leveldb.ErrNotFound {
@@ -52,7 +55,10 @@ func (db *DB) GetMulti(ctx context.Context, mode chunk.ModeGet, addrs ...chunk.A
 	}
 	chunks = make([]chunk.Chunk, len(out))
 	for i, ch := range out {
-		chunks[i] = chunk.NewChunk(ch.Address, ch.Data).WithPinCounter(ch.PinCounter)
+		chunks[i], err = db.withStamp(chunk.NewChunk(ch.Address, ch.Data).WithPinCounter(ch.PinCounter))
+		if err != nil {
+			return nil, err
+		}
 	}
 	return chunks, nil
 }
@@ -31,6 +31,9 @@ func (db *DB) Has(ctx context.Context, addr chunk.Address) (bool, error) {
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	has, err := db.retrievalDataIndex.Has(addressToItem(addr))
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
@@ -46,6 +49,9 @@ func (db *DB) HasMulti(ctx context.Context, addrs ...chunk.Address) ([]bool, err
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	have, err := db.retrievalDataIndex.HasMulti(addressesToItems(addrs...)...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
@@ -38,7 +38,7 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
-	exist, err = db.put(mode, chs...)
+	exist, err = db.put(ctx, mode, chs...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
 	}
@@ -52,11 +52,18 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 // same address are passed in arguments, only the first chunk will be stored,
 // and following ones will have exist set to true for their index in exist
 // slice. This is the same behaviour as if the same chunks are passed one by one
-// in multiple put method calls.
-func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err error) {
+// in multiple put method calls. Nothing is stored if the context is done
+// before the batch lock is acquired.
+func (db *DB) put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// protect parallel updates
 	db.batchMu.Lock()
 	defer db.batchMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	batch := new(leveldb.Batch)
 
@@ -74,6 +81,14 @@ func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err err
 	// Values from this map are stored with the batch
 	binIDs := make(map[uint8]uint64)
 
+	// postage stamps are stored regardless of the mode
+	// and whether the chunk already exists
+	for _, ch := range chs {
+		if ch.Stamp() != nil {
+			db.stampIndex.PutInBatch(batch, chunkToItem(ch))
+		}
+	}
+
 	switch mode {
 	case chunk.ModePutRequest:
 		for i, ch := range chs {
@@ -307,7 +322,7 @@ func (db *DB) setGC(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, e
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
+		db.deleteGCInBatch(batch, item)
 		gcSizeChange--
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
@@ -322,7 +337,7 @@ func (db *DB) setGC(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, e
 		return 0, err
 	}
 	if !ok {
-		err = db.gcIndex.PutInBatch(batch, item)
+		err = db.putGCInBatch(batch, item)
 		if err != nil {
 			return 0, err
 		}
@@ -37,7 +37,7 @@ func (db *DB) Set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Addres
 
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
-	err = db.set(mode, addrs...)
+	err = db.set(ctx, mode, addrs...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
 	}
@@ -48,10 +48,18 @@ func (db *DB) Set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Addres
 // chunks represented by provided addresses.
 // It acquires lockAddr to protect two calls
 // of this function for the same address in parallel.
-func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
+// No index is updated if the context is done before
+// the batch lock is acquired.
+func (db *DB) set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// protect parallel updates
 	db.batchMu.Lock()
 	defer db.batchMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	batch := new(leveldb.Batch)
 
@@ -59,6 +67,8 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
+	var triggerPushFeed bool                    // signal push feed subscriptions to iterate
+	var coldRemoved []chunk.Address             // chunks to delete from the cold tier
 
 	switch mode {
 	case chunk.ModeSetAccess:
@@ -96,6 +106,10 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 			}
 			gcSizeChange += c
 		}
+		coldRemoved, err = db.removeColdInBatch(batch, addrs)
+		if err != nil {
+			return err
+		}
 
 	case chunk.ModeSetPin:
 		for _, addr := range addrs {
@@ -111,6 +125,14 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 				return err
 			}
 		}
+	case chunk.ModeSetReUpload:
+		for _, addr := range addrs {
+			err := db.setReUpload(batch, addr)
+			if err != nil {
+				return err
+			}
+		}
+		triggerPushFeed = len(addrs) > 0
 
 	default:
 		return ErrInvalidMode
@@ -125,9 +147,17 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	if err != nil {
 		return err
 	}
+	if mode == chunk.ModeSetRemove {
+		db.cache.remove(addrs...)
+		db.deleteBackendData(addrs)
+		db.deleteColdData(coldRemoved)
+	}
 	for po := range triggerPullFeed {
 		db.triggerPullSubscriptions(po)
 	}
+	if triggerPushFeed {
+		db.triggerPushSubscriptions()
+	}
 	return nil
 }
 
@@ -161,7 +191,7 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
+		db.deleteGCInBatch(batch, item)
 		gcSizeChange--
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
@@ -177,7 +207,7 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 		return 0, err
 	}
 	if !ok {
-		err = db.gcIndex.PutInBatch(batch, item)
+		err = db.putGCInBatch(batch, item)
 		if err != nil {
 			return 0, err
 		}
@@ -290,7 +320,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
+		db.deleteGCInBatch(batch, item)
 		gcSizeChange--
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
@@ -306,7 +336,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 		return 0, err
 	}
 	if !ok {
-		err = db.gcIndex.PutInBatch(batch, item)
+		err = db.putGCInBatch(batch, item)
 		if err != nil {
 			return 0, err
 		}
@@ -343,7 +373,8 @@ func (db *DB) setRemove(batch *leveldb.Batch, addr chunk.Address) (gcSizeChange
 	db.retrievalDataIndex.DeleteInBatch(batch, item)
 	db.retrievalAccessIndex.DeleteInBatch(batch, item)
 	db.pullIndex.DeleteInBatch(batch, item)
-	db.gcIndex.DeleteInBatch(batch, item)
+	db.deleteGCInBatch(batch, item)
+	db.stampIndex.DeleteInBatch(batch, item)
 	// a check is needed for decrementing gcSize
 	// as delete is not reporting if the key/value pair
 	// is deleted or not
@@ -406,3 +437,17 @@ func (db *DB) setUnpin(batch *leveldb.Batch, addr chunk.Address) (err error) {
 
 	return nil
 }
+
+// setReUpload adds a stored chunk to the push index, so that it
+// is push synced again. The chunk is pushed without a tag.
+// Provided batch is updated.
+func (db *DB) setReUpload(batch *leveldb.Batch, addr chunk.Address) (err error) {
+	item := addressToItem(addr)
+
+	i, err := db.retrievalDataIndex.Get(item)
+	if err != nil {
+		return err
+	}
+	item.StoreTimestamp = i.StoreTimestamp
+	return db.pushIndex.PutInBatch(batch, item)
+}
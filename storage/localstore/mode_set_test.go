@@ -363,3 +363,33 @@ func TestModeSetRemove(t *testing.T) {
 		})
 	}
 }
+
+// TestModeSetReUpload validates that ModeSetReUpload adds
+// push synced chunks back to the push index.
+func TestModeSetReUpload(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	ch := generateTestRandomChunk()
+
+	_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Set(context.Background(), chunk.ModeSetSyncPush, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("push index count", newItemsCountTest(db.pushIndex, 0))
+
+	err = db.Set(context.Background(), chunk.ModeSetReUpload, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("push index count", newItemsCountTest(db.pushIndex, 1))
+
+	err = db.Set(context.Background(), chunk.ModeSetReUpload, generateTestRandomChunk().Address())
+	if err != leveldb.ErrNotFound {
+		t.Fatalf("got error %v, want %v", err, leveldb.ErrNotFound)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+)
+
+// IteratePinned calls the function for every pinned chunk with its pin counter,
+// in the order of their addresses. Iteration stops if the function returns true
+// or an error.
+func (db *DB) IteratePinned(fn func(addr chunk.Address, pinCounter uint64) (stop bool, err error)) error {
+	return db.pinIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		return fn(item.Address, item.PinCounter)
+	}, nil)
+}
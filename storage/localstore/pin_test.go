@@ -0,0 +1,67 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// TestIteratePinned validates that IteratePinned iterates
+// over all pinned chunks with their pin counters.
+func TestIteratePinned(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	want := make(map[string]uint64)
+	for i, ch := range generateTestRandomChunks(10) {
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// pin every other chunk as many times as its index
+		if i%2 == 0 {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			err = db.Set(context.Background(), chunk.ModeSetPin, ch.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		want[ch.Address().Hex()] = uint64(i)
+	}
+
+	got := make(map[string]uint64)
+	err := db.IteratePinned(func(addr chunk.Address, pinCounter uint64) (stop bool, err error) {
+		got[addr.Hex()] = pinCounter
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pinned chunks, want %d", len(got), len(want))
+	}
+	for addr, pinCounter := range want {
+		if got[addr] != pinCounter {
+			t.Errorf("chunk %s: got pin counter %d, want %d", addr, got[addr], pinCounter)
+		}
+	}
+}
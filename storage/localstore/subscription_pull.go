@@ -99,6 +99,7 @@ func (db *DB) SubscribePull(ctx context.Context, bin uint8, since, until uint64)
 					case chunkDescriptors <- chunk.Descriptor{
 						Address: item.Address,
 						BinID:   item.BinID,
+						Tag:     item.Tag,
 					}:
 						if until > 0 && item.BinID == until {
 							return true, errStopSubscription
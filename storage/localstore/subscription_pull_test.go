@@ -685,3 +685,41 @@ func TestAddressInBin(t *testing.T) {
 		}
 	}
 }
+
+// TestDB_SubscribePull_tag validates that chunk descriptors
+// hold the uid of the tag the chunk was uploaded with.
+func TestDB_SubscribePull_tag(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{Tags: chunk.NewTags()})
+	defer cleanupFunc()
+
+	tag, err := db.tags.Create("test", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := generateTestRandomChunk().WithTagID(tag.Uid)
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, stop := db.SubscribePull(ctx, db.po(ch.Address()), 0, 1)
+	defer stop()
+
+	select {
+	case d, ok := <-c:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		if !bytes.Equal(d.Address, ch.Address()) {
+			t.Errorf("got address %s, want %s", d.Address, ch.Address())
+		}
+		if d.Tag != tag.Uid {
+			t.Errorf("got tag %v, want %v", d.Tag, tag.Uid)
+		}
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+}
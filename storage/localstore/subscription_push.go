@@ -76,9 +76,13 @@ func (db *DB) SubscribePush(ctx context.Context) (c <-chan chunk.Chunk, stop fun
 					if err != nil {
 						return true, err
 					}
+					ch, err := db.withStamp(chunk.NewChunk(dataItem.Address, dataItem.Data).WithTagID(item.Tag))
+					if err != nil {
+						return true, err
+					}
 
 					select {
-					case chunks <- chunk.NewChunk(dataItem.Address, dataItem.Data).WithTagID(item.Tag):
+					case chunks <- ch:
 						count++
 						// set next iteration start item
 						// when its chunk is successfully sent to channel
@@ -0,0 +1,261 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// defaultHotCapacityRatio is the part of the capacity kept in the hot
+// tier if the cold tier is configured without a hot tier capacity
+var defaultHotCapacityRatio = 0.5
+
+// TierStats are the statistics of the hot and cold tiers of the localstore
+type TierStats struct {
+	HotChunks    uint64 `json:"hotChunks"`    // number of garbage collectable chunks stored locally
+	ColdChunks   uint64 `json:"coldChunks"`   // number of chunks stored in the cold tier
+	HotCapacity  uint64 `json:"hotCapacity"`  // number of garbage collectable chunks kept locally
+	ColdCapacity uint64 `json:"coldCapacity"` // number of chunks the cold tier holds before garbage collection
+	Spilled      uint64 `json:"spilled"`      // number of chunks moved to the cold tier since start
+	Recalled     uint64 `json:"recalled"`     // number of chunks moved back from the cold tier since start
+}
+
+// TierStats returns the statistics of the tiers, the cold tier is empty
+// if it is not configured
+func (db *DB) TierStats() (s TierStats, err error) {
+	gcSize, err := db.gcSize.Get()
+	if err != nil {
+		return s, err
+	}
+	s.HotChunks = gcSize
+	s.HotCapacity = db.capacity
+	if db.cold == nil {
+		return s, nil
+	}
+	s.ColdChunks, err = db.coldSize.Get()
+	if err != nil {
+		return s, err
+	}
+	if s.ColdChunks < gcSize {
+		s.HotChunks = gcSize - s.ColdChunks
+	} else {
+		s.HotChunks = 0
+	}
+	s.HotCapacity = db.hotCapacity
+	s.ColdCapacity = db.capacity - db.hotCapacity
+	s.Spilled = atomic.LoadUint64(&db.spilled)
+	s.Recalled = atomic.LoadUint64(&db.recalled)
+	return s, nil
+}
+
+// hotOverCapacity returns whether more garbage collectable chunks
+// than the capacity of the hot tier are stored locally
+func (db *DB) hotOverCapacity(gcSize uint64) (bool, error) {
+	if db.cold == nil || gcSize <= db.hotCapacity {
+		return false, nil
+	}
+	coldSize, err := db.coldSize.Get()
+	if err != nil {
+		return false, err
+	}
+	return gcSize > coldSize && gcSize-coldSize > db.hotCapacity, nil
+}
+
+// isCold returns whether the data of the chunk is in the cold tier
+func (db *DB) isCold(item shed.Item) (bool, error) {
+	if db.cold == nil {
+		return false, nil
+	}
+	return db.coldIndex.Has(item)
+}
+
+// spillCold moves the data of the least recently accessed chunks stored
+// locally to the cold tier until the hot tier is below its garbage collection
+// target. If done is false, another call is needed as the batch size is reached.
+// The data is uploaded before the indexes are updated, so that the chunks stay
+// retrievable if the upload fails.
+func (db *DB) spillCold() (spilled uint64, done bool, err error) {
+	metricName := "localstore/tier/spill"
+
+	gcSize, err := db.gcSize.Get()
+	if err != nil {
+		return 0, true, err
+	}
+	coldSize, err := db.coldSize.Get()
+	if err != nil {
+		return 0, true, err
+	}
+	target := uint64(float64(db.hotCapacity) * gcTargetRatio)
+	if gcSize <= coldSize || gcSize-coldSize <= target {
+		return 0, true, nil
+	}
+	want := gcSize - coldSize - target
+	done = true
+	if want > gcBatchSize {
+		want = gcBatchSize
+		done = false
+	}
+
+	var items []shed.Item
+	err = db.gcIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		if uint64(len(items)) >= want {
+			return true, nil
+		}
+		cold, err := db.coldIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if !cold {
+			items = append(items, item)
+		}
+		return false, nil
+	}, nil)
+	if err != nil {
+		return 0, true, err
+	}
+
+	uploaded := make([]shed.Item, 0, len(items))
+	for _, item := range items {
+		i, err := db.retrievalDataIndex.Get(item)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, true, err
+		}
+		if err := db.cold.Put(i.Address, i.Data); err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/put/error", nil).Inc(1)
+			return 0, true, err
+		}
+		uploaded = append(uploaded, i)
+	}
+
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	batch := new(leveldb.Batch)
+	var removed, orphans []chunk.Address
+	for _, item := range uploaded {
+		// the chunk might have been removed or collected since uploaded
+		has, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return 0, true, err
+		}
+		if !has {
+			orphans = append(orphans, item.Address)
+			continue
+		}
+		removed = append(removed, item.Address)
+		// the retrieval index value without data and the
+		// cold index record that the data is in the cold tier
+		item.Data = nil
+		if err := db.retrievalDataIndex.PutInBatch(batch, item); err != nil {
+			return 0, true, err
+		}
+		if err := db.coldIndex.PutInBatch(batch, item); err != nil {
+			return 0, true, err
+		}
+		spilled++
+	}
+	coldSize, err = db.coldSize.Get()
+	if err != nil {
+		return 0, true, err
+	}
+	db.coldSize.PutInBatch(batch, coldSize+spilled)
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return 0, true, err
+	}
+	db.deleteBackendData(removed)
+	db.deleteColdData(orphans)
+
+	atomic.AddUint64(&db.spilled, spilled)
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(int64(spilled))
+	return spilled, done, nil
+}
+
+// recallInBatch moves the data of the item back from the cold tier to the localstore,
+// it returns whether the item was in the cold tier and the data has to be deleted from
+// it once the batch is written. It must be called under batchMu lock.
+func (db *DB) recallInBatch(batch *leveldb.Batch, item shed.Item) (recalled bool, err error) {
+	cold, err := db.isCold(item)
+	if err != nil || !cold {
+		return false, err
+	}
+	if err := db.retrievalDataIndex.PutInBatch(batch, item); err != nil {
+		return false, err
+	}
+	db.coldIndex.DeleteInBatch(batch, item)
+	coldSize, err := db.coldSize.Get()
+	if err != nil {
+		return false, err
+	}
+	if coldSize > 0 {
+		db.coldSize.PutInBatch(batch, coldSize-1)
+	}
+	return true, nil
+}
+
+// removeColdInBatch removes the chunks with the addresses from the cold index,
+// it returns the addresses of the chunks in the cold tier that have to be deleted
+// from it once the batch is written. It must be called under batchMu lock.
+func (db *DB) removeColdInBatch(batch *leveldb.Batch, addrs []chunk.Address) (removed []chunk.Address, err error) {
+	if db.cold == nil {
+		return nil, nil
+	}
+	for _, addr := range addrs {
+		item := addressToItem(addr)
+		cold, err := db.coldIndex.Has(item)
+		if err != nil {
+			return nil, err
+		}
+		if cold {
+			db.coldIndex.DeleteInBatch(batch, item)
+			removed = append(removed, addr)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	coldSize, err := db.coldSize.Get()
+	if err != nil {
+		return nil, err
+	}
+	if n := uint64(len(removed)); coldSize > n {
+		coldSize -= n
+	} else {
+		coldSize = 0
+	}
+	db.coldSize.PutInBatch(batch, coldSize)
+	return removed, nil
+}
+
+// deleteColdData removes the data of the chunks from the cold tier,
+// it must be called after the batch removing them is written
+func (db *DB) deleteColdData(addrs []chunk.Address) {
+	for _, addr := range addrs {
+		if err := db.cold.Delete(addr); err != nil {
+			metrics.GetOrRegisterCounter("localstore/tier/delete/error", nil).Inc(1)
+			log.Error("localstore cold tier delete", "addr", addr, "err", err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// TestDB_tiers validates that the least recently accessed chunks are moved
+// to the cold tier above the hot tier capacity, retrieved from it and moved
+// back when accessed.
+func TestDB_tiers(t *testing.T) {
+	cold := newMemBackend()
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity:    100,
+		HotCapacity: 20,
+		ColdTier:    cold,
+	})
+	collected := make(chan uint64)
+	defer setTestHookCollectGarbage(func(collectedCount uint64) {
+		select {
+		case collected <- collectedCount:
+		case <-db.close:
+		}
+	})()
+	defer cleanupFunc()
+
+	var chunks []chunk.Chunk
+	for i := 0; i < 50; i++ {
+		ch := generateTestRandomChunk()
+		if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, ch)
+	}
+
+	var stats TierStats
+	for {
+		select {
+		case <-collected:
+		case <-time.After(10 * time.Second):
+			t.Fatal("spill timeout")
+		}
+		var err error
+		stats, err = db.TierStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.HotChunks <= stats.HotCapacity {
+			break
+		}
+	}
+	if stats.HotCapacity != 20 || stats.ColdCapacity != 80 {
+		t.Errorf("got tier capacities %v and %v, want 20 and 80", stats.HotCapacity, stats.ColdCapacity)
+	}
+	if stats.HotChunks+stats.ColdChunks != 50 {
+		t.Errorf("got %v hot and %v cold chunks, want 50", stats.HotChunks, stats.ColdChunks)
+	}
+	if n := cold.len(); uint64(n) != stats.ColdChunks {
+		t.Errorf("got %v chunks in the cold tier, want %v", n, stats.ColdChunks)
+	}
+
+	// the first chunks are the least recently accessed ones
+	first := chunks[0]
+	if !cold.has(first.Address()) {
+		t.Fatal("least recently accessed chunk not in the cold tier")
+	}
+	for _, ch := range chunks {
+		got, err := db.Get(context.Background(), chunk.ModeGetLookup, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got data %x, want %x", got.Data(), ch.Data())
+		}
+	}
+
+	updated := make(chan struct{}, 1)
+	defer setTestHookUpdateGC(func() {
+		updated <- struct{}{}
+	})()
+	if _, err := db.Get(context.Background(), chunk.ModeGetRequest, first.Address()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-updated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("update gc timeout")
+	}
+	if cold.has(first.Address()) {
+		t.Error("accessed chunk in the cold tier")
+	}
+	if cold, err := db.coldIndex.Has(addressToItem(first.Address())); err != nil || cold {
+		t.Errorf("got accessed chunk in the cold index %v, err %v", cold, err)
+	}
+	stats, err := db.TierStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Recalled != 1 {
+		t.Errorf("got %v recalled chunks, want 1", stats.Recalled)
+	}
+
+	second := chunks[1]
+	if !cold.has(second.Address()) {
+		t.Fatal("least recently accessed chunk not in the cold tier")
+	}
+	if err := db.Set(context.Background(), chunk.ModeSetRemove, second.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if cold.has(second.Address()) {
+		t.Error("removed chunk in the cold tier")
+	}
+}
+
+// memBackend is a Backend storing the data of chunks in memory
+type memBackend struct {
+	data map[string][]byte
+	mu   sync.Mutex
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{data: make(map[string][]byte)}
+}
+
+func (b *memBackend) Put(addr chunk.Address, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[string(addr)] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memBackend) Get(addr chunk.Address) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.data[string(addr)]
+	if !ok {
+		return nil, leveldb.ErrNotFound
+	}
+	return data, nil
+}
+
+func (b *memBackend) Has(addr chunk.Address) (bool, error) {
+	return b.has(addr), nil
+}
+
+func (b *memBackend) Delete(addr chunk.Address) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.data, string(addr))
+	return nil
+}
+
+func (b *memBackend) Close() error {
+	return nil
+}
+
+func (b *memBackend) has(addr chunk.Address) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.data[string(addr)]
+	return ok
+}
+
+func (b *memBackend) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.data)
+}
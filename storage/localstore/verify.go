@@ -0,0 +1,509 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/time/rate"
+)
+
+// Kinds of the issues found by Verify
+const (
+	IssueCorrupted   = "corrupted"    // the data of the chunk is not valid
+	IssueMissingData = "missing-data" // the data of the chunk is not in the backend or the cold tier
+	IssueOrphaned    = "orphaned"     // the chunk is in none of the gc, push and pin indexes, so it is never removed
+	IssueDangling    = "dangling"     // the index entry is of a chunk that is not stored
+	IssueStale       = "stale"        // the index entry does not match the stored chunk
+	IssueGCSize      = "gc-size"      // the gc size does not match the number of entries in the gc index
+)
+
+var (
+	// verifyPageSize is the number of index entries read at once by Verify,
+	// so that no iterator is held for the whole check
+	verifyPageSize = 1000
+	// maxVerifyIssues is the maximal number of issues listed in a VerifyReport
+	maxVerifyIssues = 10000
+)
+
+// VerifyOptions configures an integrity check of the localstore
+type VerifyOptions struct {
+	// Validators check the data of the chunks, a chunk is corrupted if none of them
+	// validates it. The data is only checked to be stored if there are none.
+	Validators []chunk.Validator
+	// Repair fixes or removes the inconsistent index entries and moves
+	// the corrupted chunks to the quarantine index.
+	Repair bool
+	// Rate is the maximal number of chunks and index entries checked
+	// per second, so that the check does not starve the node. Unlimited if zero.
+	Rate int
+}
+
+// VerifyIssue is an inconsistency found by Verify
+type VerifyIssue struct {
+	Kind     string `json:"kind"`
+	Index    string `json:"index"`
+	Address  string `json:"address,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+// VerifyReport is the outcome of an integrity check of the localstore
+type VerifyReport struct {
+	Chunks      int            `json:"chunks"`      // number of chunks checked
+	Entries     int            `json:"entries"`     // number of other index entries checked
+	Unchecked   int            `json:"unchecked"`   // number of chunks with the data in a backend or cold tier that is not configured
+	Counts      map[string]int `json:"counts"`      // number of issues by kind
+	Issues      []VerifyIssue  `json:"issues"`      // the first maxVerifyIssues issues
+	Repaired    int            `json:"repaired"`    // number of issues repaired
+	Quarantined int            `json:"quarantined"` // number of corrupted chunks moved to the quarantine index
+	Duration    time.Duration  `json:"duration"`
+}
+
+func (r *VerifyReport) add(kind, index string, addr chunk.Address, repaired bool) {
+	r.Counts[kind]++
+	if repaired {
+		r.Repaired++
+	}
+	metrics.GetOrRegisterCounter("localstore/verify/"+kind, nil).Inc(1)
+	if len(r.Issues) < maxVerifyIssues {
+		i := VerifyIssue{Kind: kind, Index: index, Repaired: repaired}
+		if addr != nil {
+			i.Address = addr.Hex()
+		}
+		r.Issues = append(r.Issues, i)
+	}
+}
+
+// verifier checks the localstore for a single Verify call
+type verifier struct {
+	db      *DB
+	o       *VerifyOptions
+	report  *VerifyReport
+	limiter *rate.Limiter
+	// retrieval index decoding the values without resolving
+	// the data stored in the backend or the cold tier
+	raw shed.Index
+}
+
+// Verify checks the integrity of the localstore while it is in use. It finds chunks
+// with missing or corrupted data, chunks that would never be removed, index entries
+// of chunks that are not stored or that do not match them and a wrong gc size. The report lists them and, with Repair, whether they were
+// fixed. Cancelling the context stops the check, returning the report so far.
+func (db *DB) Verify(ctx context.Context, o *VerifyOptions) (report *VerifyReport, err error) {
+	if o == nil {
+		o = new(VerifyOptions)
+	}
+	start := time.Now()
+	report = &VerifyReport{
+		Counts: make(map[string]int),
+		Issues: make([]VerifyIssue, 0),
+	}
+	defer func() {
+		report.Duration = time.Since(start)
+		log.Info("localstore verify", "chunks", report.Chunks, "entries", report.Entries, "issues", report.Counts, "repaired", report.Repaired, "err", err)
+	}()
+
+	v := &verifier{
+		db:      db,
+		o:       o,
+		report:  report,
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}
+	if o.Rate > 0 {
+		v.limiter = rate.NewLimiter(rate.Limit(o.Rate), 1)
+	}
+	v.raw, err = db.shed.NewIndex("Address->StoreTimestamp|BinID|Data", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return nil, ErrInvalidMode
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.StoreTimestamp = int64(binary.BigEndian.Uint64(value[8:16]))
+			e.BinID = binary.BigEndian.Uint64(value[:8])
+			e.Data = value[16:]
+			return e, nil
+		},
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if err := v.iterate(ctx, v.raw, v.checkChunk); err != nil {
+		return report, err
+	}
+	for _, c := range []struct {
+		name  string
+		index shed.Index
+		check func(name string, index shed.Index, item shed.Item) error
+	}{
+		{name: "retrievalAccessIndex", index: db.retrievalAccessIndex, check: v.checkEntry},
+		{name: "pullIndex", index: db.pullIndex, check: v.checkPullEntry},
+		{name: "pushIndex", index: db.pushIndex, check: v.checkPushEntry},
+		{name: "gcIndex", index: db.gcIndex, check: v.checkGCEntry},
+		{name: "gcUnstampedIndex", index: db.gcUnstampedIndex, check: v.checkGCEntry},
+		{name: "gcExcludeIndex", index: db.gcExcludeIndex, check: v.checkEntry},
+		{name: "stampIndex", index: db.stampIndex, check: v.checkEntry},
+		{name: "coldIndex", index: db.coldIndex, check: v.checkEntry},
+		{name: "pinIndex", index: db.pinIndex, check: v.checkEntry},
+	} {
+		c := c
+		err := v.iterate(ctx, c.index, func(item shed.Item) error {
+			report.Entries++
+			return c.check(c.name, c.index, item)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, v.checkGCSize()
+}
+
+// iterate calls the function for all the items of the index at the rate of the
+// options, reading them in pages outside of the iteration
+func (v *verifier) iterate(ctx context.Context, index shed.Index, fn func(shed.Item) error) error {
+	var start *shed.Item
+	for {
+		items := make([]shed.Item, 0, verifyPageSize)
+		err := index.Iterate(func(item shed.Item) (stop bool, err error) {
+			items = append(items, item)
+			return len(items) == verifyPageSize, nil
+		}, &shed.IterateOptions{StartFrom: start, SkipStartFromItem: start != nil})
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := v.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if len(items) < verifyPageSize {
+			return nil
+		}
+		start = &items[len(items)-1]
+	}
+}
+
+// checkChunk checks the data of the chunk of the retrieval
+// index item and that the chunk is removed eventually
+func (v *verifier) checkChunk(item shed.Item) (err error) {
+	db := v.db
+	v.report.Chunks++
+
+	// the data in the backend or the cold tier is read as Get does
+	missing := false
+	if len(item.Data) == 0 {
+		i, err := db.retrievalDataIndex.Get(item)
+		switch err {
+		case nil:
+			item.Data = i.Data
+		case leveldb.ErrNotFound:
+			missing = true
+		default:
+			return err
+		}
+	}
+	// the data can not be checked if the backend or the cold tier
+	// it is stored in is not configured
+	unchecked := !missing && len(item.Data) == 0
+	if unchecked {
+		v.report.Unchecked++
+	}
+	corrupted := !missing && !unchecked && !v.valid(chunk.NewChunk(item.Address, item.Data))
+
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	// the chunk might have been removed or collected since iterated
+	if has, err := v.raw.Has(item); err != nil || !has {
+		return err
+	}
+	if missing || corrupted {
+		kind := IssueMissingData
+		if corrupted {
+			kind = IssueCorrupted
+		}
+		if !v.o.Repair {
+			v.report.add(kind, "retrievalDataIndex", item.Address, false)
+			return nil
+		}
+		if err := v.remove(item, corrupted); err != nil {
+			return err
+		}
+		v.report.add(kind, "retrievalDataIndex", item.Address, true)
+		return nil
+	}
+
+	orphaned, err := v.orphaned(&item)
+	if err != nil || !orphaned {
+		return err
+	}
+	if !v.o.Repair {
+		v.report.add(IssueOrphaned, "gcIndex", item.Address, false)
+		return nil
+	}
+	batch := new(leveldb.Batch)
+	if item.AccessTimestamp == 0 {
+		item.AccessTimestamp = now()
+		if err := db.retrievalAccessIndex.PutInBatch(batch, item); err != nil {
+			return err
+		}
+	}
+	if err := db.putGCInBatch(batch, item); err != nil {
+		return err
+	}
+	if err := db.incGCSizeInBatch(batch, 1); err != nil {
+		return err
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return err
+	}
+	v.report.add(IssueOrphaned, "gcIndex", item.Address, true)
+	return nil
+}
+
+// orphaned returns whether the chunk of the item is in none of the gc, push and
+// pin indexes, setting the access timestamp of the item if the chunk has one
+func (v *verifier) orphaned(item *shed.Item) (bool, error) {
+	db := v.db
+	a, err := db.retrievalAccessIndex.Get(*item)
+	switch err {
+	case nil:
+		item.AccessTimestamp = a.AccessTimestamp
+		if has, err := db.gcIndex.Has(*item); err != nil || has {
+			return false, err
+		}
+	case leveldb.ErrNotFound:
+	default:
+		return false, err
+	}
+	if has, err := db.pushIndex.Has(*item); err != nil || has {
+		return false, err
+	}
+	has, err := db.pinIndex.Has(*item)
+	return !has, err
+}
+
+// valid returns whether one of the validators validates the chunk
+func (v *verifier) valid(ch chunk.Chunk) bool {
+	if len(v.o.Validators) == 0 {
+		return true
+	}
+	for _, val := range v.o.Validators {
+		if val.Validate(ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes the chunk of the retrieval index item from the indexes as Set with
+// ModeSetRemove does, keeping its pins, and moves corrupted data to the quarantine
+// index. It must be called under batchMu lock.
+func (v *verifier) remove(item shed.Item, quarantine bool) (err error) {
+	db := v.db
+	batch := new(leveldb.Batch)
+	if a, err := db.retrievalAccessIndex.Get(item); err == nil {
+		item.AccessTimestamp = a.AccessTimestamp
+	}
+	var gcSizeChange int64
+	if has, err := db.gcIndex.Has(item); err != nil {
+		return err
+	} else if has {
+		gcSizeChange = -1
+	}
+	v.raw.DeleteInBatch(batch, item)
+	db.retrievalAccessIndex.DeleteInBatch(batch, item)
+	db.pullIndex.DeleteInBatch(batch, item)
+	db.pushIndex.DeleteInBatch(batch, item)
+	db.deleteGCInBatch(batch, item)
+	db.stampIndex.DeleteInBatch(batch, item)
+	coldRemoved, err := db.removeColdInBatch(batch, []chunk.Address{item.Address})
+	if err != nil {
+		return err
+	}
+	if err := db.incGCSizeInBatch(batch, gcSizeChange); err != nil {
+		return err
+	}
+	if quarantine {
+		if err := db.quarantineIndex.PutInBatch(batch, item); err != nil {
+			return err
+		}
+		v.report.Quarantined++
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return err
+	}
+	db.cache.remove(item.Address)
+	db.deleteBackendData([]chunk.Address{item.Address})
+	if db.cold != nil {
+		db.deleteColdData(coldRemoved)
+	}
+	return nil
+}
+
+// stored returns the retrieval index item of the chunk with the address,
+// found is false if the chunk is not stored
+func (v *verifier) stored(addr chunk.Address) (item shed.Item, found bool, err error) {
+	item, err = v.raw.Get(addressToItem(addr))
+	switch err {
+	case nil:
+		return item, true, nil
+	case leveldb.ErrNotFound:
+		return item, false, nil
+	}
+	return item, false, err
+}
+
+// checkEntry checks that the chunk of the index entry is stored,
+// dangling entries are removed but the ones of pinned chunks
+func (v *verifier) checkEntry(name string, index shed.Index, item shed.Item) error {
+	return v.checkMatch(name, index, item, nil)
+}
+
+// checkPullEntry checks that the pull index entry matches the bin ID of the chunk
+func (v *verifier) checkPullEntry(name string, index shed.Index, item shed.Item) error {
+	return v.checkMatch(name, index, item, func(stored shed.Item) (bool, error) {
+		return stored.BinID == item.BinID, nil
+	})
+}
+
+// checkPushEntry checks that the push index entry matches the store timestamp of the chunk
+func (v *verifier) checkPushEntry(name string, index shed.Index, item shed.Item) error {
+	return v.checkMatch(name, index, item, func(stored shed.Item) (bool, error) {
+		return stored.StoreTimestamp == item.StoreTimestamp, nil
+	})
+}
+
+// checkGCEntry checks that the gc index entry matches the bin ID
+// and the access timestamp of the chunk
+func (v *verifier) checkGCEntry(name string, index shed.Index, item shed.Item) error {
+	return v.checkMatch(name, index, item, func(stored shed.Item) (bool, error) {
+		if stored.BinID != item.BinID {
+			return false, nil
+		}
+		a, err := v.db.retrievalAccessIndex.Get(item)
+		switch err {
+		case nil:
+			return a.AccessTimestamp == item.AccessTimestamp, nil
+		case leveldb.ErrNotFound:
+			return false, nil
+		}
+		return false, err
+	})
+}
+
+// checkMatch checks that the chunk of the index entry is stored and that the
+// entry matches it with the match function, if set. With Repair, inconsistent
+// entries are removed, except the ones of the pin index, which record the
+// intent of the user and are only reported.
+func (v *verifier) checkMatch(name string, index shed.Index, item shed.Item, match func(stored shed.Item) (bool, error)) error {
+	db := v.db
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	// the entry might have been removed since iterated
+	if has, err := index.Has(item); err != nil || !has {
+		return err
+	}
+
+	stored, found, err := v.stored(item.Address)
+	if err != nil {
+		return err
+	}
+	kind := IssueDangling
+	if found {
+		if match == nil {
+			return nil
+		}
+		ok, err := match(stored)
+		if err != nil || ok {
+			return err
+		}
+		kind = IssueStale
+	}
+	if !v.o.Repair || name == "pinIndex" {
+		v.report.add(kind, name, item.Address, false)
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	index.DeleteInBatch(batch, item)
+	switch name {
+	case "gcIndex":
+		if err := db.incGCSizeInBatch(batch, -1); err != nil {
+			return err
+		}
+	case "coldIndex":
+		coldSize, err := db.coldSize.Get()
+		if err != nil {
+			return err
+		}
+		if coldSize > 0 {
+			db.coldSize.PutInBatch(batch, coldSize-1)
+		}
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return err
+	}
+	if name == "coldIndex" && db.cold != nil {
+		db.deleteColdData([]chunk.Address{item.Address})
+	}
+	v.report.add(kind, name, item.Address, true)
+	return nil
+}
+
+// checkGCSize checks that the gc size matches the number of entries in the gc index
+func (v *verifier) checkGCSize() error {
+	db := v.db
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	count, err := db.gcIndex.Count()
+	if err != nil {
+		return err
+	}
+	gcSize, err := db.gcSize.Get()
+	if err != nil {
+		return err
+	}
+	if uint64(count) == gcSize {
+		return nil
+	}
+	if v.o.Repair {
+		if err := db.gcSize.Put(uint64(count)); err != nil {
+			return err
+		}
+	}
+	v.report.add(IssueGCSize, "gcSize", nil, v.o.Repair)
+	return nil
+}
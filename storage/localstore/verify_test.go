@@ -0,0 +1,204 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/shed"
+)
+
+// dataValidator validates the chunks with the data they were generated with
+type dataValidator map[string][]byte
+
+func (v dataValidator) Validate(ch chunk.Chunk) bool {
+	return bytes.Equal(v[string(ch.Address())], ch.Data())
+}
+
+// TestDB_Verify validates that Verify finds corrupted and orphaned chunks
+// and dangling and stale index entries, that they are repaired and that the
+// corrupted chunks are moved to the quarantine index.
+func TestDB_Verify(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(10)
+	validator := make(dataValidator)
+	for _, ch := range chunks {
+		validator[string(ch.Address())] = ch.Data()
+	}
+	if _, err := db.Put(context.Background(), chunk.ModePutRequest, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := func(ch chunk.Chunk) shed.Item {
+		t.Helper()
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := db.retrievalAccessIndex.Get(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.AccessTimestamp = a.AccessTimestamp
+		return item
+	}
+
+	// corrupt the data of the first chunk
+	corrupted := stored(chunks[0])
+	corrupted.Data = generateTestRandomChunk().Data()
+	if err := db.retrievalDataIndex.Put(corrupted); err != nil {
+		t.Fatal(err)
+	}
+	// remove the second chunk from the gc index
+	if err := db.gcIndex.Delete(stored(chunks[1])); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.gcSize.Put(9); err != nil {
+		t.Fatal(err)
+	}
+	// add a push index entry of the third chunk with a wrong store timestamp
+	stale := stored(chunks[2])
+	stale.StoreTimestamp++
+	if err := db.pushIndex.Put(stale); err != nil {
+		t.Fatal(err)
+	}
+	// add the entries of a chunk that is not stored
+	dangling := shed.Item{
+		Address:         generateTestRandomChunk().Address(),
+		BinID:           100,
+		AccessTimestamp: now(),
+	}
+	if err := db.pullIndex.Put(dangling); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.gcIndex.Put(dangling); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.gcSize.Put(10); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCounts := map[string]int{
+		IssueCorrupted: 1,
+		IssueOrphaned:  1,
+		IssueStale:     1,
+		IssueDangling:  2,
+	}
+	o := &VerifyOptions{
+		Validators: []chunk.Validator{validator},
+	}
+	report, err := db.Verify(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Chunks != 10 {
+		t.Errorf("got %v chunks checked, want 10", report.Chunks)
+	}
+	if !reflect.DeepEqual(report.Counts, wantCounts) {
+		t.Errorf("got issues %v, want %v", report.Counts, wantCounts)
+	}
+	if report.Repaired != 0 || report.Quarantined != 0 {
+		t.Errorf("got %v repaired and %v quarantined without repair, want none", report.Repaired, report.Quarantined)
+	}
+
+	o.Repair = true
+	report, err = db.Verify(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Counts, wantCounts) {
+		t.Errorf("got issues %v, want %v", report.Counts, wantCounts)
+	}
+	if report.Repaired != 5 || report.Quarantined != 1 {
+		t.Errorf("got %v repaired and %v quarantined, want 5 and 1", report.Repaired, report.Quarantined)
+	}
+
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, chunks[0].Address()); err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v for corrupted chunk, want %v", err, chunk.ErrChunkNotFound)
+	}
+	q, err := db.quarantineIndex.Get(addressToItem(chunks[0].Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(q.Data, corrupted.Data) {
+		t.Error("quarantined data does not match the corrupted data")
+	}
+	t.Run("retrieval data index count", newItemsCountTest(db.retrievalDataIndex, 9))
+	t.Run("pull index count", newItemsCountTest(db.pullIndex, 0))
+	t.Run("push index count", newItemsCountTest(db.pushIndex, 0))
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, 9))
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	report, err = db.Verify(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("got issues %v after repair, want none", report.Issues)
+	}
+}
+
+// TestDB_Verify_gcSize validates that Verify repairs
+// a gc size that does not match the gc index.
+func TestDB_Verify_gcSize(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	if _, err := db.Put(context.Background(), chunk.ModePutRequest, generateTestRandomChunks(5)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.gcSize.Put(42); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Verify(context.Background(), &VerifyOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Counts[IssueGCSize] != 1 || report.Repaired != 1 {
+		t.Errorf("got issues %v and %v repaired, want a repaired gc size", report.Counts, report.Repaired)
+	}
+	t.Run("gc size", newIndexGCSizeTest(db))
+}
+
+// TestDB_Verify_rate validates that Verify is rate limited
+// and stops when the context is done.
+func TestDB_Verify_rate(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	if _, err := db.Put(context.Background(), chunk.ModePutRequest, generateTestRandomChunks(5)...); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report, err := db.Verify(ctx, &VerifyOptions{Rate: 1})
+	if err == nil {
+		t.Fatal("got no error, want the check to stop")
+	}
+	if report.Chunks != 1 {
+		t.Errorf("got %v chunks checked, want 1", report.Chunks)
+	}
+}
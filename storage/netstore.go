@@ -28,8 +28,10 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/spancontext"
 	lru "github.com/hashicorp/golang-lru"
+	opentracing "github.com/opentracing/opentracing-go"
 	olog "github.com/opentracing/opentracing-go/log"
 	"github.com/syndtr/goleveldb/leveldb"
 	"golang.org/x/sync/singleflight"
@@ -41,6 +43,15 @@ import (
 const (
 	// capacity for the fetchers LRU cache
 	fetchersCapacity = 500000
+
+	// hedgePercentile is the delivery latency percentile of a peer after which
+	// a parallel request for the same chunk is sent to the next peer
+	hedgePercentile = 0.5
+)
+
+var (
+	// MaxParallelRequests caps the number of concurrent in-flight retrieve requests for a single chunk
+	MaxParallelRequests = 3
 )
 
 var (
@@ -88,6 +99,13 @@ func (fi *Fetcher) SafeClose(ch chunk.Chunk) {
 
 type RemoteGetFunc func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error)
 
+// RecoverFunc publishes a request to the neighbourhoods with the target prefixes
+// to re-upload the chunk with the given address
+type RecoverFunc func(ctx context.Context, targets [][]byte, ref Address) error
+
+// SyncedFunc is called with chunks that are newly stored through push or pull syncing
+type SyncedFunc func(ctx context.Context, ch Chunk)
+
 // NetStore is an extension of LocalStore
 // it implements the ChunkStore interface
 // on request it initiates remote cloud retrieval
@@ -98,6 +116,9 @@ type NetStore struct {
 	putMu        sync.Mutex
 	requestGroup singleflight.Group
 	RemoteGet    RemoteGetFunc
+	Latencies    *LatencyTracker // per-peer delivery latencies, used to schedule parallel requests
+	Recover      RecoverFunc     // requests re-upload of chunks that can not be retrieved, nil disables recovery
+	Synced       SyncedFunc      // called with chunks newly stored through syncing, nil for none
 	logger       log.Logger
 }
 
@@ -106,16 +127,38 @@ func NewNetStore(store chunk.Store, baseAddr *network.BzzAddr) *NetStore {
 	fetchers, _ := lru.New(fetchersCapacity)
 
 	return &NetStore{
-		fetchers: fetchers,
-		Store:    store,
-		LocalID:  baseAddr.ID(),
-		logger:   log.NewBaseAddressLogger(baseAddr.ShortString()),
+		fetchers:  fetchers,
+		Store:     store,
+		LocalID:   baseAddr.ID(),
+		Latencies: NewLatencyTracker(),
+		logger:    log.NewBaseAddressLogger(baseAddr.ShortString()),
 	}
 }
 
 // Put stores a chunk in localstore, and delivers to all requestor peers using the fetcher stored in
 // the fetchers cache
 func (n *NetStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	return n.put(ctx, mode, chs, func() ([]bool, error) {
+		return n.Store.Put(ctx, mode, chs...)
+	})
+}
+
+// PutBatch stores the chunks as Put does, amortizing the index updates of the localstore
+// over the chunks. It is meant for the many chunks of syncing and uploads.
+func (n *NetStore) PutBatch(ctx context.Context, mode chunk.ModePut, chs []Chunk) ([]bool, error) {
+	return n.put(ctx, mode, chs, func() ([]bool, error) {
+		return chunk.PutBatch(ctx, n.Store, mode, chs)
+	})
+}
+
+// GetBatch returns the chunks with the addresses from the localstore, nil for the ones
+// not found locally, without requesting them from the network.
+func (n *NetStore) GetBatch(ctx context.Context, mode chunk.ModeGet, addrs []Address) ([]Chunk, error) {
+	return chunk.GetBatch(ctx, n.Store, mode, addrs)
+}
+
+// put delivers the chunks to the fetchers waiting for them around storing them with the store function
+func (n *NetStore) put(ctx context.Context, mode chunk.ModePut, chs []Chunk, store func() ([]bool, error)) ([]bool, error) {
 	// first notify all goroutines waiting on the fetcher that the chunk has been received
 
 	n.putMu.Lock()
@@ -132,10 +175,17 @@ func (n *NetStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([
 	n.putMu.Unlock()
 
 	// put the chunk to the localstore, there should be no error
-	exist, err := n.Store.Put(ctx, mode, chs...)
+	exist, err := store()
 	if err != nil {
 		return nil, err
 	}
+	if mode == chunk.ModePutSync && n.Synced != nil {
+		for i, ch := range chs {
+			if !exist[i] {
+				n.Synced(ctx, ch)
+			}
+		}
+	}
 
 	n.putMu.Lock()
 	defer n.putMu.Unlock()
@@ -182,16 +232,48 @@ func (n *NetStore) Get(ctx context.Context, mode chunk.ModeGet, req *Request) (c
 
 		n.logger.Trace("netstore.chunk-not-in-localstore", "ref", ref.String())
 
-		v, err, _ := n.requestGroup.Do(ref.String(), func() (interface{}, error) {
+		v, err := n.fetch(ctx, mode, req, start)
+		if err != nil {
+			n.logger.Trace(err.Error(), "ref", ref)
+			return nil, err
+		}
+
+		n.logger.Trace("netstore.singleflight returned", "ref", ref.String(), "err", err)
+
+		return v, nil
+	}
+	n.logger.Trace("netstore.get returned", "ref", ref.String())
+
+	ctx, ssp := spancontext.StartSpan(
+		ctx,
+		"localstore.get")
+	defer ssp.Finish()
+
+	return ch, nil
+}
+
+// fetch retrieves a chunk from the network. Concurrent requests for the same chunk share
+// a single retrieval, but every caller only waits as long as its own context allows.
+// If the shared retrieval is cancelled by the context of another caller, it is retried
+// with the context of the caller unless the chunk has been stored in the meantime.
+func (n *NetStore) fetch(ctx context.Context, mode chunk.ModeGet, req *Request, start time.Time) (Chunk, error) {
+	ref := req.Addr
+	for {
+		resC := n.requestGroup.DoChan(ref.String(), func() (interface{}, error) {
+			var ch Chunk
 			// currently we issue a retrieve request if a fetcher
 			// has already been created by a syncer for that particular chunk.
 			// so it is possible to
 			// have 2 in-flight requests for the same chunk - one by a
 			// syncer (offered/wanted/deliver flow) and one from
 			// here - retrieve request
+			var err error
 			fi, _, ok := n.GetOrCreateFetcher(ctx, ref, "request")
 			if ok {
 				ch, err = n.RemoteFetch(ctx, req, fi)
+				if err == ErrNoSuitablePeer {
+					ch, err = n.recover(ctx, req, fi)
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -205,29 +287,36 @@ func (n *NetStore) Get(ctx context.Context, mode chunk.ModeGet, req *Request) (c
 			return ch, nil
 		})
 
-		if err != nil {
-			n.logger.Trace(err.Error(), "ref", ref)
-			return nil, err
+		select {
+		case res := <-resC:
+			if res.Err == nil {
+				return res.Val.(Chunk), nil
+			}
+			// the retrieval was cancelled by the context of another caller
+			if isContextErr(res.Err) && ctx.Err() == nil {
+				if ch, err := n.Store.Get(ctx, mode, ref); err == nil {
+					return ch, nil
+				}
+				continue
+			}
+			return nil, res.Err
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-
-		n.logger.Trace("netstore.singleflight returned", "ref", ref.String(), "err", err)
-
-		return v.(Chunk), nil
 	}
-	n.logger.Trace("netstore.get returned", "ref", ref.String())
-
-	ctx, ssp := spancontext.StartSpan(
-		ctx,
-		"localstore.get")
-	defer ssp.Finish()
+}
 
-	return ch, nil
+// isContextErr reports whether the error is caused by a done context
+func isContextErr(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
 }
 
 // RemoteFetch is handling the retry mechanism when making a chunk request to our peers.
 // For a given chunk Request, we call RemoteGet, which selects the next eligible peer and
-// issues a RetrieveRequest and we wait for a delivery. If a delivery doesn't arrive within the SearchTimeout
-// we retry.
+// issues a RetrieveRequest and we wait for a delivery. If a delivery doesn't arrive within
+// the p50 delivery latency of the selected peer, a parallel request is issued to the next peer,
+// up to MaxParallelRequests in-flight requests per chunk. Requests that are not served within
+// the SearchTimeout are considered failed and make room for new ones.
 func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (chunk.Chunk, error) {
 	// while we haven't timed-out, and while we don't have a chunk,
 	// iterate over peers and try to find a chunk
@@ -235,50 +324,237 @@ func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (
 
 	ref := req.Addr
 
-	for {
-		metrics.GetOrRegisterCounter("remote/fetch/inner", nil).Inc(1)
+	var (
+		inflight  []*inflightRequest
+		exhausted bool // no more eligible peers to send a request to
+	)
+	defer func() {
+		for _, r := range inflight {
+			r.cleanup()
+		}
+	}()
 
-		ctx, osp := spancontext.StartSpan(
-			ctx,
-			"remote.fetch")
-		osp.LogFields(olog.String("ref", ref.String()))
+	for {
+		if !exhausted && len(inflight) < MaxParallelRequests {
+			r, err := n.remoteRequest(ctx, req)
+			if err != nil {
+				if len(inflight) == 0 {
+					return nil, ErrNoSuitablePeer
+				}
+				exhausted = true
+			} else {
+				inflight = append(inflight, r)
+				if len(inflight) > 1 {
+					metrics.GetOrRegisterCounter("remote/fetch/parallel", nil).Inc(1)
+				}
+			}
+		}
 
-		ctx = context.WithValue(ctx, "remote.fetch", osp)
+		// wait until either the oldest request times out or, if we can still
+		// issue requests, the hedging delay of the most recent request elapses
+		wait := time.Until(inflight[0].started.Add(timeouts.SearchTimeout))
+		if !exhausted && len(inflight) < MaxParallelRequests {
+			if hedge := time.Until(inflight[len(inflight)-1].hedgeAt); hedge < wait {
+				wait = hedge
+			}
+		}
+		timer := time.NewTimer(wait)
 
-		log.Trace("remote.fetch", "ref", ref)
+		select {
+		case <-fi.Delivered:
+			timer.Stop()
+			n.logger.Trace("remote.fetch, chunk delivered", "ref", ref, "base", hex.EncodeToString(n.LocalID[:16]), "requests", len(inflight))
+			for _, r := range inflight {
+				r.span.LogFields(olog.Bool("delivered", true))
+				r.span.Finish()
+			}
+			return fi.Chunk, nil
+		case <-timer.C:
+			// expire requests which have not been served within the search timeout
+			now := time.Now()
+			for len(inflight) > 0 && !now.Before(inflight[0].started.Add(timeouts.SearchTimeout)) {
+				metrics.GetOrRegisterCounter("remote/fetch/timeout/search", nil).Inc(1)
+				r := inflight[0]
+				r.span.LogFields(olog.Bool("timeout", true))
+				r.span.Finish()
+				r.cleanup()
+				inflight = inflight[1:]
+			}
+			if len(inflight) == 0 && exhausted {
+				return nil, ErrNoSuitablePeer
+			}
+			// a timed out request frees a slot, so allow trying to find a peer again
+			exhausted = false
+		case <-ctx.Done(): // global fetcher timeout
+			timer.Stop()
+			n.logger.Trace("remote.fetch, global timeout fail", "ref", ref, "err", ctx.Err())
+			metrics.GetOrRegisterCounter("remote/fetch/timeout/global", nil).Inc(1)
 
-		currentPeer, cleanup, err := n.RemoteGet(ctx, req, n.LocalID)
-		if err != nil {
-			n.logger.Trace(err.Error(), "ref", ref)
-			osp.LogFields(olog.String("err", err.Error()))
-			osp.Finish()
-			return nil, ErrNoSuitablePeer
+			for _, r := range inflight {
+				r.span.LogFields(olog.Bool("fail", true))
+				r.span.Finish()
+			}
+			return nil, ctx.Err()
 		}
-		defer cleanup()
+	}
+}
 
-		// add peer to the set of peers to skip from now
-		n.logger.Trace("remote.fetch, adding peer to skip", "ref", ref, "peer", currentPeer.String())
-		req.PeersToSkip.Store(currentPeer.String(), time.Now())
+// recover publishes a recovery request for a chunk that could not be retrieved from any
+// peer if recovery targets are set in the context, then retries the retrieval until the
+// chunk is re-uploaded by a node in the target neighbourhoods or the context is done
+func (n *NetStore) recover(ctx context.Context, req *Request, fi *Fetcher) (Chunk, error) {
+	targets := sctx.GetRecoveryTargets(ctx)
+	if n.Recover == nil || len(targets) == 0 {
+		return nil, ErrNoSuitablePeer
+	}
+	ref := req.Addr
+	metrics.GetOrRegisterCounter("netstore/recovery", nil).Inc(1)
+	if err := n.Recover(ctx, targets, ref); err != nil {
+		n.logger.Debug("netstore.recovery request failed", "ref", ref, "err", err)
+		return nil, ErrNoSuitablePeer
+	}
+	n.logger.Trace("netstore.recovery requested", "ref", ref)
 
+	for {
+		timer := time.NewTimer(timeouts.RecoveryRetryInterval)
 		select {
 		case <-fi.Delivered:
-			n.logger.Trace("remote.fetch, chunk delivered", "ref", ref, "base", hex.EncodeToString(n.LocalID[:16]))
-
-			osp.LogFields(olog.Bool("delivered", true))
-			osp.Finish()
+			timer.Stop()
 			return fi.Chunk, nil
-		case <-time.After(timeouts.SearchTimeout):
-			metrics.GetOrRegisterCounter("remote/fetch/timeout/search", nil).Inc(1)
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		// peers that failed before are requested again, they may have the chunk by now
+		r := &Request{
+			Addr:     ref,
+			Origin:   req.Origin,
+			Priority: req.Priority,
+			Client:   req.Client,
+		}
+		ch, err := n.RemoteFetch(ctx, r, fi)
+		if err == nil {
+			metrics.GetOrRegisterCounter("netstore/recovery/success", nil).Inc(1)
+			return ch, nil
+		}
+		if err != ErrNoSuitablePeer {
+			return nil, err
+		}
+	}
+}
 
-			osp.LogFields(olog.Bool("timeout", true))
-			osp.Finish()
-			break
-		case <-ctx.Done(): // global fetcher timeout
-			n.logger.Trace("remote.fetch, global timeout fail", "ref", ref, "err", ctx.Err())
-			metrics.GetOrRegisterCounter("remote/fetch/timeout/global", nil).Inc(1)
+// inflightRequest is a retrieve request sent to a single peer as part of a RemoteFetch
+type inflightRequest struct {
+	peer    enode.ID
+	started time.Time
+	hedgeAt time.Time // when a parallel request to another peer should be issued
+	cleanup func()
+	span    opentracing.Span
+}
+
+// remoteRequest issues a retrieve request to the next eligible peer through RemoteGet
+// and computes the time at which a parallel request should follow it, based on
+// the delivery latencies observed for that peer.
+func (n *NetStore) remoteRequest(ctx context.Context, req *Request) (*inflightRequest, error) {
+	metrics.GetOrRegisterCounter("remote/fetch/inner", nil).Inc(1)
+
+	ref := req.Addr
+
+	ctx, osp := spancontext.StartSpan(
+		ctx,
+		"remote.fetch")
+	osp.LogFields(olog.String("ref", ref.String()))
+
+	ctx = context.WithValue(ctx, "remote.fetch", osp)
+
+	log.Trace("remote.fetch", "ref", ref)
+
+	currentPeer, cleanup, err := n.RemoteGet(ctx, req, n.LocalID)
+	if err != nil {
+		n.logger.Trace(err.Error(), "ref", ref)
+		osp.LogFields(olog.String("err", err.Error()))
+		osp.Finish()
+		return nil, err
+	}
+
+	// add peer to the set of peers to skip from now
+	n.logger.Trace("remote.fetch, adding peer to skip", "ref", ref, "peer", currentPeer.String())
+	req.PeersToSkip.Store(currentPeer.String(), time.Now())
+
+	now := time.Now()
+	hedge := timeouts.SearchTimeout
+	if p50, ok := n.Latencies.Percentile(*currentPeer, hedgePercentile); ok && p50 < hedge {
+		hedge = p50
+		if hedge < timeouts.HedgeMinDelay {
+			hedge = timeouts.HedgeMinDelay
+		}
+	}
 
-			osp.LogFields(olog.Bool("fail", true))
-			osp.Finish()
+	return &inflightRequest{
+		peer:    *currentPeer,
+		started: now,
+		hedgeAt: now.Add(hedge),
+		cleanup: cleanup,
+		span:    osp,
+	}, nil
+}
+
+// Probe retrieves the chunk of the request from the network, even if it is present in the
+// LocalStore, and returns the peer that delivered it. Unlike RemoteFetch, requests are sent
+// to one peer at a time, so that the returned peer is the first hop of the route that served
+// the chunk. Peers set in req.PeersToSkip are not requested.
+func (n *NetStore) Probe(ctx context.Context, req *Request) (*enode.ID, error) {
+	metrics.GetOrRegisterCounter("netstore/probe", nil).Inc(1)
+
+	// GetOrCreateFetcher is not used as it would flag fetchers of concurrent
+	// retrievals as requested by the syncer
+	key := req.Addr.String()
+	n.putMu.Lock()
+	v, loaded := n.fetchers.Get(key)
+	if !loaded {
+		v = NewFetcher()
+		v.(*Fetcher).CreatedBy = "probe"
+		n.fetchers.Add(key, v)
+	}
+	n.putMu.Unlock()
+	fi := v.(*Fetcher)
+
+	if !loaded {
+		// do not leave behind a fetcher for a chunk that was never delivered
+		defer func() {
+			n.putMu.Lock()
+			defer n.putMu.Unlock()
+			if v, ok := n.fetchers.Peek(key); ok && v.(*Fetcher) == fi {
+				n.fetchers.Remove(key)
+			}
+		}()
+	}
+
+	for {
+		r, err := n.remoteRequest(ctx, req)
+		if err != nil {
+			return nil, ErrNoSuitablePeer
+		}
+		timer := time.NewTimer(timeouts.SearchTimeout)
+
+		select {
+		case <-fi.Delivered:
+			timer.Stop()
+			r.span.LogFields(olog.Bool("delivered", true))
+			r.span.Finish()
+			r.cleanup()
+			return &r.peer, nil
+		case <-timer.C:
+			metrics.GetOrRegisterCounter("netstore/probe/timeout/search", nil).Inc(1)
+			r.span.LogFields(olog.Bool("timeout", true))
+			r.span.Finish()
+			r.cleanup()
+		case <-ctx.Done():
+			timer.Stop()
+			r.span.LogFields(olog.Bool("fail", true))
+			r.span.Finish()
+			r.cleanup()
 			return nil, ctx.Err()
 		}
 	}
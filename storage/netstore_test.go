@@ -0,0 +1,386 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
+)
+
+// TestLatencyTrackerPercentile checks that per-peer percentiles are computed over
+// the recorded samples and that the global percentile is used as a fallback
+func TestLatencyTrackerPercentile(t *testing.T) {
+	lt := NewLatencyTracker()
+
+	if _, ok := lt.Percentile(enode.ID{1}, 0.5); ok {
+		t.Fatal("expected no percentile without samples")
+	}
+
+	for i := 1; i <= 10; i++ {
+		lt.Record(enode.ID{1}, time.Duration(i)*time.Millisecond)
+	}
+	p50, ok := lt.Percentile(enode.ID{1}, 0.5)
+	if !ok {
+		t.Fatal("expected percentile")
+	}
+	if p50 != 5*time.Millisecond {
+		t.Fatalf("expected p50 %v, got %v", 5*time.Millisecond, p50)
+	}
+
+	// unknown peer falls back to the global window
+	p50, ok = lt.Percentile(enode.ID{2}, 0.5)
+	if !ok {
+		t.Fatal("expected global percentile")
+	}
+	if p50 != 5*time.Millisecond {
+		t.Fatalf("expected global p50 %v, got %v", 5*time.Millisecond, p50)
+	}
+
+	// the window only keeps the most recent samples
+	for i := 0; i < latencySamples; i++ {
+		lt.Record(enode.ID{1}, time.Second)
+	}
+	p50, _ = lt.Percentile(enode.ID{1}, 0.5)
+	if p50 != time.Second {
+		t.Fatalf("expected p50 %v, got %v", time.Second, p50)
+	}
+}
+
+// TestNetStoreParallelRequests checks that the NetStore issues parallel requests for a chunk
+// once the p50 delivery latency of the requested peer elapses, that the number of parallel
+// requests is capped, and that a delivery by any of the peers completes the fetch
+func TestNetStoreParallelRequests(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SearchTimeout = d }(timeouts.SearchTimeout)
+	timeouts.SearchTimeout = 2 * time.Second
+
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+
+	var (
+		mtx      sync.Mutex
+		requests int
+		peerID   byte
+	)
+	requested := make(chan struct{}, 10)
+	ns.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests++
+		peerID++
+		id := enode.ID{peerID}
+		requested <- struct{}{}
+		return &id, func() {}, nil
+	}
+	// all peers are known to deliver fast
+	for i := 1; i <= 10; i++ {
+		ns.Latencies.Record(enode.ID{byte(i)}, 10*time.Millisecond)
+	}
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ns.Get(context.Background(), chunk.ModeGetRequest, NewRequest(ch.Address()))
+		errc <- err
+	}()
+
+	for i := 0; i < MaxParallelRequests; i++ {
+		select {
+		case <-requested:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for request %d", i)
+		}
+	}
+
+	// no more requests should be issued before the search timeout of the first one
+	select {
+	case <-requested:
+		t.Fatalf("expected at most %d parallel requests", MaxParallelRequests)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if _, err := ns.Put(context.Background(), chunk.ModePutRequest, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for fetch to complete")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if requests != MaxParallelRequests {
+		t.Fatalf("expected %d requests, got %d", MaxParallelRequests, requests)
+	}
+}
+
+// TestNetStoreGetContext checks that callers waiting for the same chunk only wait as long
+// as their own contexts allow and that cancelling the caller which started the retrieval
+// does not fail the other callers
+func TestNetStoreGetContext(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SearchTimeout = d }(timeouts.SearchTimeout)
+	timeouts.SearchTimeout = 5 * time.Second
+
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+
+	requested := make(chan struct{}, 10)
+	ns.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		requested <- struct{}{}
+		return &enode.ID{1}, func() {}, nil
+	}
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	get := func(ctx context.Context) chan error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := ns.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address()))
+			errc <- err
+		}()
+		return errc
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	errA := get(ctxA)
+	select {
+	case <-requested:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for request")
+	}
+
+	ctxB, cancelB := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelB()
+	errB := get(ctxB)
+	ctxC, cancelC := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelC()
+	errC := get(ctxC)
+
+	select {
+	case err := <-errC:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the caller with the shortest deadline")
+	}
+
+	cancelA()
+	select {
+	case err := <-errA:
+		if err != context.Canceled {
+			t.Fatalf("expected error %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the cancelled caller")
+	}
+	// the remaining caller retries the retrieval
+	select {
+	case <-requested:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for retried request")
+	}
+
+	if _, err := ns.Put(context.Background(), chunk.ModePutRequest, ch); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errB:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the remaining caller")
+	}
+}
+
+// TestNetStoreSequentialWithoutLatencies checks that without any latency samples
+// the NetStore falls back to waiting for the search timeout before trying the next peer
+func TestNetStoreSequentialWithoutLatencies(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SearchTimeout = d }(timeouts.SearchTimeout)
+	timeouts.SearchTimeout = 300 * time.Millisecond
+
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+
+	var (
+		mtx      sync.Mutex
+		requests int
+	)
+	ns.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests++
+		id := enode.ID{byte(requests)}
+		return &id, func() {}, nil
+	}
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		ns.Put(context.Background(), chunk.ModePutRequest, ch)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := ns.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address())); err != nil {
+		t.Fatal(err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if requests != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+}
+
+// TestNetStoreProbe checks that Probe requests a chunk from the network even if it is
+// stored locally, tries peers one at a time and returns the peer that delivered the chunk
+func TestNetStoreProbe(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SearchTimeout = d }(timeouts.SearchTimeout)
+	timeouts.SearchTimeout = 200 * time.Millisecond
+
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := ns.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// peer 1 is skipped, peer 2 does not deliver, peer 3 delivers
+	ns.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		for i := byte(1); i <= 3; i++ {
+			id := enode.ID{i}
+			if req.SkipPeer(id.String()) {
+				continue
+			}
+			if i == 3 {
+				go ns.Put(context.Background(), chunk.ModePutRequest, ch)
+			}
+			return &id, func() {}, nil
+		}
+		return nil, func() {}, ErrNoSuitablePeer
+	}
+
+	req := NewRequest(ch.Address())
+	req.PeersToSkip.Store(enode.ID{1}.String(), time.Now())
+	peer, err := ns.Probe(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *peer != (enode.ID{3}) {
+		t.Fatalf("expected delivery from peer %v, got %v", enode.ID{3}, *peer)
+	}
+
+	// no peers left to deliver
+	req = NewRequest(ch.Address())
+	for i := byte(1); i <= 3; i++ {
+		req.PeersToSkip.Store(enode.ID{i}.String(), time.Now())
+	}
+	if _, err := ns.Probe(context.Background(), req); err != ErrNoSuitablePeer {
+		t.Fatalf("expected error %v, got %v", ErrNoSuitablePeer, err)
+	}
+	if ns.fetchers.Contains(ch.Address().String()) {
+		t.Fatal("expected fetcher to be removed")
+	}
+}
+
+// TestNetStoreRecovery checks that a chunk that can not be retrieved is requested
+// to be recovered if recovery targets are set and retrieved again after re-upload
+func TestNetStoreRecovery(t *testing.T) {
+	defer func(d time.Duration) { timeouts.RecoveryRetryInterval = d }(timeouts.RecoveryRetryInterval)
+	timeouts.RecoveryRetryInterval = 50 * time.Millisecond
+
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+
+	var (
+		mtx       sync.Mutex
+		recovered bool
+		targets   [][]byte
+	)
+	ns.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if !recovered {
+			return nil, func() {}, ErrNoSuitablePeer
+		}
+		go ns.Put(context.Background(), chunk.ModePutRequest, ch)
+		return &enode.ID{1}, func() {}, nil
+	}
+	ns.Recover = func(ctx context.Context, t [][]byte, ref Address) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		recovered, targets = true, t
+		return nil
+	}
+
+	// without targets no recovery is requested
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := ns.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address())); err != ErrNoSuitablePeer {
+		t.Fatalf("expected error %v, got %v", ErrNoSuitablePeer, err)
+	}
+
+	want := [][]byte{{0xab}}
+	got, err := ns.Get(sctx.SetRecoveryTargets(ctx, want), chunk.ModeGetRequest, NewRequest(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Address(), ch.Address()) {
+		t.Fatalf("expected chunk %s, got %s", ch.Address(), got.Address())
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(targets) != 1 || !bytes.Equal(targets[0], want[0]) {
+		t.Fatalf("expected recovery targets %x, got %x", want, targets)
+	}
+}
+
+// TestNetStoreSynced checks that the synced hook is called only for new chunks stored through syncing
+func TestNetStoreSynced(t *testing.T) {
+	ns := NewNetStore(NewMapChunkStore(), network.NewBzzAddr(make([]byte, 32), nil))
+
+	var synced []Chunk
+	ns.Synced = func(_ context.Context, ch Chunk) {
+		synced = append(synced, ch)
+	}
+
+	chs := GenerateRandomChunks(chunk.DefaultSize, 2)
+	if _, err := ns.Put(context.Background(), chunk.ModePutRequest, chs[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ns.Put(context.Background(), chunk.ModePutSync, chs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(synced) != 1 || !bytes.Equal(synced[0].Address(), chs[1].Address()) {
+		t.Fatalf("expected synced chunk %s, got %v", chs[1].Address(), synced)
+	}
+}
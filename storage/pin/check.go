@@ -0,0 +1,329 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pin
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// Report is the result of cross-checking the pinned files against the pinned chunks
+// in the local store
+type Report struct {
+	Pins     int               // number of pinned files
+	Chunks   int               // number of pinned chunks in the local store
+	Orphans  []chunk.Address   // pinned chunks not reachable from any pinned file, nil if some pinned files could not be walked completely
+	Broken   []*BrokenPin      // pinned files with chunks missing from the local store or not pinned
+	Repaired []storage.Address // broken pins fixed by fetching and pinning their chunks
+	Unpinned int               // number of orphaned chunks unpinned
+
+	expected   map[string]uint64 // pin counters of the chunks reachable from the pinned files
+	pinned     map[string]uint64 // pin counters of the pinned chunks in the local store
+	incomplete bool              // whether some pinned files could not be walked completely
+}
+
+// BrokenPin describes the problems found with a pinned file
+type BrokenPin struct {
+	Address    storage.Address // root address of the pinned file
+	Missing    []chunk.Address // chunks missing from the local store
+	NotPinned  []chunk.Address // chunks in the local store which are not pinned
+	Incomplete bool            // whether tree or manifest chunks are missing, so not all chunks of the file are known
+}
+
+// CheckPins cross-checks the pinned files against the pinned chunks in the local store.
+// It reports the orphaned chunks which are pinned but not reachable from any pinned file
+// and the broken pins whose chunks are missing or not pinned. If fix is true, the missing
+// chunks of broken pins are fetched from the network and pinned, and the orphaned chunks
+// found once the broken pins are fetched are unpinned.
+func (p *API) CheckPins(ctx context.Context, fix bool) (*Report, error) {
+	r, err := p.checkPins(ctx)
+	if err != nil || !fix {
+		return r, err
+	}
+
+	last := r
+	if len(r.Broken) > 0 {
+		for _, b := range r.Broken {
+			if len(b.Missing) == 0 && !b.Incomplete {
+				continue
+			}
+			pinInfo, err := p.getPinnedFile(b.Address)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.fetch(ctx, pinInfo); err != nil {
+				log.Warn("Could not fetch broken pin", "rootHash", hex.EncodeToString(b.Address), "err", err)
+			}
+		}
+		// check again to find the chunks of the fetched files
+		last, err = p.checkPins(ctx)
+		if err != nil {
+			return nil, err
+		}
+		repaired := make(map[string]bool)
+		for _, b := range r.Broken {
+			repaired[string(b.Address)] = true
+		}
+		for _, b := range last.Broken {
+			if len(b.Missing) > 0 || b.Incomplete {
+				repaired[string(b.Address)] = false
+				continue
+			}
+			for _, addr := range b.NotPinned {
+				// the chunk is pinned once for each time it is reachable from a pinned file
+				for i := last.pinned[string(addr)]; i < last.expected[string(addr)]; i++ {
+					if err := p.db.Set(ctx, chunk.ModeSetPin, addr); err != nil {
+						return nil, err
+					}
+				}
+				last.pinned[string(addr)] = last.expected[string(addr)]
+			}
+		}
+		for _, b := range r.Broken {
+			if repaired[string(b.Address)] {
+				r.Repaired = append(r.Repaired, b.Address)
+			}
+		}
+	}
+
+	for _, addr := range last.Orphans {
+		for i := uint64(0); i < last.pinned[string(addr)]; i++ {
+			if err := p.db.Set(ctx, chunk.ModeSetUnpin, addr); err != nil {
+				return nil, err
+			}
+		}
+		r.Unpinned++
+	}
+	return r, nil
+}
+
+// checkPins walks the pinned files in the local store and compares their chunks
+// with the pinned chunks
+func (p *API) checkPins(ctx context.Context) (*Report, error) {
+	pins, err := p.ListPins()
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Pins:     len(pins),
+		expected: make(map[string]uint64),
+		pinned:   make(map[string]uint64),
+	}
+	err = p.db.IteratePinned(func(addr chunk.Address, pinCounter uint64) (stop bool, err error) {
+		r.pinned[string(addr)] = pinCounter
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.Chunks = len(r.pinned)
+
+	fileStore, local := p.localFileStore()
+	for _, pinInfo := range pins {
+		b := &BrokenPin{
+			Address: pinInfo.Address,
+		}
+		complete, err := p.walkLocal(ctx, fileStore, local, pinInfo, func(ref storage.Reference) error {
+			addr := chunk.Address(p.removeDecryptionKeyFromChunkHash(ref))
+			r.expected[string(addr)] += pinInfo.PinCounter
+			has, err := p.db.Has(ctx, addr)
+			if err != nil {
+				return err
+			}
+			if !has {
+				b.Missing = append(b.Missing, addr)
+			} else if r.pinned[string(addr)] == 0 {
+				b.NotPinned = append(b.NotPinned, addr)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.Incomplete = !complete
+		if len(b.Missing) > 0 || len(b.NotPinned) > 0 || b.Incomplete {
+			r.Broken = append(r.Broken, b)
+			log.Debug("Broken pin", "rootHash", hex.EncodeToString(b.Address), "missing", len(b.Missing), "notPinned", len(b.NotPinned), "incomplete", b.Incomplete)
+		}
+		if b.Incomplete {
+			r.incomplete = true
+		}
+	}
+
+	if r.incomplete {
+		// orphans can not be told apart from the chunks of files that could not be walked
+		return r, nil
+	}
+	for addr := range r.pinned {
+		if _, ok := r.expected[addr]; !ok {
+			r.Orphans = append(r.Orphans, chunk.Address(addr))
+		}
+	}
+	return r, nil
+}
+
+// localFileStore returns a file store and an API which read the chunks
+// from the local store only
+func (p *API) localFileStore() (*storage.FileStore, *api.API) {
+	params := p.fileParams
+	if params == nil {
+		params = storage.NewFileStoreParams()
+	}
+	fileStore := storage.NewFileStore(p.db, p.db, params, p.tag)
+	return fileStore, api.NewAPI(fileStore, nil, nil, nil, nil, p.tag)
+}
+
+// walkLocal calls walkFn for every chunk of the pinned file found by walking the chunk
+// trees of the file in the local store, the same way the chunks are walked when the
+// file is pinned. It returns false if not all chunks could be walked because tree or
+// manifest chunks are missing.
+func (p *API) walkLocal(ctx context.Context, fileStore *storage.FileStore, local *api.API, pinInfo PinInfo, walkFn func(storage.Reference) error) (complete bool, err error) {
+	var fnErr error
+	walk := func(ref storage.Reference) error {
+		fnErr = walkFn(ref)
+		return fnErr
+	}
+
+	complete = true
+	refs := []storage.Reference{storage.Reference(pinInfo.Address)}
+	if !pinInfo.IsRaw {
+		walker, err := local.NewManifestWalker(ctx, pinInfo.Address, p.api.Decryptor(ctx, ""), nil)
+		if err != nil {
+			complete = false
+		} else {
+			err = walker.Walk(func(entry *api.ManifestEntry) error {
+				ref, err := hex.DecodeString(entry.Hash)
+				if err != nil {
+					return err
+				}
+				refs = append(refs, ref)
+				return nil
+			})
+			if err != nil {
+				complete = false
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if err := fileStore.Walk(ctx, storage.Address(ref), walk); err != nil {
+			if fnErr != nil {
+				return false, fnErr
+			}
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			complete = false
+		}
+	}
+	return complete, nil
+}
+
+// fetch retrieves all chunks of the pinned file through the swarm API, which stores
+// the chunks fetched from the network in the local store
+func (p *API) fetch(ctx context.Context, pinInfo PinInfo) error {
+	// fetching is not interactive, so do not compete with downloads for retrievals
+	ctx = sctx.SetBackground(ctx)
+	refs := []storage.Reference{storage.Reference(pinInfo.Address)}
+	if !pinInfo.IsRaw {
+		walker, err := p.api.NewManifestWalker(ctx, pinInfo.Address, p.api.Decryptor(ctx, ""), nil)
+		if err != nil {
+			return err
+		}
+		err = walker.Walk(func(entry *api.ManifestEntry) error {
+			ref, err := hex.DecodeString(entry.Hash)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, ref)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		reader, _ := p.api.Retrieve(ctx, storage.Address(ref))
+		size, err := reader.Size(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, io.NewSectionReader(reader, 0, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartCheck checks the pins periodically at the given interval, fixing the problems
+// found if fix is true. The returned function stops the checks.
+func (p *API) StartCheck(interval time.Duration, fix bool) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			r, err := p.CheckPins(ctx, fix)
+			if err != nil {
+				log.Error("Error checking pins", "err", err)
+				continue
+			}
+			log.Info("Checked pins", "pins", r.Pins, "chunks", r.Chunks, "orphans", len(r.Orphans),
+				"broken", len(r.Broken), "repaired", len(r.Repaired), "unpinned", r.Unpinned)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// CheckAPI is the RPC API to check the pins of the node
+type CheckAPI struct {
+	p *API
+}
+
+// NewCheckAPI creates the RPC API to check the pins of the node
+func NewCheckAPI(p *API) *CheckAPI {
+	return &CheckAPI{p: p}
+}
+
+// Check cross-checks the pinned files against the pinned chunks and reports the orphaned
+// chunks and the broken pins. If fix is true, broken pins are fetched and orphaned chunks
+// are unpinned.
+func (a *CheckAPI) Check(ctx context.Context, fix bool) (*Report, error) {
+	return a.p.CheckPins(ctx, fix)
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestCheckPins tests that orphaned pinned chunks and broken pins are reported
+// and fixed by unpinning the orphans and fetching the missing chunks
+func TestCheckPins(t *testing.T) {
+	p, f, closeFunc := getPinApiAndFileStore(t)
+	defer closeFunc()
+
+	rawHash := uploadFile(t, f, testutil.RandomBytes(10, 10000), false)
+	collectionHash := uploadCollection(t, p, f, false)
+	if err := p.PinFiles(rawHash, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PinFiles(collectionHash, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := p.CheckPins(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Pins != 2 || len(r.Orphans) != 0 || len(r.Broken) != 0 {
+		t.Fatalf("expected 2 healthy pins, got %d pins, %d orphans, %d broken", r.Pins, len(r.Orphans), len(r.Broken))
+	}
+
+	// pin the chunk of a file which is not pinned itself
+	orphan := uploadFile(t, f, testutil.RandomBytes(11, 100), false)
+	if err := p.db.Set(context.Background(), chunk.ModeSetPin, chunk.Address(orphan)); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove a data chunk of the pinned raw file
+	var refs []storage.Reference
+	err = f.Walk(context.Background(), rawHash, func(ref storage.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := chunk.Address(refs[len(refs)-1])
+	ch, err := p.db.Get(context.Background(), chunk.ModeGetRequest, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.db.Set(context.Background(), chunk.ModeSetRemove, missing); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = p.CheckPins(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Orphans) != 1 || !bytes.Equal(r.Orphans[0], orphan) {
+		t.Fatalf("expected orphan %s, got %v", chunk.Address(orphan), r.Orphans)
+	}
+	if len(r.Broken) != 1 {
+		t.Fatalf("expected 1 broken pin, got %d", len(r.Broken))
+	}
+	b := r.Broken[0]
+	if !bytes.Equal(b.Address, rawHash) || len(b.Missing) != 1 || !bytes.Equal(b.Missing[0], missing) || b.Incomplete {
+		t.Fatalf("expected broken pin %s missing chunk %s, got %s missing %v", rawHash, missing, b.Address, b.Missing)
+	}
+
+	// the missing chunk can be fetched from the network
+	fetcher := &fetchingStore{
+		DB:     p.db,
+		remote: map[string]chunk.Chunk{string(missing): ch},
+	}
+	p.api = api.NewAPI(storage.NewFileStore(fetcher, fetcher, storage.NewFileStoreParams(), p.tag), nil, nil, nil, nil, p.tag)
+
+	r, err = p.CheckPins(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Repaired) != 1 || !bytes.Equal(r.Repaired[0], rawHash) {
+		t.Fatalf("expected repaired pin %s, got %v", rawHash, r.Repaired)
+	}
+	if r.Unpinned != 1 {
+		t.Fatalf("expected 1 unpinned chunk, got %d", r.Unpinned)
+	}
+
+	r, err = p.CheckPins(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Pins != 2 || len(r.Orphans) != 0 || len(r.Broken) != 0 {
+		t.Fatalf("expected 2 healthy pins after fix, got %d pins, %d orphans, %d broken", r.Pins, len(r.Orphans), len(r.Broken))
+	}
+}
+
+// fetchingStore is a local store which retrieves the chunks not found locally
+// from the remote chunks, as if they were fetched from the network
+type fetchingStore struct {
+	*localstore.DB
+	remote map[string]chunk.Chunk
+}
+
+func (s *fetchingStore) Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (chunk.Chunk, error) {
+	ch, err := s.DB.Get(ctx, mode, addr)
+	if err != chunk.ErrChunkNotFound {
+		return ch, err
+	}
+	ch, ok := s.remote[string(addr)]
+	if !ok {
+		return nil, err
+	}
+	if _, err := s.DB.Put(ctx, chunk.ModePutRequest, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
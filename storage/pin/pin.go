@@ -26,6 +26,7 @@ import (
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/localstore"
@@ -280,7 +281,8 @@ func (p *API) walkChunksFromRootHash(addr []byte, isRaw bool, credentials string
 		defer fwg.Done()
 		if !isRaw {
 			// If it is not a raw file... load the manifest and add the files inside one by one
-			walker, err := p.api.NewManifestWalker(context.Background(), storage.Address(addr),
+			// pinning is not interactive, so do not compete with downloads for retrievals
+			walker, err := p.api.NewManifestWalker(sctx.SetBackground(context.Background()), storage.Address(addr),
 				p.api.Decryptor(context.Background(), credentials), nil)
 			if err != nil {
 				log.Error("Could not decode manifest.", "err", err)
@@ -379,7 +381,7 @@ QuitChunkFor:
 			cwg.Add(1)
 			go func() {
 				defer cwg.Done()
-				chunkData, err := getter.Get(context.Background(), ref)
+				chunkData, err := getter.Get(sctx.SetBackground(context.Background()), ref)
 				if err != nil {
 					log.Error("Error getting chunk data from localstore.",
 						"Address", hex.EncodeToString(ref), "err", err)
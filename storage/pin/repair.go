@@ -0,0 +1,238 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pin
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// DefaultRepairSamples is the default number of chunks of each pinned file
+// checked in a round of the periodic repair
+const DefaultRepairSamples = 16
+
+// repairWorkers is the number of chunks checked concurrently by a repair
+const repairWorkers = 8
+
+var (
+	repairChecked    = metrics.NewRegisteredCounter("pin/repair/checked", nil)
+	repairMissing    = metrics.NewRegisteredCounter("pin/repair/missing", nil)
+	repairReuploaded = metrics.NewRegisteredCounter("pin/repair/reuploaded", nil)
+)
+
+// Prober retrieves a chunk from the network bypassing the local store and
+// returns the peer it was retrieved through
+type Prober interface {
+	Probe(ctx context.Context, req *storage.Request) (*enode.ID, error)
+}
+
+// RepairReport is the result of the repair of a pinned file
+type RepairReport struct {
+	Address    storage.Address // root address of the pinned file
+	Chunks     int             // number of chunks of the file in the local store
+	Checked    int             // number of chunks checked for retrievability from the network
+	Missing    []chunk.Address // checked chunks that could not be retrieved from the network
+	Reuploaded []chunk.Address // missing chunks pushed to the network again from the local store
+	Incomplete bool            // whether tree or manifest chunks are missing from the local store, so not all chunks of the file are known
+}
+
+// Repairer verifies that the chunks of the pinned files can be retrieved from
+// the network and re-uploads the missing ones from the local store
+type Repairer struct {
+	p      *API
+	prober Prober
+}
+
+// NewRepairer creates a Repairer of the pins of the API, probing the network with prober
+func NewRepairer(p *API, prober Prober) *Repairer {
+	return &Repairer{
+		p:      p,
+		prober: prober,
+	}
+}
+
+// Repair retrieves a random sample of the chunks of the pinned file from the network,
+// or all of its chunks if samples is 0, and pushes the chunks that could not be
+// retrieved to the network again
+func (r *Repairer) Repair(ctx context.Context, addr storage.Address, samples int) (*RepairReport, error) {
+	pinInfo, err := r.p.getPinnedFile(addr)
+	if err != nil {
+		return nil, err
+	}
+	report := &RepairReport{
+		Address: addr,
+	}
+
+	var addrs []chunk.Address
+	seen := make(map[string]bool)
+	fileStore, local := r.p.localFileStore()
+	complete, err := r.p.walkLocal(ctx, fileStore, local, pinInfo, func(ref storage.Reference) error {
+		a := chunk.Address(r.p.removeDecryptionKeyFromChunkHash(ref))
+		if !seen[string(a)] {
+			seen[string(a)] = true
+			addrs = append(addrs, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Incomplete = !complete
+	report.Chunks = len(addrs)
+
+	if samples > 0 && samples < len(addrs) {
+		rand.Shuffle(len(addrs), func(i, j int) {
+			addrs[i], addrs[j] = addrs[j], addrs[i]
+		})
+		addrs = addrs[:samples]
+	}
+	report.Checked = len(addrs)
+
+	// checking is not interactive, so do not compete with downloads for retrievals
+	ctx = sctx.SetBackground(ctx)
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, repairWorkers)
+	)
+	for _, a := range addrs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a chunk.Address) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			repairChecked.Inc(1)
+			if r.retrievable(ctx, a) {
+				return
+			}
+			repairMissing.Inc(1)
+			reuploaded := true
+			if err := r.p.db.Set(ctx, chunk.ModeSetReUpload, a); err != nil {
+				log.Warn("Could not re-upload missing chunk of pin", "rootHash", hex.EncodeToString(addr), "ref", a, "err", err)
+				reuploaded = false
+			} else {
+				repairReuploaded.Inc(1)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Missing = append(report.Missing, a)
+			if reuploaded {
+				report.Reuploaded = append(report.Reuploaded, a)
+			}
+		}(a)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// retrievable reports whether the chunk can be retrieved from the network
+func (r *Repairer) retrievable(ctx context.Context, addr chunk.Address) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.FetcherGlobalTimeout)
+	defer cancel()
+	_, err := r.prober.Probe(ctx, storage.NewRequestWithContext(ctx, addr))
+	if err != nil {
+		log.Debug("Pinned chunk not retrievable", "ref", addr, "err", err)
+		return false
+	}
+	return true
+}
+
+// RepairAll repairs all pinned files, checking a random sample of the chunks of each
+func (r *Repairer) RepairAll(ctx context.Context, samples int) ([]*RepairReport, error) {
+	pins, err := r.p.ListPins()
+	if err != nil {
+		return nil, err
+	}
+	var reports []*RepairReport
+	for _, pinInfo := range pins {
+		report, err := r.Repair(ctx, pinInfo.Address, samples)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Start repairs the pins periodically at the given interval, checking a random
+// sample of the chunks of each pinned file. The returned function stops the repairs.
+func (r *Repairer) Start(interval time.Duration, samples int) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			reports, err := r.RepairAll(ctx, samples)
+			if err != nil {
+				log.Error("Error repairing pins", "err", err)
+				continue
+			}
+			var checked, missing, reuploaded int
+			for _, report := range reports {
+				checked += report.Checked
+				missing += len(report.Missing)
+				reuploaded += len(report.Reuploaded)
+			}
+			log.Info("Repaired pins", "pins", len(reports), "checked", checked, "missing", missing, "reuploaded", reuploaded)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// RepairAPI is the RPC API to repair the pins of the node
+type RepairAPI struct {
+	r *Repairer
+}
+
+// NewRepairAPI creates the RPC API to repair the pins of the node
+func NewRepairAPI(r *Repairer) *RepairAPI {
+	return &RepairAPI{r: r}
+}
+
+// Repair checks that all chunks of the pinned file can be retrieved from the network
+// and re-uploads the missing ones
+func (a *RepairAPI) Repair(ctx context.Context, addr storage.Address) (*RepairReport, error) {
+	return a.r.Repair(ctx, addr, 0)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// testProber fails to retrieve the chunks marked missing
+type testProber struct {
+	mu      sync.Mutex
+	missing map[string]bool
+	probed  int
+}
+
+func (p *testProber) Probe(ctx context.Context, req *storage.Request) (*enode.ID, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.probed++
+	if p.missing[string(req.Addr)] {
+		return nil, errors.New("not found")
+	}
+	return &enode.ID{}, nil
+}
+
+// TestRepair tests that the chunks of a pinned file which can not be retrieved
+// from the network are re-uploaded
+func TestRepair(t *testing.T) {
+	p, f, closeFunc := getPinApiAndFileStore(t)
+	defer closeFunc()
+
+	rawHash := uploadFile(t, f, testutil.RandomBytes(10, 10000), false)
+	if err := p.PinFiles(rawHash, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	var addrs []chunk.Address
+	err := f.Walk(context.Background(), rawHash, func(ref storage.Reference) error {
+		addrs = append(addrs, chunk.Address(ref))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the chunks are synced, so nothing is left to push
+	if err := p.db.Set(context.Background(), chunk.ModeSetSyncPush, addrs...); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := addrs[len(addrs)-1]
+	prober := &testProber{missing: map[string]bool{string(missing): true}}
+	r := NewRepairer(p, prober)
+
+	report, err := r.Repair(context.Background(), rawHash, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Chunks != len(addrs) || report.Checked != 2 || report.Incomplete {
+		t.Fatalf("expected 2 of %d chunks checked, got %+v", len(addrs), report)
+	}
+
+	report, err = r.Repair(context.Background(), rawHash, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != len(addrs) {
+		t.Fatalf("expected all %d chunks checked, got %d", len(addrs), report.Checked)
+	}
+	if len(report.Missing) != 1 || !bytes.Equal(report.Missing[0], missing) {
+		t.Fatalf("expected missing chunk %s, got %v", missing, report.Missing)
+	}
+	if len(report.Reuploaded) != 1 || !bytes.Equal(report.Reuploaded[0], missing) {
+		t.Fatalf("expected re-uploaded chunk %s, got %v", missing, report.Reuploaded)
+	}
+
+	// the missing chunk is pushed again
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chunkC, stop := p.db.SubscribePush(ctx)
+	defer stop()
+	select {
+	case ch := <-chunkC:
+		if !bytes.Equal(ch.Address(), missing) {
+			t.Fatalf("expected push of %s, got %s", missing, ch.Address())
+		}
+	case <-ctx.Done():
+		t.Fatal("missing chunk was not re-uploaded")
+	}
+
+	if _, err := r.Repair(context.Background(), storage.Address(testutil.RandomBytes(1, 32)), 0); err == nil {
+		t.Fatal("expected error repairing an address which is not pinned")
+	}
+
+	reports, err := r.RepairAll(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Checked != 1 {
+		t.Fatalf("expected 1 chunk of 1 pin checked, got %+v", reports)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// DefaultProgressiveWindow is the default number of data chunks fetched ahead of the read position
+const DefaultProgressiveWindow = 16
+
+// ErrReadTimeout is returned by a progressive read when the data at the read position
+// did not arrive in time. Fetching continues and the read can be retried.
+var ErrReadTimeout = errors.New("read timeout")
+
+// ProgressiveReaderParams configures a ProgressiveReader
+type ProgressiveReaderParams struct {
+	Window      int           // number of data chunks fetched ahead of the read position, DefaultProgressiveWindow if 0
+	ReadTimeout time.Duration // maximum time a read waits for data, 0 for no limit
+}
+
+// ProgressiveReader reads a document sequentially, returning its bytes as soon as
+// the data chunks at the read position arrive, while the following chunks are still
+// being fetched concurrently. Reads are not safe for concurrent use.
+type ProgressiveReader struct {
+	reader      *LazyChunkReader
+	cancel      context.CancelFunc
+	window      int64
+	readTimeout time.Duration
+	off         int64                       // read position
+	size        int64                       // size of the document, set once sizeC is closed
+	sizeErr     error                       // error retrieving the root chunk, set once sizeC is closed
+	sizeC       chan struct{}               // closed when the root chunk is retrieved
+	chunks      map[int64]*progressiveChunk // fetched data chunks by index
+}
+
+// progressiveChunk is the data of a chunk fetched by a ProgressiveReader
+type progressiveChunk struct {
+	data  []byte
+	err   error
+	ready chan struct{} // closed when data or err is set
+}
+
+// RetrieveProgressive returns a reader of the document with the given root address
+// which returns bytes as soon as the leading chunks arrive
+func (f *FileStore) RetrieveProgressive(ctx context.Context, addr Address, params *ProgressiveReaderParams) *ProgressiveReader {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, _ := f.Retrieve(ctx, addr)
+	return newProgressiveReader(reader, cancel, params)
+}
+
+func newProgressiveReader(reader *LazyChunkReader, cancel context.CancelFunc, params *ProgressiveReaderParams) *ProgressiveReader {
+	if params == nil {
+		params = &ProgressiveReaderParams{}
+	}
+	window := params.Window
+	if window <= 0 {
+		window = DefaultProgressiveWindow
+	}
+	r := &ProgressiveReader{
+		reader:      reader,
+		cancel:      cancel,
+		window:      int64(window),
+		readTimeout: params.ReadTimeout,
+		sizeC:       make(chan struct{}),
+		chunks:      make(map[int64]*progressiveChunk),
+	}
+	go func() {
+		r.size, r.sizeErr = reader.Size(reader.Context(), nil)
+		close(r.sizeC)
+	}()
+	return r
+}
+
+// SetReadTimeout sets the maximum time the following reads wait for data, 0 for no limit
+func (r *ProgressiveReader) SetReadTimeout(timeout time.Duration) {
+	r.readTimeout = timeout
+}
+
+// Size returns the size of the document, waiting for the root chunk at most the read timeout
+func (r *ProgressiveReader) Size() (int64, error) {
+	timeout, stop := r.timeout()
+	defer stop()
+	if err := r.waitSize(timeout); err != nil {
+		return 0, err
+	}
+	return r.size, nil
+}
+
+// Read reads from the read position, waiting for the data chunk at the read position
+// at most the read timeout. It returns ErrReadTimeout if the data did not arrive in time.
+func (r *ProgressiveReader) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	timeout, stop := r.timeout()
+	defer stop()
+	if err := r.waitSize(timeout); err != nil {
+		return 0, err
+	}
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+
+	index := r.off / chunk.DefaultSize
+	r.fetch(index)
+	c := r.chunks[index]
+	select {
+	case <-c.ready:
+	case <-timeout:
+		metrics.GetOrRegisterCounter("storage/progressive/read/timeout", nil).Inc(1)
+		return 0, ErrReadTimeout
+	case <-r.reader.Context().Done():
+		return 0, r.reader.Context().Err()
+	}
+	if c.err != nil {
+		// retry fetching the chunk on the next read
+		delete(r.chunks, index)
+		return 0, c.err
+	}
+
+	n = copy(b, c.data[r.off-index*chunk.DefaultSize:])
+	r.off += int64(n)
+	if r.off >= (index+1)*chunk.DefaultSize {
+		delete(r.chunks, index)
+	}
+	metrics.GetOrRegisterCounter("storage/progressive/read/bytes", nil).Inc(int64(n))
+	return n, nil
+}
+
+// Close stops fetching chunks
+func (r *ProgressiveReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// timeout returns the channel signalling the end of the read timeout and a function releasing its timer
+func (r *ProgressiveReader) timeout() (<-chan time.Time, func()) {
+	if r.readTimeout <= 0 {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(r.readTimeout)
+	return timer.C, func() { timer.Stop() }
+}
+
+// waitSize waits for the root chunk to be retrieved
+func (r *ProgressiveReader) waitSize(timeout <-chan time.Time) error {
+	select {
+	case <-r.sizeC:
+		return r.sizeErr
+	case <-timeout:
+		metrics.GetOrRegisterCounter("storage/progressive/read/timeout", nil).Inc(1)
+		return ErrReadTimeout
+	}
+}
+
+// fetch starts fetching the data chunks in the window starting at the chunk with the index
+// which are not fetched yet
+func (r *ProgressiveReader) fetch(index int64) {
+	for i := index; i < index+r.window && i*chunk.DefaultSize < r.size; i++ {
+		if _, ok := r.chunks[i]; ok {
+			continue
+		}
+		c := &progressiveChunk{
+			ready: make(chan struct{}),
+		}
+		r.chunks[i] = c
+		go func(off int64) {
+			length := r.size - off
+			if length > chunk.DefaultSize {
+				length = chunk.DefaultSize
+			}
+			data := make([]byte, length)
+			n, err := r.reader.ReadAt(data, off)
+			if err == io.EOF {
+				err = nil
+			}
+			c.data, c.err = data[:n], err
+			close(c.ready)
+		}(i * chunk.DefaultSize)
+	}
+}
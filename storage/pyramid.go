@@ -469,6 +469,12 @@ func (pc *PyramidChunker) prepareChunks(ctx context.Context, isAppend bool) {
 					break
 				}
 			} else {
+				// report the read error so that the split fails instead of
+				// returning a root address without waiting for the chunks
+				select {
+				case pc.errC <- err:
+				case <-pc.quitC:
+				}
 				pc.quit()
 				break
 			}
@@ -0,0 +1,73 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package recovery implements the recovery of content that can not be retrieved
+// from the network. Downloaders publish recovery requests as trojan messages to the
+// neighbourhoods of pinning nodes, which re-upload the requested chunks if they have
+// them pinned.
+package recovery
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/trojan"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// Topic is the topic of recovery request trojan messages,
+// the payload of which is the address of the missing chunk
+var Topic = trojan.NewTopic("RECOVERY")
+
+// NewRecoverFunc returns a storage.RecoverFunc that sends recovery requests
+// with the dispatcher
+func NewRecoverFunc(d *trojan.Dispatcher) storage.RecoverFunc {
+	return func(ctx context.Context, targets [][]byte, ref storage.Address) error {
+		metrics.GetOrRegisterCounter("recovery/request", nil).Inc(1)
+		return d.Send(ctx, targets, Topic, ref)
+	}
+}
+
+// Store is the interface of the local store holding the pinned chunks
+type Store interface {
+	Get(ctx context.Context, mode chunk.ModeGet, addr chunk.Address) (chunk.Chunk, error)
+	Set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Address) error
+}
+
+// NewResponder registers a handler on the dispatcher that re-uploads the chunks
+// requested by recovery requests if they are pinned in the store.
+// It returns a function that deregisters the handler.
+func NewResponder(d *trojan.Dispatcher, store Store) (deregister func()) {
+	return d.Register(Topic, func(ctx context.Context, m *trojan.Message) {
+		if len(m.Payload) != chunk.AddressLength {
+			log.Debug("invalid recovery request", "payload", len(m.Payload))
+			return
+		}
+		addr := chunk.Address(m.Payload)
+		if _, err := store.Get(ctx, chunk.ModeGetPin, addr); err != nil {
+			log.Trace("recovery request for chunk that is not pinned", "ref", addr)
+			return
+		}
+		if err := store.Set(ctx, chunk.ModeSetReUpload, addr); err != nil {
+			log.Error("recovery re-upload failed", "ref", addr, "err", err)
+			return
+		}
+		log.Debug("re-uploading chunk on recovery request", "ref", addr)
+		metrics.GetOrRegisterCounter("recovery/reupload", nil).Inc(1)
+	})
+}
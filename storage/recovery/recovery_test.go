@@ -0,0 +1,106 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/pss/trojan"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/localstore"
+)
+
+type uploadStore struct {
+	chunks []chunk.Chunk
+}
+
+func (s *uploadStore) Put(_ context.Context, _ chunk.ModePut, chs ...chunk.Chunk) ([]bool, error) {
+	s.chunks = append(s.chunks, chs...)
+	return make([]bool, len(chs)), nil
+}
+
+// TestRecovery checks that recovery requests for pinned chunks
+// make the responder push sync the chunks again
+func TestRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	chs := storage.GenerateRandomChunks(chunk.DefaultSize, 2)
+	pinned, unpinned := chs[0], chs[1]
+	if _, err := db.Put(ctx, chunk.ModePutUpload, chs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, chunk.ModeSetPin, pinned.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, chunk.ModeSetSyncPush, pinned.Address(), unpinned.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := &uploadStore{}
+	d := trojan.NewDispatcher(uploads)
+	deregister := NewResponder(d, db)
+	defer deregister()
+
+	recoverFunc := NewRecoverFunc(d)
+	targets := [][]byte{{0x42}}
+	for _, ch := range []chunk.Chunk{unpinned, pinned} {
+		if err := recoverFunc(ctx, targets, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(uploads.chunks) != 2 {
+		t.Fatalf("got %d recovery requests, want 2", len(uploads.chunks))
+	}
+	for _, ch := range uploads.chunks {
+		if !bytes.HasPrefix(ch.Address(), targets[0]) {
+			t.Fatalf("recovery request %s not sent to target %x", ch.Address(), targets[0])
+		}
+		d.Deliver(ctx, ch)
+	}
+
+	pushed, stop := db.SubscribePush(ctx)
+	defer stop()
+	select {
+	case ch := <-pushed:
+		if !bytes.Equal(ch.Address(), pinned.Address()) {
+			t.Fatalf("got pushed chunk %s, want %s", ch.Address(), pinned.Address())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pinned chunk is not pushed")
+	}
+	select {
+	case ch := <-pushed:
+		t.Fatalf("unexpected pushed chunk %s", ch.Address())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
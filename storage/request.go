@@ -17,14 +17,30 @@
 package storage
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/sctx"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
 
+// Priority is the priority lane of a chunk retrieval request
+type Priority int
+
+// Priority lanes from lowest to highest: metadata (manifest and intermediate
+// tree chunks) is served before data, interactive retrievals before background ones
+const (
+	PriorityBackgroundData Priority = iota
+	PriorityBackgroundMetadata
+	PriorityData
+	PriorityMetadata
+
+	NumPriorities = int(PriorityMetadata) + 1
+)
+
 // Request encapsulates all the necessary arguments when making a request to NetStore.
 // These could have also been added as part of the interface of NetStore.Get, but a request struct seemed
 // like a better option
@@ -32,14 +48,34 @@ type Request struct {
 	Addr        Address  // chunk address
 	Origin      enode.ID // who is sending us that request? we compare Origin to the suggested peer from RequestFromPeers
 	PeersToSkip sync.Map // peers not to request chunk from
+	Priority    Priority // priority lane used when scheduling the retrieval
+	Client      string   // who the retrieval is done for, used for fairness among concurrent downloads
 }
 
 // NewRequest returns a new instance of Request based on chunk address skip check and
 // a map of peers to skip.
 func NewRequest(addr Address) *Request {
 	return &Request{
-		Addr: addr,
+		Addr:     addr,
+		Priority: PriorityData,
+	}
+}
+
+// NewRequestWithContext returns a new instance of Request with the priority and client
+// set according to the retrieval markers of the context (see the sctx package)
+func NewRequestWithContext(ctx context.Context, addr Address) *Request {
+	r := NewRequest(addr)
+	background, metadata := sctx.IsBackground(ctx), sctx.IsMetadata(ctx)
+	switch {
+	case background && metadata:
+		r.Priority = PriorityBackgroundMetadata
+	case background:
+		r.Priority = PriorityBackgroundData
+	case metadata:
+		r.Priority = PriorityMetadata
 	}
+	r.Client = sctx.GetClient(ctx)
+	return r
 }
 
 // SkipPeer returns if the peer with nodeID should not be requested to deliver a chunk.
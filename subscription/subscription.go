@@ -0,0 +1,224 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package subscription bounds the notifications buffered for the clients of RPC
+// subscriptions. Notifications are queued in a buffer of a size the client selects
+// and sent from the buffer on a separate goroutine, so a slow client neither blocks
+// the producer nor grows the buffer without limit. When the buffer is full the
+// oldest or the newest notification is dropped, or the producer pauses until the
+// client catches up, as selected by the client.
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+)
+
+// Policy selects what happens to a notification when the buffer is full
+type Policy string
+
+// buffer policies
+const (
+	DropOldest Policy = "drop-oldest" // the oldest buffered notification is dropped
+	DropNewest Policy = "drop-newest" // the new notification is dropped
+	Pause      Policy = "pause"       // the producer waits until the client catches up
+)
+
+// default and maximum number of buffered notifications
+const (
+	DefaultBufferSize = 64
+	MaxBufferSize     = 4096
+)
+
+// ErrClosed is returned by Notify once the subscription is closed
+var ErrClosed = errors.New("subscription closed")
+
+var droppedCount = metrics.NewRegisteredCounter("rpc/subscription/dropped", nil)
+
+// Options are the buffering options a client selects for a subscription
+type Options struct {
+	Buffer int    `json:"buffer"` // maximum number of buffered notifications, DefaultBufferSize if 0
+	Policy Policy `json:"policy"` // what happens when the buffer is full, the default of the stream if empty
+}
+
+// Notifier sends the notifications of an RPC subscription from a bounded buffer
+type Notifier struct {
+	send   func(interface{}) error
+	size   int
+	policy Policy
+
+	mu      sync.Mutex
+	queue   []interface{}
+	dropped uint64
+
+	readyC    chan struct{} // signals notifications in the buffer
+	roomC     chan struct{} // signals room in the buffer to paused producers
+	quitC     chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a Notifier for the subscription of the RPC notifier with the options
+// selected by the client, the default buffer size and the policy of the stream if nil.
+// Streams of state snapshots default to DropOldest as only the latest state matters,
+// streams of messages to Pause. The Notifier is closed when the client unsubscribes
+// or the connection is closed.
+func New(notifier *rpc.Notifier, sub *rpc.Subscription, opts *Options, policy Policy) (*Notifier, error) {
+	n, err := newNotifier(func(data interface{}) error {
+		return notifier.Notify(sub.ID, data)
+	}, opts, policy)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-sub.Err():
+		case <-notifier.Closed():
+		case <-n.quitC:
+		}
+		n.close()
+	}()
+	return n, nil
+}
+
+// newNotifier validates the options and starts sending the buffered notifications with send
+func newNotifier(send func(interface{}) error, opts *Options, policy Policy) (*Notifier, error) {
+	n := &Notifier{
+		send:   send,
+		size:   DefaultBufferSize,
+		policy: policy,
+		readyC: make(chan struct{}, 1),
+		roomC:  make(chan struct{}, 1),
+		quitC:  make(chan struct{}),
+	}
+	if opts != nil {
+		if opts.Buffer < 0 || opts.Buffer > MaxBufferSize {
+			return nil, fmt.Errorf("invalid subscription buffer %d, must be at most %d", opts.Buffer, MaxBufferSize)
+		}
+		if opts.Buffer > 0 {
+			n.size = opts.Buffer
+		}
+		switch opts.Policy {
+		case "":
+		case DropOldest, DropNewest, Pause:
+			n.policy = opts.Policy
+		default:
+			return nil, fmt.Errorf("invalid subscription policy %q", opts.Policy)
+		}
+	}
+	go n.loop()
+	return n, nil
+}
+
+// Notify buffers the notification to be sent to the client. If the buffer is full,
+// the oldest or the new notification is dropped or Notify blocks until there is room,
+// depending on the policy. It returns ErrClosed once the subscription is closed.
+func (n *Notifier) Notify(data interface{}) error {
+	for {
+		n.mu.Lock()
+		select {
+		case <-n.quitC:
+			n.mu.Unlock()
+			return ErrClosed
+		default:
+		}
+		if len(n.queue) < n.size {
+			n.queue = append(n.queue, data)
+			n.mu.Unlock()
+			signal(n.readyC)
+			return nil
+		}
+		switch n.policy {
+		case DropOldest:
+			n.queue[0] = nil
+			n.queue = append(n.queue[1:], data)
+			n.dropped++
+			n.mu.Unlock()
+			droppedCount.Inc(1)
+			return nil
+		case DropNewest:
+			n.dropped++
+			n.mu.Unlock()
+			droppedCount.Inc(1)
+			return nil
+		}
+		n.mu.Unlock()
+		select {
+		case <-n.roomC:
+		case <-n.quitC:
+			return ErrClosed
+		}
+	}
+}
+
+// Dropped returns the number of notifications dropped because the buffer was full
+func (n *Notifier) Dropped() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dropped
+}
+
+// Closed returns a channel which is closed when the subscription is closed
+func (n *Notifier) Closed() <-chan struct{} {
+	return n.quitC
+}
+
+// loop sends the buffered notifications until the subscription is closed
+// or sending fails
+func (n *Notifier) loop() {
+	for {
+		select {
+		case <-n.readyC:
+		case <-n.quitC:
+			return
+		}
+		for {
+			n.mu.Lock()
+			if len(n.queue) == 0 {
+				n.mu.Unlock()
+				break
+			}
+			data := n.queue[0]
+			n.queue[0] = nil
+			n.queue = n.queue[1:]
+			n.mu.Unlock()
+			signal(n.roomC)
+			if err := n.send(data); err != nil {
+				log.Debug("subscription notification failed", "err", err)
+				n.close()
+				return
+			}
+		}
+	}
+}
+
+func (n *Notifier) close() {
+	n.closeOnce.Do(func() {
+		close(n.quitC)
+	})
+}
+
+// signal signals c without blocking if it is already signalled
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
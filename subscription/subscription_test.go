@@ -0,0 +1,186 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package subscription
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testClient is a slow client receiving the notifications once released
+type testClient struct {
+	releaseC chan struct{}
+	receiveC chan interface{}
+}
+
+func newTestClient() *testClient {
+	return &testClient{
+		releaseC: make(chan struct{}),
+		receiveC: make(chan interface{}, 100),
+	}
+}
+
+func (c *testClient) send(data interface{}) error {
+	<-c.releaseC
+	c.receiveC <- data
+	return nil
+}
+
+// receive releases the client and returns the next n notifications
+func (c *testClient) receive(t *testing.T, n int) (got []interface{}) {
+	t.Helper()
+	close(c.releaseC)
+	for i := 0; i < n; i++ {
+		select {
+		case data := <-c.receiveC:
+			got = append(got, data)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for notification %d", i)
+		}
+	}
+	return got
+}
+
+// notifyAll notifies 0 to n-1, the first notification is taken by the blocked client
+// so the buffer of size 2 is full after the third
+func notifyAll(t *testing.T, n *Notifier, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := n.Notify(i); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// let the sender take the first notification
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// TestDropOldest tests that the oldest buffered notifications are dropped
+func TestDropOldest(t *testing.T) {
+	c := newTestClient()
+	n, err := newNotifier(c.send, &Options{Buffer: 2}, DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+	notifyAll(t, n, 5)
+	if got := c.receive(t, 3); !reflect.DeepEqual(got, []interface{}{0, 3, 4}) {
+		t.Fatalf("expected notifications 0, 3, 4, got %v", got)
+	}
+	if dropped := n.Dropped(); dropped != 2 {
+		t.Fatalf("expected 2 dropped notifications, got %d", dropped)
+	}
+}
+
+// TestDropNewest tests that new notifications are dropped while the buffer is full
+func TestDropNewest(t *testing.T) {
+	c := newTestClient()
+	n, err := newNotifier(c.send, &Options{Buffer: 2}, DropNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+	notifyAll(t, n, 5)
+	if got := c.receive(t, 3); !reflect.DeepEqual(got, []interface{}{0, 1, 2}) {
+		t.Fatalf("expected notifications 0, 1, 2, got %v", got)
+	}
+	if dropped := n.Dropped(); dropped != 2 {
+		t.Fatalf("expected 2 dropped notifications, got %d", dropped)
+	}
+}
+
+// TestPause tests that the producer waits while the buffer is full and
+// no notification is dropped
+func TestPause(t *testing.T) {
+	c := newTestClient()
+	n, err := newNotifier(c.send, &Options{Buffer: 2, Policy: Pause}, DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+	notifyAll(t, n, 3)
+
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		n.Notify(3)
+	}()
+	select {
+	case <-doneC:
+		t.Fatal("expected the producer to pause while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := c.receive(t, 4); !reflect.DeepEqual(got, []interface{}{0, 1, 2, 3}) {
+		t.Fatalf("expected notifications 0 to 3, got %v", got)
+	}
+	<-doneC
+	if dropped := n.Dropped(); dropped != 0 {
+		t.Fatalf("expected no dropped notifications, got %d", dropped)
+	}
+}
+
+// TestClose tests that paused producers are released and further notifications
+// refused once the subscription is closed, also when sending fails
+func TestClose(t *testing.T) {
+	c := newTestClient()
+	n, err := newNotifier(c.send, &Options{Buffer: 1, Policy: Pause}, DropNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifyAll(t, n, 2)
+	errC := make(chan error)
+	go func() {
+		errC <- n.Notify(2)
+	}()
+	n.close()
+	if err := <-errC; err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+	if err := n.Notify(3); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+	close(c.releaseC)
+
+	n, err = newNotifier(func(interface{}) error { return errors.New("write failed") }, nil, Pause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-n.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to close when sending fails")
+	}
+}
+
+// TestInvalidOptions tests that invalid options are refused
+func TestInvalidOptions(t *testing.T) {
+	for _, opts := range []*Options{
+		{Buffer: -1},
+		{Buffer: MaxBufferSize + 1},
+		{Policy: "block"},
+	} {
+		if _, err := newNotifier(func(interface{}) error { return nil }, opts, DropOldest); err == nil {
+			t.Fatalf("expected error for options %+v", opts)
+		}
+	}
+}
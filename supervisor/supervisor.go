@@ -0,0 +1,348 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package supervisor contains panics in the protocols of non-critical subsystems
+// (pss, bzzeth), so that a bug in an optional protocol does not take down
+// the node together with storage and retrieval.
+//
+// A p2p connection is dropped as soon as any of its protocols returns, so a panicking
+// protocol is not allowed to return. Instead, its messages are discarded for a backoff
+// period, after which the protocol is restarted on the same connection. Repeated panics
+// of a subsystem double its backoff up to a maximum.
+//
+// Protocols built on p2p/protocols handle every message in its own goroutine. A panic of
+// a message handler does not stop the protocol, it only fails the message, and the
+// messages received during the backoff are discarded without restarting the protocol.
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// default backoff of restarts
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+// ErrClosed is returned by supervised protocols when the supervisor is closed
+var ErrClosed = errors.New("supervisor closed")
+
+// Params configures the backoff of restarts
+type Params struct {
+	MinBackoff time.Duration // backoff after the first panic
+	MaxBackoff time.Duration // maximum backoff after repeated panics
+}
+
+// NewParams returns the default parameters
+func NewParams() *Params {
+	return &Params{
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+}
+
+// Stats are the panics and restarts of a subsystem
+type Stats struct {
+	Panics    int64         // number of contained panics
+	Restarts  int64         // number of protocol restarts
+	LastPanic time.Time     // time of the last panic
+	Backoff   time.Duration // backoff of the last restart
+}
+
+// Supervisor contains panics of the protocols of subsystems and restarts them
+type Supervisor struct {
+	params     *Params
+	lock       sync.Mutex
+	subsystems map[string]*subsystem
+	quit       chan struct{}
+	closeOnce  sync.Once
+}
+
+// subsystem is the supervision state of a subsystem
+type subsystem struct {
+	name      string
+	stats     Stats
+	mPanics   metrics.Counter
+	mRestarts metrics.Counter
+}
+
+// New creates a new supervisor
+func New(params *Params) *Supervisor {
+	if params == nil {
+		params = NewParams()
+	}
+	return &Supervisor{
+		params:     params,
+		subsystems: make(map[string]*subsystem),
+		quit:       make(chan struct{}),
+	}
+}
+
+// Close stops the supervised protocols waiting for a restart
+func (s *Supervisor) Close() {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+// Stats returns the panics and restarts of the subsystem
+func (s *Supervisor) Stats(name string) Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.subsystem(name).stats
+}
+
+// subsystem returns the supervision state of the subsystem
+// the caller is expected to hold s.lock
+func (s *Supervisor) subsystem(name string) *subsystem {
+	sub, ok := s.subsystems[name]
+	if !ok {
+		sub = &subsystem{
+			name:      name,
+			mPanics:   metrics.GetOrRegisterCounter(fmt.Sprintf("supervisor/%s/panics", name), nil),
+			mRestarts: metrics.GetOrRegisterCounter(fmt.Sprintf("supervisor/%s/restarts", name), nil),
+		}
+		s.subsystems[name] = sub
+	}
+	return sub
+}
+
+// panicked records a panic of the subsystem and returns the backoff before its restart
+func (s *Supervisor) panicked(name string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub := s.subsystem(name)
+	now := time.Now()
+	// the backoff is reset if the subsystem has been stable for long enough
+	if sub.stats.Backoff == 0 || now.Sub(sub.stats.LastPanic) > 2*s.params.MaxBackoff {
+		sub.stats.Backoff = s.params.MinBackoff
+	} else {
+		sub.stats.Backoff *= 2
+		if sub.stats.Backoff > s.params.MaxBackoff {
+			sub.stats.Backoff = s.params.MaxBackoff
+		}
+	}
+	sub.stats.Panics++
+	sub.stats.LastPanic = now
+	sub.mPanics.Inc(1)
+	return sub.stats.Backoff
+}
+
+// restarted records a restart of the subsystem
+func (s *Supervisor) restarted(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub := s.subsystem(name)
+	sub.stats.Restarts++
+	sub.mRestarts.Inc(1)
+}
+
+// Protocols returns the protocols of the subsystem with their Run functions supervised
+func (s *Supervisor) Protocols(name string, protos []p2p.Protocol) []p2p.Protocol {
+	supervised := make([]p2p.Protocol, len(protos))
+	for i, proto := range protos {
+		run := proto.Run
+		proto.Run = func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return s.run(name, run, peer, rw)
+		}
+		supervised[i] = proto
+	}
+	return supervised
+}
+
+// run runs the protocol, restarting it after a backoff whenever it panics
+func (s *Supervisor) run(name string, run func(*p2p.Peer, p2p.MsgReadWriter) error, peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+	var pumped *pumpRW
+	defer func() {
+		if pumped != nil {
+			pumped.close()
+		}
+	}()
+	for {
+		err, panicked := contain(name, run, peer, s.guard(name, peer, rw))
+		if !panicked {
+			return err
+		}
+		backoff := s.panicked(name)
+		log.Warn("supervisor: restarting protocol after panic", "subsystem", name, "peer", peer.ID(), "backoff", backoff)
+
+		// messages can only be discarded while waiting for the restart
+		// if they are read independently of the protocol
+		if pumped == nil {
+			pumped = newPumpRW(rw, s.quit)
+			rw = pumped
+		}
+		if err := pumped.discard(backoff); err != nil {
+			return err
+		}
+		s.restarted(name)
+	}
+}
+
+// contain runs the protocol, recovering from a panic
+func contain(name string, run func(*p2p.Peer, p2p.MsgReadWriter) error, peer *p2p.Peer, rw p2p.MsgReadWriter) (err error, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("supervisor: protocol panicked", "subsystem", name, "peer", peer.ID(), "panic", r, "stack trace", string(debug.Stack()))
+			err, panicked = fmt.Errorf("%s panicked: %v", name, r), true
+		}
+	}()
+	return run(peer, rw), false
+}
+
+// guardedRW is the connection of a supervised protocol, it takes over the panics
+// of the message handlers of the protocol, see protocols.PanicHandler
+type guardedRW struct {
+	p2p.MsgReadWriter
+	s     *Supervisor
+	name  string
+	peer  *p2p.Peer
+	mtx   sync.Mutex
+	until time.Time // messages are discarded until then after a message handler panicked
+}
+
+// guard returns the connection passed to a run of the protocol
+func (s *Supervisor) guard(name string, peer *p2p.Peer, rw p2p.MsgReadWriter) *guardedRW {
+	return &guardedRW{
+		MsgReadWriter: rw,
+		s:             s,
+		name:          name,
+		peer:          peer,
+	}
+}
+
+// HandlePanic records the panic of a message handler and discards the messages of the
+// connection for the backoff period
+func (g *guardedRW) HandlePanic(err *protocols.PanicError) {
+	log.Error("supervisor: message handler panicked", "subsystem", g.name, "peer", g.peer.ID(), "panic", err.Value, "stack trace", string(err.Stack))
+	backoff := g.s.panicked(g.name)
+	log.Warn("supervisor: discarding messages after panic", "subsystem", g.name, "peer", g.peer.ID(), "backoff", backoff)
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.until = time.Now().Add(backoff)
+}
+
+// ReadMsg returns the next message of the connection not received during a backoff
+func (g *guardedRW) ReadMsg() (p2p.Msg, error) {
+	for {
+		msg, err := g.MsgReadWriter.ReadMsg()
+		if err != nil {
+			return msg, err
+		}
+		g.mtx.Lock()
+		discard := time.Now().Before(g.until)
+		g.mtx.Unlock()
+		if !discard {
+			return msg, nil
+		}
+		msg.Discard()
+	}
+}
+
+// pumpRW reads the messages of a connection independently of the protocol reading them,
+// so that they can be discarded while the protocol is not running
+type pumpRW struct {
+	p2p.MsgReadWriter
+	msgC chan p2p.Msg
+	errC chan error
+	quit chan struct{}
+	done chan struct{} // closed when the protocol returns
+}
+
+// newPumpRW starts reading the messages of the connection
+func newPumpRW(rw p2p.MsgReadWriter, quit chan struct{}) *pumpRW {
+	p := &pumpRW{
+		MsgReadWriter: rw,
+		msgC:          make(chan p2p.Msg),
+		errC:          make(chan error, 1),
+		quit:          quit,
+		done:          make(chan struct{}),
+	}
+	go p.pump()
+	return p
+}
+
+// pump reads messages until the connection fails
+func (p *pumpRW) pump() {
+	for {
+		msg, err := p.MsgReadWriter.ReadMsg()
+		if err != nil {
+			p.errC <- err
+			return
+		}
+		select {
+		case p.msgC <- msg:
+		case <-p.quit:
+			msg.Discard()
+			p.errC <- ErrClosed
+			return
+		case <-p.done:
+			msg.Discard()
+			return
+		}
+	}
+}
+
+// close stops passing on messages once the protocol has returned
+func (p *pumpRW) close() {
+	close(p.done)
+}
+
+// ReadMsg returns the next message of the connection
+func (p *pumpRW) ReadMsg() (p2p.Msg, error) {
+	select {
+	case msg := <-p.msgC:
+		return msg, nil
+	case err := <-p.errC:
+		p.errC <- err
+		return p2p.Msg{}, err
+	case <-p.quit:
+		return p2p.Msg{}, ErrClosed
+	}
+}
+
+// discard discards the messages of the connection for the given period
+func (p *pumpRW) discard(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-p.msgC:
+			msg.Discard()
+		case err := <-p.errC:
+			p.errC <- err
+			return err
+		case <-p.quit:
+			return ErrClosed
+		case <-timer.C:
+			return nil
+		}
+	}
+}
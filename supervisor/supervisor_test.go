@@ -0,0 +1,198 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// TestSupervisorRestartsPanickingProtocol tests that a panicking protocol is restarted
+// on the same connection after the backoff, with the messages received meanwhile discarded
+func TestSupervisorRestartsPanickingProtocol(t *testing.T) {
+	s := New(&Params{
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: time.Second,
+	})
+	defer s.Close()
+
+	received := make(chan uint64, 10)
+	runs := 0
+	protos := s.Protocols("test", []p2p.Protocol{{
+		Name:    "test",
+		Version: 1,
+		Length:  2,
+		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			runs++
+			for {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				msg.Discard()
+				if msg.Code == 1 {
+					panic("test panic")
+				}
+				received <- msg.Code
+			}
+		},
+	}})
+
+	local, remote := p2p.MsgPipe()
+	defer remote.Close()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- protos[0].Run(p2p.NewPeer(enode.ID{}, "test", nil), local)
+	}()
+
+	// the message panicking the protocol, and one received during the backoff
+	if err := p2p.Send(remote, 1, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(remote, 0, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-received:
+		t.Fatalf("expected message %d to be discarded", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the message received after the restart
+	time.Sleep(100 * time.Millisecond)
+	if err := p2p.Send(remote, 0, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the restarted protocol to receive a message")
+	}
+
+	stats := s.Stats("test")
+	if stats.Panics != 1 || stats.Restarts != 1 || runs != 2 {
+		t.Fatalf("expected 1 panic, 1 restart and 2 runs, got %d panics, %d restarts and %d runs", stats.Panics, stats.Restarts, runs)
+	}
+
+	// a second panic doubles the backoff
+	if err := p2p.Send(remote, 1, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if stats := s.Stats("test"); stats.Backoff != 200*time.Millisecond {
+		t.Fatalf("expected backoff of 200ms, got %v", stats.Backoff)
+	}
+
+	// the protocol returns when the supervisor is closed
+	s.Close()
+	select {
+	case err := <-errC:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("expected error %v, got %v", ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the protocol to return")
+	}
+}
+
+// testHandlerMsg is the message of the protocol testing panics of message handlers
+type testHandlerMsg struct {
+	Panic bool
+}
+
+// TestSupervisorContainsHandlerPanic tests that a panic of a message handler of a protocol
+// built on p2p/protocols, which runs outside of the protocol, is contained without stopping
+// the protocol, with the messages received during the backoff discarded
+func TestSupervisorContainsHandlerPanic(t *testing.T) {
+	s := New(&Params{
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: time.Second,
+	})
+	defer s.Close()
+
+	spec := &protocols.Spec{
+		Name:       "test",
+		Version:    1,
+		MaxMsgSize: 1024,
+		Messages:   []interface{}{testHandlerMsg{}},
+	}
+	received := make(chan struct{}, 10)
+	runs := 0
+	protos := s.Protocols("test", []p2p.Protocol{{
+		Name:    spec.Name,
+		Version: spec.Version,
+		Length:  spec.Length(),
+		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			runs++
+			return protocols.NewPeer(peer, rw, spec).Run(func(ctx context.Context, msg interface{}) error {
+				if msg.(*testHandlerMsg).Panic {
+					panic("test panic")
+				}
+				received <- struct{}{}
+				return nil
+			})
+		},
+	}})
+
+	local, remote := p2p.MsgPipe()
+	defer remote.Close()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- protos[0].Run(p2p.NewPeer(enode.ID{}, "test", nil), local)
+	}()
+
+	// the message panicking the handler, and one received during the backoff
+	if err := p2p.Send(remote, 0, &testHandlerMsg{Panic: true}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := p2p.Send(remote, 0, &testHandlerMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+		t.Fatal("expected message received during the backoff to be discarded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the message received after the backoff
+	time.Sleep(100 * time.Millisecond)
+	if err := p2p.Send(remote, 0, &testHandlerMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the protocol to receive a message after the backoff")
+	}
+
+	select {
+	case err := <-errC:
+		t.Fatalf("expected the protocol to keep running, it returned %v", err)
+	default:
+	}
+	stats := s.Stats("test")
+	if stats.Panics != 1 || stats.Restarts != 0 || runs != 1 {
+		t.Fatalf("expected 1 panic, no restarts and 1 run, got %d panics, %d restarts and %d runs", stats.Panics, stats.Restarts, runs)
+	}
+}
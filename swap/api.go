@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -30,6 +31,13 @@ type swapAPI interface {
 	Balances() (map[enode.ID]int64, error)
 	PeerCheques(peer enode.ID) (PeerCheques, error)
 	Cheques() (map[enode.ID]*PeerCheques, error)
+	PeerHistory(peer enode.ID, since int64) (*PeerHistory, error)
+	Summary() (*Summary, error)
+	CashoutStrategy() (*CashoutStrategy, error)
+	SetCashoutStrategy(strategy *CashoutStrategy) error
+	CashoutEstimates() ([]*CashoutEstimate, error)
+	Prices() (Prices, error)
+	PeerPrices(peer enode.ID) (Prices, error)
 }
 
 // API would be the API accessor for protocol methods
@@ -229,3 +237,115 @@ func (s *Swap) addStoreCheques(chequePrefix string, cheques map[enode.ID]*PeerCh
 	}
 	return s.store.Iterate(chequePrefix, chequesIterFunction)
 }
+
+// atRiskRatio is the fraction of the disconnect threshold over which a peer is reported at risk of being disconnected
+const atRiskRatio = 0.9
+
+// PeerHistory contains the accounting history of a peer together with its current accounting state
+type PeerHistory struct {
+	Peer                enode.ID
+	Balance             int64  // current balance, positive when the peer owes us
+	PaymentThreshold    int64  // honey amount at which a cheque is sent
+	DisconnectThreshold int64  // honey amount at which the peer is disconnected
+	UntilDisconnect     int64  // honey the peer can still incur before it gets disconnected
+	ProjectedSettlement uint64 // value of the cheque settling the current balance
+	Balances            []BalanceEntry
+	Cheques             []ChequeEntry
+	Disconnects         []DisconnectEntry
+}
+
+// Summary aggregates the accounting state of all known peers
+type Summary struct {
+	Peers               int
+	Debt                int64  // honey owed to peers
+	Credit              int64  // honey owed by peers
+	ProjectedPayout     uint64 // value of the cheques settling the debt
+	ProjectedIncome     uint64 // value of the cheques settling the credit
+	ChequesSent         int
+	ChequesReceived     int
+	Disconnects         int
+	PaymentThreshold    int64
+	DisconnectThreshold int64
+	AtRisk              []enode.ID // peers close to the disconnect threshold
+}
+
+// PeerHistory returns the balance time series, cheques and disconnects of the peer
+// recorded since the given unix time, together with its current accounting state
+// history is only kept in memory since the node started
+func (s *Swap) PeerHistory(peer enode.ID, since int64) (*PeerHistory, error) {
+	balances, cheques, disconnects := s.history.since(peer, time.Unix(since, 0))
+	balance, err := s.PeerBalance(peer)
+	if err != nil && (err != state.ErrNotFound || len(balances)+len(cheques)+len(disconnects) == 0) {
+		return nil, err
+	}
+	settlement, err := s.settlementValue(balance)
+	if err != nil {
+		return nil, err
+	}
+	return &PeerHistory{
+		Peer:                peer,
+		Balance:             balance,
+		PaymentThreshold:    s.params.PaymentThreshold,
+		DisconnectThreshold: s.params.DisconnectThreshold,
+		UntilDisconnect:     s.params.DisconnectThreshold - balance,
+		ProjectedSettlement: settlement,
+		Balances:            balances,
+		Cheques:             cheques,
+		Disconnects:         disconnects,
+	}, nil
+}
+
+// Summary returns the aggregated accounting state of all known peers
+func (s *Swap) Summary() (*Summary, error) {
+	balances, err := s.Balances()
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{
+		Peers:               len(balances),
+		PaymentThreshold:    s.params.PaymentThreshold,
+		DisconnectThreshold: s.params.DisconnectThreshold,
+	}
+	for peer, balance := range balances {
+		settlement, err := s.settlementValue(balance)
+		if err != nil {
+			return nil, err
+		}
+		if balance < 0 {
+			summary.Debt -= balance
+			summary.ProjectedPayout += settlement
+		} else {
+			summary.Credit += balance
+			summary.ProjectedIncome += settlement
+		}
+		if float64(balance) >= atRiskRatio*float64(s.params.DisconnectThreshold) {
+			summary.AtRisk = append(summary.AtRisk, peer)
+		}
+	}
+
+	s.history.lock.RLock()
+	defer s.history.lock.RUnlock()
+	for _, ph := range s.history.peers {
+		for _, e := range ph.cheques {
+			switch e.Action {
+			case ChequeSentAction:
+				summary.ChequesSent++
+			case ChequeReceivedAction:
+				summary.ChequesReceived++
+			}
+		}
+		summary.Disconnects += len(ph.disconnects)
+	}
+	return summary, nil
+}
+
+// settlementValue returns the value of the cheque that would settle the balance
+func (s *Swap) settlementValue(balance int64) (uint64, error) {
+	if balance < 0 {
+		balance = -balance
+	}
+	if balance == 0 {
+		return 0, nil
+	}
+	return s.honeyPriceOracle.GetPrice(uint64(balance))
+}
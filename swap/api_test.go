@@ -1,14 +1,17 @@
 package swap
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
 	"github.com/ethersphere/swarm/p2p/protocols"
 	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/swap/int256"
 )
 
 type peerChequesTestCase struct {
@@ -546,3 +549,114 @@ func verifyCheques(t *testing.T, s *Swap, peer enode.ID, expectedCheques PeerChe
 		t.Fatalf("Expected peer %v cheques to be %v, but are %v", peer, expectedCheques, peerCheques)
 	}
 }
+
+// TestPeerHistory tests that balance changes, cheques and disconnects are recorded in the peer history
+func TestPeerHistory(t *testing.T) {
+	swap, clean := newTestSwap(t, ownerKey, nil)
+	defer clean()
+	testPeer, err := swap.addPeer(newDummyPeerWithSpec(Spec).Peer, beneficiaryAddress, testChequeContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPeerID := testPeer.ID()
+
+	if err := testDeploy(context.Background(), swap, int256.Uint256From(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	setBalance(t, testPeer, 10)
+	setBalance(t, testPeer, -42)
+	// sending the cheque settles the balance
+	if err := testPeer.sendCheque(); err != nil {
+		t.Fatal(err)
+	}
+	disconnectThreshold := swap.params.DisconnectThreshold
+	setBalance(t, testPeer, disconnectThreshold)
+	if err := swap.Add(1, testPeer.Peer); err == nil {
+		t.Fatal("expected error adding to balance over the disconnect threshold")
+	}
+
+	history, err := swap.PeerHistory(testPeerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Balance != disconnectThreshold {
+		t.Fatalf("expected balance %d, got %d", disconnectThreshold, history.Balance)
+	}
+	if history.UntilDisconnect != 0 {
+		t.Fatalf("expected 0 honey until disconnect, got %d", history.UntilDisconnect)
+	}
+	var balances, amounts []int64
+	for _, e := range history.Balances {
+		balances = append(balances, e.Balance)
+		amounts = append(amounts, e.Amount)
+	}
+	if !reflect.DeepEqual(balances, []int64{10, -42, 0, disconnectThreshold}) {
+		t.Fatalf("unexpected balance history %v", balances)
+	}
+	if !reflect.DeepEqual(amounts, []int64{10, -52, 42, disconnectThreshold}) {
+		t.Fatalf("unexpected balance changes %v", amounts)
+	}
+	if len(history.Cheques) != 1 || history.Cheques[0].Action != ChequeSentAction || history.Cheques[0].Cheque.Honey != 42 {
+		t.Fatalf("unexpected cheque history %v", history.Cheques)
+	}
+	if len(history.Disconnects) != 1 || history.Disconnects[0].Balance != disconnectThreshold || history.Disconnects[0].Amount != 1 {
+		t.Fatalf("unexpected disconnect history %v", history.Disconnects)
+	}
+
+	// history in the future is empty, but the current state is still returned
+	history, err = swap.PeerHistory(testPeerID, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Balances) != 0 || len(history.Cheques) != 0 || len(history.Disconnects) != 0 {
+		t.Fatalf("expected empty history, got %v", history)
+	}
+	if history.Balance != disconnectThreshold {
+		t.Fatalf("expected balance %d, got %d", disconnectThreshold, history.Balance)
+	}
+
+	// unknown peer
+	if _, err := swap.PeerHistory(adapters.RandomNodeConfig().ID, 0); err != state.ErrNotFound {
+		t.Fatalf("expected error %v, got %v", state.ErrNotFound, err)
+	}
+}
+
+// TestSummary tests the aggregation of the accounting state of all peers
+func TestSummary(t *testing.T) {
+	swap, clean := newTestSwap(t, ownerKey, nil)
+	defer clean()
+
+	debitor := addPeer(t, swap)
+	creditor := addPeer(t, swap)
+	disconnectThreshold := swap.params.DisconnectThreshold
+	setBalance(t, debitor, disconnectThreshold)
+	setBalance(t, creditor, -100)
+
+	summary, err := swap.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Peers != 2 {
+		t.Fatalf("expected 2 peers, got %d", summary.Peers)
+	}
+	if summary.Debt != 100 {
+		t.Fatalf("expected debt 100, got %d", summary.Debt)
+	}
+	if summary.Credit != disconnectThreshold {
+		t.Fatalf("expected credit %d, got %d", disconnectThreshold, summary.Credit)
+	}
+	payout, err := swap.honeyPriceOracle.GetPrice(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ProjectedPayout != payout {
+		t.Fatalf("expected projected payout %d, got %d", payout, summary.ProjectedPayout)
+	}
+	if !reflect.DeepEqual(summary.AtRisk, []enode.ID{debitor.ID()}) {
+		t.Fatalf("expected peer %s at risk, got %v", debitor.ID(), summary.AtRisk)
+	}
+	if summary.DisconnectThreshold != disconnectThreshold || summary.PaymentThreshold != swap.params.PaymentThreshold {
+		t.Fatalf("unexpected thresholds in summary %v", summary)
+	}
+}
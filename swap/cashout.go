@@ -24,6 +24,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/metrics"
 	contract "github.com/ethersphere/swarm/contracts/swap"
+	"github.com/ethersphere/swarm/events"
 	"github.com/ethersphere/swarm/swap/chain"
 	"github.com/ethersphere/swarm/swap/int256"
 )
@@ -35,6 +36,7 @@ const CashChequeBeneficiaryTransactionCost = 50000
 type CashoutProcessor struct {
 	backend    chain.Backend     // ethereum backend to use
 	privateKey *ecdsa.PrivateKey // private key to use
+	events     *events.Bus       // bus bounced cheques are published on, nil for none
 	Logger     Logger
 }
 
@@ -87,46 +89,62 @@ func (c *CashoutProcessor) cashCheque(ctx context.Context, request *CashoutReque
 
 // estimatePayout estimates the payout for a given cheque as well as the transaction cost
 func (c *CashoutProcessor) estimatePayout(ctx context.Context, cheque *Cheque) (expectedPayout *int256.Uint256, transactionCosts *int256.Uint256, err error) {
-	otherSwap, err := contract.InstanceAt(cheque.Contract, c.backend)
+	estimate, err := c.estimateCashout(ctx, cheque)
 	if err != nil {
 		return nil, nil, err
 	}
+	return estimate.ExpectedPayout, estimate.TransactionCosts, nil
+}
+
+// estimateCashout estimates the payout for a given cheque as well as the gas price and transaction cost of cashing it
+func (c *CashoutProcessor) estimateCashout(ctx context.Context, cheque *Cheque) (*CashoutEstimate, error) {
+	otherSwap, err := contract.InstanceAt(cheque.Contract, c.backend)
+	if err != nil {
+		return nil, err
+	}
 
 	po, err := otherSwap.PaidOut(&bind.CallOpts{Context: ctx}, cheque.Beneficiary)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	paidOut, err := int256.NewUint256(po)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	gp, err := c.backend.SuggestGasPrice(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	gasPrice, err := int256.NewUint256(gp)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	transactionCosts, err = new(int256.Uint256).Mul(gasPrice, int256.Uint256From(CashChequeBeneficiaryTransactionCost))
+	transactionCosts, err := new(int256.Uint256).Mul(gasPrice, int256.Uint256From(CashChequeBeneficiaryTransactionCost))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	estimate := &CashoutEstimate{
+		Cheque:           cheque,
+		ExpectedPayout:   int256.Uint256From(0),
+		GasPrice:         gasPrice,
+		TransactionCosts: transactionCosts,
 	}
 
 	if paidOut.Cmp(cheque.CumulativePayout) > 0 {
-		return new(int256.Uint256), transactionCosts, nil
+		return estimate, nil
 	}
 
-	expectedPayout, err = new(int256.Uint256).Sub(cheque.CumulativePayout, paidOut)
+	estimate.ExpectedPayout, err = new(int256.Uint256).Sub(cheque.CumulativePayout, paidOut)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return expectedPayout, transactionCosts, nil
+	return estimate, nil
 }
 
 // waitForAndProcessActiveCashout waits for activeCashout to complete
@@ -151,6 +169,11 @@ func (c *CashoutProcessor) waitForAndProcessActiveCashout(activeCashout *ActiveC
 	if result.Bounced {
 		metrics.GetOrRegisterCounter("swap/cheques/cashed/bounced", nil).Inc(1)
 		activeCashout.Logger.Warn(CashChequeAction, "cheque bounced", "tx", receipt.TxHash)
+		c.events.Publish(events.ChequeBounced, &events.ChequeData{
+			Chequebook:  activeCashout.Request.Cheque.Contract.Hex(),
+			Beneficiary: activeCashout.Request.Destination.Hex(),
+			Transaction: receipt.TxHash.Hex(),
+		})
 	}
 
 	activeCashout.Logger.Info(CashChequeAction, "cheque cashed", "honey", activeCashout.Request.Cheque.Honey)
@@ -0,0 +1,257 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/swap/int256"
+)
+
+// DefaultCashoutCostsMultiplier is the multiple of the transaction costs a payout has to exceed for the cheque to be cashed
+const DefaultCashoutCostsMultiplier = 2
+
+// ErrInvalidCashoutStrategy is used when a cashout strategy has invalid parameters
+var ErrInvalidCashoutStrategy = errors.New("invalid cashout strategy")
+
+// reasons for not cashing a cheque reported in cashout estimates
+const (
+	cashoutActiveReason      = "cashout in progress"
+	cashoutNoPayoutReason    = "cheque already cashed"
+	cashoutCostsReason       = "payout does not cover transaction costs"
+	cashoutMinPayoutReason   = "payout below minimum"
+	cashoutMaxGasPriceReason = "gas price above maximum"
+)
+
+// CashoutStrategy defines when received cheques are cashed
+// Cheques are cashed when they are received and their payout exceeds MinPayout,
+// or periodically at every Interval regardless of MinPayout. In both cases
+// the payout has to exceed the transaction costs times CostsMultiplier and
+// the gas price must not be above MaxGasPrice.
+type CashoutStrategy struct {
+	CostsMultiplier uint64          // multiple of the transaction costs the payout has to exceed, at least 1
+	MinPayout       *int256.Uint256 // minimum uncashed payout of a received cheque to be cashed, nil for no minimum
+	MaxGasPrice     *int256.Uint256 // maximum gas price at which cheques are cashed, nil for no limit
+	Interval        time.Duration   // interval at which all uncashed cheques are cashed, 0 to cash only on receipt
+}
+
+// DefaultCashoutStrategy returns the strategy cashing received cheques whose payout is worth twice the transaction costs
+func DefaultCashoutStrategy() *CashoutStrategy {
+	return &CashoutStrategy{
+		CostsMultiplier: DefaultCashoutCostsMultiplier,
+	}
+}
+
+// validate checks the strategy parameters, a nil strategy is invalid
+func (cs *CashoutStrategy) validate() error {
+	if cs == nil || cs.CostsMultiplier == 0 || cs.Interval < 0 {
+		return ErrInvalidCashoutStrategy
+	}
+	return nil
+}
+
+// decide returns whether the cheque with the estimate should be cashed and the reason if it should not
+// scheduled denotes a periodical cashout, which ignores the minimum payout
+func (cs *CashoutStrategy) decide(estimate *CashoutEstimate, scheduled bool) (cash bool, reason string) {
+	if estimate.ExpectedPayout.Equals(int256.Uint256From(0)) {
+		return false, cashoutNoPayoutReason
+	}
+	if cs.MaxGasPrice != nil && estimate.GasPrice.Cmp(cs.MaxGasPrice) > 0 {
+		return false, cashoutMaxGasPriceReason
+	}
+	costThreshold, err := new(int256.Uint256).Mul(estimate.TransactionCosts, int256.Uint256From(cs.CostsMultiplier))
+	if err != nil || estimate.ExpectedPayout.Cmp(costThreshold) <= 0 {
+		return false, cashoutCostsReason
+	}
+	if !scheduled && cs.MinPayout != nil && estimate.ExpectedPayout.Cmp(cs.MinPayout) < 0 {
+		return false, cashoutMinPayoutReason
+	}
+	return true, ""
+}
+
+// CashoutEstimate is the estimated outcome of cashing a received cheque
+type CashoutEstimate struct {
+	Peer             enode.ID        // peer which issued the cheque
+	Cheque           *Cheque         // last cheque received from the peer
+	ExpectedPayout   *int256.Uint256 // uncashed amount of the cheque
+	GasPrice         *int256.Uint256 // current gas price
+	TransactionCosts *int256.Uint256 // expected costs of the cashing transaction
+	Cash             bool            // whether the cheque would be cashed by the strategy on receipt
+	Reason           string          // why the cheque would not be cashed
+}
+
+// cashouts runs the cashout strategy
+type cashouts struct {
+	lock     sync.Mutex
+	strategy *CashoutStrategy
+	active   map[common.Address]bool // chequebooks cheques of which are being cashed
+	reset    chan struct{}           // signals a change of the strategy to the scheduler
+	quit     chan struct{}
+}
+
+// newCashouts creates the cashout strategy runner, with the default strategy if strategy is nil
+func newCashouts(strategy *CashoutStrategy) *cashouts {
+	if strategy == nil {
+		strategy = DefaultCashoutStrategy()
+	}
+	return &cashouts{
+		strategy: strategy,
+		active:   make(map[common.Address]bool),
+		reset:    make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// CashoutStrategy returns the current cashout strategy
+func (s *Swap) CashoutStrategy() (*CashoutStrategy, error) {
+	s.cashouts.lock.Lock()
+	defer s.cashouts.lock.Unlock()
+	strategy := *s.cashouts.strategy
+	return &strategy, nil
+}
+
+// SetCashoutStrategy replaces the cashout strategy
+func (s *Swap) SetCashoutStrategy(strategy *CashoutStrategy) error {
+	if err := strategy.validate(); err != nil {
+		return err
+	}
+	s.cashouts.lock.Lock()
+	s.cashouts.strategy = strategy
+	s.cashouts.lock.Unlock()
+	s.logger.Info(CashChequeAction, "cashout strategy changed", "costsMultiplier", strategy.CostsMultiplier, "minPayout", strategy.MinPayout, "maxGasPrice", strategy.MaxGasPrice, "interval", strategy.Interval)
+
+	select {
+	case s.cashouts.reset <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// CashoutEstimates estimates the outcome of cashing the last cheques received from the connected peers
+// without cashing them
+func (s *Swap) CashoutEstimates() (estimates []*CashoutEstimate, err error) {
+	for _, p := range s.receivedCheques() {
+		estimate, err := s.estimateCashout(context.TODO(), p.ID(), p.cheque)
+		if err != nil {
+			return nil, err
+		}
+		estimate.Cash, estimate.Reason = s.decideCashout(estimate, false)
+		estimates = append(estimates, estimate)
+	}
+	return estimates, nil
+}
+
+// estimateCashout estimates the outcome of cashing the cheque received from the peer
+func (s *Swap) estimateCashout(ctx context.Context, peer enode.ID, cheque *Cheque) (*CashoutEstimate, error) {
+	estimate, err := s.cashoutProcessor.estimateCashout(ctx, cheque)
+	if err != nil {
+		return nil, err
+	}
+	estimate.Peer = peer
+	return estimate, nil
+}
+
+// decideCashout returns whether the cheque with the estimate should be cashed by the current strategy
+func (s *Swap) decideCashout(estimate *CashoutEstimate, scheduled bool) (bool, string) {
+	s.cashouts.lock.Lock()
+	defer s.cashouts.lock.Unlock()
+	if s.cashouts.active[estimate.Cheque.Contract] {
+		return false, cashoutActiveReason
+	}
+	return s.cashouts.strategy.decide(estimate, scheduled)
+}
+
+// cashout cashes the cheque with the estimate if the current strategy decides to
+func (s *Swap) cashout(estimate *CashoutEstimate, destination common.Address, scheduled bool) {
+	s.cashouts.lock.Lock()
+	defer s.cashouts.lock.Unlock()
+	if s.cashouts.active[estimate.Cheque.Contract] {
+		return
+	}
+	if cash, reason := s.cashouts.strategy.decide(estimate, scheduled); !cash {
+		s.logger.Debug(CashChequeAction, "not cashing cheque", "reason", reason, "expectedPayout", estimate.ExpectedPayout, "transactionCosts", estimate.TransactionCosts)
+		return
+	}
+	s.cashouts.active[estimate.Cheque.Contract] = true
+	go func() {
+		defaultCashCheque(s, estimate.Cheque, destination)
+		s.cashouts.lock.Lock()
+		delete(s.cashouts.active, estimate.Cheque.Contract)
+		s.cashouts.lock.Unlock()
+	}()
+}
+
+// receivedCheque is the last cheque received from a connected peer
+type receivedCheque struct {
+	*Peer
+	cheque *Cheque
+}
+
+// receivedCheques returns the last cheques received from the connected peers
+func (s *Swap) receivedCheques() (cheques []receivedCheque) {
+	s.peersLock.RLock()
+	defer s.peersLock.RUnlock()
+	for _, p := range s.peers {
+		p.lock.Lock()
+		cheque := p.getLastReceivedCheque()
+		p.lock.Unlock()
+		if cheque != nil {
+			cheques = append(cheques, receivedCheque{Peer: p, cheque: cheque})
+		}
+	}
+	return cheques
+}
+
+// runCashouts periodically cashes the cheques received from the connected peers
+// following the interval of the current strategy, until the cashouts are stopped
+func (s *Swap) runCashouts() {
+	for {
+		s.cashouts.lock.Lock()
+		interval := s.cashouts.strategy.Interval
+		s.cashouts.lock.Unlock()
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			tick = time.After(interval)
+		}
+
+		select {
+		case <-tick:
+			s.cashoutAll()
+		case <-s.cashouts.reset:
+		case <-s.cashouts.quit:
+			return
+		}
+	}
+}
+
+// cashoutAll cashes the cheques received from the connected peers which the current strategy decides to cash
+func (s *Swap) cashoutAll() {
+	for _, p := range s.receivedCheques() {
+		estimate, err := s.estimateCashout(context.TODO(), p.ID(), p.cheque)
+		if err != nil {
+			s.logger.Error(CashChequeAction, "estimating cashout", "peer", p.ID(), "err", err)
+			continue
+		}
+		s.cashout(estimate, p.chequebookAddress(), true)
+	}
+}
@@ -19,6 +19,7 @@ package swap
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/log"
@@ -188,3 +189,142 @@ func TestEstimatePayout(t *testing.T) {
 		t.Fatalf("unexpected transaction cost: got %v, wanted: %d", transactionCost, 0)
 	}
 }
+
+// TestCashoutStrategyDecide tests the decisions of a cashout strategy for various estimates
+func TestCashoutStrategyDecide(t *testing.T) {
+	strategy := &CashoutStrategy{
+		CostsMultiplier: 2,
+		MinPayout:       int256.Uint256From(1000),
+		MaxGasPrice:     int256.Uint256From(10),
+	}
+	estimate := func(payout, gasPrice uint64) *CashoutEstimate {
+		return &CashoutEstimate{
+			ExpectedPayout:   int256.Uint256From(payout),
+			GasPrice:         int256.Uint256From(gasPrice),
+			TransactionCosts: int256.Uint256From(gasPrice * 100),
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		estimate  *CashoutEstimate
+		scheduled bool
+		cash      bool
+		reason    string
+	}{
+		{name: "cashed", estimate: estimate(1000, 1), cash: true},
+		{name: "no payout", estimate: estimate(0, 1), reason: cashoutNoPayoutReason},
+		{name: "gas price above maximum", estimate: estimate(5000, 11), reason: cashoutMaxGasPriceReason},
+		{name: "payout does not cover costs", estimate: estimate(1000, 5), reason: cashoutCostsReason},
+		{name: "payout below minimum", estimate: estimate(999, 1), reason: cashoutMinPayoutReason},
+		{name: "scheduled below minimum", estimate: estimate(999, 1), scheduled: true, cash: true},
+		{name: "scheduled payout does not cover costs", estimate: estimate(999, 5), scheduled: true, reason: cashoutCostsReason},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cash, reason := strategy.decide(tc.estimate, tc.scheduled)
+			if cash != tc.cash {
+				t.Fatalf("expected cash %v, got %v", tc.cash, cash)
+			}
+			if reason != tc.reason {
+				t.Fatalf("expected reason %q, got %q", tc.reason, reason)
+			}
+		})
+	}
+}
+
+// TestCashoutStrategy tests that cheques below the minimum payout are not cashed on receipt,
+// but are reported by the estimates and cashed once the strategy schedules cashouts
+func TestCashoutStrategy(t *testing.T) {
+	testBackend := newTestBackend(t)
+	defer testBackend.Close()
+	swap, clean := newTestSwap(t, ownerKey, testBackend)
+	defer clean()
+	reset := setupContractTest()
+	defer reset()
+
+	if err := testDeploy(context.Background(), swap, int256.Uint256From(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	payout := int256.Uint256From(CashChequeBeneficiaryTransactionCost * 10)
+	issuer, err := testDeployWithPrivateKey(context.Background(), testBackend, ownerKey, ownerAddress, payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheque, err := newSignedTestCheque(issuer.ContractParams().ContractAddress, swap.owner.address, payout, ownerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := swap.addPeer(newDummyPeerWithSpec(Spec).Peer, ownerAddress, issuer.ContractParams().ContractAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.setLastReceivedCheque(cheque); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, invalid := range []*CashoutStrategy{
+		nil,
+		{CostsMultiplier: 0},
+		{CostsMultiplier: DefaultCashoutCostsMultiplier, Interval: -time.Second},
+	} {
+		if err := swap.SetCashoutStrategy(invalid); err != ErrInvalidCashoutStrategy {
+			t.Fatalf("expected error %v for strategy %+v, got %v", ErrInvalidCashoutStrategy, invalid, err)
+		}
+	}
+	strategy := DefaultCashoutStrategy()
+	strategy.MinPayout = int256.Uint256From(CashChequeBeneficiaryTransactionCost * 100)
+	if err := swap.SetCashoutStrategy(strategy); err != nil {
+		t.Fatal(err)
+	}
+	current, err := swap.CashoutStrategy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.MinPayout.Equals(strategy.MinPayout) {
+		t.Fatalf("expected minimum payout %v, got %v", strategy.MinPayout, current.MinPayout)
+	}
+
+	estimates, err := swap.CashoutEstimates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(estimates) != 1 {
+		t.Fatalf("expected 1 estimate, got %d", len(estimates))
+	}
+	estimate := estimates[0]
+	if estimate.Peer != peer.ID() {
+		t.Fatalf("expected estimate for peer %v, got %v", peer.ID(), estimate.Peer)
+	}
+	if !estimate.ExpectedPayout.Equals(payout) {
+		t.Fatalf("expected payout %v, got %v", payout, estimate.ExpectedPayout)
+	}
+	if estimate.Cash || estimate.Reason != cashoutMinPayoutReason {
+		t.Fatalf("expected cheque not to be cashed because of %q, got cash %v, reason %q", cashoutMinPayoutReason, estimate.Cash, estimate.Reason)
+	}
+
+	// scheduled cashouts ignore the minimum payout
+	go swap.runCashouts()
+	strategy.Interval = 10 * time.Millisecond
+	if err := swap.SetCashoutStrategy(strategy); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-testBackend.cashDone:
+	case <-time.After(4 * time.Second):
+		t.Fatal("timeout waiting for the scheduled cashout")
+	}
+	if err := swap.SetCashoutStrategy(DefaultCashoutStrategy()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cashed cheque has no payout left
+	estimates, err = swap.CashoutEstimates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimates[0].Cash || estimates[0].Reason != cashoutNoPayoutReason {
+		t.Fatalf("expected cheque not to be cashed because of %q, got cash %v, reason %q", cashoutNoPayoutReason, estimates[0].Cash, estimates[0].Reason)
+	}
+}
@@ -210,8 +210,8 @@ func newRandomTestCheque() *Cheque {
 // During tests, because the cashing in of cheques is async, we should wait for the function to be returned
 // Otherwise if we call `handleEmitChequeMsg` manually, it will return before the TX has been committed to the `SimulatedBackend`,
 // causing subsequent TX to possibly fail due to nonce mismatch
-func testCashCheque(s *Swap, cheque *Cheque) {
-	cashCheque(s, cheque)
+func testCashCheque(s *Swap, cheque *Cheque, destination common.Address) {
+	cashCheque(s, cheque, destination)
 	// send to the channel, signals to clients that this function actually finished
 	if stb, ok := s.backend.(*swapTestBackend); ok {
 		if stb.cashDone != nil {
@@ -294,7 +294,7 @@ func newTestSwapAndPeer(t *testing.T, key *ecdsa.PrivateKey) (*Swap, *Peer, func
 	swap, clean := newTestSwap(t, key, nil)
 	// owner address is the beneficiary (counterparty) for the peer
 	// that's because we expect cheques we receive to be signed by the address we would issue cheques to
-	peer, err := swap.addPeer(newDummyPeer().Peer, ownerAddress, testChequeContract)
+	peer, err := swap.addPeer(newDummyPeerWithSpec(Spec).Peer, ownerAddress, testChequeContract)
 	if err != nil {
 		t.Fatal(err)
 	}
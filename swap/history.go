@@ -0,0 +1,142 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// maxHistoryEntries is the number of the most recent entries of every kind kept for a peer
+const maxHistoryEntries = 1000
+
+// Actions of cheque history entries
+const (
+	ChequeSentAction      = "sent"      // cheque was sent to the peer
+	ChequeConfirmedAction = "confirmed" // sent cheque was confirmed by the peer
+	ChequeReceivedAction  = "received"  // cheque was received from the peer
+)
+
+// BalanceEntry is a point of the balance time series of a peer
+type BalanceEntry struct {
+	Time    time.Time
+	Balance int64 // balance after the change
+	Amount  int64 // amount the balance changed by
+}
+
+// ChequeEntry records a cheque sent to or received from a peer
+type ChequeEntry struct {
+	Time   time.Time
+	Action string
+	Cheque *Cheque
+}
+
+// DisconnectEntry records a peer exceeding the disconnect threshold
+type DisconnectEntry struct {
+	Time    time.Time
+	Balance int64 // balance when the peer was disconnected
+	Amount  int64 // amount that would have been added to the balance
+}
+
+// peerHistory holds the accounting history of a peer
+type peerHistory struct {
+	balances    []BalanceEntry
+	cheques     []ChequeEntry
+	disconnects []DisconnectEntry
+}
+
+// history keeps the accounting history of all peers in memory,
+// also after the peers disconnect
+type history struct {
+	lock  sync.RWMutex
+	peers map[enode.ID]*peerHistory
+}
+
+func newHistory() *history {
+	return &history{
+		peers: make(map[enode.ID]*peerHistory),
+	}
+}
+
+// get returns the history of the peer, creating it if needed
+// the caller is expected to hold h.lock
+func (h *history) get(peer enode.ID) *peerHistory {
+	ph, ok := h.peers[peer]
+	if !ok {
+		ph = new(peerHistory)
+		h.peers[peer] = ph
+	}
+	return ph
+}
+
+func (h *history) addBalance(peer enode.ID, balance, amount int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ph := h.get(peer)
+	ph.balances = append(ph.balances, BalanceEntry{Time: time.Now(), Balance: balance, Amount: amount})
+	if l := len(ph.balances); l > maxHistoryEntries {
+		ph.balances = ph.balances[l-maxHistoryEntries:]
+	}
+}
+
+func (h *history) addCheque(peer enode.ID, action string, cheque *Cheque) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ph := h.get(peer)
+	ph.cheques = append(ph.cheques, ChequeEntry{Time: time.Now(), Action: action, Cheque: cheque})
+	if l := len(ph.cheques); l > maxHistoryEntries {
+		ph.cheques = ph.cheques[l-maxHistoryEntries:]
+	}
+}
+
+func (h *history) addDisconnect(peer enode.ID, balance, amount int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ph := h.get(peer)
+	ph.disconnects = append(ph.disconnects, DisconnectEntry{Time: time.Now(), Balance: balance, Amount: amount})
+	if l := len(ph.disconnects); l > maxHistoryEntries {
+		ph.disconnects = ph.disconnects[l-maxHistoryEntries:]
+	}
+}
+
+// since returns copies of the history entries of the peer recorded after the given time
+func (h *history) since(peer enode.ID, t time.Time) (balances []BalanceEntry, cheques []ChequeEntry, disconnects []DisconnectEntry) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	ph, ok := h.peers[peer]
+	if !ok {
+		return nil, nil, nil
+	}
+	for _, e := range ph.balances {
+		if !e.Time.Before(t) {
+			balances = append(balances, e)
+		}
+	}
+	for _, e := range ph.cheques {
+		if !e.Time.Before(t) {
+			cheques = append(cheques, e)
+		}
+	}
+	for _, e := range ph.disconnects {
+		if !e.Time.Before(t) {
+			disconnects = append(disconnects, e)
+		}
+	}
+	return balances, cheques, disconnects
+}
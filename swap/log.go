@@ -37,6 +37,8 @@ const (
 	CashChequeAction string = "cash_cheque"
 	// DeployChequebookAction used when deploying chequebooks
 	DeployChequebookAction string = "deploy_chequebook_contract"
+	// UpdatePricesAction used when updating and advertising message prices
+	UpdatePricesAction string = "update_prices"
 )
 
 // DefaultSwapLogLevel indicates default filter level of log messages
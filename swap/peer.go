@@ -39,20 +39,25 @@ type Peer struct {
 	swap               *Swap
 	beneficiary        common.Address // address of the peers chequebook owner
 	contractAddress    common.Address // address of the peers chequebook
+	token              *Token         // token negotiated for payments, nil for the default chequebook token
 	lastReceivedCheque *Cheque        // last cheque we received from the peer
 	lastSentCheque     *Cheque        // last cheque that was sent to peer that was confirmed
 	pendingCheque      *Cheque        // last cheque that was sent to peer but is not yet confirmed
 	balance            int64          // current balance of the peer
+	prices             priceEpochs    // prices of the peer accepted for the messages it is paid for
+	localPrices        priceEpochs    // prices of the local node advertised to the peer for the messages the local node is paid for
 	logger             Logger         // logger for swap related messages and audit trail with peer identifier
 }
 
 // NewPeer creates a new swap Peer instance
-func NewPeer(p *protocols.Peer, s *Swap, beneficiary common.Address, contractAddress common.Address) (peer *Peer, err error) {
+// token is the token negotiated for payments, nil for the token of the default chequebook
+func NewPeer(p *protocols.Peer, s *Swap, beneficiary common.Address, contractAddress common.Address, token *Token) (peer *Peer, err error) {
 	peer = &Peer{
 		Peer:            p,
 		swap:            s,
 		beneficiary:     beneficiary,
 		contractAddress: contractAddress,
+		token:           token,
 		logger:          newPeerLogger(s, p.ID()),
 	}
 
@@ -75,6 +80,92 @@ func NewPeer(p *protocols.Peer, s *Swap, beneficiary common.Address, contractAdd
 	return peer, nil
 }
 
+// getPrices returns the prices of the peer last accepted for the messages it is paid for
+func (p *Peer) getPrices() Prices {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.prices.current.prices
+}
+
+// acceptPrices records the prices of the peer accepted in the epoch for the messages it is paid for,
+// which price the messages sent to the peer from then on; it returns false for an epoch which is not
+// newer than the last accepted one
+func (p *Peer) acceptPrices(epoch uint64, prices Prices) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if epoch <= p.prices.current.epoch {
+		return false
+	}
+	p.prices.add(epoch, prices)
+	p.prices.use(epoch)
+	return true
+}
+
+// getLocalPrices returns the prices of the local node last confirmed by the peer
+func (p *Peer) getLocalPrices() Prices {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.localPrices.current.prices
+}
+
+// advertisePrices records prices of the local node advertised to the peer and returns their epoch,
+// they are agreed for the message types agreed in the handshake and price the messages sent to the
+// peer once it confirms them
+func (p *Peer) advertisePrices(prices Prices) uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	last := p.localPrices.last()
+	p.localPrices.add(last.epoch+1, prices.only(last.prices))
+	return last.epoch + 1
+}
+
+// confirmPrices records the prices of the epoch confirmed by the peer as the agreed prices of the local node
+// if the epoch is newer than the last confirmed one; it returns false if the prices are not those advertised
+// in the epoch
+func (p *Peer) confirmPrices(epoch uint64, prices Prices) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	advertised, ok := p.localPrices.get(epoch)
+	if !ok || !advertised.equal(prices) {
+		return false
+	}
+	if epoch > p.localPrices.current.epoch {
+		p.localPrices.use(epoch)
+	}
+	return true
+}
+
+// priceEpoch returns the epoch of the current prices of the messages sent to the peer,
+// those of the peer if it is paid for them and those of the local node otherwise
+func (p *Peer) priceEpoch(paidToPeer bool) uint64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if paidToPeer {
+		return p.prices.current.epoch
+	}
+	return p.localPrices.current.epoch
+}
+
+// agreedPrices returns the prices of a message exchanged with the peer, those of the peer if it is
+// paid for it and those of the local node otherwise, of the epoch of the message if it carries one
+func (p *Peer) agreedPrices(msg protocols.PricedMessage, paidToPeer bool) (Prices, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	epochs := &p.localPrices
+	if paidToPeer {
+		epochs = &p.prices
+	}
+	epochMsg, ok := msg.(protocols.EpochMessage)
+	if !ok {
+		return epochs.current.prices, nil
+	}
+	prices, ok := epochs.get(epochMsg.PriceEpoch())
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownPriceEpoch, epochMsg.PriceEpoch())
+	}
+	return prices, nil
+}
+
 // getLastReceivedCheque returns the last cheque we received for this peer
 // the caller is expected to hold p.lock
 func (p *Peer) getLastReceivedCheque() *Cheque {
@@ -114,18 +205,48 @@ func (p *Peer) setPendingCheque(cheque *Cheque) error {
 	return p.swap.savePendingCheque(p.ID(), cheque)
 }
 
-// getLastSentCumulativePayout returns the cumulative payout of the last sent cheque or 0 if there is none
+// chequebookAddress returns the address of our chequebook holding the token negotiated with the peer
+func (p *Peer) chequebookAddress() common.Address {
+	if p.token == nil {
+		return p.swap.GetParams().ContractAddress
+	}
+	return p.token.Chequebook.ContractParams().ContractAddress
+}
+
+// issuedFromChequebook returns whether the cheque was issued from our chequebook holding the token negotiated with the peer
+func (p *Peer) issuedFromChequebook(cheque *Cheque) bool {
+	if p.token != nil {
+		return cheque.Contract == p.token.Chequebook.ContractParams().ContractAddress
+	}
+	for _, t := range p.swap.tokens {
+		if cheque.Contract == t.Chequebook.ContractParams().ContractAddress {
+			return false
+		}
+	}
+	return true
+}
+
+// getLastSentCumulativePayout returns the cumulative payout of the last cheque sent from our chequebook
+// holding the negotiated token or 0 if there is none
 // the caller is expected to hold p.lock
-func (p *Peer) getLastSentCumulativePayout() *int256.Uint256 {
+func (p *Peer) getLastSentCumulativePayout() (*int256.Uint256, error) {
 	lastCheque := p.getLastSentCheque()
+	if lastCheque != nil && !p.issuedFromChequebook(lastCheque) {
+		// the last cheque was issued from the chequebook of another token
+		var err error
+		if lastCheque, err = p.swap.loadLastSentChequebookCheque(p.ID(), p.chequebookAddress()); err != nil {
+			return nil, err
+		}
+	}
 	if lastCheque != nil {
-		return lastCheque.CumulativePayout
+		return lastCheque.CumulativePayout, nil
 	}
-	return int256.Uint256From(0)
+	return int256.Uint256From(0), nil
 }
 
 // the caller is expected to hold p.lock
 func (p *Peer) setBalance(balance int64) error {
+	p.swap.history.addBalance(p.ID(), balance, balance-p.balance)
 	p.balance = balance
 	return p.swap.saveBalance(p.ID(), balance)
 }
@@ -162,13 +283,16 @@ func (p *Peer) createCheque() (*Cheque, error) {
 	// the balance should be negative here, we take the absolute value:
 	honey := uint64(-p.getBalance())
 
-	oraclePrice, err := p.swap.honeyPriceOracle.GetPrice(honey)
+	tokenPrice, err := p.swap.price(p.token, honey)
 	if err != nil {
 		return nil, fmt.Errorf("error getting price from oracle: %v", err)
 	}
-	price := int256.Uint256From(oraclePrice)
+	price := int256.Uint256From(tokenPrice)
 
-	cumulativePayout := p.getLastSentCumulativePayout()
+	cumulativePayout, err := p.getLastSentCumulativePayout()
+	if err != nil {
+		return nil, err
+	}
 	newCumulativePayout, err := new(int256.Uint256).Add(cumulativePayout, price)
 	if err != nil {
 		return nil, err
@@ -177,7 +301,7 @@ func (p *Peer) createCheque() (*Cheque, error) {
 	cheque = &Cheque{
 		ChequeParams: ChequeParams{
 			CumulativePayout: newCumulativePayout,
-			Contract:         p.swap.GetParams().ContractAddress,
+			Contract:         p.chequebookAddress(),
 			Beneficiary:      p.beneficiary,
 		},
 		Honey: honey,
@@ -214,6 +338,7 @@ func (p *Peer) sendCheque() error {
 		return fmt.Errorf("error while updating balance: %v", err)
 	}
 
+	p.swap.history.addCheque(p.ID(), ChequeSentAction, cheque)
 	metrics.GetOrRegisterCounter("swap/cheques/emitted/num", nil).Inc(1)
 	metrics.GetOrRegisterCounter("swap/cheques/emitted/honey", nil).Inc(honeyAmount)
 	p.logger.Info(SendChequeAction, "sending cheque to peer", "cheque", cheque)
@@ -0,0 +1,527 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+const (
+	// DefaultPriceUpdateInterval is the interval at which the prices of the oracle are updated
+	// and advertised to the peers if they changed
+	DefaultPriceUpdateInterval = 10 * time.Minute
+	// DefaultReferenceGasPrice is the gas price in wei at which the gas price indexed oracle returns the base prices
+	DefaultReferenceGasPrice = uint64(1000000000)
+	// DefaultMaxPriceRatio is the multiple of the local prices above which prices advertised by peers are refused
+	DefaultMaxPriceRatio = uint64(10)
+	// maxPriceEpochs is the number of epochs of prices kept for each peer to price the messages sent before they changed
+	maxPriceEpochs = 8
+)
+
+// kinds of price oracles
+const (
+	PriceOracleStatic   = "static"   // prices from the configuration
+	PriceOracleGas      = "gas"      // configured prices scaled by the current gas price
+	PriceOracleContract = "contract" // prices read from a contract
+)
+
+// ErrInvalidPriceOracle is used when the price oracle parameters are invalid
+var ErrInvalidPriceOracle = errors.New("invalid price oracle")
+
+// ErrUnacceptablePrices is used when a peer advertises prices above the limits of the local node
+var ErrUnacceptablePrices = errors.New("unacceptable prices")
+
+// ErrUnknownPriceEpoch is used when a message is priced in an epoch of prices which is not known
+var ErrUnknownPriceEpoch = errors.New("unknown price epoch")
+
+// priceContractABI is the ABI of the contracts providing prices to the contract-backed oracle
+// price returns the price in honey of the message type with the name, 0 if it is not set
+const priceContractABI = `[{"constant":true,"inputs":[{"name":"message","type":"string"}],"name":"price","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// MessagePrice is the price of an accounted message type
+type MessagePrice struct {
+	Message string // name of the message type
+	Value   uint64 // price in honey, per byte if the message type is priced per byte
+}
+
+// Prices are the prices of accounted message types, advertised to peers
+type Prices []MessagePrice
+
+// get returns the price of the message type with the name and whether it has a price
+func (p Prices) get(message string) (uint64, bool) {
+	for _, mp := range p {
+		if mp.Message == message {
+			return mp.Value, true
+		}
+	}
+	return 0, false
+}
+
+// equal returns whether the prices are the same
+func (p Prices) equal(other Prices) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	for _, mp := range p {
+		if v, ok := other.get(mp.Message); !ok || v != mp.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// only returns the prices of the message types priced by the other prices
+func (p Prices) only(other Prices) Prices {
+	filtered := make(Prices, 0, len(p))
+	for _, mp := range p {
+		if _, ok := other.get(mp.Message); ok {
+			filtered = append(filtered, mp)
+		}
+	}
+	return filtered
+}
+
+// merge returns the prices with the prices of the other message types
+// for the types missing in the prices
+func (p Prices) merge(other Prices) Prices {
+	merged := append(Prices(nil), p...)
+	for _, mp := range other {
+		if _, ok := p.get(mp.Message); !ok {
+			merged = append(merged, mp)
+		}
+	}
+	return merged
+}
+
+// DefaultPrices returns the prices defined by the accounted message types
+func DefaultPrices() Prices {
+	return Prices{
+		{Message: "RetrieveRequest", Value: RetrieveRequestPrice},
+		{Message: "ChunkDelivery", Value: ChunkDeliveryPrice},
+	}
+}
+
+// messageName returns the name of the type of the message, the key of its price
+func messageName(msg interface{}) string {
+	t := reflect.TypeOf(msg)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// PriceOracle provides the current prices of the accounted message types
+type PriceOracle interface {
+	// Prices returns the current prices, message types without a price are priced by their definition
+	Prices(ctx context.Context) (Prices, error)
+}
+
+// PriceOracleParams configures the price oracle
+type PriceOracleParams struct {
+	Kind              string         // kind of the oracle, static if empty
+	Prices            Prices         // prices of the static oracle and base prices of the gas price indexed oracle, the default prices for missing message types
+	ReferenceGasPrice uint64         // gas price in wei at which the gas price indexed oracle returns the base prices, DefaultReferenceGasPrice if 0
+	Contract          common.Address // address of the contract providing the prices of the contract-backed oracle
+	UpdateInterval    time.Duration  // interval at which the prices are updated, DefaultPriceUpdateInterval if 0
+	MaxPriceRatio     uint64         // multiple of the local prices above which prices advertised by peers are refused, DefaultMaxPriceRatio if 0
+}
+
+// newPriceOracle creates the price oracle configured by the params, the static oracle
+// with the default prices if params is nil
+func newPriceOracle(params *PriceOracleParams, backend bind.ContractBackend) (PriceOracle, error) {
+	if params == nil {
+		params = new(PriceOracleParams)
+	}
+	prices := params.Prices.merge(DefaultPrices())
+	switch params.Kind {
+	case "", PriceOracleStatic:
+		return NewStaticPriceOracle(prices), nil
+	case PriceOracleGas:
+		reference := params.ReferenceGasPrice
+		if reference == 0 {
+			reference = DefaultReferenceGasPrice
+		}
+		return NewGasPriceOracle(backend, prices, new(big.Int).SetUint64(reference)), nil
+	case PriceOracleContract:
+		if (params.Contract == common.Address{}) {
+			return nil, fmt.Errorf("%w: no price contract address", ErrInvalidPriceOracle)
+		}
+		return NewContractPriceOracle(backend, params.Contract, prices)
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidPriceOracle, params.Kind)
+}
+
+// staticPriceOracle is a price oracle which returns fixed prices
+type staticPriceOracle struct {
+	prices Prices
+}
+
+// NewStaticPriceOracle returns a price oracle returning the prices
+func NewStaticPriceOracle(prices Prices) PriceOracle {
+	return &staticPriceOracle{
+		prices: prices,
+	}
+}
+
+// Prices returns the fixed prices
+func (o *staticPriceOracle) Prices(ctx context.Context) (Prices, error) {
+	return o.prices, nil
+}
+
+// gasPriceOracle is a price oracle which scales base prices by the current gas price,
+// so that the prices follow the costs of settling payments
+type gasPriceOracle struct {
+	backend   bind.ContractTransactor
+	base      Prices
+	reference *big.Int
+}
+
+// NewGasPriceOracle returns a price oracle returning the base prices scaled by the ratio
+// of the current gas price of the backend to the reference gas price
+func NewGasPriceOracle(backend bind.ContractTransactor, base Prices, reference *big.Int) PriceOracle {
+	return &gasPriceOracle{
+		backend:   backend,
+		base:      base,
+		reference: reference,
+	}
+}
+
+// Prices returns the base prices scaled by the current gas price
+func (o *gasPriceOracle) Prices(ctx context.Context) (Prices, error) {
+	gasPrice, err := o.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices := make(Prices, 0, len(o.base))
+	for _, mp := range o.base {
+		value := new(big.Int).SetUint64(mp.Value)
+		value.Mul(value, gasPrice).Div(value, o.reference)
+		if !value.IsUint64() {
+			return nil, fmt.Errorf("price of %s overflows at gas price %s", mp.Message, gasPrice)
+		}
+		prices = append(prices, MessagePrice{Message: mp.Message, Value: value.Uint64()})
+	}
+	return prices, nil
+}
+
+// contractPriceOracle is a price oracle which reads the prices from a contract
+type contractPriceOracle struct {
+	contract *bind.BoundContract
+	defaults Prices
+}
+
+// NewContractPriceOracle returns a price oracle reading the prices of the message types of the
+// default prices from the contract at the address, the default prices if the contract sets none
+func NewContractPriceOracle(backend bind.ContractBackend, address common.Address, defaults Prices) (PriceOracle, error) {
+	parsed, err := abi.JSON(strings.NewReader(priceContractABI))
+	if err != nil {
+		return nil, err
+	}
+	return &contractPriceOracle{
+		contract: bind.NewBoundContract(address, parsed, backend, backend, backend),
+		defaults: defaults,
+	}, nil
+}
+
+// Prices returns the prices set by the contract
+func (o *contractPriceOracle) Prices(ctx context.Context) (Prices, error) {
+	prices := make(Prices, 0, len(o.defaults))
+	for _, mp := range o.defaults {
+		var value *big.Int
+		if err := o.contract.Call(&bind.CallOpts{Context: ctx}, &value, "price", mp.Message); err != nil {
+			return nil, fmt.Errorf("reading price of %s: %w", mp.Message, err)
+		}
+		if value == nil || value.Sign() == 0 {
+			prices = append(prices, mp)
+			continue
+		}
+		if !value.IsUint64() {
+			return nil, fmt.Errorf("price of %s overflows: %s", mp.Message, value)
+		}
+		prices = append(prices, MessagePrice{Message: mp.Message, Value: value.Uint64()})
+	}
+	return prices, nil
+}
+
+// epochPrices are the prices agreed by the peers in an epoch
+type epochPrices struct {
+	epoch  uint64
+	prices Prices
+}
+
+// priceEpochs are the prices of the messages paid to one of the peers by epoch, the messages
+// carry the epoch of their prices so that both peers price them the same while the prices change
+type priceEpochs struct {
+	current epochPrices   // prices of the messages sent from now on
+	epochs  []epochPrices // prices of the last maxPriceEpochs epochs, the oldest first
+}
+
+// newPriceEpochs returns the prices agreed in the handshake as the prices of epoch 0
+func newPriceEpochs(prices Prices) priceEpochs {
+	current := epochPrices{prices: prices}
+	return priceEpochs{
+		current: current,
+		epochs:  []epochPrices{current},
+	}
+}
+
+// add records the prices of an epoch, dropping the oldest epoch if more than maxPriceEpochs are kept
+func (e *priceEpochs) add(epoch uint64, prices Prices) {
+	e.epochs = append(e.epochs, epochPrices{epoch: epoch, prices: prices})
+	if len(e.epochs) > maxPriceEpochs {
+		e.epochs = e.epochs[1:]
+	}
+}
+
+// last returns the prices of the last epoch recorded
+func (e *priceEpochs) last() epochPrices {
+	if len(e.epochs) == 0 {
+		return e.current
+	}
+	return e.epochs[len(e.epochs)-1]
+}
+
+// get returns the prices of the epoch and whether they are known
+func (e *priceEpochs) get(epoch uint64) (Prices, bool) {
+	if epoch == e.current.epoch {
+		return e.current.prices, true
+	}
+	for _, ep := range e.epochs {
+		if ep.epoch == epoch {
+			return ep.prices, true
+		}
+	}
+	return nil, false
+}
+
+// use sets the prices of the recorded epoch as the prices of the messages sent from now on
+func (e *priceEpochs) use(epoch uint64) {
+	if prices, ok := e.get(epoch); ok {
+		e.current = epochPrices{epoch: epoch, prices: prices}
+	}
+}
+
+// pricing keeps the current prices of the local node, updated from the price oracle
+type pricing struct {
+	lock     sync.RWMutex
+	oracle   PriceOracle
+	prices   Prices        // current prices, nil before the first update
+	interval time.Duration // interval of the price updates
+	maxRatio uint64        // multiple of the current prices above which prices of peers are refused
+	quit     chan struct{}
+}
+
+// newPricing creates the prices updated from the oracle at the interval, DefaultPriceUpdateInterval
+// if 0, refusing prices of peers above maxRatio times the current prices, DefaultMaxPriceRatio if 0
+func newPricing(oracle PriceOracle, interval time.Duration, maxRatio uint64) *pricing {
+	if interval == 0 {
+		interval = DefaultPriceUpdateInterval
+	}
+	if maxRatio == 0 {
+		maxRatio = DefaultMaxPriceRatio
+	}
+	return &pricing{
+		oracle:   oracle,
+		interval: interval,
+		maxRatio: maxRatio,
+		quit:     make(chan struct{}),
+	}
+}
+
+// current returns the current prices
+func (p *pricing) current() Prices {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.prices
+}
+
+// update queries the oracle for the current prices and returns whether they changed
+func (p *pricing) update(ctx context.Context) (bool, error) {
+	prices, err := p.oracle.Prices(ctx)
+	if err != nil {
+		return false, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.prices != nil && p.prices.equal(prices) {
+		return false, nil
+	}
+	p.prices = prices
+	return true, nil
+}
+
+// accept returns the prices advertised by a peer for the message types priced by the local prices,
+// the prices of other message types are ignored and the messages priced by their definition
+// it returns ErrUnacceptablePrices if a price exceeds the max ratio of the local price
+// or the int64 range of the accounting
+func (p *pricing) accept(current Prices, prices Prices) (Prices, error) {
+	ratio := new(big.Int).SetUint64(p.maxRatio)
+	accepted := make(Prices, 0, len(current))
+	for _, mp := range prices {
+		if mp.Value > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: price %d of %s overflows", ErrUnacceptablePrices, mp.Value, mp.Message)
+		}
+		local, ok := current.get(mp.Message)
+		if !ok {
+			continue
+		}
+		if _, ok := accepted.get(mp.Message); ok {
+			return nil, fmt.Errorf("%w: duplicate price of %s", ErrUnacceptablePrices, mp.Message)
+		}
+		limit := new(big.Int).Mul(new(big.Int).SetUint64(local), ratio)
+		if new(big.Int).SetUint64(mp.Value).Cmp(limit) > 0 {
+			return nil, fmt.Errorf("%w: price %d of %s exceeds %d", ErrUnacceptablePrices, mp.Value, mp.Message, limit)
+		}
+		accepted = append(accepted, mp)
+	}
+	return accepted, nil
+}
+
+// Price returns the price of the message exchanged with the peer
+// Swap implements the protocols.PriceOracle interface
+// The price of a message is set by the node paid for it and agreed by both peers, so that
+// their balances match: the prices of the peer accepted by the local node are used for the
+// messages paid by the local node, the prices of the local node confirmed by the peer otherwise.
+// Messages carrying the epoch of their prices are priced from the prices of that epoch,
+// messages without an agreed price are priced by their definition
+func (s *Swap) Price(peer *protocols.Peer, msg protocols.PricedMessage, payer protocols.Payer) (*protocols.Price, error) {
+	price := msg.Price()
+	if price == nil {
+		return nil, nil
+	}
+	swapPeer := s.getPeer(peer.ID())
+	if swapPeer == nil {
+		return nil, nil
+	}
+	prices, err := swapPeer.agreedPrices(msg, price.Payer == payer)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := prices.get(messageName(msg))
+	if !ok {
+		return nil, nil
+	}
+	return &protocols.Price{
+		Value:   value,
+		PerByte: price.PerByte,
+		Payer:   price.Payer,
+	}, nil
+}
+
+// PriceEpoch returns the epoch of the current prices of the message sent to the peer
+// Swap implements the protocols.EpochPriceOracle interface
+func (s *Swap) PriceEpoch(peer *protocols.Peer, msg protocols.EpochMessage) uint64 {
+	price := msg.Price()
+	if price == nil {
+		return 0
+	}
+	swapPeer := s.getPeer(peer.ID())
+	if swapPeer == nil {
+		return 0
+	}
+	return swapPeer.priceEpoch(price.Payer == protocols.Sender)
+}
+
+// Prices returns the current prices of the local node, advertised to the peers
+func (s *Swap) Prices() (Prices, error) {
+	return s.pricing.current(), nil
+}
+
+// PeerPrices returns the prices of a connected peer agreed for the messages it is paid for
+func (s *Swap) PeerPrices(peer enode.ID) (Prices, error) {
+	swapPeer := s.getPeer(peer)
+	if swapPeer == nil {
+		return nil, fmt.Errorf("peer %s not a swap enabled peer", peer)
+	}
+	return swapPeer.getPrices(), nil
+}
+
+// runPriceUpdates periodically updates the prices from the oracle and advertises
+// them to the connected peers if they changed, until swap is closed
+func (s *Swap) runPriceUpdates() {
+	for {
+		select {
+		case <-time.After(s.pricing.interval):
+		case <-s.pricing.quit:
+			return
+		}
+		changed, err := s.pricing.update(context.TODO())
+		if err != nil {
+			s.logger.Error(UpdatePricesAction, "updating prices", "err", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		prices := s.pricing.current()
+		s.logger.Info(UpdatePricesAction, "prices changed, advertising to peers", "prices", prices)
+		s.peersLock.RLock()
+		peers := make([]*Peer, 0, len(s.peers))
+		for _, p := range s.peers {
+			peers = append(peers, p)
+		}
+		s.peersLock.RUnlock()
+		for _, p := range peers {
+			epoch := p.advertisePrices(prices)
+			if err := p.Send(context.TODO(), &PricesMsg{Prices: prices, Epoch: epoch}); err != nil {
+				p.logger.Warn(UpdatePricesAction, "advertising prices", "err", err)
+			}
+		}
+	}
+}
+
+// handlePricesMsg accepts the prices advertised by the peer for its epoch and confirms them,
+// the peer is dropped if the prices are not acceptable; advertisements older than the prices
+// last accepted are ignored
+func (s *Swap) handlePricesMsg(ctx context.Context, p *Peer, msg *PricesMsg) error {
+	p.logger.Info(UpdatePricesAction, "received prices from peer", "prices", msg.Prices, "epoch", msg.Epoch)
+	prices, err := s.pricing.accept(s.pricing.current(), msg.Prices)
+	if err != nil {
+		p.logger.Warn(UpdatePricesAction, "refusing prices of peer", "err", err)
+		return protocols.Break(err)
+	}
+	if !p.acceptPrices(msg.Epoch, prices) {
+		p.logger.Warn(UpdatePricesAction, "ignoring prices older than the prices accepted", "epoch", msg.Epoch)
+		return nil
+	}
+	return p.Send(ctx, &ConfirmPricesMsg{Prices: prices, Epoch: msg.Epoch})
+}
+
+// handleConfirmPricesMsg records the prices confirmed by the peer as the prices of the messages
+// it pays for, a confirmation of prices which were not advertised to the peer is ignored
+func (s *Swap) handleConfirmPricesMsg(ctx context.Context, p *Peer, msg *ConfirmPricesMsg) error {
+	if !p.confirmPrices(msg.Epoch, msg.Prices) {
+		p.logger.Warn(UpdatePricesAction, "ignoring confirmation of prices not advertised to peer", "prices", msg.Prices, "epoch", msg.Epoch)
+		return nil
+	}
+	p.logger.Info(UpdatePricesAction, "peer confirmed prices", "prices", msg.Prices, "epoch", msg.Epoch)
+	return nil
+}
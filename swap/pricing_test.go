@@ -0,0 +1,365 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// pricedTestMsg is a message paid by the sender, priced per unit
+type pricedTestMsg struct{}
+
+func (m *pricedTestMsg) Price() *protocols.Price {
+	return &protocols.Price{
+		Value:   1,
+		PerByte: false,
+		Payer:   protocols.Sender,
+	}
+}
+
+// epochTestMsg is a message paid by the sender carrying the epoch of its prices
+type epochTestMsg struct {
+	Epoch uint64
+}
+
+func (m *epochTestMsg) Price() *protocols.Price {
+	return &protocols.Price{
+		Value:   1,
+		PerByte: false,
+		Payer:   protocols.Sender,
+	}
+}
+
+func (m *epochTestMsg) PriceEpoch() uint64 {
+	return m.Epoch
+}
+
+func (m *epochTestMsg) SetPriceEpoch(epoch uint64) {
+	m.Epoch = epoch
+}
+
+// epochDeliveryTestMsg is a message paid by the receiver carrying the epoch of its prices
+type epochDeliveryTestMsg struct {
+	epochTestMsg
+}
+
+func (m *epochDeliveryTestMsg) Price() *protocols.Price {
+	return &protocols.Price{
+		Value:   1,
+		PerByte: false,
+		Payer:   protocols.Receiver,
+	}
+}
+
+// newTestSwapAndPricedPeer creates a swap with the prices and a peer with which the prices
+// of both were agreed in the handshake
+func newTestSwapAndPricedPeer(t *testing.T, key *ecdsa.PrivateKey, localPrices Prices, prices Prices) (*Swap, *Peer, func()) {
+	t.Helper()
+	swap, clean := newTestSwap(t, key, nil)
+	swap.pricing = newPricing(NewStaticPriceOracle(localPrices), 0, 0)
+	if _, err := swap.pricing.update(context.Background()); err != nil {
+		clean()
+		t.Fatal(err)
+	}
+	peer, err := swap.addTokenPeer(newDummyPeerWithSpec(Spec).Peer, ownerAddress, testChequeContract, nil, prices, localPrices)
+	if err != nil {
+		clean()
+		t.Fatal(err)
+	}
+	return swap, peer, clean
+}
+
+// TestPriceOracles tests the prices returned by the price oracles
+func TestPriceOracles(t *testing.T) {
+	prices := Prices{{Message: "RetrieveRequest", Value: 100}}
+
+	oracle, err := newPriceOracle(&PriceOracleParams{Prices: prices}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := oracle.Prices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Prices{{Message: "RetrieveRequest", Value: 100}, {Message: "ChunkDelivery", Value: ChunkDeliveryPrice}}
+	if !got.equal(want) {
+		t.Fatalf("got static prices %v, want %v", got, want)
+	}
+
+	// the simulated backend suggests a gas price of 1 wei
+	backend := newTestBackend(t)
+	defer backend.Close()
+	gasPrice, err := backend.SuggestGasPrice(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference := new(big.Int).Mul(gasPrice, big.NewInt(4))
+	got, err = NewGasPriceOracle(backend, prices, reference).Prices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := got.get("RetrieveRequest"); v != 25 {
+		t.Fatalf("got gas indexed price %d, want 25", v)
+	}
+
+	if _, err := newPriceOracle(&PriceOracleParams{Kind: PriceOracleContract}, nil); !errors.Is(err, ErrInvalidPriceOracle) {
+		t.Fatalf("got error %v for contract oracle without address, want %v", err, ErrInvalidPriceOracle)
+	}
+	if _, err := newPriceOracle(&PriceOracleParams{Kind: "unknown"}, nil); !errors.Is(err, ErrInvalidPriceOracle) {
+		t.Fatalf("got error %v for unknown oracle, want %v", err, ErrInvalidPriceOracle)
+	}
+	if _, err := newPriceOracle(&PriceOracleParams{Kind: PriceOracleContract, Contract: common.HexToAddress("0x1")}, backend); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPricingUpdate tests that the updates of the prices report changes
+func TestPricingUpdate(t *testing.T) {
+	p := newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}}), 0, 0)
+	if p.current() != nil {
+		t.Fatal("expected no prices before the first update")
+	}
+	for i, want := range []bool{true, false} {
+		changed, err := p.update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != want {
+			t.Fatalf("update %d: got changed %v, want %v", i, changed, want)
+		}
+	}
+	if v, ok := p.current().get("pricedTestMsg"); !ok || v != 5 {
+		t.Fatalf("got price %d, want 5", v)
+	}
+}
+
+// TestSwapPrice tests that the price of a message is set by the node paid for it once agreed
+func TestSwapPrice(t *testing.T) {
+	swap, peer, clean := newTestSwapAndPricedPeer(t, ownerKey, Prices{{Message: "pricedTestMsg", Value: 1}}, nil)
+	defer clean()
+
+	swap.pricing = newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}}), 0, 0)
+	if _, err := swap.pricing.update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := swap.handlePricesMsg(context.Background(), peer, &PricesMsg{Prices: Prices{{Message: "pricedTestMsg", Value: 7}}, Epoch: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &pricedTestMsg{}
+	// sending, the local node pays the peer
+	if price, err := swap.Price(peer.Peer, msg, protocols.Sender); err != nil || price == nil || price.Value != 7 {
+		t.Fatalf("got price %v, error %v for sending, want the peer price 7", price, err)
+	}
+	// receiving, the local node is paid, the prices agreed in the handshake are used until the peer confirms the new ones
+	if price, err := swap.Price(peer.Peer, msg, protocols.Receiver); err != nil || price == nil || price.Value != 1 {
+		t.Fatalf("got price %v, error %v for receiving before the confirmation, want the agreed price 1", price, err)
+	}
+	epoch := peer.advertisePrices(swap.pricing.current())
+	if err := swap.handleConfirmPricesMsg(context.Background(), peer, &ConfirmPricesMsg{Prices: swap.pricing.current(), Epoch: epoch}); err != nil {
+		t.Fatal(err)
+	}
+	if price, err := swap.Price(peer.Peer, msg, protocols.Receiver); err != nil || price == nil || price.Value != 5 {
+		t.Fatalf("got price %v, error %v for receiving, want the local price 5", price, err)
+	}
+	// without advertised price the message type defines the price
+	if price, err := swap.Price(peer.Peer, &testMsgSwapPrice{}, protocols.Sender); err != nil || price != nil {
+		t.Fatalf("got price %v, error %v for message without advertised price, want nil", price, err)
+	}
+
+	acc := protocols.NewAccounting(swap)
+	cost, err := acc.Validate(peer.Peer, 0, msg, protocols.Sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != -7 {
+		t.Fatalf("got cost %d, want -7", cost)
+	}
+}
+
+// TestConfirmPrices tests that only confirmations of the prices advertised to the peer in their epoch
+// are recorded, including confirmations of advertisements superseded since
+func TestConfirmPrices(t *testing.T) {
+	swap, peer, clean := newTestSwapAndPricedPeer(t, ownerKey, Prices{{Message: "pricedTestMsg", Value: 1}}, nil)
+	defer clean()
+
+	first := peer.advertisePrices(Prices{{Message: "pricedTestMsg", Value: 5}, {Message: "unknown", Value: 3}})
+	second := peer.advertisePrices(Prices{{Message: "pricedTestMsg", Value: 6}, {Message: "unknown", Value: 3}})
+
+	// the peer confirms the prices of the message types agreed in the handshake
+	for _, tc := range []struct {
+		name      string
+		epoch     uint64
+		confirmed Prices
+		want      Prices
+	}{
+		{name: "not advertised", epoch: second, confirmed: Prices{{Message: "pricedTestMsg", Value: 4}}, want: Prices{{Message: "pricedTestMsg", Value: 1}}},
+		{name: "unknown epoch", epoch: second + 1, confirmed: Prices{{Message: "pricedTestMsg", Value: 6}}, want: Prices{{Message: "pricedTestMsg", Value: 1}}},
+		{name: "superseded", epoch: first, confirmed: Prices{{Message: "pricedTestMsg", Value: 5}}, want: Prices{{Message: "pricedTestMsg", Value: 5}}},
+		{name: "last", epoch: second, confirmed: Prices{{Message: "pricedTestMsg", Value: 6}}, want: Prices{{Message: "pricedTestMsg", Value: 6}}},
+		{name: "already confirmed", epoch: first, confirmed: Prices{{Message: "pricedTestMsg", Value: 5}}, want: Prices{{Message: "pricedTestMsg", Value: 6}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := swap.handleConfirmPricesMsg(context.Background(), peer, &ConfirmPricesMsg{Prices: tc.confirmed, Epoch: tc.epoch}); err != nil {
+				t.Fatal(err)
+			}
+			if got := peer.getLocalPrices(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got agreed prices %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if _, ok := peer.getLocalPrices().get("unknown"); ok {
+		t.Fatal("expected price of message type not agreed in the handshake to be priced by its definition")
+	}
+}
+
+// TestPricesChangeWithTraffic tests that the balances of two peers match when the prices of one
+// of them change while messages priced by them are in flight in both directions, received before
+// and after the confirmation of the new prices
+func TestPricesChangeWithTraffic(t *testing.T) {
+	pricesA := Prices{{Message: "epochTestMsg", Value: 10}, {Message: "epochDeliveryTestMsg", Value: 10}}
+	pricesB := Prices{{Message: "epochTestMsg", Value: 20}, {Message: "epochDeliveryTestMsg", Value: 20}}
+	swapA, peerB, cleanA := newTestSwapAndPricedPeer(t, ownerKey, pricesA, pricesB)
+	defer cleanA()
+	swapB, peerA, cleanB := newTestSwapAndPricedPeer(t, beneficiaryKey, pricesB, pricesA)
+	defer cleanB()
+	accA := protocols.NewAccounting(swapA)
+	accB := protocols.NewAccounting(swapB)
+
+	// send accounts a message at the sender and returns the function accounting it at the receiver
+	send := func(from *protocols.Accounting, to *protocols.Accounting, fromPeer *Peer, toPeer *Peer, msg protocols.PricedMessage) func() {
+		t.Helper()
+		from.Stamp(fromPeer.Peer, msg)
+		cost, err := from.Validate(fromPeer.Peer, 0, msg, protocols.Sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := from.Apply(fromPeer.Peer, cost, 0); err != nil {
+			t.Fatal(err)
+		}
+		return func() {
+			t.Helper()
+			cost, err := to.Validate(toPeer.Peer, 0, msg, protocols.Receiver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := to.Apply(toPeer.Peer, cost, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// traffic sends messages in both directions paid by B to A
+	traffic := func() []func() {
+		return []func(){
+			send(accB, accA, peerA, peerB, &epochTestMsg{}),
+			send(accA, accB, peerB, peerA, &epochDeliveryTestMsg{}),
+		}
+	}
+	deliver := func(inFlight []func()) {
+		for _, receive := range inFlight {
+			receive()
+		}
+	}
+
+	before := traffic()
+	// A changes its prices, B accepts them and its messages are priced by them from then on
+	changed := Prices{{Message: "epochTestMsg", Value: 30}, {Message: "epochDeliveryTestMsg", Value: 30}}
+	epoch := peerB.advertisePrices(changed)
+	if err := swapB.handlePricesMsg(context.Background(), peerA, &PricesMsg{Prices: changed, Epoch: epoch}); err != nil {
+		t.Fatal(err)
+	}
+	// the messages sent before the confirmation is received are received after those sent later
+	beforeConfirmation := traffic()
+	deliver(beforeConfirmation)
+	deliver(before)
+	if err := swapA.handleConfirmPricesMsg(context.Background(), peerB, &ConfirmPricesMsg{Prices: changed, Epoch: epoch}); err != nil {
+		t.Fatal(err)
+	}
+	deliver(traffic())
+
+	// B paid for 3 messages at the old prices and 3 at the new ones
+	if got, want := peerB.getBalance(), int64(3*10+3*30); got != want {
+		t.Fatalf("got balance %d of A with B, want %d", got, want)
+	}
+	if got, want := peerA.getBalance(), -peerB.getBalance(); got != want {
+		t.Fatalf("got balance %d of B with A, want %d", got, want)
+	}
+
+	// messages priced in an epoch which is not known are refused
+	msg := &epochTestMsg{Epoch: epoch + 1}
+	if _, err := accA.Validate(peerB.Peer, 0, msg, protocols.Receiver); !errors.Is(err, ErrUnknownPriceEpoch) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownPriceEpoch)
+	}
+}
+
+// TestHostilePrices tests that prices advertised by peers above the max ratio of the local
+// prices or the int64 range are refused
+func TestHostilePrices(t *testing.T) {
+	swap, peer, clean := newTestSwapAndPeer(t, ownerKey)
+	defer clean()
+
+	swap.pricing = newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}}), 0, 10)
+	if _, err := swap.pricing.update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		prices Prices
+	}{
+		{name: "above ratio", prices: Prices{{Message: "pricedTestMsg", Value: 51}}},
+		{name: "above int64", prices: Prices{{Message: "pricedTestMsg", Value: math.MaxInt64 + 1}}},
+		{name: "unknown above int64", prices: Prices{{Message: "unknown", Value: math.MaxUint64}}},
+		{name: "duplicate", prices: Prices{{Message: "pricedTestMsg", Value: 5}, {Message: "pricedTestMsg", Value: 50}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := swap.handlePricesMsg(context.Background(), peer, &PricesMsg{Prices: tc.prices})
+			if !errors.Is(err, ErrUnacceptablePrices) {
+				t.Fatalf("got error %v, want %v", err, ErrUnacceptablePrices)
+			}
+			if peer.getPrices() != nil {
+				t.Fatalf("expected refused prices not to be recorded, got %v", peer.getPrices())
+			}
+		})
+	}
+
+	// prices up to the limit are accepted, the prices of message types not priced locally are ignored
+	err := swap.handlePricesMsg(context.Background(), peer, &PricesMsg{Prices: Prices{{Message: "pricedTestMsg", Value: 50}, {Message: "unknown", Value: 1000}}, Epoch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price, err := swap.Price(peer.Peer, &pricedTestMsg{}, protocols.Sender); err != nil || price == nil || price.Value != 50 {
+		t.Fatalf("got price %v, error %v, want the peer price 50", price, err)
+	}
+	if _, ok := peer.getPrices().get("unknown"); ok {
+		t.Fatal("expected price of message type not priced locally to be ignored")
+	}
+}
+
+// testMsgSwapPrice is a message without advertised prices
+type testMsgSwapPrice struct {
+	pricedTestMsg
+}
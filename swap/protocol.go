@@ -42,12 +42,14 @@ var (
 	// Spec is the swap protocol specification
 	Spec = &protocols.Spec{
 		Name:       "swap",
-		Version:    1,
+		Version:    5,
 		MaxMsgSize: 10 * 1024 * 1024,
 		Messages: []interface{}{
 			HandshakeMsg{},
 			EmitChequeMsg{},
 			ConfirmChequeMsg{},
+			PricesMsg{},
+			ConfirmPricesMsg{},
 		},
 	}
 )
@@ -98,9 +100,12 @@ func (s *Swap) verifyHandshake(msg interface{}) error {
 func (s *Swap) run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 	protoPeer := protocols.NewPeer(p, rw, Spec)
 
+	localPrices := s.pricing.current()
 	handshake, err := protoPeer.Handshake(context.Background(), &HandshakeMsg{
 		ContractAddress: s.GetParams().ContractAddress,
 		ChainID:         s.chainID,
+		Chequebooks:     s.tokenChequebooks(),
+		Prices:          localPrices,
 	}, s.verifyHandshake)
 	if err != nil {
 		return err
@@ -110,13 +115,30 @@ func (s *Swap) run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 	if !ok {
 		return ErrInvalidHandshakeMsg
 	}
+	// peers advertising unacceptable prices are dropped, both peers agree on the prices
+	// advertised in the handshake for the message types priced by both
+	prices, err := s.pricing.accept(localPrices, response.Prices)
+	if err != nil {
+		return err
+	}
+	localPrices = localPrices.only(response.Prices)
 
 	beneficiary, err := s.getContractOwner(context.Background(), response.ContractAddress)
 	if err != nil {
 		return err
 	}
 
-	swapPeer, err := s.addPeer(protoPeer, beneficiary, response.ContractAddress)
+	// pay with the token accepted by both peers, in the chequebooks holding it
+	contractAddress := response.ContractAddress
+	token, chequebook := s.negotiateToken(response.Chequebooks)
+	if token != nil {
+		if err := s.verifyTokenChequebook(context.Background(), chequebook, token, beneficiary); err != nil {
+			return err
+		}
+		contractAddress = chequebook
+	}
+
+	swapPeer, err := s.addTokenPeer(protoPeer, beneficiary, contractAddress, token, prices, localPrices)
 	if err != nil {
 		return err
 	}
@@ -132,12 +154,20 @@ func (s *Swap) removePeer(p *Peer) {
 }
 
 func (s *Swap) addPeer(protoPeer *protocols.Peer, beneficiary common.Address, contractAddress common.Address) (*Peer, error) {
+	return s.addTokenPeer(protoPeer, beneficiary, contractAddress, nil, nil, nil)
+}
+
+// addTokenPeer adds a peer paying and being paid in the token, nil for the default chequebook token,
+// with the prices of the peer and of the local node agreed in the handshake
+func (s *Swap) addTokenPeer(protoPeer *protocols.Peer, beneficiary common.Address, contractAddress common.Address, token *Token, prices Prices, localPrices Prices) (*Peer, error) {
 	s.peersLock.Lock()
 	defer s.peersLock.Unlock()
-	p, err := NewPeer(protoPeer, s, beneficiary, contractAddress)
+	p, err := NewPeer(protoPeer, s, beneficiary, contractAddress, token)
 	if err != nil {
 		return nil, err
 	}
+	p.prices = newPriceEpochs(prices)
+	p.localPrices = newPriceEpochs(localPrices)
 	s.peers[p.ID()] = p
 	return p, nil
 }
@@ -18,8 +18,10 @@ package swap
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -51,7 +53,16 @@ type swapTester struct {
 
 // creates a new protocol tester for swap with a deployed chequebook
 func newSwapTester(t *testing.T, backend *swapTestBackend, depositAmount *int256.Uint256) (*swapTester, func(), error) {
+	return newSwapTesterWithPricing(t, backend, depositAmount, nil)
+}
+
+// newSwapTesterWithPricing creates a swap protocol tester pricing messages with the pricing,
+// the default one if nil, which is set before the protocol runs
+func newSwapTesterWithPricing(t *testing.T, backend *swapTestBackend, depositAmount *int256.Uint256, pricing *pricing) (*swapTester, func(), error) {
 	swap, clean := newTestSwap(t, ownerKey, backend)
+	if pricing != nil {
+		swap.pricing = pricing
+	}
 
 	err := testDeploy(context.Background(), swap, depositAmount)
 	if err != nil {
@@ -216,6 +227,134 @@ func TestHandshakeInvalidContract(t *testing.T) {
 	}
 }
 
+// TestHandshakeUnacceptablePrices tests that a peer advertising prices above the limit in the handshake is dropped
+func TestHandshakeUnacceptablePrices(t *testing.T) {
+	pricing := newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}}), 0, 10)
+	if _, err := pricing.update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// setup the protocolTester, which will allow protocol testing by sending messages
+	protocolTester, clean, err := newSwapTesterWithPricing(t, nil, int256.Uint256From(0), pricing)
+	defer clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lhs := correctSwapHandshakeMsg(protocolTester.swap)
+	lhs.Prices = protocolTester.swap.pricing.current()
+	rhs := correctSwapHandshakeMsg(protocolTester.swap)
+	rhs.Prices = Prices{{Message: "pricedTestMsg", Value: 51}}
+	_, acceptErr := protocolTester.swap.pricing.accept(lhs.Prices, rhs.Prices)
+	if acceptErr == nil {
+		t.Fatal("expected prices above the limit to be refused")
+	}
+
+	err = protocolTester.testHandshake(lhs, rhs, &p2ptest.Disconnect{
+		Peer:  protocolTester.Nodes[0].ID(),
+		Error: acceptErr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestHandshakeAgreedPrices tests that the peers agree on the prices advertised in the handshake
+// for the message types priced by both, and that the prices advertised later are confirmed
+func TestHandshakeAgreedPrices(t *testing.T) {
+	pricing := newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}, {Message: "local", Value: 2}}), 0, 10)
+	if _, err := pricing.update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// setup the protocolTester, which will allow protocol testing by sending messages
+	protocolTester, clean, err := newSwapTesterWithPricing(t, nil, int256.Uint256From(0), pricing)
+	defer clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lhs := correctSwapHandshakeMsg(protocolTester.swap)
+	lhs.Prices = protocolTester.swap.pricing.current()
+	rhs := correctSwapHandshakeMsg(protocolTester.swap)
+	rhs.Prices = Prices{{Message: "pricedTestMsg", Value: 7}, {Message: "remote", Value: 9}}
+	if err := protocolTester.testHandshake(lhs, rhs); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := protocolTester.swap.getPeer(protocolTester.Nodes[0].ID())
+	if peer == nil {
+		t.Fatal("expected peer to be added")
+	}
+	if got, want := peer.getPrices(), (Prices{{Message: "pricedTestMsg", Value: 7}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got agreed prices of the peer %v, want %v", got, want)
+	}
+	if got, want := peer.getLocalPrices(), (Prices{{Message: "pricedTestMsg", Value: 5}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got agreed local prices %v, want %v", got, want)
+	}
+
+	// prices advertised by the peer are confirmed for the message types priced locally
+	err = protocolTester.TestExchanges(p2ptest.Exchange{
+		Label: "confirm prices",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 3,
+				Msg:  &PricesMsg{Prices: Prices{{Message: "pricedTestMsg", Value: 8}, {Message: "remote", Value: 10}}, Epoch: 1},
+				Peer: protocolTester.Nodes[0].ID(),
+			},
+		},
+		Expects: []p2ptest.Expect{
+			{
+				Code: 4,
+				Msg:  &ConfirmPricesMsg{Prices: Prices{{Message: "pricedTestMsg", Value: 8}}, Epoch: 1},
+				Peer: protocolTester.Nodes[0].ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPricesMsgUnacceptablePrices tests that a peer advertising prices above the limit after the handshake is dropped
+func TestPricesMsgUnacceptablePrices(t *testing.T) {
+	pricing := newPricing(NewStaticPriceOracle(Prices{{Message: "pricedTestMsg", Value: 5}}), 0, 10)
+	if _, err := pricing.update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// setup the protocolTester, which will allow protocol testing by sending messages
+	protocolTester, clean, err := newSwapTesterWithPricing(t, nil, int256.Uint256From(0), pricing)
+	defer clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := correctSwapHandshakeMsg(protocolTester.swap)
+	handshake.Prices = protocolTester.swap.pricing.current()
+	err = protocolTester.TestExchanges(HandshakeMsgExchange(handshake, handshake, protocolTester.Nodes[0].ID())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = protocolTester.TestExchanges(p2ptest.Exchange{
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 3,
+				Msg:  &PricesMsg{Prices: Prices{{Message: "pricedTestMsg", Value: math.MaxUint64}}, Epoch: 1},
+				Peer: protocolTester.Nodes[0].ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = protocolTester.TestDisconnected(&p2ptest.Disconnect{
+		Peer:  protocolTester.Nodes[0].ID(),
+		Error: errors.New("subprotocol error"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestEmitCheque tests the correct processing of EmitChequeMsg messages
 // One protocol tester is created which will receive the EmitChequeMsg
 // A second swap instance is created for easy creation of a chequebook contract which is deployed to the simulated backend
@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -35,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethersphere/swarm/contracts/swap"
 	contract "github.com/ethersphere/swarm/contracts/swap"
+	"github.com/ethersphere/swarm/events"
 	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/p2p/protocols"
 	"github.com/ethersphere/swarm/state"
@@ -61,9 +63,13 @@ type Swap struct {
 	chainID           uint64                     // id of the chain the backend is connected to
 	params            *Params                    // economic and operational parameters
 	contract          contract.Contract          // reference to the smart contract
+	tokens            []*Token                   // tokens accepted besides the default chequebook token, in order of preference
 	chequebookFactory contract.SimpleSwapFactory // the chequebook factory used
 	honeyPriceOracle  HoneyOracle                // oracle which resolves the price of honey (in Wei)
 	cashoutProcessor  *CashoutProcessor          // processor for cashing out
+	cashouts          *cashouts                  // strategy deciding when received cheques are cashed
+	history           *history                   // accounting history of peers
+	pricing           *pricing                   // current prices of the messages the node is paid for
 	logger            Logger                     //Swap Logger
 }
 
@@ -76,11 +82,14 @@ type Owner struct {
 
 // Params encapsulates economic and operational parameters
 type Params struct {
-	BaseAddrs           *network.BzzAddr // this node's base address
-	LogPath             string           // optional audit log path
-	LogLevel            int              // optional indicates audit filter level of swap log messages
-	PaymentThreshold    int64            // honey amount at which a payment is triggered
-	DisconnectThreshold int64            // honey amount at which a peer disconnects
+	BaseAddrs           *network.BzzAddr   // this node's base address
+	LogPath             string             // optional audit log path
+	LogLevel            int                // optional indicates audit filter level of swap log messages
+	PaymentThreshold    int64              // honey amount at which a payment is triggered
+	DisconnectThreshold int64              // honey amount at which a peer disconnects
+	Tokens              []TokenParams      // chequebooks of tokens accepted besides the default one, in order of preference
+	CashoutStrategy     *CashoutStrategy   // strategy deciding when received cheques are cashed, the default one if nil
+	PriceOracle         *PriceOracleParams // oracle of the prices of the messages the node is paid for, the default prices if nil
 }
 
 // newSwapInstance is a swap constructor function without integrity checks
@@ -95,6 +104,9 @@ func newSwapInstance(stateStore state.Store, owner *Owner, backend chain.Backend
 		honeyPriceOracle:  NewHoneyPriceOracle(),
 		chainID:           chainID,
 		cashoutProcessor:  newCashoutProcessor(backend, owner.privateKey),
+		cashouts:          newCashouts(params.CashoutStrategy),
+		history:           newHistory(),
+		pricing:           newPricing(NewStaticPriceOracle(DefaultPrices()), 0, 0),
 		logger:            logger,
 	}
 }
@@ -105,6 +117,7 @@ func newSwapInstance(stateStore state.Store, owner *Owner, backend chain.Backend
 // - connects to the blockchain backend;
 // - verifies that we have not connected SWAP before on a different blockchain backend;
 // - starts the chequebook; creates the swap instance
+// - starts cashing received cheques following the cashout strategy
 func New(dbPath string, prvkey *ecdsa.PrivateKey, backendURL string, params *Params, chequebookAddressFlag common.Address, skipDepositFlag bool, depositAmountFlag uint64, factoryAddress common.Address) (swap *Swap, err error) {
 	// swap log for auditing purposes
 	swapLogger := newSwapLogger(params.LogPath, params.LogLevel, params.BaseAddrs)
@@ -150,6 +163,13 @@ func New(dbPath string, prvkey *ecdsa.PrivateKey, backendURL string, params *Par
 		return nil, err
 	}
 
+	// a cashout strategy set in the params has to be valid
+	if params.CashoutStrategy != nil {
+		if err := params.CashoutStrategy.validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	// create the swap instance
 	swap = newSwapInstance(
 		stateStore,
@@ -164,6 +184,26 @@ func New(dbPath string, prvkey *ecdsa.PrivateKey, backendURL string, params *Par
 	if swap.contract, err = swap.StartChequebook(chequebookAddressFlag); err != nil {
 		return nil, err
 	}
+	// bind the chequebooks of additional payment tokens
+	if swap.tokens, err = swap.bindTokens(params.Tokens); err != nil {
+		return nil, err
+	}
+	// set up the price oracle and get the current prices
+	oracle, err := newPriceOracle(params.PriceOracle, backend)
+	if err != nil {
+		return nil, err
+	}
+	var priceUpdateInterval time.Duration
+	var maxPriceRatio uint64
+	if params.PriceOracle != nil {
+		priceUpdateInterval = params.PriceOracle.UpdateInterval
+		maxPriceRatio = params.PriceOracle.MaxPriceRatio
+	}
+	swap.pricing = newPricing(oracle, priceUpdateInterval, maxPriceRatio)
+	if _, err := swap.pricing.update(context.TODO()); err != nil {
+		return nil, fmt.Errorf("getting prices from the price oracle: %w", err)
+	}
+	swapLogger.Info(InitAction, "using prices", "prices", swap.pricing.current())
 
 	// deposit money in the chequebook if desired
 	if !skipDepositFlag {
@@ -185,6 +225,11 @@ func New(dbPath string, prvkey *ecdsa.PrivateKey, backendURL string, params *Par
 		}
 	}
 
+	// cash received cheques periodically if the cashout strategy defines an interval
+	go swap.runCashouts()
+	// update the prices periodically and advertise them to peers if they changed
+	go swap.runPriceUpdates()
+
 	return swap, nil
 }
 
@@ -195,6 +240,11 @@ const (
 	pendingChequePrefix    = "pending_cheque_"
 	connectedChequebookKey = "connected_chequebook"
 	connectedBlockchainKey = "connected_blockchain"
+
+	// the last cheques exchanged with a peer in each chequebook, as cumulative payouts
+	// continue from them when a token is used again after paying in another
+	chequebookSentChequePrefix     = "chequebook_sent_cheque_"
+	chequebookReceivedChequePrefix = "chequebook_received_cheque_"
 )
 
 // createFactory determines the factory address and returns and error if no factory address has been specified or is unknown for the network
@@ -255,6 +305,16 @@ func pendingChequeKey(peer enode.ID) string {
 	return pendingChequePrefix + peer.String()
 }
 
+// returns the store key for retrieving the last cheque sent to a peer from a chequebook
+func chequebookSentChequeKey(chequebook common.Address, peer enode.ID) string {
+	return chequebookSentChequePrefix + chequebook.Hex() + "_" + peer.String()
+}
+
+// returns the store key for retrieving the last cheque received from a peer issued from a chequebook
+func chequebookReceivedChequeKey(chequebook common.Address, peer enode.ID) string {
+	return chequebookReceivedChequePrefix + chequebook.Hex() + "_" + peer.String()
+}
+
 func keyToID(key string, prefix string) enode.ID {
 	return enode.HexID(key[len(prefix):])
 }
@@ -274,6 +334,7 @@ func (s *Swap) modifyBalanceOk(amount int64, swapPeer *Peer) (err error) {
 	// check if balance with peer is over the disconnect threshold and if the message would increase the existing debt
 	balance := swapPeer.getBalance()
 	if balance >= s.params.DisconnectThreshold && amount > 0 {
+		s.history.addDisconnect(swapPeer.ID(), balance, amount)
 		return fmt.Errorf("balance for peer %s is over the disconnect threshold %d and cannot incur more debt, disconnecting", swapPeer.ID().String(), s.params.DisconnectThreshold)
 	}
 
@@ -337,6 +398,10 @@ func (s *Swap) handleMsg(p *Peer) func(ctx context.Context, msg interface{}) err
 			return s.handleEmitChequeMsg(ctx, p, msg)
 		case *ConfirmChequeMsg:
 			return s.handleConfirmChequeMsg(ctx, p, msg)
+		case *PricesMsg:
+			return s.handlePricesMsg(ctx, p, msg)
+		case *ConfirmPricesMsg:
+			return s.handleConfirmPricesMsg(ctx, p, msg)
 		}
 		return nil
 	}
@@ -376,6 +441,7 @@ func (s *Swap) handleEmitChequeMsg(ctx context.Context, p *Peer, msg *EmitCheque
 		return protocols.Break(fmt.Errorf("updating balance: %w", err))
 	}
 
+	s.history.addCheque(p.ID(), ChequeReceivedAction, cheque)
 	metrics.GetOrRegisterCounter("swap/cheques/received/num", nil).Inc(1)
 	metrics.GetOrRegisterCounter("swap/cheques/received/honey", nil).Inc(honeyAmount)
 
@@ -386,21 +452,13 @@ func (s *Swap) handleEmitChequeMsg(ctx context.Context, p *Peer, msg *EmitCheque
 		return protocols.Break(err)
 	}
 
-	expectedPayout, transactionCosts, err := s.cashoutProcessor.estimatePayout(context.TODO(), cheque)
+	estimate, err := s.estimateCashout(context.TODO(), p.ID(), cheque)
 	if err != nil {
 		return protocols.Break(err)
 	}
 
-	costsMultiplier := int256.Uint256From(2)
-	costThreshold, err := new(int256.Uint256).Mul(transactionCosts, costsMultiplier)
-	if err != nil {
-		return err
-	}
-
-	// do a payout transaction if we get 2 times the gas costs
-	if expectedPayout.Cmp(costThreshold) == 1 {
-		go defaultCashCheque(s, cheque)
-	}
+	// do a payout transaction if the cashout strategy decides to
+	s.cashout(estimate, p.chequebookAddress(), false)
 
 	return nil
 }
@@ -424,6 +482,11 @@ func (s *Swap) handleConfirmChequeMsg(ctx context.Context, p *Peer, msg *Confirm
 		return protocols.Break(fmt.Errorf("encoding cheque failed: %w", err))
 	}
 
+	err = batch.Put(chequebookSentChequeKey(cheque.Contract, p.ID()), cheque)
+	if err != nil {
+		return protocols.Break(fmt.Errorf("encoding cheque failed: %w", err))
+	}
+
 	err = batch.Put(pendingChequeKey(p.ID()), nil)
 	if err != nil {
 		return protocols.Break(fmt.Errorf("encoding pending cheque failed: %w", err))
@@ -436,16 +499,18 @@ func (s *Swap) handleConfirmChequeMsg(ctx context.Context, p *Peer, msg *Confirm
 
 	p.lastSentCheque = cheque
 	p.pendingCheque = nil
+	s.history.addCheque(p.ID(), ChequeConfirmedAction, cheque)
 
 	return nil
 }
 
 // cashCheque should be called async as it blocks until the transaction(s) are mined
 // The function cashes the cheque by sending it to the blockchain
-func cashCheque(s *Swap, cheque *Cheque) {
+// the payout is sent to the destination, our chequebook holding the same token as the issuer's
+func cashCheque(s *Swap, cheque *Cheque, destination common.Address) {
 	err := s.cashoutProcessor.cashCheque(context.Background(), &CashoutRequest{
 		Cheque:      *cheque,
-		Destination: s.GetParams().ContractAddress,
+		Destination: destination,
 		Logger:      s.logger,
 	})
 
@@ -464,9 +529,17 @@ func (s *Swap) processAndVerifyCheque(cheque *Cheque, p *Peer) (*int256.Uint256,
 	}
 
 	lastCheque := p.getLastReceivedCheque()
+	// cumulative payouts are only comparable within the same chequebook,
+	// they continue from the last cheque received from it before another token was used
+	if lastCheque != nil && lastCheque.Contract != cheque.Contract {
+		var err error
+		if lastCheque, err = s.loadLastReceivedChequebookCheque(p.ID(), cheque.Contract); err != nil {
+			return nil, err
+		}
+	}
 
 	// TODO: there should probably be a lock here?
-	expectedAmount, err := s.honeyPriceOracle.GetPrice(cheque.Honey)
+	expectedAmount, err := s.price(p.token, cheque.Honey)
 	if err != nil {
 		return nil, err
 	}
@@ -517,6 +590,37 @@ func (s *Swap) loadLastSentCheque(p enode.ID) (cheque *Cheque, err error) {
 	return cheque, nil
 }
 
+// loadLastReceivedChequebookCheque loads the last cheque received from the peer issued from the chequebook
+// and returns nil when there never was such a cheque saved
+func (s *Swap) loadLastReceivedChequebookCheque(p enode.ID, chequebook common.Address) (cheque *Cheque, err error) {
+	return s.loadChequebookCheque(chequebookReceivedChequeKey(chequebook, p), receivedChequeKey(p), chequebook)
+}
+
+// loadLastSentChequebookCheque loads the last cheque sent to the peer from the chequebook
+// and returns nil when there never was such a cheque saved
+func (s *Swap) loadLastSentChequebookCheque(p enode.ID, chequebook common.Address) (cheque *Cheque, err error) {
+	return s.loadChequebookCheque(chequebookSentChequeKey(chequebook, p), sentChequeKey(p), chequebook)
+}
+
+// loadChequebookCheque loads the cheque of a chequebook stored under key, stores written
+// before cheques were kept per chequebook only hold the last cheque of the peer under peerKey
+func (s *Swap) loadChequebookCheque(key string, peerKey string, chequebook common.Address) (cheque *Cheque, err error) {
+	err = s.store.Get(key, &cheque)
+	if err == state.ErrNotFound {
+		err = s.store.Get(peerKey, &cheque)
+		if err == nil && cheque != nil && cheque.Contract != chequebook {
+			return nil, nil
+		}
+	}
+	if err == state.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cheque, nil
+}
+
 // loadPendingCheque loads the current pending cheque for the peer from the store
 // and returns nil when there never was a pending cheque saved
 func (s *Swap) loadPendingCheque(p enode.ID) (cheque *Cheque, err error) {
@@ -544,13 +648,27 @@ func (s *Swap) loadBalance(p enode.ID) (balance int64, err error) {
 }
 
 // saveLastReceivedCheque saves cheque as the last received cheque for peer
+// and as the last one received from the chequebook it was issued from
 func (s *Swap) saveLastReceivedCheque(p enode.ID, cheque *Cheque) error {
-	return s.store.Put(receivedChequeKey(p), cheque)
+	return s.saveChequebookCheque(receivedChequeKey(p), chequebookReceivedChequeKey(cheque.Contract, p), cheque)
 }
 
-// saveLastSentCheque saves cheque as the last received cheque for peer
+// saveLastSentCheque saves cheque as the last sent cheque for peer
+// and as the last one sent from the chequebook it was issued from
 func (s *Swap) saveLastSentCheque(p enode.ID, cheque *Cheque) error {
-	return s.store.Put(sentChequeKey(p), cheque)
+	return s.saveChequebookCheque(sentChequeKey(p), chequebookSentChequeKey(cheque.Contract, p), cheque)
+}
+
+// saveChequebookCheque saves cheque under the key of the peer and the key of its chequebook
+func (s *Swap) saveChequebookCheque(peerKey string, chequebookKey string, cheque *Cheque) error {
+	batch := new(state.StoreBatch)
+	if err := batch.Put(peerKey, cheque); err != nil {
+		return err
+	}
+	if err := batch.Put(chequebookKey, cheque); err != nil {
+		return err
+	}
+	return s.store.WriteBatch(batch)
 }
 
 // savePendingCheque saves cheque as the last pending cheque for peer
@@ -565,9 +683,24 @@ func (s *Swap) saveBalance(p enode.ID, balance int64) error {
 
 // Close cleans up swap
 func (s *Swap) Close() error {
+	select {
+	case <-s.cashouts.quit:
+	default:
+		close(s.cashouts.quit)
+	}
+	select {
+	case <-s.pricing.quit:
+	default:
+		close(s.pricing.quit)
+	}
 	return s.store.Close()
 }
 
+// SetEvents sets the bus bounced cheques are published on
+func (s *Swap) SetEvents(b *events.Bus) {
+	s.cashoutProcessor.events = b
+}
+
 // GetParams returns contract parameters (Bin, ABI, contractAddress) from the contract
 func (s *Swap) GetParams() *contract.Params {
 	return s.contract.ContractParams()
@@ -26,6 +26,7 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	mrand "math/rand"
 	"os"
@@ -1414,8 +1415,12 @@ func TestPeerGetLastSentCumulativePayout(t *testing.T) {
 	_, peer, clean := newTestSwapAndPeer(t, ownerKey)
 	defer clean()
 
-	if !peer.getLastSentCumulativePayout().Equals(int256.Uint256From(0)) {
-		t.Fatalf("last cumulative payout should be 0 in the beginning, was %v", peer.getLastSentCumulativePayout())
+	lastPayout, err := peer.getLastSentCumulativePayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lastPayout.Equals(int256.Uint256From(0)) {
+		t.Fatalf("last cumulative payout should be 0 in the beginning, was %v", lastPayout)
 	}
 
 	cheque := newTestCheque()
@@ -1423,8 +1428,100 @@ func TestPeerGetLastSentCumulativePayout(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if peer.getLastSentCumulativePayout() != cheque.CumulativePayout {
-		t.Fatalf("last cumulative payout should be the payout of the last sent cheque, was: %v, expected %v", peer.getLastSentCumulativePayout(), cheque.CumulativePayout)
+	if lastPayout, err = peer.getLastSentCumulativePayout(); err != nil {
+		t.Fatal(err)
+	}
+	if lastPayout != cheque.CumulativePayout {
+		t.Fatalf("last cumulative payout should be the payout of the last sent cheque, was: %v, expected %v", lastPayout, cheque.CumulativePayout)
+	}
+}
+
+// TestPeerChequebookSwitch tests that cumulative payouts continue from the last cheque
+// of a chequebook when the token paid in with a peer is switched from A to B and back to A
+func TestPeerChequebookSwitch(t *testing.T) {
+	swap, clean := newTestSwap(t, ownerKey, nil)
+	defer clean()
+	ctx := context.Background()
+	if err := testDeploy(ctx, swap, int256.Uint256From(0)); err != nil {
+		t.Fatal(err)
+	}
+	chequebookB, err := testDeployWithPrivateKey(ctx, swap.backend, swap.owner.privateKey, swap.owner.address, int256.Uint256From(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenB := &Token{Address: common.HexToAddress("0x1"), Rate: 1, Chequebook: chequebookB}
+	swap.tokens = []*Token{tokenB}
+	protoPeer := newDummyPeerWithSpec(Spec).Peer
+
+	// pay sends a cheque for the honey to the peer paid in the token, nil for the default one, and confirms it
+	pay := func(token *Token, honey int64) *Cheque {
+		t.Helper()
+		peer, err := swap.addTokenPeer(protoPeer, ownerAddress, testChequeContract, token, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer.lock.Lock()
+		if err := peer.setBalance(-honey); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.sendCheque(); err != nil {
+			t.Fatal(err)
+		}
+		cheque := peer.getPendingCheque()
+		peer.lock.Unlock()
+		if err := swap.handleConfirmChequeMsg(ctx, peer, &ConfirmChequeMsg{Cheque: cheque}); err != nil {
+			t.Fatal(err)
+		}
+		return cheque
+	}
+
+	chequeA := pay(nil, 10)
+	chequeB := pay(tokenB, 20)
+	if chequeB.Contract != chequebookB.ContractParams().ContractAddress {
+		t.Fatalf("expected cheque issued from chequebook %x, was %x", chequebookB.ContractParams().ContractAddress, chequeB.Contract)
+	}
+	if !chequeB.CumulativePayout.Equals(int256.Uint256From(20)) {
+		t.Fatalf("expected cumulative payout 20 of the first cheque of chequebook B, was %v", chequeB.CumulativePayout)
+	}
+	chequeA2 := pay(nil, 30)
+	if chequeA2.Contract != chequeA.Contract {
+		t.Fatalf("expected cheque issued from chequebook %x, was %x", chequeA.Contract, chequeA2.Contract)
+	}
+	if !chequeA2.CumulativePayout.Equals(int256.Uint256From(40)) {
+		t.Fatalf("expected cumulative payout 40 continuing from the last cheque of chequebook A, was %v", chequeA2.CumulativePayout)
+	}
+
+	// receive processes a cheque issued by the peer from the chequebook with the cumulative payout for the honey
+	swap.owner.address = beneficiaryAddress
+	chequebookX, chequebookY := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	receive := func(chequebook common.Address, cumulativePayout uint64, honey uint64) error {
+		t.Helper()
+		peer, err := swap.addPeer(protoPeer, ownerAddress, chequebook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cheque, err := newSignedTestCheque(chequebook, beneficiaryAddress, int256.Uint256From(cumulativePayout), ownerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cheque.Honey = honey
+		peer.lock.Lock()
+		defer peer.lock.Unlock()
+		_, err = swap.processAndVerifyCheque(cheque, peer)
+		return err
+	}
+
+	if err := receive(chequebookX, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := receive(chequebookY, 20, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := receive(chequebookX, 40, 30); err != nil {
+		t.Fatalf("expected cheque continuing from the last cheque of chequebook X to be accepted: %v", err)
+	}
+	if err := receive(chequebookX, 30, 30); err == nil {
+		t.Fatal("expected cheque not continuing from the last cheque of chequebook X to be rejected")
 	}
 }
 
@@ -1508,3 +1605,70 @@ func TestAvailableBalance(t *testing.T) {
 	}
 
 }
+
+func TestNegotiateToken(t *testing.T) {
+	tokenA := &Token{Address: common.HexToAddress("0x1"), Rate: 1}
+	tokenB := &Token{Address: common.HexToAddress("0x2"), Rate: 1}
+	tokenC := &Token{Address: common.HexToAddress("0x3"), Rate: 1}
+	swap := &Swap{tokens: []*Token{tokenA, tokenB, tokenC}}
+
+	chequebookA := TokenChequebook{Token: tokenA.Address, Contract: common.HexToAddress("0xa")}
+	chequebookB := TokenChequebook{Token: tokenB.Address, Contract: common.HexToAddress("0xb")}
+	chequebookC := TokenChequebook{Token: tokenC.Address, Contract: common.HexToAddress("0xc")}
+	chequebookD := TokenChequebook{Token: common.HexToAddress("0x4"), Contract: common.HexToAddress("0xd")}
+
+	for _, tc := range []struct {
+		name       string
+		offered    []TokenChequebook
+		token      *Token
+		chequebook common.Address
+	}{
+		{name: "none offered"},
+		{name: "no common token", offered: []TokenChequebook{chequebookD}},
+		{name: "single common token", offered: []TokenChequebook{chequebookD, chequebookC}, token: tokenC, chequebook: chequebookC.Contract},
+		{name: "same preference", offered: []TokenChequebook{chequebookA, chequebookB}, token: tokenA, chequebook: chequebookA.Contract},
+		{name: "lowest rank sum", offered: []TokenChequebook{chequebookC, chequebookD, chequebookB}, token: tokenC, chequebook: chequebookC.Contract},
+		{name: "tie broken by address", offered: []TokenChequebook{chequebookC, chequebookB, chequebookA}, token: tokenA, chequebook: chequebookA.Contract},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, chequebook := swap.negotiateToken(tc.offered)
+			if token != tc.token {
+				t.Fatalf("expected token %v, got %v", tc.token, token)
+			}
+			if chequebook != tc.chequebook {
+				t.Fatalf("expected chequebook %x, got %x", tc.chequebook, chequebook)
+			}
+		})
+	}
+}
+
+func TestTokenPrice(t *testing.T) {
+	swap := &Swap{honeyPriceOracle: NewHoneyPriceOracle()}
+	honey := uint64(10)
+	oraclePrice, err := swap.honeyPriceOracle.GetPrice(honey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, err := swap.price(nil, honey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != oraclePrice {
+		t.Fatalf("expected price %d for the default token, got %d", oraclePrice, price)
+	}
+
+	token := &Token{Address: common.HexToAddress("0x1"), Rate: 3}
+	price, err = swap.price(token, honey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 3*oraclePrice {
+		t.Fatalf("expected price %d, got %d", 3*oraclePrice, price)
+	}
+
+	token.Rate = math.MaxUint64
+	if _, err = swap.price(token, honey); err == nil {
+		t.Fatal("expected price overflow error")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	contract "github.com/ethersphere/swarm/contracts/swap"
+)
+
+// ErrInvalidTokenChequebook is used when a chequebook does not hold the announced token or has a different issuer
+var ErrInvalidTokenChequebook = errors.New("invalid token chequebook")
+
+// TokenParams configures a chequebook holding an ERC20 token accepted for payments
+// besides the token of the default chequebook
+type TokenParams struct {
+	Chequebook common.Address // address of the chequebook, owned by the node
+	Rate       uint64         // token units paid for one unit of the honey price, 1 if not set
+}
+
+// Token is an ERC20 token accepted for payments besides the token of the default chequebook
+type Token struct {
+	Address    common.Address    // address of the ERC20 token contract
+	Rate       uint64            // token units paid for one unit of the honey price
+	Chequebook contract.Contract // chequebook of the node holding the token
+}
+
+// bindTokens binds to the chequebooks of the additional payment tokens
+func (s *Swap) bindTokens(params []TokenParams) (tokens []*Token, err error) {
+	defaultToken, err := s.contract.Token(nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[common.Address]bool{defaultToken: true}
+	for _, p := range params {
+		chequebook, err := contract.InstanceAt(p.Chequebook, s.backend)
+		if err != nil {
+			return nil, err
+		}
+		issuer, err := chequebook.Issuer(nil)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != s.owner.address {
+			return nil, fmt.Errorf("chequebook %x is not owned by %x", p.Chequebook, s.owner.address)
+		}
+		address, err := chequebook.Token(nil)
+		if err != nil {
+			return nil, err
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("chequebook %x holds token %x which is already configured", p.Chequebook, address)
+		}
+		seen[address] = true
+		rate := p.Rate
+		if rate == 0 {
+			rate = 1
+		}
+		s.logger.Info(InitAction, "bound to token chequebook", "chequebookAddr", p.Chequebook, "token", address, "rate", rate)
+		tokens = append(tokens, &Token{
+			Address:    address,
+			Rate:       rate,
+			Chequebook: chequebook,
+		})
+	}
+	return tokens, nil
+}
+
+// tokenChequebooks returns the chequebooks of the additional payment tokens announced in the handshake
+func (s *Swap) tokenChequebooks() (chequebooks []TokenChequebook) {
+	for _, t := range s.tokens {
+		chequebooks = append(chequebooks, TokenChequebook{
+			Token:    t.Address,
+			Contract: t.Chequebook.ContractParams().ContractAddress,
+		})
+	}
+	return chequebooks
+}
+
+// negotiateToken chooses the token used for payments with a peer which offered the given chequebooks.
+// The token with the lowest sum of preference ranks of both peers is chosen, the default token
+// having the lowest preference for both. Ties are broken by the lower token address,
+// so that both peers choose the same token. It returns nil for the default token.
+func (s *Swap) negotiateToken(offered []TokenChequebook) (token *Token, chequebook common.Address) {
+	best := len(s.tokens) + len(offered)
+	for i, t := range s.tokens {
+		for j, o := range offered {
+			if o.Token != t.Address {
+				continue
+			}
+			rank := i + j
+			if rank < best || (token != nil && rank == best && bytes.Compare(t.Address[:], token.Address[:]) < 0) {
+				best = rank
+				token = t
+				chequebook = o.Contract
+			}
+		}
+	}
+	return token, chequebook
+}
+
+// verifyTokenChequebook verifies that the chequebook holds the token and is owned by the issuer
+func (s *Swap) verifyTokenChequebook(ctx context.Context, address common.Address, token *Token, issuer common.Address) error {
+	chequebook, err := contract.InstanceAt(address, s.backend)
+	if err != nil {
+		return err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	chequebookToken, err := chequebook.Token(opts)
+	if err != nil {
+		return err
+	}
+	chequebookIssuer, err := chequebook.Issuer(opts)
+	if err != nil {
+		return err
+	}
+	if chequebookToken != token.Address || chequebookIssuer != issuer {
+		return ErrInvalidTokenChequebook
+	}
+	return nil
+}
+
+// price returns the amount of token units to be paid for the honey
+// a nil token denotes the token of the default chequebook
+func (s *Swap) price(token *Token, honey uint64) (uint64, error) {
+	price, err := s.honeyPriceOracle.GetPrice(honey)
+	if err != nil {
+		return 0, err
+	}
+	if token == nil {
+		return price, nil
+	}
+	if price > math.MaxUint64/token.Rate {
+		return 0, fmt.Errorf("price of %d honey overflows in token %x", honey, token.Address)
+	}
+	return price * token.Rate, nil
+}
@@ -35,10 +35,18 @@ type Cheque struct {
 	Signature []byte // signature Sign(Keccak256(contract, beneficiary, amount), prvKey)
 }
 
+// TokenChequebook is a chequebook holding an ERC20 token accepted for payments
+type TokenChequebook struct {
+	Token    common.Address // address of the ERC20 token contract
+	Contract common.Address // address of the chequebook
+}
+
 // HandshakeMsg is exchanged on peer handshake
 type HandshakeMsg struct {
-	ChainID         uint64         // chain id of the blockchain the peer is connected to
-	ContractAddress common.Address // chequebook contract address of the peer
+	ChainID         uint64            // chain id of the blockchain the peer is connected to
+	ContractAddress common.Address    // chequebook contract address of the peer
+	Chequebooks     []TokenChequebook // chequebooks of tokens accepted besides the default one, in order of preference
+	Prices          Prices            // current prices of the peer for the messages it is paid for
 }
 
 // EmitChequeMsg is sent from the debitor to the creditor with the actual cheque
@@ -46,6 +54,19 @@ type EmitChequeMsg struct {
 	Cheque *Cheque
 }
 
+// PricesMsg is sent to the peers when the prices of the node change
+type PricesMsg struct {
+	Prices Prices
+	Epoch  uint64 // epoch of the prices, increasing with every advertisement to the peer
+}
+
+// ConfirmPricesMsg is sent to the peer with the prices it advertised which the node accepted,
+// they price the messages of their epoch the node pays the peer for
+type ConfirmPricesMsg struct {
+	Prices Prices
+	Epoch  uint64 // epoch of the prices accepted
+}
+
 // ConfirmChequeMsg is sent from the creditor to the debitor with the cheque to confirm successful processing
 type ConfirmChequeMsg struct {
 	Cheque *Cheque
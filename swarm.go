@@ -18,6 +18,7 @@ package swarm
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
@@ -35,20 +36,33 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/api"
 	httpapi "github.com/ethersphere/swarm/api/http"
 	"github.com/ethersphere/swarm/bzzeth"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/contracts/ens"
+	"github.com/ethersphere/swarm/events"
+	"github.com/ethersphere/swarm/failover"
 	"github.com/ethersphere/swarm/fuse"
+	"github.com/ethersphere/swarm/handover"
 	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/metrics/history"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/bridge"
+	"github.com/ethersphere/swarm/network/custody"
+	"github.com/ethersphere/swarm/network/holepunch"
+	"github.com/ethersphere/swarm/network/quic"
 	"github.com/ethersphere/swarm/network/retrieval"
 	"github.com/ethersphere/swarm/network/stream"
 	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/pinservice"
+	"github.com/ethersphere/swarm/postage"
 	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/discovery"
 	pssmessage "github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/pss/trojan"
 	"github.com/ethersphere/swarm/pushsync"
 	"github.com/ethersphere/swarm/state"
 	"github.com/ethersphere/swarm/storage"
@@ -56,6 +70,8 @@ import (
 	"github.com/ethersphere/swarm/storage/localstore"
 	"github.com/ethersphere/swarm/storage/mock"
 	"github.com/ethersphere/swarm/storage/pin"
+	"github.com/ethersphere/swarm/storage/recovery"
+	"github.com/ethersphere/swarm/supervisor"
 	"github.com/ethersphere/swarm/swap"
 	"github.com/ethersphere/swarm/tracing"
 	rnsconfig "github.com/rnsdomains/rns-go-lib/config"
@@ -69,11 +85,21 @@ var (
 	uptimeGauge        = metrics.NewRegisteredGauge("stack/uptime", nil)
 )
 
+// how often the identity revocation list is reloaded
+var revocationListPeriod = time.Minute
+
+// how often the upload tags are persisted so that their progress survives a crash
+var tagsPersistPeriod = time.Minute
+
+// how long requests in flight are waited for when the http proxy is stopped
+var httpShutdownTimeout = 10 * time.Second
+
 // Swarm abstracts the complete Swarm stack
 type Swarm struct {
 	config            *api.Config        // swarm configuration
 	api               *api.API           // high level api layer (fs/manifest)
 	dns               api.Resolver       // DNS registrar
+	resolver          *api.MultiResolver // resolver chain of the DNS registrars, nil if none configured
 	rns               api.Resolver       // RNS registrar
 	fileStore         *storage.FileStore // distributed preimage archive, the local API to the storage with document level storage/retrieval support
 	streamer          *stream.Registry
@@ -84,15 +110,42 @@ type Swarm struct {
 	netStore          *storage.NetStore
 	sfs               *fuse.SwarmFS // need this to cleanup all the active mounts on node exit
 	ps                *pss.Pss
+	discovery         *discovery.Registry // registers and resolves named services of pss nodes
 	pushSync          *pushsync.Pusher
 	storer            *pushsync.Storer
 	swap              *swap.Swap
 	stateStore        *state.DBStore
 	tags              *chunk.Tags
 	accountingMetrics *protocols.AccountingMetrics
+	metering          *protocols.Metering
+	bandwidth         *protocols.Bandwidth
+	events            *events.Bus // bus of the node lifecycle and protocol events
 	cleanupFuncs      []func() error
 	pinAPI            *pin.API // API object implements all pinning related commands
 	inspector         *api.Inspector
+	supervisor        *supervisor.Supervisor // contains panics of the protocols of non-critical subsystems
+	postageIssuer     *postage.Issuer        // issues postage batches and stamps uploads, nil if postage is disabled
+	trojan            *trojan.Dispatcher     // sends and delivers trojan messages, nil if push sync is disabled
+	recoveryResponder func()                 // deregisters the responder re-uploading pinned chunks on recovery requests
+	pinService        *pinservice.PinService // requests pins from providers and serves them if the node is a provider
+	custody           *custody.Custody       // audits that neighbourhood peers store their chunks and proves custody to them
+	puncher           *holepunch.Puncher     // connects to peers behind NATs with hole punches and relayed connections
+	quic              *quic.Transport        // carries the connections of peers over QUIC, nil if disabled
+	bridge            *bridge.Bridge         // serves browsers joining as light peers over websocket, nil if disabled
+	failover          *failover.Node         // node of a warm standby failover pair, nil if not paired
+	stopPinCheck      func()                 // stops the periodic checks of the pins, nil if not running
+	pinRepairer       *pin.Repairer          // re-uploads the chunks of the pins missing from the network
+	stopPinRepair     func()                 // stops the periodic repairs of the pins, nil if not running
+	feeds             *feed.Handler          // looks up and publishes feed updates
+	feedScheduler     *feed.Scheduler        // publishes feed updates signed for future epochs when they are due
+	gateway           *httpapi.Gateway       // enforces the gateway policy on HTTP and pss rpc clients, nil if not a gateway
+	contentTypes      *httpapi.ContentTypes  // determines the content types of the files served over HTTP
+	auth              *httpapi.Auth          // verifies the API tokens of the HTTP API, nil if authentication is disabled
+	quota             *httpapi.Quota         // holds the accounts of the API tokens to their quota, nil if disabled
+	metricsHistory    *history.Recorder      // keeps the recent history of the metrics, nil if disabled
+	httpServer        *http.Server           // serves the http proxy, nil if it is not listening
+
+	identity *network.SignatureIdentity // verifies the identities of peers in private swarms, nil if not configured
 
 	tracerClose io.Closer
 }
@@ -113,6 +166,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		config:       config,
 		privateKey:   config.ShiftPrivateKey(),
 		cleanupFuncs: []func() error{},
+		events:       events.NewBus(),
 	}
 	log.Debug("Setting up Swarm service components")
 
@@ -123,6 +177,32 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		LightNode:    config.LightNodeEnabled,
 		BootnodeMode: config.BootnodeMode,
 		SyncEnabled:  config.SyncEnabled,
+		Zone:         config.Zone,
+		// capabilities advertised in the handshake, peers filter the candidates for routing by them
+		PssRelayDisabled: config.PssRelayDisabled,
+		MediaStream:      config.Port != "",
+		NatRelay:         config.NatRelay,
+		Quic:             config.QuicListenAddr != "",
+		AltUnderlays:     config.AltUnderlays,
+	}
+	if len(config.IdentityAuthorities) > 0 {
+		// only nodes with credentials issued by the authorities join the private swarm
+		self.identity = network.NewSignatureIdentity(common.FromHex(config.IdentityCredential), config.IdentityAuthorities)
+		if config.IdentityRevocationList != "" {
+			if err := self.identity.LoadRevocationList(config.IdentityRevocationList); err != nil {
+				return nil, fmt.Errorf("loading identity revocation list: %v", err)
+			}
+		}
+		bzzconfig.Identity = self.identity
+	}
+	if config.NetworkKey != "" {
+		// only nodes configured with the network key join the private swarm
+		if config.NetworkKeyPrevious != "" {
+			bzzconfig.NetworkKey = network.NewNetworkKey(common.FromHex(config.NetworkKeyPrevious))
+			bzzconfig.NetworkKey.Rotate(common.FromHex(config.NetworkKey), config.NetworkKeyGrace)
+		} else {
+			bzzconfig.NetworkKey = network.NewNetworkKey(common.FromHex(config.NetworkKey))
+		}
 	}
 
 	// Swap initialization
@@ -137,6 +217,8 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 			LogLevel:            self.config.SwapLogLevel,
 			DisconnectThreshold: int64(self.config.SwapDisconnectThreshold),
 			PaymentThreshold:    int64(self.config.SwapPaymentThreshold),
+			Tokens:              self.config.SwapTokens,
+			PriceOracle:         &self.config.SwapPriceOracle,
 		}
 
 		// create the accounting objects
@@ -153,8 +235,27 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		if err != nil {
 			return nil, err
 		}
+		self.swap.SetEvents(self.events)
 		// start anonymous metrics collection
 		self.accountingMetrics = protocols.SetupAccountingMetrics(10*time.Second, filepath.Join(config.Path, "metrics.db"))
+	} else if config.MeteringEnabled {
+		// meter the traffic with peers without settling it
+		self.metering = protocols.NewMetering(&protocols.MeteringParams{
+			SoftLimit:   config.MeteringSoftLimit,
+			RefreshRate: config.MeteringRefreshRate,
+		})
+		self.accountingMetrics = protocols.SetupAccountingMetrics(10*time.Second, filepath.Join(config.Path, "metrics.db"))
+	}
+
+	// limit the bandwidth of the protocols transferring chunks
+	self.bandwidth, err = protocols.NewBandwidth(&protocols.BandwidthLimits{
+		Upload:       config.BandwidthUpload,
+		Download:     config.BandwidthDownload,
+		PeerUpload:   config.BandwidthPeerUpload,
+		PeerDownload: config.BandwidthPeerDownload,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	config.HiveParams.Discovery = true
@@ -171,7 +272,9 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	// set up high level api
 	var resolver *api.MultiResolver
 	if len(config.EnsAPIs) > 0 {
-		opts := []api.MultiResolverOption{}
+		opts := []api.MultiResolverOption{
+			api.MultiResolverOptionWithCacheTTL(api.DefaultResolverCacheTTL, ""),
+		}
 		for _, c := range config.EnsAPIs {
 			tld, endpoint, addr := parseResolverAPIAddress(c)
 			r, err := newEnsClient(endpoint, addr, config, self.privateKey)
@@ -181,8 +284,16 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 			opts = append(opts, api.MultiResolverOptionWithResolver(r, tld))
 
 		}
+		for _, c := range config.EnsCacheTTLs {
+			tld, ttl, err := parseResolverCacheTTL(c)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, api.MultiResolverOptionWithCacheTTL(ttl, tld))
+		}
 		resolver = api.NewMultiResolver(opts...)
 		self.dns = resolver
+		self.resolver = resolver
 	}
 	if config.RnsAPI != "" {
 		var contractAddress string
@@ -195,17 +306,35 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	}
 
 	// check that we are not in the old database schema
-	// if so - fail and exit
+	// if so - migrate it if opted in, otherwise fail and exit
 	isLegacy := localstore.IsLegacyDatabase(config.ChunkDbPath)
 
 	if isLegacy {
-		return nil, errors.New("Legacy database format detected! Please read the migration announcement at: https://github.com/ethersphere/swarm/blob/master/docs/Migration-v0.3-to-v0.4.md")
+		if !config.MigrateLegacyDB {
+			return nil, errors.New("Legacy database format detected! Start with --migrate-legacy-db or run swarm db import-legacy to migrate it, and read the migration announcement at: https://github.com/ethersphere/swarm/blob/master/docs/Migration-v0.3-to-v0.4.md")
+		}
+		log.Info("migrating legacy database", "path", config.ChunkDbPath)
+		backup, count, err := localstore.MigrateLegacyDatadir(config.ChunkDbPath, config.BaseKey, &localstore.Options{
+			Capacity: config.DbCapacity,
+			Backend:  config.ChunkStoreBackend,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migrate legacy database: %v", err)
+		}
+		log.Info("migrated legacy database", "chunks", count, "backup", backup)
 	}
 
 	var feedsHandler *feed.Handler
-	fhParams := &feed.HandlerParams{}
+	fhParams := &feed.HandlerParams{
+		HintStore: self.stateStore,
+	}
 
 	feedsHandler = feed.NewHandler(fhParams)
+	self.feeds = feedsHandler
+	self.feedScheduler, err = feed.NewScheduler(feedsHandler, self.stateStore)
+	if err != nil {
+		return nil, err
+	}
 	self.tags = chunk.NewTags()
 	err = self.stateStore.Get("tags", self.tags)
 	if err != nil {
@@ -222,12 +351,37 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		common.FromHex(config.BzzKey),
 		network.NewKadParams(),
 	)
-
+	labels, err := network.NewPeerLabels(self.stateStore)
+	if err != nil {
+		return nil, err
+	}
+	to.SetPeerLabels(labels)
+	// the reputation of peers evicts the worst behaving ones from overfull bins and steers retrievals
+	to.SetPeerScores(network.NewPeerScores())
+
+	var coldTier localstore.Backend
+	if config.ColdStoreEndpoint != "" {
+		coldTier, err = localstore.NewS3Backend(localstore.S3Config{
+			Endpoint:  config.ColdStoreEndpoint,
+			Bucket:    config.ColdStoreBucket,
+			Region:    config.ColdStoreRegion,
+			AccessKey: config.ColdStoreAccessKey,
+			SecretKey: config.ColdStoreSecretKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 	localStore, err := localstore.New(config.ChunkDbPath, config.BaseKey, &localstore.Options{
-		MockStore:    mockStore,
-		Capacity:     config.DbCapacity,
-		Tags:         self.tags,
-		PutToGCCheck: to.IsWithinDepth,
+		MockStore:     mockStore,
+		Capacity:      config.DbCapacity,
+		CacheCapacity: config.CacheCapacity,
+		Tags:          self.tags,
+		PutToGCCheck:  to.IsWithinDepth,
+		Backend:       config.ChunkStoreBackend,
+		ColdTier:      coldTier,
+		HotCapacity:   config.DbHotCapacity,
+		Events:        self.events,
 	})
 	if err != nil {
 		return nil, err
@@ -239,48 +393,190 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	)
 
 	self.netStore = storage.NewNetStore(lstore, bzzconfig.Address)
-	self.retrieval = retrieval.New(to, self.netStore, bzzconfig.Address, self.swap)
+	var balance protocols.Balance
+	if self.swap != nil {
+		balance = self.swap
+	} else if self.metering != nil {
+		balance = self.metering
+	}
+	self.retrieval = retrieval.New(to, self.netStore, bzzconfig.Address, balance)
+	if config.ZonePreferred {
+		self.retrieval.PreferZone(config.Zone)
+	}
+	self.retrieval.SetBandwidth(self.bandwidth)
 	self.netStore.RemoteGet = self.retrieval.RequestFromPeers
 
 	feedsHandler.SetStore(self.netStore)
 
+	// light nodes keep the sync provider running so that they can switch to full mode
+	// at runtime, streams are only negotiated while the node advertises storing chunks
 	syncing := true
-	if !config.SyncEnabled || config.LightNodeEnabled || config.BootnodeMode {
+	if !config.SyncEnabled || config.BootnodeMode {
 		syncing = false
 	}
 
-	syncProvider := stream.NewSyncProvider(self.netStore, to, bzzconfig.Address, syncing, false)
+	var syncFilter *stream.SyncFilter
+	if config.SyncMinPO > 0 || config.SyncMaxPO > 0 || len(config.SyncTags) > 0 {
+		syncFilter = &stream.SyncFilter{
+			MinPO: config.SyncMinPO,
+			MaxPO: config.SyncMaxPO,
+			Tags:  config.SyncTags,
+		}
+	}
+	// postage stamps are validated on push and pull syncing and uploads are stamped
+	// with the batch of the request, chunks are still accepted without stamps unless required
+	var stamps chunk.StampValidator
+	var putterStore chunk.Store = localStore
+	if config.PostageEnabled {
+		batches := postage.NewLocalBatchStore(self.stateStore)
+		self.postageIssuer = postage.NewIssuer(self.privateKey, batches)
+		issuers := append([]common.Address{self.postageIssuer.Owner()}, config.PostageIssuers...)
+		stamps = postage.NewValidator(batches, issuers, config.PostageRequired)
+		putterStore = postage.NewStampingStore(localStore, self.postageIssuer)
+	}
+
+	syncProvider := stream.NewSyncProviderWithFilter(self.netStore, to, bzzconfig.Address, syncing, false, syncFilter, stamps)
 	self.streamer = stream.New(self.stateStore, bzzconfig.Address, syncProvider)
+	self.streamer.SetPeerScores(to.PeerScores())
+	self.streamer.SetBandwidth(self.bandwidth)
+	self.streamer.SetEvents(self.events)
 
 	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage
 	lnetStore := storage.NewLNetStore(self.netStore)
-	self.fileStore = storage.NewFileStore(lnetStore, localStore, self.config.FileStoreParams, self.tags)
+	self.fileStore = storage.NewFileStore(lnetStore, putterStore, self.config.FileStoreParams, self.tags)
 
 	log.Debug("Setup local storage")
 	self.bzz = network.NewBzz(bzzconfig, to, self.stateStore, stream.Spec, self.retrieval.Spec(), self.streamer.Run, self.retrieval.Run)
 	self.bzzEth = bzzeth.New(self.netStore, to)
+	self.custody = custody.New(self.bzz, localStore)
+	self.supervisor = supervisor.New(supervisor.NewParams())
 
 	// Pss = postal service over swarm (devp2p over bzz)
 	self.ps, err = pss.New(to, config.Pss)
 	if err != nil {
 		return nil, err
 	}
+	self.ps.SetBandwidth(self.bandwidth)
+	if err := self.ps.SetRatchetStore(self.stateStore); err != nil {
+		return nil, err
+	}
+	if err := self.ps.SetCacheStore(self.stateStore); err != nil {
+		return nil, err
+	}
 	if pss.IsActiveHandshake {
 		pss.SetHandshakeController(self.ps, pss.NewHandshakeParams())
 	}
+	self.discovery = discovery.New(feedsHandler, self.privateKey)
+	// peers the hive fails to dial are signaled over pss to punch holes in their NATs
+	self.puncher = holepunch.New(self.bzz, pss.NewPubSub(self.ps, holepunch.SignalTTL), config.NatRelay)
+	self.bzz.Hive.SetPuncher(self.puncher.Punch)
+	if len(config.Bootnodes) > 0 || len(config.BootnodeTrees) > 0 {
+		self.bzz.Hive.SetBootnodes(network.NewBootnodes(config.Bootnodes, config.BootnodeTrees))
+	}
+	if config.Bridge {
+		self.bridge = bridge.New(to, self.netStore, pss.NewPubSub(self.ps, bridge.MessageTTL))
+	}
+	if config.GatewayEnabled {
+		self.gateway, err = httpapi.NewGateway(httpapi.GatewayPolicy{
+			RequestsPerMinute: config.GatewayRequestsPerMinute,
+			MaxUploadSize:     config.GatewayMaxUploadSize,
+			BandwidthQuota:    config.GatewayBandwidthQuota,
+			BlockedTopics:     config.GatewayBlockedTopics,
+			AnonymousUploads:  !config.GatewayNoAnonymousUploads,
+			UploadTokens:      config.GatewayUploadTokens,
+		})
+		if err != nil {
+			return nil, err
+		}
+		self.ps.SetTopicFilter(self.gateway.TopicBlocked)
+	}
+	self.contentTypes, err = httpapi.NewContentTypes(config.ContentTypePipeline, config.ContentTypeOverrides)
+	if err != nil {
+		return nil, err
+	}
+	if config.AuthEnabled {
+		self.auth, err = httpapi.NewAuth(self.stateStore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.QuotaEnabled {
+		if self.auth == nil {
+			return nil, errors.New("quota requires API token authentication")
+		}
+		self.quota, err = httpapi.NewQuota(self.stateStore, httpapi.QuotaLimits{
+			UploadBytes: config.QuotaUploadBytes,
+			PinnedBytes: config.QuotaPinnedBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if config.PushSyncEnabled {
 		// expire time for push-sync messages should be lower than regular chat-like messages to avoid network flooding
 		pubsub := pss.NewPubSub(self.ps, 20*time.Second)
 		self.pushSync = pushsync.NewPusher(localStore, pubsub, self.tags)
-		self.storer = pushsync.NewStorer(self.netStore, pubsub)
+		// uploads with deduplication enabled probe the custody of the chunks in their neighbourhood
+		self.pushSync.SetProbe(self.custody.Stored)
+		self.storer = pushsync.NewStorer(self.netStore, pubsub, self.privateKey, stamps)
+		self.storer.SetActive(to.IsStorer)
+
+		// requests to recover missing content are sent as trojan chunks that are
+		// push synced to the neighbourhoods given by the downloader
+		self.trojan = trojan.NewDispatcher(putterStore)
+		self.netStore.Synced = self.trojan.Deliver
+		self.netStore.Recover = recovery.NewRecoverFunc(self.trojan)
 	}
 
 	self.api = api.NewAPI(self.fileStore, self.dns, self.rns, feedsHandler, self.privateKey, self.tags)
+	self.api.FeedScheduler = self.feedScheduler
+	self.api.Kademlia = to
+	if config.DNSLinkEnabled {
+		self.api.DNSLink = api.NewDNSLink(api.DefaultDNSLinkTTL, nil)
+	}
+	if !config.PopularityDisabled && config.PopularityWindow > 0 {
+		self.api.Popularity = api.NewPopularity(config.PopularityWindow, config.PopularityThreshold)
+	}
+	if config.MetricsHistoryEnabled {
+		self.metricsHistory = history.NewRecorder(metrics.DefaultRegistry, config.MetricsHistoryInterval, config.MetricsHistoryRetention, history.DefaultSeries)
+	}
 
 	if config.EnablePinning {
 		// Instantiate the pinAPI object with the already opened localstore
 		self.pinAPI = pin.NewAPI(localStore, self.stateStore, self.config.FileStoreParams, self.tags, self.api)
+		self.pinRepairer = pin.NewRepairer(self.pinAPI, self.netStore)
+		if self.trojan != nil {
+			self.recoveryResponder = recovery.NewResponder(self.trojan, localStore)
+		}
+	}
+	var pinProvider *pinservice.Provider
+	if config.EnablePinning && config.PinningProvider {
+		pinProvider = pinservice.NewProvider(self.api, self.fileStore, self.pinAPI, localStore)
+	}
+	self.pinService = pinservice.New(self.fileStore, pinProvider)
+
+	if config.FailoverPartner != "" {
+		// pins of the partner are fetched and pinned like the pins requested by peers
+		pinner := pinProvider
+		if pinner == nil && self.pinAPI != nil {
+			pinner = pinservice.NewProvider(self.api, self.fileStore, self.pinAPI, localStore)
+			self.cleanupFuncs = append(self.cleanupFuncs, func() error {
+				pinner.Close()
+				return nil
+			})
+		}
+		params := failover.NewParams()
+		if config.FailoverListenAddr != "" {
+			params.ListenAddr = config.FailoverListenAddr
+		}
+		params.Gateway = "http://" + net.JoinHostPort(config.ListenAddr, config.Port)
+		params.Partner = config.FailoverPartner
+		params.Primary = config.FailoverPrimary
+		self.failover, err = failover.New(params, to, self.pinAPI, pinner, feedsHandler)
+		if err != nil {
+			return nil, err
+		}
 	}
 	self.sfs = fuse.NewSwarmFS(self.api)
 	log.Debug("Initialized FUSE filesystem")
@@ -315,6 +611,21 @@ func parseResolverAPIAddress(s string) (tld, endpoint string, addr common.Addres
 	return
 }
 
+// parseResolverCacheTTL parses string according to format [tld:]duration
+// and returns the TLD and the duration the resolved names are cached for.
+func parseResolverCacheTTL(s string) (tld string, ttl time.Duration, err error) {
+	value := s
+	if i := strings.Index(value, ":"); i >= 0 {
+		tld = value[:i]
+		value = value[i+1:]
+	}
+	ttl, err = time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return "", 0, fmt.Errorf("invalid resolver cache TTL %q", s)
+	}
+	return tld, ttl, nil
+}
+
 // ensClient provides functionality for api.ResolveValidator
 type ensClient struct {
 	*ens.ENS
@@ -367,11 +678,22 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 	s.tracerClose = tracing.Closer
 
 	// update uaddr to correct enode
+	if s.quic != nil {
+		// the port of the QUIC listener is advertised with the underlay
+		if err := s.quic.Start(srv); err != nil {
+			return err
+		}
+		s.bzz.SetQuicPort(uint16(s.quic.Port()))
+	}
 	newaddr := s.bzz.UpdateLocalAddr([]byte(srv.Self().URLv4()))
 	log.Info("Updated bzz local addr", "oaddr", fmt.Sprintf("%x", newaddr.OAddr), "uaddr", fmt.Sprintf("%s", newaddr.UAddr))
 
 	log.Info("Starting bzz service")
 
+	// the hive punches holes once started
+	if err := s.puncher.Start(srv); err != nil {
+		return err
+	}
 	err := s.bzz.Start(srv)
 	if err != nil {
 		log.Error("bzz failed", "err", err)
@@ -384,6 +706,28 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 		return err
 	}
 
+	if s.failover != nil {
+		if err := s.failover.Start(); err != nil {
+			return err
+		}
+	}
+
+	s.feedScheduler.Start()
+	if s.metricsHistory != nil {
+		s.metricsHistory.Start()
+	}
+
+	if s.pinAPI != nil && s.config.PinCheckInterval > 0 {
+		s.stopPinCheck = s.pinAPI.StartCheck(s.config.PinCheckInterval, s.config.PinCheckFix)
+	}
+	if s.pinRepairer != nil && s.config.PinRepairInterval > 0 {
+		samples := s.config.PinRepairSamples
+		if samples <= 0 {
+			samples = pin.DefaultRepairSamples
+		}
+		s.stopPinRepair = s.pinRepairer.Start(s.config.PinRepairInterval, samples)
+	}
+
 	if s.ps != nil {
 		s.ps.Start(srv)
 	}
@@ -391,27 +735,46 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 	if s.config.Port != "" {
 		addr := net.JoinHostPort(s.config.ListenAddr, s.config.Port)
 		server := httpapi.NewServer(s.api, s.pinAPI, s.config.Cors)
+		if s.gateway != nil {
+			server.SetGateway(s.gateway)
+		}
+		server.SetContentTypes(s.contentTypes)
+		if s.auth != nil {
+			if err := server.SetAuth(s.auth, s.APIs()); err != nil {
+				return err
+			}
+			log.Info("Swarm HTTP proxy requires API tokens", "rpc", httpapi.RPCPath)
+		}
+		if s.quota != nil {
+			server.SetQuota(s.quota)
+		}
+		if s.bridge != nil {
+			server.SetBridge(s.bridge)
+			log.Info("Swarm HTTP proxy serves browser light peers", "path", httpapi.BridgePath)
+		}
 
 		if s.config.Cors != "" {
 			log.Info("Swarm HTTP proxy CORS headers", "allowedOrigins", s.config.Cors)
 		}
 
-		go func() {
-			// We need to use net.Listen because the addr could be on port '0',
-			// which means that the OS will allocate a port for us
-			listener, err := net.Listen("tcp", addr)
-			if err != nil {
-				log.Error("Could not open a port for Swarm HTTP proxy", "err", err.Error())
-				return
-			}
+		// We need to use a listener because the addr could be on port '0',
+		// which means that the OS will allocate a port for us, it is opened
+		// before Start returns so that one handed over is claimed
+		listener, err := handover.Listen("tcp", addr, "http")
+		if err != nil {
+			log.Error("Could not open a port for Swarm HTTP proxy", "err", err.Error())
+		} else {
 			s.config.Port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
 			log.Info("Starting Swarm HTTP proxy", "port", s.config.Port)
 
-			err = http.Serve(listener, server)
-			if err != nil {
-				log.Error("Could not start Swarm HTTP proxy", "err", err.Error())
-			}
-		}()
+			s.httpServer = &http.Server{Handler: server}
+			go func() {
+				err := s.httpServer.Serve(listener)
+				if err != nil && err != http.ErrServerClosed {
+					log.Error("Could not start Swarm HTTP proxy", "err", err.Error())
+				}
+			}()
+		}
 	}
 
 	doneC := make(chan struct{})
@@ -432,6 +795,39 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 		}
 	}(startTime)
 
+	go func() {
+		for {
+			select {
+			case <-time.After(tagsPersistPeriod):
+				if err := s.stateStore.Put("tags", s.tags); err != nil {
+					log.Error("could not persist tags", "err", err)
+				}
+			case <-doneC:
+				return
+			}
+		}
+	}()
+
+	if s.identity != nil && s.config.IdentityRevocationList != "" {
+		go func() {
+			for {
+				select {
+				case <-time.After(revocationListPeriod):
+					if err := s.identity.LoadRevocationList(s.config.IdentityRevocationList); err != nil {
+						log.Error("could not reload identity revocation list", "err", err)
+						continue
+					}
+					s.bzz.RevalidatePeers()
+				case <-doneC:
+					return
+				}
+			}
+		}()
+	}
+
+	go s.publishPeerEvents(srv, doneC)
+	go s.publishDepthEvents(doneC)
+
 	startCounter.Inc(1)
 	if err := s.streamer.Start(srv); err != nil {
 		return err
@@ -439,6 +835,51 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 	return s.retrieval.Start(srv)
 }
 
+// publishPeerEvents publishes the peers added to and dropped by the server on the event bus
+// and unregisters the metering gauges of the dropped peers
+func (s *Swarm) publishPeerEvents(srv *p2p.Server, quit chan struct{}) {
+	peerEvents := make(chan *p2p.PeerEvent, 64)
+	sub := srv.SubscribeEvents(peerEvents)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case e := <-peerEvents:
+			switch e.Type {
+			case p2p.PeerEventTypeAdd:
+				s.events.Publish(events.PeerAdded, &events.PeerData{Peer: e.Peer.String()})
+			case p2p.PeerEventTypeDrop:
+				s.events.Publish(events.PeerDropped, &events.PeerData{Peer: e.Peer.String(), Reason: e.Error})
+				if s.metering != nil {
+					s.metering.RemovePeer(e.Peer)
+				}
+			}
+		case <-sub.Err():
+			return
+		case <-quit:
+			return
+		}
+	}
+}
+
+// publishDepthEvents publishes the changes of the neighbourhood depth on the event bus
+func (s *Swarm) publishDepthEvents(quit chan struct{}) {
+	c, unsubscribe := s.bzz.Hive.Kademlia.SubscribeToNeighbourhoodDepthChange()
+	defer unsubscribe()
+	depth := s.bzz.Hive.Kademlia.NeighbourhoodDepth()
+	for {
+		select {
+		case <-c:
+			previous := depth
+			depth = s.bzz.Hive.Kademlia.NeighbourhoodDepth()
+			if depth != previous {
+				s.events.Publish(events.DepthChanged, &events.DepthData{Depth: depth, Previous: previous})
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
 // Stop stops all component services.
 // Implements the node.Service interface.
 func (s *Swarm) Stop() error {
@@ -450,10 +891,36 @@ func (s *Swarm) Stop() error {
 		}
 	}
 
+	if s.bridge != nil {
+		// websocket connections of the bridge are hijacked and not closed by the shutdown
+		s.bridge.Stop()
+	}
+	if s.httpServer != nil {
+		// stop accepting connections and let the requests in flight complete
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			log.Error("http proxy shutdown", "err", err)
+		}
+		cancel()
+	}
 	if s.pushSync != nil {
 		s.pushSync.Close()
 	}
+	s.feedScheduler.Stop()
+	s.discovery.Close()
+	if s.metricsHistory != nil {
+		s.metricsHistory.Stop()
+	}
 
+	s.supervisor.Close()
+	if err := s.puncher.Stop(); err != nil {
+		log.Error("puncher stop", "err", err)
+	}
+	if s.quic != nil {
+		if err := s.quic.Stop(); err != nil {
+			log.Error("quic stop", "err", err)
+		}
+	}
 	if s.ps != nil {
 		s.ps.Stop()
 	}
@@ -482,6 +949,10 @@ func (s *Swarm) Stop() error {
 		s.storer.Close()
 	}
 
+	if s.recoveryResponder != nil {
+		s.recoveryResponder()
+	}
+
 	if s.netStore != nil {
 		s.netStore.Close()
 	}
@@ -493,6 +964,25 @@ func (s *Swarm) Stop() error {
 		log.Error("error during bzz-eth shutdown", "err", err)
 	}
 
+	err = s.pinService.Stop()
+	if err != nil {
+		log.Error("error during pinservice shutdown", "err", err)
+	}
+
+	if s.stopPinCheck != nil {
+		s.stopPinCheck()
+	}
+	if s.stopPinRepair != nil {
+		s.stopPinRepair()
+	}
+
+	if s.failover != nil {
+		err = s.failover.Stop()
+		if err != nil {
+			log.Error("error during failover shutdown", "err", err)
+		}
+	}
+
 	err = s.bzz.Stop()
 	if s.stateStore != nil {
 		s.stateStore.Close()
@@ -514,10 +1004,13 @@ func (s *Swarm) Protocols() (protos []p2p.Protocol) {
 		protos = append(protos, s.bzz.Protocols()...)
 	} else {
 		protos = append(protos, s.bzz.Protocols()...)
-		protos = append(protos, s.bzzEth.Protocols()...)
+		protos = append(protos, s.supervisor.Protocols("bzzeth", s.bzzEth.Protocols())...)
 		if s.ps != nil {
-			protos = append(protos, s.ps.Protocols()...)
+			protos = append(protos, s.supervisor.Protocols("pss", s.ps.Protocols())...)
 		}
+		protos = append(protos, s.supervisor.Protocols("pinservice", s.pinService.Protocols())...)
+		protos = append(protos, s.supervisor.Protocols("custody", s.custody.Protocols())...)
+		protos = append(protos, s.supervisor.Protocols("holepunch", s.puncher.Protocols())...)
 
 		if s.swap != nil {
 			protos = append(protos, s.swap.Protocols()...)
@@ -556,6 +1049,42 @@ func (s *Swarm) APIs() []rpc.API {
 			Service:   protocols.NewAccountingApi(s.accountingMetrics),
 			Public:    false,
 		},
+		{
+			Namespace: "admin",
+			Version:   events.APIVersion,
+			Service:   events.NewAPI(s.events),
+			Public:    false,
+		},
+		{
+			Namespace: "bandwidth",
+			Version:   protocols.BandwidthVersion,
+			Service:   protocols.NewBandwidthApi(s.bandwidth),
+			Public:    false,
+		},
+		{
+			Namespace: "capture",
+			Version:   protocols.CaptureVersion,
+			Service:   protocols.NewCaptureApi(),
+			Public:    false,
+		},
+		{
+			Namespace: "feed",
+			Version:   feed.APIVersion,
+			Service:   feed.NewAPI(s.feeds, s.feedScheduler),
+			Public:    true,
+		},
+		{
+			Namespace: "tags",
+			Version:   api.TagsAPIVersion,
+			Service:   api.NewTagsAPI(s.tags),
+			Public:    false,
+		},
+		{
+			Namespace: "swarm",
+			Version:   api.HashAPIVersion,
+			Service:   api.NewHashAPI(),
+			Public:    false,
+		},
 	}
 
 	apis = append(apis, s.bzz.APIs()...)
@@ -565,19 +1094,123 @@ func (s *Swarm) APIs() []rpc.API {
 	if s.config.SyncEnabled {
 		apis = append(apis, s.streamer.APIs()...)
 	}
+	apis = append(apis, s.retrieval.APIs()...)
 	apis = append(apis, s.bzzEth.APIs()...)
+	apis = append(apis, s.pinService.APIs()...)
+	apis = append(apis, s.custody.APIs()...)
 
 	if s.ps != nil {
 		apis = append(apis, s.ps.APIs()...)
+		apis = append(apis, s.discovery.APIs()...)
 	}
 
 	if s.config.SwapEnabled {
 		apis = append(apis, s.swap.APIs()...)
 	}
 
+	if s.postageIssuer != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "postage",
+			Version:   postage.APIVersion,
+			Service:   postage.NewAPI(s.postageIssuer),
+			Public:    false,
+		})
+	}
+
+	if s.auth != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "auth",
+			Version:   httpapi.AuthAPIVersion,
+			Service:   httpapi.NewAuthAPI(s.auth),
+			Public:    false,
+		})
+	}
+
+	if s.quota != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "quota",
+			Version:   httpapi.QuotaAPIVersion,
+			Service:   httpapi.NewQuotaAPI(s.quota),
+			Public:    false,
+		})
+	}
+
+	if s.gateway != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "gateway",
+			Version:   httpapi.GatewayAPIVersion,
+			Service:   httpapi.NewGatewayAPI(s.gateway),
+			Public:    false,
+		})
+	}
+
+	if s.metricsHistory != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "metrics",
+			Version:   history.APIVersion,
+			Service:   history.NewAPI(s.metricsHistory),
+			Public:    false,
+		})
+	}
+
+	if s.metering != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "metering",
+			Version:   protocols.AccountingVersion,
+			Service:   protocols.NewMeteringApi(s.metering),
+			Public:    false,
+		})
+	}
+
+	if s.pushSync != nil {
+		apis = append(apis, s.pushSync.APIs()...)
+	}
+
+	if s.resolver != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "resolver",
+			Version:   api.ResolverAPIVersion,
+			Service:   api.NewResolverAPI(s.resolver),
+			Public:    false,
+		})
+	}
+
+	if s.pinAPI != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "pin",
+			Version:   pin.Version,
+			Service:   pin.NewCheckAPI(s.pinAPI),
+			Public:    false,
+		}, rpc.API{
+			Namespace: "pin",
+			Version:   pin.Version,
+			Service:   pin.NewRepairAPI(s.pinRepairer),
+			Public:    false,
+		})
+	}
+
 	return apis
 }
 
+// SetQuic sets the transport carrying the connections of peers over QUIC, which must be
+// the dialer of the p2p server; peers advertising the capability are dialed on their QUIC port
+func (s *Swarm) SetQuic(t *quic.Transport) {
+	s.quic = t
+	t.SetPorts(func(node *enode.Node) int {
+		var port int
+		s.bzz.EachAddr(nil, 256, func(addr *network.BzzAddr, _ int) bool {
+			if addr.ID() != node.ID() {
+				return true
+			}
+			if network.IsQuic(addr) {
+				port = int(addr.QuicPort)
+			}
+			return false
+		})
+		return port
+	})
+}
+
 // RegisterPssProtocol adds a devp2p protocol to the swarm node's Pss instance
 func (s *Swarm) RegisterPssProtocol(topic *pssmessage.Topic, spec *protocols.Spec, targetprotocol *p2p.Protocol, options *pss.ProtocolParams) (*pss.Protocol, error) {
 	return pss.RegisterProtocol(s.ps, topic, spec, targetprotocol, options)
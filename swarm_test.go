@@ -349,6 +349,38 @@ func TestParseEnsAPIAddress(t *testing.T) {
 	}
 }
 
+// TestParseResolverCacheTTL validates parsing of the resolver cache TTLs
+// for a TLD or the default one.
+func TestParseResolverCacheTTL(t *testing.T) {
+	for _, x := range []struct {
+		value string
+		tld   string
+		ttl   time.Duration
+		err   bool
+	}{
+		{value: "5m", ttl: 5 * time.Minute},
+		{value: "eth:1h", tld: "eth", ttl: time.Hour},
+		{value: "test:0s", tld: "test"},
+		{value: "eth:", err: true},
+		{value: "eth:-1s", err: true},
+		{value: "forever", err: true},
+	} {
+		tld, ttl, err := parseResolverCacheTTL(x.value)
+		if x.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got none", x.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", x.value, err)
+		}
+		if tld != x.tld || ttl != x.ttl {
+			t.Errorf("%q: expected TLD %q and TTL %v, got %q and %v", x.value, x.tld, x.ttl, tld, ttl)
+		}
+	}
+}
+
 // TestLocalStoreAndRetrieve runs multiple tests where different size files are uploaded
 // to a single Swarm instance using API Store and checked against the content returned
 // by API Retrieve function.
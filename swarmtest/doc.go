@@ -0,0 +1,29 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package swarmtest provides in-memory test doubles of the main swarm components
+for applications embedding swarm to unit test against, without running nodes
+or the network simulations.
+
+ - ChunkStore, a chunk.Store keeping the chunks and the pull index in memory
+ - Fetcher, serving the retrievals of a storage.NetStore from a set of fake peers
+ - Kademlia, a network.Kademlia table populated with peers that are not connected
+ - PubSub, a pss pub/sub delivering the messages sent to the handlers registered locally
+
+None of them persist any state or do any network I/O.
+*/
+package swarmtest
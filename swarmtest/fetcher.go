@@ -0,0 +1,104 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swarmtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// Fetcher serves the retrieve requests of a storage.NetStore from fake peers.
+// Peers are requested in the order they were added, skipping the ones the request
+// was already sent to, and those storing the chunk deliver it to the NetStore.
+// Requests to peers not storing the chunk are never served.
+type Fetcher struct {
+	netStore *storage.NetStore
+	mu       sync.Mutex
+	peers    []enode.ID
+	chunks   map[enode.ID]map[string]chunk.Chunk
+	requests map[string][]enode.ID // peers requested, by chunk address
+}
+
+// NewFetcher creates a Fetcher with no peers and sets it as the RemoteGet of the NetStore
+func NewFetcher(n *storage.NetStore) *Fetcher {
+	f := &Fetcher{
+		netStore: n,
+		chunks:   make(map[enode.ID]map[string]chunk.Chunk),
+		requests: make(map[string][]enode.ID),
+	}
+	n.RemoteGet = f.RemoteGet
+	return f
+}
+
+// AddPeer adds a peer storing the chunks, or the chunks to the peer if it was added already
+func (f *Fetcher) AddPeer(id enode.ID, chs ...chunk.Chunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.chunks[id]; !ok {
+		f.peers = append(f.peers, id)
+		f.chunks[id] = make(map[string]chunk.Chunk)
+	}
+	for _, ch := range chs {
+		f.chunks[id][string(ch.Address())] = ch
+	}
+}
+
+// RemovePeer removes the peer, the requests it received are not served any more
+func (f *Fetcher) RemovePeer(id enode.ID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, p := range f.peers {
+		if p == id {
+			f.peers = append(f.peers[:i], f.peers[i+1:]...)
+			break
+		}
+	}
+	delete(f.chunks, id)
+}
+
+// Requests returns the peers requested the chunk with the address, in the order of the requests
+func (f *Fetcher) Requests(addr chunk.Address) []enode.ID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]enode.ID(nil), f.requests[string(addr)]...)
+}
+
+// RemoteGet implements storage.RemoteGetFunc
+func (f *Fetcher) RemoteGet(ctx context.Context, req *storage.Request, localID enode.ID) (*enode.ID, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range f.peers {
+		if id == req.Origin || id == localID {
+			continue
+		}
+		if _, skip := req.PeersToSkip.Load(id.String()); skip {
+			continue
+		}
+		key := string(req.Addr)
+		f.requests[key] = append(f.requests[key], id)
+		if ch, ok := f.chunks[id][key]; ok {
+			go f.netStore.Put(context.Background(), chunk.ModePutRequest, ch)
+		}
+		id := id
+		return &id, func() {}, nil
+	}
+	return nil, nil, storage.ErrNoSuitablePeer
+}
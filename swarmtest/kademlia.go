@@ -0,0 +1,60 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swarmtest
+
+import (
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pot"
+)
+
+// Kademlia is a network.Kademlia table of peers that are not connected, to be passed
+// where a kademlia or a network.KademliaBackend is needed. The peers can be iterated
+// and picked as connected ones, but they have no underlying p2p peer to send messages to.
+type Kademlia struct {
+	*network.Kademlia
+}
+
+// NewKademlia creates an empty Kademlia with the base address and default parameters
+func NewKademlia(base []byte) *Kademlia {
+	return &Kademlia{
+		Kademlia: network.NewKademlia(base, network.NewKadParams()),
+	}
+}
+
+// On inserts peers with the addresses as connected ones
+func (k *Kademlia) On(addrs ...*network.BzzAddr) []*network.Peer {
+	peers := make([]*network.Peer, len(addrs))
+	for i, addr := range addrs {
+		peers[i] = network.NewPeer(&network.BzzPeer{BzzAddr: addr}, k.Kademlia)
+		k.Kademlia.On(peers[i])
+	}
+	return peers
+}
+
+// OnAt inserts a connected peer with a random address at the proximity order to the base address
+func (k *Kademlia) OnAt(po int) *network.Peer {
+	oaddr := pot.RandomAddressAt(pot.NewAddressFromBytes(k.BaseAddr()), po)
+	addr := network.NewBzzAddr(oaddr.Bytes(), network.RandomBzzAddr().UAddr)
+	return k.On(addr)[0]
+}
+
+// Off removes the peers from the connected ones
+func (k *Kademlia) Off(peers ...*network.Peer) {
+	for _, p := range peers {
+		k.Kademlia.Off(p)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swarmtest
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Message is a message sent through the PubSub
+type Message struct {
+	To    []byte
+	Topic string
+	Msg   []byte
+}
+
+// PubSub is a loopback pss pub/sub, implementing the PubSub interfaces of the
+// pushsync and holepunch packages. Messages sent are recorded and passed to
+// all the handlers registered for their topic, with a peer of zero identifier.
+type PubSub struct {
+	base     []byte
+	mu       sync.Mutex
+	handlers map[string]map[int]func(msg []byte, p *p2p.Peer) error
+	nextID   int
+	sent     []Message
+}
+
+// NewPubSub creates a PubSub with the base address, which is the closest one to all addresses
+func NewPubSub(base []byte) *PubSub {
+	return &PubSub{
+		base:     base,
+		handlers: make(map[string]map[int]func(msg []byte, p *p2p.Peer) error),
+	}
+}
+
+// BaseAddr returns the base address
+func (ps *PubSub) BaseAddr() []byte {
+	return ps.base
+}
+
+// IsClosestTo returns true for any address, no other nodes are known
+func (ps *PubSub) IsClosestTo(addr []byte) bool {
+	return true
+}
+
+// Register registers a handler for the topic and returns the function deregistering it
+func (ps *PubSub) Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.handlers[topic] == nil {
+		ps.handlers[topic] = make(map[int]func(msg []byte, p *p2p.Peer) error)
+	}
+	id := ps.nextID
+	ps.nextID++
+	ps.handlers[topic][id] = handler
+	return func() {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		delete(ps.handlers[topic], id)
+	}
+}
+
+// Send records the message and calls the handlers registered for the topic,
+// returning the first error of the handlers
+func (ps *PubSub) Send(to []byte, topic string, msg []byte) error {
+	ps.mu.Lock()
+	ps.sent = append(ps.sent, Message{To: to, Topic: topic, Msg: msg})
+	var handlers []func(msg []byte, p *p2p.Peer) error
+	for _, h := range ps.handlers[topic] {
+		handlers = append(handlers, h)
+	}
+	ps.mu.Unlock()
+
+	p := p2p.NewPeer(enode.ID{}, "", nil)
+	for _, h := range handlers {
+		if err := h(msg, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sent returns the messages sent to the address, all messages if it is nil
+func (ps *PubSub) Sent(to []byte) []Message {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var msgs []Message
+	for _, m := range ps.sent {
+		if to == nil || bytes.Equal(m.To, to) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
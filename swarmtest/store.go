@@ -0,0 +1,227 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swarmtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethersphere/swarm/chunk"
+)
+
+// ChunkStore is an in-memory chunk.Store. Chunks are indexed for pull syncing
+// in the bins of their proximity to the base address, as in the localstore.
+type ChunkStore struct {
+	base   []byte
+	mu     sync.RWMutex
+	chunks map[string]chunk.Chunk
+	bins   [chunk.MaxPO + 1][]chunk.Descriptor // pull index, binIDs of a bin start at 1
+	pinned map[string]bool
+	synced map[string]bool
+	notify chan struct{} // closed and replaced on every put
+	closed bool
+}
+
+// NewChunkStore creates an empty ChunkStore with the base address used to bin the chunks
+func NewChunkStore(base []byte) *ChunkStore {
+	return &ChunkStore{
+		base:   base,
+		chunks: make(map[string]chunk.Chunk),
+		pinned: make(map[string]bool),
+		synced: make(map[string]bool),
+		notify: make(chan struct{}),
+	}
+}
+
+// Get returns the chunk with the address or chunk.ErrChunkNotFound
+func (s *ChunkStore) Get(_ context.Context, _ chunk.ModeGet, addr chunk.Address) (chunk.Chunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ch, ok := s.chunks[string(addr)]
+	if !ok {
+		return nil, chunk.ErrChunkNotFound
+	}
+	return ch, nil
+}
+
+// GetMulti returns the chunks with the addresses, failing if any of them is not stored
+func (s *ChunkStore) GetMulti(ctx context.Context, mode chunk.ModeGet, addrs ...chunk.Address) ([]chunk.Chunk, error) {
+	chs := make([]chunk.Chunk, len(addrs))
+	for i, addr := range addrs {
+		ch, err := s.Get(ctx, mode, addr)
+		if err != nil {
+			return nil, err
+		}
+		chs[i] = ch
+	}
+	return chs, nil
+}
+
+// Put stores the chunks and adds the new ones to the pull index
+func (s *ChunkStore) Put(_ context.Context, mode chunk.ModePut, chs ...chunk.Chunk) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exist := make([]bool, len(chs))
+	for i, ch := range chs {
+		key := string(ch.Address())
+		if _, ok := s.chunks[key]; ok {
+			exist[i] = true
+			continue
+		}
+		s.chunks[key] = ch
+		s.synced[key] = mode != chunk.ModePutUpload
+		bin := chunk.Proximity(s.base, ch.Address())
+		s.bins[bin] = append(s.bins[bin], chunk.Descriptor{
+			Address: ch.Address(),
+			BinID:   uint64(len(s.bins[bin]) + 1),
+			Tag:     ch.TagID(),
+		})
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return exist, nil
+}
+
+// Has reports whether the chunk with the address is stored
+func (s *ChunkStore) Has(_ context.Context, addr chunk.Address) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.chunks[string(addr)]
+	return ok, nil
+}
+
+// HasMulti reports whether the chunks with the addresses are stored
+func (s *ChunkStore) HasMulti(ctx context.Context, addrs ...chunk.Address) ([]bool, error) {
+	have := make([]bool, len(addrs))
+	for i, addr := range addrs {
+		have[i], _ = s.Has(ctx, addr)
+	}
+	return have, nil
+}
+
+// Set removes, pins, unpins or marks synced the chunks with the addresses.
+// Access and re-upload modes are no-ops.
+func (s *ChunkStore) Set(_ context.Context, mode chunk.ModeSet, addrs ...chunk.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, addr := range addrs {
+		key := string(addr)
+		switch mode {
+		case chunk.ModeSetRemove:
+			delete(s.chunks, key)
+			delete(s.pinned, key)
+			delete(s.synced, key)
+		case chunk.ModeSetPin:
+			s.pinned[key] = true
+		case chunk.ModeSetUnpin:
+			delete(s.pinned, key)
+		case chunk.ModeSetSyncPush, chunk.ModeSetSyncPull:
+			if _, ok := s.chunks[key]; ok {
+				s.synced[key] = true
+			}
+		}
+	}
+	return nil
+}
+
+// Pinned reports whether the chunk with the address is pinned
+func (s *ChunkStore) Pinned(addr chunk.Address) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pinned[string(addr)]
+}
+
+// Synced reports whether the chunk with the address is stored and synced,
+// chunks put with chunk.ModePutUpload are not synced until set so
+func (s *ChunkStore) Synced(addr chunk.Address) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synced[string(addr)]
+}
+
+// Len returns the number of chunks stored
+func (s *ChunkStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks)
+}
+
+// LastPullSubscriptionBinID returns the binID of the latest chunk put in the bin, 0 if it is empty
+func (s *ChunkStore) LastPullSubscriptionBinID(bin uint8) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.bins[bin])), nil
+}
+
+// SubscribePull delivers the descriptors of the chunks put in the bin with binIDs in
+// the [since, until] interval, waiting for new chunks if until is 0. The returned channel
+// is closed once until is reached, the context is done, the stop function is called or
+// the store is closed. Removed chunks are still delivered, as their binIDs are not reused.
+func (s *ChunkStore) SubscribePull(ctx context.Context, bin uint8, since, until uint64) (<-chan chunk.Descriptor, func()) {
+	c := make(chan chunk.Descriptor)
+	quit := make(chan struct{})
+	var once sync.Once
+	stop := func() { once.Do(func() { close(quit) }) }
+	if since == 0 {
+		since = 1
+	}
+	go func() {
+		defer close(c)
+		next := since
+		for {
+			s.mu.RLock()
+			descs := s.bins[bin]
+			notify, closed := s.notify, s.closed
+			s.mu.RUnlock()
+			for ; next <= uint64(len(descs)); next++ {
+				if until > 0 && next > until {
+					return
+				}
+				select {
+				case c <- descs[next-1]:
+				case <-quit:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+			if (until > 0 && next > until) || closed {
+				return
+			}
+			select {
+			case <-notify:
+			case <-quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, stop
+}
+
+// Close terminates the pull subscriptions
+func (s *ChunkStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.notify)
+		s.notify = make(chan struct{})
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package swarmtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// TestChunkStoreSubscribePull checks that pull subscriptions deliver the chunks
+// of their bin in the [since, until] interval, including the ones put later
+func TestChunkStoreSubscribePull(t *testing.T) {
+	s := NewChunkStore(make([]byte, 32))
+	defer s.Close()
+
+	// all chunks with an address starting with a set bit fall in bin 0
+	put := func(n int) error {
+		for i := 0; i < n; i++ {
+			ch := chunktesting.GenerateTestRandomChunk()
+			ch.Address()[0] |= 0x80
+			if _, err := s.Put(context.Background(), chunk.ModePutSync, ch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := put(3); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := s.LastPullSubscriptionBinID(0); last != 3 {
+		t.Fatalf("expected last bin id 3, got %v", last)
+	}
+
+	c, stop := s.SubscribePull(context.Background(), 0, 2, 4)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- put(2) }()
+	var ids []uint64
+	for d := range c {
+		ids = append(ids, d.BinID)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 2 || ids[2] != 4 {
+		t.Fatalf("expected bin ids 2 to 4, got %v", ids)
+	}
+}
+
+// TestFetcher checks that a NetStore retrieves chunks missing locally from the peers storing them
+func TestFetcher(t *testing.T) {
+	ns := storage.NewNetStore(NewChunkStore(make([]byte, 32)), network.NewBzzAddr(make([]byte, 32), nil))
+	f := NewFetcher(ns)
+	ch := chunktesting.GenerateTestRandomChunk()
+	empty, storer := enode.ID{1}, enode.ID{2}
+	f.AddPeer(empty)
+	f.AddPeer(storer, ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := ns.Get(ctx, chunk.ModeGetRequest, storage.NewRequest(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Data(), ch.Data()) {
+		t.Fatal("unexpected chunk data")
+	}
+	if reqs := f.Requests(ch.Address()); len(reqs) != 2 || reqs[0] != empty || reqs[1] != storer {
+		t.Fatalf("expected requests to %v and %v, got %v", empty, storer, reqs)
+	}
+	if has, _ := ns.Has(ctx, ch.Address()); !has {
+		t.Fatal("expected chunk to be stored")
+	}
+}
+
+// TestKademlia checks that the peers inserted are iterated as connected ones
+func TestKademlia(t *testing.T) {
+	k := NewKademlia(network.RandomBzzAddr().OAddr)
+	var peers []*network.Peer
+	for po := 0; po < 4; po++ {
+		peers = append(peers, k.OnAt(po))
+	}
+	k.Off(peers[0])
+
+	var pos []int
+	k.EachConn(nil, 255, func(p *network.Peer, po int) bool {
+		pos = append(pos, po)
+		return true
+	})
+	if len(pos) != 3 || pos[0] != 3 || pos[2] != 1 {
+		t.Fatalf("expected connected peers at po 3 to 1, got %v", pos)
+	}
+}
+
+// TestPubSub checks that messages are recorded and passed to the registered handlers of their topic
+func TestPubSub(t *testing.T) {
+	ps := NewPubSub(make([]byte, 32))
+	var got [][]byte
+	deregister := ps.Register("topic", false, func(msg []byte, _ *p2p.Peer) error {
+		got = append(got, msg)
+		return nil
+	})
+	errHandler := errors.New("handler error")
+	ps.Register("failing", false, func([]byte, *p2p.Peer) error {
+		return errHandler
+	})
+
+	to := []byte{1}
+	if err := ps.Send(to, "topic", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	deregister()
+	if err := ps.Send(to, "topic", []byte("gone")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Send(nil, "failing", nil); err != errHandler {
+		t.Fatalf("expected error %v, got %v", errHandler, err)
+	}
+	if len(got) != 1 || string(got[0]) != "hello" {
+		t.Fatalf("expected one message handled, got %q", got)
+	}
+	if sent := ps.Sent(to); len(sent) != 2 {
+		t.Fatalf("expected 2 messages sent to %x, got %v", to, len(sent))
+	}
+}